@@ -0,0 +1,58 @@
+// +build !confonly
+
+package commander
+
+import (
+	"context"
+	"crypto/subtle"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// tokenAuthenticator rejects gRPC calls without the expected bearer token, before they reach any service.
+type tokenAuthenticator struct {
+	token []byte
+}
+
+func (a *tokenAuthenticator) authenticate(ctx context.Context, method string) error {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for _, v := range md.Get("authorization") {
+			if len(v) > 7 && strings.EqualFold(v[:7], "bearer ") && subtle.ConstantTimeCompare([]byte(v[7:]), a.token) == 1 {
+				return nil
+			}
+		}
+	}
+
+	source := "unknown"
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		source = p.Addr.String()
+	}
+	newError("rejected unauthenticated call to ", method, " from ", source).AtWarning().WriteToLog()
+	return status.Error(codes.Unauthenticated, "invalid token")
+}
+
+func (a *tokenAuthenticator) unary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := a.authenticate(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (a *tokenAuthenticator) stream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := a.authenticate(ss.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+func (a *tokenAuthenticator) serverOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.UnaryInterceptor(a.unary),
+		grpc.StreamInterceptor(a.stream),
+	}
+}
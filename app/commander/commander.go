@@ -6,7 +6,10 @@ package commander
 
 import (
 	"context"
+	gotls "crypto/tls"
+	"crypto/x509"
 	"net"
+	"os"
 	"sync"
 
 	"google.golang.org/grpc"
@@ -15,6 +18,7 @@ import (
 	"v2ray.com/core/common"
 	"v2ray.com/core/common/signal/done"
 	"v2ray.com/core/features/outbound"
+	"v2ray.com/core/transport/internet/tls"
 )
 
 // Commander is a V2Ray feature that provides gRPC methods to external clients.
@@ -24,12 +28,18 @@ type Commander struct {
 	services []Service
 	ohm      outbound.Manager
 	tag      string
+	config   *Config
 }
 
 // NewCommander creates a new Commander based on the given config.
 func NewCommander(ctx context.Context, config *Config) (*Commander, error) {
+	if config.Tag == "" && config.Listen == "" && config.UnixSocket == "" {
+		return nil, newError("commander has neither tag nor listen address")
+	}
+
 	c := &Commander{
-		tag: config.Tag,
+		tag:    config.Tag,
+		config: config,
 	}
 
 	common.Must(core.RequireFeatures(ctx, func(om outbound.Manager) {
@@ -60,25 +70,119 @@ func (c *Commander) Type() interface{} {
 	return (*Commander)(nil)
 }
 
+// tlsConfig returns TLS settings for direct listeners, or nil if TLS is not enabled.
+func (c *Commander) tlsConfig() *gotls.Config {
+	if c.config.Tls == nil {
+		return nil
+	}
+
+	config := c.config.Tls.GetTLSConfig()
+	config.NextProtos = []string{"h2"}
+
+	clientCAs := x509.NewCertPool()
+	hasClientCA := false
+	for _, cert := range c.config.Tls.Certificate {
+		if cert.Usage == tls.Certificate_AUTHORITY_VERIFY && clientCAs.AppendCertsFromPEM(cert.Certificate) {
+			hasClientCA = true
+		}
+	}
+	if hasClientCA {
+		config.ClientCAs = clientCAs
+		config.ClientAuth = gotls.RequireAndVerifyClientCert
+	}
+	return config
+}
+
+// listen creates the direct listeners of the gRPC server.
+func (c *Commander) listen() ([]net.Listener, error) {
+	var listeners []net.Listener
+
+	if c.config.Listen != "" {
+		l, err := net.Listen("tcp", c.config.Listen)
+		if err != nil {
+			return nil, newError("failed to listen on ", c.config.Listen).Base(err)
+		}
+		listeners = append(listeners, l)
+	}
+
+	if path := c.config.UnixSocket; path != "" {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			newError("failed to remove existing socket ", path).Base(err).AtWarning().WriteToLog()
+		}
+		l, err := net.Listen("unix", path)
+		if err != nil {
+			closeListeners(listeners)
+			return nil, newError("failed to listen on ", path).Base(err)
+		}
+		listeners = append(listeners, l)
+		mode := os.FileMode(0600)
+		if c.config.UnixSocketMode != 0 {
+			mode = os.FileMode(c.config.UnixSocketMode)
+		}
+		if err := os.Chmod(path, mode); err != nil {
+			closeListeners(listeners)
+			return nil, newError("failed to set permission of ", path).Base(err)
+		}
+	}
+
+	if config := c.tlsConfig(); config != nil {
+		for i, l := range listeners {
+			listeners[i] = gotls.NewListener(l, config)
+		}
+	}
+
+	return listeners, nil
+}
+
+func closeListeners(listeners []net.Listener) {
+	for _, l := range listeners {
+		l.Close()
+	}
+}
+
+func (c *Commander) serve(listener net.Listener) {
+	go func() {
+		if err := c.server.Serve(listener); err != nil {
+			newError("failed to start grpc server").Base(err).AtError().WriteToLog()
+		}
+	}()
+}
+
 // Start implements common.Runnable.
 func (c *Commander) Start() error {
+	var opts []grpc.ServerOption
+	if c.config.Token != "" {
+		auth := &tokenAuthenticator{token: []byte(c.config.Token)}
+		opts = auth.serverOptions()
+	}
+
+	listeners, err := c.listen()
+	if err != nil {
+		return err
+	}
+
 	c.Lock()
-	c.server = grpc.NewServer()
+	c.server = grpc.NewServer(opts...)
 	for _, service := range c.services {
 		service.Register(c.server)
 	}
 	c.Unlock()
 
+	for _, l := range listeners {
+		newError("gRPC API listening on ", l.Addr()).AtInfo().WriteToLog()
+		c.serve(l)
+	}
+
+	if c.tag == "" {
+		return nil
+	}
+
 	listener := &OutboundListener{
 		buffer: make(chan net.Conn, 4),
 		done:   done.New(),
 	}
 
-	go func() {
-		if err := c.server.Serve(listener); err != nil {
-			newError("failed to start grpc server").Base(err).AtError().WriteToLog()
-		}
-	}()
+	c.serve(listener)
 
 	if err := c.ohm.RemoveHandler(context.Background(), c.tag); err != nil {
 		newError("failed to remove existing handler").WriteToLog()
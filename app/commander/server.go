@@ -0,0 +1,198 @@
+// +build !confonly
+
+package commander
+
+import (
+	"context"
+	"runtime"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"v2ray.com/core"
+	"v2ray.com/core/common"
+	"v2ray.com/core/common/errors"
+	"v2ray.com/core/common/net"
+	"v2ray.com/core/common/session"
+	"v2ray.com/core/features/dns"
+	"v2ray.com/core/features/inbound"
+	"v2ray.com/core/features/outbound"
+	"v2ray.com/core/features/routing"
+	routing_session "v2ray.com/core/features/routing/session"
+)
+
+const defaultHealthcheckTimeout = 3 * time.Second
+
+// defaultHealthcheckDomain is resolved and routed by health checks, if the request has no domain.
+const defaultHealthcheckDomain = "www.gstatic.com"
+
+// serverServer is an implementation of ServerService.
+type serverServer struct {
+	v         *core.Instance
+	startTime time.Time
+}
+
+// NewServerServer creates a ServerService server for the V2Ray instance.
+func NewServerServer(v *core.Instance) ServerServiceServer {
+	return &serverServer{
+		v:         v,
+		startTime: time.Now(),
+	}
+}
+
+// registeredFeatures returns the features in this build as "kind:name", in the order of core.RegisteredFeatures().
+func registeredFeatures() []string {
+	features := core.RegisteredFeatures()
+	names := make([]string, 0, len(features))
+	for _, f := range features {
+		names = append(names, f.Kind+":"+f.Name)
+	}
+	return names
+}
+
+func (s *serverServer) GetServerInfo(ctx context.Context, request *GetServerInfoRequest) (*GetServerInfoResponse, error) {
+	var rtm runtime.MemStats
+	runtime.ReadMemStats(&rtm)
+
+	response := &GetServerInfoResponse{
+		Version:          core.Version(),
+		VersionStatement: core.VersionStatement(),
+		Features:         registeredFeatures(),
+		Uptime:           uint32(time.Since(s.startTime).Seconds()),
+		NumGoroutine:     uint32(runtime.NumGoroutine()),
+		Alloc:            rtm.Alloc,
+		Sys:              rtm.Sys,
+		NumGc:            rtm.NumGC,
+	}
+	if ihm, ok := s.v.GetFeature(inbound.ManagerType()).(inbound.Manager); ok {
+		response.InboundCount = uint32(len(ihm.ListHandlers(ctx)))
+	}
+	if ohm, ok := s.v.GetFeature(outbound.ManagerType()).(outbound.Manager); ok {
+		response.OutboundCount = uint32(len(ohm.ListHandlers(ctx)))
+	}
+	return response, nil
+}
+
+// checkDispatcher verifies that a dispatcher is present, and that sessions not routed to an outbound have the
+// default outbound to go. Dispatching a request would connect to the outside world, so it is not exercised.
+func (s *serverServer) checkDispatcher() error {
+	if s.v.GetFeature(routing.DispatcherType()) == nil {
+		return newError("dispatcher not found")
+	}
+	ohm, ok := s.v.GetFeature(outbound.ManagerType()).(outbound.Manager)
+	if !ok {
+		return newError("outbound manager not found")
+	}
+	if ohm.GetDefaultHandler() == nil {
+		return newError("no default outbound")
+	}
+	return nil
+}
+
+// checkRouter picks a route for the domain, and verifies that the outbound of the route exists. Having no
+// route for it is not a failure, as the default outbound is used.
+func (s *serverServer) checkRouter(domain string) error {
+	router, ok := s.v.GetFeature(routing.RouterType()).(routing.Router)
+	if !ok {
+		return newError("router not found")
+	}
+	route, err := router.PickRoute(&routing_session.Context{
+		Outbound: &session.Outbound{
+			Target: net.TCPDestination(net.DomainAddress(domain), 443),
+		},
+	})
+	if err != nil {
+		if errors.Cause(err) == common.ErrNoClue {
+			return nil
+		}
+		return err
+	}
+	tag := route.GetOutboundTag()
+	if ohm, ok := s.v.GetFeature(outbound.ManagerType()).(outbound.Manager); ok && ohm.GetHandler(tag) == nil {
+		return newError("outbound [", tag, "] of the route for ", domain, " not found")
+	}
+	return nil
+}
+
+// checkDNS resolves the domain through the DNS client, which queries the configured name servers.
+func (s *serverServer) checkDNS(domain string) error {
+	client, ok := s.v.GetFeature(dns.ClientType()).(dns.Client)
+	if !ok {
+		return newError("DNS client not found")
+	}
+	ips, err := client.LookupIP(domain)
+	if err != nil {
+		return err
+	}
+	if len(ips) == 0 {
+		return newError("no IP for ", domain)
+	}
+	return nil
+}
+
+func (s *serverServer) Healthcheck(ctx context.Context, request *HealthcheckRequest) (*HealthcheckResponse, error) {
+	timeout := defaultHealthcheckTimeout
+	if request.Timeout > 0 {
+		timeout = time.Duration(request.Timeout) * time.Millisecond
+	}
+	domain := request.Domain
+	if domain == "" {
+		domain = defaultHealthcheckDomain
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	checks := []struct {
+		name  string
+		check func() error
+	}{
+		{"dispatcher", s.checkDispatcher},
+		{"router", func() error { return s.checkRouter(domain) }},
+		{"dns", func() error { return s.checkDNS(domain) }},
+	}
+
+	results := make([]chan error, len(checks))
+	start := time.Now()
+	for i, c := range checks {
+		results[i] = make(chan error, 1)
+		go func(check func() error, result chan<- error) {
+			result <- check()
+		}(c.check, results[i])
+	}
+
+	response := &HealthcheckResponse{Healthy: true}
+	for i, c := range checks {
+		health := &FeatureHealth{Name: c.name}
+		var err error
+		select {
+		case err = <-results[i]:
+		case <-ctx.Done():
+			err = newError("no response within ", timeout)
+		}
+		health.Latency = uint32(time.Since(start) / time.Millisecond)
+		if err != nil {
+			health.Error = err.Error()
+			response.Healthy = false
+		} else {
+			health.Healthy = true
+		}
+		response.Features = append(response.Features, health)
+	}
+	return response, nil
+}
+
+func (s *serverServer) mustEmbedUnimplementedServerServiceServer() {}
+
+type serverService struct {
+	v *core.Instance
+}
+
+func (s *serverService) Register(server *grpc.Server) {
+	RegisterServerServiceServer(server, NewServerServer(s.v))
+}
+
+func init() {
+	common.Must(common.RegisterConfig((*ServerConfig)(nil), func(ctx context.Context, cfg interface{}) (interface{}, error) {
+		return &serverService{v: core.MustFromContext(ctx)}, nil
+	}))
+}
@@ -0,0 +1,97 @@
+package commander_test
+
+import (
+	"context"
+	"testing"
+
+	"v2ray.com/core"
+	. "v2ray.com/core/app/commander"
+	"v2ray.com/core/app/dispatcher"
+	"v2ray.com/core/app/dns"
+	"v2ray.com/core/app/proxyman"
+	_ "v2ray.com/core/app/proxyman/inbound"
+	_ "v2ray.com/core/app/proxyman/outbound"
+	"v2ray.com/core/app/router"
+	"v2ray.com/core/common"
+	"v2ray.com/core/common/serial"
+	"v2ray.com/core/proxy/freedom"
+)
+
+func TestServerService(t *testing.T) {
+	v, err := core.New(&core.Config{
+		App: []*serial.TypedMessage{
+			serial.ToTypedMessage(&dispatcher.Config{}),
+			serial.ToTypedMessage(&proxyman.InboundConfig{}),
+			serial.ToTypedMessage(&proxyman.OutboundConfig{}),
+			serial.ToTypedMessage(&dns.Config{
+				StaticHosts: []*dns.Config_HostMapping{
+					{
+						Type:   dns.DomainMatchingType_Full,
+						Domain: "healthy.invalid",
+						Ip:     [][]byte{{127, 0, 0, 1}},
+					},
+				},
+			}),
+			serial.ToTypedMessage(&router.Config{
+				Rule: []*router.RoutingRule{
+					{
+						TargetTag: &router.RoutingRule_Tag{Tag: "missing"},
+						Domain: []*router.Domain{
+							{Type: router.Domain_Full, Value: "broken.invalid"},
+						},
+					},
+				},
+			}),
+		},
+		Outbound: []*core.OutboundHandlerConfig{
+			{
+				Tag:           "direct",
+				ProxySettings: serial.ToTypedMessage(&freedom.Config{}),
+			},
+		},
+	})
+	common.Must(err)
+	common.Must(v.Start())
+	defer v.Close()
+
+	server := NewServerServer(v)
+
+	info, err := server.GetServerInfo(context.Background(), &GetServerInfoRequest{})
+	common.Must(err)
+	if info.Version != core.Version() {
+		t.Error("version: ", info.Version)
+	}
+	if info.InboundCount != 0 || info.OutboundCount != 1 {
+		t.Error("handlers: ", info.InboundCount, " inbounds, ", info.OutboundCount, " outbounds")
+	}
+	if info.NumGoroutine == 0 || info.Sys == 0 {
+		t.Error("runtime stats not set")
+	}
+	found := false
+	for _, feature := range info.Features {
+		if feature == "outbound:freedom" {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("freedom not in features: ", info.Features)
+	}
+
+	health, err := server.Healthcheck(context.Background(), &HealthcheckRequest{Timeout: 5000, Domain: "healthy.invalid"})
+	common.Must(err)
+	if !health.Healthy || len(health.Features) != 3 {
+		t.Error("unhealthy: ", health.Features)
+	}
+
+	// The route of the domain goes to a missing outbound, and names of .invalid are never resolved.
+	health, err = server.Healthcheck(context.Background(), &HealthcheckRequest{Timeout: 5000, Domain: "broken.invalid"})
+	common.Must(err)
+	if health.Healthy {
+		t.Error("expected unhealthy, but got ", health.Features)
+	}
+	for _, feature := range health.Features {
+		if expected := feature.Name == "dispatcher"; feature.Healthy != expected {
+			t.Error("feature ", feature.Name, ": healthy ", feature.Healthy, ", error ", feature.Error)
+		}
+	}
+}
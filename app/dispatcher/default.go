@@ -30,14 +30,18 @@ var (
 	errSniffingTimeout = newError("timeout on sniffing")
 )
 
+const defaultSniffingTimeout = time.Millisecond * 200
+
 type cachedReader struct {
 	sync.Mutex
 	reader *pipe.Reader
 	cache  buf.MultiBuffer
 }
 
-func (r *cachedReader) Cache(b *buf.Buffer) {
-	mb, _ := r.reader.ReadMultiBufferTimeout(time.Millisecond * 100)
+// Cache waits up to the given timeout for more data, and copies everything
+// cached so far into b. Data read here is kept and returned by later reads.
+func (r *cachedReader) Cache(b *buf.Buffer, timeout time.Duration) error {
+	mb, err := r.reader.ReadMultiBufferTimeout(timeout)
 	r.Lock()
 	if !mb.IsEmpty() {
 		r.cache, _ = buf.MergeMulti(r.cache, mb)
@@ -47,6 +51,7 @@ func (r *cachedReader) Cache(b *buf.Buffer) {
 	n := r.cache.Copy(rawBytes)
 	b.Resize(0, int32(n))
 	r.Unlock()
+	return err
 }
 
 func (r *cachedReader) readInternal() buf.MultiBuffer {
@@ -95,6 +100,10 @@ type DefaultDispatcher struct {
 	router routing.Router
 	policy policy.Manager
 	stats  stats.Manager
+	quota  stats.QuotaEnforcer
+
+	blockedUDP blockedUDPLogger
+	mirror     *mirror
 }
 
 func init() {
@@ -115,6 +124,16 @@ func (d *DefaultDispatcher) Init(config *Config, om outbound.Manager, router rou
 	d.router = router
 	d.policy = pm
 	d.stats = sm
+	if qe, ok := sm.(stats.QuotaEnforcer); ok {
+		d.quota = qe
+	}
+	if config.Mirror != nil {
+		m, err := newMirror(config.Mirror)
+		if err != nil {
+			return newError("invalid mirror config").Base(err)
+		}
+		d.mirror = m
+	}
 	return nil
 }
 
@@ -124,12 +143,20 @@ func (*DefaultDispatcher) Type() interface{} {
 }
 
 // Start implements common.Runnable.
-func (*DefaultDispatcher) Start() error {
+func (d *DefaultDispatcher) Start() error {
+	if d.mirror != nil {
+		return d.mirror.start()
+	}
 	return nil
 }
 
 // Close implements common.Closable.
-func (*DefaultDispatcher) Close() error { return nil }
+func (d *DefaultDispatcher) Close() error {
+	if d.mirror != nil {
+		return d.mirror.close()
+	}
+	return nil
+}
 
 func (d *DefaultDispatcher) getLink(ctx context.Context) (*transport.Link, *transport.Link) {
 	opt := pipe.OptionsFromContext(ctx)
@@ -154,30 +181,79 @@ func (d *DefaultDispatcher) getLink(ctx context.Context) (*transport.Link, *tran
 
 	if user != nil && len(user.Email) > 0 {
 		p := d.policy.ForLevel(user.Level)
-		if p.Stats.UserUplink {
+		// Traffic of users with a quota is always counted.
+		hasQuota := d.hasQuota(user)
+		var counters []stats.Counter
+		if p.Stats.UserUplink || hasQuota {
 			name := "user>>>" + user.Email + ">>>traffic>>>uplink"
 			if c, _ := stats.GetOrRegisterCounter(d.stats, name); c != nil {
+				counters = append(counters, c)
 				inboundLink.Writer = &SizeStatWriter{
 					Counter: c,
 					Writer:  inboundLink.Writer,
 				}
 			}
 		}
-		if p.Stats.UserDownlink {
+		if p.Stats.UserDownlink || hasQuota {
 			name := "user>>>" + user.Email + ">>>traffic>>>downlink"
 			if c, _ := stats.GetOrRegisterCounter(d.stats, name); c != nil {
+				counters = append(counters, c)
 				outboundLink.Writer = &SizeStatWriter{
 					Counter: c,
 					Writer:  outboundLink.Writer,
 				}
 			}
 		}
+		if hasQuota {
+			inboundLink.Writer = &QuotaWriter{
+				Counters: counters,
+				Quota:    user.Quota,
+				Email:    user.Email,
+				Writer:   inboundLink.Writer,
+			}
+			outboundLink.Writer = &QuotaWriter{
+				Counters: counters,
+				Quota:    user.Quota,
+				Email:    user.Email,
+				Writer:   outboundLink.Writer,
+			}
+		}
+	}
+
+	var level uint32
+	if user != nil {
+		level = user.Level
+	}
+	if timeouts := d.policy.ForLevel(level).Timeouts; timeouts.UplinkIdle > 0 || timeouts.DownlinkIdle > 0 {
+		uplink := newIdleDirection("uplink", timeouts.UplinkIdle, uplinkWriter)
+		downlink := newIdleDirection("downlink", timeouts.DownlinkIdle, downlinkWriter)
+		inboundLink.Writer = &idleWriter{direction: uplink, writer: inboundLink.Writer}
+		outboundLink.Writer = &idleWriter{direction: downlink, writer: outboundLink.Writer}
+		go watchIdle(ctx, uplink, downlink)
 	}
 
 	return inboundLink, outboundLink
 }
 
+// hasQuota returns true if the traffic of the user is limited by a quota.
+func (d *DefaultDispatcher) hasQuota(user *protocol.MemoryUser) bool {
+	return d.quota != nil && user != nil && len(user.Email) > 0 && user.Quota > 0
+}
+
+// isTargetDomain returns true if the domain is the target of the outbound already.
+func isTargetDomain(ctx context.Context, domain string) bool {
+	outbound := session.OutboundFromContext(ctx)
+	if outbound == nil {
+		return false
+	}
+	address := outbound.Target.Address
+	return address != nil && address.Family().IsDomain() && address.Domain() == domain
+}
+
 func shouldOverride(result SniffResult, domainOverride []string) bool {
+	if isEncryptedSNI(result) {
+		return false
+	}
 	for _, p := range domainOverride {
 		if strings.HasPrefix(result.Protocol(), p) {
 			return true
@@ -196,6 +272,16 @@ func (d *DefaultDispatcher) Dispatch(ctx context.Context, destination net.Destin
 	}
 	ctx = session.ContextWithOutbound(ctx, ob)
 
+	if inbound := session.InboundFromContext(ctx); inbound != nil && d.hasQuota(inbound.User) {
+		d.quota.SetQuota(inbound.User.Email, inbound.User.Quota)
+		if d.quota.IsOverQuota(inbound.User.Email) {
+			return nil, newError("user ", inbound.User.Email, " has exceeded traffic quota").AtInfo()
+		}
+	}
+	if err := d.checkUDPPort(ctx, destination); err != nil {
+		return nil, err
+	}
+
 	inbound, outbound := d.getLink(ctx)
 	content := session.ContentFromContext(ctx)
 	if content == nil {
@@ -211,9 +297,22 @@ func (d *DefaultDispatcher) Dispatch(ctx context.Context, destination net.Destin
 				reader: outbound.Reader.(*pipe.Reader),
 			}
 			outbound.Reader = cReader
-			result, err := sniffer(ctx, cReader)
+			result, err := sniffer(ctx, cReader, sniffingRequest.Timeout)
+			if err == errSniffingTimeout {
+				newError("no sniffable content within timeout, using original destination").AtDebug().WriteToLog(session.ExportIDToError(ctx))
+			}
 			if err == nil {
 				content.Protocol = result.Protocol()
+				if isEncryptedSNI(result) {
+					newError("encrypted client hello with public name ", result.Domain(), ", keeping original destination").WriteToLog(session.ExportIDToError(ctx))
+					content.SetAttribute(AttributeEncryptedSNI, "true")
+				} else {
+					// The public name of an encrypted client hello is not the requested domain.
+					content.SniffedDomain = result.Domain()
+				}
+				if sniffingRequest.RecordRequest {
+					content.SniffedRequest = sniffedRequest(result)
+				}
 			}
 			if err == nil && shouldOverride(result, sniffingRequest.OverrideDestinationForProtocol) {
 				domain := result.Domain()
@@ -227,45 +326,75 @@ func (d *DefaultDispatcher) Dispatch(ctx context.Context, destination net.Destin
 	return inbound, nil
 }
 
-func sniffer(ctx context.Context, cReader *cachedReader) (SniffResult, error) {
+func sniffer(ctx context.Context, cReader *cachedReader, timeout time.Duration) (SniffResult, error) {
 	payload := buf.New()
 	defer payload.Release()
 
+	if timeout <= 0 {
+		timeout = defaultSniffingTimeout
+	}
+	deadline := time.Now().Add(timeout)
+
 	sniffer := NewSniffer()
-	totalAttempt := 0
 	for {
 		select {
 		case <-ctx.Done():
 			return nil, ctx.Err()
 		default:
-			totalAttempt++
-			if totalAttempt > 2 {
-				return nil, errSniffingTimeout
-			}
+		}
 
-			cReader.Cache(payload)
-			if !payload.IsEmpty() {
-				result, err := sniffer.Sniff(payload.Bytes())
-				if err != common.ErrNoClue {
-					return result, err
-				}
-			}
-			if payload.IsFull() {
-				return nil, errUnknownContent
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return nil, errSniffingTimeout
+		}
+
+		cacheErr := cReader.Cache(payload, remaining)
+		if !payload.IsEmpty() {
+			result, err := sniffer.Sniff(payload.Bytes())
+			if err != common.ErrNoClue {
+				return result, err
 			}
 		}
+		if payload.IsFull() {
+			return nil, errUnknownContent
+		}
+
+		switch cacheErr {
+		case nil:
+		case buf.ErrReadTimeout:
+			return nil, errSniffingTimeout
+		default:
+			// The client closed its side already, cached bytes are still delivered.
+			return nil, cacheErr
+		}
 	}
 }
 
 func (d *DefaultDispatcher) routedDispatch(ctx context.Context, link *transport.Link, destination net.Destination) {
 	var handler outbound.Handler
 
-	if d.router != nil {
+	if tag := session.OutboundTagFromContext(ctx); tag != "" {
+		// The requester chose the outbound, such as the DNS client for a name server.
+		handler = d.ohm.GetHandler(tag)
+		if handler == nil {
+			newError("non existing outbound tag requested: ", tag).AtWarning().WriteToLog(session.ExportIDToError(ctx))
+			common.Close(link.Writer)
+			common.Interrupt(link.Reader)
+			return
+		}
+		newError("taking requested outbound [", tag, "] for [", destination, "]").WriteToLog(session.ExportIDToError(ctx))
+	} else if d.router != nil {
 		if route, err := d.router.PickRoute(routing_session.AsRoutingContext(ctx)); err == nil {
 			tag := route.GetOutboundTag()
 			if h := d.ohm.GetHandler(tag); h != nil {
 				newError("taking detour [", tag, "] for [", destination, "]").WriteToLog(session.ExportIDToError(ctx))
 				handler = h
+				if outbound := session.OutboundFromContext(ctx); outbound != nil {
+					outbound.RuleTag = route.GetRuleTag()
+					if attributed, ok := route.(routing.AttributedRoute); ok {
+						outbound.RouteAttributes = attributed.GetRouteAttributes()
+					}
+				}
 			} else {
 				newError("non existing tag: ", tag).AtWarning().WriteToLog(session.ExportIDToError(ctx))
 			}
@@ -285,11 +414,33 @@ func (d *DefaultDispatcher) routedDispatch(ctx context.Context, link *transport.
 		return
 	}
 
+	if outbound := session.OutboundFromContext(ctx); outbound != nil {
+		outbound.Tag = handler.Tag()
+	}
+
 	if accessMessage := log.AccessMessageFromContext(ctx); accessMessage != nil {
 		if tag := handler.Tag(); tag != "" {
 			accessMessage.Detour = tag
 		}
-		log.Record(accessMessage)
+		if domain := session.SniffedDomainFromContext(ctx); domain != "" && !isTargetDomain(ctx, domain) {
+			accessMessage.SniffedDomain = domain
+		}
+		if content := session.ContentFromContext(ctx); content != nil && content.SniffedRequest != nil {
+			accessMessage.Method = content.SniffedRequest.Method
+			accessMessage.Path = content.SniffedRequest.Path
+			accessMessage.ServerName = content.SniffedRequest.ServerName
+		}
+		accessMessage.SessionID = uint32(session.IDFromContext(ctx))
+		log.RecordContext(ctx, accessMessage)
+	}
+
+	if d.mirror != nil && d.mirror.matches(ctx) {
+		if s := d.mirror.newSession(ctx, destination); s != nil {
+			link = &transport.Link{
+				Reader: &mirrorReader{session: s, reader: link.Reader},
+				Writer: &mirrorWriter{session: s, writer: link.Writer},
+			}
+		}
 	}
 
 	handler.Dispatch(ctx, link)
@@ -0,0 +1,97 @@
+// +build !confonly
+
+package dispatcher
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"v2ray.com/core/common"
+	"v2ray.com/core/common/buf"
+	"v2ray.com/core/common/session"
+	"v2ray.com/core/transport/pipe"
+)
+
+// idleDirection is the uplink or the downlink of a session, with the time it is last written.
+type idleDirection struct {
+	name    string
+	timeout time.Duration
+	pipe    *pipe.Writer
+	// last is the time of the last write in unix nanoseconds, accessed atomically.
+	last int64
+}
+
+func newIdleDirection(name string, timeout time.Duration, pipe *pipe.Writer) *idleDirection {
+	return &idleDirection{
+		name:    name,
+		timeout: timeout,
+		pipe:    pipe,
+		last:    time.Now().UnixNano(),
+	}
+}
+
+func (d *idleDirection) closed() bool {
+	select {
+	case <-d.pipe.Done():
+		return true
+	default:
+		return false
+	}
+}
+
+// idleWriter records the time of writes to a direction.
+type idleWriter struct {
+	direction *idleDirection
+	writer    buf.Writer
+}
+
+func (w *idleWriter) WriteMultiBuffer(mb buf.MultiBuffer) error {
+	atomic.StoreInt64(&w.direction.last, time.Now().UnixNano())
+	return w.writer.WriteMultiBuffer(mb)
+}
+
+func (w *idleWriter) Close() error {
+	return common.Close(w.writer)
+}
+
+func (w *idleWriter) Interrupt() {
+	common.Interrupt(w.writer)
+}
+
+// watchIdle interrupts the session once a direction with a timeout is not written for longer than it,
+// regardless of the other direction. A direction is not watched after it is closed, and watching ends
+// when both are closed.
+func watchIdle(ctx context.Context, uplink *idleDirection, downlink *idleDirection) {
+	interval := time.Duration(0)
+	for _, d := range []*idleDirection{uplink, downlink} {
+		if d.timeout > 0 && (interval == 0 || d.timeout < interval) {
+			interval = d.timeout
+		}
+	}
+	ticker := time.NewTicker(interval / 4)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		now := time.Now()
+		open := false
+		for _, d := range []*idleDirection{uplink, downlink} {
+			if d.closed() {
+				continue
+			}
+			open = true
+			if d.timeout == 0 {
+				continue
+			}
+			if idle := now.Sub(time.Unix(0, atomic.LoadInt64(&d.last))); idle > d.timeout {
+				newError("closing session as its ", d.name, " is idle for ", idle.Round(time.Second)).AtInfo().WriteToLog(session.ExportIDToError(ctx))
+				uplink.pipe.Interrupt()
+				downlink.pipe.Interrupt()
+				return
+			}
+		}
+		if !open {
+			return
+		}
+	}
+}
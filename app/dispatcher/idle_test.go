@@ -0,0 +1,85 @@
+package dispatcher_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "v2ray.com/core/app/dispatcher"
+	"v2ray.com/core/app/policy"
+	"v2ray.com/core/app/proxyman"
+	"v2ray.com/core/app/proxyman/outbound"
+	"v2ray.com/core/app/stats"
+	"v2ray.com/core/common"
+	"v2ray.com/core/common/buf"
+	"v2ray.com/core/common/net"
+	"v2ray.com/core/common/session"
+	"v2ray.com/core/transport"
+)
+
+// keepaliveHandler is an outbound that keeps sending downlink, as some servers send keepalives.
+type keepaliveHandler struct{}
+
+func (keepaliveHandler) Start() error { return nil }
+func (keepaliveHandler) Close() error { return nil }
+func (keepaliveHandler) Tag() string  { return "keepalive" }
+func (keepaliveHandler) Dispatch(ctx context.Context, link *transport.Link) {
+	for {
+		b := buf.New()
+		b.WriteString("ping")
+		if err := link.Writer.WriteMultiBuffer(buf.MultiBuffer{b}); err != nil {
+			return
+		}
+		time.Sleep(time.Millisecond * 100)
+	}
+}
+
+func TestIdleTimeouts(t *testing.T) {
+	dispatch := func(timeout *policy.Policy_Timeout) *transport.Link {
+		pm, err := policy.New(context.Background(), &policy.Config{
+			Level: map[uint32]*policy.Policy{
+				0: {Timeout: timeout},
+			},
+		})
+		common.Must(err)
+		sm, err := stats.NewManager(context.Background(), &stats.Config{})
+		common.Must(err)
+		om, err := outbound.New(context.Background(), &proxyman.OutboundConfig{})
+		common.Must(err)
+		common.Must(om.AddHandler(context.Background(), keepaliveHandler{}))
+
+		d := new(DefaultDispatcher)
+		common.Must(d.Init(&Config{}, om, nil, pm, sm))
+		ctx := session.ContextWithInbound(context.Background(), &session.Inbound{Tag: "in"})
+		link, err := d.Dispatch(ctx, net.TCPDestination(net.DomainAddress("example.com"), 80))
+		common.Must(err)
+		return link
+	}
+
+	// readUntil reads the downlink until it ends, or the time is up.
+	readUntil := func(link *transport.Link, deadline time.Time) error {
+		for time.Now().Before(deadline) {
+			mb, err := link.Reader.(buf.TimeoutReader).ReadMultiBufferTimeout(time.Until(deadline))
+			buf.ReleaseMulti(mb)
+			if err != nil && err != buf.ErrReadTimeout {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// The uplink is idle while the downlink keeps the session active.
+	link := dispatch(&policy.Policy_Timeout{UplinkIdle: &policy.Second{Value: 1}})
+	start := time.Now()
+	if err := readUntil(link, start.Add(time.Second*5)); err == nil {
+		t.Error("expected session closed as uplink is idle")
+	} else if elapsed := time.Since(start); elapsed < time.Second {
+		t.Error("session closed too early: ", elapsed)
+	}
+
+	link = dispatch(&policy.Policy_Timeout{DownlinkIdle: &policy.Second{Value: 1}})
+	if err := readUntil(link, time.Now().Add(time.Millisecond*1500)); err != nil {
+		t.Error("expected session open as downlink is active, but got ", err)
+	}
+	common.Interrupt(link.Writer)
+}
@@ -0,0 +1,264 @@
+// +build !confonly
+
+package dispatcher
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"v2ray.com/core/common"
+	"v2ray.com/core/common/buf"
+	"v2ray.com/core/common/net"
+	"v2ray.com/core/common/session"
+)
+
+const (
+	defaultMirrorSessionBytes = 1024 * 1024
+	defaultMirrorTotalBytes   = 64 * 1024 * 1024
+
+	mirrorRecordHeaderSize = 17
+)
+
+// Types of mirror records, as described in MirrorConfig.
+const (
+	mirrorRecordStart byte = iota
+	mirrorRecordUplink
+	mirrorRecordDownlink
+	mirrorRecordTruncated
+)
+
+// mirror writes records of the traffic of matching sessions. It stops for good when the total limit is reached,
+// or a write fails.
+type mirror struct {
+	inboundTags map[string]bool
+	ruleTags    map[string]bool
+	target      string
+	open        func() (io.WriteCloser, error)
+
+	maxSession uint64
+	maxTotal   uint64
+
+	access  sync.Mutex
+	writer  io.WriteCloser
+	written uint64
+	stopped bool
+}
+
+func newMirror(config *MirrorConfig) (*mirror, error) {
+	if len(config.InboundTag) == 0 && len(config.RuleTag) == 0 {
+		return nil, newError("no inbound or rule to mirror traffic of")
+	}
+	m := &mirror{
+		inboundTags: make(map[string]bool),
+		ruleTags:    make(map[string]bool),
+		maxSession:  config.MaxSessionBytes,
+		maxTotal:    config.MaxTotalBytes,
+	}
+	for _, tag := range config.InboundTag {
+		m.inboundTags[tag] = true
+	}
+	for _, tag := range config.RuleTag {
+		m.ruleTags[tag] = true
+	}
+	if m.maxSession == 0 {
+		m.maxSession = defaultMirrorSessionBytes
+	}
+	if m.maxTotal == 0 {
+		m.maxTotal = defaultMirrorTotalBytes
+	}
+
+	switch {
+	case len(config.File) > 0:
+		m.target = config.File
+		m.open = func() (io.WriteCloser, error) {
+			return os.OpenFile(config.File, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+		}
+	case len(config.UnixSocket) > 0:
+		m.target = "unix:" + config.UnixSocket
+		m.open = func() (io.WriteCloser, error) {
+			return net.Dial("unix", config.UnixSocket)
+		}
+	default:
+		return nil, newError("no file or unix socket to mirror traffic to")
+	}
+	return m, nil
+}
+
+func (m *mirror) start() error {
+	w, err := m.open()
+	if err != nil {
+		return newError("failed to open mirror ", m.target).Base(err)
+	}
+	m.access.Lock()
+	m.writer = w
+	m.access.Unlock()
+	newError("mirroring plaintext traffic to ", m.target, ", which is for debugging only").AtWarning().WriteToLog()
+	return nil
+}
+
+func (m *mirror) close() error {
+	m.access.Lock()
+	defer m.access.Unlock()
+
+	m.stopped = true
+	if m.writer == nil {
+		return nil
+	}
+	return m.writer.Close()
+}
+
+// matches returns true if the session in ctx comes from a mirrored inbound, or is routed by a mirrored rule.
+func (m *mirror) matches(ctx context.Context) bool {
+	if inbound := session.InboundFromContext(ctx); inbound != nil && m.inboundTags[inbound.Tag] {
+		return true
+	}
+	if outbound := session.OutboundFromContext(ctx); outbound != nil && len(outbound.RuleTag) > 0 && m.ruleTags[outbound.RuleTag] {
+		return true
+	}
+	return false
+}
+
+// write writes a record. It returns false if mirroring has stopped.
+func (m *mirror) write(id uint32, recordType byte, payload []byte) bool {
+	record := make([]byte, mirrorRecordHeaderSize+len(payload))
+	binary.BigEndian.PutUint64(record[0:], uint64(time.Now().UnixNano()))
+	binary.BigEndian.PutUint32(record[8:], id)
+	record[12] = recordType
+	binary.BigEndian.PutUint32(record[13:], uint32(len(payload)))
+	copy(record[mirrorRecordHeaderSize:], payload)
+
+	m.access.Lock()
+	defer m.access.Unlock()
+
+	if m.stopped || m.writer == nil {
+		return false
+	}
+	if m.written+uint64(len(record)) > m.maxTotal {
+		m.stopped = true
+		newError("mirror ", m.target, " reaches the limit of ", m.maxTotal, " bytes, mirroring stops").AtWarning().WriteToLog()
+		return false
+	}
+	if _, err := m.writer.Write(record); err != nil {
+		m.stopped = true
+		newError("failed to write to mirror ", m.target, ", mirroring stops").Base(err).AtWarning().WriteToLog()
+		return false
+	}
+	m.written += uint64(len(record))
+	return true
+}
+
+// mirrorSession is the mirroring of a session, up to the per-session limit.
+type mirrorSession struct {
+	mirror *mirror
+	id     uint32
+
+	access sync.Mutex
+	left   uint64
+	done   bool
+}
+
+// newSession starts mirroring the session in ctx, or returns nil if mirroring has stopped.
+func (m *mirror) newSession(ctx context.Context, destination net.Destination) *mirrorSession {
+	id := uint32(session.IDFromContext(ctx))
+	var inboundTag, ruleTag, outboundTag string
+	var source net.Destination
+	if inbound := session.InboundFromContext(ctx); inbound != nil {
+		inboundTag = inbound.Tag
+		source = inbound.Source
+	}
+	if outbound := session.OutboundFromContext(ctx); outbound != nil {
+		ruleTag = outbound.RuleTag
+		outboundTag = outbound.Tag
+	}
+	description := fmt.Sprintf("inbound [%s] %s -> %s, rule [%s], outbound [%s]", inboundTag, source, destination, ruleTag, outboundTag)
+	if !m.write(id, mirrorRecordStart, []byte(description)) {
+		return nil
+	}
+	newError("mirroring session to ", m.target).WriteToLog(session.ExportIDToError(ctx))
+	return &mirrorSession{
+		mirror: m,
+		id:     id,
+		left:   m.maxSession,
+	}
+}
+
+func (s *mirrorSession) record(recordType byte, mb buf.MultiBuffer) {
+	s.access.Lock()
+	defer s.access.Unlock()
+
+	for _, b := range mb {
+		if s.done {
+			return
+		}
+		payload := b.Bytes()
+		if uint64(len(payload)) > s.left {
+			payload = payload[:s.left]
+		}
+		if len(payload) > 0 {
+			if !s.mirror.write(s.id, recordType, payload) {
+				s.done = true
+				return
+			}
+			s.left -= uint64(len(payload))
+		}
+		if s.left == 0 {
+			s.done = true
+			s.mirror.write(s.id, mirrorRecordTruncated, nil)
+		}
+	}
+}
+
+// mirrorReader records the uplink of a session that it reads.
+type mirrorReader struct {
+	session *mirrorSession
+	reader  buf.Reader
+}
+
+func (r *mirrorReader) ReadMultiBuffer() (buf.MultiBuffer, error) {
+	mb, err := r.reader.ReadMultiBuffer()
+	if !mb.IsEmpty() {
+		r.session.record(mirrorRecordUplink, mb)
+	}
+	return mb, err
+}
+
+// ReadMultiBufferTimeout implements buf.TimeoutReader, if the underlying reader does.
+func (r *mirrorReader) ReadMultiBufferTimeout(timeout time.Duration) (buf.MultiBuffer, error) {
+	tr, ok := r.reader.(buf.TimeoutReader)
+	if !ok {
+		return r.ReadMultiBuffer()
+	}
+	mb, err := tr.ReadMultiBufferTimeout(timeout)
+	if !mb.IsEmpty() {
+		r.session.record(mirrorRecordUplink, mb)
+	}
+	return mb, err
+}
+
+func (r *mirrorReader) Interrupt() {
+	common.Interrupt(r.reader)
+}
+
+// mirrorWriter records the downlink of a session that it writes.
+type mirrorWriter struct {
+	session *mirrorSession
+	writer  buf.Writer
+}
+
+func (w *mirrorWriter) WriteMultiBuffer(mb buf.MultiBuffer) error {
+	w.session.record(mirrorRecordDownlink, mb)
+	return w.writer.WriteMultiBuffer(mb)
+}
+
+func (w *mirrorWriter) Close() error {
+	return common.Close(w.writer)
+}
+
+func (w *mirrorWriter) Interrupt() {
+	common.Interrupt(w.writer)
+}
@@ -0,0 +1,136 @@
+package dispatcher_test
+
+import (
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	. "v2ray.com/core/app/dispatcher"
+	"v2ray.com/core/app/policy"
+	"v2ray.com/core/app/proxyman"
+	"v2ray.com/core/app/proxyman/outbound"
+	"v2ray.com/core/app/stats"
+	"v2ray.com/core/common"
+	"v2ray.com/core/common/buf"
+	"v2ray.com/core/common/net"
+	"v2ray.com/core/common/session"
+	"v2ray.com/core/transport"
+)
+
+// echoHandler is an outbound that sends the uplink back.
+type echoHandler struct{}
+
+func (echoHandler) Start() error { return nil }
+func (echoHandler) Close() error { return nil }
+func (echoHandler) Tag() string  { return "echo" }
+func (echoHandler) Dispatch(ctx context.Context, link *transport.Link) {
+	buf.Copy(link.Reader, link.Writer)
+	common.Close(link.Writer)
+}
+
+type mirrorRecord struct {
+	id         uint32
+	recordType byte
+	payload    string
+}
+
+func readMirrorRecords(t *testing.T, file string) []mirrorRecord {
+	content, err := ioutil.ReadFile(file)
+	common.Must(err)
+	var records []mirrorRecord
+	for len(content) > 0 {
+		if len(content) < 17 {
+			t.Fatal("incomplete record header: ", content)
+		}
+		length := binary.BigEndian.Uint32(content[13:])
+		records = append(records, mirrorRecord{
+			id:         binary.BigEndian.Uint32(content[8:]),
+			recordType: content[12],
+			payload:    string(content[17 : 17+length]),
+		})
+		content = content[17+length:]
+	}
+	return records
+}
+
+func TestMirror(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "mirror")
+
+	pm, err := policy.New(context.Background(), &policy.Config{})
+	common.Must(err)
+	sm, err := stats.NewManager(context.Background(), &stats.Config{})
+	common.Must(err)
+	om, err := outbound.New(context.Background(), &proxyman.OutboundConfig{})
+	common.Must(err)
+	common.Must(om.AddHandler(context.Background(), echoHandler{}))
+
+	d := new(DefaultDispatcher)
+	common.Must(d.Init(&Config{
+		Mirror: &MirrorConfig{
+			InboundTag:      []string{"debug"},
+			File:            file,
+			MaxSessionBytes: 8,
+		},
+	}, om, nil, pm, sm))
+	common.Must(d.Start())
+
+	dispatch := func(id session.ID, tag string, request string) string {
+		ctx := session.ContextWithID(context.Background(), id)
+		ctx = session.ContextWithInbound(ctx, &session.Inbound{
+			Source: net.TCPDestination(net.LocalHostIP, 10000),
+			Tag:    tag,
+		})
+		link, err := d.Dispatch(ctx, net.TCPDestination(net.DomainAddress("example.com"), 80))
+		common.Must(err)
+		b := buf.New()
+		b.WriteString(request)
+		common.Must(link.Writer.WriteMultiBuffer(buf.MultiBuffer{b}))
+		common.Close(link.Writer)
+		mb, err := buf.ReadAllToBytes(&buf.BufferedReader{Reader: link.Reader})
+		common.Must(err)
+		return string(mb)
+	}
+
+	if r := dispatch(1, "debug", "hello"); r != "hello" {
+		t.Error("unexpected response: ", r)
+	}
+	if r := dispatch(2, "other", "not mirrored"); r != "not mirrored" {
+		t.Error("unexpected response: ", r)
+	}
+	// The limit of bytes per session applies to both directions.
+	if r := dispatch(3, "debug", "long request"); r != "long request" {
+		t.Error("unexpected response: ", r)
+	}
+	common.Must(d.Close())
+
+	records := readMirrorRecords(t, file)
+	var got []mirrorRecord
+	for _, r := range records {
+		if r.recordType == 0 {
+			if r.payload != "inbound [debug] tcp:127.0.0.1:10000 -> tcp:example.com:80, rule [], outbound [echo]" {
+				t.Error("unexpected description: ", r.payload)
+			}
+			r.payload = ""
+		}
+		got = append(got, r)
+	}
+	expected := []mirrorRecord{
+		{1, 0, ""},
+		{1, 1, "hello"},
+		{1, 2, "hel"},
+		{1, 3, ""},
+		{3, 0, ""},
+		{3, 1, "long req"},
+		{3, 3, ""},
+	}
+	if len(got) != len(expected) {
+		t.Fatal("expected records ", expected, ", but got ", got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Error("expected record ", expected[i], ", but got ", got[i])
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"v2ray.com/core/common/protocol/bittorrent"
 	"v2ray.com/core/common/protocol/http"
 	"v2ray.com/core/common/protocol/tls"
+	"v2ray.com/core/common/session"
 )
 
 type SniffResult interface {
@@ -14,6 +15,53 @@ type SniffResult interface {
 	Domain() string
 }
 
+// encryptedSNIResult is implemented by sniff results whose visible domain may
+// only be the public name of a client-facing server, e.g. TLS with ECH.
+type encryptedSNIResult interface {
+	EncryptedClientHello() bool
+}
+
+// AttributeEncryptedSNI is the content attribute set on sessions whose TLS
+// client hello hides the real server name. Routing rules may match it with
+// `attrs[':ech'] == 'true'`.
+const AttributeEncryptedSNI = ":ech"
+
+// requestResult is implemented by sniff results of plaintext requests.
+type requestResult interface {
+	Method() string
+	Path() string
+}
+
+// maxRecordedPathLength is the length of recorded request paths, beyond which they are truncated.
+const maxRecordedPathLength = 256
+
+// sniffedRequest returns the metadata of the sniffed request, or nil if there is none.
+func sniffedRequest(result SniffResult) *session.SniffedRequest {
+	if r, ok := result.(requestResult); ok && r.Method() != "" {
+		path := r.Path()
+		if len(path) > maxRecordedPathLength {
+			path = path[:maxRecordedPathLength]
+		}
+		return &session.SniffedRequest{
+			Method: r.Method(),
+			Path:   path,
+		}
+	}
+	if result.Protocol() == "tls" && result.Domain() != "" {
+		return &session.SniffedRequest{
+			ServerName: result.Domain(),
+		}
+	}
+	return nil
+}
+
+func isEncryptedSNI(result SniffResult) bool {
+	if r, ok := result.(encryptedSNIResult); ok {
+		return r.EncryptedClientHello()
+	}
+	return false
+}
+
 type protocolSniffer func([]byte) (SniffResult, error)
 
 type Sniffer struct {
@@ -24,6 +72,7 @@ func NewSniffer() *Sniffer {
 	return &Sniffer{
 		sniffer: []protocolSniffer{
 			func(b []byte) (SniffResult, error) { return http.SniffHTTP(b) },
+			func(b []byte) (SniffResult, error) { return http.SniffHTTP2(b) },
 			func(b []byte) (SniffResult, error) { return tls.SniffTLS(b) },
 			func(b []byte) (SniffResult, error) { return bittorrent.SniffBittorrent(b) },
 		},
@@ -25,3 +25,37 @@ func (w *SizeStatWriter) Close() error {
 func (w *SizeStatWriter) Interrupt() {
 	common.Interrupt(w.Writer)
 }
+
+// QuotaWriter fails once the user has exceeded their traffic quota, which ends the session. The traffic
+// is the sum of the counters of the user, which are looked up once per session, so that writes take no
+// locks of the stats manager.
+type QuotaWriter struct {
+	Counters []stats.Counter
+	Quota    uint64
+	Email    string
+	Writer   buf.Writer
+}
+
+func (w *QuotaWriter) isOverQuota() bool {
+	var traffic int64
+	for _, c := range w.Counters {
+		traffic += c.Value()
+	}
+	return traffic > 0 && uint64(traffic) >= w.Quota
+}
+
+func (w *QuotaWriter) WriteMultiBuffer(mb buf.MultiBuffer) error {
+	if w.isOverQuota() {
+		buf.ReleaseMulti(mb)
+		return newError("user ", w.Email, " has exceeded traffic quota")
+	}
+	return w.Writer.WriteMultiBuffer(mb)
+}
+
+func (w *QuotaWriter) Close() error {
+	return common.Close(w.Writer)
+}
+
+func (w *QuotaWriter) Interrupt() {
+	common.Interrupt(w.Writer)
+}
@@ -6,6 +6,7 @@ import (
 	. "v2ray.com/core/app/dispatcher"
 	"v2ray.com/core/common"
 	"v2ray.com/core/common/buf"
+	"v2ray.com/core/features/stats"
 )
 
 type TestCounter int64
@@ -42,3 +43,27 @@ func TestStatsWriter(t *testing.T) {
 		t.Fatal("unexpected counter value. want 7, but got ", c.Value())
 	}
 }
+
+func TestQuotaWriter(t *testing.T) {
+	var uplink, downlink TestCounter
+	writer := &QuotaWriter{
+		Counters: []stats.Counter{&uplink, &downlink},
+		Quota:    10,
+		Email:    "a",
+		Writer:   buf.Discard,
+	}
+
+	uplink.Add(4)
+	downlink.Add(5)
+	common.Must(writer.WriteMultiBuffer(buf.MergeBytes(nil, []byte("abcd"))))
+
+	downlink.Add(1)
+	if err := writer.WriteMultiBuffer(buf.MergeBytes(nil, []byte("efg"))); err == nil {
+		t.Error("expected error over quota")
+	}
+
+	// Resetting the counters enables the user again.
+	uplink.Set(0)
+	downlink.Set(0)
+	common.Must(writer.WriteMultiBuffer(buf.MergeBytes(nil, []byte("hij"))))
+}
@@ -0,0 +1,69 @@
+// +build !confonly
+
+package dispatcher
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"v2ray.com/core/common/net"
+	"v2ray.com/core/common/session"
+	"v2ray.com/core/features/stats"
+)
+
+// blockedUDPLogInterval is the least interval between logs of blocked UDP traffic, as clients abusing an
+// open relay send packets at high rates.
+const blockedUDPLogInterval = time.Second * 10
+
+// blockedUDPLogger logs blocked UDP traffic at most once in blockedUDPLogInterval, with the number of
+// blocks not logged.
+type blockedUDPLogger struct {
+	access     sync.Mutex
+	last       time.Time
+	suppressed uint32
+}
+
+func (l *blockedUDPLogger) log(ctx context.Context, source net.Destination, destination net.Destination) {
+	l.access.Lock()
+	now := time.Now()
+	if now.Sub(l.last) < blockedUDPLogInterval {
+		l.suppressed++
+		l.access.Unlock()
+		return
+	}
+	suppressed := l.suppressed
+	l.last = now
+	l.suppressed = 0
+	l.access.Unlock()
+
+	newError("blocked UDP traffic from ", source, " to ", destination, " by policy, and ", suppressed, " more since last report").AtWarning().WriteToLog(session.ExportIDToError(ctx))
+}
+
+// checkUDPPort returns an error if the policy of the user level of the inbound doesn't allow UDP traffic
+// to the destination port. Only traffic from clients of inbounds is checked, as opposed to queries of the
+// DNS app, for example. TCP traffic is never checked.
+func (d *DefaultDispatcher) checkUDPPort(ctx context.Context, destination net.Destination) error {
+	if destination.Network != net.Network_UDP {
+		return nil
+	}
+	inbound := session.InboundFromContext(ctx)
+	if inbound == nil || !inbound.Source.IsValid() {
+		return nil
+	}
+	var level uint32
+	if inbound.User != nil {
+		level = inbound.User.Level
+	}
+	if d.policy.ForLevel(level).UDP.Allows(destination.Port) {
+		return nil
+	}
+
+	if len(inbound.Tag) > 0 {
+		if c, _ := stats.GetOrRegisterCounter(d.stats, "inbound>>>"+inbound.Tag+">>>udp>>>blocked"); c != nil {
+			c.Add(1)
+		}
+	}
+	d.blockedUDP.log(ctx, inbound.Source, destination)
+	return newError("UDP destination port ", destination.Port, " is not allowed").AtDebug()
+}
@@ -0,0 +1,72 @@
+package dispatcher_test
+
+import (
+	"context"
+	"testing"
+
+	. "v2ray.com/core/app/dispatcher"
+	"v2ray.com/core/app/policy"
+	"v2ray.com/core/app/proxyman"
+	"v2ray.com/core/app/proxyman/outbound"
+	"v2ray.com/core/app/stats"
+	"v2ray.com/core/common"
+	"v2ray.com/core/common/net"
+	"v2ray.com/core/common/protocol"
+	"v2ray.com/core/common/session"
+)
+
+func TestUDPPortPolicy(t *testing.T) {
+	pm, err := policy.New(context.Background(), &policy.Config{
+		Level: map[uint32]*policy.Policy{
+			0: {
+				Udp: &policy.Policy_Udp{
+					AllowedPorts: &net.PortList{Range: []*net.PortRange{{From: 443, To: 443}, {From: 53, To: 53}}},
+					DeniedPorts:  &net.PortList{Range: []*net.PortRange{{From: 53, To: 53}}},
+				},
+			},
+		},
+	})
+	common.Must(err)
+	sm, err := stats.NewManager(context.Background(), &stats.Config{})
+	common.Must(err)
+	om, err := outbound.New(context.Background(), &proxyman.OutboundConfig{})
+	common.Must(err)
+	d := new(DefaultDispatcher)
+	common.Must(d.Init(&Config{}, om, nil, pm, sm))
+
+	inbound := &session.Inbound{
+		Source: net.UDPDestination(net.LocalHostIP, 10000),
+		Tag:    "in",
+	}
+	ctx := session.ContextWithInbound(context.Background(), inbound)
+
+	for _, c := range []struct {
+		dest    net.Destination
+		allowed bool
+	}{
+		{net.UDPDestination(net.DomainAddress("example.com"), 443), true},
+		{net.UDPDestination(net.DomainAddress("example.com"), 53), false},
+		{net.UDPDestination(net.DomainAddress("example.com"), 123), false},
+		{net.TCPDestination(net.DomainAddress("example.com"), 123), true},
+	} {
+		_, err := d.Dispatch(ctx, c.dest)
+		if allowed := err == nil; allowed != c.allowed {
+			t.Error("expect ", c.dest, " allowed: ", c.allowed, ", but got ", err)
+		}
+	}
+	if v := sm.GetCounter("inbound>>>in>>>udp>>>blocked").Value(); v != 2 {
+		t.Error("expect 2 blocked, but got ", v)
+	}
+
+	// Users of other levels are not restricted.
+	inbound.User = &protocol.MemoryUser{Level: 1}
+	if _, err := d.Dispatch(ctx, net.UDPDestination(net.DomainAddress("example.com"), 123)); err != nil {
+		t.Error("expect UDP allowed for level 1, but got ", err)
+	}
+
+	// Traffic not from clients, such as DNS queries, is not restricted.
+	ctx = session.ContextWithInbound(context.Background(), &session.Inbound{Tag: "dns"})
+	if _, err := d.Dispatch(ctx, net.UDPDestination(net.LocalHostIP, 53)); err != nil {
+		t.Error("expect DNS queries allowed, but got ", err)
+	}
+}
@@ -0,0 +1,60 @@
+// +build !confonly
+
+package command
+
+//go:generate go run v2ray.com/core/common/errors/errorgen
+
+import (
+	"context"
+
+	grpc "google.golang.org/grpc"
+
+	"v2ray.com/core"
+	"v2ray.com/core/app/dns"
+	"v2ray.com/core/common"
+	feature_dns "v2ray.com/core/features/dns"
+)
+
+// dnsUpdater is a DNS client whose name servers can be replaced at runtime.
+type dnsUpdater interface {
+	Update(*dns.Config) error
+}
+
+type DNSServer struct {
+	V *core.Instance
+}
+
+// UpdateDns implements DnsService.
+func (s *DNSServer) UpdateDns(ctx context.Context, request *UpdateDnsRequest) (*UpdateDnsResponse, error) {
+	if request.Config == nil {
+		return nil, newError("DNS config not specified")
+	}
+	updater, ok := s.V.GetFeature(feature_dns.ClientType()).(dnsUpdater)
+	if !ok {
+		return nil, newError("DNS doesn't support updating")
+	}
+	if err := updater.Update(request.Config); err != nil {
+		return nil, err
+	}
+	newError("name servers updated").AtInfo().WriteToLog()
+	return &UpdateDnsResponse{}, nil
+}
+
+func (s *DNSServer) mustEmbedUnimplementedDnsServiceServer() {}
+
+type service struct {
+	v *core.Instance
+}
+
+func (s *service) Register(server *grpc.Server) {
+	RegisterDnsServiceServer(server, &DNSServer{
+		V: s.v,
+	})
+}
+
+func init() {
+	common.Must(common.RegisterConfig((*Config)(nil), func(ctx context.Context, cfg interface{}) (interface{}, error) {
+		s := core.MustFromContext(ctx)
+		return &service{v: s}, nil
+	}))
+}
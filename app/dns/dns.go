@@ -8,8 +8,11 @@ package dns
 import (
 	"context"
 	"fmt"
+	"sort"
 	"sync"
+	"unicode/utf8"
 
+	"v2ray.com/core"
 	"v2ray.com/core/app/router"
 	"v2ray.com/core/common"
 	"v2ray.com/core/common/errors"
@@ -18,17 +21,44 @@ import (
 	"v2ray.com/core/common/strmatcher"
 	"v2ray.com/core/features"
 	"v2ray.com/core/features/dns"
+	"v2ray.com/core/features/outbound"
 )
 
 // DNS is a DNS rely server.
 type DNS struct {
-	sync.Mutex
-	tag     string
+	sync.RWMutex
+	tag   string
+	ctx   context.Context
+	ohm   outbound.Manager
+	state *dnsState
+
+	started bool
+}
+
+// dnsState is the hosts and name servers of DNS, which are replaced as a whole on update.
+type dnsState struct {
 	hosts   *StaticHosts
 	clients []*Client
 
 	domainMatcher strmatcher.IndexMatcher
 	matcherInfos  []DomainMatcherInfo
+
+	prefetch *prefetcher
+	// lookups counts the lookups with the state, which are completed before its name servers are closed.
+	lookups sync.WaitGroup
+}
+
+// close stops the prefetcher at once, and closes the name servers when the lookups in progress are done.
+func (st *dnsState) close() {
+	st.prefetch.close()
+	go func() {
+		st.lookups.Wait()
+		for _, client := range st.clients {
+			if err := client.Close(); err != nil {
+				newError("failed to close name server ", client.Name()).Base(err).AtDebug().WriteToLog()
+			}
+		}
+	}()
 }
 
 // DomainMatcherInfo contains information attached to index returned by Server.domainMatcher
@@ -46,6 +76,27 @@ func New(ctx context.Context, config *Config) (*DNS, error) {
 		tag = generateRandomTag()
 	}
 
+	state, err := newDNSState(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &DNS{
+		tag:   tag,
+		ctx:   ctx,
+		state: state,
+	}
+	if state.needsOutbounds() {
+		if err := core.RequireFeatures(ctx, func(om outbound.Manager) {
+			s.ohm = om
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func newDNSState(ctx context.Context, config *Config) (*dnsState, error) {
 	var clientIP net.IP
 	switch len(config.ClientIp) {
 	case 0, net.IPv4len, net.IPv6len:
@@ -109,15 +160,82 @@ func New(ctx context.Context, config *Config) (*DNS, error) {
 		clients = append(clients, NewLocalDNSClient())
 	}
 
-	return &DNS{
-		tag:           tag,
+	return &dnsState{
 		hosts:         hosts,
 		clients:       clients,
 		domainMatcher: domainMatcher,
 		matcherInfos:  matcherInfos,
+		prefetch:      newPrefetcher(config),
 	}, nil
 }
 
+// needsOutbounds returns true if some name servers query through specific outbounds.
+func (st *dnsState) needsOutbounds() bool {
+	for _, client := range st.clients {
+		if client.outboundTag != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func (st *dnsState) checkOutbounds(ohm outbound.Manager) error {
+	for _, client := range st.clients {
+		if client.outboundTag != "" && ohm.GetHandler(client.outboundTag) == nil {
+			return newError("outbound ", client.outboundTag, " of name server ", client.Name(), " not found")
+		}
+	}
+	return nil
+}
+
+func (s *DNS) getState() *dnsState {
+	s.RLock()
+	defer s.RUnlock()
+	return s.state
+}
+
+// acquireState returns the state for a lookup, whose name servers are kept open until lookups.Done is
+// called.
+func (s *DNS) acquireState() *dnsState {
+	s.RLock()
+	defer s.RUnlock()
+	s.state.lookups.Add(1)
+	return s.state
+}
+
+// Update replaces the hosts and name servers of DNS with the ones of the config. Lookups in progress are
+// completed with the previous name servers. The tag of DNS can't be changed.
+func (s *DNS) Update(config *Config) error {
+	if len(config.Tag) > 0 && config.Tag != s.tag {
+		return newError("tag of DNS can't be changed from ", s.tag, " to ", config.Tag)
+	}
+	state, err := newDNSState(s.ctx, config)
+	if err != nil {
+		return err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	if state.needsOutbounds() {
+		if s.ohm == nil {
+			if err := core.RequireFeatures(s.ctx, func(om outbound.Manager) {
+				s.ohm = om
+			}); err != nil {
+				return err
+			}
+		}
+		if err := state.checkOutbounds(s.ohm); err != nil {
+			return err
+		}
+	}
+	s.state.close()
+	s.state = state
+	if s.started {
+		state.prefetch.start(s.prefetchIP)
+	}
+	return nil
+}
+
 // Type implements common.HasType.
 func (*DNS) Type() interface{} {
 	return dns.ClientType()
@@ -125,14 +243,39 @@ func (*DNS) Type() interface{} {
 
 // Start implements common.Runnable.
 func (s *DNS) Start() error {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.state.needsOutbounds() {
+		if err := s.state.checkOutbounds(s.ohm); err != nil {
+			return err
+		}
+	}
+	// Domains are prefetched in background, as name servers may query through outbounds not started yet.
+	s.state.prefetch.start(s.prefetchIP)
+	s.started = true
 	return nil
 }
 
+// Ready implements features.HasReadiness. DNS is ready when the domains to prefetch are resolved.
+func (s *DNS) Ready() bool {
+	return s.getState().prefetch.ready()
+}
+
 // Close implements common.Closable.
 func (s *DNS) Close() error {
+	s.getState().close()
 	return nil
 }
 
+// prefetchIP resolves the domain for the prefetcher.
+func (s *DNS) prefetchIP(ctx context.Context, domain string) ([]net.IP, error) {
+	return s.lookupIPInternal(ctx, domain, IPOption{
+		IPv4Enable: true,
+		IPv6Enable: true,
+	}, "")
+}
+
 // IsOwnLink implements proxy.dns.ownLinkVerifier
 func (s *DNS) IsOwnLink(ctx context.Context) bool {
 	inbound := session.InboundFromContext(ctx)
@@ -141,29 +284,41 @@ func (s *DNS) IsOwnLink(ctx context.Context) bool {
 
 // LookupIP implements dns.Client.
 func (s *DNS) LookupIP(domain string) ([]net.IP, error) {
-	return s.lookupIPInternal(domain, IPOption{
+	return s.lookupIPInternal(context.Background(), domain, IPOption{
 		IPv4Enable: true,
 		IPv6Enable: true,
-	})
+	}, "")
 }
 
 // LookupIPv4 implements dns.IPv4Lookup.
 func (s *DNS) LookupIPv4(domain string) ([]net.IP, error) {
-	return s.lookupIPInternal(domain, IPOption{
+	return s.lookupIPInternal(context.Background(), domain, IPOption{
 		IPv4Enable: true,
 		IPv6Enable: false,
-	})
+	}, "")
 }
 
 // LookupIPv6 implements dns.IPv6Lookup.
 func (s *DNS) LookupIPv6(domain string) ([]net.IP, error) {
-	return s.lookupIPInternal(domain, IPOption{
+	return s.lookupIPInternal(context.Background(), domain, IPOption{
 		IPv4Enable: false,
 		IPv6Enable: true,
-	})
+	}, "")
+}
+
+// WithServerTag implements dns.ServerSelector.
+func (s *DNS) WithServerTag(tag string) (dns.Client, error) {
+	return (&dnsView{DNS: s, ctx: context.Background()}).WithServerTag(tag)
+}
+
+// WithContext implements dns.ContextBinder.
+func (s *DNS) WithContext(ctx context.Context) dns.Client {
+	return &dnsView{DNS: s, ctx: ctx}
 }
 
-func (s *DNS) lookupIPInternal(domain string, option IPOption) ([]net.IP, error) {
+// lookupIPInternal queries the name servers with the given tag, or all of them if the tag is empty, on
+// behalf of the session in ctx.
+func (s *DNS) lookupIPInternal(ctx context.Context, domain string, option IPOption, serverTag string) ([]net.IP, error) {
 	if domain == "" {
 		return nil, newError("empty domain name")
 	}
@@ -172,31 +327,58 @@ func (s *DNS) lookupIPInternal(domain string, option IPOption) ([]net.IP, error)
 	if domain[len(domain)-1] == '.' {
 		domain = domain[:len(domain)-1]
 	}
+	// Rules and hosts are matched in the normalized form, while name servers are queried with the domain as
+	// requested, only with internationalized labels in punycode.
+	query := domain
+	domain = net.NormalizeDomain(domain)
+	for i := 0; i < len(query); i++ {
+		if query[i] >= utf8.RuneSelf {
+			query = domain
+			break
+		}
+	}
+
+	state := s.acquireState()
+	defer state.lookups.Done()
 
 	// Static host lookup
-	switch addrs := s.hosts.Lookup(domain, option); {
+	switch addrs := state.hosts.Lookup(domain, option); {
 	case addrs == nil: // Domain not recorded in static host
 		break
 	case len(addrs) == 0: // Domain recorded, but no valid IP returned (e.g. IPv4 address with only IPv6 enabled)
 		return nil, dns.ErrEmptyResponse
 	case len(addrs) == 1 && addrs[0].Family().IsDomain(): // Domain replacement
-		newError("domain replaced: ", domain, " -> ", addrs[0].Domain()).WriteToLog()
+		newError("domain replaced: ", domain, " -> ", addrs[0].Domain()).WriteToLog(session.ExportIDToError(ctx))
 		domain = addrs[0].Domain()
+		query = domain
 	default: // Successfully found ip records in static host
-		newError("returning ", len(addrs), " IPs for domain ", domain).WriteToLog()
+		newError("returning ", len(addrs), " IPs for domain ", domain).WriteToLog(session.ExportIDToError(ctx))
 		return toNetIP(addrs)
 	}
 
+	// Domains being prefetched are held until they are resolved, and pinned ones are answered at once.
+	if ips := state.prefetch.wait(ctx, domain, option); len(ips) > 0 {
+		return ips, nil
+	}
+
 	// Name servers lookup
 	errs := []error{}
-	ctx := session.ContextWithInbound(context.Background(), &session.Inbound{Tag: s.tag})
-	for _, client := range s.sortClients(domain) {
-		ips, err := client.QueryIP(ctx, domain, option)
+	// Queries are new sessions of the inbound of DNS, which only share the ID and the sniffed domain of the
+	// session in ctx.
+	queryCtx := session.ContextWithInbound(context.Background(), &session.Inbound{Tag: s.tag})
+	if id := session.IDFromContext(ctx); id != 0 {
+		queryCtx = session.ContextWithID(queryCtx, id)
+	}
+	if sniffedDomain := session.SniffedDomainFromContext(ctx); sniffedDomain != "" {
+		queryCtx = session.ContextWithContent(queryCtx, &session.Content{SniffedDomain: sniffedDomain})
+	}
+	for _, client := range state.sortClients(queryCtx, domain, serverTag) {
+		ips, err := client.QueryIP(queryCtx, query, option)
 		if len(ips) > 0 {
 			return ips, nil
 		}
 		if err != nil {
-			newError("failed to lookup ip for domain ", domain, " at server ", client.Name()).Base(err).WriteToLog()
+			newError("failed to lookup ip for domain ", domain, " at server ", client.Name()).Base(err).WriteToLog(session.ExportIDToError(ctx))
 			errs = append(errs, err)
 		}
 		if err != context.Canceled && err != context.DeadlineExceeded && err != errExpectedIPNonMatch {
@@ -207,45 +389,111 @@ func (s *DNS) lookupIPInternal(domain string, option IPOption) ([]net.IP, error)
 	return nil, newError("returning nil for domain ", domain).Base(errors.Combine(errs...))
 }
 
-func (s *DNS) sortClients(domain string) []*Client {
-	clients := make([]*Client, 0, len(s.clients))
-	clientUsed := make([]bool, len(s.clients))
-	clientNames := make([]string, 0, len(s.clients))
+// sortClients returns the name servers to query for the domain, in order. Name servers whose domains match
+// the domain come first, and then the others, unless a matching one skips fallback. Both are in descending
+// priority, and in the order of the name servers for the same priority.
+func (s *dnsState) sortClients(ctx context.Context, domain string, serverTag string) []*Client {
+	matched := make([]bool, len(s.clients))
+	skipFallback := false
 	domainRules := []string{}
 
 	// Priority domain matching
 	for _, match := range s.domainMatcher.Match(domain) {
 		info := s.matcherInfos[match]
 		client := s.clients[info.clientIdx]
+		if len(serverTag) > 0 && client.Tag() != serverTag {
+			continue
+		}
 		domainRule := client.domains[info.domainRuleIdx]
 		domainRules = append(domainRules, fmt.Sprintf("%s(DNS idx:%d)", domainRule, info.clientIdx))
-		if clientUsed[info.clientIdx] {
-			continue
+		matched[info.clientIdx] = true
+		if client.skipFallback {
+			skipFallback = true
 		}
-		clientUsed[info.clientIdx] = true
-		clients = append(clients, client)
-		clientNames = append(clientNames, client.Name())
 	}
 
-	// Default round-robin query
+	clients := make([]*Client, 0, len(s.clients))
+	var fallback []*Client
 	for idx, client := range s.clients {
-		if clientUsed[idx] {
-			continue
+		switch {
+		case len(serverTag) > 0 && client.Tag() != serverTag:
+		case matched[idx]:
+			clients = append(clients, client)
+		case !skipFallback:
+			fallback = append(fallback, client)
 		}
-		clientUsed[idx] = true
-		clients = append(clients, client)
+	}
+	sortByPriority(clients)
+	sortByPriority(fallback)
+	clients = append(clients, fallback...)
+
+	clientNames := make([]string, 0, len(clients))
+	for _, client := range clients {
 		clientNames = append(clientNames, client.Name())
 	}
 
 	if len(domainRules) > 0 {
-		newError("domain ", domain, " matches following rules: ", domainRules).AtDebug().WriteToLog()
+		newError("domain ", domain, " matches following rules: ", domainRules).AtDebug().WriteToLog(session.ExportIDToError(ctx))
 	}
 	if len(clientNames) > 0 {
-		newError("domain ", domain, " will use DNS in order: ", clientNames).AtDebug().WriteToLog()
+		newError("domain ", domain, " will use DNS in order: ", clientNames).AtDebug().WriteToLog(session.ExportIDToError(ctx))
 	}
 	return clients
 }
 
+func sortByPriority(clients []*Client) {
+	sort.SliceStable(clients, func(i, j int) bool {
+		return clients[i].priority > clients[j].priority
+	})
+}
+
+// dnsView is a view of DNS that queries on behalf of a session, and the name servers of one tag only if
+// serverTag is not empty.
+type dnsView struct {
+	*DNS
+	ctx       context.Context
+	serverTag string
+}
+
+// LookupIP implements dns.Client.
+func (s *dnsView) LookupIP(domain string) ([]net.IP, error) {
+	return s.lookupIPInternal(s.ctx, domain, IPOption{
+		IPv4Enable: true,
+		IPv6Enable: true,
+	}, s.serverTag)
+}
+
+// LookupIPv4 implements dns.IPv4Lookup.
+func (s *dnsView) LookupIPv4(domain string) ([]net.IP, error) {
+	return s.lookupIPInternal(s.ctx, domain, IPOption{
+		IPv4Enable: true,
+		IPv6Enable: false,
+	}, s.serverTag)
+}
+
+// LookupIPv6 implements dns.IPv6Lookup.
+func (s *dnsView) LookupIPv6(domain string) ([]net.IP, error) {
+	return s.lookupIPInternal(s.ctx, domain, IPOption{
+		IPv4Enable: false,
+		IPv6Enable: true,
+	}, s.serverTag)
+}
+
+// WithServerTag implements dns.ServerSelector.
+func (s *dnsView) WithServerTag(tag string) (dns.Client, error) {
+	for _, client := range s.getState().clients {
+		if client.Tag() == tag {
+			return &dnsView{DNS: s.DNS, ctx: s.ctx, serverTag: tag}, nil
+		}
+	}
+	return nil, newError("no name server with tag ", tag)
+}
+
+// WithContext implements dns.ContextBinder.
+func (s *dnsView) WithContext(ctx context.Context) dns.Client {
+	return &dnsView{DNS: s.DNS, ctx: ctx, serverTag: s.serverTag}
+}
+
 func init() {
 	common.Must(common.RegisterConfig((*Config)(nil), func(ctx context.Context, config interface{}) (interface{}, error) {
 		return New(ctx, config.(*Config))
@@ -1,6 +1,7 @@
 package dns_test
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -16,9 +17,13 @@ import (
 	"v2ray.com/core/common"
 	"v2ray.com/core/common/net"
 	"v2ray.com/core/common/serial"
+	"v2ray.com/core/common/session"
 	feature_dns "v2ray.com/core/features/dns"
+	"v2ray.com/core/features/outbound"
+	"v2ray.com/core/proxy/blackhole"
 	"v2ray.com/core/proxy/freedom"
 	"v2ray.com/core/testing/servers/udp"
+	"v2ray.com/core/transport"
 )
 
 type staticHandler struct {
@@ -346,6 +351,179 @@ func TestPrioritizedDomain(t *testing.T) {
 	}
 }
 
+func TestServerTag(t *testing.T) {
+	port := udp.PickPort()
+
+	dnsServer := dns.Server{
+		Addr:    "127.0.0.1:" + port.String(),
+		Net:     "udp",
+		Handler: &staticHandler{},
+		UDPSize: 1200,
+	}
+
+	go dnsServer.ListenAndServe()
+	time.Sleep(time.Second)
+
+	endpoint := &net.Endpoint{
+		Network: net.Network_UDP,
+		Address: &net.IPOrDomain{
+			Address: &net.IPOrDomain_Ip{
+				Ip: []byte{127, 0, 0, 1},
+			},
+		},
+		Port: uint32(port),
+	}
+
+	config := &core.Config{
+		App: []*serial.TypedMessage{
+			serial.ToTypedMessage(&Config{
+				NameServer: []*NameServer{
+					{
+						Address: endpoint,
+						Tag:     "isp",
+					},
+					{
+						Address: endpoint,
+						Tag:     "tunnel",
+						Geoip: []*router.GeoIP{
+							{
+								CountryCode: "local",
+								Cidr: []*router.CIDR{
+									{
+										// inner ip, will not match
+										Ip:     []byte{192, 168, 11, 1},
+										Prefix: 32,
+									},
+								},
+							},
+						},
+					},
+				},
+			}),
+			serial.ToTypedMessage(&dispatcher.Config{}),
+			serial.ToTypedMessage(&proxyman.OutboundConfig{}),
+			serial.ToTypedMessage(&policy.Config{}),
+		},
+		Outbound: []*core.OutboundHandlerConfig{
+			{
+				ProxySettings: serial.ToTypedMessage(&freedom.Config{}),
+			},
+		},
+	}
+
+	v, err := core.New(config)
+	common.Must(err)
+
+	client := v.GetFeature(feature_dns.ClientType()).(feature_dns.Client)
+
+	{
+		ips, err := client.LookupIP("google.com")
+		if err != nil {
+			t.Fatal("unexpected error: ", err)
+		}
+		if r := cmp.Diff(ips, []net.IP{{8, 8, 8, 8}}); r != "" {
+			t.Fatal(r)
+		}
+	}
+
+	{
+		isp, err := feature_dns.ClientWithServerTag(client, "isp")
+		common.Must(err)
+		ips, err := isp.(feature_dns.IPv4Lookup).LookupIPv4("google.com")
+		if err != nil {
+			t.Fatal("unexpected error: ", err)
+		}
+		if r := cmp.Diff(ips, []net.IP{{8, 8, 8, 8}}); r != "" {
+			t.Fatal(r)
+		}
+	}
+
+	{
+		tunnel, err := feature_dns.ClientWithServerTag(client, "tunnel")
+		common.Must(err)
+		if ips, err := tunnel.LookupIP("google.com"); err == nil {
+			t.Error("expected only the tunnel server to be queried, but got ", ips)
+		}
+	}
+
+	if _, err := feature_dns.ClientWithServerTag(client, "unknown"); err == nil {
+		t.Error("expected error for unknown server tag")
+	}
+}
+
+func TestOutboundTag(t *testing.T) {
+	port := udp.PickPort()
+
+	dnsServer := dns.Server{
+		Addr:    "127.0.0.1:" + port.String(),
+		Net:     "udp",
+		Handler: &staticHandler{},
+		UDPSize: 1200,
+	}
+
+	go dnsServer.ListenAndServe()
+	time.Sleep(time.Second)
+
+	newConfig := func(outboundTag string) *core.Config {
+		return &core.Config{
+			App: []*serial.TypedMessage{
+				serial.ToTypedMessage(&Config{
+					NameServer: []*NameServer{
+						{
+							Address: &net.Endpoint{
+								Network: net.Network_UDP,
+								Address: &net.IPOrDomain{
+									Address: &net.IPOrDomain_Ip{
+										Ip: []byte{127, 0, 0, 1},
+									},
+								},
+								Port: uint32(port),
+							},
+							OutboundTag: outboundTag,
+						},
+					},
+				}),
+				serial.ToTypedMessage(&dispatcher.Config{}),
+				serial.ToTypedMessage(&proxyman.OutboundConfig{}),
+				serial.ToTypedMessage(&policy.Config{}),
+			},
+			Outbound: []*core.OutboundHandlerConfig{
+				{
+					// The default outbound drops the queries.
+					Tag:           "blocked",
+					ProxySettings: serial.ToTypedMessage(&blackhole.Config{}),
+				},
+				{
+					Tag:           "direct",
+					ProxySettings: serial.ToTypedMessage(&freedom.Config{}),
+				},
+			},
+		}
+	}
+
+	v, err := core.New(newConfig("direct"))
+	common.Must(err)
+	common.Must(v.Start())
+	defer v.Close()
+
+	client := v.GetFeature(feature_dns.ClientType()).(feature_dns.Client)
+	ips, err := client.LookupIP("google.com")
+	if err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+	if r := cmp.Diff(ips, []net.IP{{8, 8, 8, 8}}); r != "" {
+		t.Fatal(r)
+	}
+
+	v, err = core.New(newConfig("unknown"))
+	common.Must(err)
+	if err := v.Start(); err == nil {
+		t.Error("expect error for unknown outbound tag")
+	}
+
+	dnsServer.Shutdown()
+}
+
 func TestUDPServerIPv6(t *testing.T) {
 	port := udp.PickPort()
 
@@ -969,3 +1147,447 @@ func TestMultiMatchPrioritizedDomain(t *testing.T) {
 		t.Error("DNS query doesn't finish in 2 seconds.")
 	}
 }
+
+func TestUpdate(t *testing.T) {
+	hostsConfig := func(ip []byte) *Config {
+		return &Config{
+			StaticHosts: []*Config_HostMapping{
+				{
+					Type:   DomainMatchingType_Full,
+					Domain: "example.com",
+					Ip:     [][]byte{ip},
+				},
+			},
+		}
+	}
+
+	config := &core.Config{
+		App: []*serial.TypedMessage{
+			serial.ToTypedMessage(hostsConfig([]byte{1, 1, 1, 1})),
+			serial.ToTypedMessage(&dispatcher.Config{}),
+			serial.ToTypedMessage(&proxyman.OutboundConfig{}),
+			serial.ToTypedMessage(&policy.Config{}),
+		},
+		Outbound: []*core.OutboundHandlerConfig{
+			{
+				ProxySettings: serial.ToTypedMessage(&freedom.Config{}),
+			},
+		},
+	}
+
+	v, err := core.New(config)
+	common.Must(err)
+
+	server := v.GetFeature(feature_dns.ClientType()).(*DNS)
+	common.Must(server.Update(hostsConfig([]byte{2, 2, 2, 2})))
+
+	ips, err := server.LookupIP("example.com")
+	if err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+	if r := cmp.Diff(ips, []net.IP{{2, 2, 2, 2}}); r != "" {
+		t.Fatal(r)
+	}
+
+	badConfig := hostsConfig([]byte{3, 3, 3, 3})
+	badConfig.NameServer = []*NameServer{
+		{
+			Address: &net.Endpoint{
+				Network: net.Network_UDP,
+				Address: &net.IPOrDomain{
+					Address: &net.IPOrDomain_Ip{
+						Ip: []byte{127, 0, 0, 1},
+					},
+				},
+				Port: 53,
+			},
+			OutboundTag: "nonexistent",
+		},
+	}
+	if err := server.Update(badConfig); err == nil {
+		t.Error("expect error for nonexistent outbound")
+	}
+	ips, err = server.LookupIP("example.com")
+	if err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+	if r := cmp.Diff(ips, []net.IP{{2, 2, 2, 2}}); r != "" {
+		t.Fatal(r)
+	}
+}
+
+func TestNormalizedLookup(t *testing.T) {
+	config := &core.Config{
+		App: []*serial.TypedMessage{
+			serial.ToTypedMessage(&Config{
+				StaticHosts: []*Config_HostMapping{
+					{
+						Type:   DomainMatchingType_Subdomain,
+						Domain: "xn--fsqu00a.xn--0zwm56d",
+						Ip:     [][]byte{{1, 1, 1, 1}},
+					},
+				},
+			}),
+			serial.ToTypedMessage(&dispatcher.Config{}),
+			serial.ToTypedMessage(&proxyman.OutboundConfig{}),
+			serial.ToTypedMessage(&policy.Config{}),
+		},
+		Outbound: []*core.OutboundHandlerConfig{
+			{
+				ProxySettings: serial.ToTypedMessage(&freedom.Config{}),
+			},
+		},
+	}
+
+	v, err := core.New(config)
+	common.Must(err)
+	client := v.GetFeature(feature_dns.ClientType()).(feature_dns.Client)
+
+	for _, domain := range []string{"www.例子.测试.", "WWW.XN--FSQU00A.XN--0ZWM56D"} {
+		ips, err := client.LookupIP(domain)
+		if err != nil {
+			t.Fatal("unexpected error for ", domain, ": ", err)
+		}
+		if r := cmp.Diff(ips, []net.IP{{1, 1, 1, 1}}); r != "" {
+			t.Error(domain, ": ", r)
+		}
+	}
+}
+
+func TestPrefetch(t *testing.T) {
+	port := udp.PickPort()
+
+	dnsServer := dns.Server{
+		Addr:    "127.0.0.1:" + port.String(),
+		Net:     "udp",
+		Handler: &staticHandler{},
+		UDPSize: 1200,
+	}
+
+	go dnsServer.ListenAndServe()
+	time.Sleep(time.Second)
+
+	config := &core.Config{
+		App: []*serial.TypedMessage{
+			serial.ToTypedMessage(&Config{
+				NameServer: []*NameServer{
+					{
+						Address: &net.Endpoint{
+							Network: net.Network_UDP,
+							Address: &net.IPOrDomain{
+								Address: &net.IPOrDomain_Ip{
+									Ip: []byte{127, 0, 0, 1},
+								},
+							},
+							Port: uint32(port),
+						},
+					},
+				},
+				StaticHosts: []*Config_HostMapping{
+					{
+						Type:          DomainMatchingType_Full,
+						Domain:        "pinned.test",
+						ProxiedDomain: "facebook.com",
+						Pin:           true,
+					},
+				},
+				Prefetch:        []string{"google.com", "notexist.google.com"},
+				PrefetchTimeout: 1,
+			}),
+			serial.ToTypedMessage(&dispatcher.Config{}),
+			serial.ToTypedMessage(&proxyman.OutboundConfig{}),
+			serial.ToTypedMessage(&policy.Config{}),
+		},
+		Outbound: []*core.OutboundHandlerConfig{
+			{
+				ProxySettings: serial.ToTypedMessage(&freedom.Config{}),
+			},
+		},
+	}
+
+	v, err := core.New(config)
+	common.Must(err)
+	common.Must(v.Start())
+	defer v.Close()
+
+	client := v.GetFeature(feature_dns.ClientType()).(feature_dns.Client)
+
+	ips, err := client.LookupIP("google.com")
+	if err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+	if r := cmp.Diff(ips, []net.IP{{8, 8, 8, 8}}); r != "" {
+		t.Fatal(r)
+	}
+
+	// Lookups of domains failed to prefetch are held for the timeout only.
+	start := time.Now()
+	if _, err := client.(feature_dns.IPv6Lookup).LookupIPv6("notexist.google.com"); err == nil {
+		t.Error("expect error for notexist.google.com")
+	}
+	if d := time.Since(start); d > time.Second*3 {
+		t.Error("lookup held for ", d)
+	}
+
+	dnsServer.Shutdown()
+
+	ips, err = client.LookupIP("pinned.test")
+	if err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+	if r := cmp.Diff(ips, []net.IP{{9, 9, 9, 9}}); r != "" {
+		t.Fatal(r)
+	}
+}
+
+func TestNameServerPriority(t *testing.T) {
+	port := udp.PickPort()
+
+	dnsServer := dns.Server{
+		Addr:    "127.0.0.1:" + port.String(),
+		Net:     "udp",
+		Handler: &staticHandler{},
+		UDPSize: 1200,
+	}
+
+	go dnsServer.ListenAndServe()
+	time.Sleep(time.Second)
+	defer dnsServer.Shutdown()
+
+	endpoint := &net.Endpoint{
+		Network: net.Network_UDP,
+		Address: &net.IPOrDomain{
+			Address: &net.IPOrDomain_Ip{
+				Ip: []byte{127, 0, 0, 1},
+			},
+		},
+		Port: uint32(port),
+	}
+	googleDomain := []*NameServer_PriorityDomain{
+		{
+			Type:   DomainMatchingType_Subdomain,
+			Domain: "google.com",
+		},
+	}
+	// The name server answers 8.8.4.4 for google.com to queries with client IPs, and 8.8.8.8 otherwise.
+	newClient := func(nameServers ...*NameServer) feature_dns.Client {
+		config := &core.Config{
+			App: []*serial.TypedMessage{
+				serial.ToTypedMessage(&Config{
+					NameServer: nameServers,
+				}),
+				serial.ToTypedMessage(&dispatcher.Config{}),
+				serial.ToTypedMessage(&proxyman.OutboundConfig{}),
+				serial.ToTypedMessage(&policy.Config{}),
+			},
+			Outbound: []*core.OutboundHandlerConfig{
+				{
+					ProxySettings: serial.ToTypedMessage(&freedom.Config{}),
+				},
+			},
+		}
+		v, err := core.New(config)
+		common.Must(err)
+		return v.GetFeature(feature_dns.ClientType()).(feature_dns.Client)
+	}
+	expectIPs := func(client feature_dns.Client, domain string, expected []net.IP) {
+		t.Helper()
+		ips, err := client.LookupIP(domain)
+		if err != nil {
+			t.Fatal("unexpected error: ", err)
+		}
+		if r := cmp.Diff(ips, expected); r != "" {
+			t.Error(r)
+		}
+	}
+
+	// Name servers with overlapping domains are queried in their order.
+	client := newClient(&NameServer{
+		Address:           endpoint,
+		PrioritizedDomain: googleDomain,
+	}, &NameServer{
+		Address:           endpoint,
+		ClientIp:          []byte{10, 0, 0, 1},
+		PrioritizedDomain: googleDomain,
+	})
+	expectIPs(client, "google.com", []net.IP{{8, 8, 8, 8}})
+
+	// Unless they have priorities, which apply to name servers that don't match as well.
+	client = newClient(&NameServer{
+		Address:           endpoint,
+		PrioritizedDomain: googleDomain,
+	}, &NameServer{
+		Address:           endpoint,
+		ClientIp:          []byte{10, 0, 0, 1},
+		PrioritizedDomain: googleDomain,
+		Priority:          10,
+	})
+	expectIPs(client, "google.com", []net.IP{{8, 8, 4, 4}})
+	client = newClient(&NameServer{
+		Address: endpoint,
+	}, &NameServer{
+		Address:  endpoint,
+		ClientIp: []byte{10, 0, 0, 1},
+		Priority: 10,
+	})
+	expectIPs(client, "google.com", []net.IP{{8, 8, 4, 4}})
+
+	// Name servers that match come first whatever the priorities.
+	client = newClient(&NameServer{
+		Address:  endpoint,
+		ClientIp: []byte{10, 0, 0, 1},
+		Priority: 10,
+	}, &NameServer{
+		Address:           endpoint,
+		PrioritizedDomain: googleDomain,
+	})
+	expectIPs(client, "google.com", []net.IP{{8, 8, 8, 8}})
+}
+
+func TestNameServerSkipFallback(t *testing.T) {
+	port := udp.PickPort()
+
+	dnsServer := dns.Server{
+		Addr:    "127.0.0.1:" + port.String(),
+		Net:     "udp",
+		Handler: &staticHandler{},
+		UDPSize: 1200,
+	}
+
+	go dnsServer.ListenAndServe()
+	time.Sleep(time.Second)
+	defer dnsServer.Shutdown()
+
+	endpoint := &net.Endpoint{
+		Network: net.Network_UDP,
+		Address: &net.IPOrDomain{
+			Address: &net.IPOrDomain_Ip{
+				Ip: []byte{127, 0, 0, 1},
+			},
+		},
+		Port: uint32(port),
+	}
+
+	newClient := func(skipFallback bool) feature_dns.Client {
+		config := &core.Config{
+			App: []*serial.TypedMessage{
+				serial.ToTypedMessage(&Config{
+					NameServer: []*NameServer{
+						{
+							Address: endpoint,
+							PrioritizedDomain: []*NameServer_PriorityDomain{
+								{
+									Type:   DomainMatchingType_Full,
+									Domain: "facebook.com",
+								},
+							},
+							// Answers never match, so that the next name servers are queried if any.
+							Geoip: []*router.GeoIP{
+								{
+									Cidr: []*router.CIDR{
+										{Ip: []byte{192, 168, 11, 1}, Prefix: 32},
+									},
+								},
+							},
+							SkipFallback: skipFallback,
+						},
+						{
+							Address: endpoint,
+						},
+					},
+				}),
+				serial.ToTypedMessage(&dispatcher.Config{}),
+				serial.ToTypedMessage(&proxyman.OutboundConfig{}),
+				serial.ToTypedMessage(&policy.Config{}),
+			},
+			Outbound: []*core.OutboundHandlerConfig{
+				{
+					ProxySettings: serial.ToTypedMessage(&freedom.Config{}),
+				},
+			},
+		}
+		v, err := core.New(config)
+		common.Must(err)
+		return v.GetFeature(feature_dns.ClientType()).(feature_dns.Client)
+	}
+
+	client := newClient(false)
+	ips, err := client.LookupIP("facebook.com")
+	if err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+	if r := cmp.Diff(ips, []net.IP{{9, 9, 9, 9}}); r != "" {
+		t.Error(r)
+	}
+
+	client = newClient(true)
+	if ips, err := client.LookupIP("facebook.com"); err == nil {
+		t.Error("expected no fallback for facebook.com, but got ", ips)
+	}
+	// Domains that don't match are queried at all the name servers as usual.
+	ips, err = client.LookupIP("google.com")
+	if err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+	if r := cmp.Diff(ips, []net.IP{{8, 8, 8, 8}}); r != "" {
+		t.Error(r)
+	}
+}
+
+// sniffedDomainRecorder is an outbound that records the sniffed domains of the sessions it gets.
+type sniffedDomainRecorder struct {
+	domains chan string
+}
+
+func (*sniffedDomainRecorder) Start() error { return nil }
+func (*sniffedDomainRecorder) Close() error { return nil }
+func (*sniffedDomainRecorder) Tag() string  { return "recorder" }
+
+func (r *sniffedDomainRecorder) Dispatch(ctx context.Context, link *transport.Link) {
+	r.domains <- session.SniffedDomainFromContext(ctx)
+	common.Interrupt(link.Writer)
+	common.Interrupt(link.Reader)
+}
+
+func TestSniffedDomainOfQueries(t *testing.T) {
+	config := &core.Config{
+		App: []*serial.TypedMessage{
+			serial.ToTypedMessage(&Config{
+				NameServer: []*NameServer{
+					{
+						Address: &net.Endpoint{
+							Network: net.Network_UDP,
+							Address: net.NewIPOrDomain(net.LocalHostIP),
+							Port:    53,
+						},
+					},
+				},
+			}),
+			serial.ToTypedMessage(&dispatcher.Config{}),
+			serial.ToTypedMessage(&proxyman.OutboundConfig{}),
+			serial.ToTypedMessage(&policy.Config{}),
+		},
+	}
+
+	v, err := core.New(config)
+	common.Must(err)
+	recorder := &sniffedDomainRecorder{domains: make(chan string, 1)}
+	common.Must(v.GetFeature(outbound.ManagerType()).(outbound.Manager).AddHandler(context.Background(), recorder))
+
+	// The query is a new session of DNS, which carries the domain sniffed by the session that looks it up.
+	ctx := session.ContextWithContent(context.Background(), &session.Content{
+		Protocol:      "dns",
+		SniffedDomain: "example.com",
+	})
+	client := feature_dns.ClientWithContext(ctx, v.GetFeature(feature_dns.ClientType()).(feature_dns.Client))
+	go client.(feature_dns.IPv4Lookup).LookupIPv4("example.com") // nolint: errcheck
+
+	select {
+	case domain := <-recorder.domains:
+		if domain != "example.com" {
+			t.Error("expected sniffed domain example.com, but got ", domain)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no query dispatched")
+	}
+}
@@ -9,10 +9,13 @@ import (
 
 	"v2ray.com/core"
 	"v2ray.com/core/app/router"
+	"v2ray.com/core/common"
 	"v2ray.com/core/common/errors"
 	"v2ray.com/core/common/net"
+	"v2ray.com/core/common/session"
 	"v2ray.com/core/common/strmatcher"
 	"v2ray.com/core/features/routing"
+	"v2ray.com/core/transport"
 )
 
 // IPOption is an object for IP query options.
@@ -31,10 +34,25 @@ type Server interface {
 
 // Client is the interface for DNS client.
 type Client struct {
-	server    Server
-	clientIP  net.IP
-	domains   []string
-	expectIPs []*router.GeoIPMatcher
+	server       Server
+	tag          string
+	outboundTag  string
+	priority     int32
+	skipFallback bool
+	clientIP     net.IP
+	domains      []string
+	expectIPs    []*router.GeoIPMatcher
+}
+
+// taggedDispatcher dispatches connections through the outbound of a tag, bypassing routing.
+type taggedDispatcher struct {
+	routing.Dispatcher
+	tag string
+}
+
+// Dispatch implements routing.Dispatcher.
+func (d *taggedDispatcher) Dispatch(ctx context.Context, dest net.Destination) (*transport.Link, error) {
+	return d.Dispatcher.Dispatch(session.ContextWithOutboundTag(ctx, d.tag), dest)
 }
 
 var errExpectedIPNonMatch = errors.New("expectIPs not match")
@@ -68,8 +86,17 @@ func NewServer(dest net.Destination, dispatcher routing.Dispatcher) (Server, err
 
 // NewClient creates a DNS client managing a name server with client IP, domain rules and expected IPs.
 func NewClient(ctx context.Context, ns *NameServer, clientIP net.IP, container router.GeoIPMatcherContainer, updateDomainRule func(strmatcher.Matcher, int) error) (*Client, error) {
-	client := &Client{}
+	client := &Client{
+		tag:          ns.Tag,
+		outboundTag:  ns.OutboundTag,
+		priority:     ns.Priority,
+		skipFallback: ns.SkipFallback,
+	}
 	err := core.RequireFeatures(ctx, func(dispatcher routing.Dispatcher) error {
+		if ns.OutboundTag != "" {
+			dispatcher = &taggedDispatcher{Dispatcher: dispatcher, tag: ns.OutboundTag}
+		}
+
 		// Create a new server for each client for now
 		server, err := NewServer(ns.Address.AsDestination(), dispatcher)
 		if err != nil {
@@ -165,11 +192,21 @@ func NewSimpleClient(ctx context.Context, endpoint *net.Endpoint, clientIP net.I
 	return client, err
 }
 
+// Tag returns the tag of the name server, or empty if it has none.
+func (c *Client) Tag() string {
+	return c.tag
+}
+
 // Name returns the server name the client manages.
 func (c *Client) Name() string {
 	return c.server.Name()
 }
 
+// Close closes the name server of the client, if it keeps connections or tasks.
+func (c *Client) Close() error {
+	return common.Close(c.server)
+}
+
 // QueryIP send DNS query to the name server with the client's IP.
 func (c *Client) QueryIP(ctx context.Context, domain string, option IPOption) ([]net.IP, error) {
 	ctx, cancel := context.WithTimeout(ctx, 4*time.Second)
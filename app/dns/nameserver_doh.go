@@ -128,6 +128,12 @@ func (s *DoHNameServer) Name() string {
 	return s.name
 }
 
+// Close implements common.Closable. It stops the cleanup, and closes the idle connections to the server.
+func (s *DoHNameServer) Close() error {
+	s.httpClient.CloseIdleConnections()
+	return s.cleanup.Close()
+}
+
 // Cleanup clears expired items from cache
 func (s *DoHNameServer) Cleanup() error {
 	now := time.Now()
@@ -223,6 +229,9 @@ func (s *DoHNameServer) sendQuery(ctx context.Context, domain string, clientIP n
 			// generate new context for each req, using same context
 			// may cause reqs all aborted if any one encounter an error
 			dnsCtx := context.Background()
+			if id := session.IDFromContext(ctx); id != 0 {
+				dnsCtx = session.ContextWithID(dnsCtx, id)
+			}
 
 			// reserve internal dns server requested Inbound
 			if inbound := session.InboundFromContext(ctx); inbound != nil {
@@ -231,6 +240,7 @@ func (s *DoHNameServer) sendQuery(ctx context.Context, domain string, clientIP n
 
 			dnsCtx = session.ContextWithContent(dnsCtx, &session.Content{
 				Protocol:       "https",
+				SniffedDomain:  session.SniffedDomainFromContext(ctx),
 				SkipDNSResolve: true,
 			})
 
@@ -243,17 +253,17 @@ func (s *DoHNameServer) sendQuery(ctx context.Context, domain string, clientIP n
 
 			b, err := dns.PackMessage(r.msg)
 			if err != nil {
-				newError("failed to pack dns query").Base(err).AtError().WriteToLog()
+				newError("failed to pack dns query").Base(err).AtError().WriteToLog(session.ExportIDToError(ctx))
 				return
 			}
 			resp, err := s.dohHTTPSContext(dnsCtx, b.Bytes())
 			if err != nil {
-				newError("failed to retrieve response").Base(err).AtError().WriteToLog()
+				newError("failed to retrieve response").Base(err).AtError().WriteToLog(session.ExportIDToError(ctx))
 				return
 			}
 			rec, err := parseResponse(resp)
 			if err != nil {
-				newError("failed to handle DOH response").Base(err).AtError().WriteToLog()
+				newError("failed to handle DOH response").Base(err).AtError().WriteToLog(session.ExportIDToError(ctx))
 				return
 			}
 			s.updateIP(r, rec)
@@ -333,7 +343,7 @@ func (s *DoHNameServer) QueryIP(ctx context.Context, domain string, clientIP net
 
 	ips, err := s.findIPsForDomain(fqdn, option)
 	if err != errRecordNotFound {
-		newError(s.name, " cache HIT ", domain, " -> ", ips).Base(err).AtDebug().WriteToLog()
+		newError(s.name, " cache HIT ", domain, " -> ", ips).Base(err).AtDebug().WriteToLog(session.ExportIDToError(ctx))
 		return ips, err
 	}
 
@@ -74,6 +74,17 @@ func (s *QUICNameServer) Name() string {
 	return s.name
 }
 
+// Close implements common.Closable. It stops the cleanup, and closes the session to the server.
+func (s *QUICNameServer) Close() error {
+	s.Lock()
+	if s.session != nil {
+		_ = s.session.CloseWithError(0, "")
+		s.session = nil
+	}
+	s.Unlock()
+	return s.cleanup.Close()
+}
+
 // Cleanup clears expired items from cache
 func (s *QUICNameServer) Cleanup() error {
 	now := time.Now()
@@ -177,6 +188,7 @@ func (s *QUICNameServer) sendQuery(ctx context.Context, domain string, clientIP
 
 			dnsCtx = session.ContextWithContent(dnsCtx, &session.Content{
 				Protocol:       "quic",
+				SniffedDomain:  session.SniffedDomainFromContext(ctx),
 				SkipDNSResolve: true,
 			})
 
@@ -186,19 +198,19 @@ func (s *QUICNameServer) sendQuery(ctx context.Context, domain string, clientIP
 
 			b, err := dns.PackMessage(r.msg)
 			if err != nil {
-				newError("failed to pack dns query").Base(err).AtError().WriteToLog()
+				newError("failed to pack dns query").Base(err).AtError().WriteToLog(session.ExportIDToError(ctx))
 				return
 			}
 
 			conn, err := s.openStream(dnsCtx)
 			if err != nil {
-				newError("failed to open quic session").Base(err).AtError().WriteToLog()
+				newError("failed to open quic session").Base(err).AtError().WriteToLog(session.ExportIDToError(ctx))
 				return
 			}
 
 			_, err = conn.Write(b.Bytes())
 			if err != nil {
-				newError("failed to send query").Base(err).AtError().WriteToLog()
+				newError("failed to send query").Base(err).AtError().WriteToLog(session.ExportIDToError(ctx))
 				return
 			}
 
@@ -208,13 +220,13 @@ func (s *QUICNameServer) sendQuery(ctx context.Context, domain string, clientIP
 			defer respBuf.Release()
 			n, err := respBuf.ReadFrom(conn)
 			if err != nil && n == 0 {
-				newError("failed to read response").Base(err).AtError().WriteToLog()
+				newError("failed to read response").Base(err).AtError().WriteToLog(session.ExportIDToError(ctx))
 				return
 			}
 
 			rec, err := parseResponse(respBuf.Bytes())
 			if err != nil {
-				newError("failed to handle response").Base(err).AtError().WriteToLog()
+				newError("failed to handle response").Base(err).AtError().WriteToLog(session.ExportIDToError(ctx))
 				return
 			}
 			s.updateIP(r, rec)
@@ -270,7 +282,7 @@ func (s *QUICNameServer) QueryIP(ctx context.Context, domain string, clientIP ne
 
 	ips, err := s.findIPsForDomain(fqdn, option)
 	if err != errRecordNotFound {
-		newError(s.name, " cache HIT ", domain, " -> ", ips).Base(err).AtDebug().WriteToLog()
+		newError(s.name, " cache HIT ", domain, " -> ", ips).Base(err).AtDebug().WriteToLog(session.ExportIDToError(ctx))
 		return ips, err
 	}
 
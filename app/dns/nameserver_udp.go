@@ -63,6 +63,12 @@ func (s *ClassicNameServer) Name() string {
 	return s.name
 }
 
+// Close implements common.Closable. It stops the cleanup, and closes the connection to the server.
+func (s *ClassicNameServer) Close() error {
+	s.udpServer.RemoveRay(s.address)
+	return s.cleanup.Close()
+}
+
 // Cleanup clears expired items from cache
 func (s *ClassicNameServer) Cleanup() error {
 	now := time.Now()
@@ -196,7 +202,8 @@ func (s *ClassicNameServer) sendQuery(ctx context.Context, domain string, client
 			udpCtx = session.ContextWithInbound(udpCtx, inbound)
 		}
 		udpCtx = session.ContextWithContent(udpCtx, &session.Content{
-			Protocol: "dns",
+			Protocol:      "dns",
+			SniffedDomain: session.SniffedDomainFromContext(ctx),
 		})
 		s.udpServer.Dispatch(udpCtx, s.address, b)
 	}
@@ -246,7 +253,7 @@ func (s *ClassicNameServer) QueryIP(ctx context.Context, domain string, clientIP
 
 	ips, err := s.findIPsForDomain(fqdn, option)
 	if err != errRecordNotFound {
-		newError(s.name, " cache HIT ", domain, " -> ", ips).Base(err).AtDebug().WriteToLog()
+		newError(s.name, " cache HIT ", domain, " -> ", ips).Base(err).AtDebug().WriteToLog(session.ExportIDToError(ctx))
 		return ips, err
 	}
 
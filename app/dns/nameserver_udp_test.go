@@ -0,0 +1,73 @@
+package dns_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "v2ray.com/core/app/dns"
+	"v2ray.com/core/common/buf"
+	"v2ray.com/core/common/net"
+	"v2ray.com/core/features/routing"
+	"v2ray.com/core/transport"
+	"v2ray.com/core/transport/pipe"
+)
+
+type testDispatcher struct {
+	uplinks chan buf.Reader
+}
+
+func (d *testDispatcher) Dispatch(ctx context.Context, dest net.Destination) (*transport.Link, error) {
+	uplinkReader, uplinkWriter := pipe.New()
+	downlinkReader, _ := pipe.New()
+	d.uplinks <- uplinkReader
+	return &transport.Link{Reader: downlinkReader, Writer: uplinkWriter}, nil
+}
+
+func (*testDispatcher) Start() error {
+	return nil
+}
+
+func (*testDispatcher) Close() error {
+	return nil
+}
+
+func (*testDispatcher) Type() interface{} {
+	return routing.DispatcherType()
+}
+
+func TestClassicNameServerClose(t *testing.T) {
+	dispatcher := &testDispatcher{uplinks: make(chan buf.Reader, 1)}
+	server := NewClassicNameServer(net.UDPDestination(net.LocalHostIP, 53), dispatcher)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	go server.QueryIP(ctx, "example.com", nil, IPOption{IPv4Enable: true}) // nolint: errcheck
+
+	var uplink buf.Reader
+	select {
+	case uplink = <-dispatcher.uplinks:
+	case <-time.After(2 * time.Second):
+		t.Fatal("no query dispatched")
+	}
+	if _, err := uplink.ReadMultiBuffer(); err != nil {
+		t.Fatal("failed to read query: ", err)
+	}
+
+	if err := server.Close(); err != nil {
+		t.Fatal(err)
+	}
+	closed := make(chan error, 1)
+	go func() {
+		_, err := uplink.ReadMultiBuffer()
+		closed <- err
+	}()
+	select {
+	case err := <-closed:
+		if err == nil {
+			t.Error("expected the connection to the server to be closed")
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("connection to the server still open")
+	}
+}
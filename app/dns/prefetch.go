@@ -0,0 +1,166 @@
+// +build !confonly
+
+package dns
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"v2ray.com/core/common/net"
+	"v2ray.com/core/common/signal/done"
+)
+
+const (
+	defaultPrefetchTimeout = time.Second * 5
+	minPrefetchRetry       = time.Second
+	maxPrefetchRetry       = time.Minute
+)
+
+// prefetchEntry is a domain resolved when DNS starts. The answer of a pinned domain never expires.
+type prefetchEntry struct {
+	ready  *done.Instance
+	pinned bool
+
+	access sync.RWMutex
+	ips    []net.IP
+}
+
+// answer returns the pinned answer of the IP families in option, if any.
+func (e *prefetchEntry) answer(option IPOption) []net.IP {
+	e.access.RLock()
+	defer e.access.RUnlock()
+
+	var ips []net.IP
+	for _, ip := range e.ips {
+		if (ip.To4() != nil && option.IPv4Enable) || (ip.To4() == nil && option.IPv6Enable) {
+			ips = append(ips, ip)
+		}
+	}
+	return ips
+}
+
+// prefetcher resolves domains in background when DNS starts, and holds lookups of them until they are
+// resolved, or the timeout passes.
+type prefetcher struct {
+	entries map[string]*prefetchEntry
+	timeout time.Duration
+	closed  *done.Instance
+
+	access   sync.Mutex
+	deadline time.Time
+}
+
+func newPrefetcher(config *Config) *prefetcher {
+	p := &prefetcher{
+		entries: make(map[string]*prefetchEntry),
+		timeout: time.Duration(config.PrefetchTimeout) * time.Second,
+		closed:  done.New(),
+	}
+	if p.timeout == 0 {
+		p.timeout = defaultPrefetchTimeout
+	}
+	add := func(domain string, pinned bool) {
+		domain = net.NormalizeDomain(domain)
+		entry, found := p.entries[domain]
+		if !found {
+			entry = &prefetchEntry{ready: done.New()}
+			p.entries[domain] = entry
+		}
+		entry.pinned = entry.pinned || pinned
+	}
+	for _, domain := range config.Prefetch {
+		add(domain, false)
+	}
+	for _, mapping := range config.StaticHosts {
+		if mapping.Pin && len(mapping.ProxiedDomain) > 0 {
+			add(mapping.ProxiedDomain, true)
+		}
+	}
+	return p
+}
+
+// start resolves the domains with lookup, retrying failures in background until the prefetcher is closed.
+func (p *prefetcher) start(lookup func(ctx context.Context, domain string) ([]net.IP, error)) {
+	if len(p.entries) == 0 {
+		return
+	}
+	p.access.Lock()
+	p.deadline = time.Now().Add(p.timeout)
+	p.access.Unlock()
+
+	ctx := context.WithValue(context.Background(), prefetchKey{}, true)
+	for domain, entry := range p.entries {
+		go p.resolve(ctx, domain, entry, lookup)
+	}
+}
+
+func (p *prefetcher) resolve(ctx context.Context, domain string, entry *prefetchEntry, lookup func(ctx context.Context, domain string) ([]net.IP, error)) {
+	retry := minPrefetchRetry
+	for {
+		ips, err := lookup(ctx, domain)
+		if err == nil && len(ips) > 0 {
+			if entry.pinned {
+				entry.access.Lock()
+				entry.ips = ips
+				entry.access.Unlock()
+			}
+			newError("prefetched ", domain, ": ", ips).AtInfo().WriteToLog()
+			entry.ready.Close()
+			return
+		}
+		newError("failed to prefetch ", domain, ", retrying in ", retry).Base(err).AtWarning().WriteToLog()
+		select {
+		case <-p.closed.Wait():
+			return
+		case <-time.After(retry):
+		}
+		if retry *= 2; retry > maxPrefetchRetry {
+			retry = maxPrefetchRetry
+		}
+	}
+}
+
+// wait holds a lookup of the domain until it is prefetched, or the timeout since the start passes. It
+// returns the answer if the domain is pinned.
+func (p *prefetcher) wait(ctx context.Context, domain string, option IPOption) []net.IP {
+	entry, found := p.entries[domain]
+	if !found || ctx.Value(prefetchKey{}) != nil {
+		return nil
+	}
+	if ips := entry.answer(option); len(ips) > 0 {
+		return ips
+	}
+
+	p.access.Lock()
+	deadline := p.deadline
+	p.access.Unlock()
+	if wait := time.Until(deadline); wait > 0 {
+		timer := time.NewTimer(wait)
+		select {
+		case <-entry.ready.Wait():
+		case <-p.closed.Wait():
+		case <-ctx.Done():
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+	return entry.answer(option)
+}
+
+// ready returns whether all domains are prefetched.
+func (p *prefetcher) ready() bool {
+	for _, entry := range p.entries {
+		if !entry.ready.Done() {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *prefetcher) close() {
+	p.closed.Close()
+}
+
+// prefetchKey marks the context of lookups by the prefetcher, which are not held.
+type prefetchKey struct{}
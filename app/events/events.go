@@ -0,0 +1,249 @@
+// +build !confonly
+
+// Package events delivers events of V2Ray, such as outbounds failing health checks, to webhooks and
+// scripts, without blocking the components that emit them.
+package events
+
+//go:generate go run v2ray.com/core/common/errors/errorgen
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"v2ray.com/core/common"
+	"v2ray.com/core/common/signal/done"
+	"v2ray.com/core/features/events"
+)
+
+const (
+	defaultQueueSize   = 256
+	defaultMaxRetries  = 3
+	defaultHookTimeout = 10 * time.Second
+	// retryInterval is the wait before the first retry of a delivery, which doubles on each retry.
+	retryInterval = time.Second
+)
+
+// message is the JSON form of an event delivered to hooks.
+type message struct {
+	Type     string                 `json:"type"`
+	Time     time.Time              `json:"time"`
+	Instance string                 `json:"instance"`
+	Data     map[string]interface{} `json:"data,omitempty"`
+}
+
+// delivery is an event waiting in the queue of a hook.
+type delivery struct {
+	eventType string
+	payload   []byte
+}
+
+// hook delivers the events of its types, one at a time, from its queue.
+type hook struct {
+	events     map[string]bool
+	target     string
+	deliver    func(ctx context.Context, d *delivery) error
+	timeout    time.Duration
+	maxRetries uint32
+	queue      chan *delivery
+	// dropped is the number of events dropped since the last report, as the queue was full.
+	dropped uint32
+}
+
+func newHook(config *Hook, queueSize uint32, maxRetries uint32) (*hook, error) {
+	h := &hook{
+		events:     make(map[string]bool),
+		timeout:    time.Duration(config.Timeout) * time.Second,
+		maxRetries: maxRetries,
+		queue:      make(chan *delivery, queueSize),
+	}
+	for _, e := range config.Event {
+		h.events[e] = true
+	}
+	if h.timeout == 0 {
+		h.timeout = defaultHookTimeout
+	}
+
+	switch {
+	case len(config.Url) > 0:
+		h.target = config.Url
+		h.deliver = func(ctx context.Context, d *delivery) error {
+			return post(ctx, config.Url, d)
+		}
+	case len(config.Command) > 0:
+		h.target = strings.Join(config.Command, " ")
+		h.deliver = func(ctx context.Context, d *delivery) error {
+			return run(ctx, config.Command, d)
+		}
+	default:
+		return nil, newError("hook has neither URL nor command")
+	}
+	return h, nil
+}
+
+func post(ctx context.Context, url string, d *delivery) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(d.payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode/100 != 2 {
+		return newError("unexpected status ", resp.Status)
+	}
+	return nil
+}
+
+func run(ctx context.Context, command []string, d *delivery) error {
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Stdin = bytes.NewReader(d.payload)
+	cmd.Env = append(os.Environ(), "V2RAY_EVENT="+d.eventType)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return newError("command fails with output: ", strings.TrimSpace(string(output))).Base(err)
+	}
+	return nil
+}
+
+func (h *hook) wants(eventType string) bool {
+	return len(h.events) == 0 || h.events[eventType]
+}
+
+// push queues the delivery, or drops it if the queue is full.
+func (h *hook) push(d *delivery) {
+	select {
+	case h.queue <- d:
+	default:
+		atomic.AddUint32(&h.dropped, 1)
+	}
+}
+
+// run delivers the queued events until done, with retries.
+func (h *hook) run(done *done.Instance) {
+	for {
+		var d *delivery
+		select {
+		case d = <-h.queue:
+		case <-done.Wait():
+			return
+		}
+		if dropped := atomic.SwapUint32(&h.dropped, 0); dropped > 0 {
+			newError("dropped ", dropped, " events of hook ", h.target, " as its queue is full").AtWarning().WriteToLog()
+		}
+
+		wait := retryInterval
+		for attempt := uint32(0); ; attempt++ {
+			ctx, cancel := context.WithTimeout(context.Background(), h.timeout)
+			err := h.deliver(ctx, d)
+			cancel()
+			if err == nil {
+				break
+			}
+			if attempt >= h.maxRetries {
+				newError("failed to deliver ", d.eventType, " event to hook ", h.target).Base(err).AtWarning().WriteToLog()
+				break
+			}
+			newError("failed to deliver ", d.eventType, " event to hook ", h.target, ", retrying in ", wait).Base(err).AtDebug().WriteToLog()
+			select {
+			case <-time.After(wait):
+			case <-done.Wait():
+				return
+			}
+			wait *= 2
+		}
+	}
+}
+
+// Hooks is an implementation of events.Emitter, which delivers events to webhooks and commands.
+type Hooks struct {
+	instance string
+	hooks    []*hook
+	done     *done.Instance
+}
+
+// New creates a new Hooks.
+func New(ctx context.Context, config *Config) (*Hooks, error) {
+	h := &Hooks{
+		instance: config.Instance,
+		done:     done.New(),
+	}
+	if len(h.instance) == 0 {
+		h.instance, _ = os.Hostname()
+	}
+	queueSize := config.QueueSize
+	if queueSize == 0 {
+		queueSize = defaultQueueSize
+	}
+	maxRetries := config.MaxRetries
+	if maxRetries == 0 {
+		maxRetries = defaultMaxRetries
+	}
+	for _, hc := range config.Hook {
+		hook, err := newHook(hc, queueSize, maxRetries)
+		if err != nil {
+			return nil, err
+		}
+		h.hooks = append(h.hooks, hook)
+	}
+	return h, nil
+}
+
+// Type implements common.HasType.
+func (*Hooks) Type() interface{} {
+	return events.EmitterType()
+}
+
+// Emit implements events.Emitter.
+func (h *Hooks) Emit(event *events.Event) {
+	var payload []byte
+	for _, hook := range h.hooks {
+		if !hook.wants(event.Type) {
+			continue
+		}
+		if payload == nil {
+			var err error
+			payload, err = json.Marshal(&message{
+				Type:     event.Type,
+				Time:     event.Time,
+				Instance: h.instance,
+				Data:     event.Data,
+			})
+			if err != nil {
+				newError("failed to marshal ", event.Type, " event").Base(err).AtWarning().WriteToLog()
+				return
+			}
+		}
+		hook.push(&delivery{eventType: event.Type, payload: payload})
+	}
+}
+
+// Start implements common.Runnable. Events emitted before are delivered after it.
+func (h *Hooks) Start() error {
+	for _, hook := range h.hooks {
+		go hook.run(h.done)
+	}
+	return nil
+}
+
+// Close implements common.Closable. Events not delivered yet are dropped.
+func (h *Hooks) Close() error {
+	return h.done.Close()
+}
+
+func init() {
+	common.Must(common.RegisterConfig((*Config)(nil), func(ctx context.Context, config interface{}) (interface{}, error) {
+		return New(ctx, config.(*Config))
+	}))
+}
@@ -0,0 +1,122 @@
+package events_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"v2ray.com/core"
+	. "v2ray.com/core/app/events"
+	"v2ray.com/core/app/proxyman"
+	_ "v2ray.com/core/app/proxyman/inbound"
+	_ "v2ray.com/core/app/proxyman/outbound"
+	"v2ray.com/core/common"
+	"v2ray.com/core/common/serial"
+	"v2ray.com/core/features/events"
+	"v2ray.com/core/proxy/freedom"
+)
+
+type received struct {
+	Type     string                 `json:"type"`
+	Instance string                 `json:"instance"`
+	Data     map[string]interface{} `json:"data"`
+}
+
+func TestWebhook(t *testing.T) {
+	var failures int32
+	ch := make(chan received, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The first delivery fails, and is retried.
+		if atomic.AddInt32(&failures, 1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var e received
+		common.Must(json.NewDecoder(r.Body).Decode(&e))
+		ch <- e
+	}))
+	defer server.Close()
+
+	config := &core.Config{
+		App: []*serial.TypedMessage{
+			serial.ToTypedMessage(&Config{
+				Instance: "test",
+				Hook: []*Hook{
+					{
+						Event: []string{events.OutboundAdded},
+						Url:   server.URL,
+					},
+				},
+			}),
+			serial.ToTypedMessage(&proxyman.InboundConfig{}),
+			serial.ToTypedMessage(&proxyman.OutboundConfig{}),
+		},
+		Outbound: []*core.OutboundHandlerConfig{
+			{
+				Tag:           "direct",
+				ProxySettings: serial.ToTypedMessage(&freedom.Config{}),
+			},
+		},
+	}
+	v, err := core.New(config)
+	common.Must(err)
+	common.Must(v.Start())
+	defer v.Close()
+
+	select {
+	case e := <-ch:
+		if e.Type != events.OutboundAdded || e.Instance != "test" || e.Data["tag"] != "direct" {
+			t.Error("unexpected event: ", e)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("no event delivered")
+	}
+}
+
+func TestCommandHook(t *testing.T) {
+	dir := t.TempDir()
+	payloadFile := filepath.Join(dir, "payload")
+	envFile := filepath.Join(dir, "env")
+	hooks, err := New(context.Background(), &Config{
+		Instance: "test",
+		Hook: []*Hook{
+			{
+				Command: []string{"sh", "-c", "cat > " + payloadFile + " && echo $V2RAY_EVENT > " + envFile},
+			},
+		},
+	})
+	common.Must(err)
+	common.Must(hooks.Start())
+	defer hooks.Close()
+
+	hooks.Emit(events.New(events.QuotaExceeded, map[string]interface{}{"email": "love@v2ray.com"}))
+
+	deadline := time.Now().Add(time.Second * 5)
+	for {
+		env, _ := ioutil.ReadFile(envFile)
+		if len(env) > 0 {
+			if string(env) != events.QuotaExceeded+"\n" {
+				t.Error("unexpected environment: ", string(env))
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("no event delivered")
+		}
+		time.Sleep(time.Millisecond * 100)
+	}
+
+	payload, err := ioutil.ReadFile(payloadFile)
+	common.Must(err)
+	var e received
+	common.Must(json.Unmarshal(payload, &e))
+	if e.Type != events.QuotaExceeded || e.Instance != "test" || e.Data["email"] != "love@v2ray.com" {
+		t.Error("unexpected event: ", e)
+	}
+}
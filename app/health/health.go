@@ -0,0 +1,119 @@
+// +build !confonly
+
+// Package health serves the liveness and readiness of V2Ray over HTTP, for orchestrators such as Kubernetes.
+package health
+
+//go:generate go run v2ray.com/core/common/errors/errorgen
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"v2ray.com/core"
+	"v2ray.com/core/common"
+)
+
+const readHeaderTimeout = 5 * time.Second
+
+// readiness is the JSON body of the responses of /ready.
+type readiness struct {
+	Ready    bool     `json:"ready"`
+	NotReady []string `json:"notReady"`
+}
+
+// Server is the HTTP server for health checks.
+type Server struct {
+	instance *core.Instance
+	listen   string
+
+	access sync.Mutex
+	server *http.Server
+}
+
+// New creates a Server. It listens when started.
+func New(ctx context.Context, config *Config) (*Server, error) {
+	if config.Listen == "" {
+		return nil, newError("health: listen address is not set")
+	}
+	return &Server{
+		instance: core.MustFromContext(ctx),
+		listen:   config.Listen,
+	}, nil
+}
+
+// Type implements common.HasType.
+func (*Server) Type() interface{} {
+	return (*Server)(nil)
+}
+
+func (s *Server) serveHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("ok\n")) // nolint: errcheck
+}
+
+func (s *Server) serveReady(w http.ResponseWriter, r *http.Request) {
+	body := readiness{NotReady: s.instance.NotReady()}
+	if body.NotReady == nil {
+		body.NotReady = []string{}
+	}
+	body.Ready = len(body.NotReady) == 0
+
+	w.Header().Set("Content-Type", "application/json")
+	if !body.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	// Failing to write means the client has gone.
+	json.NewEncoder(w).Encode(body) // nolint: errcheck
+}
+
+// Start implements common.Runnable. The server is started before inbounds, so that orchestrators see V2Ray
+// as not ready, rather than not responding, while it starts.
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.listen)
+	if err != nil {
+		return newError("failed to listen on ", s.listen).Base(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", s.serveHealthz)
+	mux.HandleFunc("/ready", s.serveReady)
+	server := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: readHeaderTimeout,
+	}
+
+	s.access.Lock()
+	s.server = server
+	s.access.Unlock()
+
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			newError("health check server stopped").Base(err).AtError().WriteToLog()
+		}
+	}()
+	newError("health check server listening on ", listener.Addr()).AtInfo().WriteToLog()
+	return nil
+}
+
+// Close implements common.Closable.
+func (s *Server) Close() error {
+	s.access.Lock()
+	defer s.access.Unlock()
+
+	if s.server == nil {
+		return nil
+	}
+	err := s.server.Close()
+	s.server = nil
+	return err
+}
+
+func init() {
+	common.Must(common.RegisterConfig((*Config)(nil), func(ctx context.Context, config interface{}) (interface{}, error) {
+		return New(ctx, config.(*Config))
+	}))
+}
@@ -0,0 +1,152 @@
+package health_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"v2ray.com/core"
+	"v2ray.com/core/app/dispatcher"
+	"v2ray.com/core/app/dns"
+	. "v2ray.com/core/app/health"
+	"v2ray.com/core/app/proxyman"
+	_ "v2ray.com/core/app/proxyman/inbound"
+	_ "v2ray.com/core/app/proxyman/outbound"
+	"v2ray.com/core/common"
+	"v2ray.com/core/common/net"
+	"v2ray.com/core/common/serial"
+	"v2ray.com/core/proxy/dokodemo"
+	"v2ray.com/core/proxy/freedom"
+	"v2ray.com/core/testing/servers/tcp"
+	"v2ray.com/core/testing/servers/udp"
+)
+
+type readiness struct {
+	Ready    bool     `json:"ready"`
+	NotReady []string `json:"notReady"`
+}
+
+func get(t *testing.T, url string) (int, []byte) {
+	resp, err := http.Get(url)
+	common.Must(err)
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	common.Must(err)
+	return resp.StatusCode, body
+}
+
+func newInstance(port net.Port, dnsConfig *dns.Config, inbounds ...*core.InboundHandlerConfig) *core.Instance {
+	server, err := core.New(&core.Config{
+		App: []*serial.TypedMessage{
+			serial.ToTypedMessage(&Config{Listen: "127.0.0.1:" + port.String()}),
+			serial.ToTypedMessage(dnsConfig),
+			serial.ToTypedMessage(&dispatcher.Config{}),
+			serial.ToTypedMessage(&proxyman.InboundConfig{}),
+			serial.ToTypedMessage(&proxyman.OutboundConfig{}),
+		},
+		Inbound: inbounds,
+		Outbound: []*core.OutboundHandlerConfig{
+			{ProxySettings: serial.ToTypedMessage(&freedom.Config{})},
+		},
+	})
+	common.Must(err)
+	return server
+}
+
+func TestReadiness(t *testing.T) {
+	port := tcp.PickPort()
+	// Nothing answers DNS queries to this port, so that the domain is never prefetched.
+	dnsPort := udp.PickPort()
+
+	server := newInstance(port, &dns.Config{
+		NameServer: []*dns.NameServer{{
+			Address: &net.Endpoint{
+				Network: net.Network_UDP,
+				Address: net.NewIPOrDomain(net.LocalHostIP),
+				Port:    uint32(dnsPort),
+			},
+		}},
+		Prefetch: []string{"www.v2fly.org"},
+	})
+	if _, err := http.Get("http://127.0.0.1:" + port.String() + "/healthz"); err == nil {
+		t.Error("health check server is listening before started")
+	}
+	common.Must(server.Start())
+
+	status, body := get(t, "http://127.0.0.1:"+port.String()+"/healthz")
+	if status != http.StatusOK || string(body) != "ok\n" {
+		t.Error("unexpected liveness: ", status, " ", string(body))
+	}
+
+	status, body = get(t, "http://127.0.0.1:"+port.String()+"/ready")
+	var r readiness
+	common.Must(json.Unmarshal(body, &r))
+	if status != http.StatusServiceUnavailable {
+		t.Error("unexpected status of readiness: ", status)
+	}
+	if diff := cmp.Diff(r, readiness{NotReady: []string{"dns"}}); diff != "" {
+		t.Error(diff)
+	}
+	common.Must(server.Close())
+
+	server = newInstance(port, &dns.Config{
+		StaticHosts: []*dns.Config_HostMapping{{
+			Type:   dns.DomainMatchingType_Full,
+			Domain: "www.v2fly.org",
+			Ip:     [][]byte{{127, 0, 0, 1}},
+		}},
+		Prefetch: []string{"www.v2fly.org"},
+	})
+	common.Must(server.Start())
+	defer server.Close()
+
+	// Prefetching runs in background.
+	time.Sleep(time.Millisecond * 100)
+	status, body = get(t, "http://127.0.0.1:"+port.String()+"/ready")
+	r = readiness{}
+	common.Must(json.Unmarshal(body, &r))
+	if status != http.StatusOK {
+		t.Error("unexpected status of readiness: ", status)
+	}
+	if diff := cmp.Diff(r, readiness{Ready: true, NotReady: []string{}}); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestReadinessOfFailedStart(t *testing.T) {
+	port := tcp.PickPort()
+	occupied, err := net.Listen("tcp", "127.0.0.1:0")
+	common.Must(err)
+	defer occupied.Close()
+
+	server := newInstance(port, &dns.Config{}, &core.InboundHandlerConfig{
+		ReceiverSettings: serial.ToTypedMessage(&proxyman.ReceiverConfig{
+			PortRange: net.SinglePortRange(net.Port(occupied.Addr().(*net.TCPAddr).Port)),
+			Listen:    net.NewIPOrDomain(net.LocalHostIP),
+		}),
+		ProxySettings: serial.ToTypedMessage(&dokodemo.Config{
+			Address:  net.NewIPOrDomain(net.LocalHostIP),
+			Port:     80,
+			Networks: []net.Network{net.Network_TCP},
+		}),
+	})
+	defer server.Close()
+	if err := server.Start(); err == nil {
+		t.Fatal("inbound is started on an occupied port")
+	}
+
+	// The inbound that failed to start is reported, as long as the process stays.
+	status, body := get(t, "http://127.0.0.1:"+port.String()+"/ready")
+	var r readiness
+	common.Must(json.Unmarshal(body, &r))
+	if status != http.StatusServiceUnavailable {
+		t.Error("unexpected status of readiness: ", status)
+	}
+	if diff := cmp.Diff(r, readiness{NotReady: []string{"inbound"}}); diff != "" {
+		t.Error(diff)
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"v2ray.com/core"
 	"v2ray.com/core/app/log"
 	"v2ray.com/core/common"
+	clog "v2ray.com/core/common/log"
 )
 
 type LoggerServer struct {
@@ -33,6 +34,53 @@ func (s *LoggerServer) RestartLogger(ctx context.Context, request *RestartLogger
 	return &RestartLoggerResponse{}, nil
 }
 
+func (s *LoggerServer) logger() (*log.Instance, error) {
+	logger, ok := s.V.GetFeature((*log.Instance)(nil)).(*log.Instance)
+	if !ok {
+		return nil, newError("unable to get logger instance")
+	}
+	return logger, nil
+}
+
+// SetLogLevel implements LoggerService.
+func (s *LoggerServer) SetLogLevel(ctx context.Context, request *SetLogLevelRequest) (*SetLogLevelResponse, error) {
+	logger, err := s.logger()
+	if err != nil {
+		return nil, err
+	}
+	switch request.Level {
+	case clog.Severity_Error, clog.Severity_Warning, clog.Severity_Info, clog.Severity_Debug:
+	default:
+		return nil, newError("invalid log level: ", request.Level)
+	}
+	logger.SetErrorLogLevel(request.Level)
+	newError("log level is set to ", request.Level).AtWarning().WriteToLog()
+	return &SetLogLevelResponse{}, nil
+}
+
+// GetLogLevel implements LoggerService.
+func (s *LoggerServer) GetLogLevel(ctx context.Context, request *GetLogLevelRequest) (*GetLogLevelResponse, error) {
+	logger, err := s.logger()
+	if err != nil {
+		return nil, err
+	}
+	return &GetLogLevelResponse{Level: logger.ErrorLogLevel()}, nil
+}
+
+// FollowLog implements LoggerService.
+func (s *LoggerServer) FollowLog(request *FollowLogRequest, stream LoggerService_FollowLogServer) error {
+	logger, err := s.logger()
+	if err != nil {
+		return err
+	}
+	for msg := range logger.Follow(stream.Context(), 256) {
+		if err := stream.Send(&FollowLogResponse{Message: msg.String()}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (s *LoggerServer) mustEmbedUnimplementedLoggerServiceServer() {}
 
 type service struct {
@@ -12,6 +12,7 @@ import (
 	_ "v2ray.com/core/app/proxyman/inbound"
 	_ "v2ray.com/core/app/proxyman/outbound"
 	"v2ray.com/core/common"
+	clog "v2ray.com/core/common/log"
 	"v2ray.com/core/common/serial"
 )
 
@@ -32,3 +33,30 @@ func TestLoggerRestart(t *testing.T) {
 	}
 	common.Must2(server.RestartLogger(context.Background(), &RestartLoggerRequest{}))
 }
+
+func TestLoggerLogLevel(t *testing.T) {
+	v, err := core.New(&core.Config{
+		App: []*serial.TypedMessage{
+			serial.ToTypedMessage(&log.Config{ErrorLogLevel: clog.Severity_Warning}),
+			serial.ToTypedMessage(&dispatcher.Config{}),
+			serial.ToTypedMessage(&proxyman.InboundConfig{}),
+			serial.ToTypedMessage(&proxyman.OutboundConfig{}),
+		},
+	})
+	common.Must(err)
+	common.Must(v.Start())
+
+	server := &LoggerServer{
+		V: v,
+	}
+	common.Must2(server.SetLogLevel(context.Background(), &SetLogLevelRequest{Level: clog.Severity_Debug}))
+	resp, err := server.GetLogLevel(context.Background(), &GetLogLevelRequest{})
+	common.Must(err)
+	if resp.Level != clog.Severity_Debug {
+		t.Error("expected level Debug, but actually ", resp.Level)
+	}
+
+	if _, err := server.SetLogLevel(context.Background(), &SetLogLevelRequest{Level: clog.Severity_Unknown}); err == nil {
+		t.Error("expected error for unknown level")
+	}
+}
@@ -19,15 +19,20 @@ type Instance struct {
 	accessLogger log.Handler
 	errorLogger  log.Handler
 	active       bool
+	// errorLogLevel is the level of error logs, which starts as the one in config, and may be changed at runtime.
+	errorLogLevel log.Severity
+	followers     map[chan *log.GeneralMessage]struct{}
 }
 
 // New creates a new log.Instance based on the given config.
 func New(ctx context.Context, config *Config) (*Instance, error) {
 	g := &Instance{
-		config: config,
-		active: false,
+		config:        config,
+		active:        false,
+		errorLogLevel: config.ErrorLogLevel,
+		followers:     make(map[chan *log.GeneralMessage]struct{}),
 	}
-	log.RegisterHandler(g)
+	log.RegisterContextHandler(ctx, g)
 
 	// start logger instantly on inited
 	// other modules would log during init
@@ -103,17 +108,71 @@ func (g *Instance) Handle(msg log.Message) {
 	switch msg := msg.(type) {
 	case *log.AccessMessage:
 		if g.accessLogger != nil {
+			if g.config.DisableSessionId && msg.SessionID != 0 {
+				m := *msg
+				m.SessionID = 0
+				msg = &m
+			}
 			g.accessLogger.Handle(msg)
 		}
 	case *log.GeneralMessage:
-		if g.errorLogger != nil && msg.Severity <= g.config.ErrorLogLevel {
+		if msg.Severity > g.errorLogLevel {
+			return
+		}
+		if g.config.DisableSessionId && msg.SessionID != 0 {
+			m := *msg
+			m.SessionID = 0
+			msg = &m
+		}
+		if g.errorLogger != nil {
 			g.errorLogger.Handle(msg)
 		}
+		for follower := range g.followers {
+			select {
+			case follower <- msg:
+			default:
+			}
+		}
 	default:
 		// Swallow
 	}
 }
 
+// ErrorLogLevel returns the level of error logs.
+func (g *Instance) ErrorLogLevel() log.Severity {
+	g.RLock()
+	defer g.RUnlock()
+
+	return g.errorLogLevel
+}
+
+// SetErrorLogLevel changes the level of error logs. It is kept when the logger restarts.
+func (g *Instance) SetErrorLogLevel(level log.Severity) {
+	g.Lock()
+	defer g.Unlock()
+
+	g.errorLogLevel = level
+}
+
+// Follow returns a channel of the error logs kept from now on, until ctx is done. Logs are dropped when the
+// channel is full, instead of blocking the loggers.
+func (g *Instance) Follow(ctx context.Context, size int) <-chan *log.GeneralMessage {
+	follower := make(chan *log.GeneralMessage, size)
+
+	g.Lock()
+	g.followers[follower] = struct{}{}
+	g.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		g.Lock()
+		delete(g.followers, follower)
+		close(follower)
+		g.Unlock()
+	}()
+	return follower
+}
+
 // Close implements common.Closable.Close().
 func (g *Instance) Close() error {
 	newError("Logger closing").AtDebug().WriteToLog()
@@ -50,3 +50,111 @@ func TestCustomLogHandler(t *testing.T) {
 
 	common.Must(logger.Close())
 }
+
+func TestDisableSessionID(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+
+	var loggedValue []string
+
+	mockHandler := mocks.NewLogHandler(mockCtl)
+	mockHandler.EXPECT().Handle(gomock.Any()).AnyTimes().DoAndReturn(func(msg clog.Message) {
+		loggedValue = append(loggedValue, msg.String())
+	})
+
+	log.RegisterHandlerCreator(log.LogType_Console, func(lt log.LogType, options log.HandlerCreatorOptions) (clog.Handler, error) {
+		return mockHandler, nil
+	})
+
+	logger, err := log.New(context.Background(), &log.Config{
+		ErrorLogLevel:    clog.Severity_Warning,
+		ErrorLogType:     log.LogType_Console,
+		AccessLogType:    log.LogType_Console,
+		DisableSessionId: true,
+	})
+	common.Must(err)
+	common.Must(logger.Start())
+
+	clog.Record(&clog.GeneralMessage{
+		Severity:  clog.Severity_Warning,
+		SessionID: 1234,
+		Content:   "test",
+	})
+	clog.Record(&clog.AccessMessage{
+		From:      "from",
+		To:        "to",
+		Status:    clog.AccessAccepted,
+		SessionID: 1234,
+	})
+
+	expected := []string{"[Warning] test", "from accepted to"}
+	if len(loggedValue) != len(expected) {
+		t.Fatal("expected ", expected, ", but actually ", loggedValue)
+	}
+	for i := range expected {
+		if loggedValue[i] != expected[i] {
+			t.Error("expected '", expected[i], "', but actually '", loggedValue[i], "'")
+		}
+	}
+
+	common.Must(logger.Close())
+}
+
+func TestErrorLogLevelAndFollow(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+
+	var loggedValue []string
+
+	mockHandler := mocks.NewLogHandler(mockCtl)
+	mockHandler.EXPECT().Handle(gomock.Any()).AnyTimes().DoAndReturn(func(msg clog.Message) {
+		loggedValue = append(loggedValue, msg.String())
+	})
+
+	log.RegisterHandlerCreator(log.LogType_Console, func(lt log.LogType, options log.HandlerCreatorOptions) (clog.Handler, error) {
+		return mockHandler, nil
+	})
+
+	logger, err := log.New(context.Background(), &log.Config{
+		ErrorLogLevel: clog.Severity_Warning,
+		ErrorLogType:  log.LogType_Console,
+		AccessLogType: log.LogType_None,
+	})
+	common.Must(err)
+	common.Must(logger.Start())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	follower := logger.Follow(ctx, 1)
+
+	clog.Record(&clog.GeneralMessage{
+		Severity: clog.Severity_Info,
+		Content:  "dropped",
+	})
+	logger.SetErrorLogLevel(clog.Severity_Info)
+	if level := logger.ErrorLogLevel(); level != clog.Severity_Info {
+		t.Error("expected level Info, but actually ", level)
+	}
+	clog.Record(&clog.GeneralMessage{
+		Severity: clog.Severity_Info,
+		Content:  "test",
+	})
+	// The follower is full, and the message is only dropped for it.
+	clog.Record(&clog.GeneralMessage{
+		Severity: clog.Severity_Info,
+		Content:  "overflow",
+	})
+
+	expected := []string{"[Info] test", "[Info] overflow"}
+	if len(loggedValue) != len(expected) {
+		t.Fatal("expected ", expected, ", but actually ", loggedValue)
+	}
+	if msg := <-follower; msg.String() != "[Info] test" {
+		t.Error("expected '[Info] test' followed, but actually ", msg)
+	}
+	cancel()
+	if msg, ok := <-follower; ok {
+		t.Error("expected follower closed, but got ", msg)
+	}
+
+	common.Must(logger.Close())
+}
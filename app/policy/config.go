@@ -3,6 +3,7 @@ package policy
 import (
 	"time"
 
+	"v2ray.com/core/common/net"
 	"v2ray.com/core/features/policy"
 )
 
@@ -14,7 +15,7 @@ func (s *Second) Duration() time.Duration {
 	return time.Second * time.Duration(s.Value)
 }
 
-func defaultPolicy() *Policy {
+func defaultPolicy(bufferSize int32) *Policy {
 	p := policy.SessionDefault()
 
 	return &Policy{
@@ -25,7 +26,7 @@ func defaultPolicy() *Policy {
 			DownlinkOnly:   &Second{Value: uint32(p.Timeouts.DownlinkOnly / time.Second)},
 		},
 		Buffer: &Policy_Buffer{
-			Connection: p.Buffer.PerConnection,
+			Connection: bufferSize,
 		},
 	}
 }
@@ -43,6 +44,12 @@ func (p *Policy_Timeout) overrideWith(another *Policy_Timeout) {
 	if another.DownlinkOnly != nil {
 		p.DownlinkOnly = &Second{Value: another.DownlinkOnly.Value}
 	}
+	if another.UplinkIdle != nil {
+		p.UplinkIdle = &Second{Value: another.UplinkIdle.Value}
+	}
+	if another.DownlinkIdle != nil {
+		p.DownlinkIdle = &Second{Value: another.DownlinkIdle.Value}
+	}
 }
 
 func (p *Policy) overrideWith(another *Policy) {
@@ -58,6 +65,9 @@ func (p *Policy) overrideWith(another *Policy) {
 			Connection: another.Buffer.Connection,
 		}
 	}
+	if another.Udp != nil {
+		p.Udp = another.Udp
+	}
 }
 
 // ToCorePolicy converts this Policy to policy.Session.
@@ -69,6 +79,8 @@ func (p *Policy) ToCorePolicy() policy.Session {
 		cp.Timeouts.Handshake = p.Timeout.Handshake.Duration()
 		cp.Timeouts.DownlinkOnly = p.Timeout.DownlinkOnly.Duration()
 		cp.Timeouts.UplinkOnly = p.Timeout.UplinkOnly.Duration()
+		cp.Timeouts.UplinkIdle = p.Timeout.UplinkIdle.Duration()
+		cp.Timeouts.DownlinkIdle = p.Timeout.DownlinkIdle.Duration()
 	}
 	if p.Stats != nil {
 		cp.Stats.UserUplink = p.Stats.UserUplink
@@ -77,6 +89,14 @@ func (p *Policy) ToCorePolicy() policy.Session {
 	if p.Buffer != nil {
 		cp.Buffer.PerConnection = p.Buffer.Connection
 	}
+	if p.Udp != nil {
+		if p.Udp.AllowedPorts != nil {
+			cp.UDP.AllowedPorts = net.PortListFromProto(p.Udp.AllowedPorts)
+		}
+		if p.Udp.DeniedPorts != nil {
+			cp.UDP.DeniedPorts = net.PortListFromProto(p.Udp.DeniedPorts)
+		}
+	}
 	return cp
 }
 
@@ -84,10 +104,14 @@ func (p *Policy) ToCorePolicy() policy.Session {
 func (p *SystemPolicy) ToCorePolicy() policy.System {
 	return policy.System{
 		Stats: policy.SystemStats{
-			InboundUplink:    p.Stats.InboundUplink,
-			InboundDownlink:  p.Stats.InboundDownlink,
-			OutboundUplink:   p.Stats.OutboundUplink,
-			OutboundDownlink: p.Stats.OutboundDownlink,
+			InboundUplink:      p.Stats.InboundUplink,
+			InboundDownlink:    p.Stats.InboundDownlink,
+			OutboundUplink:     p.Stats.OutboundUplink,
+			OutboundDownlink:   p.Stats.OutboundDownlink,
+			InboundUDPSessions: p.Stats.InboundUdpSessions,
+			InboundSessions:    p.Stats.InboundSessions,
+			OutboundSessions:   p.Stats.OutboundSessions,
+			Transport:          p.Stats.Transport,
 		},
 	}
 }
@@ -11,17 +11,20 @@ import (
 type Instance struct {
 	levels map[uint32]*Policy
 	system *SystemPolicy
+	// bufferSize is the buffer size per connection of levels that don't set it.
+	bufferSize int32
 }
 
 // New creates new Policy manager instance.
 func New(ctx context.Context, config *Config) (*Instance, error) {
 	m := &Instance{
-		levels: make(map[uint32]*Policy),
-		system: config.System,
+		levels:     make(map[uint32]*Policy),
+		system:     config.System,
+		bufferSize: policy.DefaultBufferSizeFromContext(ctx),
 	}
 	if len(config.Level) > 0 {
 		for lv, p := range config.Level {
-			pp := defaultPolicy()
+			pp := defaultPolicy(m.bufferSize)
 			pp.overrideWith(p)
 			m.levels[lv] = pp
 		}
@@ -40,7 +43,9 @@ func (m *Instance) ForLevel(level uint32) policy.Session {
 	if p, ok := m.levels[level]; ok {
 		return p.ToCorePolicy()
 	}
-	return policy.SessionDefault()
+	p := policy.SessionDefault()
+	p.Buffer.PerConnection = m.bufferSize
+	return p
 }
 
 // ForSystem implements policy.Manager.
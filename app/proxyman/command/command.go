@@ -4,13 +4,18 @@ package command
 
 import (
 	"context"
+	"reflect"
+	"strings"
+	"time"
 
 	grpc "google.golang.org/grpc"
 
 	"v2ray.com/core"
+	"v2ray.com/core/app/proxyman"
 	"v2ray.com/core/common"
 	"v2ray.com/core/features/inbound"
 	"v2ray.com/core/features/outbound"
+	"v2ray.com/core/features/stats"
 	"v2ray.com/core/proxy"
 )
 
@@ -64,14 +69,85 @@ func (op *RemoveUserOperation) ApplyInbound(ctx context.Context, handler inbound
 	return um.RemoveUser(ctx, op.Email)
 }
 
+func loadInboundJSON(data string) (*core.InboundHandlerConfig, error) {
+	if jsonLoaders.Inbound == nil {
+		return nil, newError("JSON config is not supported")
+	}
+	config, err := jsonLoaders.Inbound([]byte(data))
+	if err != nil {
+		return nil, newError("failed to load JSON config").Base(err)
+	}
+	return config, nil
+}
+
+func loadOutboundJSON(data string) (*core.OutboundHandlerConfig, error) {
+	if jsonLoaders.Outbound == nil {
+		return nil, newError("JSON config is not supported")
+	}
+	config, err := jsonLoaders.Outbound([]byte(data))
+	if err != nil {
+		return nil, newError("failed to load JSON config").Base(err)
+	}
+	return config, nil
+}
+
+// protocolName returns the name of the given proxy, which is the name of its package under v2ray.com/core/proxy,
+// or the last element of the package path for handlers outside of it.
+func protocolName(p interface{}) string {
+	t := reflect.TypeOf(p)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil {
+		return ""
+	}
+	path := t.PkgPath()
+	if name := strings.TrimPrefix(path, "v2ray.com/core/proxy/"); name != path {
+		if idx := strings.IndexByte(name, '/'); idx >= 0 {
+			name = name[:idx]
+		}
+		return name
+	}
+	return path[strings.LastIndexByte(path, '/')+1:]
+}
+
 type handlerServer struct {
 	s   *core.Instance
 	ihm inbound.Manager
 	ohm outbound.Manager
+	sm  stats.Manager
+}
+
+// unregisterCounters removes traffic and session counters of the handler with the given tag.
+func (s *handlerServer) unregisterCounters(direction string, tag string) {
+	if s.sm == nil || tag == "" {
+		return
+	}
+	names := proxyman.SessionCounterNames(direction, tag)
+	for _, link := range []string{"uplink", "downlink"} {
+		names = append(names, direction+">>>"+tag+">>>traffic>>>"+link)
+	}
+	for _, name := range names {
+		if err := s.sm.UnregisterCounter(name); err != nil {
+			newError("failed to unregister counter ", name).Base(err).AtWarning().WriteToLog()
+		}
+	}
 }
 
 func (s *handlerServer) AddInbound(ctx context.Context, request *AddInboundRequest) (*AddInboundResponse, error) {
-	if err := core.AddInboundHandler(s.s, request.Inbound); err != nil {
+	config := request.Inbound
+	if config == nil && len(request.JsonConfig) > 0 {
+		c, err := loadInboundJSON(request.JsonConfig)
+		if err != nil {
+			return nil, err
+		}
+		config = c
+	}
+	if config == nil {
+		return nil, newError("inbound config is not specified")
+	}
+
+	if err := core.AddInboundHandler(s.s, config); err != nil {
 		return nil, err
 	}
 
@@ -79,7 +155,11 @@ func (s *handlerServer) AddInbound(ctx context.Context, request *AddInboundReque
 }
 
 func (s *handlerServer) RemoveInbound(ctx context.Context, request *RemoveInboundRequest) (*RemoveInboundResponse, error) {
-	return &RemoveInboundResponse{}, s.ihm.RemoveHandler(ctx, request.Tag)
+	if err := s.ihm.RemoveHandler(ctx, request.Tag); err != nil {
+		return nil, err
+	}
+	s.unregisterCounters("inbound", request.Tag)
+	return &RemoveInboundResponse{}, nil
 }
 
 func (s *handlerServer) AlterInbound(ctx context.Context, request *AlterInboundRequest) (*AlterInboundResponse, error) {
@@ -101,14 +181,30 @@ func (s *handlerServer) AlterInbound(ctx context.Context, request *AlterInboundR
 }
 
 func (s *handlerServer) AddOutbound(ctx context.Context, request *AddOutboundRequest) (*AddOutboundResponse, error) {
-	if err := core.AddOutboundHandler(s.s, request.Outbound); err != nil {
+	config := request.Outbound
+	if config == nil && len(request.JsonConfig) > 0 {
+		c, err := loadOutboundJSON(request.JsonConfig)
+		if err != nil {
+			return nil, err
+		}
+		config = c
+	}
+	if config == nil {
+		return nil, newError("outbound config is not specified")
+	}
+
+	if err := core.AddOutboundHandler(s.s, config); err != nil {
 		return nil, err
 	}
 	return &AddOutboundResponse{}, nil
 }
 
 func (s *handlerServer) RemoveOutbound(ctx context.Context, request *RemoveOutboundRequest) (*RemoveOutboundResponse, error) {
-	return &RemoveOutboundResponse{}, s.ohm.RemoveHandler(ctx, request.Tag)
+	if err := s.ohm.RemoveHandler(ctx, request.Tag); err != nil {
+		return nil, err
+	}
+	s.unregisterCounters("outbound", request.Tag)
+	return &RemoveOutboundResponse{}, nil
 }
 
 func (s *handlerServer) AlterOutbound(ctx context.Context, request *AlterOutboundRequest) (*AlterOutboundResponse, error) {
@@ -125,6 +221,101 @@ func (s *handlerServer) AlterOutbound(ctx context.Context, request *AlterOutboun
 	return &AlterOutboundResponse{}, operation.ApplyOutbound(ctx, handler)
 }
 
+func (s *handlerServer) ListHandlers(ctx context.Context, request *ListHandlersRequest) (*ListHandlersResponse, error) {
+	response := &ListHandlersResponse{}
+
+	for _, handler := range s.ihm.ListHandlers(ctx) {
+		info := &HandlerInfo{
+			Tag: handler.Tag(),
+		}
+		if p, port, _ := handler.GetRandomInboundProxy(); p != nil {
+			info.Protocol = protocolName(p)
+			info.Port = uint32(port)
+		}
+		response.Inbound = append(response.Inbound, info)
+	}
+
+	for _, handler := range s.ohm.ListHandlers(ctx) {
+		info := &HandlerInfo{
+			Tag: handler.Tag(),
+		}
+		if gp, ok := handler.(proxy.GetOutbound); ok {
+			info.Protocol = protocolName(gp.GetOutbound())
+		} else {
+			info.Protocol = protocolName(handler)
+		}
+		response.Outbound = append(response.Outbound, info)
+	}
+
+	return response, nil
+}
+
+func (s *handlerServer) GetInboundBans(ctx context.Context, request *GetInboundBansRequest) (*GetInboundBansResponse, error) {
+	handler, err := s.ihm.GetHandler(ctx, request.Tag)
+	if err != nil {
+		return nil, newError("failed to get handler: ", request.Tag).Base(err)
+	}
+	lister, ok := handler.(inbound.BanLister)
+	if !ok {
+		return nil, newError("inbound ", request.Tag, " doesn't ban source IPs")
+	}
+
+	response := &GetInboundBansResponse{}
+	for _, ban := range lister.Bans() {
+		response.Ban = append(response.Ban, &InboundBan{
+			Ip:     ban.IP.String(),
+			Expire: ban.Expire.Unix(),
+		})
+	}
+	return response, nil
+}
+
+// sessionStats returns the session stats of the handler, or nil if it doesn't track its sessions.
+func sessionStats(handler interface{}, tag string, oldest int) *HandlerSessionStats {
+	reporter, ok := handler.(proxyman.SessionReporter)
+	if !ok {
+		return nil
+	}
+	snapshot := reporter.Sessions().Snapshot(oldest)
+	info := &HandlerSessionStats{
+		Tag:           tag,
+		LiveSessions:  snapshot.Live,
+		TotalSessions: snapshot.Total,
+		Goroutines:    snapshot.Goroutines,
+	}
+	for _, age := range snapshot.OldestAges {
+		info.OldestSessionAge = append(info.OldestSessionAge, int64(age/time.Millisecond))
+	}
+	return info
+}
+
+func (s *handlerServer) GetSessionStats(ctx context.Context, request *GetSessionStatsRequest) (*GetSessionStatsResponse, error) {
+	response := &GetSessionStatsResponse{}
+	oldest := int(request.Oldest)
+
+	for _, handler := range s.ihm.ListHandlers(ctx) {
+		if request.Tag != "" && handler.Tag() != request.Tag {
+			continue
+		}
+		if info := sessionStats(handler, handler.Tag(), oldest); info != nil {
+			response.Inbound = append(response.Inbound, info)
+		}
+	}
+	for _, handler := range s.ohm.ListHandlers(ctx) {
+		if request.Tag != "" && handler.Tag() != request.Tag {
+			continue
+		}
+		if info := sessionStats(handler, handler.Tag(), oldest); info != nil {
+			response.Outbound = append(response.Outbound, info)
+		}
+	}
+
+	if request.Tag != "" && len(response.Inbound) == 0 && len(response.Outbound) == 0 {
+		return nil, newError("no handler with tag ", request.Tag, " tracks its sessions")
+	}
+	return response, nil
+}
+
 func (s *handlerServer) mustEmbedUnimplementedHandlerServiceServer() {}
 
 type service struct {
@@ -135,9 +326,10 @@ func (s *service) Register(server *grpc.Server) {
 	hs := &handlerServer{
 		s: s.v,
 	}
-	common.Must(s.v.RequireFeatures(func(im inbound.Manager, om outbound.Manager) {
+	common.Must(s.v.RequireFeatures(func(im inbound.Manager, om outbound.Manager, sm stats.Manager) {
 		hs.ihm = im
 		hs.ohm = om
+		hs.sm = sm
 	}))
 	RegisterHandlerServiceServer(server, hs)
 }
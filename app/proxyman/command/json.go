@@ -0,0 +1,19 @@
+package command
+
+import (
+	"v2ray.com/core"
+)
+
+// JSONLoaders build handler configs from the JSON objects of AddInbound and AddOutbound requests.
+type JSONLoaders struct {
+	Inbound  func(data []byte) (*core.InboundHandlerConfig, error)
+	Outbound func(data []byte) (*core.OutboundHandlerConfig, error)
+}
+
+var jsonLoaders JSONLoaders
+
+// RegisterJSONLoaders registers the loaders of handler configs in JSON. They are registered by the JSON config
+// package, so handlers can only be added in JSON if V2Ray is built with JSON support.
+func RegisterJSONLoaders(loaders JSONLoaders) {
+	jsonLoaders = loaders
+}
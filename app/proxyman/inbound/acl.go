@@ -0,0 +1,90 @@
+package inbound
+
+import (
+	"context"
+
+	"v2ray.com/core"
+	"v2ray.com/core/app/proxyman"
+	"v2ray.com/core/app/router"
+	"v2ray.com/core/common/log"
+	"v2ray.com/core/common/net"
+	"v2ray.com/core/common/session"
+	"v2ray.com/core/features/stats"
+)
+
+// sourceACL decides the source IPs that may use an inbound. Rejected sources are counted in the stats of
+// the inbound, as "inbound>>>tag>>>acl>>>rejected".
+type sourceACL struct {
+	// ctx is the context of the inbound, whose instance rejections are logged to.
+	ctx         context.Context
+	tag         string
+	allowed     *router.MultiGeoIPMatcher
+	denied      *router.MultiGeoIPMatcher
+	logRejected bool
+	rejected    stats.Counter
+}
+
+// newSourceACL creates the ACL from the config, or returns nil if the config doesn't restrict sources.
+func newSourceACL(ctx context.Context, tag string, config *proxyman.SourceAccessConfig) (*sourceACL, error) {
+	if len(config.GetAllowed()) == 0 && len(config.GetDenied()) == 0 {
+		return nil, nil
+	}
+	acl := &sourceACL{
+		ctx:         ctx,
+		tag:         tag,
+		logRejected: config.LogRejected,
+	}
+	if len(config.Allowed) > 0 {
+		matcher, err := router.NewMultiGeoIPMatcher(config.Allowed, true)
+		if err != nil {
+			return nil, newError("failed to build allowed sources").Base(err)
+		}
+		acl.allowed = matcher
+	}
+	if len(config.Denied) > 0 {
+		matcher, err := router.NewMultiGeoIPMatcher(config.Denied, true)
+		if err != nil {
+			return nil, newError("failed to build denied sources").Base(err)
+		}
+		acl.denied = matcher
+	}
+	if v := core.FromContext(ctx); v != nil && len(tag) > 0 {
+		if statsManager, ok := v.GetFeature(stats.ManagerType()).(stats.Manager); ok {
+			acl.rejected, _ = stats.GetOrRegisterCounter(statsManager, "inbound>>>"+tag+">>>acl>>>rejected")
+		}
+	}
+	return acl, nil
+}
+
+// Allow returns whether the source may use the inbound. Sources other than IPs, such as of Unix domain
+// sockets, are always allowed.
+func (a *sourceACL) Allow(source net.Destination) bool {
+	if !source.Address.Family().IsIP() {
+		return true
+	}
+	ip := source.Address.IP()
+	if a.denied != nil && a.denied.ApplyIP(ip) {
+		a.reject(source, "source is denied")
+		return false
+	}
+	if a.allowed != nil && !a.allowed.ApplyIP(ip) {
+		a.reject(source, "source is not allowed")
+		return false
+	}
+	return true
+}
+
+func (a *sourceACL) reject(source net.Destination, reason string) {
+	if a.rejected != nil {
+		a.rejected.Add(1)
+	}
+	newError("rejecting ", source, " on inbound [", a.tag, "]: ", reason).AtDebug().WriteToLog(session.ExportIDToError(a.ctx))
+	if a.logRejected {
+		log.RecordContext(a.ctx, &log.AccessMessage{
+			From:   source,
+			To:     "",
+			Status: log.AccessRejected,
+			Reason: reason,
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package inbound
+
+import (
+	"context"
+	"testing"
+
+	"v2ray.com/core/app/proxyman"
+	"v2ray.com/core/app/router"
+	"v2ray.com/core/common"
+	"v2ray.com/core/common/net"
+)
+
+func TestSourceACL(t *testing.T) {
+	acl, err := newSourceACL(context.Background(), "", &proxyman.SourceAccessConfig{
+		Allowed: []*router.GeoIP{
+			{Cidr: []*router.CIDR{{Ip: []byte{192, 168, 0, 0}, Prefix: 16}}},
+		},
+		Denied: []*router.GeoIP{
+			{Cidr: []*router.CIDR{{Ip: []byte{192, 168, 1, 0}, Prefix: 24}}},
+		},
+	})
+	common.Must(err)
+
+	for _, c := range []struct {
+		source net.Destination
+		allow  bool
+	}{
+		{net.TCPDestination(net.ParseAddress("192.168.2.3"), 1234), true},
+		{net.UDPDestination(net.ParseAddress("192.168.1.5"), 1234), false},
+		{net.TCPDestination(net.ParseAddress("10.0.0.1"), 1234), false},
+		{net.UnixDestination(net.DomainAddress("@v2ray.sock")), true},
+	} {
+		if allow := acl.Allow(c.source); allow != c.allow {
+			t.Error("source ", c.source, ": expected ", c.allow, ", but got ", allow)
+		}
+	}
+
+	acl, err = newSourceACL(context.Background(), "", &proxyman.SourceAccessConfig{})
+	common.Must(err)
+	if acl != nil {
+		t.Error("expected no ACL without sources")
+	}
+}
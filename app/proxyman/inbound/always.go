@@ -2,6 +2,9 @@ package inbound
 
 import (
 	"context"
+	"runtime"
+
+	"github.com/golang/protobuf/proto"
 
 	"v2ray.com/core"
 	"v2ray.com/core/app/proxyman"
@@ -10,10 +13,12 @@ import (
 	"v2ray.com/core/common/errors"
 	"v2ray.com/core/common/mux"
 	"v2ray.com/core/common/net"
+	"v2ray.com/core/features/inbound"
 	"v2ray.com/core/features/policy"
 	"v2ray.com/core/features/stats"
 	"v2ray.com/core/proxy"
 	"v2ray.com/core/transport/internet"
+	"v2ray.com/core/transport/internet/udp"
 )
 
 func getStatCounter(v *core.Instance, tag string) (stats.Counter, stats.Counter) {
@@ -41,11 +46,38 @@ func getStatCounter(v *core.Instance, tag string) (stats.Counter, stats.Counter)
 	return uplinkCounter, downlinkCounter
 }
 
+// newSessionTracker creates the tracker of the sessions of the inbound with the tag.
+func newSessionTracker(v *core.Instance, tag string) *proxyman.SessionTracker {
+	policy := v.GetFeature(policy.ManagerType()).(policy.Manager)
+	statsManager, _ := v.GetFeature(stats.ManagerType()).(stats.Manager)
+	return proxyman.NewSessionTrackerWithStats(statsManager, "inbound", tag, policy.ForSystem().Stats.InboundSessions)
+}
+
+// newTransportStats creates the counters of the transports of inbounds, or returns nil if they are not
+// enabled.
+func newTransportStats(v *core.Instance) *internet.TransportStats {
+	policy := v.GetFeature(policy.ManagerType()).(policy.Manager)
+	if !policy.ForSystem().Stats.Transport {
+		return nil
+	}
+	statsManager, _ := v.GetFeature(stats.ManagerType()).(stats.Manager)
+	return internet.NewTransportStats(statsManager)
+}
+
+// maxPortRangeSize is the largest port range an inbound may listen on.
+const maxPortRangeSize = 4096
+
 type AlwaysOnInboundHandler struct {
-	proxy   proxy.Inbound
-	workers []worker
-	mux     *mux.Server
-	tag     string
+	proxy     proxy.Inbound
+	workers   []worker
+	mux       *mux.Server
+	tag       string
+	address   net.Address
+	portRange *net.PortRange
+	dualStack *proxyman.DualStackConfig
+	bindRetry *proxyman.BindRetryConfig
+	limiter   *connectionLimiter
+	sessions  *proxyman.SessionTracker
 }
 
 func NewAlwaysOnInboundHandler(ctx context.Context, tag string, receiverConfig *proxyman.ReceiverConfig, proxyConfig interface{}) (*AlwaysOnInboundHandler, error) {
@@ -59,12 +91,16 @@ func NewAlwaysOnInboundHandler(ctx context.Context, tag string, receiverConfig *
 	}
 
 	h := &AlwaysOnInboundHandler{
-		proxy: p,
-		mux:   mux.NewServer(ctx),
-		tag:   tag,
+		proxy:     p,
+		mux:       mux.NewServer(ctx),
+		tag:       tag,
+		sessions:  newSessionTracker(core.MustFromContext(ctx), tag),
+		bindRetry: receiverConfig.BindRetry,
 	}
 
 	uplinkCounter, downlinkCounter := getStatCounter(core.MustFromContext(ctx), tag)
+	sessionGauge, dropCounter := getUDPSessionCounters(core.MustFromContext(ctx), tag)
+	udpSessions := newUDPSessionTable(receiverConfig.UdpSession, sessionGauge, dropCounter)
 
 	nl := p.Network()
 	pr := receiverConfig.PortRange
@@ -72,11 +108,51 @@ func NewAlwaysOnInboundHandler(ctx context.Context, tag string, receiverConfig *
 	if address == nil {
 		address = net.AnyIP
 	}
+	h.address = address
+	h.portRange = pr
+	if pr != nil && pr.To >= pr.From && pr.To-pr.From+1 > maxPortRangeSize {
+		return nil, newError("port range ", pr.FromPort(), "-", pr.ToPort(), " is larger than ", maxPortRangeSize, " ports").WithKind(errors.KindConfig)
+	}
 
-	mss, err := internet.ToMemoryStreamConfig(receiverConfig.StreamSettings)
+	mss, err := internet.ToMemoryStreamConfigWithContext(ctx, receiverConfig.StreamSettings)
 	if err != nil {
 		return nil, newError("failed to parse stream config").Base(err).AtWarning()
 	}
+	if ref := mss.SocketSettings.GetInheritedSocket(); len(ref) > 0 {
+		// Workers take the address of the socket passed by systemd, and their listeners adopt it.
+		addr, err := internet.InheritedSocketAddr(ref)
+		if err != nil {
+			return nil, newError("failed to adopt socket ", ref, " passed by systemd").Base(err).WithKind(errors.KindConfig)
+		}
+		switch addr.(type) {
+		case *net.TCPAddr, *net.UDPAddr:
+		default:
+			return nil, newError("socket ", ref, " passed by systemd is not a TCP or UDP socket: ", addr).WithKind(errors.KindConfig)
+		}
+		dest := net.DestinationFromAddr(addr)
+		address = dest.Address
+		pr = net.SinglePortRange(dest.Port)
+		h.address = address
+		h.portRange = pr
+	}
+
+	limiter, err := newConnectionLimiter(receiverConfig.ConnectionLimit)
+	if err != nil {
+		return nil, err
+	}
+	h.limiter = limiter
+
+	acl, err := newSourceACL(ctx, tag, receiverConfig.SourceAccess)
+	if err != nil {
+		return nil, err
+	}
+	tlsHandshakes := newTLSHandshakeCounter(core.MustFromContext(ctx), tag, mss)
+	transportStats := newTransportStats(core.MustFromContext(ctx))
+
+	listeners, err := shardedListeners(receiverConfig.ListenerSharding, mss)
+	if err != nil {
+		return nil, err
+	}
 
 	if receiverConfig.ReceiveOriginalDestination {
 		if mss.SocketSettings == nil {
@@ -100,44 +176,71 @@ func NewAlwaysOnInboundHandler(ctx context.Context, tag string, receiverConfig *
 				sniffingConfig:  receiverConfig.GetEffectiveSniffingSettings(),
 				uplinkCounter:   uplinkCounter,
 				downlinkCounter: downlinkCounter,
+				transportStats:  transportStats,
+				sessions:        h.sessions,
 				ctx:             ctx,
 			}
 			h.workers = append(h.workers, worker)
 		}
 	}
+	addresses := []net.Address{address}
+	if receiverConfig.DualStack != nil {
+		if pr == nil {
+			return nil, newError("dual stack listening requires a port").WithKind(errors.KindConfig)
+		}
+		h.dualStack = receiverConfig.DualStack
+		addresses = []net.Address{net.AnyIP, net.AnyIPv6}
+	}
 	if pr != nil {
-		for port := pr.From; port <= pr.To; port++ {
-			if net.HasNetwork(nl, net.Network_TCP) {
-				newError("creating stream worker on ", address, ":", port).AtDebug().WriteToLog()
-
-				worker := &tcpWorker{
-					address:         address,
-					port:            net.Port(port),
-					proxy:           p,
-					stream:          mss,
-					recvOrigDest:    receiverConfig.ReceiveOriginalDestination,
-					tag:             tag,
-					dispatcher:      h.mux,
-					sniffingConfig:  receiverConfig.GetEffectiveSniffingSettings(),
-					uplinkCounter:   uplinkCounter,
-					downlinkCounter: downlinkCounter,
-					ctx:             ctx,
-				}
-				h.workers = append(h.workers, worker)
+		for _, address := range addresses {
+			stream := mss
+			if h.dualStack != nil && address.Family().IsIPv6() {
+				// Without IPV6_V6ONLY, the IPv6 listener would take the IPv4 port as well.
+				stream = v6OnlyStreamConfig(mss)
 			}
+			for port := pr.From; port <= pr.To; port++ {
+				if net.HasNetwork(nl, net.Network_TCP) {
+					newError("creating stream worker on ", address, ":", port).AtDebug().WriteToLog()
+
+					worker := &tcpWorker{
+						address:         address,
+						port:            net.Port(port),
+						proxy:           p,
+						stream:          stream,
+						recvOrigDest:    receiverConfig.ReceiveOriginalDestination,
+						tag:             tag,
+						dispatcher:      h.mux,
+						sniffingConfig:  receiverConfig.GetEffectiveSniffingSettings(),
+						uplinkCounter:   uplinkCounter,
+						downlinkCounter: downlinkCounter,
+						limiter:         limiter,
+						acl:             acl,
+						tlsHandshakes:   tlsHandshakes,
+						transportStats:  transportStats,
+						sessions:        h.sessions,
+						listeners:       listeners,
+						ctx:             ctx,
+					}
+					h.workers = append(h.workers, worker)
+				}
 
-			if net.HasNetwork(nl, net.Network_UDP) {
-				worker := &udpWorker{
-					tag:             tag,
-					proxy:           p,
-					address:         address,
-					port:            net.Port(port),
-					dispatcher:      h.mux,
-					uplinkCounter:   uplinkCounter,
-					downlinkCounter: downlinkCounter,
-					stream:          mss,
+				if net.HasNetwork(nl, net.Network_UDP) {
+					worker := &udpWorker{
+						tag:             tag,
+						proxy:           p,
+						address:         address,
+						port:            net.Port(port),
+						dispatcher:      h.mux,
+						uplinkCounter:   uplinkCounter,
+						downlinkCounter: downlinkCounter,
+						udpSessions:     udpSessions,
+						acl:             acl,
+						sessions:        h.sessions,
+						stream:          stream,
+						maxSessions:     udp.MaxHubSessionsFromContext(ctx),
+					}
+					h.workers = append(h.workers, worker)
 				}
-				h.workers = append(h.workers, worker)
 			}
 		}
 	}
@@ -145,13 +248,127 @@ func NewAlwaysOnInboundHandler(ctx context.Context, tag string, receiverConfig *
 	return h, nil
 }
 
+// shardedListeners returns the number of listeners of each TCP address.
+func shardedListeners(config *proxyman.ListenerShardingConfig, mss *internet.MemoryStreamConfig) (int, error) {
+	if config == nil {
+		return 1, nil
+	}
+	if mss.SocketSettings != nil && mss.SocketSettings.DisableReusePort {
+		return 0, newError("listener sharding requires SO_REUSEPORT, which is disabled in socket settings").WithKind(errors.KindConfig)
+	}
+	if config.Listeners > 0 {
+		return int(config.Listeners), nil
+	}
+	return runtime.GOMAXPROCS(0), nil
+}
+
+// v6OnlyStreamConfig returns a copy of the stream config whose listeners accept IPv6 connections only.
+func v6OnlyStreamConfig(mss *internet.MemoryStreamConfig) *internet.MemoryStreamConfig {
+	stream := *mss
+	if mss.SocketSettings != nil {
+		stream.SocketSettings = proto.Clone(mss.SocketSettings).(*internet.SocketConfig)
+	} else {
+		stream.SocketSettings = &internet.SocketConfig{}
+	}
+	stream.SocketSettings.V6Only = true
+	return &stream
+}
+
 // Start implements common.Runnable.
 func (h *AlwaysOnInboundHandler) Start() error {
-	for _, worker := range h.workers {
-		if err := worker.Start(); err != nil {
+	if h.dualStack != nil {
+		if err := h.startDualStack(); err != nil {
 			return err
 		}
+	} else if h.portRange == nil || h.portRange.From == h.portRange.To {
+		for _, worker := range h.workers {
+			if err := startWorker(worker, h.bindRetry); err != nil {
+				return err
+			}
+		}
+	} else if err := h.startRange(); err != nil {
+		return err
+	}
+
+	if observer, ok := h.proxy.(proxy.ListenObserver); ok {
+		var ports []net.Port
+		seen := make(map[net.Port]bool)
+		for _, worker := range h.workers {
+			if port := worker.Port(); !seen[port] {
+				seen[port] = true
+				ports = append(ports, port)
+			}
+		}
+		if err := observer.OnListen(h.address, ports); err != nil {
+			return newError("failed to start inbound ", h.tag).Base(err)
+		}
+	}
+	return nil
+}
+
+// startRange starts the workers of a port range. Ports that fail to listen are skipped, as long as
+// some of them work.
+func (h *AlwaysOnInboundHandler) startRange() error {
+	var started []worker
+	var failedPorts []net.Port
+	var lastErr error
+	for _, worker := range h.workers {
+		if err := startWorker(worker, h.bindRetry); err != nil {
+			newError("failed to listen on ", h.address, ":", worker.Port()).Base(err).AtWarning().WriteToLog()
+			failedPorts = append(failedPorts, worker.Port())
+			lastErr = err
+			continue
+		}
+		started = append(started, worker)
+	}
+	h.workers = started
+
+	pr := h.portRange
+	if len(started) == 0 {
+		return newError("failed to listen on any port in ", h.address, ":", pr.FromPort(), "-", pr.ToPort()).Base(lastErr)
+	}
+	if len(failedPorts) > 0 {
+		newError("bound ", len(started), " listeners on ", h.address, ":", pr.FromPort(), "-", pr.ToPort(), ", failed on ports ", failedPorts).AtWarning().WriteToLog()
+	} else {
+		newError("bound ", len(started), " listeners on ", h.address, ":", pr.FromPort(), "-", pr.ToPort()).AtInfo().WriteToLog()
+	}
+	return nil
+}
+
+// startDualStack starts the workers on both address families. Unless partial listening is allowed,
+// all of them must start.
+func (h *AlwaysOnInboundHandler) startDualStack() error {
+	var started []worker
+	var lastErr error
+	for _, worker := range h.workers {
+		if err := startWorker(worker, h.bindRetry); err != nil {
+			if !h.dualStack.AllowPartial {
+				for _, w := range started {
+					w.Close()
+				}
+				return newError("failed to listen on ", worker.Address(), ":", worker.Port()).Base(err)
+			}
+			newError("failed to listen on ", worker.Address(), ":", worker.Port()).Base(err).AtWarning().WriteToLog()
+			lastErr = err
+			continue
+		}
+		started = append(started, worker)
 	}
+	h.workers = started
+	if len(started) == 0 {
+		return newError("failed to listen on any address of inbound ", h.tag).Base(lastErr)
+	}
+
+	var addresses []net.Address
+	seen := make(map[string]bool)
+	for _, worker := range started {
+		if address := worker.Address(); !seen[address.String()] {
+			seen[address.String()] = true
+			addresses = append(addresses, address)
+		}
+	}
+	pr := h.portRange
+	newError("bound ", len(started), " listeners on ", addresses, " port ", pr.FromPort(), "-", pr.ToPort()).AtInfo().WriteToLog()
 	return nil
 }
 
@@ -180,6 +397,19 @@ func (h *AlwaysOnInboundHandler) Tag() string {
 	return h.tag
 }
 
+// Bans implements inbound.BanLister.
+func (h *AlwaysOnInboundHandler) Bans() []inbound.Ban {
+	if h.limiter == nil {
+		return nil
+	}
+	return h.limiter.Bans()
+}
+
+// Sessions implements proxyman.SessionReporter.
+func (h *AlwaysOnInboundHandler) Sessions() *proxyman.SessionTracker {
+	return h.sessions
+}
+
 func (h *AlwaysOnInboundHandler) GetInbound() proxy.Inbound {
 	return h.proxy
 }
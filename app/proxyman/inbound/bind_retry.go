@@ -0,0 +1,65 @@
+package inbound
+
+import (
+	"os"
+	"syscall"
+	"time"
+
+	"v2ray.com/core/app/proxyman"
+	"v2ray.com/core/common/errors"
+	"v2ray.com/core/common/net"
+)
+
+const (
+	defaultBindBackoff    = 500 * time.Millisecond
+	defaultBindMaxBackoff = 5 * time.Second
+)
+
+// isAddressInUse returns true if the error of listening means the address is taken.
+func isAddressInUse(err error) bool {
+	err = errors.Cause(err)
+	if opErr, ok := err.(*net.OpError); ok {
+		err = opErr.Err
+	}
+	if sysErr, ok := err.(*os.SyscallError); ok {
+		err = sysErr.Err
+	}
+	return err == syscall.EADDRINUSE
+}
+
+// startWorker starts the worker. While its address is in use, it retries as the config allows, waiting
+// longer after each attempt.
+func startWorker(w worker, config *proxyman.BindRetryConfig) error {
+	err := w.Start()
+	if err == nil || config.GetAttempts() == 0 || !isAddressInUse(err) {
+		return err
+	}
+
+	backoff := defaultBindBackoff
+	if config.Backoff > 0 {
+		backoff = time.Duration(config.Backoff) * time.Millisecond
+	}
+	maxBackoff := defaultBindMaxBackoff
+	if config.MaxBackoff > 0 {
+		maxBackoff = time.Duration(config.MaxBackoff) * time.Millisecond
+	}
+
+	for attempt := uint32(1); attempt <= config.Attempts; attempt++ {
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+		newError("address ", w.Address(), ":", w.Port(), " is in use, retrying in ", backoff, " (", attempt, "/", config.Attempts, ")").Base(err).AtWarning().WriteToLog()
+		time.Sleep(backoff)
+		backoff *= 2
+
+		err = w.Start()
+		if err == nil {
+			newError("listening on ", w.Address(), ":", w.Port(), " after ", attempt, " retries").AtWarning().WriteToLog()
+			return nil
+		}
+		if !isAddressInUse(err) {
+			return err
+		}
+	}
+	return newError("failed to listen on ", w.Address(), ":", w.Port(), " after ", config.Attempts, " retries").Base(err)
+}
@@ -0,0 +1,59 @@
+package inbound
+
+import (
+	"os"
+	"syscall"
+	"testing"
+
+	"v2ray.com/core/app/proxyman"
+	"v2ray.com/core/common/net"
+	"v2ray.com/core/proxy"
+)
+
+// busyWorker fails to start while its address is in use for the given number of times.
+type busyWorker struct {
+	busy    int
+	started int
+}
+
+func (w *busyWorker) Start() error {
+	w.started++
+	if w.started <= w.busy {
+		return newError("failed to listen TCP").Base(&net.OpError{
+			Op:  "listen",
+			Net: "tcp",
+			Err: os.NewSyscallError("bind", syscall.EADDRINUSE),
+		})
+	}
+	return nil
+}
+
+func (w *busyWorker) Close() error         { return nil }
+func (w *busyWorker) Port() net.Port       { return 443 }
+func (w *busyWorker) Address() net.Address { return net.AnyIP }
+func (w *busyWorker) Proxy() proxy.Inbound { return nil }
+
+func TestStartWorkerRetry(t *testing.T) {
+	config := &proxyman.BindRetryConfig{Attempts: 3, Backoff: 10, MaxBackoff: 20}
+
+	w := &busyWorker{busy: 3}
+	if err := startWorker(w, config); err != nil {
+		t.Error("expected to start after retries, but got ", err)
+	}
+	if w.started != 4 {
+		t.Error("expected 4 attempts, but got ", w.started)
+	}
+
+	w = &busyWorker{busy: 4}
+	if err := startWorker(w, config); err == nil || !isAddressInUse(err) {
+		t.Error("expected to give up with the address in use, but got ", err)
+	}
+
+	w = &busyWorker{busy: 1}
+	if err := startWorker(w, nil); err == nil {
+		t.Error("expected no retry without config")
+	}
+	if w.started != 1 {
+		t.Error("expected 1 attempt, but got ", w.started)
+	}
+}
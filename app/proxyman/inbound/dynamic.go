@@ -11,8 +11,10 @@ import (
 	"v2ray.com/core/common/mux"
 	"v2ray.com/core/common/net"
 	"v2ray.com/core/common/task"
+	"v2ray.com/core/features/inbound"
 	"v2ray.com/core/proxy"
 	"v2ray.com/core/transport/internet"
+	"v2ray.com/core/transport/internet/udp"
 )
 
 type DynamicInboundHandler struct {
@@ -25,9 +27,17 @@ type DynamicInboundHandler struct {
 	portsInUse     map[net.Port]bool
 	workerMutex    sync.RWMutex
 	worker         []worker
+	retiring       map[*time.Timer][]worker
+	draining       map[*udpWorker]bool
 	lastRefresh    time.Time
 	mux            *mux.Server
 	task           *task.Periodic
+	limiter        *connectionLimiter
+	acl            *sourceACL
+	tlsHandshakes  *tlsHandshakeCounter
+	transportStats *internet.TransportStats
+	udpSessions    *udpSessionTable
+	sessions       *proxyman.SessionTracker
 
 	ctx context.Context
 }
@@ -39,12 +49,15 @@ func NewDynamicInboundHandler(ctx context.Context, tag string, receiverConfig *p
 		proxyConfig:    proxyConfig,
 		receiverConfig: receiverConfig,
 		portsInUse:     make(map[net.Port]bool),
+		retiring:       make(map[*time.Timer][]worker),
+		draining:       make(map[*udpWorker]bool),
 		mux:            mux.NewServer(ctx),
+		sessions:       newSessionTracker(v, tag),
 		v:              v,
 		ctx:            ctx,
 	}
 
-	mss, err := internet.ToMemoryStreamConfig(receiverConfig.StreamSettings)
+	mss, err := internet.ToMemoryStreamConfigWithContext(ctx, receiverConfig.StreamSettings)
 	if err != nil {
 		return nil, newError("failed to parse stream settings").Base(err).AtWarning()
 	}
@@ -60,6 +73,21 @@ func NewDynamicInboundHandler(ctx context.Context, tag string, receiverConfig *p
 
 	h.streamSettings = mss
 
+	limiter, err := newConnectionLimiter(receiverConfig.ConnectionLimit)
+	if err != nil {
+		return nil, err
+	}
+	h.limiter = limiter
+	acl, err := newSourceACL(ctx, tag, receiverConfig.SourceAccess)
+	if err != nil {
+		return nil, err
+	}
+	h.acl = acl
+	h.tlsHandshakes = newTLSHandshakeCounter(v, tag, mss)
+	h.transportStats = newTransportStats(v)
+	sessionGauge, dropCounter := getUDPSessionCounters(v, tag)
+	h.udpSessions = newUDPSessionTable(receiverConfig.UdpSession, sessionGauge, dropCounter)
+
 	h.task = &task.Periodic{
 		Interval: time.Minute * time.Duration(h.receiverConfig.AllocationStrategy.GetRefreshValue()),
 		Execute:  h.refresh,
@@ -68,38 +96,73 @@ func NewDynamicInboundHandler(ctx context.Context, tag string, receiverConfig *p
 	return h, nil
 }
 
-func (h *DynamicInboundHandler) allocatePort() net.Port {
+// allocatePort returns a random port in the range that no worker listens on, or false if all ports
+// are taken, e.g. by workers of the previous rounds that are still draining.
+func (h *DynamicInboundHandler) allocatePort() (net.Port, bool) {
 	from := int(h.receiverConfig.PortRange.From)
 	delta := int(h.receiverConfig.PortRange.To) - from + 1
 
 	h.portMutex.Lock()
 	defer h.portMutex.Unlock()
 
+	if len(h.portsInUse) >= delta {
+		return 0, false
+	}
+
 	for {
 		r := dice.Roll(delta)
 		port := net.Port(from + r)
 		_, used := h.portsInUse[port]
 		if !used {
 			h.portsInUse[port] = true
-			return port
+			return port, true
 		}
 	}
 }
 
-func (h *DynamicInboundHandler) closeWorkers(workers []worker) {
-	ports2Del := make([]net.Port, len(workers))
-	for idx, worker := range workers {
-		ports2Del[idx] = worker.Port()
-		if err := worker.Close(); err != nil {
-			newError("failed to close worker").Base(err).WriteToLog()
+func (h *DynamicInboundHandler) releasePort(port net.Port) {
+	h.portMutex.Lock()
+	delete(h.portsInUse, port)
+	h.portMutex.Unlock()
+}
+
+// retireWorkers closes the workers of a round. TCP workers stop listening at once, while UDP workers drain
+// their sessions first. A port is released when all its workers are closed.
+func (h *DynamicInboundHandler) retireWorkers(workers []worker) {
+	var access sync.Mutex
+	pending := make(map[net.Port]int)
+	for _, w := range workers {
+		pending[w.Port()]++
+	}
+	closed := func(port net.Port) {
+		access.Lock()
+		pending[port]--
+		released := pending[port] == 0
+		access.Unlock()
+		if released {
+			h.releasePort(port)
 		}
 	}
 
-	h.portMutex.Lock()
-	for _, port := range ports2Del {
-		delete(h.portsInUse, port)
+	for _, w := range workers {
+		port := w.Port()
+		if udpWorker, ok := w.(*udpWorker); ok {
+			h.workerMutex.Lock()
+			h.draining[udpWorker] = true
+			h.workerMutex.Unlock()
+			udpWorker.drain(func() {
+				h.workerMutex.Lock()
+				delete(h.draining, udpWorker)
+				h.workerMutex.Unlock()
+				closed(port)
+			})
+			continue
+		}
+		if err := w.Close(); err != nil {
+			newError("failed to close worker").Base(err).WriteToLog()
+		}
+		closed(port)
 	}
-	h.portMutex.Unlock()
 }
 
 func (h *DynamicInboundHandler) refresh() error {
@@ -117,12 +180,18 @@ func (h *DynamicInboundHandler) refresh() error {
 	uplinkCounter, downlinkCounter := getStatCounter(h.v, h.tag)
 
 	for i := uint32(0); i < concurrency; i++ {
-		port := h.allocatePort()
+		port, ok := h.allocatePort()
+		if !ok {
+			newError("no free port in ", h.receiverConfig.PortRange.From, "-", h.receiverConfig.PortRange.To).AtWarning().WriteToLog()
+			break
+		}
 		rawProxy, err := core.CreateObject(h.v, h.proxyConfig)
 		if err != nil {
 			newError("failed to create proxy instance").Base(err).AtWarning().WriteToLog()
+			h.releasePort(port)
 			continue
 		}
+		started := len(workers)
 		p := rawProxy.(proxy.Inbound)
 		nl := p.Network()
 		if net.HasNetwork(nl, net.Network_TCP) {
@@ -137,10 +206,16 @@ func (h *DynamicInboundHandler) refresh() error {
 				sniffingConfig:  h.receiverConfig.GetEffectiveSniffingSettings(),
 				uplinkCounter:   uplinkCounter,
 				downlinkCounter: downlinkCounter,
+				limiter:         h.limiter,
+				acl:             h.acl,
+				tlsHandshakes:   h.tlsHandshakes,
+				transportStats:  h.transportStats,
+				sessions:        h.sessions,
 				ctx:             h.ctx,
 			}
 			if err := worker.Start(); err != nil {
 				newError("failed to create TCP worker").Base(err).AtWarning().WriteToLog()
+				h.releasePort(port)
 				continue
 			}
 			workers = append(workers, worker)
@@ -155,23 +230,38 @@ func (h *DynamicInboundHandler) refresh() error {
 				dispatcher:      h.mux,
 				uplinkCounter:   uplinkCounter,
 				downlinkCounter: downlinkCounter,
+				udpSessions:     h.udpSessions,
+				acl:             h.acl,
+				sessions:        h.sessions,
 				stream:          h.streamSettings,
+				maxSessions:     udp.MaxHubSessionsFromContext(h.ctx),
 			}
 			if err := worker.Start(); err != nil {
 				newError("failed to create UDP worker").Base(err).AtWarning().WriteToLog()
-				continue
+			} else {
+				workers = append(workers, worker)
 			}
-			workers = append(workers, worker)
+		}
+
+		if len(workers) == started {
+			h.releasePort(port)
 		}
 	}
 
+	// Workers of this round keep listening until the timeout, after the next round takes their place.
+	// Retiring them only stops listening, and connections and UDP sessions they accepted stay alive until
+	// they finish.
 	h.workerMutex.Lock()
 	h.worker = workers
-	h.workerMutex.Unlock()
-
-	time.AfterFunc(timeout, func() {
-		h.closeWorkers(workers)
+	var timer *time.Timer
+	timer = time.AfterFunc(timeout, func() {
+		h.workerMutex.Lock()
+		delete(h.retiring, timer)
+		h.workerMutex.Unlock()
+		h.retireWorkers(workers)
 	})
+	h.retiring[timer] = workers
+	h.workerMutex.Unlock()
 
 	return nil
 }
@@ -181,7 +271,32 @@ func (h *DynamicInboundHandler) Start() error {
 }
 
 func (h *DynamicInboundHandler) Close() error {
-	return h.task.Close()
+	err := h.task.Close()
+
+	h.workerMutex.Lock()
+	var workers []worker
+	for timer, retiring := range h.retiring {
+		if timer.Stop() {
+			workers = append(workers, retiring...)
+		}
+		delete(h.retiring, timer)
+	}
+	h.worker = nil
+	h.workerMutex.Unlock()
+
+	// Workers of the handler are closed at once, including those draining.
+	h.retireWorkers(workers)
+	h.workerMutex.Lock()
+	draining := make([]*udpWorker, 0, len(h.draining))
+	for w := range h.draining {
+		draining = append(draining, w)
+	}
+	h.workerMutex.Unlock()
+	for _, w := range draining {
+		w.closeDrained()
+	}
+
+	return err
 }
 
 func (h *DynamicInboundHandler) GetRandomInboundProxy() (interface{}, net.Port, int) {
@@ -199,3 +314,16 @@ func (h *DynamicInboundHandler) GetRandomInboundProxy() (interface{}, net.Port,
 func (h *DynamicInboundHandler) Tag() string {
 	return h.tag
 }
+
+// Sessions implements proxyman.SessionReporter.
+func (h *DynamicInboundHandler) Sessions() *proxyman.SessionTracker {
+	return h.sessions
+}
+
+// Bans implements inbound.BanLister.
+func (h *DynamicInboundHandler) Bans() []inbound.Ban {
+	if h.limiter == nil {
+		return nil
+	}
+	return h.limiter.Bans()
+}
@@ -0,0 +1,49 @@
+package inbound
+
+import (
+	"context"
+	"testing"
+
+	"v2ray.com/core"
+	"v2ray.com/core/app/proxyman"
+	"v2ray.com/core/common"
+	"v2ray.com/core/common/net"
+	"v2ray.com/core/proxy/dokodemo"
+)
+
+func TestDynamicInboundStartFailure(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	common.Must(err)
+	defer l.Close()
+	port := net.Port(l.Addr().(*net.TCPAddr).Port)
+
+	v, err := core.New(&core.Config{})
+	common.Must(err)
+	ctx := context.WithValue(context.Background(), core.V2rayKey(1), v)
+	h, err := NewDynamicInboundHandler(ctx, "dynamic", &proxyman.ReceiverConfig{
+		PortRange:          net.SinglePortRange(port),
+		Listen:             net.NewIPOrDomain(net.LocalHostIP),
+		AllocationStrategy: &proxyman.AllocationStrategy{Type: proxyman.AllocationStrategy_Random},
+	}, &dokodemo.Config{
+		Address:  net.NewIPOrDomain(net.LocalHostIP),
+		Port:     80,
+		Networks: []net.Network{net.Network_TCP},
+	})
+	common.Must(err)
+	defer h.Close()
+
+	// The only port of the range is taken, so the worker fails to start.
+	common.Must(h.refresh())
+	if len(h.worker) != 0 {
+		t.Error("expected no worker, but got ", len(h.worker))
+	}
+	if len(h.portsInUse) != 0 {
+		t.Error("expected the port released, but got ", h.portsInUse)
+	}
+
+	common.Must(l.Close())
+	common.Must(h.refresh())
+	if len(h.worker) != 1 || h.worker[0].Port() != port {
+		t.Error("expected a worker on port ", port, ", but got ", h.worker)
+	}
+}
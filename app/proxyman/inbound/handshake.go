@@ -0,0 +1,52 @@
+package inbound
+
+import (
+	"v2ray.com/core"
+	"v2ray.com/core/features/stats"
+	"v2ray.com/core/transport/internet"
+	"v2ray.com/core/transport/internet/tls"
+)
+
+// tlsHandshakeCounter counts the TLS handshakes of an inbound, as "inbound>>>tag>>>tls>>>resumed" and
+// "inbound>>>tag>>>tls>>>full". Only the transports that hand TLS connections to the inbound, such as TCP,
+// are counted.
+type tlsHandshakeCounter struct {
+	resumed stats.Counter
+	full    stats.Counter
+}
+
+// newTLSHandshakeCounter creates the counter of the inbound, or returns nil if the inbound doesn't use TLS.
+func newTLSHandshakeCounter(v *core.Instance, tag string, stream *internet.MemoryStreamConfig) *tlsHandshakeCounter {
+	if len(tag) == 0 || tls.ConfigFromStreamSettings(stream) == nil {
+		return nil
+	}
+	statsManager, ok := v.GetFeature(stats.ManagerType()).(stats.Manager)
+	if !ok {
+		return nil
+	}
+	resumed, _ := stats.GetOrRegisterCounter(statsManager, "inbound>>>"+tag+">>>tls>>>resumed")
+	full, _ := stats.GetOrRegisterCounter(statsManager, "inbound>>>"+tag+">>>tls>>>full")
+	if resumed == nil || full == nil {
+		return nil
+	}
+	return &tlsHandshakeCounter{
+		resumed: resumed,
+		full:    full,
+	}
+}
+
+// Record counts the handshake of the connection, if it is a TLS connection that completed the handshake.
+func (c *tlsHandshakeCounter) Record(conn internet.Connection) {
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return
+	}
+	state := tlsConn.ConnectionState()
+	switch {
+	case !state.HandshakeComplete:
+	case state.DidResume:
+		c.resumed.Add(1)
+	default:
+		c.full.Add(1)
+	}
+}
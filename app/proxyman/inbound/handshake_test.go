@@ -0,0 +1,66 @@
+package inbound
+
+import (
+	gotls "crypto/tls"
+	"testing"
+
+	"v2ray.com/core/app/stats"
+	"v2ray.com/core/common"
+	"v2ray.com/core/common/net"
+	"v2ray.com/core/common/protocol/tls/cert"
+	"v2ray.com/core/transport/internet/tls"
+)
+
+func TestTLSHandshakeCounter(t *testing.T) {
+	counter := &tlsHandshakeCounter{
+		resumed: new(stats.Counter),
+		full:    new(stats.Counter),
+	}
+
+	certPEM, keyPEM := cert.MustGenerate(nil, cert.DNSNames("v2fly.org")).ToPEM()
+	certificate, err := gotls.X509KeyPair(certPEM, keyPEM)
+	common.Must(err)
+	serverConfig := &gotls.Config{Certificates: []gotls.Certificate{certificate}}
+	clientConfig := &gotls.Config{
+		ServerName:         "v2fly.org",
+		InsecureSkipVerify: true,
+		ClientSessionCache: gotls.NewLRUClientSessionCache(8),
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	common.Must(err)
+	defer listener.Close()
+
+	for i := 0; i < 3; i++ {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			server := tls.Server(conn, serverConfig)
+			b := make([]byte, 1)
+			if _, err := server.Read(b); err == nil {
+				server.Write(b)
+			}
+			counter.Record(server)
+			server.Close()
+		}()
+
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		common.Must(err)
+		client := gotls.Client(conn, clientConfig)
+		common.Must2(client.Write([]byte{1}))
+		common.Must2(client.Read(make([]byte, 1)))
+		client.Close()
+		<-done
+	}
+
+	if v := counter.full.Value(); v != 1 {
+		t.Error("full handshakes: ", v)
+	}
+	if v := counter.resumed.Value(); v != 2 {
+		t.Error("resumed handshakes: ", v)
+	}
+}
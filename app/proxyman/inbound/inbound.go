@@ -11,6 +11,7 @@ import (
 	"v2ray.com/core/common"
 	"v2ray.com/core/common/serial"
 	"v2ray.com/core/common/session"
+	"v2ray.com/core/features/events"
 	"v2ray.com/core/features/inbound"
 )
 
@@ -20,16 +21,25 @@ type Manager struct {
 	untaggedHandler []inbound.Handler
 	taggedHandlers  map[string]inbound.Handler
 	running         bool
+	instance        *core.Instance
 }
 
 // New returns a new Manager for inbound handlers.
 func New(ctx context.Context, config *proxyman.InboundConfig) (*Manager, error) {
 	m := &Manager{
 		taggedHandlers: make(map[string]inbound.Handler),
+		instance:       core.FromContext(ctx),
 	}
 	return m, nil
 }
 
+// emit sends an event of the handler with the tag through the events.Emitter of the instance, if any.
+func (m *Manager) emit(eventType string, tag string) {
+	if m.instance != nil {
+		events.Emit(m.instance, events.New(eventType, map[string]interface{}{"tag": tag}))
+	}
+}
+
 // Type implements common.HasType.
 func (*Manager) Type() interface{} {
 	return inbound.ManagerType()
@@ -48,9 +58,12 @@ func (m *Manager) AddHandler(ctx context.Context, handler inbound.Handler) error
 	}
 
 	if m.running {
-		return handler.Start()
+		if err := handler.Start(); err != nil {
+			return err
+		}
 	}
 
+	m.emit(events.InboundAdded, tag)
 	return nil
 }
 
@@ -80,12 +93,26 @@ func (m *Manager) RemoveHandler(ctx context.Context, tag string) error {
 			newError("failed to close handler ", tag).Base(err).AtWarning().WriteToLog(session.ExportIDToError(ctx))
 		}
 		delete(m.taggedHandlers, tag)
+		m.emit(events.InboundRemoved, tag)
 		return nil
 	}
 
 	return common.ErrNoClue
 }
 
+// ListHandlers implements inbound.Manager.
+func (m *Manager) ListHandlers(ctx context.Context) []inbound.Handler {
+	m.access.RLock()
+	defer m.access.RUnlock()
+
+	handlers := make([]inbound.Handler, 0, len(m.untaggedHandler)+len(m.taggedHandlers))
+	handlers = append(handlers, m.untaggedHandler...)
+	for _, handler := range m.taggedHandlers {
+		handlers = append(handlers, handler)
+	}
+	return handlers
+}
+
 // Start implements common.Runnable.
 func (m *Manager) Start() error {
 	m.access.Lock()
@@ -0,0 +1,242 @@
+package inbound
+
+import (
+	"hash/fnv"
+	"sort"
+	"sync"
+	"time"
+
+	"v2ray.com/core/app/proxyman"
+	"v2ray.com/core/common/net"
+	"v2ray.com/core/features/inbound"
+)
+
+const (
+	defaultBanWindow   = time.Minute
+	defaultBanDuration = 10 * time.Minute
+
+	// limiterShards is the number of shards of the state of source IPs, to reduce lock contention.
+	limiterShards = 16
+	// limiterSweepInterval is how often a shard drops the state of idle source IPs.
+	limiterSweepInterval = time.Minute
+)
+
+// connectionLimits are the thresholds applied to a source IP.
+type connectionLimits struct {
+	rate         float64
+	burst        float64
+	banThreshold uint32
+}
+
+type limitOverride struct {
+	networks []*net.IPNet
+	limits   connectionLimits
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type failureRecord struct {
+	count uint32
+	start time.Time
+}
+
+type limiterShard struct {
+	sync.Mutex
+	buckets   map[string]*tokenBucket
+	failures  map[string]*failureRecord
+	bans      map[string]time.Time
+	lastSweep time.Time
+}
+
+// connectionLimiter limits the rate of new connections from each source IP, and bans source IPs
+// that fail authentication too often.
+type connectionLimiter struct {
+	limits      connectionLimits
+	overrides   []limitOverride
+	banWindow   time.Duration
+	banDuration time.Duration
+	shards      [limiterShards]limiterShard
+}
+
+func newLimits(rate, burst, banThreshold uint32) connectionLimits {
+	if burst == 0 {
+		burst = rate
+	}
+	return connectionLimits{
+		rate:         float64(rate),
+		burst:        float64(burst),
+		banThreshold: banThreshold,
+	}
+}
+
+// newConnectionLimiter creates a limiter from the config, or returns nil if the config doesn't limit
+// anything.
+func newConnectionLimiter(config *proxyman.ConnectionLimitConfig) (*connectionLimiter, error) {
+	if config == nil {
+		return nil, nil
+	}
+	l := &connectionLimiter{
+		limits:      newLimits(config.Rate, config.Burst, config.BanThreshold),
+		banWindow:   time.Duration(config.BanWindow) * time.Second,
+		banDuration: time.Duration(config.BanDuration) * time.Second,
+	}
+	if l.banWindow == 0 {
+		l.banWindow = defaultBanWindow
+	}
+	if l.banDuration == 0 {
+		l.banDuration = defaultBanDuration
+	}
+	enabled := config.Rate > 0 || config.BanThreshold > 0
+	for _, o := range config.Override {
+		override := limitOverride{
+			limits: newLimits(o.Rate, o.Burst, o.BanThreshold),
+		}
+		for _, cidr := range o.Cidr {
+			_, network, err := net.ParseCIDR(cidr)
+			if err != nil {
+				return nil, newError("invalid network in connection limit: ", cidr).Base(err)
+			}
+			override.networks = append(override.networks, network)
+		}
+		l.overrides = append(l.overrides, override)
+		enabled = enabled || o.Rate > 0 || o.BanThreshold > 0
+	}
+	if !enabled {
+		return nil, nil
+	}
+	for i := range l.shards {
+		s := &l.shards[i]
+		s.buckets = make(map[string]*tokenBucket)
+		s.failures = make(map[string]*failureRecord)
+		s.bans = make(map[string]time.Time)
+	}
+	return l, nil
+}
+
+func (l *connectionLimiter) limitsOf(ip net.IP) connectionLimits {
+	for _, o := range l.overrides {
+		for _, network := range o.networks {
+			if network.Contains(ip) {
+				return o.limits
+			}
+		}
+	}
+	return l.limits
+}
+
+// shard returns the locked shard of the source IP.
+func (l *connectionLimiter) shard(key string, now time.Time) *limiterShard {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	s := &l.shards[h.Sum32()%limiterShards]
+	s.Lock()
+	if now.Sub(s.lastSweep) > limiterSweepInterval {
+		s.sweep(now, l.banWindow)
+	}
+	return s
+}
+
+// sweep drops the state that no longer affects decisions. It must be called with the shard locked.
+func (s *limiterShard) sweep(now time.Time, banWindow time.Duration) {
+	s.lastSweep = now
+	for key, b := range s.buckets {
+		// Buckets refill within seconds, so an idle bucket is as good as a new one.
+		if now.Sub(b.last) > limiterSweepInterval {
+			delete(s.buckets, key)
+		}
+	}
+	for key, f := range s.failures {
+		if now.Sub(f.start) > banWindow {
+			delete(s.failures, key)
+		}
+	}
+	for key, expire := range s.bans {
+		if now.After(expire) {
+			delete(s.bans, key)
+		}
+	}
+}
+
+// Allow returns whether a new connection from the source IP is accepted.
+func (l *connectionLimiter) Allow(ip net.IP) bool {
+	now := time.Now()
+	key := ip.String()
+	limits := l.limitsOf(ip)
+
+	s := l.shard(key, now)
+	defer s.Unlock()
+
+	if expire, found := s.bans[key]; found {
+		if now.Before(expire) {
+			return false
+		}
+		delete(s.bans, key)
+	}
+
+	if limits.rate <= 0 {
+		return true
+	}
+	b, found := s.buckets[key]
+	if !found {
+		b = &tokenBucket{tokens: limits.burst, last: now}
+		s.buckets[key] = b
+	}
+	b.tokens += now.Sub(b.last).Seconds() * limits.rate
+	if b.tokens > limits.burst {
+		b.tokens = limits.burst
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// RecordFailure records an authentication failure of the source IP, and returns whether the IP is
+// banned for it.
+func (l *connectionLimiter) RecordFailure(ip net.IP) bool {
+	limits := l.limitsOf(ip)
+	if limits.banThreshold == 0 {
+		return false
+	}
+
+	now := time.Now()
+	key := ip.String()
+	s := l.shard(key, now)
+	defer s.Unlock()
+
+	f, found := s.failures[key]
+	if !found || now.Sub(f.start) > l.banWindow {
+		f = &failureRecord{start: now}
+		s.failures[key] = f
+	}
+	f.count++
+	if f.count < limits.banThreshold {
+		return false
+	}
+	delete(s.failures, key)
+	s.bans[key] = now.Add(l.banDuration)
+	return true
+}
+
+// Bans returns the source IPs currently banned, in the order of their expiration.
+func (l *connectionLimiter) Bans() []inbound.Ban {
+	now := time.Now()
+	var bans []inbound.Ban
+	for i := range l.shards {
+		s := &l.shards[i]
+		s.Lock()
+		for key, expire := range s.bans {
+			if now.Before(expire) {
+				bans = append(bans, inbound.Ban{IP: net.ParseIP(key), Expire: expire})
+			}
+		}
+		s.Unlock()
+	}
+	sort.Slice(bans, func(i, j int) bool { return bans[i].Expire.Before(bans[j].Expire) })
+	return bans
+}
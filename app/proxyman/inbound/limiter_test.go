@@ -0,0 +1,76 @@
+package inbound
+
+import (
+	"testing"
+
+	"v2ray.com/core/app/proxyman"
+	"v2ray.com/core/common"
+	"v2ray.com/core/common/net"
+)
+
+func TestConnectionLimiter(t *testing.T) {
+	limiter, err := newConnectionLimiter(&proxyman.ConnectionLimitConfig{
+		Rate:         1,
+		Burst:        3,
+		BanThreshold: 2,
+		Override: []*proxyman.ConnectionLimitConfig_Override{
+			{
+				Cidr: []string{"10.0.0.0/8"},
+				Rate: 100,
+			},
+		},
+	})
+	common.Must(err)
+
+	ip := net.ParseIP("1.2.3.4")
+	for i := 0; i < 3; i++ {
+		if !limiter.Allow(ip) {
+			t.Fatal("connection ", i, " rejected within burst")
+		}
+	}
+	if limiter.Allow(ip) {
+		t.Error("connection accepted beyond burst")
+	}
+
+	nat := net.ParseIP("10.1.2.3")
+	for i := 0; i < 10; i++ {
+		if !limiter.Allow(nat) {
+			t.Fatal("connection ", i, " rejected from overridden network")
+		}
+	}
+
+	other := net.ParseIP("5.6.7.8")
+	if limiter.RecordFailure(other) {
+		t.Error("banned after first failure")
+	}
+	if !limiter.RecordFailure(other) {
+		t.Error("not banned after reaching threshold")
+	}
+	if limiter.Allow(other) {
+		t.Error("banned IP accepted")
+	}
+	if limiter.RecordFailure(nat) {
+		t.Error("overridden network banned without threshold")
+	}
+
+	bans := limiter.Bans()
+	if len(bans) != 1 || !bans[0].IP.Equal(other) {
+		t.Error("bans: ", bans)
+	}
+}
+
+func TestConnectionLimiterDisabled(t *testing.T) {
+	limiter, err := newConnectionLimiter(&proxyman.ConnectionLimitConfig{})
+	common.Must(err)
+	if limiter != nil {
+		t.Error("expected no limiter")
+	}
+
+	if _, err := newConnectionLimiter(&proxyman.ConnectionLimitConfig{
+		Override: []*proxyman.ConnectionLimitConfig_Override{
+			{Cidr: []string{"bad"}, Rate: 1},
+		},
+	}); err == nil {
+		t.Error("expected error for invalid network")
+	}
+}
@@ -0,0 +1,165 @@
+package inbound
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"v2ray.com/core"
+	"v2ray.com/core/app/proxyman"
+	"v2ray.com/core/common/net"
+	"v2ray.com/core/features/policy"
+	"v2ray.com/core/features/stats"
+)
+
+const (
+	defaultUDPIdleTimeout = 8
+	// defaultUDPRequestTimeout is the idle timeout of request/response protocols, where a session is
+	// done after the first response.
+	defaultUDPRequestTimeout = 4
+	// maxUDPCheckInterval is the longest interval between checks of idle UDP sessions.
+	maxUDPCheckInterval = 16 * time.Second
+)
+
+var defaultUDPPortTimeouts = map[net.Port]int64{
+	53:  defaultUDPRequestTimeout,
+	123: defaultUDPRequestTimeout,
+}
+
+func getUDPSessionCounters(v *core.Instance, tag string) (stats.Counter, stats.Counter) {
+	if len(tag) == 0 {
+		return nil, nil
+	}
+	policy := v.GetFeature(policy.ManagerType()).(policy.Manager)
+	if !policy.ForSystem().Stats.InboundUDPSessions {
+		return nil, nil
+	}
+	statsManager := v.GetFeature(stats.ManagerType()).(stats.Manager)
+	sessions, _ := stats.GetOrRegisterCounter(statsManager, "inbound>>>"+tag+">>>udp>>>sessions")
+	dropped, _ := stats.GetOrRegisterCounter(statsManager, "inbound>>>"+tag+">>>udp>>>dropped")
+	return sessions, dropped
+}
+
+// udpSessionTable tracks the UDP sessions of all the workers of an inbound handler, and enforces
+// their limits.
+type udpSessionTable struct {
+	sync.Mutex
+	maxSessions int
+	idleTimeout int64
+	portTimeout map[net.Port]int64
+	sessions    map[*udpConn]*list.Element
+	// lru holds the sessions in the order of their activity, from the one idle for the longest time.
+	lru *list.List
+
+	sessionGauge stats.Counter
+	dropCounter  stats.Counter
+}
+
+func newUDPSessionTable(config *proxyman.UDPSessionConfig, sessionGauge, dropCounter stats.Counter) *udpSessionTable {
+	t := &udpSessionTable{
+		idleTimeout:  defaultUDPIdleTimeout,
+		portTimeout:  make(map[net.Port]int64),
+		sessions:     make(map[*udpConn]*list.Element),
+		lru:          list.New(),
+		sessionGauge: sessionGauge,
+		dropCounter:  dropCounter,
+	}
+	for port, timeout := range defaultUDPPortTimeouts {
+		t.portTimeout[port] = timeout
+	}
+	if config != nil {
+		t.maxSessions = int(config.MaxSessions)
+		if config.IdleTimeout > 0 {
+			t.idleTimeout = int64(config.IdleTimeout)
+		}
+		for port, timeout := range config.PortTimeout {
+			t.portTimeout[net.Port(port)] = int64(timeout)
+		}
+	}
+	return t
+}
+
+// timeout returns the idle timeout in seconds of the session to the destination.
+func (t *udpSessionTable) timeout(dest net.Destination) int64 {
+	if dest.IsValid() {
+		if timeout, found := t.portTimeout[dest.Port]; found && timeout > 0 {
+			return timeout
+		}
+	}
+	return t.idleTimeout
+}
+
+// checkInterval returns how often idle sessions should be checked, so that they are closed soon
+// after their timeouts.
+func (t *udpSessionTable) checkInterval() time.Duration {
+	interval := maxUDPCheckInterval
+	timeouts := []int64{t.idleTimeout}
+	for _, timeout := range t.portTimeout {
+		timeouts = append(timeouts, timeout)
+	}
+	for _, timeout := range timeouts {
+		if d := time.Duration(timeout) * time.Second; d > 0 && d < interval {
+			interval = d
+		}
+	}
+	return interval
+}
+
+// Add tracks a new session. If the table is full, the session idle for the longest time is closed
+// to make room for it.
+func (t *udpSessionTable) Add(conn *udpConn) {
+	t.Lock()
+	defer t.Unlock()
+
+	if t.maxSessions > 0 && len(t.sessions) >= t.maxSessions {
+		oldest := t.lru.Remove(t.lru.Front()).(*udpConn)
+		delete(t.sessions, oldest)
+		oldest.Close()
+		if t.dropCounter != nil {
+			t.dropCounter.Add(1)
+		}
+		newError("evicted UDP session from ", oldest.remote, " for too many sessions").AtDebug().WriteToLog()
+	}
+
+	// New sessions are usually the latest active, so the search ends at the back.
+	activity := atomic.LoadInt64(&conn.lastActivityTime)
+	mark := t.lru.Back()
+	for mark != nil && atomic.LoadInt64(&mark.Value.(*udpConn).lastActivityTime) > activity {
+		mark = mark.Prev()
+	}
+	if mark == nil {
+		t.sessions[conn] = t.lru.PushFront(conn)
+	} else {
+		t.sessions[conn] = t.lru.InsertAfter(conn, mark)
+	}
+	t.updateGauge()
+}
+
+// Touch marks the session as the latest active.
+func (t *udpSessionTable) Touch(conn *udpConn) {
+	t.Lock()
+	defer t.Unlock()
+
+	if e, found := t.sessions[conn]; found {
+		t.lru.MoveToBack(e)
+	}
+}
+
+// Remove stops tracking the session.
+func (t *udpSessionTable) Remove(conn *udpConn) {
+	t.Lock()
+	defer t.Unlock()
+
+	if e, found := t.sessions[conn]; found {
+		t.lru.Remove(e)
+		delete(t.sessions, conn)
+	}
+	t.updateGauge()
+}
+
+func (t *udpSessionTable) updateGauge() {
+	if t.sessionGauge != nil {
+		t.sessionGauge.Set(int64(len(t.sessions)))
+	}
+}
@@ -0,0 +1,100 @@
+package inbound
+
+import (
+	"testing"
+	"time"
+
+	"v2ray.com/core/app/proxyman"
+	"v2ray.com/core/app/stats"
+	"v2ray.com/core/common/net"
+	"v2ray.com/core/common/signal/done"
+	"v2ray.com/core/transport/pipe"
+)
+
+func newTestUDPConn(lastActivity int64) *udpConn {
+	_, writer := pipe.New()
+	return &udpConn{
+		lastActivityTime: lastActivity,
+		writer:           writer,
+		done:             done.New(),
+	}
+}
+
+func TestUDPSessionTableEviction(t *testing.T) {
+	gauge := new(stats.Counter)
+	dropped := new(stats.Counter)
+	table := newUDPSessionTable(&proxyman.UDPSessionConfig{MaxSessions: 2}, gauge, dropped)
+
+	now := time.Now().Unix()
+	idle := newTestUDPConn(now - 5)
+	active := newTestUDPConn(now)
+	table.Add(active)
+	table.Add(idle)
+	table.Add(newTestUDPConn(now))
+
+	if !idle.done.Done() {
+		t.Error("idle session not evicted")
+	}
+	if active.done.Done() {
+		t.Error("active session evicted")
+	}
+	if v := gauge.Value(); v != 2 {
+		t.Error("session gauge: ", v)
+	}
+	if v := dropped.Value(); v != 1 {
+		t.Error("drop counter: ", v)
+	}
+
+	table.Remove(active)
+	if v := gauge.Value(); v != 1 {
+		t.Error("session gauge after removal: ", v)
+	}
+}
+
+func TestUDPSessionTableTouch(t *testing.T) {
+	table := newUDPSessionTable(&proxyman.UDPSessionConfig{MaxSessions: 2}, nil, nil)
+
+	now := time.Now().Unix()
+	first := newTestUDPConn(now - 2)
+	second := newTestUDPConn(now - 1)
+	first.sessions = table
+	table.Add(first)
+	table.Add(second)
+
+	// The first session is active again, so the second is idle for the longest time.
+	first.updateActivity()
+	table.Add(newTestUDPConn(now))
+
+	if first.done.Done() {
+		t.Error("touched session evicted")
+	}
+	if !second.done.Done() {
+		t.Error("idle session not evicted")
+	}
+}
+
+func TestUDPSessionTableTimeout(t *testing.T) {
+	table := newUDPSessionTable(&proxyman.UDPSessionConfig{
+		IdleTimeout: 30,
+		PortTimeout: map[uint32]uint32{123: 10, 5353: 1},
+	}, nil, nil)
+
+	cases := []struct {
+		dest    net.Destination
+		timeout int64
+	}{
+		{net.Destination{}, 30},
+		{net.UDPDestination(net.LocalHostIP, 53), defaultUDPRequestTimeout},
+		{net.UDPDestination(net.LocalHostIP, 123), 10},
+		{net.UDPDestination(net.LocalHostIP, 5353), 1},
+		{net.UDPDestination(net.LocalHostIP, 443), 30},
+	}
+	for _, c := range cases {
+		if timeout := table.timeout(c.dest); timeout != c.timeout {
+			t.Error("timeout of ", c.dest, ": ", timeout, ", want ", c.timeout)
+		}
+	}
+	if interval := table.checkInterval(); interval != time.Second {
+		t.Error("check interval: ", interval)
+	}
+}
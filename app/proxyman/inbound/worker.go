@@ -27,6 +27,7 @@ type worker interface {
 	Start() error
 	Close() error
 	Port() net.Port
+	Address() net.Address
 	Proxy() proxy.Inbound
 }
 
@@ -41,8 +42,15 @@ type tcpWorker struct {
 	sniffingConfig  *proxyman.SniffingConfig
 	uplinkCounter   stats.Counter
 	downlinkCounter stats.Counter
+	limiter         *connectionLimiter
+	acl             *sourceACL
+	tlsHandshakes   *tlsHandshakeCounter
+	transportStats  *internet.TransportStats
+	sessions        *proxyman.SessionTracker
+	// listeners is the number of listeners sharing the address, each accepting connections of its own.
+	listeners int
 
-	hub internet.Listener
+	hubs []internet.Listener
 
 	ctx context.Context
 }
@@ -55,17 +63,36 @@ func getTProxyType(s *internet.MemoryStreamConfig) internet.SocketConfig_TProxyM
 }
 
 func (w *tcpWorker) callback(conn internet.Connection) {
+	// The transport may count the connection already, which hides the socket and TLS state underneath.
+	rawConn := conn
+	if statConn, ok := conn.(*internet.StatCouterConnection); ok {
+		rawConn = statConn.Connection
+	}
+	source := net.DestinationFromAddr(conn.RemoteAddr())
+	if w.acl != nil && !w.acl.Allow(source) {
+		conn.Close()
+		return
+	}
+	if w.limiter != nil && source.Address.Family().IsIP() && !w.limiter.Allow(source.Address.IP()) {
+		newError("rejecting connection from ", source).AtDebug().WriteToLog()
+		conn.Close()
+		return
+	}
+	defer w.sessions.Begin()()
+
 	ctx, cancel := context.WithCancel(w.ctx)
 	sid := session.NewID()
 	ctx = session.ContextWithID(ctx, sid)
+	ctx = task.ContextWithGoroutineCounter(ctx, w.sessions)
 
 	if w.recvOrigDest {
 		var dest net.Destination
 		switch getTProxyType(w.stream) {
 		case internet.SocketConfig_Redirect:
-			d, err := tcp.GetOriginalDestination(conn)
+			d, err := tcp.GetOriginalDestination(rawConn)
 			if err != nil {
-				newError("failed to get original destination").Base(err).WriteToLog(session.ExportIDToError(ctx))
+				// The connection goes on to the destination in the config of the inbound.
+				newError("failed to get original destination").Base(err).AtWarning().WriteToLog(session.ExportIDToError(ctx))
 			} else {
 				dest = d
 			}
@@ -78,27 +105,30 @@ func (w *tcpWorker) callback(conn internet.Connection) {
 			})
 		}
 	}
-	ctx = session.ContextWithInbound(ctx, &session.Inbound{
-		Source:  net.DestinationFromAddr(conn.RemoteAddr()),
+	inbound := &session.Inbound{
+		Source:  source,
 		Gateway: net.TCPDestination(w.address, w.port),
 		Tag:     w.tag,
-	})
+	}
+	ctx = session.ContextWithInbound(ctx, inbound)
 	content := new(session.Content)
 	if w.sniffingConfig != nil {
 		content.SniffingRequest.Enabled = w.sniffingConfig.Enabled
 		content.SniffingRequest.OverrideDestinationForProtocol = w.sniffingConfig.DestinationOverride
+		content.SniffingRequest.Timeout = time.Duration(w.sniffingConfig.Timeout) * time.Millisecond
+		content.SniffingRequest.RecordRequest = w.sniffingConfig.RecordRequest
 	}
 	ctx = session.ContextWithContent(ctx, content)
-	if w.uplinkCounter != nil || w.downlinkCounter != nil {
-		conn = &internet.StatCouterConnection{
-			Connection:   conn,
-			ReadCounter:  w.uplinkCounter,
-			WriteCounter: w.downlinkCounter,
-		}
-	}
+	conn = internet.NewStatCouterConnection(conn, w.uplinkCounter, w.downlinkCounter)
 	if err := w.proxy.Process(ctx, net.Network_TCP, conn, w.dispatcher); err != nil {
 		newError("connection ends").Base(err).WriteToLog(session.ExportIDToError(ctx))
 	}
+	if w.tlsHandshakes != nil {
+		w.tlsHandshakes.Record(rawConn)
+	}
+	if w.limiter != nil && inbound.AuthFailed && source.Address.Family().IsIP() && w.limiter.RecordFailure(source.Address.IP()) {
+		newError("banning ", source.Address, " from inbound [", w.tag, "] for failing authentication").AtWarning().WriteToLog(session.ExportIDToError(ctx))
+	}
 	cancel()
 	if err := conn.Close(); err != nil {
 		newError("failed to close connection").Base(err).WriteToLog(session.ExportIDToError(ctx))
@@ -110,22 +140,40 @@ func (w *tcpWorker) Proxy() proxy.Inbound {
 }
 
 func (w *tcpWorker) Start() error {
-	ctx := context.Background()
-	hub, err := internet.ListenTCP(ctx, w.address, w.port, w.stream, func(conn internet.Connection) {
-		go w.callback(conn)
-	})
-	if err != nil {
-		return newError("failed to listen TCP on ", w.port).AtWarning().Base(err)
+	ctx := internet.ContextWithTransportStats(context.Background(), w.transportStats)
+	listeners := w.listeners
+	if listeners < 1 {
+		listeners = 1
+	}
+	hubs := make([]internet.Listener, 0, listeners)
+	for i := 0; i < listeners; i++ {
+		hub, err := internet.ListenTCP(ctx, w.address, w.port, w.stream, func(conn internet.Connection) {
+			w.sessions.Go(func() {
+				w.callback(conn)
+			})
+		})
+		if err != nil {
+			for _, hub := range hubs {
+				hub.Close()
+			}
+			return newError("failed to listen TCP on ", w.port).AtWarning().Base(err)
+		}
+		hubs = append(hubs, hub)
 	}
-	w.hub = hub
+	if listeners > 1 {
+		newError("sharding accepts on ", w.address, ":", w.port, " across ", listeners, " listeners").AtInfo().WriteToLog()
+	}
+	w.hubs = hubs
 	return nil
 }
 
 func (w *tcpWorker) Close() error {
 	var errors []interface{}
-	if w.hub != nil {
-		if err := common.Close(w.hub); err != nil {
-			errors = append(errors, err)
+	if len(w.hubs) > 0 {
+		for _, hub := range w.hubs {
+			if err := common.Close(hub); err != nil {
+				errors = append(errors, err)
+			}
 		}
 		if err := common.Close(w.proxy); err != nil {
 			errors = append(errors, err)
@@ -142,8 +190,13 @@ func (w *tcpWorker) Port() net.Port {
 	return w.port
 }
 
+func (w *tcpWorker) Address() net.Address {
+	return w.address
+}
+
 type udpConn struct {
 	lastActivityTime int64 // in seconds
+	timeout          int64 // in seconds
 	reader           buf.Reader
 	writer           buf.Writer
 	output           func([]byte) (int, error)
@@ -152,10 +205,16 @@ type udpConn struct {
 	done             *done.Instance
 	uplink           stats.Counter
 	downlink         stats.Counter
+	sessions         *udpSessionTable
 }
 
+// updateActivity records the activity of the session. The table of sessions is told once per second
+// at most, as activity is counted in seconds.
 func (c *udpConn) updateActivity() {
-	atomic.StoreInt64(&c.lastActivityTime, time.Now().Unix())
+	now := time.Now().Unix()
+	if atomic.SwapInt64(&c.lastActivityTime, now) != now && c.sessions != nil {
+		c.sessions.Touch(c)
+	}
 }
 
 // ReadMultiBuffer implements buf.Reader
@@ -232,11 +291,22 @@ type udpWorker struct {
 	dispatcher      routing.Dispatcher
 	uplinkCounter   stats.Counter
 	downlinkCounter stats.Counter
+	udpSessions     *udpSessionTable
+	acl             *sourceACL
+	sessions        *proxyman.SessionTracker
+	// maxSessions is the limit of sessions served at the same time. Zero for no limit.
+	maxSessions uint32
 
 	checker    *task.Periodic
 	activeConn map[connID]*udpConn
+	// draining is set when the worker is retired. It takes no new sessions, and is closed when the
+	// sessions end or time out, after which onDrained is called.
+	draining  bool
+	onDrained func()
 }
 
+// getConnection returns the session of the id, and whether it exists already. It returns nil if a new
+// session is rejected by the ACL, or the limit of sessions.
 func (w *udpWorker) getConnection(id connID) (*udpConn, bool) {
 	w.Lock()
 	defer w.Unlock()
@@ -244,6 +314,17 @@ func (w *udpWorker) getConnection(id connID) (*udpConn, bool) {
 	if conn, found := w.activeConn[id]; found && !conn.done.Done() {
 		return conn, true
 	}
+	if w.draining {
+		newError("dropping packets from ", id.src, " as the port is retired").AtDebug().WriteToLog()
+		return nil, false
+	}
+	if w.acl != nil && !w.acl.Allow(id.src) {
+		return nil, false
+	}
+	if limit := w.maxSessions; limit > 0 && uint32(len(w.activeConn)) >= limit {
+		newError("dropping packets from ", id.src, " as ", limit, " sessions are served already").AtDebug().WriteToLog()
+		return nil, false
+	}
 
 	pReader, pWriter := pipe.New(pipe.DiscardOverflow(), pipe.WithSizeLimit(16*1024))
 	conn := &udpConn{
@@ -260,13 +341,16 @@ func (w *udpWorker) getConnection(id connID) (*udpConn, bool) {
 			IP:   w.address.IP(),
 			Port: int(w.port),
 		},
+		timeout:  w.udpSessions.timeout(id.dest),
 		done:     done.New(),
 		uplink:   w.uplinkCounter,
 		downlink: w.downlinkCounter,
+		sessions: w.udpSessions,
 	}
+	conn.updateActivity()
+	w.udpSessions.Add(conn)
 	w.activeConn[id] = conn
 
-	conn.updateActivity()
 	return conn, false
 }
 
@@ -278,6 +362,10 @@ func (w *udpWorker) callback(b *buf.Buffer, source net.Destination, originalDest
 		id.dest = originalDest
 	}
 	conn, existing := w.getConnection(id)
+	if conn == nil {
+		b.Release()
+		return
+	}
 
 	// payload will be discarded in pipe is full.
 	conn.writer.WriteMultiBuffer(buf.MultiBuffer{b})
@@ -285,10 +373,14 @@ func (w *udpWorker) callback(b *buf.Buffer, source net.Destination, originalDest
 	if !existing {
 		common.Must(w.checker.Start())
 
-		go func() {
+		endSession := w.sessions.Begin()
+		w.sessions.Go(func() {
+			defer endSession()
+
 			ctx := context.Background()
 			sid := session.NewID()
 			ctx = session.ContextWithID(ctx, sid)
+			ctx = task.ContextWithGoroutineCounter(ctx, w.sessions)
 
 			if originalDest.IsValid() {
 				ctx = session.ContextWithOutbound(ctx, &session.Outbound{
@@ -304,15 +396,57 @@ func (w *udpWorker) callback(b *buf.Buffer, source net.Destination, originalDest
 				newError("connection ends").Base(err).WriteToLog(session.ExportIDToError(ctx))
 			}
 			conn.Close()
-			w.removeConn(id)
-		}()
+			w.removeConn(id, conn)
+		})
+	}
+}
+
+func (w *udpWorker) removeConn(id connID, conn *udpConn) {
+	w.Lock()
+	// The session may have been replaced after it was closed.
+	if w.activeConn[id] == conn {
+		delete(w.activeConn, id)
+	}
+	drained := w.draining && len(w.activeConn) == 0
+	w.Unlock()
+	w.udpSessions.Remove(conn)
+
+	if drained {
+		w.closeDrained()
+	}
+}
+
+// drain stops the worker from taking new sessions, and closes it once its sessions end or time out.
+// onDrained is called after the worker is closed.
+func (w *udpWorker) drain(onDrained func()) {
+	w.Lock()
+	w.draining = true
+	w.onDrained = onDrained
+	empty := len(w.activeConn) == 0
+	w.Unlock()
+
+	if empty {
+		w.closeDrained()
+		return
 	}
+	// Sessions are timed out by the checker, which stops when there is none.
+	w.checker.Start() // nolint: errcheck
 }
 
-func (w *udpWorker) removeConn(id connID) {
+// closeDrained closes the draining worker, if it is not closed yet.
+func (w *udpWorker) closeDrained() {
 	w.Lock()
-	delete(w.activeConn, id)
+	onDrained := w.onDrained
+	w.onDrained = nil
 	w.Unlock()
+	if onDrained == nil {
+		return
+	}
+
+	if err := w.Close(); err != nil {
+		newError("failed to close worker").Base(err).WriteToLog()
+	}
+	onDrained()
 }
 
 func (w *udpWorker) handlePackets() {
@@ -328,13 +462,17 @@ func (w *udpWorker) clean() error {
 	defer w.Unlock()
 
 	if len(w.activeConn) == 0 {
+		if w.draining {
+			go w.closeDrained()
+		}
 		return newError("no more connections. stopping...")
 	}
 
 	for addr, conn := range w.activeConn {
-		if nowSec-atomic.LoadInt64(&conn.lastActivityTime) > 8 { // TODO Timeout too small
+		if conn.done.Done() || nowSec-atomic.LoadInt64(&conn.lastActivityTime) > conn.timeout {
 			delete(w.activeConn, addr)
 			conn.Close()
+			w.udpSessions.Remove(conn)
 		}
 	}
 
@@ -353,8 +491,11 @@ func (w *udpWorker) Start() error {
 		return err
 	}
 
+	if w.udpSessions == nil {
+		w.udpSessions = newUDPSessionTable(nil, nil, nil)
+	}
 	w.checker = &task.Periodic{
-		Interval: time.Second * 16,
+		Interval: w.udpSessions.checkInterval(),
 		Execute:  w.clean,
 	}
 
@@ -395,6 +536,10 @@ func (w *udpWorker) Port() net.Port {
 	return w.port
 }
 
+func (w *udpWorker) Address() net.Address {
+	return w.address
+}
+
 func (w *udpWorker) Proxy() proxy.Inbound {
 	return w.proxy
 }
@@ -408,6 +553,8 @@ type dsWorker struct {
 	sniffingConfig  *proxyman.SniffingConfig
 	uplinkCounter   stats.Counter
 	downlinkCounter stats.Counter
+	transportStats  *internet.TransportStats
+	sessions        *proxyman.SessionTracker
 
 	hub internet.Listener
 
@@ -415,9 +562,12 @@ type dsWorker struct {
 }
 
 func (w *dsWorker) callback(conn internet.Connection) {
+	defer w.sessions.Begin()()
+
 	ctx, cancel := context.WithCancel(w.ctx)
 	sid := session.NewID()
 	ctx = session.ContextWithID(ctx, sid)
+	ctx = task.ContextWithGoroutineCounter(ctx, w.sessions)
 
 	ctx = session.ContextWithInbound(ctx, &session.Inbound{
 		Source:  net.DestinationFromAddr(conn.RemoteAddr()),
@@ -428,15 +578,11 @@ func (w *dsWorker) callback(conn internet.Connection) {
 	if w.sniffingConfig != nil {
 		content.SniffingRequest.Enabled = w.sniffingConfig.Enabled
 		content.SniffingRequest.OverrideDestinationForProtocol = w.sniffingConfig.DestinationOverride
+		content.SniffingRequest.Timeout = time.Duration(w.sniffingConfig.Timeout) * time.Millisecond
+		content.SniffingRequest.RecordRequest = w.sniffingConfig.RecordRequest
 	}
 	ctx = session.ContextWithContent(ctx, content)
-	if w.uplinkCounter != nil || w.downlinkCounter != nil {
-		conn = &internet.StatCouterConnection{
-			Connection:   conn,
-			ReadCounter:  w.uplinkCounter,
-			WriteCounter: w.downlinkCounter,
-		}
-	}
+	conn = internet.NewStatCouterConnection(conn, w.uplinkCounter, w.downlinkCounter)
 	if err := w.proxy.Process(ctx, net.Network_UNIX, conn, w.dispatcher); err != nil {
 		newError("connection ends").Base(err).WriteToLog(session.ExportIDToError(ctx))
 	}
@@ -453,10 +599,16 @@ func (w *dsWorker) Proxy() proxy.Inbound {
 func (w *dsWorker) Port() net.Port {
 	return net.Port(0)
 }
+
+func (w *dsWorker) Address() net.Address {
+	return w.address
+}
 func (w *dsWorker) Start() error {
-	ctx := context.Background()
+	ctx := internet.ContextWithTransportStats(context.Background(), w.transportStats)
 	hub, err := internet.ListenUnix(ctx, w.address, w.stream, func(conn internet.Connection) {
-		go w.callback(conn)
+		w.sessions.Go(func() {
+			w.callback(conn)
+		})
 	})
 	if err != nil {
 		return newError("failed to listen Unix Domain Socket on ", w.address).AtWarning().Base(err)
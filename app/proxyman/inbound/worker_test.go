@@ -0,0 +1,201 @@
+package inbound
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"v2ray.com/core/app/proxyman"
+	"v2ray.com/core/common"
+	"v2ray.com/core/common/buf"
+	"v2ray.com/core/common/net"
+	"v2ray.com/core/features/routing"
+	"v2ray.com/core/transport/internet"
+	_ "v2ray.com/core/transport/internet/tcp"
+)
+
+// countingInbound closes the connections it processes, and counts them.
+type countingInbound struct {
+	processed int32
+}
+
+func (p *countingInbound) Network() []net.Network {
+	return []net.Network{net.Network_TCP}
+}
+
+func (p *countingInbound) Process(ctx context.Context, network net.Network, conn internet.Connection, dispatcher routing.Dispatcher) error {
+	atomic.AddInt32(&p.processed, 1)
+	return nil
+}
+
+func TestTCPWorkerListenerSharding(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	common.Must(err)
+	port := net.Port(l.Addr().(*net.TCPAddr).Port)
+	common.Must(l.Close())
+
+	p := new(countingInbound)
+	sessions := proxyman.NewSessionTracker(nil, nil, nil)
+	worker := &tcpWorker{
+		address:   net.LocalHostIP,
+		port:      port,
+		proxy:     p,
+		tag:       "sharded",
+		sessions:  sessions,
+		listeners: 4,
+		ctx:       context.Background(),
+	}
+	common.Must(worker.Start())
+	if len(worker.hubs) != 4 {
+		t.Fatal("expected 4 listeners, but got ", len(worker.hubs))
+	}
+
+	const conns = 32
+	for i := 0; i < conns; i++ {
+		conn, err := net.Dial("tcp", net.TCPDestination(net.LocalHostIP, port).NetAddr())
+		common.Must(err)
+		conn.Close()
+	}
+	for i := 0; i < 100 && atomic.LoadInt32(&p.processed) < conns; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if v := atomic.LoadInt32(&p.processed); v != conns {
+		t.Error("expected ", conns, " connections processed, but got ", v)
+	}
+	if v := sessions.Snapshot(0).Total; v != conns {
+		t.Error("expected ", conns, " sessions, but got ", v)
+	}
+
+	common.Must(worker.Close())
+	if conn, err := net.Dial("tcp", net.TCPDestination(net.LocalHostIP, port).NetAddr()); err == nil {
+		conn.Close()
+		t.Error("expected all listeners to be closed")
+	}
+}
+
+// echoInbound echoes the first two packets of each UDP session, and ends the session.
+type echoInbound struct{}
+
+func (echoInbound) Network() []net.Network {
+	return []net.Network{net.Network_UDP}
+}
+
+func (echoInbound) Process(ctx context.Context, network net.Network, conn internet.Connection, dispatcher routing.Dispatcher) error {
+	reader := conn.(buf.Reader)
+	for i := 0; i < 2; i++ {
+		mb, err := reader.ReadMultiBuffer()
+		if err != nil {
+			return err
+		}
+		for _, b := range mb {
+			if _, err := conn.Write(b.Bytes()); err != nil {
+				buf.ReleaseMulti(mb)
+				return err
+			}
+		}
+		buf.ReleaseMulti(mb)
+	}
+	return nil
+}
+
+func TestUDPWorkerDrain(t *testing.T) {
+	l, err := net.ListenUDP("udp", &net.UDPAddr{IP: []byte{127, 0, 0, 1}})
+	common.Must(err)
+	port := net.Port(l.LocalAddr().(*net.UDPAddr).Port)
+	common.Must(l.Close())
+
+	worker := &udpWorker{
+		address:  net.LocalHostIP,
+		port:     port,
+		proxy:    echoInbound{},
+		tag:      "draining",
+		sessions: proxyman.NewSessionTracker(nil, nil, nil),
+	}
+	common.Must(worker.Start())
+
+	dial := func() *net.UDPConn {
+		conn, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: []byte{127, 0, 0, 1}, Port: int(port)})
+		common.Must(err)
+		return conn
+	}
+	echoed := func(conn *net.UDPConn) bool {
+		common.Must2(conn.Write([]byte("ping")))
+		common.Must(conn.SetReadDeadline(time.Now().Add(500 * time.Millisecond)))
+		n, err := conn.Read(make([]byte, 16))
+		return err == nil && n == 4
+	}
+
+	live := dial()
+	defer live.Close()
+	if !echoed(live) {
+		t.Fatal("expected the packet echoed")
+	}
+
+	drained := make(chan struct{})
+	worker.drain(func() { close(drained) })
+
+	// New sessions are refused, while the live session is still served.
+	other := dial()
+	defer other.Close()
+	if echoed(other) {
+		t.Error("expected new session refused by draining worker")
+	}
+	if !echoed(live) {
+		t.Error("expected live session served by draining worker")
+	}
+
+	// The worker is closed once the live session ends.
+	select {
+	case <-drained:
+	case <-time.After(2 * time.Second):
+		t.Fatal("worker is not closed after its sessions end")
+	}
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: []byte{127, 0, 0, 1}, Port: int(port)})
+	if err != nil {
+		t.Fatal("port is not released: ", err)
+	}
+	conn.Close()
+}
+
+func TestUDPWorkerMaxSessions(t *testing.T) {
+	l, err := net.ListenUDP("udp", &net.UDPAddr{IP: []byte{127, 0, 0, 1}})
+	common.Must(err)
+	port := net.Port(l.LocalAddr().(*net.UDPAddr).Port)
+	common.Must(l.Close())
+
+	worker := &udpWorker{
+		address:     net.LocalHostIP,
+		port:        port,
+		proxy:       echoInbound{},
+		tag:         "limited",
+		sessions:    proxyman.NewSessionTracker(nil, nil, nil),
+		maxSessions: 1,
+	}
+	common.Must(worker.Start())
+	defer worker.Close()
+
+	echoed := func(conn *net.UDPConn) bool {
+		common.Must2(conn.Write([]byte("ping")))
+		common.Must(conn.SetReadDeadline(time.Now().Add(500 * time.Millisecond)))
+		n, err := conn.Read(make([]byte, 16))
+		return err == nil && n == 4
+	}
+
+	first, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: []byte{127, 0, 0, 1}, Port: int(port)})
+	common.Must(err)
+	defer first.Close()
+	second, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: []byte{127, 0, 0, 1}, Port: int(port)})
+	common.Must(err)
+	defer second.Close()
+
+	if !echoed(first) {
+		t.Fatal("expected the packet echoed")
+	}
+	if echoed(second) {
+		t.Error("expected the session over the limit dropped")
+	}
+	if !echoed(first) {
+		t.Error("expected the first session still served")
+	}
+}
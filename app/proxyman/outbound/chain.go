@@ -0,0 +1,23 @@
+package outbound
+
+import (
+	"context"
+
+	"v2ray.com/core/common/net"
+	"v2ray.com/core/features/outbound"
+	"v2ray.com/core/transport/internet"
+)
+
+// chainDialer is a system dialer for transports layered over connections through another
+// outbound handler.
+type chainDialer struct {
+	// ctx is the context of the session, without the dialer itself, so that the handler doesn't
+	// dial through itself.
+	ctx     context.Context
+	handler outbound.Handler
+}
+
+// Dial implements internet.SystemDialer.
+func (d *chainDialer) Dial(_ context.Context, _ net.Address, dest net.Destination, _ *internet.SocketConfig) (net.Conn, error) {
+	return outbound.Dial(d.ctx, d.handler, dest), nil
+}
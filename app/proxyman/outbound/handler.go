@@ -2,13 +2,19 @@ package outbound
 
 import (
 	"context"
+	"sync/atomic"
+	"time"
 
 	"v2ray.com/core"
 	"v2ray.com/core/app/proxyman"
 	"v2ray.com/core/common"
+	"v2ray.com/core/common/buf"
+	"v2ray.com/core/common/errors"
 	"v2ray.com/core/common/mux"
 	"v2ray.com/core/common/net"
 	"v2ray.com/core/common/session"
+	"v2ray.com/core/common/task"
+	"v2ray.com/core/features/dns"
 	"v2ray.com/core/features/outbound"
 	"v2ray.com/core/features/policy"
 	"v2ray.com/core/features/stats"
@@ -16,7 +22,6 @@ import (
 	"v2ray.com/core/transport"
 	"v2ray.com/core/transport/internet"
 	"v2ray.com/core/transport/internet/tls"
-	"v2ray.com/core/transport/pipe"
 )
 
 func getStatCounter(v *core.Instance, tag string) (stats.Counter, stats.Counter) {
@@ -52,8 +57,20 @@ type Handler struct {
 	proxy           proxy.Outbound
 	outboundManager outbound.Manager
 	mux             *mux.ClientManager
+	muxBypass       muxBypass
+	pool            *connectionPool
+	viaPool         *viaPool
+	dns             dns.Client
 	uplinkCounter   stats.Counter
 	downlinkCounter stats.Counter
+	health          stats.HealthRecorder
+	sessions        *proxyman.SessionTracker
+	transportStats  *internet.TransportStats
+	// recycle limits the transport connections shared by sessions, such as those of HTTP/2 and QUIC.
+	recycle *internet.ConnectionRecycle
+	// udpMaxPacketSize is the size limit of UDP packets to send, or zero for no limit.
+	udpMaxPacketSize int32
+	udpDropped       stats.Counter
 }
 
 // NewHandler create a new Handler based on the given configuration.
@@ -66,6 +83,15 @@ func NewHandler(ctx context.Context, config *core.OutboundHandlerConfig) (outbou
 		uplinkCounter:   uplinkCounter,
 		downlinkCounter: downlinkCounter,
 	}
+	statsManager, _ := v.GetFeature(stats.ManagerType()).(stats.Manager)
+	policyManager := v.GetFeature(policy.ManagerType()).(policy.Manager)
+	h.sessions = proxyman.NewSessionTrackerWithStats(statsManager, "outbound", config.Tag, policyManager.ForSystem().Stats.OutboundSessions)
+	if policyManager.ForSystem().Stats.Transport {
+		h.transportStats = internet.NewTransportStats(statsManager)
+	}
+	if health, ok := v.GetFeature(stats.ManagerType()).(stats.HealthRecorder); ok && len(config.Tag) > 0 {
+		h.health = health
+	}
 
 	if config.SenderSettings != nil {
 		senderSettings, err := config.SenderSettings.GetInstance()
@@ -75,11 +101,22 @@ func NewHandler(ctx context.Context, config *core.OutboundHandlerConfig) (outbou
 		switch s := senderSettings.(type) {
 		case *proxyman.SenderConfig:
 			h.senderSettings = s
-			mss, err := internet.ToMemoryStreamConfig(s.StreamSettings)
+			mss, err := internet.ToMemoryStreamConfigWithContext(ctx, s.StreamSettings)
 			if err != nil {
 				return nil, newError("failed to parse stream settings").Base(err).AtWarning()
 			}
 			h.streamSettings = mss
+			h.udpMaxPacketSize = udpMaxPacketSize(s)
+			if h.udpMaxPacketSize > 0 && len(h.tag) > 0 && statsManager != nil {
+				h.udpDropped, _ = stats.GetOrRegisterCounter(statsManager, "outbound>>>"+h.tag+">>>udp>>>dropped")
+			}
+			if s.ViaPool != nil {
+				pool, err := newViaPool(s.ViaPool)
+				if err != nil {
+					return nil, err
+				}
+				h.viaPool = pool
+			}
 		default:
 			return nil, newError("settings is not SenderConfig")
 		}
@@ -90,7 +127,7 @@ func NewHandler(ctx context.Context, config *core.OutboundHandlerConfig) (outbou
 		return nil, err
 	}
 
-	rawProxyHandler, err := common.CreateObject(ctx, proxyConfig)
+	rawProxyHandler, err := common.CreateObject(session.ContextWithHandlerTag(ctx, config.Tag), proxyConfig)
 	if err != nil {
 		return nil, err
 	}
@@ -105,21 +142,60 @@ func NewHandler(ctx context.Context, config *core.OutboundHandlerConfig) (outbou
 		if config.Concurrency < 1 || config.Concurrency > 1024 {
 			return nil, newError("invalid mux concurrency: ", config.Concurrency).AtWarning()
 		}
+		bypass, err := newMuxBypass(config.Bypass)
+		if err != nil {
+			return nil, err
+		}
+		h.muxBypass = bypass
+		strategy := mux.ClientStrategy{
+			MaxConcurrency: config.Concurrency,
+			MaxConnection:  128,
+		}
+		if recycle := config.ConnectionRecycle; recycle != nil {
+			strategy.MaxLifetime = time.Duration(recycle.MaxLifetime) * time.Second
+			strategy.MaxBytes = recycle.MaxBytes
+			if len(h.tag) > 0 && statsManager != nil {
+				strategy.Recycles, _ = stats.GetOrRegisterCounter(statsManager, "outbound>>>"+h.tag+">>>mux>>>recycled")
+			}
+			h.recycle = &internet.ConnectionRecycle{
+				MaxLifetime: strategy.MaxLifetime,
+				MaxBytes:    strategy.MaxBytes,
+				Recycles:    strategy.Recycles,
+			}
+		}
 		h.mux = &mux.ClientManager{
 			Enabled: h.senderSettings.MultiplexSettings.Enabled,
 			Picker: &mux.IncrementalWorkerPicker{
 				Factory: &mux.DialingWorkerFactory{
-					Proxy:  proxyHandler,
-					Dialer: h,
-					Strategy: mux.ClientStrategy{
-						MaxConcurrency: config.Concurrency,
-						MaxConnection:  128,
-					},
+					Proxy:    proxyHandler,
+					Dialer:   h,
+					Strategy: strategy,
 				},
 			},
 		}
 	}
 
+	if h.senderSettings != nil && h.senderSettings.PreconnectSettings != nil && h.senderSettings.PreconnectSettings.Size > 0 {
+		config := h.senderSettings.PreconnectSettings
+		if config.MuxOnly && h.mux == nil {
+			return nil, newError("preconnecting Mux connections requires Mux settings").AtWarning()
+		}
+		h.pool = newConnectionPool(ctx, config, h.dialTransport)
+	}
+
+	if h.senderSettings != nil && len(h.senderSettings.DnsServerTag) > 0 {
+		if err := core.RequireFeatures(ctx, func(d dns.Client) error {
+			client, err := dns.ClientWithServerTag(d, h.senderSettings.DnsServerTag)
+			if err != nil {
+				return newError("failed to select DNS servers").Base(err)
+			}
+			h.dns = client
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+
 	h.proxy = proxyHandler
 	return h, nil
 }
@@ -129,15 +205,68 @@ func (h *Handler) Tag() string {
 	return h.tag
 }
 
+// Sessions implements proxyman.SessionReporter. Sessions handed to Mux end when Mux closes their links.
+func (h *Handler) Sessions() *proxyman.SessionTracker {
+	return h.sessions
+}
+
 // Dispatch implements proxy.Outbound.Dispatch.
 func (h *Handler) Dispatch(ctx context.Context, link *transport.Link) {
-	if h.mux != nil && (h.mux.Enabled || session.MuxPreferedFromContext(ctx)) {
+	endSession := h.sessions.Begin()
+	// The dispatcher runs Dispatch in a goroutine of its own for the session.
+	h.sessions.AddGoroutines(1)
+	defer h.sessions.AddGoroutines(-1)
+	ctx = task.ContextWithGoroutineCounter(ctx, h.sessions)
+
+	if outbound := session.OutboundFromContext(ctx); h.udpMaxPacketSize > 0 && outbound != nil && outbound.Target.Network == net.Network_UDP {
+		link = &transport.Link{
+			Reader: &udpLimitReader{
+				Reader:  link.Reader,
+				ctx:     ctx,
+				max:     h.udpMaxPacketSize,
+				dns:     outbound.Target.Port == 53,
+				dropped: h.udpDropped,
+			},
+			Writer: link.Writer,
+		}
+	}
+
+	if attributes := routeAttributes(ctx); attributes != nil && attributes.FirstByteTimeout > 0 {
+		watcher := &downlinkWatcher{Writer: link.Writer}
+		reader := link.Reader
+		link = &transport.Link{Reader: reader, Writer: watcher}
+		timeout := attributes.FirstByteTimeout
+		// The timer is stopped by the watcher, as sessions handed to Mux outlive Dispatch.
+		watcher.timer = time.AfterFunc(timeout, func() {
+			if !watcher.Received() {
+				newError("no response in ", timeout, " as set by the route of rule [", session.OutboundFromContext(ctx).RuleTag, "]").AtInfo().WriteToLog(session.ExportIDToError(ctx))
+				common.Interrupt(watcher)
+				common.Interrupt(reader)
+			}
+		})
+	}
+
+	if h.useMux(ctx) {
+		// Mux runs the session after Dispatch returns, so it ends when Mux closes the downlink.
+		link = &transport.Link{Reader: link.Reader, Writer: &sessionEndWriter{Writer: link.Writer, end: endSession}}
 		if err := h.mux.Dispatch(ctx, link); err != nil {
 			newError("failed to process mux outbound traffic").Base(err).WriteToLog(session.ExportIDToError(ctx))
 			common.Interrupt(link.Writer)
+			// Unblock the writer of the link as well, which may be an outbound chained to this one.
+			common.Interrupt(link.Reader)
 		}
 	} else {
-		if err := h.proxy.Process(ctx, link, h); err != nil {
+		defer endSession()
+		var watcher *downlinkWatcher
+		if h.health != nil {
+			watcher = &downlinkWatcher{Writer: link.Writer}
+			link = &transport.Link{Reader: link.Reader, Writer: watcher}
+		}
+		err := h.proxy.Process(ctx, link, h)
+		if watcher != nil {
+			h.health.RecordSession(h.tag, err != nil && !watcher.Received())
+		}
+		if err != nil {
 			// Ensure outbound ray is properly closed.
 			newError("failed to process outbound traffic").Base(err).WriteToLog(session.ExportIDToError(ctx))
 			common.Interrupt(link.Writer)
@@ -148,14 +277,37 @@ func (h *Handler) Dispatch(ctx context.Context, link *transport.Link) {
 	}
 }
 
+// useMux returns whether the session is dispatched to Mux. Sessions matching the bypass rules skip Mux
+// enabled by config, but not Mux preferred by the context.
+func (h *Handler) useMux(ctx context.Context) bool {
+	if h.mux == nil {
+		return false
+	}
+	if session.MuxPreferedFromContext(ctx) {
+		return true
+	}
+	return h.mux.Enabled && !h.muxBypass.Apply(ctx)
+}
+
 // Address implements internet.Dialer.
 func (h *Handler) Address() net.Address {
+	if h.viaPool != nil {
+		return h.viaPool.First()
+	}
 	if h.senderSettings == nil || h.senderSettings.Via == nil {
 		return nil
 	}
 	return h.senderSettings.Via.AsAddress()
 }
 
+// SocketSettings implements internet.SocketSettingsDialer.
+func (h *Handler) SocketSettings() *internet.SocketConfig {
+	if h.streamSettings == nil {
+		return nil
+	}
+	return h.streamSettings.SocketSettings
+}
+
 // Dial implements internet.Dialer.
 func (h *Handler) Dial(ctx context.Context, dest net.Destination) (internet.Connection, error) {
 	if h.senderSettings != nil {
@@ -164,20 +316,21 @@ func (h *Handler) Dial(ctx context.Context, dest net.Destination) (internet.Conn
 			handler := h.outboundManager.GetHandler(tag)
 			if handler != nil {
 				newError("proxying to ", tag, " for dest ", dest).AtDebug().WriteToLog(session.ExportIDToError(ctx))
-				ctx = session.ContextWithOutbound(ctx, &session.Outbound{
-					Target: dest,
-				})
-
-				opts := pipe.OptionsFromContext(ctx)
-				uplinkReader, uplinkWriter := pipe.New(opts...)
-				downlinkReader, downlinkWriter := pipe.New(opts...)
 
-				go handler.Dispatch(ctx, &transport.Link{Reader: uplinkReader, Writer: downlinkWriter})
-				conn := net.NewConnection(net.ConnectionInputMulti(uplinkWriter), net.ConnectionOutputMulti(downlinkReader))
+				if h.senderSettings.ProxySettings.TransportLayer {
+					dialCtx := internet.ContextWithSystemDialer(h.withHandshakeTimeout(ctx), &chainDialer{ctx: ctx, handler: handler})
+					dialCtx = internet.ContextWithTransportStats(dialCtx, h.transportStats)
+					dialCtx = internet.ContextWithConnectionRecycle(dialCtx, h.recycle)
+					conn, err := internet.Dial(dialCtx, dest, h.streamSettings)
+					if err != nil {
+						return nil, h.handshakeError(ctx, err)
+					}
+					return h.getStatCouterConnection(conn), nil
+				}
 
+				conn := outbound.Dial(ctx, handler, dest)
 				if config := tls.ConfigFromStreamSettings(h.streamSettings); config != nil {
-					tlsConfig := config.GetTLSConfig(tls.WithDestination(dest))
-					conn = tls.Client(conn, tlsConfig)
+					conn = config.Client(conn, tls.WithDestination(dest))
 				}
 
 				return h.getStatCouterConnection(conn), nil
@@ -185,30 +338,158 @@ func (h *Handler) Dial(ctx context.Context, dest net.Destination) (internet.Conn
 
 			newError("failed to get outbound handler with tag: ", tag).AtWarning().WriteToLog(session.ExportIDToError(ctx))
 		}
+	}
 
-		if h.senderSettings.Via != nil {
-			outbound := session.OutboundFromContext(ctx)
-			if outbound == nil {
-				outbound = new(session.Outbound)
-				ctx = session.ContextWithOutbound(ctx, outbound)
-			}
-			outbound.Gateway = h.senderSettings.Via.AsAddress()
+	if h.pool != nil && h.pool.accepts(ctx) {
+		if conn := h.pool.Get(dest); conn != nil {
+			newError("using preconnected connection to ", dest).AtDebug().WriteToLog(session.ExportIDToError(ctx))
+			return h.getStatCouterConnection(conn), nil
 		}
 	}
 
-	conn, err := internet.Dial(ctx, dest, h.streamSettings)
+	conn, err := h.dialTransport(ctx, dest)
+	if attributes := routeAttributes(ctx); attributes != nil {
+		for retry := uint32(1); err != nil && retry <= attributes.Retries && ctx.Err() == nil; retry++ {
+			newError("failed to dial ", dest, ", retrying (", retry, "/", attributes.Retries, ")").Base(err).WriteToLog(session.ExportIDToError(ctx))
+			conn, err = h.dialTransport(ctx, dest)
+		}
+	}
 	return h.getStatCouterConnection(conn), err
 }
 
-func (h *Handler) getStatCouterConnection(conn internet.Connection) internet.Connection {
-	if h.uplinkCounter != nil || h.downlinkCounter != nil {
-		return &internet.StatCouterConnection{
-			Connection:   conn,
-			ReadCounter:  h.downlinkCounter,
-			WriteCounter: h.uplinkCounter,
+func (h *Handler) dialTransport(ctx context.Context, dest net.Destination) (internet.Connection, error) {
+	if h.viaPool != nil {
+		return h.dialFromPool(ctx, dest)
+	}
+	if h.senderSettings != nil && h.senderSettings.Via != nil {
+		outbound := session.OutboundFromContext(ctx)
+		if outbound == nil {
+			outbound = new(session.Outbound)
+			ctx = session.ContextWithOutbound(ctx, outbound)
+		}
+		outbound.Gateway = h.senderSettings.Via.AsAddress()
+	}
+	return h.dialFrom(ctx, dest)
+}
+
+// dialFromPool dials from an address of the send through pool. Addresses that can't be bound are
+// skipped.
+func (h *Handler) dialFromPool(ctx context.Context, dest net.Destination) (internet.Connection, error) {
+	outbound := session.OutboundFromContext(ctx)
+	if outbound == nil {
+		outbound = new(session.Outbound)
+		ctx = session.ContextWithOutbound(ctx, outbound)
+	}
+	for attempts := h.viaPool.Size(); attempts > 0; attempts-- {
+		via := h.viaPool.Pick()
+		if via == nil {
+			break
+		}
+		outbound.Gateway = via
+		conn, err := h.dialFrom(ctx, dest)
+		if err == nil {
+			h.viaPool.RecordSuccess(via)
+			return conn, nil
+		}
+		if !isBindError(err) {
+			return nil, err
+		}
+		newError("failed to send through ", via).Base(err).AtWarning().WriteToLog(session.ExportIDToError(ctx))
+		h.viaPool.RecordBindFailure(via)
+	}
+	return nil, newError("no address available to send through")
+}
+
+func (h *Handler) dialFrom(ctx context.Context, dest net.Destination) (internet.Connection, error) {
+	if h.dns != nil {
+		// Domains are resolved by the system dialer, so that transports still see them.
+		ctx = internet.ContextWithLookupIP(ctx, h.lookupIP)
+	}
+
+	start := time.Now()
+	dialCtx := internet.ContextWithTransportStats(h.withHandshakeTimeout(ctx), h.transportStats)
+	dialCtx = internet.ContextWithConnectionRecycle(dialCtx, h.recycle)
+	conn, err := internet.Dial(dialCtx, dest, h.streamSettings)
+	if h.health != nil {
+		h.health.RecordDial(h.tag, time.Since(start), err)
+	}
+	if err != nil {
+		return nil, h.handshakeError(ctx, err)
+	}
+	return conn, nil
+}
+
+// routeAttributes returns the attributes of the route of the session in ctx, if any.
+func routeAttributes(ctx context.Context) *session.RouteAttributes {
+	if outbound := session.OutboundFromContext(ctx); outbound != nil {
+		return outbound.RouteAttributes
+	}
+	return nil
+}
+
+func (h *Handler) handshakeTimeout() time.Duration {
+	if h.streamSettings == nil {
+		return 0
+	}
+	return h.streamSettings.HandshakeTimeout
+}
+
+// withHandshakeTimeout returns a context in which the dial completes within the handshake timeout of the
+// route or the handler, if there is one.
+func (h *Handler) withHandshakeTimeout(ctx context.Context) context.Context {
+	if attributes := routeAttributes(ctx); attributes != nil && attributes.HandshakeTimeout > 0 {
+		return internet.ContextWithHandshakeTimeout(ctx, attributes.HandshakeTimeout)
+	}
+	if timeout := h.handshakeTimeout(); timeout > 0 {
+		return internet.ContextWithHandshakeTimeout(ctx, timeout)
+	}
+	return ctx
+}
+
+// handshakeError tells which timeout applied, if err is a timeout of the dial.
+func (h *Handler) handshakeError(ctx context.Context, err error) error {
+	cause := errors.Cause(err)
+	if nerr, ok := cause.(net.Error); !(ok && nerr.Timeout()) && cause != context.DeadlineExceeded {
+		return err
+	}
+	if attributes := routeAttributes(ctx); attributes != nil && attributes.HandshakeTimeout > 0 {
+		return newError("handshake timed out after ", attributes.HandshakeTimeout, " as set by the route of rule [", session.OutboundFromContext(ctx).RuleTag, "]").Base(err).WithKind(errors.KindUnreachable)
+	}
+	if timeout := h.handshakeTimeout(); timeout > 0 {
+		return newError("handshake timed out after ", timeout, " as set by handshakeTimeout of outbound [", h.tag, "]").Base(err).WithKind(errors.KindUnreachable)
+	}
+	return newError("handshake timed out by the default timeout of the transport").Base(err).WithKind(errors.KindUnreachable)
+}
+
+// lookupIP resolves domain with the selected name servers, for the family of the sending address
+// if there is one.
+func (h *Handler) lookupIP(domain string) ([]net.IP, error) {
+	lookupFunc := h.dns.LookupIP
+	if via := h.Address(); via != nil {
+		switch {
+		case via.Family().IsIPv4():
+			if lookupIPv4, ok := h.dns.(dns.IPv4Lookup); ok {
+				lookupFunc = lookupIPv4.LookupIPv4
+			}
+		case via.Family().IsIPv6():
+			if lookupIPv6, ok := h.dns.(dns.IPv6Lookup); ok {
+				lookupFunc = lookupIPv6.LookupIPv6
+			}
 		}
 	}
-	return conn
+
+	ips, err := lookupFunc(domain)
+	if err != nil {
+		return nil, err
+	}
+	if len(ips) == 0 {
+		return nil, dns.ErrEmptyResponse
+	}
+	return ips, nil
+}
+
+func (h *Handler) getStatCouterConnection(conn internet.Connection) internet.Connection {
+	return internet.NewStatCouterConnection(conn, h.downlinkCounter, h.uplinkCounter)
 }
 
 // GetOutbound implements proxy.GetOutbound.
@@ -218,11 +499,72 @@ func (h *Handler) GetOutbound() proxy.Outbound {
 
 // Start implements common.Runnable.
 func (h *Handler) Start() error {
+	if h.pool != nil {
+		return h.pool.Start()
+	}
 	return nil
 }
 
 // Close implements common.Closable.
 func (h *Handler) Close() error {
 	common.Close(h.mux)
+	if h.pool != nil {
+		common.Close(h.pool)
+	}
 	return nil
 }
+
+// downlinkWatcher notes whether any data was written to the downlink of a session.
+type downlinkWatcher struct {
+	buf.Writer
+	received int32
+	// timer, if not nil, is stopped once the first byte is received or the link ends.
+	timer *time.Timer
+}
+
+func (w *downlinkWatcher) stopTimer() {
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+}
+
+func (w *downlinkWatcher) WriteMultiBuffer(mb buf.MultiBuffer) error {
+	if !mb.IsEmpty() && atomic.CompareAndSwapInt32(&w.received, 0, 1) {
+		w.stopTimer()
+	}
+	return w.Writer.WriteMultiBuffer(mb)
+}
+
+func (w *downlinkWatcher) Received() bool {
+	return atomic.LoadInt32(&w.received) == 1
+}
+
+// Close implements common.Closable.
+func (w *downlinkWatcher) Close() error {
+	w.stopTimer()
+	return common.Close(w.Writer)
+}
+
+// Interrupt implements common.Interruptible.
+func (w *downlinkWatcher) Interrupt() {
+	w.stopTimer()
+	common.Interrupt(w.Writer)
+}
+
+// sessionEndWriter ends the session of a link once the downlink of the link is closed.
+type sessionEndWriter struct {
+	buf.Writer
+	end func()
+}
+
+// Close implements common.Closable.
+func (w *sessionEndWriter) Close() error {
+	w.end()
+	return common.Close(w.Writer)
+}
+
+// Interrupt implements common.Interruptible.
+func (w *sessionEndWriter) Interrupt() {
+	w.end()
+	common.Interrupt(w.Writer)
+}
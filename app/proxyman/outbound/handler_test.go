@@ -2,17 +2,33 @@ package outbound_test
 
 import (
 	"context"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
 
 	"v2ray.com/core"
 	"v2ray.com/core/app/policy"
+	"v2ray.com/core/app/proxyman"
 	. "v2ray.com/core/app/proxyman/outbound"
 	"v2ray.com/core/app/stats"
+	"v2ray.com/core/common"
+	"v2ray.com/core/common/buf"
 	"v2ray.com/core/common/net"
+	"v2ray.com/core/common/protocol"
 	"v2ray.com/core/common/serial"
+	"v2ray.com/core/common/session"
 	"v2ray.com/core/features/outbound"
+	feature_stats "v2ray.com/core/features/stats"
 	"v2ray.com/core/proxy/freedom"
+	"v2ray.com/core/transport"
 	"v2ray.com/core/transport/internet"
+	_ "v2ray.com/core/transport/internet/tcp"
+	"v2ray.com/core/transport/internet/tls"
+	_ "v2ray.com/core/transport/internet/udp"
+	"v2ray.com/core/transport/pipe"
 )
 
 func TestInterfaces(t *testing.T) {
@@ -78,3 +94,385 @@ func TestOutboundWithStatCounter(t *testing.T) {
 		t.Errorf("Expected conn to be StatCouterConnection")
 	}
 }
+
+func TestOutboundPreconnect(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	common.Must(err)
+	defer listener.Close()
+
+	var accepted int32
+	go func() {
+		for {
+			if _, err := listener.Accept(); err != nil {
+				return
+			}
+			atomic.AddInt32(&accepted, 1)
+		}
+	}()
+
+	v, _ := core.New(&core.Config{})
+	v.AddFeature((outbound.Manager)(new(Manager)))
+	ctx := context.WithValue(context.Background(), v2rayKey, v)
+	h, err := NewHandler(ctx, &core.OutboundHandlerConfig{
+		Tag: "tag",
+		SenderSettings: serial.ToTypedMessage(&proxyman.SenderConfig{
+			PreconnectSettings: &proxyman.PreconnectConfig{
+				Size: 2,
+			},
+		}),
+		ProxySettings: serial.ToTypedMessage(&freedom.Config{}),
+	})
+	common.Must(err)
+	common.Must(h.Start())
+	defer h.Close()
+
+	dest := net.DestinationFromAddr(listener.Addr())
+	conn, err := h.(*Handler).Dial(ctx, dest)
+	common.Must(err)
+	defer conn.Close()
+
+	time.Sleep(time.Millisecond * 500)
+	if v := atomic.LoadInt32(&accepted); v != 3 {
+		t.Error("expected 1 dialed and 2 preconnected connections, but got ", v)
+	}
+
+	pooled, err := h.(*Handler).Dial(ctx, dest)
+	common.Must(err)
+	defer pooled.Close()
+
+	time.Sleep(time.Millisecond * 500)
+	if v := atomic.LoadInt32(&accepted); v != 4 {
+		t.Error("expected the pool to be refilled, but got ", v, " connections")
+	}
+}
+
+func TestOutboundMuxBypass(t *testing.T) {
+	var listeners [2]net.Listener
+	var accepted [2]int32
+	for i := range listeners {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		common.Must(err)
+		defer listener.Close()
+		listeners[i] = listener
+
+		counter := &accepted[i]
+		go func() {
+			for {
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+				atomic.AddInt32(counter, 1)
+				conn.Close()
+			}
+		}()
+	}
+
+	bypassed := net.DestinationFromAddr(listeners[0].Addr())
+	muxed := net.DestinationFromAddr(listeners[1].Addr())
+
+	v, _ := core.New(&core.Config{})
+	v.AddFeature((outbound.Manager)(new(Manager)))
+	ctx := context.WithValue(context.Background(), v2rayKey, v)
+	h, err := NewHandler(ctx, &core.OutboundHandlerConfig{
+		Tag: "tag",
+		SenderSettings: serial.ToTypedMessage(&proxyman.SenderConfig{
+			MultiplexSettings: &proxyman.MultiplexingConfig{
+				Enabled:     true,
+				Concurrency: 8,
+				Bypass: []*proxyman.MuxBypassRule{
+					{
+						Networks: []net.Network{net.Network_TCP},
+						PortList: &net.PortList{Range: []*net.PortRange{net.SinglePortRange(bypassed.Port)}},
+					},
+				},
+			},
+		}),
+		ProxySettings: serial.ToTypedMessage(&freedom.Config{}),
+	})
+	common.Must(err)
+	common.Must(h.Start())
+	defer h.Close()
+
+	for _, dest := range []net.Destination{bypassed, muxed} {
+		uplinkReader, uplinkWriter := pipe.New()
+		downlinkReader, downlinkWriter := pipe.New()
+		sessionCtx := session.ContextWithOutbound(ctx, &session.Outbound{Target: dest})
+		go h.Dispatch(sessionCtx, &transport.Link{Reader: uplinkReader, Writer: downlinkWriter})
+		defer common.Interrupt(uplinkWriter)
+		defer common.Interrupt(downlinkReader)
+	}
+
+	time.Sleep(time.Millisecond * 500)
+	if v := atomic.LoadInt32(&accepted[0]); v != 1 {
+		t.Error("expected the bypassed session to connect directly, but got ", v, " connections")
+	}
+	// The muxed session is sent to the Mux destination, which freedom fails to reach.
+	if v := atomic.LoadInt32(&accepted[1]); v != 0 {
+		t.Error("expected the muxed session not to connect directly, but got ", v, " connections")
+	}
+}
+
+func TestOutboundHandshakeTimeout(t *testing.T) {
+	// The server accepts connections, but never completes TLS handshakes.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	common.Must(err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	v, err := core.New(&core.Config{})
+	common.Must(err)
+	v.AddFeature((outbound.Manager)(new(Manager)))
+	ctx := context.WithValue(context.Background(), v2rayKey, v)
+	h, err := NewHandler(ctx, &core.OutboundHandlerConfig{
+		Tag: "slow",
+		SenderSettings: serial.ToTypedMessage(&proxyman.SenderConfig{
+			StreamSettings: &internet.StreamConfig{
+				SecurityType: serial.GetMessageType(&tls.Config{}),
+				SecuritySettings: []*serial.TypedMessage{
+					serial.ToTypedMessage(&tls.Config{AllowInsecure: true}),
+				},
+				HandshakeTimeout: 1,
+			},
+		}),
+		ProxySettings: serial.ToTypedMessage(&freedom.Config{}),
+	})
+	common.Must(err)
+
+	start := time.Now()
+	_, err = h.(*Handler).Dial(ctx, net.DestinationFromAddr(listener.Addr()))
+	if err == nil {
+		t.Fatal("expected handshake to time out")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second*3 {
+		t.Error("handshake took ", elapsed)
+	}
+	if !strings.Contains(err.Error(), "handshakeTimeout of outbound [slow]") {
+		t.Error("unexpected error: ", err)
+	}
+}
+
+func TestOutboundRouteAttributes(t *testing.T) {
+	// The server accepts connections, but never completes TLS handshakes, nor responds.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	common.Must(err)
+	defer listener.Close()
+	var accepted int32
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&accepted, 1)
+			defer conn.Close()
+		}
+	}()
+	dest := net.DestinationFromAddr(listener.Addr())
+
+	v, err := core.New(&core.Config{})
+	common.Must(err)
+	v.AddFeature((outbound.Manager)(new(Manager)))
+	ctx := context.WithValue(context.Background(), v2rayKey, v)
+	newHandler := func(streamSettings *internet.StreamConfig) *Handler {
+		h, err := NewHandler(ctx, &core.OutboundHandlerConfig{
+			Tag: "slow",
+			SenderSettings: serial.ToTypedMessage(&proxyman.SenderConfig{
+				StreamSettings: streamSettings,
+			}),
+			ProxySettings: serial.ToTypedMessage(&freedom.Config{}),
+		})
+		common.Must(err)
+		return h.(*Handler)
+	}
+
+	h := newHandler(&internet.StreamConfig{
+		SecurityType: serial.GetMessageType(&tls.Config{}),
+		SecuritySettings: []*serial.TypedMessage{
+			serial.ToTypedMessage(&tls.Config{AllowInsecure: true}),
+		},
+		HandshakeTimeout: 10,
+	})
+	sessionCtx := session.ContextWithOutbound(ctx, &session.Outbound{
+		RuleTag: "backup",
+		RouteAttributes: &session.RouteAttributes{
+			HandshakeTimeout: time.Second,
+			Retries:          1,
+		},
+	})
+	start := time.Now()
+	_, err = h.Dial(sessionCtx, dest)
+	if err == nil {
+		t.Fatal("expected handshake to time out")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second*5 {
+		t.Error("handshake took ", elapsed)
+	}
+	if !strings.Contains(err.Error(), "route of rule [backup]") {
+		t.Error("unexpected error: ", err)
+	}
+	if v := atomic.LoadInt32(&accepted); v != 2 {
+		t.Error("expected 2 dials, but got ", v)
+	}
+
+	h = newHandler(nil)
+	uplinkReader, uplinkWriter := pipe.New()
+	downlinkReader, downlinkWriter := pipe.New()
+	defer common.Interrupt(uplinkWriter)
+	defer common.Interrupt(downlinkReader)
+	sessionCtx = session.ContextWithOutbound(ctx, &session.Outbound{
+		Target:  dest,
+		RuleTag: "backup",
+		RouteAttributes: &session.RouteAttributes{
+			FirstByteTimeout: time.Second,
+		},
+	})
+	done := make(chan struct{})
+	go func() {
+		h.Dispatch(sessionCtx, &transport.Link{Reader: uplinkReader, Writer: downlinkWriter})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second * 5):
+		t.Error("expected the session to end without response")
+	}
+
+	// Sessions handed to Mux outlive Dispatch, but still end without response.
+	muxHandler, err := NewHandler(ctx, &core.OutboundHandlerConfig{
+		Tag: "slow",
+		SenderSettings: serial.ToTypedMessage(&proxyman.SenderConfig{
+			MultiplexSettings: &proxyman.MultiplexingConfig{
+				Enabled:     true,
+				Concurrency: 8,
+			},
+		}),
+		ProxySettings: serial.ToTypedMessage(&freedom.Config{
+			DestinationOverride: &freedom.DestinationOverride{
+				Server: &protocol.ServerEndpoint{
+					Address: net.NewIPOrDomain(dest.Address),
+					Port:    uint32(dest.Port),
+				},
+			},
+		}),
+	})
+	common.Must(err)
+	common.Must(muxHandler.Start())
+	defer muxHandler.Close()
+
+	uplinkReader, uplinkWriter = pipe.New()
+	downlinkReader, downlinkWriter = pipe.New()
+	defer common.Interrupt(uplinkWriter)
+	muxHandler.Dispatch(sessionCtx, &transport.Link{Reader: uplinkReader, Writer: downlinkWriter})
+	// The session handed to Mux is live until Mux closes its link.
+	sessions := muxHandler.(*Handler).Sessions()
+	if v := sessions.Snapshot(0).Live; v != 1 {
+		t.Error("expected 1 live muxed session, but got ", v)
+	}
+	ended := make(chan error, 1)
+	go func() {
+		_, err := downlinkReader.ReadMultiBuffer()
+		ended <- err
+	}()
+	select {
+	case err := <-ended:
+		if err == nil {
+			t.Error("expected the muxed session to end without response")
+		}
+	case <-time.After(time.Second * 5):
+		t.Error("expected the muxed session to end without response")
+		common.Interrupt(downlinkReader)
+	}
+	for i := 0; i < 20 && sessions.Snapshot(0).Live > 0; i++ {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if v := sessions.Snapshot(0).Live; v != 0 {
+		t.Error("expected the muxed session to end, but got ", v, " live sessions")
+	}
+}
+
+func TestOutboundUDPMaxPacketSize(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.LocalHostIP.IP()})
+	common.Must(err)
+	defer conn.Close()
+	server := net.DestinationFromAddr(conn.LocalAddr())
+
+	v, err := core.New(&core.Config{
+		App: []*serial.TypedMessage{
+			serial.ToTypedMessage(&stats.Config{}),
+		},
+	})
+	common.Must(err)
+	v.AddFeature((outbound.Manager)(new(Manager)))
+	ctx := context.WithValue(context.Background(), v2rayKey, v)
+	h, err := NewHandler(ctx, &core.OutboundHandlerConfig{
+		Tag: "dns",
+		SenderSettings: serial.ToTypedMessage(&proxyman.SenderConfig{
+			StreamSettings: &internet.StreamConfig{
+				UdpMaxPacketSize: 600,
+			},
+			UdpMaxPacketSize: 1000,
+		}),
+		ProxySettings: serial.ToTypedMessage(&freedom.Config{
+			DestinationOverride: &freedom.DestinationOverride{
+				Server: &protocol.ServerEndpoint{
+					Address: net.NewIPOrDomain(server.Address),
+					Port:    uint32(server.Port),
+				},
+			},
+		}),
+	})
+	common.Must(err)
+
+	uplinkReader, uplinkWriter := pipe.New()
+	downlinkReader, downlinkWriter := pipe.New()
+	defer common.Interrupt(downlinkReader)
+	sessionCtx := session.ContextWithOutbound(ctx, &session.Outbound{
+		Target: net.UDPDestination(net.LocalHostIP, 53),
+	})
+	go h.(*Handler).Dispatch(sessionCtx, &transport.Link{Reader: uplinkReader, Writer: downlinkWriter})
+
+	oversized := buf.New()
+	oversized.Extend(700)
+	common.Must(uplinkWriter.WriteMultiBuffer(buf.MultiBuffer{oversized}))
+
+	query := dnsmessage.Message{
+		Header: dnsmessage.Header{ID: 1, RecursionDesired: true},
+		Questions: []dnsmessage.Question{
+			{Name: dnsmessage.MustNewName("v2fly.org."), Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET},
+		},
+	}
+	var opt dnsmessage.Resource
+	common.Must(opt.Header.SetEDNS0(4096, dnsmessage.RCodeSuccess, false))
+	opt.Body = &dnsmessage.OPTResource{}
+	query.Additionals = append(query.Additionals, opt)
+	packed, err := query.Pack()
+	common.Must(err)
+	b := buf.New()
+	common.Must2(b.Write(packed))
+	common.Must(uplinkWriter.WriteMultiBuffer(buf.MultiBuffer{b}))
+
+	received := make([]byte, 2048)
+	common.Must(conn.SetReadDeadline(time.Now().Add(time.Second * 5)))
+	n, _, err := conn.ReadFrom(received)
+	common.Must(err)
+	var relayed dnsmessage.Message
+	common.Must(relayed.Unpack(received[:n]))
+	if len(relayed.Additionals) != 1 || relayed.Additionals[0].Header.Class != 600 {
+		t.Error("expected EDNS0 payload size of 600, but got ", relayed.Additionals)
+	}
+
+	counter := v.GetFeature(feature_stats.ManagerType()).(feature_stats.Manager).GetCounter("outbound>>>dns>>>udp>>>dropped")
+	if counter == nil || counter.Value() != 1 {
+		t.Error("expected 1 dropped packet, but got ", counter)
+	}
+	common.Interrupt(uplinkWriter)
+}
@@ -0,0 +1,54 @@
+package outbound
+
+import (
+	"context"
+
+	"v2ray.com/core/app/proxyman"
+	"v2ray.com/core/app/router"
+	routing_session "v2ray.com/core/features/routing/session"
+)
+
+// muxBypass decides the sessions that skip Mux, by the rules of MultiplexingConfig.
+type muxBypass []*router.ConditionChan
+
+func newMuxBypass(rules []*proxyman.MuxBypassRule) (muxBypass, error) {
+	var bypass muxBypass
+	for _, rule := range rules {
+		conds := router.NewConditionChan()
+		if len(rule.Networks) > 0 {
+			conds.Add(router.NewNetworkMatcher(rule.Networks))
+		}
+		if rule.PortList != nil {
+			conds.Add(router.NewPortMatcher(rule.PortList, false))
+		}
+		if len(rule.Domain) > 0 {
+			matcher, err := router.NewDomainMatcher(rule.Domain)
+			if err != nil {
+				return nil, newError("failed to build domain condition of mux bypass").Base(err)
+			}
+			conds.Add(matcher)
+		}
+		if len(rule.Protocol) > 0 {
+			conds.Add(router.NewProtocolMatcher(rule.Protocol))
+		}
+		if conds.Len() == 0 {
+			return nil, newError("mux bypass rule has no condition")
+		}
+		bypass = append(bypass, conds)
+	}
+	return bypass, nil
+}
+
+// Apply returns whether the session of the context skips Mux.
+func (b muxBypass) Apply(ctx context.Context) bool {
+	if len(b) == 0 {
+		return false
+	}
+	routingCtx := routing_session.AsRoutingContext(ctx)
+	for _, conds := range b {
+		if conds.Apply(routingCtx) {
+			return true
+		}
+	}
+	return false
+}
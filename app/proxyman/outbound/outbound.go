@@ -11,6 +11,8 @@ import (
 	"v2ray.com/core/app/proxyman"
 	"v2ray.com/core/common"
 	"v2ray.com/core/common/errors"
+	"v2ray.com/core/common/session"
+	"v2ray.com/core/features/events"
 	"v2ray.com/core/features/outbound"
 )
 
@@ -21,16 +23,25 @@ type Manager struct {
 	taggedHandler    map[string]outbound.Handler
 	untaggedHandlers []outbound.Handler
 	running          bool
+	instance         *core.Instance
 }
 
 // New creates a new Manager.
 func New(ctx context.Context, config *proxyman.OutboundConfig) (*Manager, error) {
 	m := &Manager{
 		taggedHandler: make(map[string]outbound.Handler),
+		instance:      core.FromContext(ctx),
 	}
 	return m, nil
 }
 
+// emit sends an event of the handler with the tag through the events.Emitter of the instance, if any.
+func (m *Manager) emit(eventType string, tag string) {
+	if m.instance != nil {
+		events.Emit(m.instance, events.New(eventType, map[string]interface{}{"tag": tag}))
+	}
+}
+
 // Type implements common.HasType.
 func (m *Manager) Type() interface{} {
 	return outbound.ManagerType()
@@ -115,9 +126,12 @@ func (m *Manager) AddHandler(ctx context.Context, handler outbound.Handler) erro
 	}
 
 	if m.running {
-		return handler.Start()
+		if err := handler.Start(); err != nil {
+			return err
+		}
 	}
 
+	m.emit(events.OutboundAdded, tag)
 	return nil
 }
 
@@ -129,7 +143,13 @@ func (m *Manager) RemoveHandler(ctx context.Context, tag string) error {
 	m.access.Lock()
 	defer m.access.Unlock()
 
-	delete(m.taggedHandler, tag)
+	if handler, found := m.taggedHandler[tag]; found {
+		if err := handler.Close(); err != nil {
+			newError("failed to close handler ", tag).Base(err).AtWarning().WriteToLog(session.ExportIDToError(ctx))
+		}
+		delete(m.taggedHandler, tag)
+		m.emit(events.OutboundRemoved, tag)
+	}
 	if m.defaultHandler != nil && m.defaultHandler.Tag() == tag {
 		m.defaultHandler = nil
 	}
@@ -137,6 +157,19 @@ func (m *Manager) RemoveHandler(ctx context.Context, tag string) error {
 	return nil
 }
 
+// ListHandlers implements outbound.Manager.
+func (m *Manager) ListHandlers(ctx context.Context) []outbound.Handler {
+	m.access.RLock()
+	defer m.access.RUnlock()
+
+	handlers := make([]outbound.Handler, 0, len(m.untaggedHandlers)+len(m.taggedHandler))
+	handlers = append(handlers, m.untaggedHandlers...)
+	for _, handler := range m.taggedHandler {
+		handlers = append(handlers, handler)
+	}
+	return handlers
+}
+
 // Select implements outbound.HandlerSelector.
 func (m *Manager) Select(selectors []string) []string {
 	m.access.RLock()
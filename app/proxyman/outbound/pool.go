@@ -0,0 +1,230 @@
+package outbound
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"v2ray.com/core/app/proxyman"
+	"v2ray.com/core/common/net"
+	"v2ray.com/core/common/session"
+	"v2ray.com/core/common/task"
+	"v2ray.com/core/transport/internet"
+)
+
+const (
+	defaultPoolMaxIdle = 30 * time.Second
+	// poolTargetTimeout is how long a server stays warm after its last use.
+	poolTargetTimeout    = 5 * time.Minute
+	poolHandshakeTimeout = 16 * time.Second
+)
+
+type pooledConnection struct {
+	conn    internet.Connection
+	created time.Time
+}
+
+type poolTarget struct {
+	idle      []*pooledConnection
+	lastUse   time.Time
+	refilling bool
+}
+
+// connectionPool keeps handshaked transport connections to the servers of an outbound ready, so
+// that new sessions don't wait for the transport handshakes. A server is added to the pool when
+// it is dialed for the first time.
+type connectionPool struct {
+	size    int
+	maxIdle time.Duration
+	muxOnly bool
+	dial    func(ctx context.Context, dest net.Destination) (internet.Connection, error)
+	ctx     context.Context
+
+	access      sync.Mutex
+	targets     map[net.Destination]*poolTarget
+	closed      bool
+	cleanupTask *task.Periodic
+}
+
+func newConnectionPool(ctx context.Context, config *proxyman.PreconnectConfig, dial func(ctx context.Context, dest net.Destination) (internet.Connection, error)) *connectionPool {
+	maxIdle := defaultPoolMaxIdle
+	if config.MaxIdle > 0 {
+		maxIdle = time.Duration(config.MaxIdle) * time.Second
+	}
+	p := &connectionPool{
+		size:    int(config.Size),
+		maxIdle: maxIdle,
+		muxOnly: config.MuxOnly,
+		dial:    dial,
+		ctx:     ctx,
+		targets: make(map[net.Destination]*poolTarget),
+	}
+	interval := maxIdle / 2
+	if interval < time.Second {
+		interval = time.Second
+	}
+	p.cleanupTask = &task.Periodic{
+		Interval: interval,
+		Execute:  p.cleanup,
+	}
+	return p
+}
+
+// accepts returns true if connections for the given session may come from the pool.
+func (p *connectionPool) accepts(ctx context.Context) bool {
+	if !p.muxOnly {
+		return true
+	}
+	outbound := session.OutboundFromContext(ctx)
+	if outbound == nil {
+		return false
+	}
+	target := outbound.Target.Address
+	return target != nil && target.Family().IsDomain() && target.Domain() == "v1.mux.cool"
+}
+
+// Get returns a pooled connection to dest, or nil if there is none. Either way the pool is
+// refilled in background.
+func (p *connectionPool) Get(dest net.Destination) internet.Connection {
+	p.access.Lock()
+	defer p.access.Unlock()
+
+	if p.closed {
+		return nil
+	}
+
+	target, found := p.targets[dest]
+	if !found {
+		target = &poolTarget{}
+		p.targets[dest] = target
+	}
+	target.lastUse = time.Now()
+
+	var conn internet.Connection
+	for len(target.idle) > 0 && conn == nil {
+		pc := target.idle[0]
+		target.idle = target.idle[1:]
+		if time.Since(pc.created) > p.maxIdle {
+			pc.conn.Close()
+			continue
+		}
+		conn = pc.conn
+	}
+
+	p.refill(dest, target)
+	return conn
+}
+
+// refill must be called with access held.
+func (p *connectionPool) refill(dest net.Destination, target *poolTarget) {
+	if target.refilling || len(target.idle) >= p.size {
+		return
+	}
+	target.refilling = true
+	go p.fill(dest, target)
+}
+
+func (p *connectionPool) fill(dest net.Destination, target *poolTarget) {
+	defer func() {
+		p.access.Lock()
+		target.refilling = false
+		p.access.Unlock()
+	}()
+
+	for {
+		p.access.Lock()
+		if p.closed || len(target.idle) >= p.size {
+			p.access.Unlock()
+			return
+		}
+		p.access.Unlock()
+
+		conn, err := p.connect(dest)
+		if err != nil {
+			newError("failed to preconnect to ", dest).Base(err).WriteToLog()
+			return
+		}
+
+		p.access.Lock()
+		if p.closed {
+			p.access.Unlock()
+			conn.Close()
+			return
+		}
+		target.idle = append(target.idle, &pooledConnection{
+			conn:    conn,
+			created: time.Now(),
+		})
+		p.access.Unlock()
+	}
+}
+
+func (p *connectionPool) connect(dest net.Destination) (internet.Connection, error) {
+	conn, err := p.dial(p.ctx, dest)
+	if err != nil {
+		return nil, err
+	}
+	// TLS connections handshake lazily on first use, which is the latency the pool is meant to hide.
+	rawConn := conn
+	if statConn, ok := conn.(*internet.StatCouterConnection); ok {
+		rawConn = statConn.Connection
+	}
+	if hc, ok := rawConn.(interface{ Handshake() error }); ok {
+		conn.SetDeadline(time.Now().Add(poolHandshakeTimeout))
+		if err := hc.Handshake(); err != nil {
+			conn.Close()
+			return nil, newError("failed to handshake").Base(err)
+		}
+		conn.SetDeadline(time.Time{})
+	}
+	return conn, nil
+}
+
+// cleanup replaces connections that stayed idle for too long, and forgets servers that are no
+// longer used.
+func (p *connectionPool) cleanup() error {
+	p.access.Lock()
+	defer p.access.Unlock()
+
+	now := time.Now()
+	for dest, target := range p.targets {
+		var active []*pooledConnection
+		for _, pc := range target.idle {
+			if now.Sub(pc.created) > p.maxIdle {
+				pc.conn.Close()
+				continue
+			}
+			active = append(active, pc)
+		}
+		target.idle = active
+
+		if now.Sub(target.lastUse) > poolTargetTimeout {
+			if !target.refilling && len(target.idle) == 0 {
+				delete(p.targets, dest)
+			}
+			continue
+		}
+		p.refill(dest, target)
+	}
+	return nil
+}
+
+// Start implements common.Runnable.
+func (p *connectionPool) Start() error {
+	return p.cleanupTask.Start()
+}
+
+// Close implements common.Closable.
+func (p *connectionPool) Close() error {
+	p.access.Lock()
+	p.closed = true
+	for _, target := range p.targets {
+		for _, pc := range target.idle {
+			pc.conn.Close()
+		}
+		target.idle = nil
+	}
+	p.access.Unlock()
+
+	return p.cleanupTask.Close()
+}
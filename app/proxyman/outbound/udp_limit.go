@@ -0,0 +1,121 @@
+package outbound
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"v2ray.com/core/app/proxyman"
+	"v2ray.com/core/common"
+	"v2ray.com/core/common/buf"
+	"v2ray.com/core/common/session"
+	"v2ray.com/core/features/stats"
+)
+
+// minEDNS0PayloadSize is the smallest UDP payload size that EDNS0 advertises, as smaller ones are taken as it.
+const minEDNS0PayloadSize = 512
+
+// udpMaxPacketSize returns the smaller one of the UDP limits of the outbound and its transport, where zero is
+// no limit.
+func udpMaxPacketSize(settings *proxyman.SenderConfig) int32 {
+	limit := settings.UdpMaxPacketSize
+	if s := settings.StreamSettings.GetUdpMaxPacketSize(); s > 0 && (limit == 0 || s < limit) {
+		limit = s
+	}
+	return int32(limit)
+}
+
+// udpLimitReader drops UDP packets over the size limit from the uplink of a session, rather than sending them
+// to be dropped somewhere along the path, which leaves no trace. It lowers the UDP payload size that DNS
+// queries advertise in EDNS0 to the limit as well, so that upstreams truncate larger responses instead.
+type udpLimitReader struct {
+	buf.Reader
+	ctx     context.Context
+	max     int32
+	dns     bool
+	dropped stats.Counter
+}
+
+func (r *udpLimitReader) filter(mb buf.MultiBuffer) buf.MultiBuffer {
+	filtered := mb[:0]
+	for _, b := range mb {
+		if b.Len() > r.max {
+			newError("dropping UDP packet of ", b.Len(), " bytes, over the limit of ", r.max).AtDebug().WriteToLog(session.ExportIDToError(r.ctx))
+			if r.dropped != nil {
+				r.dropped.Add(1)
+			}
+			b.Release()
+			continue
+		}
+		if r.dns {
+			clampEDNS0(b, r.max)
+		}
+		filtered = append(filtered, b)
+	}
+	return filtered
+}
+
+// ReadMultiBuffer implements buf.Reader.
+func (r *udpLimitReader) ReadMultiBuffer() (buf.MultiBuffer, error) {
+	for {
+		mb, err := r.Reader.ReadMultiBuffer()
+		mb = r.filter(mb)
+		if !mb.IsEmpty() || err != nil {
+			return mb, err
+		}
+	}
+}
+
+// ReadMultiBufferTimeout implements buf.TimeoutReader.
+func (r *udpLimitReader) ReadMultiBufferTimeout(timeout time.Duration) (buf.MultiBuffer, error) {
+	reader, ok := r.Reader.(buf.TimeoutReader)
+	if !ok {
+		return nil, buf.ErrNotTimeoutReader
+	}
+	mb, err := reader.ReadMultiBufferTimeout(timeout)
+	mb = r.filter(mb)
+	if mb.IsEmpty() && err == nil {
+		return nil, buf.ErrReadTimeout
+	}
+	return mb, err
+}
+
+// Interrupt implements common.Interruptible.
+func (r *udpLimitReader) Interrupt() {
+	common.Interrupt(r.Reader)
+}
+
+// Close implements common.Closable.
+func (r *udpLimitReader) Close() error {
+	return common.Close(r.Reader)
+}
+
+// clampEDNS0 lowers the UDP payload size in the OPT record of the DNS query in b to max. b is left as is if
+// it is not a DNS query, or advertises no more than max.
+func clampEDNS0(b *buf.Buffer, max int32) {
+	if max < minEDNS0PayloadSize {
+		max = minEDNS0PayloadSize
+	}
+	var msg dnsmessage.Message
+	if err := msg.Unpack(b.Bytes()); err != nil || msg.Header.Response {
+		return
+	}
+	clamped := false
+	for i := range msg.Additionals {
+		header := &msg.Additionals[i].Header
+		if header.Type == dnsmessage.TypeOPT && int32(header.Class) > max {
+			header.Class = dnsmessage.Class(max)
+			clamped = true
+		}
+	}
+	if !clamped {
+		return
+	}
+	packed, err := msg.AppendPack(make([]byte, 0, b.Len()))
+	if err != nil || int32(len(packed)) > buf.Size {
+		return
+	}
+	b.Clear()
+	common.Must2(b.Write(packed))
+}
@@ -0,0 +1,159 @@
+package outbound
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+
+	"v2ray.com/core/app/proxyman"
+	"v2ray.com/core/common/dice"
+	"v2ray.com/core/common/errors"
+	"v2ray.com/core/common/net"
+)
+
+const (
+	// maxViaPoolSize is the largest number of addresses a pool may expand to.
+	maxViaPoolSize = 4096
+	// maxViaBindFailures is the number of consecutive bind failures that remove an address from the pool.
+	maxViaBindFailures = 3
+)
+
+// viaPool rotates the source addresses of outbound connections.
+type viaPool struct {
+	sync.Mutex
+	addresses []net.Address
+	failures  map[string]int
+	next      int
+	random    bool
+}
+
+func newViaPool(config *proxyman.ViaPool) (*viaPool, error) {
+	p := &viaPool{
+		failures: make(map[string]int),
+		random:   config.Strategy == proxyman.ViaPool_Random,
+	}
+	for _, cidr := range config.Cidr {
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return nil, newError("invalid IP in send through pool: ", cidr)
+			}
+			p.addresses = append(p.addresses, net.IPAddress(ip))
+			continue
+		}
+		ip, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, newError("invalid network in send through pool: ", cidr).Base(err)
+		}
+		// The network and broadcast addresses of IPv4 networks can't be bound, except in /31 point-to-point
+		// networks.
+		ones, bits := network.Mask.Size()
+		skipEnds := bits == 32 && ones < 31
+		for ip = ip.Mask(network.Mask); network.Contains(ip); ip = nextIP(ip) {
+			if skipEnds && (ip.Equal(network.IP) || !network.Contains(nextIP(ip))) {
+				continue
+			}
+			if len(p.addresses) >= maxViaPoolSize {
+				return nil, newError("send through pool is larger than ", maxViaPoolSize, " addresses")
+			}
+			p.addresses = append(p.addresses, net.IPAddress(ip))
+		}
+	}
+	if len(p.addresses) == 0 {
+		return nil, newError("empty send through pool")
+	}
+	return p, nil
+}
+
+// nextIP returns the IP after ip, or nil after the last one.
+func nextIP(ip net.IP) net.IP {
+	next := make(net.IP, len(ip))
+	copy(next, ip)
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			return next
+		}
+	}
+	return nil
+}
+
+// First returns the first address of the pool. It hints the address family of the pool.
+func (p *viaPool) First() net.Address {
+	p.Lock()
+	defer p.Unlock()
+
+	if len(p.addresses) == 0 {
+		return nil
+	}
+	return p.addresses[0]
+}
+
+// Pick returns the address for a new connection, or nil if no address is left.
+func (p *viaPool) Pick() net.Address {
+	p.Lock()
+	defer p.Unlock()
+
+	if len(p.addresses) == 0 {
+		return nil
+	}
+	if p.random {
+		return p.addresses[dice.Roll(len(p.addresses))]
+	}
+	if p.next >= len(p.addresses) {
+		p.next = 0
+	}
+	address := p.addresses[p.next]
+	p.next++
+	return address
+}
+
+// Size returns the number of addresses left in the pool.
+func (p *viaPool) Size() int {
+	p.Lock()
+	defer p.Unlock()
+
+	return len(p.addresses)
+}
+
+// RecordSuccess resets the bind failures of the address.
+func (p *viaPool) RecordSuccess(address net.Address) {
+	p.Lock()
+	defer p.Unlock()
+
+	delete(p.failures, address.String())
+}
+
+// RecordBindFailure records that the address can't be bound, and removes it from the pool after
+// repeated failures.
+func (p *viaPool) RecordBindFailure(address net.Address) {
+	p.Lock()
+	defer p.Unlock()
+
+	key := address.String()
+	p.failures[key]++
+	if p.failures[key] < maxViaBindFailures {
+		return
+	}
+	delete(p.failures, key)
+	for i, a := range p.addresses {
+		if a.String() == key {
+			p.addresses = append(p.addresses[:i], p.addresses[i+1:]...)
+			newError("removed ", key, " from send through pool after ", maxViaBindFailures, " bind failures").AtWarning().WriteToLog()
+			return
+		}
+	}
+}
+
+// isBindError returns whether the dial failed because the source address is not available.
+func isBindError(err error) bool {
+	cause := errors.Cause(err)
+	if opErr, ok := cause.(*net.OpError); ok {
+		cause = opErr.Err
+	}
+	if sysErr, ok := cause.(*os.SyscallError); ok {
+		cause = sysErr.Err
+	}
+	return cause == syscall.EADDRNOTAVAIL
+}
@@ -0,0 +1,63 @@
+package outbound
+
+import (
+	"context"
+	"testing"
+
+	"v2ray.com/core/app/proxyman"
+	"v2ray.com/core/common"
+	"v2ray.com/core/common/net"
+	"v2ray.com/core/common/session"
+	"v2ray.com/core/transport/internet"
+)
+
+func TestViaPool(t *testing.T) {
+	pool, err := newViaPool(&proxyman.ViaPool{
+		Cidr: []string{"192.0.2.0/30", "192.0.2.8/31", "2001:db8::/127"},
+	})
+	common.Must(err)
+	if size := pool.Size(); size != 6 {
+		t.Fatal("pool size: ", size)
+	}
+
+	var picked []string
+	for i := 0; i < 7; i++ {
+		picked = append(picked, pool.Pick().String())
+	}
+	expected := []string{"192.0.2.1", "192.0.2.2", "192.0.2.8", "192.0.2.9", "[2001:db8::]", "[2001:db8::1]", "192.0.2.1"}
+	for i := range expected {
+		if picked[i] != expected[i] {
+			t.Fatal("picked ", picked, ", want ", expected)
+		}
+	}
+
+	bad := pool.First()
+	for i := 0; i < maxViaBindFailures; i++ {
+		pool.RecordBindFailure(bad)
+	}
+	if size := pool.Size(); size != 5 {
+		t.Error("pool size after bind failures: ", size)
+	}
+	for i := 0; i < 8; i++ {
+		if pool.Pick().String() == bad.String() {
+			t.Fatal("picked removed address")
+		}
+	}
+
+	if _, err := newViaPool(&proxyman.ViaPool{Cidr: []string{"10.0.0.0/8"}}); err == nil {
+		t.Error("expected error for oversized pool")
+	}
+}
+
+func TestIsBindError(t *testing.T) {
+	ctx := session.ContextWithOutbound(context.Background(), &session.Outbound{
+		Gateway: net.ParseAddress("192.0.2.1"),
+	})
+	_, err := internet.DialSystem(ctx, net.TCPDestination(net.LocalHostIP, 1), nil)
+	if err == nil {
+		t.Skip("192.0.2.1 is assigned")
+	}
+	if !isBindError(err) {
+		t.Error("not a bind error: ", err)
+	}
+}
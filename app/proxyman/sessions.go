@@ -0,0 +1,156 @@
+package proxyman
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"v2ray.com/core/features/stats"
+)
+
+// SessionTracker accounts the sessions of a handler, and the goroutines running for them. The counters
+// given to it, which may be nil, are kept in sync with its numbers. It is safe for concurrent use.
+type SessionTracker struct {
+	live       int64
+	total      int64
+	goroutines int64
+
+	access   sync.Mutex
+	sessions map[*trackedSession]struct{}
+
+	liveGauge      stats.Counter
+	totalCounter   stats.Counter
+	goroutineGauge stats.Counter
+}
+
+type trackedSession struct {
+	start time.Time
+	ended int32
+}
+
+// NewSessionTracker creates a SessionTracker that updates the given counters.
+func NewSessionTracker(liveGauge, totalCounter, goroutineGauge stats.Counter) *SessionTracker {
+	return &SessionTracker{
+		sessions:       make(map[*trackedSession]struct{}),
+		liveGauge:      liveGauge,
+		totalCounter:   totalCounter,
+		goroutineGauge: goroutineGauge,
+	}
+}
+
+// SessionCounterNames returns the names of the counters of live sessions, total sessions and goroutines of
+// the handler with the tag, in the direction of "inbound" or "outbound".
+func SessionCounterNames(direction string, tag string) []string {
+	prefix := direction + ">>>" + tag + ">>>"
+	return []string{prefix + "sessions>>>live", prefix + "sessions>>>total", prefix + "goroutines"}
+}
+
+// NewSessionTrackerWithStats creates a SessionTracker, with counters registered in the stats manager if
+// enabled and the tag is not empty.
+func NewSessionTrackerWithStats(statsManager stats.Manager, direction string, tag string, enabled bool) *SessionTracker {
+	if len(tag) == 0 || !enabled || statsManager == nil {
+		return NewSessionTracker(nil, nil, nil)
+	}
+	var counters [3]stats.Counter
+	for i, name := range SessionCounterNames(direction, tag) {
+		counters[i], _ = stats.GetOrRegisterCounter(statsManager, name)
+	}
+	return NewSessionTracker(counters[0], counters[1], counters[2])
+}
+
+// Begin records a new session, and returns the function to call when it ends. The function may be called
+// more than once, on every exit path of the session.
+func (t *SessionTracker) Begin() func() {
+	s := &trackedSession{start: time.Now()}
+	t.access.Lock()
+	t.sessions[s] = struct{}{}
+	t.access.Unlock()
+	atomic.AddInt64(&t.live, 1)
+	atomic.AddInt64(&t.total, 1)
+	if t.liveGauge != nil {
+		t.liveGauge.Add(1)
+	}
+	if t.totalCounter != nil {
+		t.totalCounter.Add(1)
+	}
+
+	return func() {
+		if !atomic.CompareAndSwapInt32(&s.ended, 0, 1) {
+			return
+		}
+		t.access.Lock()
+		delete(t.sessions, s)
+		t.access.Unlock()
+		atomic.AddInt64(&t.live, -1)
+		if t.liveGauge != nil {
+			t.liveGauge.Add(-1)
+		}
+	}
+}
+
+// AddGoroutines implements task.GoroutineCounter.
+func (t *SessionTracker) AddGoroutines(delta int64) {
+	atomic.AddInt64(&t.goroutines, delta)
+	if t.goroutineGauge != nil {
+		t.goroutineGauge.Add(delta)
+	}
+}
+
+// Go runs f in a new goroutine that is accounted.
+func (t *SessionTracker) Go(f func()) {
+	t.AddGoroutines(1)
+	go func() {
+		defer t.AddGoroutines(-1)
+		f()
+	}()
+}
+
+// SessionSnapshot is the state of a SessionTracker at some time.
+type SessionSnapshot struct {
+	// Live is the number of sessions that haven't ended.
+	Live int64
+	// Total is the number of sessions since the tracker was created.
+	Total int64
+	// Goroutines is the number of goroutines running for the sessions.
+	Goroutines int64
+	// OldestAges are the ages of the oldest live sessions, oldest first.
+	OldestAges []time.Duration
+}
+
+// Snapshot returns the current state, with the ages of up to the given number of the oldest sessions.
+func (t *SessionTracker) Snapshot(oldest int) SessionSnapshot {
+	snapshot := SessionSnapshot{
+		Live:       atomic.LoadInt64(&t.live),
+		Total:      atomic.LoadInt64(&t.total),
+		Goroutines: atomic.LoadInt64(&t.goroutines),
+	}
+	if oldest <= 0 {
+		return snapshot
+	}
+
+	t.access.Lock()
+	starts := make([]time.Time, 0, len(t.sessions))
+	for s := range t.sessions {
+		starts = append(starts, s.start)
+	}
+	t.access.Unlock()
+
+	sort.Slice(starts, func(i, j int) bool {
+		return starts[i].Before(starts[j])
+	})
+	if len(starts) > oldest {
+		starts = starts[:oldest]
+	}
+	now := time.Now()
+	for _, start := range starts {
+		snapshot.OldestAges = append(snapshot.OldestAges, now.Sub(start))
+	}
+	return snapshot
+}
+
+// SessionReporter is a handler that tracks its sessions.
+type SessionReporter interface {
+	// Sessions returns the tracker of the sessions of the handler.
+	Sessions() *SessionTracker
+}
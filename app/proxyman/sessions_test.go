@@ -0,0 +1,55 @@
+package proxyman_test
+
+import (
+	"testing"
+	"time"
+
+	. "v2ray.com/core/app/proxyman"
+	"v2ray.com/core/app/stats"
+)
+
+func TestSessionTracker(t *testing.T) {
+	live := new(stats.Counter)
+	total := new(stats.Counter)
+	goroutines := new(stats.Counter)
+	tracker := NewSessionTracker(live, total, goroutines)
+
+	end1 := tracker.Begin()
+	time.Sleep(100 * time.Millisecond)
+	end2 := tracker.Begin()
+
+	done := make(chan struct{})
+	tracker.Go(func() {
+		<-done
+	})
+
+	snapshot := tracker.Snapshot(1)
+	if snapshot.Live != 2 || snapshot.Total != 2 || snapshot.Goroutines != 1 {
+		t.Error("snapshot: ", snapshot)
+	}
+	if len(snapshot.OldestAges) != 1 || snapshot.OldestAges[0] < 100*time.Millisecond {
+		t.Error("oldest ages: ", snapshot.OldestAges)
+	}
+
+	// Ending a session more than once counts once.
+	end1()
+	end1()
+	close(done)
+	time.Sleep(10 * time.Millisecond)
+
+	snapshot = tracker.Snapshot(2)
+	if snapshot.Live != 1 || snapshot.Total != 2 || snapshot.Goroutines != 0 {
+		t.Error("snapshot: ", snapshot)
+	}
+	if len(snapshot.OldestAges) != 1 || snapshot.OldestAges[0] >= 100*time.Millisecond {
+		t.Error("oldest ages: ", snapshot.OldestAges)
+	}
+	if live.Value() != 1 || total.Value() != 2 || goroutines.Value() != 0 {
+		t.Error("counters: ", live.Value(), " ", total.Value(), " ", goroutines.Value())
+	}
+
+	end2()
+	if snapshot := tracker.Snapshot(0); snapshot.Live != 0 || snapshot.OldestAges != nil {
+		t.Error("snapshot: ", snapshot)
+	}
+}
@@ -4,9 +4,12 @@ package reverse
 
 import (
 	"context"
+	"sync/atomic"
 	"time"
 
 	"github.com/golang/protobuf/proto"
+	"v2ray.com/core/common"
+	"v2ray.com/core/common/buf"
 	"v2ray.com/core/common/mux"
 	"v2ray.com/core/common/net"
 	"v2ray.com/core/common/session"
@@ -20,25 +23,68 @@ import (
 type Bridge struct {
 	dispatcher  routing.Dispatcher
 	tag         string
-	domain      string
-	workers     []*BridgeWorker
+	token       string
+	services    map[string]net.Destination
+	portals     []*bridgePortal
+	timeout     time.Duration
 	monitorTask *task.Periodic
 }
 
+// bridgePortal holds the connections from a Bridge to one of its portals.
+type bridgePortal struct {
+	domain  string
+	workers []*BridgeWorker
+}
+
 // NewBridge creates a new Bridge instance.
 func NewBridge(config *BridgeConfig, dispatcher routing.Dispatcher) (*Bridge, error) {
 	if config.Tag == "" {
 		return nil, newError("bridge tag is empty")
 	}
-	if config.Domain == "" {
-		return nil, newError("bridge domain is empty")
-	}
 
 	b := &Bridge{
 		dispatcher: dispatcher,
 		tag:        config.Tag,
-		domain:     config.Domain,
+		token:      config.Token,
+		timeout:    time.Second * 6,
 	}
+	if config.HeartbeatTimeout > 0 {
+		b.timeout = time.Second * time.Duration(config.HeartbeatTimeout)
+	}
+
+	for _, service := range config.Service {
+		switch {
+		case !isValidServiceTag(service.Tag) || b.services[service.Tag].IsValid():
+			return nil, newError("invalid or duplicated service tag in bridge ", config.Tag, ": ", service.Tag)
+		case service.Address == nil || service.Port == 0:
+			return nil, newError("address of service ", service.Tag, " is not specified")
+		}
+		if b.services == nil {
+			b.services = make(map[string]net.Destination)
+		}
+		b.services[service.Tag] = net.Destination{
+			Network: net.Network_TCP,
+			Address: service.Address.AsAddress(),
+			Port:    net.Port(service.Port),
+		}
+	}
+
+	domains := config.Domains
+	if config.Domain != "" {
+		domains = append([]string{config.Domain}, domains...)
+	}
+	seen := make(map[string]bool)
+	for _, domain := range domains {
+		if domain == "" || seen[domain] {
+			continue
+		}
+		seen[domain] = true
+		b.portals = append(b.portals, &bridgePortal{domain: domain})
+	}
+	if len(b.portals) == 0 {
+		return nil, newError("bridge domain is empty")
+	}
+
 	b.monitorTask = &task.Periodic{
 		Execute:  b.monitor,
 		Interval: time.Second * 2,
@@ -46,40 +92,84 @@ func NewBridge(config *BridgeConfig, dispatcher routing.Dispatcher) (*Bridge, er
 	return b, nil
 }
 
-func (b *Bridge) cleanup() {
+// cleanup removes workers that are closed, draining or no longer receive heartbeats.
+func (p *bridgePortal) cleanup(timeout time.Duration) {
 	var activeWorkers []*BridgeWorker
 
-	for _, w := range b.workers {
-		if w.IsActive() {
+	for _, w := range p.workers {
+		switch {
+		case !w.IsActive():
+		case !w.IsAlive(timeout):
+			newError("portal ", p.domain, " missed heartbeats, closing connection").AtWarning().WriteToLog()
+			w.Close()
+		default:
 			activeWorkers = append(activeWorkers, w)
 		}
 	}
 
-	if len(activeWorkers) != len(b.workers) {
-		b.workers = activeWorkers
+	if len(activeWorkers) != len(p.workers) {
+		p.workers = activeWorkers
 	}
 }
 
-func (b *Bridge) monitor() error {
-	b.cleanup()
+// confirmed returns true if the portal answered at least one connection with heartbeats.
+func (p *bridgePortal) confirmed() bool {
+	for _, w := range p.workers {
+		if w.Confirmed() {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *bridgePortal) connections() (numConnections uint32, numWorker uint32) {
+	for _, w := range p.workers {
+		numConnections += w.Connections()
+		numWorker++
+	}
+	return
+}
 
+func (b *Bridge) connect(p *bridgePortal) {
+	worker, err := NewBridgeWorker(p.domain, b.tag, b.token, b.services, b.dispatcher)
+	if err != nil {
+		newError("failed to create bridge worker for ", p.domain).Base(err).AtWarning().WriteToLog()
+		return
+	}
+	p.workers = append(p.workers, worker)
+}
+
+func (b *Bridge) monitor() error {
 	var numConnections uint32
 	var numWorker uint32
+	var leastLoaded *bridgePortal
+	var leastLoad uint32
+
+	for _, p := range b.portals {
+		p.cleanup(b.timeout)
 
-	for _, w := range b.workers {
-		if w.IsActive() {
-			numConnections += w.Connections()
-			numWorker++
+		// Every portal keeps at least one connection, so that a failover
+		// doesn't have to wait for new connections being established.
+		if len(p.workers) == 0 {
+			b.connect(p)
+			continue
 		}
-	}
 
-	if numWorker == 0 || numConnections/numWorker > 16 {
-		worker, err := NewBridgeWorker(b.domain, b.tag, b.dispatcher)
-		if err != nil {
-			newError("failed to create bridge worker").Base(err).AtWarning().WriteToLog()
-			return nil
+		c, w := p.connections()
+		numConnections += c
+		numWorker += w
+
+		if !p.confirmed() {
+			continue
+		}
+		if load := c / w; leastLoaded == nil || load < leastLoad {
+			leastLoaded = p
+			leastLoad = load
 		}
-		b.workers = append(b.workers, worker)
+	}
+
+	if leastLoaded != nil && numWorker > 0 && numConnections/numWorker > 16 {
+		b.connect(leastLoaded)
 	}
 
 	return nil
@@ -95,12 +185,20 @@ func (b *Bridge) Close() error {
 
 type BridgeWorker struct {
 	tag        string
+	token      string
+	services   map[string]net.Destination
 	worker     *mux.ServerWorker
+	link       *transport.Link
 	dispatcher routing.Dispatcher
 	state      Control_State
+	created    time.Time
+	// lastHeartbeat is the unix nano time of the latest control message from portal.
+	lastHeartbeat int64
 }
 
-func NewBridgeWorker(domain string, tag string, d routing.Dispatcher) (*BridgeWorker, error) {
+// NewBridgeWorker creates a BridgeWorker over a new connection to the portal of the domain. The services are
+// announced to the portal by their tags, and connections to them are relayed to their addresses.
+func NewBridgeWorker(domain string, tag string, token string, services map[string]net.Destination, d routing.Dispatcher) (*BridgeWorker, error) {
 	ctx := context.Background()
 	ctx = session.ContextWithInbound(ctx, &session.Inbound{
 		Tag: tag,
@@ -117,6 +215,10 @@ func NewBridgeWorker(domain string, tag string, d routing.Dispatcher) (*BridgeWo
 	w := &BridgeWorker{
 		dispatcher: d,
 		tag:        tag,
+		token:      token,
+		services:   services,
+		link:       link,
+		created:    time.Now(),
 	}
 
 	worker, err := mux.NewServerWorker(context.Background(), w, link)
@@ -136,7 +238,10 @@ func (w *BridgeWorker) Start() error {
 	return nil
 }
 
+// Close tears down the connection to portal.
 func (w *BridgeWorker) Close() error {
+	common.Interrupt(w.link.Reader)
+	common.Close(w.link.Writer)
 	return nil
 }
 
@@ -144,6 +249,20 @@ func (w *BridgeWorker) IsActive() bool {
 	return w.state == Control_ACTIVE && !w.worker.Closed()
 }
 
+// Confirmed returns true if portal has sent at least one heartbeat.
+func (w *BridgeWorker) Confirmed() bool {
+	return atomic.LoadInt64(&w.lastHeartbeat) != 0
+}
+
+// IsAlive returns false if portal didn't send any heartbeat within the given timeout.
+func (w *BridgeWorker) IsAlive(timeout time.Duration) bool {
+	last := w.created
+	if nano := atomic.LoadInt64(&w.lastHeartbeat); nano != 0 {
+		last = time.Unix(0, nano)
+	}
+	return time.Since(last) < timeout
+}
+
 func (w *BridgeWorker) Connections() uint32 {
 	return w.worker.ActiveConnections()
 }
@@ -162,15 +281,46 @@ func (w *BridgeWorker) handleInternalConn(link transport.Link) {
 					newError("failed to parse proto message").Base(err).WriteToLog()
 					break
 				}
+				atomic.StoreInt64(&w.lastHeartbeat, time.Now().UnixNano())
 				if ctl.State != w.state {
 					w.state = ctl.State
 				}
+				if ctl.State == Control_ACTIVE && ctl.Acknowledge {
+					w.acknowledge(link.Writer)
+				}
 			}
+			buf.ReleaseMulti(mb)
 		}
 	}()
 }
 
+// acknowledge answers a heartbeat that asks for it, so that portal knows this connection is alive.
+// The answer carries the token of this bridge for authentication, and the tags of its services.
+func (w *BridgeWorker) acknowledge(writer buf.Writer) {
+	msg := &Control{
+		Token: w.token,
+	}
+	for tag := range w.services {
+		msg.Service = append(msg.Service, tag)
+	}
+	msg.FillInRandom()
+	b, err := proto.Marshal(msg)
+	common.Must(err)
+	if err := writer.WriteMultiBuffer(buf.MergeBytes(nil, b)); err != nil {
+		newError("failed to acknowledge heartbeat").Base(err).WriteToLog()
+	}
+}
+
 func (w *BridgeWorker) Dispatch(ctx context.Context, dest net.Destination) (*transport.Link, error) {
+	if tag, ok := serviceOf(dest); ok {
+		service, found := w.services[tag]
+		if !found {
+			return nil, newError("service ", tag, " not found in bridge ", w.tag)
+		}
+		service.Network = dest.Network
+		dest = service
+	}
+
 	if !isInternalDomain(dest) {
 		ctx = session.ContextWithInbound(ctx, &session.Inbound{
 			Tag: w.tag,
@@ -4,7 +4,10 @@ package reverse
 
 import (
 	"context"
+	"crypto/subtle"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/golang/protobuf/proto"
@@ -15,36 +18,43 @@ import (
 	"v2ray.com/core/common/session"
 	"v2ray.com/core/common/task"
 	"v2ray.com/core/features/outbound"
+	"v2ray.com/core/features/stats"
 	"v2ray.com/core/transport"
 	"v2ray.com/core/transport/pipe"
 )
 
 type Portal struct {
-	ohm    outbound.Manager
+	ohm      outbound.Manager
+	tag      string
+	bridges  []*portalBridge
+	services []*portalService
+
+	stats          stats.Manager
+	statsTask      *task.Periodic
+	bridgeCounters map[string]stats.Counter
+}
+
+// portalBridge is a group of bridge connections that registered with the same domain.
+// Traffic sent to one portalBridge is never relayed by connections of another.
+type portalBridge struct {
 	tag    string
 	domain string
+	// token is the expected token of the bridge. Empty for no authentication.
+	token  string
 	picker *StaticMuxPicker
 	client *mux.ClientManager
 }
 
-func NewPortal(config *PortalConfig, ohm outbound.Manager) (*Portal, error) {
-	if config.Tag == "" {
-		return nil, newError("portal tag is empty")
-	}
-
-	if config.Domain == "" {
-		return nil, newError("portal domain is empty")
-	}
-
+func newPortalBridge(tag string, domain string, token string) (*portalBridge, error) {
 	picker, err := NewStaticMuxPicker()
 	if err != nil {
 		return nil, err
 	}
 
-	return &Portal{
-		ohm:    ohm,
-		tag:    config.Tag,
-		domain: config.Domain,
+	return &portalBridge{
+		tag:    tag,
+		domain: domain,
+		token:  token,
 		picker: picker,
 		client: &mux.ClientManager{
 			Picker: picker,
@@ -52,44 +62,275 @@ func NewPortal(config *PortalConfig, ohm outbound.Manager) (*Portal, error) {
 	}, nil
 }
 
+// portalService relays traffic to a service of bridges.
+type portalService struct {
+	tag     string
+	service string
+	client  *mux.ClientManager
+}
+
+// servicePicker picks the least loaded connection among the bridges that provide a service.
+type servicePicker struct {
+	service string
+	pickers []*StaticMuxPicker
+}
+
+func (p *servicePicker) PickAvailable() (*mux.ClientWorker, error) {
+	var picked *mux.ClientWorker
+	for _, picker := range p.pickers {
+		worker, err := picker.pick(func(w *PortalWorker) bool {
+			return w.HasService(p.service)
+		})
+		if err != nil {
+			continue
+		}
+		if picked == nil || worker.ActiveConnections() < picked.ActiveConnections() {
+			picked = worker
+		}
+	}
+	if picked == nil {
+		return nil, newError("no bridge provides service ", p.service)
+	}
+	return picked, nil
+}
+
+func NewPortal(config *PortalConfig, ohm outbound.Manager, sm stats.Manager) (*Portal, error) {
+	if config.Tag == "" {
+		return nil, newError("portal tag is empty")
+	}
+
+	if config.Domain == "" && len(config.Bridge) == 0 {
+		return nil, newError("portal domain is empty")
+	}
+
+	p := &Portal{
+		ohm:            ohm,
+		tag:            config.Tag,
+		stats:          sm,
+		bridgeCounters: make(map[string]stats.Counter),
+	}
+
+	domains := make(map[string]bool)
+	if config.Domain != "" {
+		b, err := newPortalBridge(config.Tag, config.Domain, "")
+		if err != nil {
+			return nil, err
+		}
+		p.bridges = append(p.bridges, b)
+		domains[config.Domain] = true
+	}
+
+	for _, bConfig := range config.Bridge {
+		switch {
+		case bConfig.Tag == "" || bConfig.Tag == config.Tag:
+			return nil, newError("invalid bridge tag in portal ", config.Tag, ": ", bConfig.Tag)
+		case bConfig.Domain == "" || domains[bConfig.Domain]:
+			return nil, newError("invalid or duplicated domain of bridge ", bConfig.Tag, ": ", bConfig.Domain)
+		case bConfig.Token == "":
+			return nil, newError("token of bridge ", bConfig.Tag, " is empty")
+		}
+		b, err := newPortalBridge(bConfig.Tag, bConfig.Domain, bConfig.Token)
+		if err != nil {
+			return nil, err
+		}
+		p.bridges = append(p.bridges, b)
+		domains[bConfig.Domain] = true
+	}
+
+	tags := map[string]bool{config.Tag: true}
+	for _, b := range p.bridges {
+		tags[b.tag] = true
+	}
+	for _, sConfig := range config.Service {
+		switch {
+		case sConfig.Tag == "" || tags[sConfig.Tag]:
+			return nil, newError("invalid or duplicated service tag in portal ", config.Tag, ": ", sConfig.Tag)
+		case !isValidServiceTag(sConfig.Service):
+			return nil, newError("invalid service of ", sConfig.Tag, ": ", sConfig.Service)
+		}
+		picker := &servicePicker{service: sConfig.Service}
+		for _, b := range p.bridges {
+			if sConfig.Bridge == "" || sConfig.Bridge == b.tag {
+				picker.pickers = append(picker.pickers, b.picker)
+			}
+		}
+		if len(picker.pickers) == 0 {
+			return nil, newError("bridge of service ", sConfig.Tag, " not found: ", sConfig.Bridge)
+		}
+		p.services = append(p.services, &portalService{
+			tag:     sConfig.Tag,
+			service: sConfig.Service,
+			client:  &mux.ClientManager{Picker: picker},
+		})
+		tags[sConfig.Tag] = true
+	}
+
+	p.statsTask = &task.Periodic{
+		Execute:  p.updateStats,
+		Interval: time.Second * 5,
+	}
+	return p, nil
+}
+
 func (p *Portal) Start() error {
+	if p.stats != nil {
+		if err := p.statsTask.Start(); err != nil {
+			return err
+		}
+	}
+
+	var self *portalBridge
+	for _, b := range p.bridges {
+		if b.tag == p.tag {
+			self = b
+			continue
+		}
+		if err := p.ohm.AddHandler(context.Background(), &Outbound{
+			portal: p,
+			bridge: b,
+			tag:    b.tag,
+		}); err != nil {
+			return err
+		}
+	}
+	for _, service := range p.services {
+		if err := p.ohm.AddHandler(context.Background(), &Outbound{
+			portal:  p,
+			service: service,
+			tag:     service.tag,
+		}); err != nil {
+			return err
+		}
+	}
+
 	return p.ohm.AddHandler(context.Background(), &Outbound{
 		portal: p,
+		bridge: self,
 		tag:    p.tag,
 	})
 }
 
 func (p *Portal) Close() error {
+	p.statsTask.Close()
+	for _, b := range p.bridges {
+		if b.tag != p.tag {
+			p.ohm.RemoveHandler(context.Background(), b.tag)
+		}
+	}
+	for _, service := range p.services {
+		p.ohm.RemoveHandler(context.Background(), service.tag)
+	}
 	return p.ohm.RemoveHandler(context.Background(), p.tag)
 }
 
-func (p *Portal) HandleConnection(ctx context.Context, link *transport.Link) error {
+// updateStats publishes the number of active sessions carried by each bridge,
+// as "portal>>>[tag]>>>bridge>>>[bridge]>>>sessions".
+func (p *Portal) updateStats() error {
+	sessions := make(map[string]uint32)
+	for _, b := range p.bridges {
+		for bridge, n := range b.picker.sessionsByBridge() {
+			sessions[bridge] += n
+		}
+	}
+	for bridge := range p.bridgeCounters {
+		if _, found := sessions[bridge]; !found {
+			sessions[bridge] = 0
+		}
+	}
+
+	for bridge, n := range sessions {
+		c, found := p.bridgeCounters[bridge]
+		if !found {
+			name := "portal>>>" + p.tag + ">>>bridge>>>" + bridge + ">>>sessions"
+			c, _ = stats.GetOrRegisterCounter(p.stats, name)
+			if c == nil {
+				continue
+			}
+			p.bridgeCounters[bridge] = c
+		}
+		c.Set(int64(n))
+	}
+	return nil
+}
+
+// bridgeIdentity returns a name for the bridge connecting in the given context,
+// which is the email of the authenticated user, or the source IP otherwise.
+func bridgeIdentity(ctx context.Context) string {
+	inbound := session.InboundFromContext(ctx)
+	if inbound == nil {
+		return "unknown"
+	}
+	if inbound.User != nil && len(inbound.User.Email) > 0 {
+		return inbound.User.Email
+	}
+	if inbound.Source.IsValid() {
+		return inbound.Source.Address.String()
+	}
+	return "unknown"
+}
+
+// bridgeSource returns the source address of the bridge connecting in the given context, for logging.
+func bridgeSource(ctx context.Context) string {
+	if inbound := session.InboundFromContext(ctx); inbound != nil && inbound.Source.IsValid() {
+		return inbound.Source.String()
+	}
+	return "unknown"
+}
+
+func (p *Portal) register(ctx context.Context, link *transport.Link, b *portalBridge) error {
+	muxClient, err := mux.NewClientWorker(*link, mux.ClientStrategy{})
+	if err != nil {
+		return newError("failed to create mux client worker").Base(err).AtWarning()
+	}
+
+	bridge := bridgeIdentity(ctx)
+	if b.token != "" {
+		bridge = b.tag
+	}
+	worker, err := NewPortalWorker(muxClient, link, bridge, b.token, bridgeSource(ctx))
+	if err != nil {
+		return newError("failed to create portal worker").Base(err)
+	}
+
+	b.picker.AddWorker(worker)
+	return nil
+}
+
+func (p *Portal) HandleConnection(ctx context.Context, link *transport.Link, bridge *portalBridge) error {
 	outboundMeta := session.OutboundFromContext(ctx)
 	if outboundMeta == nil {
 		return newError("outbound metadata not found").AtError()
 	}
 
-	if isDomain(outboundMeta.Target, p.domain) {
-		muxClient, err := mux.NewClientWorker(*link, mux.ClientStrategy{})
-		if err != nil {
-			return newError("failed to create mux client worker").Base(err).AtWarning()
+	for _, b := range p.bridges {
+		if isDomain(outboundMeta.Target, b.domain) {
+			return p.register(ctx, link, b)
 		}
+	}
 
-		worker, err := NewPortalWorker(muxClient)
-		if err != nil {
-			return newError("failed to create portal worker").Base(err)
-		}
+	if bridge == nil {
+		return newError("no bridge is assigned to portal ", p.tag).AtWarning()
+	}
+	return bridge.client.Dispatch(ctx, link)
+}
 
-		p.picker.AddWorker(worker)
-		return nil
+// HandleServiceConnection relays the connection to the service of bridges, instead of its destination.
+func (p *Portal) HandleServiceConnection(ctx context.Context, link *transport.Link, service *portalService) error {
+	outboundMeta := session.OutboundFromContext(ctx)
+	if outboundMeta == nil {
+		return newError("outbound metadata not found").AtError()
 	}
 
-	return p.client.Dispatch(ctx, link)
+	serviceMeta := *outboundMeta
+	serviceMeta.Target = serviceDestination(outboundMeta.Target.Network, service.service)
+	return service.client.Dispatch(session.ContextWithOutbound(ctx, &serviceMeta), link)
 }
 
 type Outbound struct {
-	portal *Portal
-	tag    string
+	portal  *Portal
+	bridge  *portalBridge
+	service *portalService
+	tag     string
 }
 
 func (o *Outbound) Tag() string {
@@ -97,7 +338,13 @@ func (o *Outbound) Tag() string {
 }
 
 func (o *Outbound) Dispatch(ctx context.Context, link *transport.Link) {
-	if err := o.portal.HandleConnection(ctx, link); err != nil {
+	var err error
+	if o.service != nil {
+		err = o.portal.HandleServiceConnection(ctx, link, o.service)
+	} else {
+		err = o.portal.HandleConnection(ctx, link, o.bridge)
+	}
+	if err != nil {
 		newError("failed to process reverse connection").Base(err).WriteToLog(session.ExportIDToError(ctx))
 		common.Interrupt(link.Writer)
 	}
@@ -133,7 +380,7 @@ func (p *StaticMuxPicker) cleanup() error {
 
 	var activeWorkers []*PortalWorker
 	for _, w := range p.workers {
-		if !w.Closed() {
+		if w.IsAlive() {
 			activeWorkers = append(activeWorkers, w)
 		}
 	}
@@ -146,6 +393,12 @@ func (p *StaticMuxPicker) cleanup() error {
 }
 
 func (p *StaticMuxPicker) PickAvailable() (*mux.ClientWorker, error) {
+	return p.pick(nil)
+}
+
+// pick returns the least loaded connection among the workers accepted by accept, or all workers if accept is
+// nil.
+func (p *StaticMuxPicker) pick(accept func(*PortalWorker) bool) (*mux.ClientWorker, error) {
 	p.access.Lock()
 	defer p.access.Unlock()
 
@@ -156,7 +409,7 @@ func (p *StaticMuxPicker) PickAvailable() (*mux.ClientWorker, error) {
 	var minIdx int = -1
 	var minConn uint32 = 9999
 	for i, w := range p.workers {
-		if w.draining {
+		if w.draining || !w.IsAlive() || !w.Authenticated() || (accept != nil && !accept(w)) {
 			continue
 		}
 		if w.client.ActiveConnections() < minConn {
@@ -167,7 +420,7 @@ func (p *StaticMuxPicker) PickAvailable() (*mux.ClientWorker, error) {
 
 	if minIdx == -1 {
 		for i, w := range p.workers {
-			if w.IsFull() {
+			if w.IsFull() || !w.IsAlive() || !w.Authenticated() || (accept != nil && !accept(w)) {
 				continue
 			}
 			if w.client.ActiveConnections() < minConn {
@@ -191,15 +444,55 @@ func (p *StaticMuxPicker) AddWorker(worker *PortalWorker) {
 	p.workers = append(p.workers, worker)
 }
 
+func (p *StaticMuxPicker) sessionsByBridge() map[string]uint32 {
+	p.access.Lock()
+	defer p.access.Unlock()
+
+	sessions := make(map[string]uint32)
+	for _, w := range p.workers {
+		if w.IsAlive() && w.Authenticated() {
+			sessions[w.bridge] += w.client.ActiveConnections()
+		}
+	}
+	return sessions
+}
+
+// portalAckTimeout is the duration after which a bridge connection is dropped,
+// if the bridge used to acknowledge heartbeats but stopped doing so, or
+// didn't authenticate itself.
+const portalAckTimeout = time.Second * 6
+
+const (
+	authPending int32 = iota
+	authAccepted
+	authRejected
+)
+
 type PortalWorker struct {
 	client   *mux.ClientWorker
 	control  *task.Periodic
 	writer   buf.Writer
 	reader   buf.Reader
 	draining bool
+	bridge   string
+	link     *transport.Link
+	created  time.Time
+	// lastAck is the unix nano time of the latest heartbeat acknowledged by
+	// bridge. Bridges of older versions never acknowledge.
+	lastAck int64
+	// token is the expected token of the bridge, and source is where the
+	// bridge connects from. Unauthenticated workers are never picked.
+	token  string
+	source string
+	auth   int32
+	// services are the services that the bridge registers in its acknowledges.
+	servicesAccess sync.RWMutex
+	services       map[string]bool
 }
 
-func NewPortalWorker(client *mux.ClientWorker) (*PortalWorker, error) {
+// NewPortalWorker creates a PortalWorker over the given bridge connection. If token is not empty,
+// the bridge has to present it in its acknowledges, or the connection is rejected.
+func NewPortalWorker(client *mux.ClientWorker, link *transport.Link, bridge string, token string, source string) (*PortalWorker, error) {
 	opt := []pipe.Option{pipe.WithSizeLimit(16 * 1024)}
 	uplinkReader, uplinkWriter := pipe.New(opt...)
 	downlinkReader, downlinkWriter := pipe.New(opt...)
@@ -216,18 +509,107 @@ func NewPortalWorker(client *mux.ClientWorker) (*PortalWorker, error) {
 		return nil, newError("unable to dispatch control connection")
 	}
 	w := &PortalWorker{
-		client: client,
-		reader: downlinkReader,
-		writer: uplinkWriter,
+		client:  client,
+		reader:  downlinkReader,
+		writer:  uplinkWriter,
+		bridge:  bridge,
+		link:    link,
+		created: time.Now(),
+		token:   token,
+		source:  source,
+	}
+	if token == "" {
+		w.auth = authAccepted
 	}
 	w.control = &task.Periodic{
 		Execute:  w.heartbeat,
 		Interval: time.Second * 2,
 	}
 	w.control.Start()
+	go w.readAcknowledges(downlinkReader)
 	return w, nil
 }
 
+func (w *PortalWorker) readAcknowledges(reader buf.Reader) {
+	for {
+		mb, err := reader.ReadMultiBuffer()
+		if err != nil {
+			return
+		}
+		for _, b := range mb {
+			var ctl Control
+			if err := proto.Unmarshal(b.Bytes(), &ctl); err != nil {
+				newError("failed to parse proto message").Base(err).WriteToLog()
+				continue
+			}
+			if w.token != "" {
+				if subtle.ConstantTimeCompare([]byte(ctl.Token), []byte(w.token)) != 1 {
+					w.reject("invalid token")
+					buf.ReleaseMulti(mb)
+					return
+				}
+				if atomic.CompareAndSwapInt32(&w.auth, authPending, authAccepted) {
+					newError("bridge ", w.bridge, " authenticated from ", w.source).AtInfo().WriteToLog()
+				}
+			}
+			w.updateServices(ctl.Service)
+			atomic.StoreInt64(&w.lastAck, time.Now().UnixNano())
+		}
+		buf.ReleaseMulti(mb)
+	}
+}
+
+func (w *PortalWorker) updateServices(services []string) {
+	w.servicesAccess.Lock()
+	defer w.servicesAccess.Unlock()
+
+	if len(services) == len(w.services) {
+		changed := false
+		for _, service := range services {
+			if !w.services[service] {
+				changed = true
+				break
+			}
+		}
+		if !changed {
+			return
+		}
+	}
+	w.services = make(map[string]bool, len(services))
+	for _, service := range services {
+		w.services[service] = true
+	}
+	if len(services) > 0 {
+		newError("bridge ", w.bridge, " from ", w.source, " provides services ", strings.Join(services, ", ")).AtDebug().WriteToLog()
+	}
+}
+
+// HasService returns true if the bridge has registered the given service.
+func (w *PortalWorker) HasService(service string) bool {
+	w.servicesAccess.RLock()
+	defer w.servicesAccess.RUnlock()
+
+	return w.services[service]
+}
+
+// reject closes the connection of an unauthenticated bridge.
+func (w *PortalWorker) reject(reason string) {
+	if atomic.SwapInt32(&w.auth, authRejected) == authRejected {
+		return
+	}
+	newError("rejected registration of bridge ", w.bridge, " from ", w.source, ": ", reason).AtWarning().WriteToLog()
+	w.teardown()
+}
+
+func (w *PortalWorker) teardown() {
+	common.Close(w.writer)
+	common.Interrupt(w.reader)
+	if w.link != nil {
+		common.Close(w.link.Writer)
+		common.Interrupt(w.link.Reader)
+	}
+}
+
 func (w *PortalWorker) heartbeat() error {
 	if w.client.Closed() {
 		return newError("client worker stopped")
@@ -237,7 +619,24 @@ func (w *PortalWorker) heartbeat() error {
 		return newError("already disposed")
 	}
 
-	msg := &Control{}
+	switch atomic.LoadInt32(&w.auth) {
+	case authRejected:
+		return newError("bridge ", w.bridge, " rejected")
+	case authPending:
+		if time.Since(w.created) > portalAckTimeout {
+			w.reject("no token presented")
+			return newError("bridge ", w.bridge, " rejected")
+		}
+	}
+
+	if !w.IsAlive() {
+		w.teardown()
+		return newError("bridge ", w.bridge, " stopped acknowledging heartbeats").AtWarning()
+	}
+
+	msg := &Control{
+		Acknowledge: true,
+	}
 	msg.FillInRandom()
 
 	if w.client.TotalConnections() > 256 {
@@ -264,3 +663,27 @@ func (w *PortalWorker) IsFull() bool {
 func (w *PortalWorker) Closed() bool {
 	return w.client.Closed()
 }
+
+// Authenticated returns true if the bridge doesn't need authentication, or has presented its token.
+func (w *PortalWorker) Authenticated() bool {
+	return atomic.LoadInt32(&w.auth) == authAccepted
+}
+
+// IsAlive returns false if the worker is closed, rejected, or its bridge stopped acknowledging heartbeats.
+func (w *PortalWorker) IsAlive() bool {
+	if w.Closed() {
+		return false
+	}
+	switch atomic.LoadInt32(&w.auth) {
+	case authRejected:
+		return false
+	case authPending:
+		return time.Since(w.created) < portalAckTimeout
+	}
+	if w.draining {
+		// Control connection is closed while draining, no more acknowledges.
+		return true
+	}
+	last := atomic.LoadInt64(&w.lastAck)
+	return last == 0 || time.Since(time.Unix(0, last)) < portalAckTimeout
+}
@@ -6,6 +6,7 @@ package reverse
 
 import (
 	"context"
+	"strings"
 
 	"v2ray.com/core"
 	"v2ray.com/core/common"
@@ -13,10 +14,13 @@ import (
 	"v2ray.com/core/common/net"
 	"v2ray.com/core/features/outbound"
 	"v2ray.com/core/features/routing"
+	"v2ray.com/core/features/stats"
 )
 
 const (
 	internalDomain = "reverse.internal.v2ray.com"
+	// serviceDomainSuffix follows the tag of a service in the destinations of connections to the service.
+	serviceDomainSuffix = ".service." + internalDomain
 )
 
 func isDomain(dest net.Destination, domain string) bool {
@@ -27,11 +31,41 @@ func isInternalDomain(dest net.Destination) bool {
 	return isDomain(dest, internalDomain)
 }
 
+// isValidServiceTag returns whether tag can be the tag of a service, which is a part of a domain.
+func isValidServiceTag(tag string) bool {
+	if tag == "" {
+		return false
+	}
+	for _, c := range tag {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// serviceDestination is where portals send connections to the service with the given tag, for bridges to relay
+// them to the address of the service.
+func serviceDestination(network net.Network, service string) net.Destination {
+	return net.Destination{
+		Network: network,
+		Address: net.DomainAddress(service + serviceDomainSuffix),
+	}
+}
+
+// serviceOf returns the tag of the service that dest is for, if any.
+func serviceOf(dest net.Destination) (string, bool) {
+	if !dest.Address.Family().IsDomain() || !strings.HasSuffix(dest.Address.Domain(), serviceDomainSuffix) {
+		return "", false
+	}
+	return strings.TrimSuffix(dest.Address.Domain(), serviceDomainSuffix), true
+}
+
 func init() {
 	common.Must(common.RegisterConfig((*Config)(nil), func(ctx context.Context, config interface{}) (interface{}, error) {
 		r := new(Reverse)
-		if err := core.RequireFeatures(ctx, func(d routing.Dispatcher, om outbound.Manager) error {
-			return r.Init(config.(*Config), d, om)
+		if err := core.RequireFeatures(ctx, func(d routing.Dispatcher, om outbound.Manager, sm stats.Manager) error {
+			return r.Init(config.(*Config), d, om, sm)
 		}); err != nil {
 			return nil, err
 		}
@@ -44,7 +78,7 @@ type Reverse struct {
 	portals []*Portal
 }
 
-func (r *Reverse) Init(config *Config, d routing.Dispatcher, ohm outbound.Manager) error {
+func (r *Reverse) Init(config *Config, d routing.Dispatcher, ohm outbound.Manager, sm stats.Manager) error {
 	for _, bConfig := range config.BridgeConfig {
 		b, err := NewBridge(bConfig, d)
 		if err != nil {
@@ -54,7 +88,7 @@ func (r *Reverse) Init(config *Config, d routing.Dispatcher, ohm outbound.Manage
 	}
 
 	for _, pConfig := range config.PortalConfig {
-		p, err := NewPortal(pConfig, ohm)
+		p, err := NewPortal(pConfig, ohm, sm)
 		if err != nil {
 			return err
 		}
@@ -3,8 +3,12 @@
 package router
 
 import (
+	"sort"
+
 	"v2ray.com/core/common/dice"
 	"v2ray.com/core/features/outbound"
+	"v2ray.com/core/features/routing"
+	"v2ray.com/core/features/stats"
 )
 
 type BalancingStrategy interface {
@@ -23,10 +27,77 @@ func (s *RandomStrategy) PickOutbound(tags []string) string {
 	return tags[dice.Roll(n)]
 }
 
+// healthMinSamples is the number of recent dials or sessions needed to judge an outbound.
+const healthMinSamples = 3
+
+// HealthyStrategy picks randomly among the outbounds whose recent connections mostly succeeded,
+// according to the passive data recorded by the stats app. Outbounds without recent data are
+// considered healthy.
+type HealthyStrategy struct {
+	Health stats.HealthRecorder
+}
+
+func isUnhealthy(h *stats.OutboundHealth) bool {
+	if h.Dials >= healthMinSamples && h.Failures*2 >= h.Dials {
+		return true
+	}
+	if h.Sessions >= healthMinSamples && h.Aborted*2 >= h.Sessions {
+		return true
+	}
+	return false
+}
+
+func (s *HealthyStrategy) PickOutbound(tags []string) string {
+	if s.Health != nil {
+		var healthy []string
+		for _, tag := range tags {
+			if h, ok := s.Health.OutboundHealth(tag); ok && isUnhealthy(h) {
+				continue
+			}
+			healthy = append(healthy, tag)
+		}
+		if len(healthy) > 0 {
+			tags = healthy
+		}
+	}
+
+	n := len(tags)
+	if n == 0 {
+		panic("0 tags")
+	}
+
+	return tags[dice.Roll(n)]
+}
+
 type Balancer struct {
-	selectors []string
-	strategy  BalancingStrategy
-	ohm       outbound.Manager
+	selectors  []string
+	strategy   BalancingStrategy
+	ohm        outbound.Manager
+	attributes *RouteAttributes
+}
+
+// State returns the state of the balancer.
+func (b *Balancer) State() (*routing.BalancerState, error) {
+	if s, ok := b.strategy.(*FailoverStrategy); ok {
+		return s.State(), nil
+	}
+	hs, ok := b.ohm.(outbound.HandlerSelector)
+	if !ok {
+		return nil, newError("outbound.Manager is not a HandlerSelector")
+	}
+	tags := hs.Select(b.selectors)
+	sort.Strings(tags)
+	state := new(routing.BalancerState)
+	for _, tag := range tags {
+		healthy := true
+		if s, ok := b.strategy.(*HealthyStrategy); ok && s.Health != nil {
+			if h, ok := s.Health.OutboundHealth(tag); ok && isUnhealthy(h) {
+				healthy = false
+			}
+		}
+		state.Outbounds = append(state.Outbounds, routing.BalancerOutbound{Tag: tag, Healthy: healthy})
+	}
+	return state, nil
 }
 
 func (b *Balancer) PickOutbound() (string, error) {
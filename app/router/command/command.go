@@ -10,6 +10,7 @@ import (
 
 	"google.golang.org/grpc"
 	"v2ray.com/core"
+	"v2ray.com/core/app/router"
 	"v2ray.com/core/common"
 	"v2ray.com/core/features/routing"
 	"v2ray.com/core/features/stats"
@@ -74,6 +75,45 @@ func (s *routingServer) SubscribeRoutingStats(request *SubscribeRoutingStatsRequ
 	}
 }
 
+func (s *routingServer) GetBalancerInfo(ctx context.Context, request *GetBalancerInfoRequest) (*GetBalancerInfoResponse, error) {
+	inspector, ok := s.router.(routing.BalancerInspector)
+	if !ok {
+		return nil, newError("router doesn't support inspecting balancers")
+	}
+	state, err := inspector.GetBalancerState(request.Tag)
+	if err != nil {
+		return nil, err
+	}
+	response := &GetBalancerInfoResponse{Active: state.Active}
+	for _, o := range state.Outbounds {
+		response.Outbounds = append(response.Outbounds, &BalancerOutbound{
+			Tag:     o.Tag,
+			Healthy: o.Healthy,
+		})
+	}
+	return response, nil
+}
+
+// routingUpdater is a router whose rules can be replaced at runtime.
+type routingUpdater interface {
+	Update(*router.Config) error
+}
+
+func (s *routingServer) UpdateRouting(ctx context.Context, request *UpdateRoutingRequest) (*UpdateRoutingResponse, error) {
+	if request.Config == nil {
+		return nil, newError("routing config not specified")
+	}
+	updater, ok := s.router.(routingUpdater)
+	if !ok {
+		return nil, newError("router doesn't support updating")
+	}
+	if err := updater.Update(request.Config); err != nil {
+		return nil, err
+	}
+	newError("routing rules updated").AtInfo().WriteToLog()
+	return &UpdateRoutingResponse{}, nil
+}
+
 func (s *routingServer) mustEmbedUnimplementedRoutingServiceServer() {}
 
 type service struct {
@@ -359,3 +359,42 @@ func TestSerivceTestRoute(t *testing.T) {
 		}
 	}
 }
+
+func TestServiceUpdateRouting(t *testing.T) {
+	r := new(router.Router)
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+	common.Must(r.Init(&router.Config{
+		Rule: []*router.RoutingRule{
+			{
+				InboundTag: []string{"in"},
+				TargetTag:  &router.RoutingRule_Tag{Tag: "old"},
+			},
+		},
+	}, mocks.NewDNSClient(mockCtl), mocks.NewOutboundManager(mockCtl)))
+
+	server := NewRoutingServer(r, nil)
+	if _, err := server.UpdateRouting(context.Background(), &UpdateRoutingRequest{}); err == nil {
+		t.Error("expect error for missing config")
+	}
+	if _, err := server.UpdateRouting(context.Background(), &UpdateRoutingRequest{
+		Config: &router.Config{
+			Rule: []*router.RoutingRule{
+				{
+					InboundTag: []string{"in"},
+					TargetTag:  &router.RoutingRule_Tag{Tag: "new"},
+				},
+			},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	route, err := server.TestRoute(context.Background(), &TestRouteRequest{
+		RoutingContext: &RoutingContext{InboundTag: "in"},
+	})
+	common.Must(err)
+	if route.OutboundTag != "new" {
+		t.Error("expect tag 'new' after update, but actually ", route.OutboundTag)
+	}
+}
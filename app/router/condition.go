@@ -119,9 +119,15 @@ type MultiGeoIPMatcher struct {
 }
 
 func NewMultiGeoIPMatcher(geoips []*GeoIP, onSource bool) (*MultiGeoIPMatcher, error) {
+	return newMultiGeoIPMatcher(new(GeoIPMatcherContainer), geoips, onSource)
+}
+
+// newMultiGeoIPMatcher creates a MultiGeoIPMatcher whose GeoIPs of the same country code share the matchers in
+// container.
+func newMultiGeoIPMatcher(container *GeoIPMatcherContainer, geoips []*GeoIP, onSource bool) (*MultiGeoIPMatcher, error) {
 	var matchers []*GeoIPMatcher
 	for _, geoip := range geoips {
-		matcher, err := globalGeoIPContainer.Add(geoip)
+		matcher, err := container.Add(geoip)
 		if err != nil {
 			return nil, err
 		}
@@ -145,10 +151,18 @@ func (m *MultiGeoIPMatcher) Apply(ctx routing.Context) bool {
 		ips = ctx.GetTargetIPs()
 	}
 	for _, ip := range ips {
-		for _, matcher := range m.matchers {
-			if matcher.Match(ip) {
-				return true
-			}
+		if m.ApplyIP(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ApplyIP returns true if the IP is in any of the GeoIPs of the matcher.
+func (m *MultiGeoIPMatcher) ApplyIP(ip net.IP) bool {
+	for _, matcher := range m.matchers {
+		if matcher.Match(ip) {
+			return true
 		}
 	}
 	return false
@@ -161,6 +161,7 @@ func (m *GeoIPMatcher) Match(ip net.IP) bool {
 }
 
 // GeoIPMatcherContainer is a container for GeoIPMatchers. It keeps unique copies of GeoIPMatcher by country code.
+// It is not safe for concurrent use.
 type GeoIPMatcherContainer struct {
 	matchers []*GeoIPMatcher
 }
@@ -187,7 +188,3 @@ func (c *GeoIPMatcherContainer) Add(geoip *GeoIP) (*GeoIPMatcher, error) {
 	}
 	return m, nil
 }
-
-var (
-	globalGeoIPContainer GeoIPMatcherContainer
-)
@@ -3,7 +3,10 @@
 package router
 
 import (
+	"time"
+
 	"v2ray.com/core/common/net"
+	"v2ray.com/core/common/session"
 	"v2ray.com/core/features/outbound"
 	"v2ray.com/core/features/routing"
 )
@@ -49,8 +52,11 @@ func (l *CIDRList) Swap(i int, j int) {
 
 type Rule struct {
 	Tag       string
+	RuleTag   string
 	Balancer  *Balancer
 	Condition Condition
+	// Attributes are the attributes of the routes picked by the rule, or nil if there are none.
+	Attributes *session.RouteAttributes
 }
 
 func (r *Rule) GetTag() (string, error) {
@@ -66,6 +72,11 @@ func (r *Rule) Apply(ctx routing.Context) bool {
 }
 
 func (rr *RoutingRule) BuildCondition() (Condition, error) {
+	return rr.buildCondition(new(GeoIPMatcherContainer))
+}
+
+// buildCondition builds the condition of the rule, with GeoIP matchers from container.
+func (rr *RoutingRule) buildCondition(container *GeoIPMatcherContainer) (Condition, error) {
 	conds := NewConditionChan()
 
 	if len(rr.Domain) > 0 {
@@ -101,13 +112,13 @@ func (rr *RoutingRule) BuildCondition() (Condition, error) {
 	}
 
 	if len(rr.Geoip) > 0 {
-		cond, err := NewMultiGeoIPMatcher(rr.Geoip, false)
+		cond, err := newMultiGeoIPMatcher(container, rr.Geoip, false)
 		if err != nil {
 			return nil, err
 		}
 		conds.Add(cond)
 	} else if len(rr.Cidr) > 0 {
-		cond, err := NewMultiGeoIPMatcher([]*GeoIP{{Cidr: rr.Cidr}}, false)
+		cond, err := newMultiGeoIPMatcher(container, []*GeoIP{{Cidr: rr.Cidr}}, false)
 		if err != nil {
 			return nil, err
 		}
@@ -115,13 +126,13 @@ func (rr *RoutingRule) BuildCondition() (Condition, error) {
 	}
 
 	if len(rr.SourceGeoip) > 0 {
-		cond, err := NewMultiGeoIPMatcher(rr.SourceGeoip, true)
+		cond, err := newMultiGeoIPMatcher(container, rr.SourceGeoip, true)
 		if err != nil {
 			return nil, err
 		}
 		conds.Add(cond)
 	} else if len(rr.SourceCidr) > 0 {
-		cond, err := NewMultiGeoIPMatcher([]*GeoIP{{Cidr: rr.SourceCidr}}, true)
+		cond, err := newMultiGeoIPMatcher(container, []*GeoIP{{Cidr: rr.SourceCidr}}, true)
 		if err != nil {
 			return nil, err
 		}
@@ -148,9 +159,47 @@ func (rr *RoutingRule) BuildCondition() (Condition, error) {
 }
 
 func (br *BalancingRule) Build(ohm outbound.Manager) (*Balancer, error) {
+	var strategy BalancingStrategy
+	switch br.Strategy {
+	case "", "random":
+		strategy = &RandomStrategy{}
+	case "healthy":
+		strategy = &HealthyStrategy{}
+	case "failover":
+		s, err := NewFailoverStrategy(br.Tag, br.OutboundSelector, ohm, br.Failover)
+		if err != nil {
+			return nil, err
+		}
+		strategy = s
+	default:
+		return nil, newError("unknown balancing strategy: ", br.Strategy)
+	}
 	return &Balancer{
-		selectors: br.OutboundSelector,
-		strategy:  &RandomStrategy{},
-		ohm:       ohm,
+		selectors:  br.OutboundSelector,
+		strategy:   strategy,
+		ohm:        ohm,
+		attributes: br.RouteAttributes,
 	}, nil
 }
+
+// buildRouteAttributes returns the attributes of routes, with unset ones taken from the defaults, which may be
+// nil. It returns nil if no attribute is set, so that routes are the same as without attributes.
+func buildRouteAttributes(attributes *RouteAttributes, defaults *RouteAttributes) *session.RouteAttributes {
+	pick := func(value, defaultValue uint32) uint32 {
+		if value > 0 {
+			return value
+		}
+		return defaultValue
+	}
+	handshakeTimeout := pick(attributes.GetHandshakeTimeout(), defaults.GetHandshakeTimeout())
+	firstByteTimeout := pick(attributes.GetFirstByteTimeout(), defaults.GetFirstByteTimeout())
+	retries := pick(attributes.GetRetries(), defaults.GetRetries())
+	if handshakeTimeout == 0 && firstByteTimeout == 0 && retries == 0 {
+		return nil
+	}
+	return &session.RouteAttributes{
+		HandshakeTimeout: time.Duration(handshakeTimeout) * time.Second,
+		FirstByteTimeout: time.Duration(firstByteTimeout) * time.Second,
+		Retries:          retries,
+	}
+}
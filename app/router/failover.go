@@ -0,0 +1,328 @@
+// +build !confonly
+
+package router
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"v2ray.com/core/common/net"
+	"v2ray.com/core/common/session"
+	"v2ray.com/core/common/signal/done"
+	"v2ray.com/core/features/events"
+	"v2ray.com/core/features/outbound"
+	"v2ray.com/core/features/routing"
+	"v2ray.com/core/features/stats"
+)
+
+const (
+	defaultProbeURL          = "https://www.gstatic.com/generate_204"
+	defaultProbeInterval     = 30 * time.Second
+	defaultProbeTimeout      = 10 * time.Second
+	defaultFailThreshold     = 3
+	defaultRecoveryThreshold = 3
+	defaultMinHold           = time.Minute
+)
+
+// failoverOutbound is the health of an outbound, as judged by consecutive health checks.
+type failoverOutbound struct {
+	up        bool
+	failures  uint32
+	successes uint32
+}
+
+// FailoverStrategy sticks to the first outbound, in the order of the selectors, that passes health
+// checks. It switches back to a preferred outbound only after the outbound recovers and the current
+// one has been used for a while.
+type FailoverStrategy struct {
+	tag               string
+	selectors         []string
+	ohm               outbound.Manager
+	probeURL          string
+	probeInterval     time.Duration
+	probeTimeout      time.Duration
+	failThreshold     uint32
+	recoveryThreshold uint32
+	minHold           time.Duration
+
+	access   sync.Mutex
+	status   map[string]*failoverOutbound
+	active   string
+	switched time.Time
+	gauge    stats.Counter
+	emit     func(*events.Event)
+	done     *done.Instance
+}
+
+// NewFailoverStrategy creates a failover strategy for the balancer with the given tag.
+func NewFailoverStrategy(tag string, selectors []string, ohm outbound.Manager, config *FailoverConfig) (*FailoverStrategy, error) {
+	if config == nil {
+		config = &FailoverConfig{}
+	}
+	s := &FailoverStrategy{
+		tag:               tag,
+		selectors:         selectors,
+		ohm:               ohm,
+		probeURL:          config.ProbeUrl,
+		probeInterval:     time.Duration(config.ProbeInterval) * time.Second,
+		probeTimeout:      time.Duration(config.ProbeTimeout) * time.Second,
+		failThreshold:     config.FailThreshold,
+		recoveryThreshold: config.RecoveryThreshold,
+		minHold:           time.Duration(config.MinHold) * time.Second,
+		status:            make(map[string]*failoverOutbound),
+		done:              done.New(),
+	}
+	if s.probeURL == "" {
+		s.probeURL = defaultProbeURL
+	}
+	if u, err := url.Parse(s.probeURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, newError("invalid probe URL of balancer ", tag, ": ", s.probeURL)
+	}
+	if s.probeInterval == 0 {
+		s.probeInterval = defaultProbeInterval
+	}
+	if s.probeTimeout == 0 {
+		s.probeTimeout = defaultProbeTimeout
+	}
+	if s.failThreshold == 0 {
+		s.failThreshold = defaultFailThreshold
+	}
+	if s.recoveryThreshold == 0 {
+		s.recoveryThreshold = defaultRecoveryThreshold
+	}
+	if config.MinHold == 0 {
+		s.minHold = defaultMinHold
+	}
+	return s, nil
+}
+
+// orderedTags returns the tags of the outbounds in the order of preference.
+func (s *FailoverStrategy) orderedTags() []string {
+	hs, ok := s.ohm.(outbound.HandlerSelector)
+	if !ok {
+		return nil
+	}
+	var tags []string
+	seen := make(map[string]bool)
+	for _, selector := range s.selectors {
+		selected := hs.Select([]string{selector})
+		sort.Strings(selected)
+		for _, tag := range selected {
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
+
+// isUp must be called with access held.
+func (s *FailoverStrategy) isUp(tag string) bool {
+	status, found := s.status[tag]
+	return !found || status.up
+}
+
+// setActive must be called with access held.
+func (s *FailoverStrategy) setActive(tag string, tags []string) {
+	if s.active != "" {
+		newError("balancer ", s.tag, " switched from ", s.active, " to ", tag).AtWarning().WriteToLog()
+	}
+	s.active = tag
+	s.switched = time.Now()
+	if s.gauge != nil {
+		for i, t := range tags {
+			if t == tag {
+				s.gauge.Set(int64(i))
+			}
+		}
+	}
+}
+
+// PickOutbound implements BalancingStrategy.
+func (s *FailoverStrategy) PickOutbound(tags []string) string {
+	s.access.Lock()
+	defer s.access.Unlock()
+
+	for _, tag := range tags {
+		if tag == s.active {
+			return tag
+		}
+	}
+
+	// The active outbound is gone, or none was picked yet.
+	candidates := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		candidates[tag] = true
+	}
+	ordered := s.orderedTags()
+	for _, tag := range ordered {
+		if candidates[tag] && s.isUp(tag) {
+			s.setActive(tag, ordered)
+			return tag
+		}
+	}
+	return tags[0]
+}
+
+func (s *FailoverStrategy) emitHealth(eventType string, tag string) {
+	if s.emit != nil {
+		s.emit(events.New(eventType, map[string]interface{}{"tag": tag, "balancer": s.tag}))
+	}
+}
+
+// update records the results of a round of health checks, and switches the active outbound if needed.
+func (s *FailoverStrategy) update(tags []string, results []bool) {
+	s.access.Lock()
+	defer s.access.Unlock()
+
+	status := make(map[string]*failoverOutbound, len(tags))
+	for i, tag := range tags {
+		o, found := s.status[tag]
+		if !found {
+			o = &failoverOutbound{up: true}
+		}
+		if results[i] {
+			o.failures = 0
+			o.successes++
+			if !o.up && o.successes >= s.recoveryThreshold {
+				o.up = true
+				newError("outbound ", tag, " of balancer ", s.tag, " recovered").AtInfo().WriteToLog()
+				s.emitHealth(events.OutboundHealthy, tag)
+			}
+		} else {
+			o.successes = 0
+			o.failures++
+			if o.up && o.failures >= s.failThreshold {
+				o.up = false
+				newError("outbound ", tag, " of balancer ", s.tag, " failed health checks").AtWarning().WriteToLog()
+				s.emitHealth(events.OutboundUnhealthy, tag)
+			}
+		}
+		status[tag] = o
+	}
+	s.status = status
+
+	preferred := ""
+	for _, tag := range tags {
+		if s.status[tag].up {
+			preferred = tag
+			break
+		}
+	}
+	if preferred == "" || preferred == s.active {
+		return
+	}
+
+	activeIndex := -1
+	for i, tag := range tags {
+		if tag == s.active {
+			activeIndex = i
+		}
+	}
+	switch {
+	case activeIndex < 0 || !s.status[s.active].up:
+		s.setActive(preferred, tags)
+	case time.Since(s.switched) >= s.minHold:
+		// The preferred outbound comes before the active one, as the active one is up.
+		s.setActive(preferred, tags)
+	}
+}
+
+// check runs a round of health checks on all the outbounds.
+func (s *FailoverStrategy) check() {
+	tags := s.orderedTags()
+	results := make([]bool, len(tags))
+	var wg sync.WaitGroup
+	for i, tag := range tags {
+		wg.Add(1)
+		go func(i int, tag string) {
+			defer wg.Done()
+			if err := s.probe(tag); err != nil {
+				newError("health check of outbound ", tag, " failed").Base(err).AtDebug().WriteToLog()
+				return
+			}
+			results[i] = true
+		}(i, tag)
+	}
+	wg.Wait()
+	s.update(tags, results)
+}
+
+// probe requests the probe URL through the outbound.
+func (s *FailoverStrategy) probe(tag string) error {
+	handler := s.ohm.GetHandler(tag)
+	if handler == nil {
+		return newError("outbound not found")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.probeTimeout)
+	defer cancel()
+	ctx = session.ContextWithID(ctx, session.NewID())
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				dest, err := net.ParseDestination(network + ":" + addr)
+				if err != nil {
+					return nil, err
+				}
+				return outbound.Dial(ctx, handler, dest), nil
+			},
+			DisableKeepAlives: true,
+		},
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, s.probeURL, nil)
+	if err != nil {
+		return err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	return nil
+}
+
+// Start implements common.Runnable.
+func (s *FailoverStrategy) Start() error {
+	go func() {
+		ticker := time.NewTicker(s.probeInterval)
+		defer ticker.Stop()
+		for {
+			s.check()
+			select {
+			case <-s.done.Wait():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return nil
+}
+
+// Close implements common.Closable.
+func (s *FailoverStrategy) Close() error {
+	return s.done.Close()
+}
+
+// State returns the active outbound and the health of the outbounds.
+func (s *FailoverStrategy) State() *routing.BalancerState {
+	tags := s.orderedTags()
+
+	s.access.Lock()
+	defer s.access.Unlock()
+
+	state := &routing.BalancerState{Active: s.active}
+	for _, tag := range tags {
+		state.Outbounds = append(state.Outbounds, routing.BalancerOutbound{
+			Tag:     tag,
+			Healthy: s.isUp(tag),
+		})
+	}
+	return state
+}
@@ -0,0 +1,54 @@
+package router
+
+import (
+	"testing"
+	"time"
+
+	"v2ray.com/core/app/stats"
+	"v2ray.com/core/common"
+)
+
+func TestFailoverStrategyHysteresis(t *testing.T) {
+	s, err := NewFailoverStrategy("b", nil, nil, &FailoverConfig{
+		FailThreshold:     2,
+		RecoveryThreshold: 2,
+	})
+	common.Must(err)
+	gauge := new(stats.Counter)
+	s.gauge = gauge
+
+	tags := []string{"main", "backup"}
+	steps := []struct {
+		results []bool
+		active  string
+	}{
+		{[]bool{true, true}, "main"},
+		{[]bool{false, true}, "main"},
+		{[]bool{false, true}, "backup"},
+		{[]bool{true, true}, "backup"},
+		// Main has recovered, but backup is held for a while.
+		{[]bool{true, true}, "backup"},
+	}
+	for i, step := range steps {
+		s.update(tags, step.results)
+		if s.active != step.active {
+			t.Fatal("step ", i, ": active ", s.active, ", want ", step.active)
+		}
+	}
+	if v := gauge.Value(); v != 1 {
+		t.Error("gauge: ", v)
+	}
+
+	s.switched = time.Now().Add(-2 * defaultMinHold)
+	s.update(tags, []bool{true, true})
+	if s.active != "main" {
+		t.Error("not switched back to main after hold time, active ", s.active)
+	}
+	if v := gauge.Value(); v != 0 {
+		t.Error("gauge: ", v)
+	}
+
+	if _, err := NewFailoverStrategy("b", nil, nil, &FailoverConfig{ProbeUrl: "ftp://example.com"}); err == nil {
+		t.Error("expected error for non HTTP probe URL")
+	}
+}
@@ -6,21 +6,39 @@ package router
 
 import (
 	"context"
+	"sync"
 
 	"v2ray.com/core"
 	"v2ray.com/core/common"
+	"v2ray.com/core/common/errors"
+	"v2ray.com/core/common/session"
 	"v2ray.com/core/features/dns"
+	"v2ray.com/core/features/events"
 	"v2ray.com/core/features/outbound"
 	"v2ray.com/core/features/routing"
 	routing_dns "v2ray.com/core/features/routing/dns"
+	"v2ray.com/core/features/stats"
 )
 
 // Router is an implementation of routing.Router.
 type Router struct {
+	access  sync.RWMutex
+	table   *routingTable
+	started bool
+
+	dns    dns.Client
+	ohm    outbound.Manager
+	health stats.HealthRecorder
+	stats  stats.Manager
+	// emit sends events of balancers, if the instance has an events.Emitter.
+	emit func(*events.Event)
+}
+
+// routingTable is the rules and balancers of a Router, which are replaced as a whole on update.
+type routingTable struct {
 	domainStrategy Config_DomainStrategy
 	rules          []*Rule
 	balancers      map[string]*Balancer
-	dns            dns.Client
 }
 
 // Route is an implementation of routing.Route.
@@ -28,49 +46,113 @@ type Route struct {
 	routing.Context
 	outboundGroupTags []string
 	outboundTag       string
+	ruleTag           string
+	attributes        *session.RouteAttributes
 }
 
-// Init initializes the Router.
-func (r *Router) Init(config *Config, d dns.Client, ohm outbound.Manager) error {
-	r.domainStrategy = config.DomainStrategy
-	r.dns = d
+func newRoutingTable(config *Config, ohm outbound.Manager) (*routingTable, error) {
+	t := &routingTable{
+		domainStrategy: config.DomainStrategy,
+		balancers:      make(map[string]*Balancer, len(config.BalancingRule)),
+		rules:          make([]*Rule, 0, len(config.Rule)),
+	}
 
-	r.balancers = make(map[string]*Balancer, len(config.BalancingRule))
 	for _, rule := range config.BalancingRule {
 		balancer, err := rule.Build(ohm)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		r.balancers[rule.Tag] = balancer
+		t.balancers[rule.Tag] = balancer
 	}
 
-	r.rules = make([]*Rule, 0, len(config.Rule))
+	// Rules of the table share matchers of GeoIPs, which are not shared with other routers.
+	geoips := new(GeoIPMatcherContainer)
 	for _, rule := range config.Rule {
-		cond, err := rule.BuildCondition()
+		cond, err := rule.buildCondition(geoips)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		rr := &Rule{
 			Condition: cond,
 			Tag:       rule.GetTag(),
+			RuleTag:   rule.GetRuleTag(),
 		}
+		var defaults *RouteAttributes
 		btag := rule.GetBalancingTag()
 		if len(btag) > 0 {
-			brule, found := r.balancers[btag]
+			brule, found := t.balancers[btag]
 			if !found {
-				return newError("balancer ", btag, " not found")
+				return nil, newError("balancer ", btag, " not found")
 			}
 			rr.Balancer = brule
+			defaults = brule.attributes
 		}
-		r.rules = append(r.rules, rr)
+		rr.Attributes = buildRouteAttributes(rule.RouteAttributes, defaults)
+		t.rules = append(t.rules, rr)
 	}
 
+	return t, nil
+}
+
+// Init initializes the Router.
+func (r *Router) Init(config *Config, d dns.Client, ohm outbound.Manager) error {
+	r.dns = d
+	r.ohm = ohm
+
+	table, err := newRoutingTable(config, ohm)
+	if err != nil {
+		return err
+	}
+	r.table = table
 	return nil
 }
 
+// Update replaces the rules and balancers of the Router with the ones of the config. Routes being picked
+// are completed with the previous rules, and the balancers of the previous rules are closed.
+func (r *Router) Update(config *Config) error {
+	table, err := newRoutingTable(config, r.ohm)
+	if err != nil {
+		return newError("failed to build routing rules").Base(err)
+	}
+
+	r.access.Lock()
+	defer r.access.Unlock()
+
+	if r.health != nil {
+		table.useHealthRecorder(r.health)
+	}
+	if r.stats != nil {
+		table.registerBalancerStats(r.stats)
+	}
+	if r.emit != nil {
+		table.useEmitter(r.emit)
+	}
+	if r.started {
+		if err := table.start(); err != nil {
+			table.close()
+			return err
+		}
+	}
+
+	previous := r.table
+	r.table = table
+	if r.started {
+		if err := previous.close(); err != nil {
+			newError("failed to close previous balancers").Base(err).AtWarning().WriteToLog()
+		}
+	}
+	return nil
+}
+
+func (r *Router) getTable() *routingTable {
+	r.access.RLock()
+	defer r.access.RUnlock()
+	return r.table
+}
+
 // PickRoute implements routing.Router.
 func (r *Router) PickRoute(ctx routing.Context) (routing.Route, error) {
-	rule, ctx, err := r.pickRouteInternal(ctx)
+	rule, ctx, err := r.pickRouteInternal(r.getTable(), ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -78,33 +160,33 @@ func (r *Router) PickRoute(ctx routing.Context) (routing.Route, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &Route{Context: ctx, outboundTag: tag}, nil
+	return &Route{Context: ctx, outboundTag: tag, ruleTag: rule.RuleTag, attributes: rule.Attributes}, nil
 }
 
-func (r *Router) pickRouteInternal(ctx routing.Context) (*Rule, routing.Context, error) {
+func (r *Router) pickRouteInternal(t *routingTable, ctx routing.Context) (*Rule, routing.Context, error) {
 	// SkipDNSResolve is set from DNS module.
 	// the DOH remote server maybe a domain name,
 	// this prevents cycle resolving dead loop
 	skipDNSResolve := ctx.GetSkipDNSResolve()
 
-	if r.domainStrategy == Config_IpOnDemand && !skipDNSResolve {
+	if t.domainStrategy == Config_IpOnDemand && !skipDNSResolve {
 		ctx = routing_dns.ContextWithDNSClient(ctx, r.dns)
 	}
 
-	for _, rule := range r.rules {
+	for _, rule := range t.rules {
 		if rule.Apply(ctx) {
 			return rule, ctx, nil
 		}
 	}
 
-	if r.domainStrategy != Config_IpIfNonMatch || len(ctx.GetTargetDomain()) == 0 || skipDNSResolve {
+	if t.domainStrategy != Config_IpIfNonMatch || len(ctx.GetTargetDomain()) == 0 || skipDNSResolve {
 		return nil, ctx, common.ErrNoClue
 	}
 
 	ctx = routing_dns.ContextWithDNSClient(ctx, r.dns)
 
 	// Try applying rules again if we have IPs.
-	for _, rule := range r.rules {
+	for _, rule := range t.rules {
 		if rule.Apply(ctx) {
 			return rule, ctx, nil
 		}
@@ -113,14 +195,52 @@ func (r *Router) pickRouteInternal(ctx routing.Context) (*Rule, routing.Context,
 	return nil, ctx, common.ErrNoClue
 }
 
-// Start implements common.Runnable.
-func (*Router) Start() error {
+func (t *routingTable) start() error {
+	for _, balancer := range t.balancers {
+		if runnable, ok := balancer.strategy.(common.Runnable); ok {
+			if err := runnable.Start(); err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
 
+func (t *routingTable) close() error {
+	var errs []error
+	for _, balancer := range t.balancers {
+		if closable, ok := balancer.strategy.(common.Closable); ok {
+			if err := closable.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Combine(errs...)
+}
+
+// Start implements common.Runnable.
+func (r *Router) Start() error {
+	r.access.Lock()
+	defer r.access.Unlock()
+	r.started = true
+	return r.table.start()
+}
+
 // Close implements common.Closable.
-func (*Router) Close() error {
-	return nil
+func (r *Router) Close() error {
+	r.access.Lock()
+	defer r.access.Unlock()
+	r.started = false
+	return r.table.close()
+}
+
+// GetBalancerState implements routing.BalancerInspector.
+func (r *Router) GetBalancerState(tag string) (*routing.BalancerState, error) {
+	balancer, found := r.getTable().balancers[tag]
+	if !found {
+		return nil, newError("balancer ", tag, " not found")
+	}
+	return balancer.State()
 }
 
 // Type implement common.HasType.
@@ -138,11 +258,77 @@ func (r *Route) GetOutboundTag() string {
 	return r.outboundTag
 }
 
+// GetRuleTag implements routing.Route.
+func (r *Route) GetRuleTag() string {
+	return r.ruleTag
+}
+
+// GetRouteAttributes implements routing.AttributedRoute.
+func (r *Route) GetRouteAttributes() *session.RouteAttributes {
+	return r.attributes
+}
+
+// useHealthRecorder lets health aware balancers use the passive data of the recorder.
+func (r *Router) useHealthRecorder(health stats.HealthRecorder) {
+	r.health = health
+	r.table.useHealthRecorder(health)
+}
+
+func (t *routingTable) useHealthRecorder(health stats.HealthRecorder) {
+	for _, balancer := range t.balancers {
+		if strategy, ok := balancer.strategy.(*HealthyStrategy); ok {
+			strategy.Health = health
+		}
+	}
+}
+
+// useEmitter lets failover balancers emit events of the health of their outbounds.
+func (r *Router) useEmitter(emit func(*events.Event)) {
+	r.emit = emit
+	r.table.useEmitter(emit)
+}
+
+func (t *routingTable) useEmitter(emit func(*events.Event)) {
+	for _, balancer := range t.balancers {
+		if strategy, ok := balancer.strategy.(*FailoverStrategy); ok {
+			strategy.emit = emit
+		}
+	}
+}
+
+// registerBalancerStats registers the gauges of the outbounds that failover balancers use, as their
+// indices in the order of preference.
+func (r *Router) registerBalancerStats(sm stats.Manager) {
+	r.stats = sm
+	r.table.registerBalancerStats(sm)
+}
+
+func (t *routingTable) registerBalancerStats(sm stats.Manager) {
+	for tag, balancer := range t.balancers {
+		if strategy, ok := balancer.strategy.(*FailoverStrategy); ok {
+			c, _ := stats.GetOrRegisterCounter(sm, "balancer>>>"+tag+">>>active")
+			strategy.gauge = c
+		}
+	}
+}
+
 func init() {
 	common.Must(common.RegisterConfig((*Config)(nil), func(ctx context.Context, config interface{}) (interface{}, error) {
 		r := new(Router)
-		if err := core.RequireFeatures(ctx, func(d dns.Client, ohm outbound.Manager) error {
-			return r.Init(config.(*Config), d, ohm)
+		if err := core.RequireFeatures(ctx, func(d dns.Client, ohm outbound.Manager, sm stats.Manager) error {
+			if err := r.Init(config.(*Config), d, ohm); err != nil {
+				return err
+			}
+			if health, ok := sm.(stats.HealthRecorder); ok {
+				r.useHealthRecorder(health)
+			}
+			r.registerBalancerStats(sm)
+			if v := core.FromContext(ctx); v != nil {
+				r.useEmitter(func(event *events.Event) {
+					events.Emit(v, event)
+				})
+			}
+			return nil
 		}); err != nil {
 			return nil, err
 		}
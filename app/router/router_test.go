@@ -2,14 +2,20 @@ package router_test
 
 import (
 	"context"
+	"errors"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
+	"github.com/google/go-cmp/cmp"
 	. "v2ray.com/core/app/router"
+	"v2ray.com/core/app/stats"
 	"v2ray.com/core/common"
 	"v2ray.com/core/common/net"
 	"v2ray.com/core/common/session"
 	"v2ray.com/core/features/outbound"
+	"v2ray.com/core/features/routing"
 	routing_session "v2ray.com/core/features/routing/session"
 	"v2ray.com/core/testing/mocks"
 )
@@ -52,6 +58,90 @@ func TestSimpleRouter(t *testing.T) {
 	}
 }
 
+func TestUpdateWhilePickingRoutes(t *testing.T) {
+	configWithTag := func(tag string) *Config {
+		return &Config{
+			Rule: []*RoutingRule{
+				{
+					TargetTag: &RoutingRule_Tag{
+						Tag: tag,
+					},
+					Domain: []*Domain{
+						{
+							Type:  Domain_Domain,
+							Value: "v2ray.com",
+						},
+					},
+				},
+			},
+		}
+	}
+
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+
+	mockDNS := mocks.NewDNSClient(mockCtl)
+	mockOhm := mocks.NewOutboundManager(mockCtl)
+	mockHs := mocks.NewOutboundHandlerSelector(mockCtl)
+
+	r := new(Router)
+	common.Must(r.Init(configWithTag("old"), mockDNS, &mockOutboundManager{
+		Manager:         mockOhm,
+		HandlerSelector: mockHs,
+	}))
+	common.Must(r.Start())
+	defer r.Close()
+
+	ctx := session.ContextWithOutbound(context.Background(), &session.Outbound{Target: net.TCPDestination(net.DomainAddress("www.v2ray.com"), 80)})
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				route, err := r.PickRoute(routing_session.AsRoutingContext(ctx))
+				if err != nil {
+					errs <- err
+					return
+				}
+				if tag := route.GetOutboundTag(); tag != "old" && tag != "new" {
+					errs <- errors.New("unexpected tag " + tag)
+					return
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < 200; i++ {
+		tag := "old"
+		if i%2 == 0 {
+			tag = "new"
+		}
+		common.Must(r.Update(configWithTag(tag)))
+	}
+	close(done)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	common.Must(r.Update(configWithTag("new")))
+	route, err := r.PickRoute(routing_session.AsRoutingContext(ctx))
+	common.Must(err)
+	if tag := route.GetOutboundTag(); tag != "new" {
+		t.Error("expect tag 'new' after update, but actually ", tag)
+	}
+}
+
 func TestSimpleBalancer(t *testing.T) {
 	config := &Config{
 		Rule: []*RoutingRule{
@@ -93,6 +183,91 @@ func TestSimpleBalancer(t *testing.T) {
 	}
 }
 
+func TestRouteAttributes(t *testing.T) {
+	config := &Config{
+		Rule: []*RoutingRule{
+			{
+				TargetTag: &RoutingRule_BalancingTag{
+					BalancingTag: "balance",
+				},
+				PortList: &net.PortList{Range: []*net.PortRange{{From: 443, To: 443}}},
+				RouteAttributes: &RouteAttributes{
+					HandshakeTimeout: 30,
+				},
+			},
+			{
+				TargetTag: &RoutingRule_Tag{
+					Tag: "test",
+				},
+				PortList: &net.PortList{Range: []*net.PortRange{{From: 80, To: 80}}},
+			},
+		},
+		BalancingRule: []*BalancingRule{
+			{
+				Tag:              "balance",
+				OutboundSelector: []string{"test-"},
+				RouteAttributes: &RouteAttributes{
+					HandshakeTimeout: 10,
+					Retries:          2,
+				},
+			},
+		},
+	}
+
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+
+	mockDNS := mocks.NewDNSClient(mockCtl)
+	mockOhm := mocks.NewOutboundManager(mockCtl)
+	mockHs := mocks.NewOutboundHandlerSelector(mockCtl)
+
+	mockHs.EXPECT().Select(gomock.Eq([]string{"test-"})).Return([]string{"test"})
+
+	r := new(Router)
+	common.Must(r.Init(config, mockDNS, &mockOutboundManager{
+		Manager:         mockOhm,
+		HandlerSelector: mockHs,
+	}))
+
+	pickAttributes := func(port net.Port) *session.RouteAttributes {
+		ctx := session.ContextWithOutbound(context.Background(), &session.Outbound{Target: net.TCPDestination(net.DomainAddress("v2ray.com"), port)})
+		route, err := r.PickRoute(routing_session.AsRoutingContext(ctx))
+		common.Must(err)
+		return route.(routing.AttributedRoute).GetRouteAttributes()
+	}
+
+	// Attributes unset by the rule are taken from the balancer.
+	if r := cmp.Diff(pickAttributes(443), &session.RouteAttributes{
+		HandshakeTimeout: time.Second * 30,
+		Retries:          2,
+	}); r != "" {
+		t.Error(r)
+	}
+	if attributes := pickAttributes(80); attributes != nil {
+		t.Error("expect no attributes, but got ", attributes)
+	}
+}
+
+func TestHealthyStrategy(t *testing.T) {
+	m, err := stats.NewManager(context.Background(), &stats.Config{})
+	common.Must(err)
+
+	for i := 0; i < 3; i++ {
+		m.RecordDial("broken", time.Millisecond, errors.New("failed"))
+		m.RecordDial("working", time.Millisecond, nil)
+	}
+
+	strategy := &HealthyStrategy{Health: m}
+	for i := 0; i < 20; i++ {
+		if tag := strategy.PickOutbound([]string{"broken", "working", "unknown"}); tag == "broken" {
+			t.Fatal("unhealthy outbound picked")
+		}
+	}
+	if tag := strategy.PickOutbound([]string{"broken"}); tag != "broken" {
+		t.Error("expected an outbound even if all are unhealthy, but got ", tag)
+	}
+}
+
 func TestIPOnDemand(t *testing.T) {
 	config := &Config{
 		DomainStrategy: Config_IpOnDemand,
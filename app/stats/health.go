@@ -0,0 +1,200 @@
+// +build !confonly
+
+package stats
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"v2ray.com/core/features/stats"
+)
+
+const (
+	// healthWindow is how long samples of an outbound are kept.
+	healthWindow = 5 * time.Minute
+	// healthMaxSamples limits the samples of each kind kept for an outbound.
+	healthMaxSamples = 256
+)
+
+type dialSample struct {
+	time    time.Time
+	latency time.Duration
+	failed  bool
+}
+
+type sessionSample struct {
+	time    time.Time
+	aborted bool
+}
+
+// outboundHealth is a rolling window of the connections of an outbound.
+type outboundHealth struct {
+	access   sync.Mutex
+	dials    []dialSample
+	sessions []sessionSample
+}
+
+func (h *outboundHealth) addDial(s dialSample) {
+	h.access.Lock()
+	defer h.access.Unlock()
+
+	h.dials = append(h.dials, s)
+	if len(h.dials) > healthMaxSamples {
+		h.dials = h.dials[len(h.dials)-healthMaxSamples:]
+	}
+}
+
+func (h *outboundHealth) addSession(s sessionSample) {
+	h.access.Lock()
+	defer h.access.Unlock()
+
+	h.sessions = append(h.sessions, s)
+	if len(h.sessions) > healthMaxSamples {
+		h.sessions = h.sessions[len(h.sessions)-healthMaxSamples:]
+	}
+}
+
+// summary must be called with access held.
+func (h *outboundHealth) summary(now time.Time) *stats.OutboundHealth {
+	expire := now.Add(-healthWindow)
+	for len(h.dials) > 0 && h.dials[0].time.Before(expire) {
+		h.dials = h.dials[1:]
+	}
+	for len(h.sessions) > 0 && h.sessions[0].time.Before(expire) {
+		h.sessions = h.sessions[1:]
+	}
+
+	summary := &stats.OutboundHealth{
+		Dials:    len(h.dials),
+		Sessions: len(h.sessions),
+	}
+	var latencies []time.Duration
+	for _, s := range h.dials {
+		if s.failed {
+			summary.Failures++
+		} else {
+			latencies = append(latencies, s.latency)
+		}
+		if s.time.After(summary.Updated) {
+			summary.Updated = s.time
+		}
+	}
+	for _, s := range h.sessions {
+		if s.aborted {
+			summary.Aborted++
+		}
+		if s.time.After(summary.Updated) {
+			summary.Updated = s.time
+		}
+	}
+	if len(latencies) > 0 {
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		summary.LatencyP50 = latencies[(len(latencies)-1)*50/100]
+		summary.LatencyP95 = latencies[(len(latencies)-1)*95/100]
+	}
+	return summary
+}
+
+func (h *outboundHealth) Summary() *stats.OutboundHealth {
+	h.access.Lock()
+	defer h.access.Unlock()
+
+	return h.summary(time.Now())
+}
+
+// healthGauge is a stats.Counter whose value is derived from the health of an outbound. It can't be
+// set or reset.
+type healthGauge struct {
+	health *outboundHealth
+	value  func(*stats.OutboundHealth) int64
+}
+
+// Value implements stats.Counter.
+func (g *healthGauge) Value() int64 {
+	return g.value(g.health.Summary())
+}
+
+// Set implements stats.Counter.
+func (g *healthGauge) Set(int64) int64 {
+	return g.Value()
+}
+
+// Add implements stats.Counter.
+func (g *healthGauge) Add(int64) int64 {
+	return g.Value()
+}
+
+var healthGauges = map[string]func(*stats.OutboundHealth) int64{
+	"latency>>>p50": func(h *stats.OutboundHealth) int64 {
+		return int64(h.LatencyP50 / time.Millisecond)
+	},
+	"latency>>>p95": func(h *stats.OutboundHealth) int64 {
+		return int64(h.LatencyP95 / time.Millisecond)
+	},
+	"dial>>>failure": func(h *stats.OutboundHealth) int64 {
+		return int64(h.Failures)
+	},
+	"session>>>aborted": func(h *stats.OutboundHealth) int64 {
+		return int64(h.Aborted)
+	},
+}
+
+// getOrCreateHealth returns the health of the outbound, and registers its gauges on first use.
+func (m *Manager) getOrCreateHealth(tag string) *outboundHealth {
+	m.access.RLock()
+	h, found := m.healths[tag]
+	m.access.RUnlock()
+	if found {
+		return h
+	}
+
+	m.access.Lock()
+	defer m.access.Unlock()
+
+	if h, found := m.healths[tag]; found {
+		return h
+	}
+	h = new(outboundHealth)
+	m.healths[tag] = h
+	for suffix, value := range healthGauges {
+		name := "outbound>>>" + tag + ">>>" + suffix
+		if _, found := m.counters[name]; !found {
+			m.counters[name] = &healthGauge{health: h, value: value}
+		}
+	}
+	return h
+}
+
+// RecordDial implements stats.HealthRecorder.
+func (m *Manager) RecordDial(tag string, latency time.Duration, err error) {
+	m.getOrCreateHealth(tag).addDial(dialSample{
+		time:    time.Now(),
+		latency: latency,
+		failed:  err != nil,
+	})
+}
+
+// RecordSession implements stats.HealthRecorder.
+func (m *Manager) RecordSession(tag string, aborted bool) {
+	m.getOrCreateHealth(tag).addSession(sessionSample{
+		time:    time.Now(),
+		aborted: aborted,
+	})
+}
+
+// OutboundHealth implements stats.HealthRecorder.
+func (m *Manager) OutboundHealth(tag string) (*stats.OutboundHealth, bool) {
+	m.access.RLock()
+	h, found := m.healths[tag]
+	m.access.RUnlock()
+	if !found {
+		return nil, false
+	}
+
+	summary := h.Summary()
+	if summary.Dials == 0 && summary.Sessions == 0 {
+		return nil, false
+	}
+	return summary, true
+}
@@ -0,0 +1,123 @@
+// +build !confonly
+
+package stats
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"v2ray.com/core/common/task"
+)
+
+const defaultPersistenceInterval = 5 * time.Minute
+
+// persistedCounters is the content of the persistence file.
+type persistedCounters struct {
+	Counters map[string]int64 `json:"counters"`
+}
+
+// restoreCounters loads the persistence file. Saved values are added to the counters already
+// registered, and are kept for the others until they are registered, as counters of users are
+// only registered on first use.
+func (m *Manager) restoreCounters() error {
+	data, err := ioutil.ReadFile(m.persistenceFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return newError("failed to read counters from ", m.persistenceFile).Base(err)
+	}
+	var saved persistedCounters
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return newError("failed to parse counters in ", m.persistenceFile).Base(err)
+	}
+
+	m.access.Lock()
+	defer m.access.Unlock()
+
+	for name, value := range saved.Counters {
+		if c, found := m.counters[name]; found {
+			if c, ok := c.(*Counter); ok {
+				c.Add(value)
+			}
+			continue
+		}
+		m.restored[name] = value
+	}
+	newError("restored ", len(saved.Counters), " counters from ", m.persistenceFile).AtInfo().WriteToLog()
+	return nil
+}
+
+// saveCounters writes the counters to the persistence file, along with the restored values of
+// counters not registered since.
+func (m *Manager) saveCounters() error {
+	saved := persistedCounters{
+		Counters: make(map[string]int64),
+	}
+	m.access.RLock()
+	for name, value := range m.restored {
+		saved.Counters[name] = value
+	}
+	for name, c := range m.counters {
+		if c, ok := c.(*Counter); ok {
+			saved.Counters[name] = c.Value()
+		}
+	}
+	m.access.RUnlock()
+
+	data, err := json.Marshal(&saved)
+	if err != nil {
+		return newError("failed to encode counters").Base(err)
+	}
+	if err := writeFileAtomic(m.persistenceFile, data); err != nil {
+		return newError("failed to save counters to ", m.persistenceFile).Base(err)
+	}
+	return nil
+}
+
+// writeFileAtomic replaces the file at path with data, so that the file has either its previous
+// content or data, even if the process crashes in between.
+func writeFileAtomic(path string, data []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := f.Name()
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+func (m *Manager) newPersistenceTask(interval time.Duration) *task.Periodic {
+	if interval <= 0 {
+		interval = defaultPersistenceInterval
+	}
+	return &task.Periodic{
+		Interval: interval,
+		Execute: func() error {
+			if err := m.saveCounters(); err != nil {
+				newError("failed to persist counters").Base(err).AtWarning().WriteToLog()
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,107 @@
+// +build !confonly
+
+package stats
+
+import (
+	"time"
+
+	"v2ray.com/core/common/task"
+	"v2ray.com/core/features/events"
+)
+
+// quotaCheckInterval is how often users are checked against their quotas, to log the users
+// exceeding them and those enabled again.
+const quotaCheckInterval = 10 * time.Second
+
+type userQuota struct {
+	quota    uint64
+	exceeded bool
+}
+
+// userTraffic must be called with access held.
+func (m *Manager) userTraffic(email string) uint64 {
+	var traffic int64
+	for _, direction := range []string{"uplink", "downlink"} {
+		if c, found := m.counters["user>>>"+email+">>>traffic>>>"+direction]; found {
+			traffic += c.Value()
+		}
+	}
+	if traffic < 0 {
+		return 0
+	}
+	return uint64(traffic)
+}
+
+// SetQuota implements stats.QuotaEnforcer.
+func (m *Manager) SetQuota(email string, quota uint64) {
+	m.access.RLock()
+	q, found := m.quotas[email]
+	unchanged := found && q.quota == quota
+	m.access.RUnlock()
+	if unchanged {
+		return
+	}
+
+	m.access.Lock()
+	defer m.access.Unlock()
+
+	if quota == 0 {
+		delete(m.quotas, email)
+		return
+	}
+	if q, found := m.quotas[email]; found {
+		q.quota = quota
+		return
+	}
+	m.quotas[email] = &userQuota{quota: quota}
+}
+
+// IsOverQuota implements stats.QuotaEnforcer. The counters are checked on every call, so that a
+// user is enabled again as soon as their counters are reset.
+func (m *Manager) IsOverQuota(email string) bool {
+	m.access.RLock()
+	defer m.access.RUnlock()
+
+	q, found := m.quotas[email]
+	return found && m.userTraffic(email) >= q.quota
+}
+
+// checkQuotas logs the users whose state changed since the last check, and exposes it as the
+// counter "user>>>EMAIL>>>quota>>>exceeded".
+func (m *Manager) checkQuotas() error {
+	m.access.Lock()
+	defer m.access.Unlock()
+
+	for email, q := range m.quotas {
+		exceeded := m.userTraffic(email) >= q.quota
+		if exceeded == q.exceeded {
+			continue
+		}
+		q.exceeded = exceeded
+
+		name := "user>>>" + email + ">>>quota>>>exceeded"
+		c, found := m.counters[name]
+		if !found {
+			c = new(Counter)
+			m.counters[name] = c
+		}
+		data := map[string]interface{}{"email": email, "quota": q.quota}
+		if exceeded {
+			c.Set(1)
+			newError("user ", email, " exceeded traffic quota of ", q.quota, " bytes").AtWarning().WriteToLog()
+			m.emit(events.New(events.QuotaExceeded, data))
+		} else {
+			c.Set(0)
+			newError("user ", email, " is within traffic quota again").AtInfo().WriteToLog()
+			m.emit(events.New(events.QuotaRestored, data))
+		}
+	}
+	return nil
+}
+
+func (m *Manager) newQuotaTask() *task.Periodic {
+	return &task.Periodic{
+		Interval: quotaCheckInterval,
+		Execute:  m.checkQuotas,
+	}
+}
@@ -7,30 +7,62 @@ package stats
 import (
 	"context"
 	"sync"
+	"time"
 
+	"v2ray.com/core"
 	"v2ray.com/core/common"
 	"v2ray.com/core/common/errors"
+	"v2ray.com/core/common/task"
+	"v2ray.com/core/features/events"
 	"v2ray.com/core/features/stats"
 )
 
 // Manager is an implementation of stats.Manager.
 type Manager struct {
 	access   sync.RWMutex
-	counters map[string]*Counter
+	counters map[string]stats.Counter
 	channels map[string]*Channel
+	healths  map[string]*outboundHealth
 	running  bool
+
+	persistenceFile string
+	persistenceTask *task.Periodic
+	// restored keeps saved values of counters that are not registered yet.
+	restored map[string]int64
+
+	quotas    map[string]*userQuota
+	quotaTask *task.Periodic
+
+	instance *core.Instance
 }
 
 // NewManager creates an instance of Statistics Manager.
 func NewManager(ctx context.Context, config *Config) (*Manager, error) {
 	m := &Manager{
-		counters: make(map[string]*Counter),
+		counters: make(map[string]stats.Counter),
 		channels: make(map[string]*Channel),
+		healths:  make(map[string]*outboundHealth),
+		restored: make(map[string]int64),
+		quotas:   make(map[string]*userQuota),
+		instance: core.FromContext(ctx),
+	}
+	m.quotaTask = m.newQuotaTask()
+
+	if len(config.PersistenceFile) > 0 {
+		m.persistenceFile = config.PersistenceFile
+		m.persistenceTask = m.newPersistenceTask(time.Duration(config.PersistenceInterval) * time.Second)
 	}
 
 	return m, nil
 }
 
+// emit sends the event through the events.Emitter of the instance, if any.
+func (m *Manager) emit(event *events.Event) {
+	if m.instance != nil {
+		events.Emit(m.instance, event)
+	}
+}
+
 // Type implements common.HasType.
 func (*Manager) Type() interface{} {
 	return stats.ManagerType()
@@ -46,6 +78,10 @@ func (m *Manager) RegisterCounter(name string) (stats.Counter, error) {
 	}
 	newError("create new counter ", name).AtDebug().WriteToLog()
 	c := new(Counter)
+	if value, found := m.restored[name]; found {
+		c.Set(value)
+		delete(m.restored, name)
+	}
 	m.counters[name] = c
 	return c, nil
 }
@@ -128,6 +164,19 @@ func (m *Manager) GetChannel(name string) stats.Channel {
 
 // Start implements common.Runnable.
 func (m *Manager) Start() error {
+	if m.persistenceTask != nil {
+		if err := m.restoreCounters(); err != nil {
+			return err
+		}
+		if err := m.persistenceTask.Start(); err != nil {
+			return err
+		}
+	}
+
+	if err := m.quotaTask.Start(); err != nil {
+		return err
+	}
+
 	m.access.Lock()
 	defer m.access.Unlock()
 	m.running = true
@@ -145,10 +194,20 @@ func (m *Manager) Start() error {
 
 // Close implement common.Closable.
 func (m *Manager) Close() error {
+	errs := []error{}
+	if err := m.quotaTask.Close(); err != nil {
+		errs = append(errs, err)
+	}
+	if m.persistenceTask != nil {
+		m.persistenceTask.Close()
+		if err := m.saveCounters(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
 	m.access.Lock()
 	defer m.access.Unlock()
 	m.running = false
-	errs := []error{}
 	for name, channel := range m.channels {
 		newError("remove channel ", name).AtDebug().WriteToLog()
 		delete(m.channels, name)
@@ -2,6 +2,10 @@ package stats_test
 
 import (
 	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -84,3 +88,140 @@ func TestStatsChannelRunnable(t *testing.T) {
 		t.Fatalf("unexpected running channel: test.channel.%d", 3)
 	}
 }
+
+func TestOutboundHealth(t *testing.T) {
+	m, err := NewManager(context.Background(), &Config{})
+	common.Must(err)
+
+	if _, ok := m.OutboundHealth("proxy"); ok {
+		t.Error("expected no health data")
+	}
+
+	for i := 1; i <= 20; i++ {
+		m.RecordDial("proxy", time.Duration(i)*time.Millisecond, nil)
+	}
+	m.RecordDial("proxy", time.Second, errors.New("failed"))
+	m.RecordSession("proxy", true)
+	m.RecordSession("proxy", false)
+
+	h, ok := m.OutboundHealth("proxy")
+	if !ok {
+		t.Fatal("expected health data")
+	}
+	if h.Dials != 21 || h.Failures != 1 || h.Sessions != 2 || h.Aborted != 1 {
+		t.Error("unexpected health: ", h)
+	}
+	if h.LatencyP50 != 10*time.Millisecond || h.LatencyP95 != 19*time.Millisecond {
+		t.Error("unexpected latency: ", h.LatencyP50, " ", h.LatencyP95)
+	}
+
+	for name, expected := range map[string]int64{
+		"outbound>>>proxy>>>latency>>>p50":     10,
+		"outbound>>>proxy>>>latency>>>p95":     19,
+		"outbound>>>proxy>>>dial>>>failure":    1,
+		"outbound>>>proxy>>>session>>>aborted": 1,
+	} {
+		c := m.GetCounter(name)
+		if c == nil {
+			t.Error("counter ", name, " not found")
+			continue
+		}
+		if v := c.Value(); v != expected {
+			t.Error("counter ", name, ": expected ", expected, " but got ", v)
+		}
+	}
+}
+
+func TestCounterPersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "v2ray-stats")
+	common.Must(err)
+	defer os.RemoveAll(dir)
+
+	config := &Config{PersistenceFile: filepath.Join(dir, "stats.json")}
+
+	m1, err := NewManager(context.Background(), config)
+	common.Must(err)
+	a, err := m1.RegisterCounter("a")
+	common.Must(err)
+	common.Must(m1.Start())
+	a.Add(10)
+	b, err := m1.RegisterCounter("b")
+	common.Must(err)
+	b.Add(5)
+	common.Must(m1.Close())
+
+	// Counter b is not used in this run, but its value must survive.
+	m2, err := NewManager(context.Background(), config)
+	common.Must(err)
+	a, err = m2.RegisterCounter("a")
+	common.Must(err)
+	common.Must(m2.Start())
+	if v := a.Value(); v != 10 {
+		t.Error("a: ", v)
+	}
+	a.Add(1)
+	common.Must(m2.Close())
+
+	m3, err := NewManager(context.Background(), config)
+	common.Must(err)
+	common.Must(m3.Start())
+	a, err = m3.RegisterCounter("a")
+	common.Must(err)
+	b, err = m3.RegisterCounter("b")
+	common.Must(err)
+	c, err := m3.RegisterCounter("c")
+	common.Must(err)
+	if v := a.Value(); v != 11 {
+		t.Error("a: ", v)
+	}
+	if v := b.Value(); v != 5 {
+		t.Error("b: ", v)
+	}
+	if v := c.Value(); v != 0 {
+		t.Error("c: ", v)
+	}
+	common.Must(m3.Close())
+
+	common.Must(ioutil.WriteFile(config.PersistenceFile, []byte("{"), 0600))
+	m4, err := NewManager(context.Background(), config)
+	common.Must(err)
+	if err := m4.Start(); err == nil {
+		t.Error("expected error on corrupted file")
+	}
+}
+
+func TestQuota(t *testing.T) {
+	m, err := NewManager(context.Background(), &Config{})
+	common.Must(err)
+
+	up, err := m.RegisterCounter("user>>>a>>>traffic>>>uplink")
+	common.Must(err)
+	down, err := m.RegisterCounter("user>>>a>>>traffic>>>downlink")
+	common.Must(err)
+
+	m.SetQuota("a", 100)
+	up.Add(60)
+	if m.IsOverQuota("a") {
+		t.Error("over quota at 60 bytes")
+	}
+	down.Add(40)
+	if !m.IsOverQuota("a") {
+		t.Error("not over quota at 100 bytes")
+	}
+	if m.IsOverQuota("b") {
+		t.Error("user without quota is over quota")
+	}
+
+	// Resetting the counters enables the user again.
+	up.Set(0)
+	down.Set(0)
+	if m.IsOverQuota("a") {
+		t.Error("over quota after reset")
+	}
+
+	m.SetQuota("a", 0)
+	up.Add(1000)
+	if m.IsOverQuota("a") {
+		t.Error("over quota after quota is removed")
+	}
+}
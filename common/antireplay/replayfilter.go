@@ -7,9 +7,20 @@ import (
 	cuckoo "github.com/seiflotfy/cuckoofilter"
 )
 
-const replayFilterCapacity = 100000
+// DefaultCapacity is the default number of records a ReplayFilter holds in each interval.
+const DefaultCapacity = 100000
 
 // ReplayFilter check for replay attacks.
+//
+// Records are kept in two cuckoo filters, which are reset in turn every interval, so that a record is
+// remembered for at least one interval and at most two. Each filter takes one byte per record of its
+// capacity, rounded up to a power of two.
+//
+// The filters store 8-bit fingerprints in buckets of 4, so a record never seen before is mistaken for
+// a duplicate with a probability of about 8/256 (3%) per filter when it is full, decreasing linearly
+// with its load. As a filter close to full would start to reject insertions, it is reset early when
+// it reaches 90% of its capacity. This keeps memory bounded at the cost of a shorter window under
+// floods of requests.
 type ReplayFilter struct {
 	lock     sync.Mutex
 	poolA    *cuckoo.Filter
@@ -17,13 +28,24 @@ type ReplayFilter struct {
 	poolSwap bool
 	lastSwap int64
 	interval int64
+	capacity uint32
 }
 
 // NewReplayFilter create a new filter with specifying the expiration time interval in seconds.
 func NewReplayFilter(interval int64) *ReplayFilter {
-	filter := &ReplayFilter{}
-	filter.interval = interval
-	return filter
+	return NewReplayFilterWithCapacity(interval, DefaultCapacity)
+}
+
+// NewReplayFilterWithCapacity creates a new filter with the expiration time interval in seconds, and
+// the number of records it holds in each interval. Zero capacity means DefaultCapacity.
+func NewReplayFilterWithCapacity(interval int64, capacity uint32) *ReplayFilter {
+	if capacity == 0 {
+		capacity = DefaultCapacity
+	}
+	return &ReplayFilter{
+		interval: interval,
+		capacity: capacity,
+	}
 }
 
 // Interval in second for expiration time for duplicate records.
@@ -31,6 +53,17 @@ func (filter *ReplayFilter) Interval() int64 {
 	return filter.interval
 }
 
+// swap resets the older pool. It must be called with lock held.
+func (filter *ReplayFilter) swap(now int64) {
+	if filter.poolSwap {
+		filter.poolA.Reset()
+	} else {
+		filter.poolB.Reset()
+	}
+	filter.poolSwap = !filter.poolSwap
+	filter.lastSwap = now
+}
+
 // Check determine if there are duplicate records.
 func (filter *ReplayFilter) Check(sum []byte) bool {
 	filter.lock.Lock()
@@ -39,20 +72,22 @@ func (filter *ReplayFilter) Check(sum []byte) bool {
 	now := time.Now().Unix()
 	if filter.lastSwap == 0 {
 		filter.lastSwap = now
-		filter.poolA = cuckoo.NewFilter(replayFilterCapacity)
-		filter.poolB = cuckoo.NewFilter(replayFilterCapacity)
+		filter.poolA = cuckoo.NewFilter(uint(filter.capacity))
+		filter.poolB = cuckoo.NewFilter(uint(filter.capacity))
 	}
 
-	elapsed := now - filter.lastSwap
-	if elapsed >= filter.Interval() {
-		if filter.poolSwap {
-			filter.poolA.Reset()
-		} else {
-			filter.poolB.Reset()
-		}
-		filter.poolSwap = !filter.poolSwap
-		filter.lastSwap = now
+	older := filter.poolB
+	if filter.poolSwap {
+		older = filter.poolA
+	}
+	if now-filter.lastSwap >= filter.Interval() || older.Count() >= uint(filter.capacity)/10*9 {
+		filter.swap(now)
 	}
 
-	return filter.poolA.InsertUnique(sum) && filter.poolB.InsertUnique(sum)
+	if filter.poolA.Lookup(sum) || filter.poolB.Lookup(sum) {
+		return false
+	}
+	filter.poolA.Insert(sum)
+	filter.poolB.Insert(sum)
+	return true
 }
@@ -0,0 +1,45 @@
+package antireplay_test
+
+import (
+	"encoding/binary"
+	"testing"
+
+	. "v2ray.com/core/common/antireplay"
+)
+
+func record(i uint32) []byte {
+	b := make([]byte, 16)
+	binary.BigEndian.PutUint32(b, i)
+	binary.BigEndian.PutUint32(b[12:], ^i)
+	return b
+}
+
+func TestReplayFilter(t *testing.T) {
+	filter := NewReplayFilter(120)
+
+	if !filter.Check(record(1)) {
+		t.Error("new record rejected")
+	}
+	if filter.Check(record(1)) {
+		t.Error("replayed record accepted")
+	}
+}
+
+func TestReplayFilterFull(t *testing.T) {
+	filter := NewReplayFilterWithCapacity(120, 1024)
+
+	// Far more records than the capacity must not be mistaken for replays in bulk.
+	rejected := 0
+	for i := uint32(0); i < 100000; i++ {
+		if !filter.Check(record(i)) {
+			rejected++
+		}
+	}
+	if rejected > 100000/20 {
+		t.Error("too many false positives: ", rejected)
+	}
+
+	if filter.Check(record(99999)) {
+		t.Error("recent record accepted after rotations")
+	}
+}
@@ -40,6 +40,12 @@ func WriteAllBytes(writer io.Writer, payload []byte) error {
 	return nil
 }
 
+// ReadvConn is a connection that tells whether its readers use readv, instead of the default of the process.
+type ReadvConn interface {
+	syscall.Conn
+	ReadvEnabled() bool
+}
+
 func isPacketReader(reader io.Reader) bool {
 	_, ok := reader.(net.PacketConn)
 	return ok
@@ -59,7 +65,11 @@ func NewReader(reader io.Reader) Reader {
 	}
 
 	_, isFile := reader.(*os.File)
-	if !isFile && useReadv {
+	readv := ReadvEnabled()
+	if c, ok := reader.(ReadvConn); ok {
+		readv = readvSupported && c.ReadvEnabled()
+	}
+	if !isFile && readv {
 		if sc, ok := reader.(syscall.Conn); ok {
 			rawConn, err := sc.SyscallConn()
 			if err != nil {
@@ -134,16 +134,30 @@ func (r *ReadVReader) ReadMultiBuffer() (MultiBuffer, error) {
 	return mb, nil
 }
 
+// readvSupported is whether readv is supported on this platform.
+const readvSupported = true
+
+// useReadv is whether readv is enabled by the environment variable v2ray.buf.readv.
 var useReadv = false
 
+// ReadvEnabled returns whether readers of connections use readv by default, as the environment variable
+// v2ray.buf.readv sets, or on the platforms where it performs better if the variable is not set. Connections
+// that implement ReadvConn override it.
+func ReadvEnabled() bool {
+	return useReadv
+}
+
+// ReadvPreferred returns whether readv performs better on this platform.
+func ReadvPreferred() bool {
+	return (runtime.GOARCH == "386" || runtime.GOARCH == "amd64" || runtime.GOARCH == "s390x") && (runtime.GOOS == "linux" || runtime.GOOS == "darwin" || runtime.GOOS == "windows")
+}
+
 func init() {
 	const defaultFlagValue = "NOT_DEFINED_AT_ALL"
 	value := platform.NewEnvFlag("v2ray.buf.readv").GetValue(func() string { return defaultFlagValue })
 	switch value {
 	case defaultFlagValue, "auto":
-		if (runtime.GOARCH == "386" || runtime.GOARCH == "amd64" || runtime.GOARCH == "s390x") && (runtime.GOOS == "linux" || runtime.GOOS == "darwin" || runtime.GOOS == "windows") {
-			useReadv = true
-		}
+		useReadv = ReadvPreferred()
 	case "enable":
 		useReadv = true
 	}
@@ -7,8 +7,19 @@ import (
 	"syscall"
 )
 
-const useReadv = false
+// readvSupported is false, as readv is not supported on wasm.
+const readvSupported = false
 
 func NewReadVReader(reader io.Reader, rawConn syscall.RawConn) Reader {
 	panic("not implemented")
 }
+
+// ReadvEnabled returns whether readers of connections use readv, which is never on wasm.
+func ReadvEnabled() bool {
+	return false
+}
+
+// ReadvPreferred returns false, as readv is not supported on wasm.
+func ReadvPreferred() bool {
+	return false
+}
@@ -1,6 +1,9 @@
 package bytespool
 
-import "sync"
+import (
+	"sync"
+	"sync/atomic"
+)
 
 func createAllocFunc(size int32) func() interface{} {
 	return func() interface{} {
@@ -20,6 +23,8 @@ const (
 var (
 	pool     [numPools]sync.Pool
 	poolSize [numPools]int32
+	// maxPoolSize is the size of the largest pool in use, accessed atomically.
+	maxPoolSize int32
 )
 
 func init() {
@@ -31,14 +36,46 @@ func init() {
 		poolSize[i] = size
 		size *= sizeMulti
 	}
+	maxPoolSize = poolSize[numPools-1]
+}
+
+// MaxPoolSize returns the size of the largest byte slices kept in the pools.
+func MaxPoolSize() int32 {
+	return atomic.LoadInt32(&maxPoolSize)
+}
+
+// DefaultMaxPoolSize returns the size of the largest pool.
+func DefaultMaxPoolSize() int32 {
+	return poolSize[numPools-1]
+}
+
+// RoundPoolSize returns the size of the largest pool that is not larger than size, or the smallest pool.
+func RoundPoolSize(size int32) int32 {
+	rounded := poolSize[0]
+	for _, ps := range poolSize {
+		if ps <= size {
+			rounded = ps
+		}
+	}
+	return rounded
+}
+
+// SetMaxPoolSize sets the size of the largest byte slices kept in the pools, rounded by RoundPoolSize.
+// Larger slices are allocated on demand and left to GC.
+func SetMaxPoolSize(size int32) {
+	atomic.StoreInt32(&maxPoolSize, RoundPoolSize(size))
 }
 
 // GetPool returns a sync.Pool that generates bytes array with at least the given size.
-// It may return nil if no such pool exists.
+// It may return nil if no such pool exists, or the pool is larger than MaxPoolSize.
 //
 // v2ray:api:stable
 func GetPool(size int32) *sync.Pool {
+	max := MaxPoolSize()
 	for idx, ps := range poolSize {
+		if ps > max {
+			break
+		}
 		if size <= ps {
 			return &pool[idx]
 		}
@@ -62,6 +99,10 @@ func Alloc(size int32) []byte {
 // v2ray:api:stable
 func Free(b []byte) {
 	size := int32(cap(b))
+	if max := MaxPoolSize(); size > max && max < DefaultMaxPoolSize() {
+		// Slices larger than the pools in use are left to GC.
+		return
+	}
 	b = b[0:cap(b)]
 	for i := numPools - 1; i >= 0; i-- {
 		if size >= poolSize[i] {
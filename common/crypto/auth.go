@@ -83,9 +83,48 @@ func (v *AEADAuthenticator) Seal(dst, plainText []byte) ([]byte, error) {
 	return v.AEAD.Seal(dst, iv, plainText, additionalData), nil
 }
 
+// scratchSize is the size of the buffers that readers and writers keep for their connections, for 8 chunks.
+const scratchSize = 8 * buf.Size
+
+// chunkReader is a reader of chunks, which tells the bytes read ahead.
+type chunkReader interface {
+	io.Reader
+	BufferedBytes() int32
+}
+
+// scratchReader reads ahead from a reader into a buffer kept for the connection, so that reading chunks of
+// the connection allocates no buffer.
+type scratchReader struct {
+	reader     io.Reader
+	scratch    []byte
+	start, end int
+}
+
+// BufferedBytes returns the bytes read ahead.
+func (r *scratchReader) BufferedBytes() int32 {
+	return int32(r.end - r.start)
+}
+
+// Read implements io.Reader.
+func (r *scratchReader) Read(b []byte) (int, error) {
+	if r.start == r.end {
+		if len(b) >= len(r.scratch) {
+			return r.reader.Read(b)
+		}
+		n, err := r.reader.Read(r.scratch)
+		r.start, r.end = 0, n
+		if n == 0 {
+			return 0, err
+		}
+	}
+	n := copy(b, r.scratch[r.start:r.end])
+	r.start += n
+	return n, nil
+}
+
 type AuthenticationReader struct {
 	auth         Authenticator
-	reader       *buf.BufferedReader
+	reader       chunkReader
 	sizeParser   ChunkSizeDecoder
 	sizeBytes    []byte
 	transferType protocol.TransferType
@@ -104,10 +143,13 @@ func NewAuthenticationReader(auth Authenticator, sizeParser ChunkSizeDecoder, re
 		padding:      paddingLen,
 		sizeBytes:    make([]byte, sizeParser.SizeBytes()),
 	}
-	if breader, ok := reader.(*buf.BufferedReader); ok {
-		r.reader = breader
-	} else {
-		r.reader = &buf.BufferedReader{Reader: buf.NewReader(reader)}
+	switch reader := reader.(type) {
+	case *buf.BufferedReader:
+		r.reader = reader
+	case buf.Reader:
+		r.reader = &buf.BufferedReader{Reader: reader}
+	default:
+		r.reader = &scratchReader{reader: reader, scratch: make([]byte, scratchSize)}
 	}
 	return r
 }
@@ -175,7 +217,7 @@ func (r *AuthenticationReader) readInternal(soft bool, mb *buf.MultiBuffer) erro
 	if size <= buf.Size {
 		b, err := r.readBuffer(int32(size), int32(padding))
 		if err != nil {
-			return nil
+			return err
 		}
 		*mb = append(*mb, b)
 		return nil
@@ -222,17 +264,27 @@ func (r *AuthenticationReader) ReadMultiBuffer() (buf.MultiBuffer, error) {
 }
 
 type AuthenticationWriter struct {
-	auth         Authenticator
-	writer       buf.Writer
+	auth   Authenticator
+	writer buf.Writer
+	// rawWriter is the writer that writer writes to. Streams are sealed into scratch, which is kept for the
+	// connection, and written to rawWriter.
+	rawWriter    io.Writer
+	scratch      []byte
 	sizeParser   ChunkSizeEncoder
 	transferType protocol.TransferType
 	padding      PaddingLengthGenerator
+	// sealInPlace is whether auth encrypts in place, with the output overlapping the input exactly, as AEAD
+	// does. Other authenticators may write over the input before reading it.
+	sealInPlace bool
 }
 
 func NewAuthenticationWriter(auth Authenticator, sizeParser ChunkSizeEncoder, writer io.Writer, transferType protocol.TransferType, padding PaddingLengthGenerator) *AuthenticationWriter {
+	_, isAEAD := auth.(*AEADAuthenticator)
 	w := &AuthenticationWriter{
 		auth:         auth,
+		sealInPlace:  isAEAD,
 		writer:       buf.NewWriter(writer),
+		rawWriter:    writer,
 		sizeParser:   sizeParser,
 		transferType: transferType,
 	}
@@ -242,31 +294,58 @@ func NewAuthenticationWriter(auth Authenticator, sizeParser ChunkSizeEncoder, wr
 	return w
 }
 
-func (w *AuthenticationWriter) seal(b []byte) (*buf.Buffer, error) {
-	encryptedSize := int32(len(b) + w.auth.Overhead())
+// sealChunk encrypts in place the payload of payloadSize in chunk, which follows the room for the size of the
+// chunk, and appends the padding. chunk has room for a chunk of buf.Size. It returns the size of the chunk.
+func (w *AuthenticationWriter) sealChunk(chunk []byte, payloadSize int32) (int32, error) {
+	sizeBytes := w.sizeParser.SizeBytes()
+	encryptedSize := payloadSize + int32(w.auth.Overhead())
 	var paddingSize int32
 	if w.padding != nil {
 		paddingSize = int32(w.padding.NextPaddingLen())
 	}
 
-	sizeBytes := w.sizeParser.SizeBytes()
 	totalSize := sizeBytes + encryptedSize + paddingSize
 	if totalSize > buf.Size {
-		return nil, newError("size too large: ", totalSize)
+		return 0, newError("size too large: ", totalSize)
 	}
 
-	eb := buf.New()
-	w.sizeParser.Encode(uint16(encryptedSize+paddingSize), eb.Extend(sizeBytes))
-	if _, err := w.auth.Seal(eb.Extend(encryptedSize)[:0], b); err != nil {
-		eb.Release()
-		return nil, err
+	w.sizeParser.Encode(uint16(encryptedSize+paddingSize), chunk[:sizeBytes])
+	payload := chunk[sizeBytes : sizeBytes+payloadSize]
+	if w.sealInPlace {
+		if _, err := w.auth.Seal(payload[:0], payload); err != nil {
+			return 0, err
+		}
+	} else {
+		plaintext := buf.StackNew()
+		common.Must2(plaintext.Write(payload))
+		_, err := w.auth.Seal(payload[:0], plaintext.Bytes())
+		plaintext.Release()
+		if err != nil {
+			return 0, err
+		}
 	}
 	if paddingSize > 0 {
 		// With size of the chunk and padding length encrypted, the content of padding doesn't matter much.
-		paddingBytes := eb.Extend(paddingSize)
-		common.Must2(rand.Read(paddingBytes))
+		common.Must2(rand.Read(chunk[sizeBytes+encryptedSize : totalSize]))
 	}
 
+	return totalSize, nil
+}
+
+func (w *AuthenticationWriter) seal(b []byte) (*buf.Buffer, error) {
+	sizeBytes := w.sizeParser.SizeBytes()
+	if int32(len(b)) > buf.Size-sizeBytes {
+		return nil, newError("size too large: ", len(b))
+	}
+	eb := buf.New()
+	chunk := eb.Extend(buf.Size)
+	copy(chunk[sizeBytes:], b)
+	size, err := w.sealChunk(chunk, int32(len(b)))
+	if err != nil {
+		eb.Release()
+		return nil, err
+	}
+	eb.Resize(0, size)
 	return eb, nil
 }
 
@@ -278,35 +357,32 @@ func (w *AuthenticationWriter) writeStream(mb buf.MultiBuffer) error {
 		maxPadding = int32(w.padding.MaxPaddingLen())
 	}
 
-	payloadSize := buf.Size - int32(w.auth.Overhead()) - w.sizeParser.SizeBytes() - maxPadding
-	if len(mb)+10 > 64*1024*1024 {
-		return errors.New("value too large")
-	}
-	sliceSize := len(mb) + 10
-	mb2Write := make(buf.MultiBuffer, 0, sliceSize)
-
-	temp := buf.New()
-	defer temp.Release()
-
-	rawBytes := temp.Extend(payloadSize)
-
-	for {
-		nb, nBytes := buf.SplitBytes(mb, rawBytes)
-		mb = nb
-
-		eb, err := w.seal(rawBytes[:nBytes])
-
-		if err != nil {
-			buf.ReleaseMulti(mb2Write)
-			return err
+	sizeBytes := w.sizeParser.SizeBytes()
+	payloadSize := buf.Size - int32(w.auth.Overhead()) - sizeBytes - maxPadding
+	if w.scratch == nil {
+		w.scratch = make([]byte, scratchSize)
+	}
+
+	for !mb.IsEmpty() {
+		// Chunks are sealed into the scratch, as many as it holds, and written at once. The payload is moved
+		// into the chunks directly, to be encrypted in place.
+		var n int32
+		for n+buf.Size <= scratchSize && !mb.IsEmpty() {
+			chunk := w.scratch[n : n+buf.Size]
+			nb, nBytes := buf.SplitBytes(mb, chunk[sizeBytes:sizeBytes+payloadSize])
+			mb = nb
+			size, err := w.sealChunk(chunk, int32(nBytes))
+			if err != nil {
+				return err
+			}
+			n += size
 		}
-		mb2Write = append(mb2Write, eb)
-		if mb.IsEmpty() {
-			break
+		if err := buf.WriteAllBytes(w.rawWriter, w.scratch[:n]); err != nil {
+			return err
 		}
 	}
 
-	return w.writer.WriteMultiBuffer(mb2Write)
+	return nil
 }
 
 func (w *AuthenticationWriter) writePacket(mb buf.MultiBuffer) error {
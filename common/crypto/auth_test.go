@@ -6,6 +6,7 @@ import (
 	"crypto/cipher"
 	"crypto/rand"
 	"io"
+	mrand "math/rand"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -141,3 +142,137 @@ func TestAuthenticationReaderWriterPacket(t *testing.T) {
 		t.Error("error: ", err)
 	}
 }
+
+func newAEADChunkAuthenticator(key []byte) *AEADAuthenticator {
+	block, err := aes.NewCipher(key)
+	common.Must(err)
+	aead, err := cipher.NewGCM(block)
+	common.Must(err)
+	return &AEADAuthenticator{
+		AEAD:           aead,
+		NonceGenerator: GenerateInitialAEADNonce(),
+	}
+}
+
+// sealChunks encrypts each payload into a chunk, in the format of Shadowsocks AEAD streams. Unlike
+// AuthenticationWriter, it writes chunks larger than buf.Size as well, as other implementations do.
+func sealChunks(key []byte, payloads [][]byte) []byte {
+	auth := newAEADChunkAuthenticator(key)
+	sizeParser := &AEADChunkSizeParser{Auth: auth}
+	var stream []byte
+	for _, payload := range payloads {
+		sizeBytes := make([]byte, sizeParser.SizeBytes())
+		stream = append(stream, sizeParser.Encode(uint16(len(payload)+auth.Overhead()), sizeBytes)...)
+		sealed, err := auth.Seal(nil, payload)
+		common.Must(err)
+		stream = append(stream, sealed...)
+	}
+	return stream
+}
+
+func newAEADChunkReader(key []byte, stream []byte) *AuthenticationReader {
+	auth := newAEADChunkAuthenticator(key)
+	return NewAuthenticationReader(auth, &AEADChunkSizeParser{Auth: auth}, bytes.NewReader(stream), protocol.TransferTypeStream, nil)
+}
+
+// readChunks reads r until it fails, and returns what is read before that.
+func readChunks(r buf.Reader) ([]byte, error) {
+	var content []byte
+	for {
+		mb, err := r.ReadMultiBuffer()
+		for _, b := range mb {
+			content = append(content, b.Bytes()...)
+		}
+		buf.ReleaseMulti(mb)
+		if err != nil {
+			return content, err
+		}
+	}
+}
+
+func TestAuthenticationReaderRandomChunks(t *testing.T) {
+	key := make([]byte, 16)
+	common.Must2(rand.Read(key))
+	rnd := mrand.New(mrand.NewSource(1))
+
+	for i := 0; i < 1000; i++ {
+		var payloads [][]byte
+		var plaintext []byte
+		for n := 1 + rnd.Intn(8); n > 0; n-- {
+			// Sizes around buf.Size are the most likely to be mishandled.
+			size := 1 + rnd.Intn(0x3FFF)
+			if rnd.Intn(2) == 0 {
+				size = buf.Size - 64 + rnd.Intn(128)
+			}
+			payload := make([]byte, size)
+			rnd.Read(payload)
+			payloads = append(payloads, payload)
+			plaintext = append(plaintext, payload...)
+		}
+		stream := sealChunks(key, payloads)
+
+		content, err := readChunks(newAEADChunkReader(key, stream))
+		if err != io.EOF || !bytes.Equal(content, plaintext) {
+			t.Fatal("failed to read intact stream: ", len(content), " of ", len(plaintext), " bytes, ", err)
+		}
+
+		damaged := append([]byte(nil), stream...)
+		switch rnd.Intn(3) {
+		case 0:
+			damaged = damaged[:rnd.Intn(len(damaged))]
+		case 1:
+			damaged[rnd.Intn(len(damaged))] ^= byte(1 + rnd.Intn(255))
+		case 2:
+			damaged = append(damaged, make([]byte, 1+rnd.Intn(64))...)
+		}
+		content, err = readChunks(newAEADChunkReader(key, damaged))
+		if err == io.EOF && len(damaged) < len(stream) && !bytes.Equal(content, plaintext) {
+			// Streams cut between chunks end normally, with what is read so far.
+			for _, payload := range payloads {
+				if len(content) < len(payload) {
+					break
+				}
+				content = content[len(payload):]
+			}
+			if len(content) > 0 {
+				t.Fatal("stream cut between chunks ends in the middle of a chunk")
+			}
+			continue
+		}
+		if err == nil || err == io.EOF {
+			t.Fatal("damaged stream is read without error")
+		}
+		if !bytes.HasPrefix(plaintext, content) {
+			t.Fatal("damaged stream is read with unexpected content")
+		}
+	}
+}
+
+func BenchmarkAuthenticationReaderLargeChunks(b *testing.B) {
+	const chunkSize = 0x3FFF
+
+	key := make([]byte, 16)
+	common.Must2(rand.Read(key))
+	payloads := make([][]byte, 16)
+	for i := range payloads {
+		payloads[i] = make([]byte, chunkSize)
+	}
+	stream := sealChunks(key, payloads)
+
+	b.SetBytes(chunkSize * int64(len(payloads)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		reader := newAEADChunkReader(key, stream)
+		b.StartTimer()
+
+		for {
+			mb, err := reader.ReadMultiBuffer()
+			buf.ReleaseMulti(mb)
+			if err != nil {
+				break
+			}
+		}
+	}
+}
@@ -22,10 +22,10 @@ type hasSeverity interface {
 // Error is an error object with underlying error.
 type Error struct {
 	pathObj  interface{}
-	prefix   []interface{}
 	message  []interface{}
 	inner    error
 	severity log.Severity
+	kind     Kind
 }
 
 func (err *Error) WithPathObj(obj interface{}) *Error {
@@ -42,13 +42,12 @@ func (err *Error) pkgPath() string {
 
 // Error implements error.Error().
 func (err *Error) Error() string {
-	builder := strings.Builder{}
-	for _, prefix := range err.prefix {
-		builder.WriteByte('[')
-		builder.WriteString(serial.ToString(prefix))
-		builder.WriteString("] ")
+	if len(err.message) == 0 && err.inner != nil {
+		// Errors of Classify only add a kind to the inner error.
+		return err.inner.Error()
 	}
 
+	builder := strings.Builder{}
 	path := err.pkgPath()
 	if len(path) > 0 {
 		builder.WriteString(path)
@@ -74,6 +73,32 @@ func (err *Error) Inner() error {
 	return err.inner
 }
 
+// Unwrap returns the underlying error, for the standard errors.Is and errors.As.
+func (err *Error) Unwrap() error {
+	return err.inner
+}
+
+// WithKind classifies the error as the kind.
+func (err *Error) WithKind(k Kind) *Error {
+	err.kind = k
+	return err
+}
+
+// Kind returns the kind of the error. Kinds of inner errors take precedence, as they are more specific.
+func (err *Error) Kind() Kind {
+	if k := KindOf(err.inner); k != KindUnknown {
+		return k
+	}
+	return err.kind
+}
+
+// Is returns true if the target is the kind of the error, so that errors.Is(err, KindBind) tells whether
+// the error is a failure to listen.
+func (err *Error) Is(target error) bool {
+	k, ok := target.(Kind)
+	return ok && k != KindUnknown && err.Kind() == k
+}
+
 func (err *Error) Base(e error) *Error {
 	err.inner = e
 	return err
@@ -124,7 +149,8 @@ func (err *Error) String() string {
 	return err.Error()
 }
 
-// WriteToLog writes current error into log.
+// WriteToLog writes current error into log. Pass session.ExportIDToError(ctx) when logging on behalf of
+// a session, so that the entry carries the ID of the session.
 func (err *Error) WriteToLog(opts ...ExportOption) {
 	var holder ExportOptionHolder
 
@@ -132,18 +158,22 @@ func (err *Error) WriteToLog(opts ...ExportOption) {
 		opt(&holder)
 	}
 
-	if holder.SessionID > 0 {
-		err.prefix = append(err.prefix, holder.SessionID)
+	msg := &log.GeneralMessage{
+		Severity:  GetSeverity(err),
+		SessionID: holder.SessionID,
+		Content:   err,
 	}
-
-	log.Record(&log.GeneralMessage{
-		Severity: GetSeverity(err),
-		Content:  err,
-	})
+	if holder.Handler != nil {
+		holder.Handler.Handle(msg)
+		return
+	}
+	log.Record(msg)
 }
 
 type ExportOptionHolder struct {
 	SessionID uint32
+	// Handler is the log handler of the instance the error is about, or nil for the handler of the process.
+	Handler log.Handler
 }
 
 type ExportOption func(*ExportOptionHolder)
@@ -1,6 +1,7 @@
 package errors_test
 
 import (
+	goerrors "errors"
 	"io"
 	"strings"
 	"testing"
@@ -60,3 +61,31 @@ func TestErrorMessage(t *testing.T) {
 		}
 	}
 }
+
+func TestErrorKind(t *testing.T) {
+	err := New("failed to listen").Base(io.EOF).WithKind(KindBind)
+	err = New("failed to start").Base(err).WithKind(KindConfig)
+	if k := KindOf(err); k != KindBind {
+		t.Error("kind: ", k)
+	}
+	if !goerrors.Is(err, KindBind) || goerrors.Is(err, KindConfig) {
+		t.Error("unexpected kind of ", err)
+	}
+	if !goerrors.Is(err, io.EOF) {
+		t.Error("expected to wrap EOF: ", err)
+	}
+
+	classified := Classify(io.EOF, KindUnreachable)
+	if !goerrors.Is(classified, KindUnreachable) {
+		t.Error("kind: ", KindOf(classified))
+	}
+	if diff := cmp.Diff(io.EOF.Error(), classified.Error()); diff != "" {
+		t.Error(diff)
+	}
+	if k := KindOf(New("a").Base(io.EOF)); k != KindUnknown {
+		t.Error("kind: ", k)
+	}
+	if Classify(nil, KindConfig) != nil {
+		t.Error("expected nil")
+	}
+}
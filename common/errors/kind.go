@@ -0,0 +1,76 @@
+package errors
+
+// Kind classifies errors, for programs that embed V2Ray to tell them apart. Kinds are errors themselves,
+// so that errors of a kind are matched by the standard errors.Is:
+//
+//	if errors.Is(err, errors.KindBind) { ... }
+type Kind byte
+
+const (
+	// KindUnknown is the kind of errors that are not classified.
+	KindUnknown Kind = iota
+	// KindConfig is the kind of invalid configs.
+	KindConfig
+	// KindBind is the kind of failures to listen on an address, such as when the port is in use, or
+	// when permission is denied.
+	KindBind
+	// KindAuth is the kind of failures to authenticate clients.
+	KindAuth
+	// KindUnreachable is the kind of failures to connect to upstream servers.
+	KindUnreachable
+	// KindInternal is the kind of errors of V2Ray itself, such as missing features.
+	KindInternal
+)
+
+var kindNames = [...]string{
+	KindUnknown:     "unknown",
+	KindConfig:      "config",
+	KindBind:        "bind",
+	KindAuth:        "auth",
+	KindUnreachable: "unreachable",
+	KindInternal:    "internal",
+}
+
+// String returns the name of the kind.
+func (k Kind) String() string {
+	if int(k) < len(kindNames) {
+		return kindNames[k]
+	}
+	return "unknown"
+}
+
+// Error implements error.Error().
+func (k Kind) Error() string {
+	return k.String() + " error"
+}
+
+type hasKind interface {
+	Kind() Kind
+}
+
+// KindOf returns the kind of the error, or KindUnknown if it is not classified.
+func KindOf(err error) Kind {
+	for err != nil {
+		if k, ok := err.(hasKind); ok {
+			return k.Kind()
+		}
+		u, ok := err.(interface{ Unwrap() error })
+		if !ok {
+			return KindUnknown
+		}
+		err = u.Unwrap()
+	}
+	return KindUnknown
+}
+
+// Classify returns err classified as the kind, with the same message. It returns nil if err is nil.
+func Classify(err error, kind Kind) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{
+		inner:    err,
+		severity: GetSeverity(err),
+		kind:     kind,
+	}
+}
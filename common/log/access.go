@@ -27,10 +27,23 @@ type AccessMessage struct {
 	Reason interface{}
 	Email  string
 	Detour string
+	// SniffedDomain is the domain sniffed from the content, if it didn't override the destination.
+	SniffedDomain string
+	// Method and Path of the sniffed HTTP request, and ServerName of the sniffed TLS handshake, if recorded.
+	Method     string
+	Path       string
+	ServerName string
+	// SessionID is the ID of the session, which is also in the error log entries of the session. 0 if unknown.
+	SessionID uint32
 }
 
 func (m *AccessMessage) String() string {
 	builder := strings.Builder{}
+	if m.SessionID != 0 {
+		builder.WriteByte('[')
+		builder.WriteString(serial.ToString(m.SessionID))
+		builder.WriteString("] ")
+	}
 	builder.WriteString(serial.ToString(m.From))
 	builder.WriteByte(' ')
 	builder.WriteString(string(m.Status))
@@ -43,6 +56,25 @@ func (m *AccessMessage) String() string {
 		builder.WriteByte(']')
 	}
 
+	if len(m.SniffedDomain) > 0 {
+		builder.WriteString(" sniffed: ")
+		builder.WriteString(m.SniffedDomain)
+	}
+
+	if len(m.Method) > 0 {
+		builder.WriteString(" request: ")
+		builder.WriteString(m.Method)
+		if len(m.Path) > 0 {
+			builder.WriteByte(' ')
+			builder.WriteString(m.Path)
+		}
+	}
+
+	if len(m.ServerName) > 0 {
+		builder.WriteString(" sni: ")
+		builder.WriteString(m.ServerName)
+	}
+
 	if reason := serial.ToString(m.Reason); len(reason) > 0 {
 		builder.WriteString(" ")
 		builder.WriteString(reason)
@@ -1,6 +1,7 @@
 package log // import "v2ray.com/core/common/log"
 
 import (
+	"context"
 	"sync"
 
 	"v2ray.com/core/common/serial"
@@ -19,11 +20,16 @@ type Handler interface {
 // GeneralMessage is a general log message that can contain all kind of content.
 type GeneralMessage struct {
 	Severity Severity
-	Content  interface{}
+	// SessionID is the ID of the session the message is about, or 0 if none.
+	SessionID uint32
+	Content   interface{}
 }
 
 // String implements Message.
 func (m *GeneralMessage) String() string {
+	if m.SessionID != 0 {
+		return serial.Concat("[", m.Severity, "] [", m.SessionID, "] ", m.Content)
+	}
 	return serial.Concat("[", m.Severity, "] ", m.Content)
 }
 
@@ -44,6 +50,61 @@ func RegisterHandler(handler Handler) {
 	logHandler.Set(handler)
 }
 
+type handlerKey int
+
+const handlerKeyValue handlerKey = 0
+
+// contextHandler is the log handler of an instance. Until a handler is registered into it, messages go to the
+// handler of the process.
+type contextHandler struct {
+	syncHandler
+}
+
+func (h *contextHandler) Handle(msg Message) {
+	h.RLock()
+	handler := h.Handler
+	h.RUnlock()
+
+	if handler != nil {
+		handler.Handle(msg)
+	} else {
+		logHandler.Handle(msg)
+	}
+}
+
+// ContextWithHandler returns a context of an instance, with a log handler of its own that RegisterContextHandler
+// sets.
+func ContextWithHandler(ctx context.Context) context.Context {
+	return context.WithValue(ctx, handlerKeyValue, new(contextHandler))
+}
+
+// RegisterContextHandler registers handler as the log handler of the instance in ctx, and of the process, where
+// messages that are not about an instance go.
+func RegisterContextHandler(ctx context.Context, handler Handler) {
+	if h, ok := ctx.Value(handlerKeyValue).(*contextHandler); ok {
+		h.Set(handler)
+	}
+	RegisterHandler(handler)
+}
+
+// HandlerFromContext returns the log handler of the instance in ctx, or nil if ctx is not of an instance.
+func HandlerFromContext(ctx context.Context) Handler {
+	if h, ok := ctx.Value(handlerKeyValue).(*contextHandler); ok {
+		return h
+	}
+	return nil
+}
+
+// RecordContext writes a message into the log stream of the instance in ctx, or the one of the process if ctx
+// is not of an instance.
+func RecordContext(ctx context.Context, msg Message) {
+	if h := HandlerFromContext(ctx); h != nil {
+		h.Handle(msg)
+		return
+	}
+	Record(msg)
+}
+
 type syncHandler struct {
 	sync.RWMutex
 	Handler
@@ -31,3 +31,51 @@ func TestLogRecord(t *testing.T) {
 		t.Error(diff)
 	}
 }
+
+func TestLogRecordWithSessionID(t *testing.T) {
+	var logger testLogger
+	log.RegisterHandler(&logger)
+
+	log.Record(&log.GeneralMessage{
+		Severity:  log.Severity_Info,
+		SessionID: 1234,
+		Content:   "test",
+	})
+	if diff := cmp.Diff("[Info] [1234] test", logger.value); diff != "" {
+		t.Error(diff)
+	}
+
+	log.Record(&log.AccessMessage{
+		From:      "tcp:127.0.0.1:1234",
+		To:        "tcp:v2ray.com:443",
+		Status:    log.AccessAccepted,
+		Detour:    "direct",
+		SessionID: 1234,
+	})
+	if diff := cmp.Diff("[1234] tcp:127.0.0.1:1234 accepted tcp:v2ray.com:443 [direct]", logger.value); diff != "" {
+		t.Error(diff)
+	}
+
+	log.Record(&log.AccessMessage{
+		From:          "tcp:127.0.0.1:1234",
+		To:            "tcp:1.2.3.4:443",
+		Status:        log.AccessAccepted,
+		Detour:        "direct",
+		SniffedDomain: "v2ray.com",
+		SessionID:     1234,
+	})
+	if diff := cmp.Diff("[1234] tcp:127.0.0.1:1234 accepted tcp:1.2.3.4:443 [direct] sniffed: v2ray.com", logger.value); diff != "" {
+		t.Error(diff)
+	}
+
+	log.Record(&log.AccessMessage{
+		From:   "tcp:127.0.0.1:1234",
+		To:     "tcp:v2ray.com:80",
+		Status: log.AccessAccepted,
+		Method: "GET",
+		Path:   "/index.html",
+	})
+	if diff := cmp.Diff("tcp:127.0.0.1:1234 accepted tcp:v2ray.com:80 request: GET /index.html", logger.value); diff != "" {
+		t.Error(diff)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"io"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"v2ray.com/core/common"
@@ -14,6 +15,7 @@ import (
 	"v2ray.com/core/common/session"
 	"v2ray.com/core/common/signal/done"
 	"v2ray.com/core/common/task"
+	"v2ray.com/core/features/stats"
 	"v2ray.com/core/proxy"
 	"v2ray.com/core/transport"
 	"v2ray.com/core/transport/internet"
@@ -166,9 +168,21 @@ func (f *DialingWorkerFactory) Create() (*ClientWorker, error) {
 type ClientStrategy struct {
 	MaxConcurrency uint32
 	MaxConnection  uint32
+	// MaxLifetime and MaxBytes limit the time and the traffic of a Mux connection taking new sessions. After
+	// either is reached, the connection is recycled: it stays until its sessions end, while new sessions go
+	// to another connection. Zero for no limit. The same limits reach the HTTP/2 and QUIC transports through
+	// the dial context, see internet.ConnectionRecycle.
+	MaxLifetime time.Duration
+	MaxBytes    uint64
+	// Recycles counts the recycled connections, if not nil.
+	Recycles stats.Counter
 }
 
 type ClientWorker struct {
+	// transferred is the bytes of frames in both directions, accessed atomically.
+	transferred    int64
+	recycled       int32
+	created        time.Time
 	sessionManager *SessionManager
 	link           transport.Link
 	done           *done.Instance
@@ -185,6 +199,7 @@ func NewClientWorker(stream transport.Link, s ClientStrategy) (*ClientWorker, er
 		link:           stream,
 		done:           done.New(),
 		strategy:       s,
+		created:        time.Now(),
 	}
 
 	go c.fetchOutput()
@@ -271,7 +286,53 @@ func (m *ClientWorker) IsClosing() bool {
 	if m.strategy.MaxConnection > 0 && sm.Count() >= int(m.strategy.MaxConnection) {
 		return true
 	}
-	return false
+	return m.IsRecycled()
+}
+
+// IsRecycled returns true if the worker takes no more sessions, after its connection reaches the limits of
+// the strategy.
+func (m *ClientWorker) IsRecycled() bool {
+	if atomic.LoadInt32(&m.recycled) != 0 {
+		return true
+	}
+	var reason string
+	if m.strategy.MaxLifetime > 0 && time.Since(m.created) >= m.strategy.MaxLifetime {
+		reason = "lifetime"
+	} else if m.strategy.MaxBytes > 0 && uint64(atomic.LoadInt64(&m.transferred)) >= m.strategy.MaxBytes {
+		reason = "traffic"
+	} else {
+		return false
+	}
+	if atomic.CompareAndSwapInt32(&m.recycled, 0, 1) {
+		newError("recycling mux connection after reaching its ", reason, " limit, with ", m.sessionManager.Size(), " sessions left").AtInfo().WriteToLog()
+		if m.strategy.Recycles != nil {
+			m.strategy.Recycles.Add(1)
+		}
+	}
+	return true
+}
+
+// countingWriter counts the bytes written to the connection of a worker.
+type countingWriter struct {
+	buf.Writer
+	counter *int64
+}
+
+func (w *countingWriter) WriteMultiBuffer(mb buf.MultiBuffer) error {
+	atomic.AddInt64(w.counter, int64(mb.Len()))
+	return w.Writer.WriteMultiBuffer(mb)
+}
+
+// countingReader counts the bytes read from the connection of a worker.
+type countingReader struct {
+	buf.Reader
+	counter *int64
+}
+
+func (r *countingReader) ReadMultiBuffer() (buf.MultiBuffer, error) {
+	mb, err := r.Reader.ReadMultiBuffer()
+	atomic.AddInt64(r.counter, int64(mb.Len()))
+	return mb, err
 }
 
 func (m *ClientWorker) IsFull() bool {
@@ -298,7 +359,7 @@ func (m *ClientWorker) Dispatch(ctx context.Context, link *transport.Link) bool
 	}
 	s.input = link.Reader
 	s.output = link.Writer
-	go fetchInput(ctx, s, m.link.Writer)
+	go fetchInput(ctx, s, &countingWriter{Writer: m.link.Writer, counter: &m.transferred})
 	return true
 }
 
@@ -367,7 +428,7 @@ func (m *ClientWorker) fetchOutput() {
 		common.Must(m.done.Close())
 	}()
 
-	reader := &buf.BufferedReader{Reader: m.link.Reader}
+	reader := &buf.BufferedReader{Reader: &countingReader{Reader: m.link.Reader, counter: &m.transferred}}
 
 	var meta FrameMetadata
 	for {
@@ -6,7 +6,9 @@ import (
 	"time"
 
 	"github.com/golang/mock/gomock"
+	"v2ray.com/core/app/stats"
 	"v2ray.com/core/common"
+	"v2ray.com/core/common/buf"
 	"v2ray.com/core/common/errors"
 	"v2ray.com/core/common/mux"
 	"v2ray.com/core/common/net"
@@ -114,3 +116,75 @@ func TestClientWorkerClose(t *testing.T) {
 
 	common.Must(w2.Close())
 }
+
+func TestClientWorkerRecycle(t *testing.T) {
+	uplinkReader, uplinkWriter := pipe.New(pipe.WithoutSizeLimit())
+	downlinkReader, downlinkWriter := pipe.New(pipe.WithoutSizeLimit())
+	defer downlinkWriter.Close()
+
+	recycles := new(stats.Counter)
+	worker, err := mux.NewClientWorker(transport.Link{
+		Reader: downlinkReader,
+		Writer: uplinkWriter,
+	}, mux.ClientStrategy{
+		MaxConcurrency: 4,
+		MaxConnection:  4,
+		MaxBytes:       1024,
+		Recycles:       recycles,
+	})
+	common.Must(err)
+
+	tr, tw := pipe.New(pipe.WithoutSizeLimit())
+	ctx := session.ContextWithOutbound(context.Background(), &session.Outbound{
+		Target: net.TCPDestination(net.DomainAddress("www.v2ray.com"), 80),
+	})
+	if !worker.Dispatch(ctx, &transport.Link{Reader: tr, Writer: buf.Discard}) {
+		t.Fatal("expected dispatching to a new worker")
+	}
+	if worker.IsFull() {
+		t.Error("expected worker not recycled before its limit")
+	}
+
+	payload := buf.New()
+	payload.Extend(2048)
+	common.Must(tw.WriteMultiBuffer(buf.MultiBuffer{payload}))
+	for total := int32(0); total < 2048; {
+		mb, err := uplinkReader.ReadMultiBuffer()
+		common.Must(err)
+		total += mb.Len()
+		buf.ReleaseMulti(mb)
+	}
+
+	if !worker.IsFull() || !worker.IsRecycled() {
+		t.Error("expected worker recycled after its traffic limit")
+	}
+	if worker.Closed() {
+		t.Error("expected recycled worker kept for its session")
+	}
+	tr2, tw2 := pipe.New(pipe.WithoutSizeLimit())
+	defer tw2.Close()
+	if worker.Dispatch(ctx, &transport.Link{Reader: tr2, Writer: buf.Discard}) {
+		t.Error("expected no new session on recycled worker")
+	}
+	if v := recycles.Value(); v != 1 {
+		t.Error("expected 1 recycle, but got ", v)
+	}
+	common.Must(tw.Close())
+}
+
+func TestClientWorkerRecycleLifetime(t *testing.T) {
+	reader, writer := pipe.New(pipe.WithoutSizeLimit())
+	defer writer.Close()
+
+	worker, err := mux.NewClientWorker(transport.Link{Reader: reader, Writer: writer}, mux.ClientStrategy{
+		MaxLifetime: time.Millisecond * 100,
+	})
+	common.Must(err)
+	if worker.IsRecycled() {
+		t.Error("expected worker not recycled before its lifetime")
+	}
+	time.Sleep(time.Millisecond * 200)
+	if !worker.IsRecycled() {
+		t.Error("expected worker recycled after its lifetime")
+	}
+}
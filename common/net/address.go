@@ -4,6 +4,9 @@ import (
 	"bytes"
 	"net"
 	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
 )
 
 var (
@@ -71,6 +74,16 @@ func isAlphaNum(c byte) bool {
 	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
 }
 
+// IsMulticastOrBroadcast returns true if the address is an IP multicast address, or the IPv4 limited
+// broadcast address. Packets to such addresses only reach the hosts on local networks.
+func IsMulticastOrBroadcast(addr Address) bool {
+	if addr == nil || !addr.Family().IsIP() {
+		return false
+	}
+	ip := addr.IP()
+	return ip.IsMulticast() || ip.Equal(net.IPv4bcast)
+}
+
 // ParseAddress parses a string into an Address. The return value will be an IPAddress when
 // the string is in the form of IPv4 or IPv6 address, or a DomainAddress otherwise.
 func ParseAddress(addr string) Address {
@@ -122,6 +135,21 @@ func DomainAddress(domain string) Address {
 	return domainAddress(domain)
 }
 
+// NormalizeDomain returns the domain in lower case, with internationalized labels in punycode, so that
+// domains from clients, DNS and configs are compared in the same form. Domains that are not valid
+// internationalized domain names are only converted to lower case.
+func NormalizeDomain(domain string) string {
+	for i := 0; i < len(domain); i++ {
+		if domain[i] >= utf8.RuneSelf {
+			if ascii, err := idna.Lookup.ToASCII(domain); err == nil {
+				return ascii
+			}
+			break
+		}
+	}
+	return strings.ToLower(domain)
+}
+
 type ipv4Address [4]byte
 
 func (a ipv4Address) IP() net.IP {
@@ -166,6 +166,24 @@ func TestInvalidAddressConvertion(t *testing.T) {
 	}
 }
 
+func TestIsMulticastOrBroadcast(t *testing.T) {
+	testCases := map[string]bool{
+		"239.255.255.250": true,
+		"224.0.0.251":     true,
+		"255.255.255.255": true,
+		"ff02::fb":        true,
+		"192.168.1.255":   false,
+		"8.8.8.8":         false,
+		"2001:4860::8888": false,
+		"v2ray.com":       false,
+	}
+	for input, expected := range testCases {
+		if actual := IsMulticastOrBroadcast(ParseAddress(input)); actual != expected {
+			t.Error("for ", input, ": expected ", expected, " but got ", actual)
+		}
+	}
+}
+
 func BenchmarkParseAddressIPv4(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		addr := ParseAddress("8.8.8.8")
@@ -192,3 +210,22 @@ func BenchmarkParseAddressDomain(b *testing.B) {
 		}
 	}
 }
+
+func TestNormalizeDomain(t *testing.T) {
+	testCases := []struct {
+		Input  string
+		Output string
+	}{
+		{Input: "v2ray.com", Output: "v2ray.com"},
+		{Input: "WWW.V2Ray.Com", Output: "www.v2ray.com"},
+		{Input: "XN--FSQU00A.XN--0ZWM56D", Output: "xn--fsqu00a.xn--0zwm56d"},
+		{Input: "例子.测试", Output: "xn--fsqu00a.xn--0zwm56d"},
+		{Input: "Bücher.DE", Output: "xn--bcher-kva.de"},
+		{Input: "_Service.例子.测试", Output: "_service.例子.测试"},
+	}
+	for _, testCase := range testCases {
+		if r := NormalizeDomain(testCase.Input); r != testCase.Output {
+			t.Error("normalized ", testCase.Input, " to ", r, ", but want ", testCase.Output)
+		}
+	}
+}
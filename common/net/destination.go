@@ -88,6 +88,22 @@ func UnixDestination(address Address) Destination {
 	}
 }
 
+// UnixPath returns the path of the unix domain socket this destination refers to, either by the
+// unix network or by an address like "/run/v2ray.sock", or "@v2ray" for an abstract socket.
+func (d Destination) UnixPath() (string, bool) {
+	if d.Address == nil || !d.Address.Family().IsDomain() {
+		return "", false
+	}
+	path := d.Address.Domain()
+	if d.Network == Network_UNIX {
+		return path, true
+	}
+	if len(path) > 0 && (path[0] == '/' || path[0] == '@') {
+		return path, true
+	}
+	return "", false
+}
+
 // NetAddr returns the network address in this Destination in string form.
 func (d Destination) NetAddr() string {
 	addr := ""
@@ -17,7 +17,13 @@ var ListenUnix = net.ListenUnix
 
 var LookupIP = net.LookupIP
 
+type Interface = net.Interface
+
+var InterfaceByName = net.InterfaceByName
+
 var FileConn = net.FileConn
+var FileListener = net.FileListener
+var FilePacketConn = net.FilePacketConn
 
 // ParseIP is an alias of net.ParseIP
 var ParseIP = net.ParseIP
@@ -26,6 +32,8 @@ var SplitHostPort = net.SplitHostPort
 
 var CIDRMask = net.CIDRMask
 
+var ParseCIDR = net.ParseCIDR
+
 type Addr = net.Addr
 type Conn = net.Conn
 type PacketConn = net.PacketConn
@@ -49,6 +57,7 @@ const IPv6len = net.IPv6len
 
 type Error = net.Error
 type AddrError = net.AddrError
+type OpError = net.OpError
 
 type Dialer = net.Dialer
 type Listener = net.Listener
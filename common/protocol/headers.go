@@ -59,6 +59,9 @@ func (h *RequestHeader) Destination() net.Destination {
 
 const (
 	ResponseOptionConnectionReuse bitmask.Byte = 0x01
+	// ResponseOptionFailure tells that the session failed before any response, e.g. its UDP destination is
+	// unreachable. The response has no body.
+	ResponseOptionFailure bitmask.Byte = 0x02
 )
 
 type ResponseCommand interface{}
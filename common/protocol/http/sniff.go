@@ -3,6 +3,7 @@ package http
 import (
 	"bytes"
 	"errors"
+	"net/url"
 	"strings"
 
 	"v2ray.com/core/common"
@@ -19,6 +20,8 @@ const (
 type SniffHeader struct {
 	version version
 	host    string
+	method  string
+	path    string
 }
 
 func (h *SniffHeader) Protocol() string {
@@ -36,6 +39,17 @@ func (h *SniffHeader) Domain() string {
 	return h.host
 }
 
+// Method returns the method of the HTTP/1 request.
+func (h *SniffHeader) Method() string {
+	return h.method
+}
+
+// Path returns the escaped path of the HTTP/1 request, without the query. It is empty if the request
+// target is not a path or an absolute URL, such as of CONNECT requests.
+func (h *SniffHeader) Path() string {
+	return h.path
+}
+
 var (
 	methods = [...]string{"get", "post", "head", "put", "delete", "options", "connect"}
 
@@ -66,6 +80,12 @@ func SniffHTTP(b []byte) (*SniffHeader, error) {
 	}
 
 	headers := bytes.Split(b, []byte{'\n'})
+	if requestLine := strings.Fields(string(headers[0])); len(requestLine) >= 2 {
+		sh.method = strings.ToUpper(requestLine[0])
+		if u, err := url.ParseRequestURI(requestLine[1]); err == nil {
+			sh.path = u.EscapedPath()
+		}
+	}
 	for i := 1; i < len(headers); i++ {
 		header := headers[i]
 		if len(header) == 0 {
@@ -77,12 +97,11 @@ func SniffHTTP(b []byte) (*SniffHeader, error) {
 		}
 		key := strings.ToLower(string(parts[0]))
 		if key == "host" {
-			rawHost := strings.ToLower(string(bytes.TrimSpace(parts[1])))
-			dest, err := ParseHost(rawHost, net.Port(80))
+			dest, err := ParseHost(string(bytes.TrimSpace(parts[1])), net.Port(80))
 			if err != nil {
 				return nil, err
 			}
-			sh.host = dest.Address.String()
+			sh.host = sniffedHost(dest)
 		}
 	}
 
@@ -92,3 +111,11 @@ func SniffHTTP(b []byte) (*SniffHeader, error) {
 
 	return nil, common.ErrNoClue
 }
+
+// sniffedHost returns the host of the destination in the Host header, with domains normalized.
+func sniffedHost(dest net.Destination) string {
+	if dest.Address.Family().IsDomain() {
+		return net.NormalizeDomain(dest.Address.Domain())
+	}
+	return dest.Address.String()
+}
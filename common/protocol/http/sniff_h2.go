@@ -0,0 +1,148 @@
+package http
+
+import (
+	"encoding/binary"
+	"errors"
+	"strings"
+
+	"golang.org/x/net/http2/hpack"
+
+	"v2ray.com/core/common"
+	"v2ray.com/core/common/net"
+)
+
+const (
+	http2ClientPreface  = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+	http2FrameHeaderLen = 9
+
+	http2FrameHeaders      = 0x1
+	http2FrameContinuation = 0x9
+
+	http2FlagEndHeaders = 0x4
+	http2FlagPadded     = 0x8
+	http2FlagPriority   = 0x20
+
+	// http2MaxSniffFrameSize is the largest frame accepted while sniffing, equal to
+	// the default SETTINGS_MAX_FRAME_SIZE a client may use before the server answers.
+	http2MaxSniffFrameSize = 16384
+	// http2MaxSniffFrames limits the number of frames inspected before the first
+	// request headers show up.
+	http2MaxSniffFrames = 8
+)
+
+var errNotHTTP2 = errors.New("not an HTTP/2 prior knowledge connection")
+
+// SniffHTTP2 extracts the :authority of the first request on a cleartext HTTP/2
+// connection with prior knowledge (h2c).
+func SniffHTTP2(b []byte) (*SniffHeader, error) {
+	if len(b) < len(http2ClientPreface) {
+		if strings.HasPrefix(http2ClientPreface, string(b)) {
+			return nil, common.ErrNoClue
+		}
+		return nil, errNotHTTP2
+	}
+	if string(b[:len(http2ClientPreface)]) != http2ClientPreface {
+		return nil, errNotHTTP2
+	}
+	b = b[len(http2ClientPreface):]
+
+	var block []byte
+	var streamID uint32
+	for i := 0; i < http2MaxSniffFrames; i++ {
+		if len(b) < http2FrameHeaderLen {
+			return nil, common.ErrNoClue
+		}
+		length := int(b[0])<<16 | int(b[1])<<8 | int(b[2])
+		frameType := b[3]
+		flags := b[4]
+		id := binary.BigEndian.Uint32(b[5:9]) & 0x7fffffff
+		if length > http2MaxSniffFrameSize {
+			return nil, errNotHTTP2
+		}
+		if len(b) < http2FrameHeaderLen+length {
+			return nil, common.ErrNoClue
+		}
+		payload := b[http2FrameHeaderLen : http2FrameHeaderLen+length]
+		b = b[http2FrameHeaderLen+length:]
+
+		switch {
+		case block == nil && frameType == http2FrameHeaders:
+			if id == 0 {
+				return nil, errNotHTTP2
+			}
+			fragment, err := http2HeadersFragment(payload, flags)
+			if err != nil {
+				return nil, err
+			}
+			streamID = id
+			block = append([]byte{}, fragment...)
+		case block != nil && frameType == http2FrameContinuation && id == streamID:
+			block = append(block, payload...)
+		case block != nil:
+			return nil, errNotHTTP2
+		default:
+			// SETTINGS, WINDOW_UPDATE, PRIORITY and other frames preceding the request.
+			continue
+		}
+
+		if flags&http2FlagEndHeaders != 0 {
+			return http2SniffHeaderBlock(block)
+		}
+	}
+
+	return nil, errNotHTTP2
+}
+
+func http2HeadersFragment(payload []byte, flags byte) ([]byte, error) {
+	padding := 0
+	if flags&http2FlagPadded != 0 {
+		if len(payload) < 1 {
+			return nil, errNotHTTP2
+		}
+		padding = int(payload[0])
+		payload = payload[1:]
+	}
+	if flags&http2FlagPriority != 0 {
+		if len(payload) < 5 {
+			return nil, errNotHTTP2
+		}
+		payload = payload[5:]
+	}
+	if padding > len(payload) {
+		return nil, errNotHTTP2
+	}
+	return payload[:len(payload)-padding], nil
+}
+
+func http2SniffHeaderBlock(block []byte) (*SniffHeader, error) {
+	decoder := hpack.NewDecoder(4096, nil)
+	decoder.SetMaxStringLength(http2MaxSniffFrameSize)
+	fields, err := decoder.DecodeFull(block)
+	if err != nil {
+		return nil, errNotHTTP2
+	}
+
+	var rawHost string
+	for _, field := range fields {
+		switch field.Name {
+		case ":authority":
+			rawHost = field.Value
+		case "host":
+			if len(rawHost) == 0 {
+				rawHost = field.Value
+			}
+		}
+	}
+	if len(rawHost) == 0 {
+		return nil, errNotHTTP2
+	}
+
+	dest, err := ParseHost(rawHost, net.Port(80))
+	if err != nil {
+		return nil, err
+	}
+	return &SniffHeader{
+		version: HTTP2,
+		host:    sniffedHost(dest),
+	}, nil
+}
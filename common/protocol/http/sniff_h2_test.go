@@ -0,0 +1,95 @@
+package http_test
+
+import (
+	"bytes"
+	"testing"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+
+	"v2ray.com/core/common"
+	. "v2ray.com/core/common/protocol/http"
+)
+
+func buildH2CRequest(t *testing.T, fields []hpack.HeaderField, split bool) []byte {
+	var block bytes.Buffer
+	encoder := hpack.NewEncoder(&block)
+	for _, f := range fields {
+		common.Must(encoder.WriteField(f))
+	}
+
+	var out bytes.Buffer
+	out.WriteString(http2.ClientPreface)
+	framer := http2.NewFramer(&out, nil)
+	common.Must(framer.WriteSettings(http2.Setting{ID: http2.SettingInitialWindowSize, Val: 65535}))
+	common.Must(framer.WriteWindowUpdate(0, 1<<20))
+
+	fragment := block.Bytes()
+	if !split {
+		common.Must(framer.WriteHeaders(http2.HeadersFrameParam{
+			StreamID:      1,
+			BlockFragment: fragment,
+			EndHeaders:    true,
+			PadLength:     3,
+			Priority:      http2.PriorityParam{Weight: 15},
+		}))
+		return out.Bytes()
+	}
+
+	half := len(fragment) / 2
+	common.Must(framer.WriteHeaders(http2.HeadersFrameParam{
+		StreamID:      1,
+		BlockFragment: fragment[:half],
+	}))
+	common.Must(framer.WriteContinuation(1, true, fragment[half:]))
+	return out.Bytes()
+}
+
+func TestHTTP2Headers(t *testing.T) {
+	request := []hpack.HeaderField{
+		{Name: ":method", Value: "GET"},
+		{Name: ":scheme", Value: "http"},
+		{Name: ":authority", Value: "www.V2Fly.org:8080"},
+		{Name: ":path", Value: "/"},
+	}
+
+	for _, split := range []bool{false, true} {
+		payload := buildH2CRequest(t, request, split)
+
+		header, err := SniffHTTP2(payload)
+		if err != nil {
+			t.Fatal("split: ", split, " unexpected error: ", err)
+		}
+		if header.Domain() != "www.v2fly.org" {
+			t.Error("expected domain www.v2fly.org but got ", header.Domain())
+		}
+		if header.Protocol() != "http2" {
+			t.Error("expected protocol http2 but got ", header.Protocol())
+		}
+
+		for _, n := range []int{0, 10, len(http2.ClientPreface) + 5, len(payload) - 1} {
+			if _, err := SniffHTTP2(payload[:n]); err != common.ErrNoClue {
+				t.Error("expected no clue for ", n, " bytes, but got ", err)
+			}
+		}
+	}
+}
+
+func TestHTTP2HeadersInvalid(t *testing.T) {
+	if _, err := SniffHTTP2([]byte("GET / HTTP/1.1\r\nHost: v2fly.org\r\n\r\n")); err == nil || err == common.ErrNoClue {
+		t.Error("expected HTTP/1 request to be rejected, but got ", err)
+	}
+
+	noAuthority := buildH2CRequest(t, []hpack.HeaderField{
+		{Name: ":method", Value: "GET"},
+		{Name: ":path", Value: "/"},
+	}, false)
+	if _, err := SniffHTTP2(noAuthority); err == nil || err == common.ErrNoClue {
+		t.Error("expected request without authority to be rejected, but got ", err)
+	}
+
+	oversized := append([]byte(http2.ClientPreface), 0x01, 0x00, 0x00, 0x04, 0x00, 0x00, 0x00, 0x00, 0x00)
+	if _, err := SniffHTTP2(oversized); err == nil || err == common.ErrNoClue {
+		t.Error("expected oversized frame to be rejected, but got ", err)
+	}
+}
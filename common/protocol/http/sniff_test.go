@@ -10,6 +10,8 @@ func TestHTTPHeaders(t *testing.T) {
 	cases := []struct {
 		input  string
 		domain string
+		method string
+		path   string
 		err    bool
 	}{
 		{
@@ -26,6 +28,8 @@ Cookie: PHPSESSID=r2t5uvjq435r4q7ib3vtdjq120
 Pragma: no-cache
 Cache-Control: no-cache`,
 			domain: "net.tutsplus.com",
+			method: "GET",
+			path:   "/tutorials/other/top-20-mysql-best-practices/",
 		},
 		{
 			input: `POST /foo.php HTTP/1.1
@@ -43,6 +47,8 @@ Content-Length: 43
  
 first_name=John&last_name=Doe&action=Submit`,
 			domain: "localhost",
+			method: "POST",
+			path:   "/foo.php",
 		},
 		{
 			input: `X /foo.php HTTP/1.1
@@ -80,6 +86,29 @@ first_name=John&last_name=Doe&action=Submit`,
 			domain: "",
 			err:    true,
 		},
+		{
+			input:  "GET http://example.com/a%20b?q=secret HTTP/1.1\r\nHost: example.com\r\n\r\n",
+			domain: "example.com",
+			method: "GET",
+			path:   "/a%20b",
+		},
+		{
+			input:  "GET / HTTP/1.1\r\nHost: WWW.Example.COM:8080\r\n\r\n",
+			domain: "www.example.com",
+			method: "GET",
+			path:   "/",
+		},
+		{
+			input:  "GET / HTTP/1.1\r\nHost: 例子.测试\r\n\r\n",
+			domain: "xn--fsqu00a.xn--0zwm56d",
+			method: "GET",
+			path:   "/",
+		},
+		{
+			input:  "CONNECT example.com:443 HTTP/1.1\r\nHost: example.com:443\r\n\r\n",
+			domain: "example.com",
+			method: "CONNECT",
+		},
 		{
 			input:  `GET /tutorials/other/top-20-mysql-best-practices/ HTTP/1.1`,
 			domain: "",
@@ -100,6 +129,9 @@ first_name=John&last_name=Doe&action=Submit`,
 			if header.Domain() != test.domain {
 				t.Error("expected domain ", test.domain, " but got ", header.Domain())
 			}
+			if header.Method() != test.method || header.Path() != test.path {
+				t.Error("expected request ", test.method, " ", test.path, " but got ", header.Method(), " ", header.Path())
+			}
 		}
 	}
 }
@@ -2,6 +2,9 @@ package protocol
 
 import (
 	"sync"
+	"time"
+
+	"v2ray.com/core/common/dice"
 )
 
 type ServerList struct {
@@ -87,3 +90,126 @@ func (p *RoundRobinServerPicker) PickServer() *ServerSpec {
 
 	return server
 }
+
+// FailoverServerPicker is a ServerPicker that is told about the outcome of using a server.
+type FailoverServerPicker interface {
+	ServerPicker
+	ReportSuccess(server *ServerSpec)
+	ReportFailure(server *ServerSpec)
+}
+
+type serverHealth struct {
+	failures  uint32
+	downUntil time.Time
+}
+
+// WeightedServerPicker picks servers randomly in proportion to their weights. A server that fails
+// MaxFailures times in a row is skipped for the Cooldown period, unless all servers are down.
+type WeightedServerPicker struct {
+	sync.Mutex
+	serverlist  *ServerList
+	weights     map[*ServerSpec]uint32
+	health      map[*ServerSpec]*serverHealth
+	maxFailures uint32
+	cooldown    time.Duration
+}
+
+func NewWeightedServerPicker(serverlist *ServerList, maxFailures uint32, cooldown time.Duration) *WeightedServerPicker {
+	return &WeightedServerPicker{
+		serverlist:  serverlist,
+		weights:     make(map[*ServerSpec]uint32),
+		health:      make(map[*ServerSpec]*serverHealth),
+		maxFailures: maxFailures,
+		cooldown:    cooldown,
+	}
+}
+
+// SetWeight sets the weight of a server. Servers have a weight of 1 by default.
+func (p *WeightedServerPicker) SetWeight(server *ServerSpec, weight uint32) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.weights[server] = weight
+}
+
+func (p *WeightedServerPicker) weight(server *ServerSpec) uint32 {
+	if w, found := p.weights[server]; found {
+		return w
+	}
+	return 1
+}
+
+func (p *WeightedServerPicker) PickServer() *ServerSpec {
+	p.Lock()
+	defer p.Unlock()
+
+	var servers []*ServerSpec
+	for idx := uint32(0); ; idx++ {
+		server := p.serverlist.GetServer(idx)
+		if server == nil {
+			break
+		}
+		servers = append(servers, server)
+	}
+
+	now := time.Now()
+	var available []*ServerSpec
+	var total uint32
+	for _, server := range servers {
+		if h, found := p.health[server]; found && h.downUntil.After(now) {
+			continue
+		}
+		if w := p.weight(server); w > 0 {
+			available = append(available, server)
+			total += w
+		}
+	}
+	if len(available) == 0 {
+		// Every server is down. Trying one of them is better than failing right away.
+		for _, server := range servers {
+			if w := p.weight(server); w > 0 {
+				available = append(available, server)
+				total += w
+			}
+		}
+	}
+	if len(available) == 0 {
+		return nil
+	}
+
+	n := uint32(dice.Roll(int(total)))
+	for _, server := range available {
+		w := p.weight(server)
+		if n < w {
+			return server
+		}
+		n -= w
+	}
+	return available[len(available)-1]
+}
+
+func (p *WeightedServerPicker) ReportSuccess(server *ServerSpec) {
+	p.Lock()
+	defer p.Unlock()
+
+	if h, found := p.health[server]; found {
+		h.failures = 0
+	}
+}
+
+func (p *WeightedServerPicker) ReportFailure(server *ServerSpec) {
+	p.Lock()
+	defer p.Unlock()
+
+	h, found := p.health[server]
+	if !found {
+		h = new(serverHealth)
+		p.health[server] = h
+	}
+	h.failures++
+	if p.maxFailures > 0 && h.failures >= p.maxFailures {
+		h.failures = 0
+		h.downUntil = time.Now().Add(p.cooldown)
+		newError("server ", server.Destination(), " is down, skipping it for ", p.cooldown).AtWarning().WriteToLog()
+	}
+}
@@ -69,3 +69,53 @@ func TestServerPicker(t *testing.T) {
 		t.Error("server: ", server.Destination())
 	}
 }
+
+func TestWeightedServerPicker(t *testing.T) {
+	list := NewServerList()
+	list.AddServer(NewServerSpec(net.TCPDestination(net.LocalHostIP, net.Port(1)), AlwaysValid()))
+	list.AddServer(NewServerSpec(net.TCPDestination(net.LocalHostIP, net.Port(2)), AlwaysValid()))
+	list.AddServer(NewServerSpec(net.TCPDestination(net.LocalHostIP, net.Port(3)), AlwaysValid()))
+
+	picker := NewWeightedServerPicker(list, 2, time.Hour)
+	picker.SetWeight(list.GetServer(0), 0)
+	picker.SetWeight(list.GetServer(1), 3)
+
+	counts := make(map[net.Port]int)
+	for i := 0; i < 4000; i++ {
+		counts[picker.PickServer().Destination().Port]++
+	}
+	if counts[1] != 0 {
+		t.Error("server with weight 0 picked ", counts[1], " times")
+	}
+	if counts[2] < 2500 || counts[3] < 500 {
+		t.Error("unexpected distribution: ", counts)
+	}
+
+	server := list.GetServer(1)
+	picker.ReportFailure(server)
+	picker.ReportSuccess(server)
+	picker.ReportFailure(server)
+	if picker.PickServer() == nil {
+		t.Fatal("no server picked")
+	}
+	for i := 0; i < 100; i++ {
+		if port := picker.PickServer().Destination().Port; port == 2 {
+			break
+		} else if i == 99 {
+			t.Error("server down before max failures")
+		}
+	}
+
+	picker.ReportFailure(server)
+	for i := 0; i < 100; i++ {
+		if port := picker.PickServer().Destination().Port; port != 3 {
+			t.Fatal("expected server 3, but got ", port)
+		}
+	}
+
+	picker.ReportFailure(list.GetServer(2))
+	picker.ReportFailure(list.GetServer(2))
+	if picker.PickServer() == nil {
+		t.Error("expect a server when all servers are down")
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"encoding/asn1"
 	"encoding/pem"
 	"math/big"
+	"net"
 	"time"
 
 	"v2ray.com/core/common"
@@ -70,6 +71,12 @@ func DNSNames(names ...string) Option {
 	}
 }
 
+func IPAddresses(ips ...net.IP) Option {
+	return func(c *x509.Certificate) {
+		c.IPAddresses = ips
+	}
+}
+
 func CommonName(name string) Option {
 	return func(c *x509.Certificate) {
 		c.Subject.CommonName = name
@@ -82,6 +89,12 @@ func KeyUsage(usage x509.KeyUsage) Option {
 	}
 }
 
+func ExtKeyUsage(usages ...x509.ExtKeyUsage) Option {
+	return func(c *x509.Certificate) {
+		c.ExtKeyUsage = usages
+	}
+}
+
 func Organization(org string) Option {
 	return func(c *x509.Certificate) {
 		c.Subject.Organization = []string{org}
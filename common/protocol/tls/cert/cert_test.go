@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/x509"
 	"encoding/json"
+	"net"
 	"os"
 	"strings"
 	"testing"
@@ -90,3 +91,28 @@ func writeFile(content []byte, name string) error {
 
 	return common.Error2(f.Write(content))
 }
+
+func TestGenerateSignedByAuthority(t *testing.T) {
+	ca := MustGenerate(nil, Authority(true), KeyUsage(x509.KeyUsageCertSign|x509.KeyUsageDigitalSignature), ExtKeyUsage())
+	leaf := MustGenerate(ca,
+		DNSNames("v2fly.org"),
+		IPAddresses(net.IP{127, 0, 0, 1}),
+		ExtKeyUsage(x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth))
+
+	caCert, err := x509.ParseCertificate(ca.Certificate)
+	common.Must(err)
+	leafCert, err := x509.ParseCertificate(leaf.Certificate)
+	common.Must(err)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(caCert)
+	for _, name := range []string{"v2fly.org", "127.0.0.1"} {
+		if _, err := leafCert.Verify(x509.VerifyOptions{
+			DNSName:   name,
+			Roots:     roots,
+			KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}); err != nil {
+			t.Error(name, ": ", err)
+		}
+	}
+}
@@ -6,10 +6,12 @@ import (
 	"strings"
 
 	"v2ray.com/core/common"
+	"v2ray.com/core/common/net"
 )
 
 type SniffHeader struct {
 	domain string
+	ech    bool
 }
 
 func (h *SniffHeader) Protocol() string {
@@ -20,9 +22,26 @@ func (h *SniffHeader) Domain() string {
 	return h.domain
 }
 
+// EncryptedClientHello returns true if the client hello carries an encrypted
+// client hello (or legacy encrypted SNI) extension. In this case Domain() is
+// only the public name of the client-facing server, not the real destination.
+func (h *SniffHeader) EncryptedClientHello() bool {
+	return h.ech
+}
+
 var errNotTLS = errors.New("not TLS header")
 var errNotClientHello = errors.New("not client hello")
 
+const (
+	extensionServerName           = 0x0000
+	extensionEncryptedServerName  = 0xffce
+	extensionEncryptedClientHello = 0xfe0d
+
+	// maxClientHelloRecordLen is the largest TLS record a peer may send.
+	// Anything larger can't be a client hello, so sniffing stops early.
+	maxClientHelloRecordLen = 16384 + 2048
+)
+
 func IsValidTLSVersion(major, minor byte) bool {
 	return major == 3
 }
@@ -81,7 +100,10 @@ func ReadClientHello(data []byte, h *SniffHeader) error {
 			return errNotClientHello
 		}
 
-		if extension == 0x00 { /* extensionServerName */
+		switch extension {
+		case extensionEncryptedServerName, extensionEncryptedClientHello:
+			h.ech = true
+		case extensionServerName:
 			d := data[:length]
 			if len(d) < 2 {
 				return errNotClientHello
@@ -109,8 +131,8 @@ func ReadClientHello(data []byte, h *SniffHeader) error {
 					if strings.HasSuffix(serverName, ".") {
 						return errNotClientHello
 					}
-					h.domain = serverName
-					return nil
+					h.domain = net.NormalizeDomain(serverName)
+					break
 				}
 				d = d[nameLen:]
 			}
@@ -118,7 +140,10 @@ func ReadClientHello(data []byte, h *SniffHeader) error {
 		data = data[length:]
 	}
 
-	return errNotTLS
+	if len(h.domain) == 0 {
+		return errNotTLS
+	}
+	return nil
 }
 
 func SniffTLS(b []byte) (*SniffHeader, error) {
@@ -133,6 +158,9 @@ func SniffTLS(b []byte) (*SniffHeader, error) {
 		return nil, errNotTLS
 	}
 	headerLen := int(binary.BigEndian.Uint16(b[3:5]))
+	if headerLen > maxClientHelloRecordLen {
+		return nil, errNotTLS
+	}
 	if 5+headerLen > len(b) {
 		return nil, common.ErrNoClue
 	}
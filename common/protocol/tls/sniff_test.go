@@ -159,3 +159,74 @@ func TestTLSHeaders(t *testing.T) {
 		}
 	}
 }
+
+func buildClientHello(serverName string, extraExtensions ...uint16) []byte {
+	u16 := func(v int) []byte { return []byte{byte(v >> 8), byte(v)} }
+
+	name := []byte(serverName)
+	sni := append([]byte{0x00}, u16(len(name))...)
+	sni = append(sni, name...)
+	sni = append(u16(len(sni)), sni...)
+
+	extensions := append(u16(0x0000), u16(len(sni))...)
+	extensions = append(extensions, sni...)
+	for _, ext := range extraExtensions {
+		body := []byte{0x00, 0x01, 0x02, 0x03}
+		extensions = append(extensions, u16(int(ext))...)
+		extensions = append(extensions, u16(len(body))...)
+		extensions = append(extensions, body...)
+	}
+
+	hello := []byte{0x03, 0x03}
+	hello = append(hello, make([]byte, 32)...)    // random
+	hello = append(hello, 0x00)                   // session id
+	hello = append(hello, 0x00, 0x02, 0x13, 0x01) // cipher suites
+	hello = append(hello, 0x01, 0x00)             // compression methods
+	hello = append(hello, u16(len(extensions))...)
+	hello = append(hello, extensions...)
+
+	handshake := []byte{0x01, 0x00}
+	handshake = append(handshake, u16(len(hello))...)
+	handshake = append(handshake, hello...)
+
+	record := []byte{0x16, 0x03, 0x01}
+	record = append(record, u16(len(handshake))...)
+	return append(record, handshake...)
+}
+
+func TestTLSEncryptedClientHello(t *testing.T) {
+	cases := []struct {
+		input []byte
+		ech   bool
+	}{
+		{input: buildClientHello("v2fly.org"), ech: false},
+		{input: buildClientHello("public.v2fly.org", 0xfe0d), ech: true},
+		{input: buildClientHello("public.v2fly.org", 0x0010, 0xffce), ech: true},
+	}
+
+	for _, test := range cases {
+		header, err := SniffTLS(test.input)
+		if err != nil {
+			t.Fatal("unexpected error: ", err)
+		}
+		if header.EncryptedClientHello() != test.ech {
+			t.Error("expect ech ", test.ech, " but got ", header.EncryptedClientHello())
+		}
+	}
+}
+
+func TestTLSMixedCaseServerName(t *testing.T) {
+	header, err := SniffTLS(buildClientHello("WWW.V2Fly.Org"))
+	if err != nil {
+		t.Fatal("unexpected error: ", err)
+	}
+	if header.Domain() != "www.v2fly.org" {
+		t.Error("expect domain www.v2fly.org but got ", header.Domain())
+	}
+}
+
+func TestTLSOversizedRecord(t *testing.T) {
+	if _, err := SniffTLS([]byte{0x16, 0x03, 0x01, 0xff, 0xff}); err == nil {
+		t.Error("expect oversized record to be rejected")
+	}
+}
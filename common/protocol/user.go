@@ -27,6 +27,7 @@ func (u *User) ToMemoryUser() (*MemoryUser, error) {
 		Account: account,
 		Email:   u.Email,
 		Level:   u.Level,
+		Quota:   u.Quota,
 	}, nil
 }
 
@@ -36,4 +37,6 @@ type MemoryUser struct {
 	Account Account
 	Email   string
 	Level   uint32
+	// Quota is the traffic quota of the user in bytes, or zero if unlimited.
+	Quota uint64
 }
@@ -0,0 +1,113 @@
+package reedsolomon
+
+// Arithmetic in GF(2^8) with the polynomial x^8 + x^4 + x^3 + x^2 + 1, whose generator is 2.
+
+var (
+	expTable [510]byte
+	logTable [256]byte
+	mulTable [256][256]byte
+)
+
+func init() {
+	x := 1
+	for i := 0; i < 255; i++ {
+		expTable[i] = byte(x)
+		expTable[i+255] = byte(x)
+		logTable[x] = byte(i)
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11d
+		}
+	}
+	for a := 1; a < 256; a++ {
+		for b := 1; b < 256; b++ {
+			mulTable[a][b] = expTable[int(logTable[a])+int(logTable[b])]
+		}
+	}
+}
+
+func galMul(a, b byte) byte {
+	return mulTable[a][b]
+}
+
+func galInverse(a byte) byte {
+	return expTable[255-int(logTable[a])]
+}
+
+func galExp(a byte, n int) byte {
+	if n == 0 {
+		return 1
+	}
+	if a == 0 {
+		return 0
+	}
+	return expTable[int(logTable[a])*n%255]
+}
+
+// galMulAdd adds c * in to out.
+func galMulAdd(c byte, in, out []byte) {
+	if c == 0 {
+		return
+	}
+	t := &mulTable[c]
+	for i, b := range in {
+		out[i] ^= t[b]
+	}
+}
+
+type matrix [][]byte
+
+func newMatrix(rows, cols int) matrix {
+	m := make(matrix, rows)
+	for i := range m {
+		m[i] = make([]byte, cols)
+	}
+	return m
+}
+
+func (m matrix) mul(right matrix) matrix {
+	result := newMatrix(len(m), len(right[0]))
+	for i, row := range m {
+		for k, c := range row {
+			galMulAdd(c, right[k], result[i])
+		}
+	}
+	return result
+}
+
+// invert returns the inverse of the square matrix by Gauss-Jordan elimination, or nil if it is
+// singular.
+func (m matrix) invert() matrix {
+	n := len(m)
+	work := newMatrix(n, 2*n)
+	for i := range m {
+		copy(work[i], m[i])
+		work[i][n+i] = 1
+	}
+	for col := 0; col < n; col++ {
+		pivot := col
+		for pivot < n && work[pivot][col] == 0 {
+			pivot++
+		}
+		if pivot == n {
+			return nil
+		}
+		work[col], work[pivot] = work[pivot], work[col]
+		if c := work[col][col]; c != 1 {
+			inv := galInverse(c)
+			for j := range work[col] {
+				work[col][j] = galMul(work[col][j], inv)
+			}
+		}
+		for i := 0; i < n; i++ {
+			if i != col && work[i][col] != 0 {
+				galMulAdd(work[i][col], work[col], work[i])
+			}
+		}
+	}
+	result := make(matrix, n)
+	for i := range work {
+		result[i] = work[i][n:]
+	}
+	return result
+}
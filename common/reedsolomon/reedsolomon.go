@@ -0,0 +1,130 @@
+// Package reedsolomon implements systematic Reed-Solomon erasure coding over GF(2^8), which recovers
+// the data from any data-shard-count shards out of the data and parity shards.
+package reedsolomon
+
+//go:generate go run v2ray.com/core/common/errors/errorgen
+
+// Codec encodes a fixed number of data shards into parity shards. It is safe for concurrent use.
+type Codec struct {
+	dataShards   int
+	parityShards int
+	// matrix has a row for each shard, the first dataShards rows being the identity.
+	matrix matrix
+}
+
+// New creates a Codec. There must be at least one data shard and one parity shard, and at most 256
+// shards in total.
+func New(dataShards, parityShards int) (*Codec, error) {
+	if dataShards <= 0 || parityShards <= 0 {
+		return nil, newError("invalid number of shards: ", dataShards, "+", parityShards)
+	}
+	if dataShards+parityShards > 256 {
+		return nil, newError("too many shards: ", dataShards+parityShards)
+	}
+
+	// Any dataShards rows of a Vandermonde matrix are independent, and so are those of the matrix
+	// multiplied by the inverse of its top square, which makes the code systematic.
+	total := dataShards + parityShards
+	vandermonde := newMatrix(total, dataShards)
+	for i := range vandermonde {
+		for j := range vandermonde[i] {
+			vandermonde[i][j] = galExp(byte(i), j)
+		}
+	}
+	top := vandermonde[:dataShards].invert()
+	return &Codec{
+		dataShards:   dataShards,
+		parityShards: parityShards,
+		matrix:       vandermonde.mul(top),
+	}, nil
+}
+
+// DataShards returns the number of data shards.
+func (c *Codec) DataShards() int {
+	return c.dataShards
+}
+
+// ParityShards returns the number of parity shards.
+func (c *Codec) ParityShards() int {
+	return c.parityShards
+}
+
+func (c *Codec) checkShards(shards [][]byte, allowMissing bool) (int, error) {
+	if len(shards) != c.dataShards+c.parityShards {
+		return 0, newError("wrong number of shards: ", len(shards))
+	}
+	size := -1
+	for _, shard := range shards {
+		if shard == nil && allowMissing {
+			continue
+		}
+		if size == -1 {
+			size = len(shard)
+		} else if len(shard) != size {
+			return 0, newError("shards of different sizes")
+		}
+	}
+	return size, nil
+}
+
+// Encode computes the parity shards from the data shards, in shards in that order. All shards must
+// have the same size, and the parity shards are overwritten.
+func (c *Codec) Encode(shards [][]byte) error {
+	if _, err := c.checkShards(shards, false); err != nil {
+		return err
+	}
+	for i := c.dataShards; i < len(shards); i++ {
+		c.encodeShard(i, shards[:c.dataShards], shards[i])
+	}
+	return nil
+}
+
+func (c *Codec) encodeShard(row int, data [][]byte, out []byte) {
+	for i := range out {
+		out[i] = 0
+	}
+	for j, shard := range data {
+		galMulAdd(c.matrix[row][j], shard, out)
+	}
+}
+
+// ReconstructData recovers the data shards that are nil in shards, which are allocated to the size
+// of the present ones. At least DataShards shards must be present. Missing parity shards are left nil.
+func (c *Codec) ReconstructData(shards [][]byte) error {
+	size, err := c.checkShards(shards, true)
+	if err != nil {
+		return err
+	}
+
+	var missing []int
+	for i := 0; i < c.dataShards; i++ {
+		if shards[i] == nil {
+			missing = append(missing, i)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	sub := make(matrix, 0, c.dataShards)
+	present := make([][]byte, 0, c.dataShards)
+	for i := 0; i < len(shards) && len(present) < c.dataShards; i++ {
+		if shards[i] != nil {
+			sub = append(sub, c.matrix[i])
+			present = append(present, shards[i])
+		}
+	}
+	if len(present) < c.dataShards {
+		return newError("too few shards to reconstruct: ", len(present), " < ", c.dataShards)
+	}
+
+	// The present shards are sub times the data shards.
+	decode := sub.invert()
+	for _, i := range missing {
+		shards[i] = make([]byte, size)
+		for j, shard := range present {
+			galMulAdd(decode[i][j], shard, shards[i])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package reedsolomon_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+
+	"v2ray.com/core/common"
+	. "v2ray.com/core/common/reedsolomon"
+)
+
+func newShards(codec *Codec, size int) [][]byte {
+	shards := make([][]byte, codec.DataShards()+codec.ParityShards())
+	for i := range shards {
+		shards[i] = make([]byte, size)
+		if i < codec.DataShards() {
+			common.Must2(rand.Read(shards[i]))
+		}
+	}
+	return shards
+}
+
+func TestReconstructData(t *testing.T) {
+	codec, err := New(10, 3)
+	common.Must(err)
+	shards := newShards(codec, 100)
+	common.Must(codec.Encode(shards))
+
+	testCases := [][]int{
+		{},
+		{0},
+		{12},
+		{0, 5, 9},
+		{3, 10, 11},
+		{7, 8, 12},
+	}
+	for _, lost := range testCases {
+		received := make([][]byte, len(shards))
+		copy(received, shards)
+		for _, i := range lost {
+			received[i] = nil
+		}
+		if err := codec.ReconstructData(received); err != nil {
+			t.Fatal(lost, err)
+		}
+		for i := 0; i < codec.DataShards(); i++ {
+			if !bytes.Equal(received[i], shards[i]) {
+				t.Error("shard ", i, " not reconstructed with lost shards ", lost)
+			}
+		}
+	}
+}
+
+func TestReconstructTooFewShards(t *testing.T) {
+	codec, err := New(4, 2)
+	common.Must(err)
+	shards := newShards(codec, 16)
+	common.Must(codec.Encode(shards))
+
+	shards[0], shards[1], shards[5] = nil, nil, nil
+	if err := codec.ReconstructData(shards); err == nil {
+		t.Error("expect error with 3 out of 4 shards")
+	}
+}
+
+func TestInvalidShards(t *testing.T) {
+	for _, n := range [][2]int{{0, 1}, {1, 0}, {200, 57}} {
+		if _, err := New(n[0], n[1]); err == nil {
+			t.Error("expect error for shards ", n)
+		}
+	}
+
+	codec, err := New(2, 1)
+	common.Must(err)
+	if err := codec.Encode([][]byte{make([]byte, 2), make([]byte, 3), make([]byte, 3)}); err == nil {
+		t.Error("expect error for shards of different sizes")
+	}
+}
+
+func BenchmarkEncode(b *testing.B) {
+	codec, err := New(10, 3)
+	common.Must(err)
+	shards := newShards(codec, 1400)
+	b.SetBytes(10 * 1400)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		common.Must(codec.Encode(shards))
+	}
+}
@@ -0,0 +1,218 @@
+package serial
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// ToCanonicalJSON encodes a proto Message in the JSON mapping of protobuf, except that the value of a
+// TypedMessage is encoded as the JSON of the message it contains, instead of base64 of its bytes.
+func ToCanonicalJSON(message proto.Message) ([]byte, error) {
+	m := proto.MessageV2(message)
+	data, err := protojson.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	value, err := decodeJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	value, err = expandTypedMessages(m.ProtoReflect(), value)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(value, "", "  ")
+}
+
+// FromCanonicalJSON decodes a proto Message encoded by ToCanonicalJSON.
+func FromCanonicalJSON(data []byte, message proto.Message) error {
+	m := proto.MessageV2(message)
+	value, err := decodeJSON(data)
+	if err != nil {
+		return err
+	}
+	value, err = packTypedMessages(m.ProtoReflect().Descriptor(), value)
+	if err != nil {
+		return err
+	}
+	if data, err = json.Marshal(value); err != nil {
+		return err
+	}
+	return protojson.Unmarshal(data, m)
+}
+
+func isTypedMessage(md protoreflect.MessageDescriptor) bool {
+	return md.FullName() == (&TypedMessage{}).ProtoReflect().Descriptor().FullName()
+}
+
+func decodeJSON(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func isMessageField(fd protoreflect.FieldDescriptor) bool {
+	if fd.IsMap() {
+		return fd.MapValue().Message() != nil
+	}
+	return fd.Message() != nil
+}
+
+// jsonKey returns the key of the field in the JSON object, which may be its JSON name or its name.
+func jsonKey(object map[string]interface{}, fd protoreflect.FieldDescriptor) (string, bool) {
+	for _, key := range []string{fd.JSONName(), string(fd.Name())} {
+		if _, found := object[key]; found {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// expandTypedMessages replaces the encoded TypedMessages in value, the JSON of m, with the JSON of their
+// contents.
+func expandTypedMessages(m protoreflect.Message, value interface{}) (interface{}, error) {
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return value, nil
+	}
+
+	if isTypedMessage(m.Descriptor()) {
+		tm := m.Interface().(*TypedMessage)
+		instance, err := tm.GetInstance()
+		if err != nil {
+			return nil, err
+		}
+		return expandValue(tm.Type, instance)
+	}
+
+	for i, fields := 0, m.Descriptor().Fields(); i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		key, found := jsonKey(object, fd)
+		if !found || !isMessageField(fd) || !m.Has(fd) {
+			continue
+		}
+		var err error
+		switch {
+		case fd.IsList():
+			list := m.Get(fd).List()
+			elements, _ := object[key].([]interface{})
+			for j := 0; j < len(elements) && j < list.Len(); j++ {
+				if elements[j], err = expandTypedMessages(list.Get(j).Message(), elements[j]); err != nil {
+					return nil, err
+				}
+			}
+		case fd.IsMap():
+			entries, _ := object[key].(map[string]interface{})
+			m.Get(fd).Map().Range(func(k protoreflect.MapKey, v protoreflect.Value) bool {
+				if entry, found := entries[k.String()]; found {
+					entries[k.String()], err = expandTypedMessages(v.Message(), entry)
+				}
+				return err == nil
+			})
+		default:
+			object[key], err = expandTypedMessages(m.Get(fd).Message(), object[key])
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return object, nil
+}
+
+func expandValue(messageType string, message proto.Message) (interface{}, error) {
+	m := proto.MessageV2(message)
+	data, err := protojson.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	value, err := decodeJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	if value, err = expandTypedMessages(m.ProtoReflect(), value); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"type":  messageType,
+		"value": value,
+	}, nil
+}
+
+// packTypedMessages reverses expandTypedMessages on value, the JSON of a message of type md.
+func packTypedMessages(md protoreflect.MessageDescriptor, value interface{}) (interface{}, error) {
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return value, nil
+	}
+
+	if isTypedMessage(md) {
+		messageType, _ := object["type"].(string)
+		instance, err := GetInstance(messageType)
+		if err != nil {
+			return nil, err
+		}
+		m := proto.MessageV2(instance.(proto.Message))
+		inner, err := packTypedMessages(m.ProtoReflect().Descriptor(), object["value"])
+		if err != nil {
+			return nil, err
+		}
+		if inner != nil {
+			data, err := json.Marshal(inner)
+			if err != nil {
+				return nil, err
+			}
+			if err := protojson.Unmarshal(data, m); err != nil {
+				return nil, errors.New("Serial: failed to decode " + messageType + ": " + err.Error())
+			}
+		}
+		data, err := proto.Marshal(instance.(proto.Message))
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{
+			"type":  messageType,
+			"value": base64.StdEncoding.EncodeToString(data),
+		}, nil
+	}
+
+	for i, fields := 0, md.Fields(); i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		key, found := jsonKey(object, fd)
+		if !found || !isMessageField(fd) {
+			continue
+		}
+		var err error
+		switch {
+		case fd.IsList():
+			elements, _ := object[key].([]interface{})
+			for j := range elements {
+				if elements[j], err = packTypedMessages(fd.Message(), elements[j]); err != nil {
+					return nil, err
+				}
+			}
+		case fd.IsMap():
+			entries, _ := object[key].(map[string]interface{})
+			for k, entry := range entries {
+				if entries[k], err = packTypedMessages(fd.MapValue().Message(), entry); err != nil {
+					return nil, err
+				}
+			}
+		default:
+			object[key], err = packTypedMessages(fd.Message(), object[key])
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return object, nil
+}
@@ -0,0 +1,72 @@
+package serial_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/go-cmp/cmp"
+
+	"v2ray.com/core"
+	"v2ray.com/core/app/proxyman"
+	"v2ray.com/core/common/net"
+	. "v2ray.com/core/common/serial"
+	"v2ray.com/core/transport/internet"
+	"v2ray.com/core/transport/internet/websocket"
+)
+
+func TestCanonicalJSON(t *testing.T) {
+	config := &core.Config{
+		Inbound: []*core.InboundHandlerConfig{
+			{
+				Tag: "in",
+				ReceiverSettings: ToTypedMessage(&proxyman.ReceiverConfig{
+					PortRange: net.SinglePortRange(10800),
+					Listen:    net.NewIPOrDomain(net.LocalHostIP),
+					StreamSettings: &internet.StreamConfig{
+						ProtocolName: "websocket",
+						TransportSettings: []*internet.TransportConfig{
+							{
+								ProtocolName: "websocket",
+								Settings: ToTypedMessage(&websocket.Config{
+									Path: "/ws",
+								}),
+							},
+						},
+					},
+				}),
+			},
+		},
+	}
+
+	data, err := ToCanonicalJSON(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"path": "/ws"`) {
+		t.Error("typed message is not expanded: ", string(data))
+	}
+
+	decoded := new(core.Config)
+	if err := FromCanonicalJSON(data, decoded); err != nil {
+		t.Fatal(err)
+	}
+	expected, err := proto.Marshal(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual, err := proto.Marshal(decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := cmp.Diff(expected, actual); r != "" {
+		t.Error(r)
+	}
+}
+
+func TestCanonicalJSONUnknownType(t *testing.T) {
+	data := []byte(`{"app": [{"type": "v2ray.core.NoSuchConfig", "value": {}}]}`)
+	if err := FromCanonicalJSON(data, new(core.Config)); err == nil {
+		t.Error("expected error, but got nil")
+	}
+}
@@ -1,6 +1,9 @@
 package session
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 type sessionKey int
 
@@ -11,6 +14,8 @@ const (
 	contentSessionKey
 	muxPreferedSessionKey
 	sockoptSessionKey
+	handlerTagSessionKey
+	outboundTagSessionKey
 )
 
 // ContextWithID returns a new context with the given ID.
@@ -59,6 +64,15 @@ func ContentFromContext(ctx context.Context) *Content {
 	return nil
 }
 
+// SniffedDomainFromContext returns the domain sniffed from the content of the session, or empty if none
+// was sniffed. The domain may differ from the target of the outbound, if it didn't override the destination.
+func SniffedDomainFromContext(ctx context.Context) string {
+	if content := ContentFromContext(ctx); content != nil {
+		return content.SniffedDomain
+	}
+	return ""
+}
+
 // ContextWithMuxPrefered returns a new context with the given bool
 func ContextWithMuxPrefered(ctx context.Context, forced bool) context.Context {
 	return context.WithValue(ctx, muxPreferedSessionKey, forced)
@@ -84,3 +98,52 @@ func SockoptFromContext(ctx context.Context) *Sockopt {
 	}
 	return nil
 }
+
+// ContextWithHandlerTag returns a new context with the tag of the handler being created.
+func ContextWithHandlerTag(ctx context.Context, tag string) context.Context {
+	return context.WithValue(ctx, handlerTagSessionKey, tag)
+}
+
+// HandlerTagFromContext returns the handler tag in this context, or empty if not contained.
+func HandlerTagFromContext(ctx context.Context) string {
+	if tag, ok := ctx.Value(handlerTagSessionKey).(string); ok {
+		return tag
+	}
+	return ""
+}
+
+// ContextWithOutboundTag returns a new context that requests the connection be sent through the outbound
+// of the tag, without routing.
+func ContextWithOutboundTag(ctx context.Context, tag string) context.Context {
+	return context.WithValue(ctx, outboundTagSessionKey, tag)
+}
+
+// OutboundTagFromContext returns the requested outbound tag in this context, or empty if not contained.
+func OutboundTagFromContext(ctx context.Context) string {
+	if tag, ok := ctx.Value(outboundTagSessionKey).(string); ok {
+		return tag
+	}
+	return ""
+}
+
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+// Detach returns a context with the values of ctx, but not its deadline or cancellation, for sessions that
+// outlive the context they are created with.
+func Detach(ctx context.Context) context.Context {
+	return detachedContext{ctx}
+}
@@ -4,8 +4,10 @@ package session // import "v2ray.com/core/common/session"
 import (
 	"context"
 	"math/rand"
+	"time"
 
 	"v2ray.com/core/common/errors"
+	"v2ray.com/core/common/log"
 	"v2ray.com/core/common/net"
 	"v2ray.com/core/common/protocol"
 )
@@ -24,12 +26,15 @@ func NewID() ID {
 	}
 }
 
-// ExportIDToError transfers session.ID into an error object, for logging purpose.
+// ExportIDToError transfers session.ID into an error object, for logging purpose. The error goes to the log
+// handler of the instance in ctx.
 // This can be used with error.WriteToLog().
 func ExportIDToError(ctx context.Context) errors.ExportOption {
 	id := IDFromContext(ctx)
+	handler := log.HandlerFromContext(ctx)
 	return func(h *errors.ExportOptionHolder) {
 		h.SessionID = uint32(id)
+		h.Handler = handler
 	}
 }
 
@@ -43,6 +48,8 @@ type Inbound struct {
 	Tag string
 	// User is the user that authencates for the inbound. May be nil if the protocol allows anounymous traffic.
 	User *protocol.MemoryUser
+	// AuthFailed is set by the inbound proxy if the connection fails authentication.
+	AuthFailed bool
 }
 
 // Outbound is the metadata of an outbound connection.
@@ -51,12 +58,43 @@ type Outbound struct {
 	Target net.Destination
 	// Gateway address
 	Gateway net.Address
+	// RuleTag is the tag of the routing rule that picked the outbound handler, if any.
+	RuleTag string
+	// Tag is the tag of the outbound handler that the dispatcher picked for the connection.
+	Tag string
+	// RouteAttributes are the attributes of the route that picked the outbound handler, if any.
+	RouteAttributes *RouteAttributes
+}
+
+// RouteAttributes are attributes of a route, which outbound handlers honor instead of their own settings.
+// Zero values leave the settings of outbound handlers as is.
+type RouteAttributes struct {
+	// HandshakeTimeout is the time for the outbound handler to connect, including the handshakes of transports.
+	HandshakeTimeout time.Duration
+	// FirstByteTimeout is the time for the outbound handler to receive the first bytes of the response, from
+	// when the connection is dispatched to it.
+	FirstByteTimeout time.Duration
+	// Retries is the number of times the outbound handler dials again, if it fails to connect.
+	Retries uint32
 }
 
 // SniffingRequest controls the behavior of content sniffing.
 type SniffingRequest struct {
 	OverrideDestinationForProtocol []string
 	Enabled                        bool
+	// Timeout is the maximum duration to wait for client data. Zero means default.
+	Timeout time.Duration
+	// RecordRequest records the metadata of the sniffed request in SniffedRequest, for access logs.
+	RecordRequest bool
+}
+
+// SniffedRequest is the metadata of a request sniffed from the content.
+type SniffedRequest struct {
+	// Method and Path of a plaintext HTTP request. The path has no query.
+	Method string
+	Path   string
+	// ServerName of a TLS client hello. It is the public name, if the client hello is encrypted.
+	ServerName string
 }
 
 // Content is the metadata of the connection content.
@@ -64,6 +102,12 @@ type Content struct {
 	// Protocol of current content.
 	Protocol string
 
+	// SniffedDomain is the domain sniffed from the content, whether or not it overrides the destination.
+	SniffedDomain string
+
+	// SniffedRequest is the metadata of the sniffed request, or nil if not recorded.
+	SniffedRequest *SniffedRequest
+
 	SniffingRequest SniffingRequest
 
 	Attributes map[string]string
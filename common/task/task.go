@@ -16,15 +16,43 @@ func OnSuccess(f func() error, g func() error) func() error {
 	}
 }
 
+// GoroutineCounter is notified of the goroutines that Run spawns, which may outlive Run if it returns early.
+type GoroutineCounter interface {
+	// AddGoroutines adds delta to the number of live goroutines.
+	AddGoroutines(delta int64)
+}
+
+type goroutineCounterKey struct{}
+
+// ContextWithGoroutineCounter returns a context in which Run reports its goroutines to the counter.
+func ContextWithGoroutineCounter(ctx context.Context, counter GoroutineCounter) context.Context {
+	return context.WithValue(ctx, goroutineCounterKey{}, counter)
+}
+
+// GoroutineCounterFromContext returns the counter in the context, or nil if not contained.
+func GoroutineCounterFromContext(ctx context.Context) GoroutineCounter {
+	if counter, ok := ctx.Value(goroutineCounterKey{}).(GoroutineCounter); ok {
+		return counter
+	}
+	return nil
+}
+
 // Run executes a list of tasks in parallel, returns the first error encountered or nil if all tasks pass.
 func Run(ctx context.Context, tasks ...func() error) error {
 	n := len(tasks)
 	s := semaphore.New(n)
 	done := make(chan error, 1)
+	counter := GoroutineCounterFromContext(ctx)
 
 	for _, task := range tasks {
 		<-s.Wait()
+		if counter != nil {
+			counter.AddGoroutines(1)
+		}
 		go func(f func() error) {
+			if counter != nil {
+				defer counter.AddGoroutines(-1)
+			}
 			err := f()
 			if err == nil {
 				s.Signal()
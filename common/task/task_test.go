@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -47,6 +48,39 @@ func TestExecuteParallelContextCancel(t *testing.T) {
 	}
 }
 
+type goroutineCounter struct {
+	n int64
+}
+
+func (c *goroutineCounter) AddGoroutines(delta int64) {
+	atomic.AddInt64(&c.n, delta)
+}
+
+func TestExecuteWithGoroutineCounter(t *testing.T) {
+	counter := new(goroutineCounter)
+	ctx := ContextWithGoroutineCounter(context.Background(), counter)
+	release := make(chan struct{})
+	err := Run(ctx, func() error {
+		return errors.New("test")
+	}, func() error {
+		<-release
+		return nil
+	})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	// The second task outlives Run.
+	if n := atomic.LoadInt64(&counter.n); n != 1 {
+		t.Error("expected 1 goroutine, but got ", n)
+	}
+	close(release)
+	time.Sleep(time.Millisecond * 100)
+	if n := atomic.LoadInt64(&counter.n); n != 0 {
+		t.Error("expected no goroutine, but got ", n)
+	}
+}
+
 func BenchmarkExecuteOne(b *testing.B) {
 	noop := func() error {
 		return nil
@@ -31,3 +31,18 @@ func CreateObject(ctx context.Context, config interface{}) (interface{}, error)
 	}
 	return creator(ctx, config)
 }
+
+// IsConfigRegistered returns true if the type of the config is registered through RegisterConfig().
+func IsConfigRegistered(config interface{}) bool {
+	_, found := typeCreatorRegistry[reflect.TypeOf(config)]
+	return found
+}
+
+// RegisteredConfigTypes returns the types of all configs registered through RegisterConfig().
+func RegisteredConfigTypes() []reflect.Type {
+	types := make([]reflect.Type, 0, len(typeCreatorRegistry))
+	for configType := range typeCreatorRegistry {
+		types = append(types, configType)
+	}
+	return types
+}
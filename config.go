@@ -10,6 +10,8 @@ import (
 	"v2ray.com/core/common"
 	"v2ray.com/core/common/buf"
 	"v2ray.com/core/common/cmdarg"
+	"v2ray.com/core/common/errors"
+	"v2ray.com/core/common/serial"
 	"v2ray.com/core/main/confloader"
 )
 
@@ -60,18 +62,19 @@ func getExtension(filename string) string {
 // * []string slice of multiple filename/url(s) to open to read
 // * io.Reader that reads a config content (the original way)
 func LoadConfig(formatName string, filename string, input interface{}) (*Config, error) {
-	ext := getExtension(filename)
-	if len(ext) > 0 {
-		if f, found := configLoaderByExt[ext]; found {
-			return f.Loader(input)
-		}
+	f, found := configLoaderByExt[getExtension(filename)]
+	if !found {
+		f, found = configLoaderByName[formatName]
 	}
-
-	if f, found := configLoaderByName[formatName]; found {
-		return f.Loader(input)
+	if !found {
+		return nil, newError("Unable to load config in ", formatName).AtWarning().WithKind(errors.KindConfig)
 	}
 
-	return nil, newError("Unable to load config in ", formatName).AtWarning()
+	config, err := f.Loader(input)
+	if err != nil {
+		return nil, errors.Classify(err, errors.KindConfig)
+	}
+	return config, nil
 }
 
 func loadProtobufConfig(data []byte) (*Config, error) {
@@ -82,6 +85,14 @@ func loadProtobufConfig(data []byte) (*Config, error) {
 	return config, nil
 }
 
+func loadProtoJSONConfig(data []byte) (*Config, error) {
+	config := new(Config)
+	if err := serial.FromCanonicalJSON(data, config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
 func init() {
 	common.Must(RegisterConfigLoader(&ConfigFormat{
 		Name:      "Protobuf",
@@ -103,4 +114,32 @@ func init() {
 			}
 		},
 	}))
+
+	// ProtoJSON is the JSON mapping of the Protobuf config, with typed messages expanded.
+	common.Must(RegisterConfigLoader(&ConfigFormat{
+		Name:      "ProtoJSON",
+		Extension: []string{"pbjson"},
+		Loader: func(input interface{}) (*Config, error) {
+			switch v := input.(type) {
+			case cmdarg.Arg:
+				r, err := confloader.LoadConfig(v[0])
+				if err != nil {
+					return nil, err
+				}
+				data, err := buf.ReadAllToBytes(r)
+				if err != nil {
+					return nil, err
+				}
+				return loadProtoJSONConfig(data)
+			case io.Reader:
+				data, err := buf.ReadAllToBytes(v)
+				if err != nil {
+					return nil, err
+				}
+				return loadProtoJSONConfig(data)
+			default:
+				return nil, newError("unknow type")
+			}
+		},
+	}))
 }
@@ -0,0 +1,118 @@
+// +build !confonly
+
+package core
+
+import (
+	"context"
+	"strings"
+
+	"v2ray.com/core/common/net"
+	"v2ray.com/core/common/protocol"
+	"v2ray.com/core/common/session"
+)
+
+// DialerOptions describe the inbound that connections of a Dialer appear to arrive on, so that routing
+// rules and policies apply to them as to connections of a real inbound.
+type DialerOptions struct {
+	// InboundTag is the tag of the inbound, matched by the inboundTag of routing rules.
+	InboundTag string
+	// Email is the email of the user, matched by the user of routing rules. Empty means no user.
+	Email string
+	// Level is the level of the user, which selects its policy.
+	Level uint32
+	// Sniffing enables sniffing of TCP connections. The destination is overridden by the sniffed
+	// domain for the protocols in DestinationOverride.
+	Sniffing            bool
+	DestinationOverride []string
+}
+
+// Dialer dials connections through a V2Ray instance, with the same signatures as net.Dialer and
+// net.ListenConfig. It is safe for concurrent use.
+//
+// v2ray:api:beta
+type Dialer struct {
+	instance *Instance
+	options  DialerOptions
+}
+
+// NewDialer creates a Dialer of the instance. Options may be nil.
+//
+// v2ray:api:beta
+func NewDialer(v *Instance, options *DialerOptions) *Dialer {
+	d := &Dialer{instance: v}
+	if options != nil {
+		d.options = *options
+	}
+	return d
+}
+
+// sessionContext returns a context of a new session with the inbound of the Dialer.
+func (d *Dialer) sessionContext(ctx context.Context) context.Context {
+	ctx = session.ContextWithID(session.Detach(ctx), session.NewID())
+	inbound := &session.Inbound{
+		Tag: d.options.InboundTag,
+	}
+	if d.options.Email != "" {
+		inbound.User = &protocol.MemoryUser{
+			Email: d.options.Email,
+			Level: d.options.Level,
+		}
+	}
+	ctx = session.ContextWithInbound(ctx, inbound)
+	content := new(session.Content)
+	content.SniffingRequest.Enabled = d.options.Sniffing
+	content.SniffingRequest.OverrideDestinationForProtocol = d.options.DestinationOverride
+	return session.ContextWithContent(ctx, content)
+}
+
+func parseNetwork(network string) (net.Network, error) {
+	switch strings.ToLower(network) {
+	case "tcp", "tcp4", "tcp6":
+		return net.Network_TCP, nil
+	case "udp", "udp4", "udp6":
+		return net.Network_UDP, nil
+	default:
+		return net.Network_Unknown, newError("unsupported network: ", network)
+	}
+}
+
+// DialContext connects to the address on the network, which is one of "tcp", "tcp4", "tcp6", "udp",
+// "udp4" and "udp6", through the instance. The address may contain a domain, which is resolved by the
+// outbound. Once connected, the connection is not affected by ctx.
+func (d *Dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	n, err := parseNetwork(network)
+	if err != nil {
+		return nil, err
+	}
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, newError("invalid address: ", address).Base(err)
+	}
+	p, err := net.PortFromString(port)
+	if err != nil {
+		return nil, newError("invalid port in address: ", address).Base(err)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return Dial(d.sessionContext(ctx), d.instance, net.Destination{
+		Network: n,
+		Address: net.ParseAddress(host),
+		Port:    p,
+	})
+}
+
+// Dial is DialContext with a background context.
+func (d *Dialer) Dial(network, address string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, address)
+}
+
+// ListenPacket returns a PacketConn that sends packets to any destination through the instance. The
+// network must be one of "udp", "udp4" and "udp6". The local address is ignored, as packets are sent
+// from the outbound.
+func (d *Dialer) ListenPacket(ctx context.Context, network, address string) (net.PacketConn, error) {
+	if n, err := parseNetwork(network); err != nil || n != net.Network_UDP {
+		return nil, newError("unsupported network for packets: ", network)
+	}
+	return DialUDP(d.sessionContext(ctx), d.instance)
+}
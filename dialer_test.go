@@ -0,0 +1,212 @@
+package core_test
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"v2ray.com/core"
+	"v2ray.com/core/app/dispatcher"
+	"v2ray.com/core/app/proxyman"
+	"v2ray.com/core/app/router"
+	"v2ray.com/core/common"
+	"v2ray.com/core/common/net"
+	"v2ray.com/core/common/serial"
+	"v2ray.com/core/common/session"
+	"v2ray.com/core/proxy/blackhole"
+	"v2ray.com/core/proxy/freedom"
+	"v2ray.com/core/testing/servers/tcp"
+	"v2ray.com/core/testing/servers/udp"
+)
+
+// newRoutedInstance starts an instance that blocks everything, except connections from the inbound
+// tagged "embedded" or of the user "love@v2ray.com".
+func newRoutedInstance() *core.Instance {
+	config := &core.Config{
+		App: []*serial.TypedMessage{
+			serial.ToTypedMessage(&dispatcher.Config{}),
+			serial.ToTypedMessage(&proxyman.InboundConfig{}),
+			serial.ToTypedMessage(&proxyman.OutboundConfig{}),
+			serial.ToTypedMessage(&router.Config{
+				Rule: []*router.RoutingRule{
+					{
+						TargetTag:  &router.RoutingRule_Tag{Tag: "direct"},
+						InboundTag: []string{"embedded"},
+					},
+					{
+						TargetTag: &router.RoutingRule_Tag{Tag: "direct"},
+						UserEmail: []string{"love@v2ray.com"},
+					},
+				},
+			}),
+		},
+		Outbound: []*core.OutboundHandlerConfig{
+			{
+				Tag:           "block",
+				ProxySettings: serial.ToTypedMessage(&blackhole.Config{}),
+			},
+			{
+				Tag:           "direct",
+				ProxySettings: serial.ToTypedMessage(&freedom.Config{}),
+			},
+		},
+	}
+
+	server, err := core.New(config)
+	common.Must(err)
+	common.Must(server.Start())
+	return server
+}
+
+func TestDialerRouting(t *testing.T) {
+	tcpServer := tcp.Server{
+		MsgProcessor: xor,
+	}
+	dest, err := tcpServer.Start()
+	common.Must(err)
+	defer tcpServer.Close()
+
+	server := newRoutedInstance()
+	defer server.Close()
+
+	testCases := []struct {
+		options *core.DialerOptions
+		routed  bool
+	}{
+		{nil, false},
+		{&core.DialerOptions{InboundTag: "embedded"}, true},
+		{&core.DialerOptions{InboundTag: "other"}, false},
+		{&core.DialerOptions{Email: "love@v2ray.com"}, true},
+	}
+
+	for _, tc := range testCases {
+		dialer := core.NewDialer(server, tc.options)
+		conn, err := dialer.DialContext(context.Background(), "tcp", dest.NetAddr())
+		common.Must(err)
+
+		payload := []byte("embedded dialer")
+		common.Must2(conn.Write(payload))
+		common.Must(conn.SetReadDeadline(time.Now().Add(time.Second * 2)))
+		receive := make([]byte, len(payload))
+		_, err = io.ReadFull(conn, receive)
+		conn.Close()
+
+		if tc.routed {
+			if err != nil {
+				t.Error("options ", tc.options, ": failed to read response: ", err)
+			} else if r := cmp.Diff(xor(receive), payload); r != "" {
+				t.Error(r)
+			}
+		} else if err == nil {
+			t.Error("options ", tc.options, ": expected connection blocked, but got response")
+		}
+	}
+}
+
+func TestDialerListenPacket(t *testing.T) {
+	udpServer := udp.Server{
+		MsgProcessor: xor,
+	}
+	dest, err := udpServer.Start()
+	common.Must(err)
+	defer udpServer.Close()
+
+	server := newRoutedInstance()
+	defer server.Close()
+
+	dialer := core.NewDialer(server, &core.DialerOptions{InboundTag: "embedded"})
+	conn, err := dialer.ListenPacket(context.Background(), "udp", "")
+	common.Must(err)
+	defer conn.Close()
+
+	payload := []byte("embedded packet")
+	common.Must2(conn.WriteTo(payload, &net.UDPAddr{
+		IP:   dest.Address.IP(),
+		Port: int(dest.Port),
+	}))
+
+	receive := make([]byte, 1024)
+	n, _, err := conn.ReadFrom(receive)
+	common.Must(err)
+	if r := cmp.Diff(xor(receive[:n]), payload); r != "" {
+		t.Error(r)
+	}
+
+	if _, err := dialer.ListenPacket(context.Background(), "tcp", ""); err == nil {
+		t.Error("expected error for TCP, but got nil")
+	}
+}
+
+func TestDialUDPCanceledContext(t *testing.T) {
+	udpServer := udp.Server{
+		MsgProcessor: xor,
+	}
+	dest, err := udpServer.Start()
+	common.Must(err)
+	defer udpServer.Close()
+
+	server := newRoutedInstance()
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(session.ContextWithInbound(context.Background(), &session.Inbound{Tag: "embedded"}))
+	conn, err := core.DialUDP(ctx, server)
+	common.Must(err)
+	defer conn.Close()
+	cancel()
+
+	payload := []byte("packet after cancel")
+	common.Must2(conn.WriteTo(payload, &net.UDPAddr{
+		IP:   dest.Address.IP(),
+		Port: int(dest.Port),
+	}))
+
+	// Deadlines of the PacketConn are not implemented.
+	received := make(chan []byte, 1)
+	go func() {
+		receive := make([]byte, 1024)
+		n, _, err := conn.ReadFrom(receive)
+		if err == nil {
+			received <- receive[:n]
+		}
+	}()
+	select {
+	case receive := <-received:
+		if r := cmp.Diff(xor(receive), payload); r != "" {
+			t.Error(r)
+		}
+	case <-time.After(time.Second * 2):
+		t.Error("expected packets exchanged after the context is canceled")
+	}
+}
+
+func TestDialerHTTPClient(t *testing.T) {
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello from "+r.Host)
+	}))
+	defer httpServer.Close()
+
+	server := newRoutedInstance()
+	defer server.Close()
+
+	dialer := core.NewDialer(server, &core.DialerOptions{InboundTag: "embedded"})
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: dialer.DialContext,
+		},
+	}
+	resp, err := client.Get(httpServer.URL)
+	common.Must(err)
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	common.Must(err)
+	if r := cmp.Diff(string(body), "hello from "+httpServer.Listener.Addr().String()); r != "" {
+		t.Error(r)
+	}
+}
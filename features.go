@@ -0,0 +1,179 @@
+// +build !confonly
+
+package core
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"v2ray.com/core/common"
+	"v2ray.com/core/common/errors"
+	"v2ray.com/core/common/serial"
+	"v2ray.com/core/proxy"
+	"v2ray.com/core/transport/internet"
+)
+
+// RegisteredFeature is a part of V2Ray compiled into this build. Configs disable features by their names,
+// their kinds and names as "kind:name", or their types.
+type RegisteredFeature struct {
+	// Kind is one of "app", "inbound", "outbound", "transport", "header" and "other".
+	Kind string
+	// Name is the short name of the feature, such as "dns", "vmess" or "quic". Features of different kinds
+	// may share a name, e.g. the DNS app and the DNS outbound.
+	Name string
+	// Type is the message type of the config of the feature. It is empty for transports, which are chosen
+	// by their names in stream settings.
+	Type string
+}
+
+var featureKindOrder = map[string]int{
+	"app":       0,
+	"inbound":   1,
+	"outbound":  2,
+	"transport": 3,
+	"header":    4,
+	"other":     5,
+}
+
+// shortFeatureName returns the first part of the message type after prefix.
+func shortFeatureName(messageType string, prefix string) string {
+	return strings.SplitN(strings.TrimPrefix(messageType, prefix), ".", 2)[0]
+}
+
+// RegisteredFeatures lists the config types registered through common.RegisterConfig() and the transport
+// protocols, which make up the features in this build. Configs of other features fail core.New.
+func RegisteredFeatures() []RegisteredFeature {
+	var list []RegisteredFeature
+	for _, configType := range common.RegisteredConfigTypes() {
+		if configType.Kind() != reflect.Ptr {
+			continue
+		}
+		message, ok := reflect.New(configType.Elem()).Interface().(proto.Message)
+		if !ok {
+			continue
+		}
+		f := RegisteredFeature{Kind: "other", Type: serial.GetMessageType(message)}
+		f.Name = f.Type[strings.LastIndex(f.Type, ".")+1:]
+		switch {
+		case proxy.IsInboundConfigType(configType):
+			f.Kind, f.Name = "inbound", shortFeatureName(f.Type, "v2ray.core.proxy.")
+		case proxy.IsOutboundConfigType(configType):
+			f.Kind, f.Name = "outbound", shortFeatureName(f.Type, "v2ray.core.proxy.")
+		case strings.HasPrefix(f.Type, "v2ray.core.app."):
+			f.Kind, f.Name = "app", shortFeatureName(f.Type, "v2ray.core.app.")
+		case strings.HasPrefix(f.Type, "v2ray.core.transport.internet.headers."):
+			f.Kind, f.Name = "header", shortFeatureName(f.Type, "v2ray.core.transport.internet.headers.")
+		}
+		list = append(list, f)
+	}
+	for _, name := range internet.RegisteredProtocols() {
+		list = append(list, RegisteredFeature{Kind: "transport", Name: name})
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if a.Kind != b.Kind {
+			return featureKindOrder[a.Kind] < featureKindOrder[b.Kind]
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Type < b.Type
+	})
+	return list
+}
+
+// disabledFeatureChecker finds the parts of a config that use disabled features.
+type disabledFeatureChecker struct {
+	// types maps message types of disabled features to the entries that disable them.
+	types map[string]string
+	// transports maps names of disabled transports to the entries that disable them.
+	transports map[string]string
+	problems   []string
+}
+
+func newDisabledFeatureChecker(disabled []string) *disabledFeatureChecker {
+	c := &disabledFeatureChecker{
+		types:      make(map[string]string),
+		transports: make(map[string]string),
+	}
+	registered := RegisteredFeatures()
+	for _, entry := range disabled {
+		found := false
+		for _, f := range registered {
+			if entry != f.Name && entry != f.Type && entry != f.Kind+":"+f.Name {
+				continue
+			}
+			found = true
+			if f.Kind == "transport" {
+				c.transports[f.Name] = entry
+			} else {
+				c.types[f.Type] = entry
+			}
+		}
+		if !found {
+			newError("disabled feature ", entry, " is not in this build").AtWarning().WriteToLog()
+		}
+	}
+	return c
+}
+
+func (c *disabledFeatureChecker) walk(path string, m protoreflect.Message) {
+	switch msg := m.Interface().(type) {
+	case *serial.TypedMessage:
+		if entry, found := c.types[msg.Type]; found {
+			c.problems = append(c.problems, fmt.Sprintf("%s: %s is disabled by %q", path, msg.Type, entry))
+			return
+		}
+		instance, err := msg.GetInstance()
+		if err != nil {
+			// Unknown types fail later with their own errors.
+			return
+		}
+		c.walk(path+"("+msg.Type+")", proto.MessageV2(instance).ProtoReflect())
+		return
+	case *internet.StreamConfig:
+		protocol := msg.GetEffectiveProtocol()
+		if entry, found := c.transports[protocol]; found {
+			c.problems = append(c.problems, fmt.Sprintf("%s: transport %s is disabled by %q", path, protocol, entry))
+		}
+	}
+
+	m.Range(func(fd protoreflect.FieldDescriptor, value protoreflect.Value) bool {
+		fieldPath := path + "." + string(fd.Name())
+		switch {
+		case fd.IsList() && fd.Message() != nil:
+			list := value.List()
+			for i := 0; i < list.Len(); i++ {
+				c.walk(fmt.Sprintf("%s[%d]", fieldPath, i), list.Get(i).Message())
+			}
+		case fd.IsMap() && fd.MapValue().Message() != nil:
+			value.Map().Range(func(k protoreflect.MapKey, mv protoreflect.Value) bool {
+				c.walk(fmt.Sprintf("%s[%v]", fieldPath, k.Interface()), mv.Message())
+				return true
+			})
+		case !fd.IsList() && !fd.IsMap() && fd.Message() != nil:
+			c.walk(fieldPath, value.Message())
+		}
+		return true
+	})
+}
+
+// checkDisabledFeatures rejects the config if it uses any feature in its disabled_features, so that disabled
+// features are never created, and start no listeners or background tasks.
+func checkDisabledFeatures(config *Config) error {
+	if len(config.DisabledFeatures) == 0 {
+		return nil
+	}
+	c := newDisabledFeatureChecker(config.DisabledFeatures)
+	c.walk("config", proto.MessageV2(config).ProtoReflect())
+	if len(c.problems) > 0 {
+		return newError("config uses disabled features:\n  ", strings.Join(c.problems, "\n  ")).WithKind(errors.KindConfig)
+	}
+	return nil
+}
@@ -1,6 +1,8 @@
 package dns
 
 import (
+	"context"
+
 	"v2ray.com/core/common/errors"
 	"v2ray.com/core/common/net"
 	"v2ray.com/core/common/serial"
@@ -31,6 +33,45 @@ type IPv6Lookup interface {
 	LookupIPv6(domain string) ([]net.IP, error)
 }
 
+// ServerSelector is an optional feature for querying DNS with some of the name servers only.
+//
+// v2ray:api:beta
+type ServerSelector interface {
+	// WithServerTag returns a Client that only queries the name servers with the given tag.
+	WithServerTag(tag string) (Client, error)
+}
+
+// ClientWithServerTag returns a Client that only queries the name servers of c with the given tag.
+//
+// v2ray:api:beta
+func ClientWithServerTag(c Client, tag string) (Client, error) {
+	selector, ok := c.(ServerSelector)
+	if !ok {
+		return nil, errors.New("DNS client doesn't support selecting name servers by tag")
+	}
+	return selector.WithServerTag(tag)
+}
+
+// ContextBinder is an optional feature for querying DNS on behalf of a session.
+//
+// v2ray:api:beta
+type ContextBinder interface {
+	// WithContext returns a Client that queries on behalf of the session in ctx, so that log entries of
+	// the queries carry the ID of the session. The Client implements the same optional features as this one.
+	WithContext(ctx context.Context) Client
+}
+
+// ClientWithContext returns a Client of c that queries on behalf of the session in ctx, or c itself if it
+// doesn't support that.
+//
+// v2ray:api:beta
+func ClientWithContext(ctx context.Context, c Client) Client {
+	if binder, ok := c.(ContextBinder); ok {
+		return binder.WithContext(ctx)
+	}
+	return c
+}
+
 // ClientType returns the type of Client interface. Can be used for implementing common.HasType.
 //
 // v2ray:api:beta
@@ -0,0 +1,76 @@
+package events
+
+import (
+	"time"
+
+	"v2ray.com/core/features"
+)
+
+// Types of events.
+const (
+	// InboundAdded is emitted when an inbound handler is added, with its tag.
+	InboundAdded = "inbound.added"
+	// InboundRemoved is emitted when an inbound handler is removed, with its tag.
+	InboundRemoved = "inbound.removed"
+	// OutboundAdded is emitted when an outbound handler is added, with its tag.
+	OutboundAdded = "outbound.added"
+	// OutboundRemoved is emitted when an outbound handler is removed, with its tag.
+	OutboundRemoved = "outbound.removed"
+	// OutboundUnhealthy is emitted when an outbound of a balancer fails health checks, with the tags of both.
+	OutboundUnhealthy = "outbound.unhealthy"
+	// OutboundHealthy is emitted when an outbound of a balancer recovers, with the tags of both.
+	OutboundHealthy = "outbound.healthy"
+	// QuotaExceeded is emitted when a user exceeds their traffic quota, with their email and quota.
+	QuotaExceeded = "user.quotaExceeded"
+	// QuotaRestored is emitted when a user is within their traffic quota again, with their email and quota.
+	QuotaRestored = "user.quotaRestored"
+)
+
+// Event is something happened in V2Ray, that external scripts may act on.
+//
+// v2ray:api:beta
+type Event struct {
+	Type string
+	Time time.Time
+	// Data is the details of the event, which are marshaled to JSON.
+	Data map[string]interface{}
+}
+
+// New creates an event of the type at the current time.
+func New(eventType string, data map[string]interface{}) *Event {
+	return &Event{
+		Type: eventType,
+		Time: time.Now(),
+		Data: data,
+	}
+}
+
+// Emitter is a feature that delivers events to hooks.
+//
+// v2ray:api:beta
+type Emitter interface {
+	features.Feature
+
+	// Emit queues the event for delivery. It never blocks.
+	Emit(event *Event)
+}
+
+// EmitterType returns the type of Emitter interface. Can be used to implement common.HasType.
+//
+// v2ray:api:beta
+func EmitterType() interface{} {
+	return (*Emitter)(nil)
+}
+
+// FeatureGetter finds features of an instance, as core.Instance does.
+type FeatureGetter interface {
+	GetFeature(featureType interface{}) features.Feature
+}
+
+// Emit sends the event through the Emitter of the instance, if there is one. The Emitter is looked up on
+// every call, so that components created before it may emit events.
+func Emit(v FeatureGetter, event *Event) {
+	if e, ok := v.GetFeature(EmitterType()).(Emitter); ok {
+		e.Emit(event)
+	}
+}
@@ -11,6 +11,20 @@ type Feature interface {
 	common.Runnable
 }
 
+// HasDependencies is the interface for features that must be started after some other features.
+type HasDependencies interface {
+	// Dependencies returns the types of the features, in the form of their Type(), that must be started
+	// before this one.
+	Dependencies() []interface{}
+}
+
+// HasReadiness is the interface for features that keep getting ready after they are started, e.g. by loading
+// data in background.
+type HasReadiness interface {
+	// Ready returns whether the feature is ready to serve.
+	Ready() bool
+}
+
 // PrintDeprecatedFeatureWarning prints a warning for deprecated feature.
 func PrintDeprecatedFeatureWarning(feature string) {
 	newError("You are using a deprecated feature: " + feature + ". Please update your config file with latest configuration format, or update your client software.").WriteToLog()
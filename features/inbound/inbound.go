@@ -2,6 +2,7 @@ package inbound
 
 import (
 	"context"
+	"time"
 
 	"v2ray.com/core/common"
 	"v2ray.com/core/common/net"
@@ -20,6 +21,18 @@ type Handler interface {
 	GetRandomInboundProxy() (interface{}, net.Port, int)
 }
 
+// Ban is a source IP banned from an inbound handler.
+type Ban struct {
+	IP     net.IP
+	Expire time.Time
+}
+
+// BanLister is an inbound handler that bans source IPs failing authentication too often.
+type BanLister interface {
+	// Bans returns the source IPs currently banned.
+	Bans() []Ban
+}
+
 // Manager is a feature that manages InboundHandlers.
 //
 // v2ray:api:stable
@@ -32,6 +45,9 @@ type Manager interface {
 
 	// RemoveHandler removes a handler from Manager.
 	RemoveHandler(ctx context.Context, tag string) error
+
+	// ListHandlers returns all handlers in this Manager.
+	ListHandlers(ctx context.Context) []Handler
 }
 
 // ManagerType returns the type of Manager interface. Can be used for implementing common.HasType.
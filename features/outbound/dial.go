@@ -0,0 +1,41 @@
+package outbound
+
+import (
+	"context"
+
+	"v2ray.com/core/common/net"
+	"v2ray.com/core/common/session"
+	"v2ray.com/core/transport"
+	"v2ray.com/core/transport/pipe"
+)
+
+// Dial makes a connection to dest through the given handler, by dispatching a link to it. UDP connections
+// keep the boundaries of packets, if the handler can carry UDP at all.
+func Dial(ctx context.Context, handler Handler, dest net.Destination) net.Conn {
+	ctx = session.ContextWithOutbound(ctx, &session.Outbound{
+		Target: dest,
+	})
+
+	opts := pipe.OptionsFromContext(ctx)
+	uplinkReader, uplinkWriter := pipe.New(opts...)
+	downlinkReader, downlinkWriter := pipe.New(opts...)
+
+	go handler.Dispatch(ctx, &transport.Link{Reader: uplinkReader, Writer: downlinkWriter})
+
+	output := net.ConnectionOutputMulti(downlinkReader)
+	var remote net.Addr
+	if dest.Network == net.Network_UDP {
+		output = net.ConnectionOutputMultiUDP(downlinkReader)
+		if dest.Address.Family().IsIP() {
+			remote = &net.UDPAddr{IP: dest.Address.IP(), Port: int(dest.Port)}
+		}
+	} else if dest.Address.Family().IsIP() {
+		remote = &net.TCPAddr{IP: dest.Address.IP(), Port: int(dest.Port)}
+	}
+
+	options := []net.ConnectionOption{net.ConnectionInputMulti(uplinkWriter), output}
+	if remote != nil {
+		options = append(options, net.ConnectionRemoteAddr(remote))
+	}
+	return net.NewConnection(options...)
+}
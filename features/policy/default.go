@@ -5,7 +5,10 @@ import (
 )
 
 // DefaultManager is the implementation of the Manager.
-type DefaultManager struct{}
+type DefaultManager struct {
+	// Buffer is the buffer policy of all levels, or the default one if nil.
+	Buffer *Buffer
+}
 
 // Type implements common.HasType.
 func (DefaultManager) Type() interface{} {
@@ -13,8 +16,11 @@ func (DefaultManager) Type() interface{} {
 }
 
 // ForLevel implements Manager.
-func (DefaultManager) ForLevel(level uint32) Session {
+func (m DefaultManager) ForLevel(level uint32) Session {
 	p := SessionDefault()
+	if m.Buffer != nil {
+		p.Buffer = *m.Buffer
+	}
 	if level == 1 {
 		p.Timeouts.ConnectionIdle = time.Second * 600
 	}
@@ -5,6 +5,7 @@ import (
 	"runtime"
 	"time"
 
+	"v2ray.com/core/common/net"
 	"v2ray.com/core/common/platform"
 	"v2ray.com/core/features"
 )
@@ -19,6 +20,10 @@ type Timeout struct {
 	UplinkOnly time.Duration
 	// Timeout for an downlink only connection, i.e., the uplink of the connection has been closed.
 	DownlinkOnly time.Duration
+	// Timeout for the uplink of a connection being idle, regardless of its downlink. Zero disables it.
+	UplinkIdle time.Duration
+	// Timeout for the downlink of a connection being idle, regardless of its uplink. Zero disables it.
+	DownlinkIdle time.Duration
 }
 
 // Stats contains settings for stats counters.
@@ -29,6 +34,22 @@ type Stats struct {
 	UserDownlink bool
 }
 
+// UDP contains limits for destinations of UDP traffic.
+type UDP struct {
+	// Destination ports allowed. All ports are allowed if empty.
+	AllowedPorts net.MemoryPortList
+	// Destination ports denied, even if allowed by AllowedPorts.
+	DeniedPorts net.MemoryPortList
+}
+
+// Allows returns true if UDP traffic to the destination port is allowed.
+func (u UDP) Allows(port net.Port) bool {
+	if u.DeniedPorts.Contains(port) {
+		return false
+	}
+	return len(u.AllowedPorts) == 0 || u.AllowedPorts.Contains(port)
+}
+
 // Buffer contains settings for internal buffer.
 type Buffer struct {
 	// Size of buffer per connection, in bytes. -1 for unlimited buffer.
@@ -45,6 +66,14 @@ type SystemStats struct {
 	OutboundUplink bool
 	// Whether or not to enable stat counter for downlink traffic in outbound handlers.
 	OutboundDownlink bool
+	// Whether or not to enable the gauge of UDP sessions and the counter of evicted ones in inbound handlers.
+	InboundUDPSessions bool
+	// Whether or not to enable the gauges of live sessions and goroutines, and the counter of sessions in inbound handlers.
+	InboundSessions bool
+	// Whether or not to enable the gauges of live sessions and goroutines, and the counter of sessions in outbound handlers.
+	OutboundSessions bool
+	// Whether or not to enable the counters of traffic, connections and failed dials of each transport.
+	Transport bool
 }
 
 // System contains policy settings at system level.
@@ -58,6 +87,7 @@ type Session struct {
 	Timeouts Timeout // Timeout settings
 	Stats    Stats
 	Buffer   Buffer
+	UDP      UDP
 }
 
 // Manager is a feature that provides Policy for the given user by its id or level.
@@ -107,6 +137,12 @@ func init() {
 	}
 }
 
+// DefaultBufferSize returns the buffer size per connection, in bytes, where policies don't set it, as the
+// environment variable v2ray.ray.buffer.size sets. -1 means unlimited buffer.
+func DefaultBufferSize() int32 {
+	return defaultBufferSize
+}
+
 func defaultBufferPolicy() Buffer {
 	return Buffer{
 		PerConnection: defaultBufferSize,
@@ -135,9 +171,25 @@ func SessionDefault() Session {
 type policyKey int32
 
 const (
-	bufferPolicyKey policyKey = 0
+	bufferPolicyKey      policyKey = 0
+	defaultBufferSizeKey policyKey = 1
 )
 
+// ContextWithDefaultBufferSize returns a context in which policy managers created default to the buffer size
+// per connection. It scopes the buffer size of the system config to an instance.
+func ContextWithDefaultBufferSize(ctx context.Context, size int32) context.Context {
+	return context.WithValue(ctx, defaultBufferSizeKey, size)
+}
+
+// DefaultBufferSizeFromContext returns the buffer size per connection in ctx, or DefaultBufferSize if there
+// is none.
+func DefaultBufferSizeFromContext(ctx context.Context) int32 {
+	if size, ok := ctx.Value(defaultBufferSizeKey).(int32); ok {
+		return size
+	}
+	return DefaultBufferSize()
+}
+
 func ContextWithBufferPolicy(ctx context.Context, p Buffer) context.Context {
 	return context.WithValue(ctx, bufferPolicyKey, p)
 }
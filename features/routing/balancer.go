@@ -0,0 +1,28 @@
+package routing
+
+// BalancerOutbound is an outbound of a balancer.
+//
+// v2ray:api:beta
+type BalancerOutbound struct {
+	Tag string
+	// Healthy is whether the balancer considers the outbound usable.
+	Healthy bool
+}
+
+// BalancerState is the state of a balancer.
+//
+// v2ray:api:beta
+type BalancerState struct {
+	// Active is the tag of the outbound in use, if the balancer sticks to one.
+	Active string
+	// Outbounds are the outbounds of the balancer, in the order of preference if there is one.
+	Outbounds []BalancerOutbound
+}
+
+// BalancerInspector is an optional feature of Router, which reports the state of its balancers.
+//
+// v2ray:api:beta
+type BalancerInspector interface {
+	// GetBalancerState returns the state of the balancer with the given tag.
+	GetBalancerState(tag string) (*BalancerState, error)
+}
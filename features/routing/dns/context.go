@@ -3,7 +3,10 @@ package dns
 //go:generate go run v2ray.com/core/common/errors/errorgen
 
 import (
+	"context"
+
 	"v2ray.com/core/common/net"
+	"v2ray.com/core/common/session"
 	"v2ray.com/core/features/dns"
 	"v2ray.com/core/features/routing"
 )
@@ -26,12 +29,17 @@ func (ctx *ResolvableContext) GetTargetIPs() []net.IP {
 	}
 
 	if domain := ctx.GetTargetDomain(); len(domain) != 0 {
-		ips, err := ctx.dnsClient.LookupIP(domain)
+		// Resolves on behalf of the session being routed, if known, so that its ID is logged.
+		sessionCtx := context.Background()
+		if c, ok := ctx.Context.(interface{ GetSessionID() session.ID }); ok && c.GetSessionID() != 0 {
+			sessionCtx = session.ContextWithID(sessionCtx, c.GetSessionID())
+		}
+		ips, err := dns.ClientWithContext(sessionCtx, ctx.dnsClient).LookupIP(domain)
 		if err == nil {
 			ctx.resolvedIPs = ips
 			return ips
 		}
-		newError("resolve ip for ", domain).Base(err).WriteToLog()
+		newError("resolve ip for ", domain).Base(err).WriteToLog(session.ExportIDToError(sessionCtx))
 	}
 
 	return nil
@@ -2,6 +2,7 @@ package routing
 
 import (
 	"v2ray.com/core/common"
+	"v2ray.com/core/common/session"
 	"v2ray.com/core/features"
 )
 
@@ -27,6 +28,17 @@ type Route interface {
 
 	// GetOutboundTag returns the tag of the outbound the connection was dispatched to.
 	GetOutboundTag() string
+
+	// GetRuleTag returns the tag of the routing rule that made the decision.
+	GetRuleTag() string
+}
+
+// AttributedRoute is a Route with attributes for the outbound handler of the connection.
+type AttributedRoute interface {
+	Route
+
+	// GetRouteAttributes returns the attributes of the route, or nil if there are none.
+	GetRouteAttributes() *session.RouteAttributes
 }
 
 // RouterType return the type of Router interface. Can be used to implement common.HasType.
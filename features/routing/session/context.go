@@ -10,11 +10,17 @@ import (
 
 // Context is an implementation of routing.Context, which is a wrapper of context.context with session info.
 type Context struct {
+	ID       session.ID
 	Inbound  *session.Inbound
 	Outbound *session.Outbound
 	Content  *session.Content
 }
 
+// GetSessionID returns the ID of the session, or 0 if unknown.
+func (ctx *Context) GetSessionID() session.ID {
+	return ctx.ID
+}
+
 // GetInboundTag implements routing.Context.
 func (ctx *Context) GetInboundTag() string {
 	if ctx.Inbound == nil {
@@ -120,6 +126,7 @@ func (ctx *Context) GetSkipDNSResolve() bool {
 // AsRoutingContext creates a context from context.context with session info.
 func AsRoutingContext(ctx context.Context) routing.Context {
 	return &Context{
+		ID:       session.IDFromContext(ctx),
 		Inbound:  session.InboundFromContext(ctx),
 		Outbound: session.OutboundFromContext(ctx),
 		Content:  session.ContentFromContext(ctx),
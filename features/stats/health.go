@@ -0,0 +1,36 @@
+package stats
+
+import "time"
+
+// OutboundHealth is a summary of the recent connections of an outbound.
+//
+// v2ray:api:beta
+type OutboundHealth struct {
+	// Dials is the number of dial attempts in the window, including failed ones.
+	Dials int
+	// Failures is the number of dial attempts that failed.
+	Failures int
+	// Sessions is the number of sessions that ended in the window.
+	Sessions int
+	// Aborted is the number of sessions that ended with an error before any downlink byte.
+	Aborted int
+	// LatencyP50 and LatencyP95 are percentiles of the latency of successful dials.
+	LatencyP50 time.Duration
+	LatencyP95 time.Duration
+	// Updated is the time of the latest sample.
+	Updated time.Time
+}
+
+// HealthRecorder is an optional feature of Manager, which keeps track of the health of outbounds
+// from the connections they make.
+//
+// v2ray:api:beta
+type HealthRecorder interface {
+	// RecordDial records a dial attempt of the outbound with the given tag.
+	RecordDial(tag string, latency time.Duration, err error)
+	// RecordSession records a finished session of the outbound with the given tag.
+	RecordSession(tag string, aborted bool)
+	// OutboundHealth returns the summary of the outbound with the given tag, or false if there is
+	// no recent sample.
+	OutboundHealth(tag string) (*OutboundHealth, bool)
+}
@@ -0,0 +1,12 @@
+package stats
+
+// QuotaEnforcer is an optional feature of Manager, which rejects users whose traffic exceeds their
+// quota. The traffic of a user is the sum of their uplink and downlink counters.
+//
+// v2ray:api:beta
+type QuotaEnforcer interface {
+	// SetQuota sets the quota in bytes of the user with the given email. Zero removes the quota.
+	SetQuota(email string, quota uint64)
+	// IsOverQuota returns true if the user with the given email has used up their quota.
+	IsOverQuota(email string) bool
+}
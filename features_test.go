@@ -0,0 +1,112 @@
+package core_test
+
+import (
+	"strings"
+	"testing"
+
+	. "v2ray.com/core"
+	"v2ray.com/core/app/dispatcher"
+	"v2ray.com/core/app/proxyman"
+	_ "v2ray.com/core/app/proxyman/inbound"
+	_ "v2ray.com/core/app/proxyman/outbound"
+	"v2ray.com/core/common/errors"
+	"v2ray.com/core/common/net"
+	"v2ray.com/core/common/serial"
+	"v2ray.com/core/proxy/dokodemo"
+	"v2ray.com/core/proxy/freedom"
+	"v2ray.com/core/transport/internet"
+	_ "v2ray.com/core/transport/internet/kcp"
+	_ "v2ray.com/core/transport/internet/tcp"
+)
+
+func TestRegisteredFeatures(t *testing.T) {
+	expected := []RegisteredFeature{
+		{Kind: "app", Name: "dispatcher", Type: "v2ray.core.app.dispatcher.Config"},
+		{Kind: "inbound", Name: "dokodemo", Type: "v2ray.core.proxy.dokodemo.Config"},
+		{Kind: "outbound", Name: "freedom", Type: "v2ray.core.proxy.freedom.Config"},
+		{Kind: "transport", Name: "mkcp"},
+	}
+
+	features := RegisteredFeatures()
+	for _, e := range expected {
+		found := false
+		for _, f := range features {
+			if f == e {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Error("feature not found: ", e)
+		}
+	}
+}
+
+func TestDisabledFeatures(t *testing.T) {
+	config := func(disabled ...string) *Config {
+		return &Config{
+			App: []*serial.TypedMessage{
+				serial.ToTypedMessage(&dispatcher.Config{}),
+				serial.ToTypedMessage(&proxyman.InboundConfig{}),
+				serial.ToTypedMessage(&proxyman.OutboundConfig{}),
+			},
+			Inbound: []*InboundHandlerConfig{
+				{
+					ReceiverSettings: serial.ToTypedMessage(&proxyman.ReceiverConfig{
+						PortRange: net.SinglePortRange(10000),
+						Listen:    net.NewIPOrDomain(net.LocalHostIP),
+						StreamSettings: &internet.StreamConfig{
+							ProtocolName: "mkcp",
+						},
+					}),
+					ProxySettings: serial.ToTypedMessage(&dokodemo.Config{
+						Address:  net.NewIPOrDomain(net.LocalHostIP),
+						Port:     80,
+						Networks: []net.Network{net.Network_TCP},
+					}),
+				},
+			},
+			Outbound: []*OutboundHandlerConfig{
+				{
+					ProxySettings: serial.ToTypedMessage(&freedom.Config{}),
+				},
+			},
+			DisabledFeatures: disabled,
+		}
+	}
+
+	if _, err := New(config("quic", "v2ray.core.proxy.vmess.inbound.Config")); err != nil {
+		t.Error("failed to create instance without disabled features in use: ", err)
+	}
+
+	cases := []struct {
+		disabled string
+		problem  string
+	}{
+		{
+			disabled: "dokodemo",
+			problem:  "inbound[0].proxy_settings: v2ray.core.proxy.dokodemo.Config is disabled by \"dokodemo\"",
+		},
+		{
+			disabled: "outbound:freedom",
+			problem:  "outbound[0].proxy_settings: v2ray.core.proxy.freedom.Config is disabled",
+		},
+		{
+			disabled: "mkcp",
+			problem:  "stream_settings: transport mkcp is disabled",
+		},
+	}
+	for _, c := range cases {
+		_, err := New(config(c.disabled))
+		if err == nil {
+			t.Error(c.disabled, ": expected error")
+			continue
+		}
+		if !strings.Contains(err.Error(), c.problem) {
+			t.Error(c.disabled, ": expected ", c.problem, ", but got ", err)
+		}
+		if errors.KindOf(err) != errors.KindConfig {
+			t.Error(c.disabled, ": expected config error, but got ", errors.KindOf(err))
+		}
+	}
+}
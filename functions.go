@@ -7,6 +7,7 @@ import (
 	"context"
 
 	"v2ray.com/core/common"
+	"v2ray.com/core/common/errors"
 	"v2ray.com/core/common/net"
 	"v2ray.com/core/features/routing"
 	"v2ray.com/core/transport/internet/udp"
@@ -49,7 +50,7 @@ func StartInstance(configFormat string, configBytes []byte) (*Instance, error) {
 func Dial(ctx context.Context, v *Instance, dest net.Destination) (net.Conn, error) {
 	dispatcher := v.GetFeature(routing.DispatcherType())
 	if dispatcher == nil {
-		return nil, newError("routing.Dispatcher is not registered in V2Ray core")
+		return nil, newError("routing.Dispatcher is not registered in V2Ray core").WithKind(errors.KindInternal)
 	}
 	r, err := dispatcher.(routing.Dispatcher).Dispatch(ctx, dest)
 	if err != nil {
@@ -73,7 +74,7 @@ func Dial(ctx context.Context, v *Instance, dest net.Destination) (net.Conn, err
 func DialUDP(ctx context.Context, v *Instance) (net.PacketConn, error) {
 	dispatcher := v.GetFeature(routing.DispatcherType())
 	if dispatcher == nil {
-		return nil, newError("routing.Dispatcher is not registered in V2Ray core")
+		return nil, newError("routing.Dispatcher is not registered in V2Ray core").WithKind(errors.KindInternal)
 	}
 	return udp.DialDispatcher(ctx, dispatcher.(routing.Dispatcher))
 }
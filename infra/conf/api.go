@@ -1,23 +1,76 @@
 package conf
 
 import (
+	"encoding/json"
+	"strconv"
 	"strings"
 
+	"v2ray.com/core"
 	"v2ray.com/core/app/commander"
+	dnsservice "v2ray.com/core/app/dns/command"
 	loggerservice "v2ray.com/core/app/log/command"
 	handlerservice "v2ray.com/core/app/proxyman/command"
+	routingservice "v2ray.com/core/app/router/command"
 	statsservice "v2ray.com/core/app/stats/command"
 	"v2ray.com/core/common/serial"
+	"v2ray.com/core/transport/internet/tls"
 )
 
+func init() {
+	handlerservice.RegisterJSONLoaders(handlerservice.JSONLoaders{
+		Inbound: func(data []byte) (*core.InboundHandlerConfig, error) {
+			config := new(InboundDetourConfig)
+			if err := json.Unmarshal(data, config); err != nil {
+				return nil, newError("invalid inbound config").Base(err)
+			}
+			return config.Build()
+		},
+		Outbound: func(data []byte) (*core.OutboundHandlerConfig, error) {
+			config := new(OutboundDetourConfig)
+			if err := json.Unmarshal(data, config); err != nil {
+				return nil, newError("invalid outbound config").Base(err)
+			}
+			return config.Build()
+		},
+	})
+}
+
 type APIConfig struct {
-	Tag      string   `json:"tag"`
-	Services []string `json:"services"`
+	Tag            string     `json:"tag"`
+	Services       []string   `json:"services"`
+	Listen         string     `json:"listen"`
+	UnixSocket     string     `json:"unixSocket"`
+	UnixSocketMode string     `json:"unixSocketMode"`
+	TLSSettings    *TLSConfig `json:"tlsSettings"`
+	Token          string     `json:"token"`
 }
 
 func (c *APIConfig) Build() (*commander.Config, error) {
-	if c.Tag == "" {
-		return nil, newError("API tag can't be empty.")
+	if c.Tag == "" && c.Listen == "" && c.UnixSocket == "" {
+		return nil, newError("API tag or listen address must be specified.")
+	}
+
+	config := &commander.Config{
+		Tag:        c.Tag,
+		Listen:     c.Listen,
+		UnixSocket: c.UnixSocket,
+		Token:      c.Token,
+	}
+
+	if c.UnixSocketMode != "" {
+		mode, err := strconv.ParseUint(c.UnixSocketMode, 8, 32)
+		if err != nil {
+			return nil, newError("invalid unixSocketMode: ", c.UnixSocketMode).Base(err)
+		}
+		config.UnixSocketMode = uint32(mode)
+	}
+
+	if c.TLSSettings != nil {
+		ts, err := c.TLSSettings.Build()
+		if err != nil {
+			return nil, newError("failed to build TLS config for API").Base(err)
+		}
+		config.Tls = ts.(*tls.Config)
 	}
 
 	services := make([]*serial.TypedMessage, 0, 16)
@@ -31,11 +84,15 @@ func (c *APIConfig) Build() (*commander.Config, error) {
 			services = append(services, serial.ToTypedMessage(&loggerservice.Config{}))
 		case "statsservice":
 			services = append(services, serial.ToTypedMessage(&statsservice.Config{}))
+		case "routingservice":
+			services = append(services, serial.ToTypedMessage(&routingservice.Config{}))
+		case "dnsservice":
+			services = append(services, serial.ToTypedMessage(&dnsservice.Config{}))
+		case "serverservice":
+			services = append(services, serial.ToTypedMessage(&commander.ServerConfig{}))
 		}
 	}
 
-	return &commander.Config{
-		Tag:     c.Tag,
-		Service: services,
-	}, nil
+	config.Service = services
+	return config, nil
 }
@@ -0,0 +1,67 @@
+package conf_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	"v2ray.com/core/app/commander"
+	handlerservice "v2ray.com/core/app/proxyman/command"
+	"v2ray.com/core/common/serial"
+	. "v2ray.com/core/infra/conf"
+)
+
+func TestAPIConfig(t *testing.T) {
+	parser := func(s string) (proto.Message, error) {
+		config := new(APIConfig)
+		if err := json.Unmarshal([]byte(s), config); err != nil {
+			return nil, err
+		}
+		return config.Build()
+	}
+
+	runMultiTestCase(t, []TestCase{
+		{
+			Input: `{
+				"tag": "api",
+				"services": ["HandlerService"]
+			}`,
+			Parser: parser,
+			Output: &commander.Config{
+				Tag: "api",
+				Service: []*serial.TypedMessage{
+					serial.ToTypedMessage(&handlerservice.Config{}),
+				},
+			},
+		},
+		{
+			Input: `{
+				"unixSocket": "/run/v2ray/api.sock",
+				"unixSocketMode": "0660",
+				"token": "secret",
+				"services": ["HandlerService"]
+			}`,
+			Parser: parser,
+			Output: &commander.Config{
+				UnixSocket:     "/run/v2ray/api.sock",
+				UnixSocketMode: 0660,
+				Token:          "secret",
+				Service: []*serial.TypedMessage{
+					serial.ToTypedMessage(&handlerservice.Config{}),
+				},
+			},
+		},
+	})
+}
+
+func TestAPIConfigInvalid(t *testing.T) {
+	for _, c := range []*APIConfig{
+		{},
+		{Listen: "127.0.0.1:10085", UnixSocketMode: "999"},
+	} {
+		if _, err := c.Build(); err == nil {
+			t.Error("expected error for ", c, ", but got nil")
+		}
+	}
+}
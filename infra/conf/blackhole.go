@@ -15,10 +15,21 @@ func (*NoneResponse) Build() (proto.Message, error) {
 	return new(blackhole.NoneResponse), nil
 }
 
-type HTTPResponse struct{}
+type HTTPResponse struct {
+	StatusCode uint32            `json:"statusCode"`
+	Header     map[string]string `json:"header"`
+	Body       string            `json:"body"`
+}
 
-func (*HTTPResponse) Build() (proto.Message, error) {
-	return new(blackhole.HTTPResponse), nil
+func (v *HTTPResponse) Build() (proto.Message, error) {
+	if v.StatusCode != 0 && (v.StatusCode < 100 || v.StatusCode > 999) {
+		return nil, newError("invalid HTTP status code: ", v.StatusCode)
+	}
+	return &blackhole.HTTPResponse{
+		StatusCode: v.StatusCode,
+		Header:     v.Header,
+		Body:       v.Body,
+	}, nil
 }
 
 type BlackholeConfig struct {
@@ -25,6 +25,28 @@ func TestHTTPResponseJSON(t *testing.T) {
 				Response: serial.ToTypedMessage(&blackhole.HTTPResponse{}),
 			},
 		},
+		{
+			Input: `{
+				"response": {
+					"type": "http",
+					"statusCode": 451,
+					"header": {
+						"Content-Type": "text/plain"
+					},
+					"body": "{{.Domain}} is blocked by {{.Rule}}"
+				}
+			}`,
+			Parser: loadJSON(creator),
+			Output: &blackhole.Config{
+				Response: serial.ToTypedMessage(&blackhole.HTTPResponse{
+					StatusCode: 451,
+					Header: map[string]string{
+						"Content-Type": "text/plain",
+					},
+					Body: "{{.Domain}} is blocked by {{.Rule}}",
+				}),
+			},
+		},
 		{
 			Input:  `{}`,
 			Parser: loadJSON(creator),
@@ -3,6 +3,7 @@ package conf
 import (
 	"encoding/json"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"v2ray.com/core/common/net"
@@ -45,6 +46,22 @@ func (v *Address) UnmarshalJSON(data []byte) error {
 	if err := json.Unmarshal(data, &rawStr); err != nil {
 		return newError("invalid address: ", string(data)).Base(err)
 	}
+	if strings.HasPrefix(rawStr, "unix:") {
+		// An explicit unix domain socket, whose path may be relative to the working directory.
+		path := strings.TrimPrefix(rawStr, "unix:")
+		if len(path) == 0 {
+			return newError("empty unix domain socket path: ", rawStr)
+		}
+		if path[0] != '@' && !filepath.IsAbs(path) {
+			abs, err := filepath.Abs(path)
+			if err != nil {
+				return newError("invalid unix domain socket path: ", rawStr).Base(err)
+			}
+			path = abs
+		}
+		v.Address = net.DomainAddress(path)
+		return nil
+	}
 	v.Address = net.ParseAddress(rawStr)
 
 	return nil
@@ -3,6 +3,7 @@ package conf_test
 import (
 	"encoding/json"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -71,6 +72,36 @@ func TestURLParsing(t *testing.T) {
 	}
 }
 
+func TestUnixSocketParsing(t *testing.T) {
+	{
+		var address Address
+		common.Must(json.Unmarshal([]byte(`"unix:/run/v2ray.sock"`), &address))
+		if address.Domain() != "/run/v2ray.sock" {
+			t.Error("path: ", address.Domain())
+		}
+	}
+	{
+		var address Address
+		common.Must(json.Unmarshal([]byte(`"unix:@v2ray"`), &address))
+		if address.Domain() != "@v2ray" {
+			t.Error("path: ", address.Domain())
+		}
+	}
+	{
+		var address Address
+		common.Must(json.Unmarshal([]byte(`"unix:v2ray.sock"`), &address))
+		if !filepath.IsAbs(address.Domain()) || filepath.Base(address.Domain()) != "v2ray.sock" {
+			t.Error("path: ", address.Domain())
+		}
+	}
+	{
+		var address Address
+		if err := json.Unmarshal([]byte(`"unix:"`), &address); err == nil {
+			t.Error("nil error")
+		}
+	}
+}
+
 func TestInvalidAddressJson(t *testing.T) {
 	rawJSON := "1234"
 	var address Address
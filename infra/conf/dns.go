@@ -11,11 +11,15 @@ import (
 )
 
 type NameServerConfig struct {
-	Address   *Address
-	ClientIP  *Address
-	Port      uint16
-	Domains   []string
-	ExpectIPs StringList
+	Address      *Address
+	ClientIP     *Address
+	Port         uint16
+	Domains      []string
+	ExpectIPs    StringList
+	Tag          string
+	OutboundTag  string
+	Priority     int32
+	SkipFallback bool
 }
 
 func (c *NameServerConfig) UnmarshalJSON(data []byte) error {
@@ -26,11 +30,15 @@ func (c *NameServerConfig) UnmarshalJSON(data []byte) error {
 	}
 
 	var advanced struct {
-		Address   *Address   `json:"address"`
-		ClientIP  *Address   `json:"clientIp"`
-		Port      uint16     `json:"port"`
-		Domains   []string   `json:"domains"`
-		ExpectIPs StringList `json:"expectIps"`
+		Address      *Address   `json:"address"`
+		ClientIP     *Address   `json:"clientIp"`
+		Port         uint16     `json:"port"`
+		Domains      []string   `json:"domains"`
+		ExpectIPs    StringList `json:"expectIps"`
+		Tag          string     `json:"tag"`
+		OutboundTag  string     `json:"outboundTag"`
+		Priority     int32      `json:"priority"`
+		SkipFallback bool       `json:"skipFallback"`
 	}
 	if err := json.Unmarshal(data, &advanced); err == nil {
 		c.Address = advanced.Address
@@ -38,6 +46,10 @@ func (c *NameServerConfig) UnmarshalJSON(data []byte) error {
 		c.Port = advanced.Port
 		c.Domains = advanced.Domains
 		c.ExpectIPs = advanced.ExpectIPs
+		c.Tag = advanced.Tag
+		c.OutboundTag = advanced.OutboundTag
+		c.Priority = advanced.Priority
+		c.SkipFallback = advanced.SkipFallback
 		return nil
 	}
 
@@ -108,6 +120,10 @@ func (c *NameServerConfig) Build() (*dns.NameServer, error) {
 		PrioritizedDomain: domains,
 		Geoip:             geoipList,
 		OriginalRules:     originalRules,
+		Tag:               c.Tag,
+		OutboundTag:       c.OutboundTag,
+		Priority:          c.Priority,
+		SkipFallback:      c.SkipFallback,
 	}, nil
 }
 
@@ -118,29 +134,63 @@ var typeMap = map[router.Domain_Type]dns.DomainMatchingType{
 	router.Domain_Regex:  dns.DomainMatchingType_Regex,
 }
 
+// HostAddress is the address of a static host, either an address, or an object with the address and
+// whether to pin it.
+type HostAddress struct {
+	*Address
+	Pin bool
+}
+
+func (h *HostAddress) UnmarshalJSON(data []byte) error {
+	var address Address
+	if err := json.Unmarshal(data, &address); err == nil {
+		h.Address = &address
+		return nil
+	}
+
+	var advanced struct {
+		Address *Address `json:"address"`
+		Pin     bool     `json:"pin"`
+	}
+	if err := json.Unmarshal(data, &advanced); err == nil && advanced.Address != nil {
+		h.Address = advanced.Address
+		h.Pin = advanced.Pin
+		return nil
+	}
+
+	return newError("failed to parse host address: ", string(data))
+}
+
 // DNSConfig is a JSON serializable object for dns.Config.
 type DNSConfig struct {
-	Servers  []*NameServerConfig `json:"servers"`
-	Hosts    map[string]*Address `json:"hosts"`
-	ClientIP *Address            `json:"clientIp"`
-	Tag      string              `json:"tag"`
+	Servers         []*NameServerConfig     `json:"servers"`
+	Hosts           map[string]*HostAddress `json:"hosts"`
+	ClientIP        *Address                `json:"clientIp"`
+	Tag             string                  `json:"tag"`
+	Prefetch        StringList              `json:"prefetch"`
+	PrefetchTimeout uint32                  `json:"prefetchTimeout"`
 }
 
-func getHostMapping(addr *Address) *dns.Config_HostMapping {
+func getHostMapping(addr *HostAddress) *dns.Config_HostMapping {
 	if addr.Family().IsIP() {
 		return &dns.Config_HostMapping{
 			Ip: [][]byte{[]byte(addr.IP())},
 		}
 	}
 	return &dns.Config_HostMapping{
-		ProxiedDomain: addr.Domain(),
+		ProxiedDomain: net.NormalizeDomain(addr.Domain()),
+		Pin:           addr.Pin,
 	}
 }
 
 // Build implements Buildable
 func (c *DNSConfig) Build() (*dns.Config, error) {
 	config := &dns.Config{
-		Tag: c.Tag,
+		Tag:             c.Tag,
+		PrefetchTimeout: c.PrefetchTimeout,
+	}
+	for _, domain := range c.Prefetch {
+		config.Prefetch = append(config.Prefetch, net.NormalizeDomain(domain))
 	}
 
 	if c.ClientIP != nil {
@@ -171,6 +221,9 @@ func (c *DNSConfig) Build() (*dns.Config, error) {
 
 		for _, domain := range domains {
 			addr := c.Hosts[domain]
+			if addr.Pin && addr.Family().IsIP() {
+				return nil, newError("only hosts mapped to domains can be pinned: ", domain)
+			}
 			var mappings []*dns.Config_HostMapping
 			switch {
 			case strings.HasPrefix(domain, "domain:"):
@@ -180,7 +233,7 @@ func (c *DNSConfig) Build() (*dns.Config, error) {
 				}
 				mapping := getHostMapping(addr)
 				mapping.Type = dns.DomainMatchingType_Subdomain
-				mapping.Domain = domainName
+				mapping.Domain = net.NormalizeDomain(domainName)
 				mappings = append(mappings, mapping)
 
 			case strings.HasPrefix(domain, "geosite:"):
@@ -216,7 +269,7 @@ func (c *DNSConfig) Build() (*dns.Config, error) {
 				}
 				mapping := getHostMapping(addr)
 				mapping.Type = dns.DomainMatchingType_Keyword
-				mapping.Domain = keywordVal
+				mapping.Domain = strings.ToLower(keywordVal)
 				mappings = append(mappings, mapping)
 
 			case strings.HasPrefix(domain, "full:"):
@@ -226,7 +279,7 @@ func (c *DNSConfig) Build() (*dns.Config, error) {
 				}
 				mapping := getHostMapping(addr)
 				mapping.Type = dns.DomainMatchingType_Full
-				mapping.Domain = fullVal
+				mapping.Domain = net.NormalizeDomain(fullVal)
 				mappings = append(mappings, mapping)
 
 			case strings.HasPrefix(domain, "dotless:"):
@@ -263,7 +316,7 @@ func (c *DNSConfig) Build() (*dns.Config, error) {
 			default:
 				mapping := getHostMapping(addr)
 				mapping.Type = dns.DomainMatchingType_Full
-				mapping.Domain = domain
+				mapping.Domain = net.NormalizeDomain(domain)
 				mappings = append(mappings, mapping)
 			}
 
@@ -24,3 +24,13 @@ func (c *DNSOutboundConfig) Build() (proto.Message, error) {
 	}
 	return config, nil
 }
+
+type DNSInboundConfig struct {
+	UserLevel uint32 `json:"userLevel"`
+}
+
+func (c *DNSInboundConfig) Build() (proto.Message, error) {
+	return &dns.ServerConfig{
+		UserLevel: c.UserLevel,
+	}, nil
+}
@@ -31,3 +31,21 @@ func TestDnsProxyConfig(t *testing.T) {
 		},
 	})
 }
+
+func TestDnsInboundConfig(t *testing.T) {
+	creator := func() Buildable {
+		return new(DNSInboundConfig)
+	}
+
+	runMultiTestCase(t, []TestCase{
+		{
+			Input: `{
+				"userLevel": 1
+			}`,
+			Parser: loadJSON(creator),
+			Output: &dns.ServerConfig{
+				UserLevel: 1,
+			},
+		},
+	})
+}
@@ -38,6 +38,13 @@ func init() {
 					{Type: router.Domain_Full, Value: "example.com"},
 				},
 			},
+			{
+				CountryCode: "IDN",
+				Domain: []*router.Domain{
+					{Type: router.Domain_Domain, Value: "例子.测试"},
+					{Type: router.Domain_Full, Value: "WWW.V2Fly.Org"},
+				},
+			},
 		},
 	}
 
@@ -70,11 +77,15 @@ func TestDNSConfigParsing(t *testing.T) {
 					"address": "8.8.8.8",
 					"clientIp": "10.0.0.1",
 					"port": 5353,
-					"domains": ["domain:v2ray.com"]
+					"domains": ["domain:v2ray.com"],
+					"tag": "isp",
+					"outboundTag": "direct"
 				}],
 				"hosts": {
 					"v2ray.com": "127.0.0.1",
-					"domain:example.com": "google.com",
+					"domain:example.com": "Google.com",
+					"full:Bücher.DE": "10.0.0.3",
+					"geosite:idn": "10.0.0.2",
 					"geosite:test": "10.0.0.1",
 					"keyword:google": "8.8.8.8",
 					"regexp:.*\\.com": "8.8.4.4"
@@ -107,6 +118,8 @@ func TestDNSConfigParsing(t *testing.T) {
 								Size: 1,
 							},
 						},
+						Tag:         "isp",
+						OutboundTag: "direct",
 					},
 				},
 				StaticHosts: []*dns.Config_HostMapping{
@@ -115,6 +128,21 @@ func TestDNSConfigParsing(t *testing.T) {
 						Domain:        "example.com",
 						ProxiedDomain: "google.com",
 					},
+					{
+						Type:   dns.DomainMatchingType_Full,
+						Domain: "xn--bcher-kva.de",
+						Ip:     [][]byte{{10, 0, 0, 3}},
+					},
+					{
+						Type:   dns.DomainMatchingType_Subdomain,
+						Domain: "xn--fsqu00a.xn--0zwm56d",
+						Ip:     [][]byte{{10, 0, 0, 2}},
+					},
+					{
+						Type:   dns.DomainMatchingType_Full,
+						Domain: "www.v2fly.org",
+						Ip:     [][]byte{{10, 0, 0, 2}},
+					},
 					{
 						Type:   dns.DomainMatchingType_Full,
 						Domain: "example.com",
@@ -139,5 +167,78 @@ func TestDNSConfigParsing(t *testing.T) {
 				ClientIp: []byte{10, 0, 0, 1},
 			},
 		},
+		{
+			Input: `{
+				"servers": [{
+					"address": "8.8.8.8",
+					"domains": ["geosite:test"],
+					"priority": 10,
+					"skipFallback": true
+				}]
+			}`,
+			Parser: parserCreator(),
+			Output: &dns.Config{
+				NameServer: []*dns.NameServer{
+					{
+						Address: &net.Endpoint{
+							Address: &net.IPOrDomain{
+								Address: &net.IPOrDomain_Ip{
+									Ip: []byte{8, 8, 8, 8},
+								},
+							},
+							Network: net.Network_UDP,
+						},
+						PrioritizedDomain: []*dns.NameServer_PriorityDomain{
+							{
+								Type:   dns.DomainMatchingType_Full,
+								Domain: "example.com",
+							},
+						},
+						OriginalRules: []*dns.NameServer_OriginalRule{
+							{
+								Rule: "geosite:test",
+								Size: 1,
+							},
+						},
+						Priority:     10,
+						SkipFallback: true,
+					},
+				},
+			},
+		},
+		{
+			Input: `{
+				"hosts": {
+					"domain:example.com": {"address": "Google.com", "pin": true},
+					"v2ray.com": {"address": "127.0.0.1"}
+				},
+				"prefetch": ["V2Fly.org"],
+				"prefetchTimeout": 3
+			}`,
+			Parser: parserCreator(),
+			Output: &dns.Config{
+				StaticHosts: []*dns.Config_HostMapping{
+					{
+						Type:          dns.DomainMatchingType_Subdomain,
+						Domain:        "example.com",
+						ProxiedDomain: "google.com",
+						Pin:           true,
+					},
+					{
+						Type:   dns.DomainMatchingType_Full,
+						Domain: "v2ray.com",
+						Ip:     [][]byte{{127, 0, 0, 1}},
+					},
+				},
+				Prefetch:        []string{"v2fly.org"},
+				PrefetchTimeout: 3,
+			},
+		},
 	})
+
+	config := new(DNSConfig)
+	common.Must(json.Unmarshal([]byte(`{"hosts": {"v2ray.com": {"address": "127.0.0.1", "pin": true}}}`), config))
+	if _, err := config.Build(); err == nil {
+		t.Error("expect error for pinning a host mapped to IP")
+	}
 }
@@ -1,17 +1,50 @@
 package conf
 
 import (
+	"encoding/json"
+
 	"github.com/golang/protobuf/proto"
 	"v2ray.com/core/proxy/dokodemo"
 )
 
+// DokodemoAutoRedirectConfig is the settings of "autoRedirect". It is either a boolean, or an object.
+type DokodemoAutoRedirectConfig struct {
+	Enabled    bool   `json:"-"`
+	Fwmark     uint32 `json:"fwmark"`
+	RouteTable uint32 `json:"routeTable"`
+	BypassMark uint32 `json:"bypassMark"`
+}
+
+// UnmarshalJSON implements encoding/json.Unmarshaler.
+func (c *DokodemoAutoRedirectConfig) UnmarshalJSON(data []byte) error {
+	var enabled bool
+	if err := json.Unmarshal(data, &enabled); err == nil {
+		*c = DokodemoAutoRedirectConfig{Enabled: enabled}
+		return nil
+	}
+
+	type config DokodemoAutoRedirectConfig
+	var v config
+	if err := json.Unmarshal(data, &v); err != nil {
+		return newError("invalid autoRedirect settings").Base(err)
+	}
+	*c = DokodemoAutoRedirectConfig(v)
+	c.Enabled = true
+	return nil
+}
+
 type DokodemoConfig struct {
-	Host         *Address     `json:"address"`
-	PortValue    uint16       `json:"port"`
-	NetworkList  *NetworkList `json:"network"`
-	TimeoutValue uint32       `json:"timeout"`
-	Redirect     bool         `json:"followRedirect"`
-	UserLevel    uint32       `json:"userLevel"`
+	Host         *Address                    `json:"address"`
+	PortValue    uint16                      `json:"port"`
+	NetworkList  *NetworkList                `json:"network"`
+	TimeoutValue uint32                      `json:"timeout"`
+	Redirect     bool                        `json:"followRedirect"`
+	UserLevel    uint32                      `json:"userLevel"`
+	AutoRedirect *DokodemoAutoRedirectConfig `json:"autoRedirect"`
+
+	AcceptRoutingHint bool   `json:"acceptRoutingHint"`
+	DropMulticast     bool   `json:"dropMulticast"`
+	MulticastOutbound string `json:"multicastOutbound"`
 }
 
 func (v *DokodemoConfig) Build() (proto.Message, error) {
@@ -24,5 +57,18 @@ func (v *DokodemoConfig) Build() (proto.Message, error) {
 	config.Timeout = v.TimeoutValue
 	config.FollowRedirect = v.Redirect
 	config.UserLevel = v.UserLevel
+	config.AcceptRoutingHint = v.AcceptRoutingHint
+	config.DropMulticast = v.DropMulticast
+	config.MulticastOutbound = v.MulticastOutbound
+	if v.AutoRedirect != nil && v.AutoRedirect.Enabled {
+		if !v.Redirect {
+			return nil, newError("autoRedirect requires followRedirect")
+		}
+		config.AutoRedirect = &dokodemo.AutoRedirect{
+			Fwmark:     v.AutoRedirect.Fwmark,
+			RouteTable: v.AutoRedirect.RouteTable,
+			BypassMark: v.AutoRedirect.BypassMark,
+		}
+	}
 	return config, nil
 }
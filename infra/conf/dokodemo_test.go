@@ -37,5 +37,80 @@ func TestDokodemoConfig(t *testing.T) {
 				UserLevel:      1,
 			},
 		},
+		{
+			Input: `{
+				"address": "127.0.0.1",
+				"port": 80,
+				"acceptRoutingHint": true
+			}`,
+			Parser: loadJSON(creator),
+			Output: &dokodemo.Config{
+				Address:           net.NewIPOrDomain(net.LocalHostIP),
+				Port:              80,
+				Networks:          []net.Network{net.Network_TCP},
+				AcceptRoutingHint: true,
+			},
+		},
+		{
+			Input: `{
+				"network": "udp",
+				"followRedirect": true,
+				"dropMulticast": true,
+				"multicastOutbound": "lan"
+			}`,
+			Parser: loadJSON(creator),
+			Output: &dokodemo.Config{
+				Networks:          []net.Network{net.Network_UDP},
+				FollowRedirect:    true,
+				DropMulticast:     true,
+				MulticastOutbound: "lan",
+			},
+		},
+		{
+			Input: `{
+				"network": "tcp,udp",
+				"followRedirect": true,
+				"autoRedirect": true
+			}`,
+			Parser: loadJSON(creator),
+			Output: &dokodemo.Config{
+				Networks:       []net.Network{net.Network_TCP, net.Network_UDP},
+				FollowRedirect: true,
+				AutoRedirect:   &dokodemo.AutoRedirect{},
+			},
+		},
+		{
+			Input: `{
+				"network": "tcp,udp",
+				"followRedirect": true,
+				"autoRedirect": {
+					"fwmark": 2,
+					"routeTable": 200,
+					"bypassMark": 255
+				}
+			}`,
+			Parser: loadJSON(creator),
+			Output: &dokodemo.Config{
+				Networks:       []net.Network{net.Network_TCP, net.Network_UDP},
+				FollowRedirect: true,
+				AutoRedirect: &dokodemo.AutoRedirect{
+					Fwmark:     2,
+					RouteTable: 200,
+					BypassMark: 255,
+				},
+			},
+		},
+		{
+			Input: `{
+				"network": "tcp",
+				"followRedirect": true,
+				"autoRedirect": false
+			}`,
+			Parser: loadJSON(creator),
+			Output: &dokodemo.Config{
+				Networks:       []net.Network{net.Network_TCP},
+				FollowRedirect: true,
+			},
+		},
 	})
 }
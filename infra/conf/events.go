@@ -0,0 +1,49 @@
+package conf
+
+import (
+	"v2ray.com/core/app/events"
+)
+
+type EventHookConfig struct {
+	Events  []string `json:"events"`
+	URL     string   `json:"url"`
+	Command []string `json:"command"`
+	Timeout uint32   `json:"timeout"`
+}
+
+// Build implements Buildable.
+func (c *EventHookConfig) Build() (*events.Hook, error) {
+	if (len(c.URL) > 0) == (len(c.Command) > 0) {
+		return nil, newError("events: exactly one of url and command must be set in a hook")
+	}
+	return &events.Hook{
+		Event:   c.Events,
+		Url:     c.URL,
+		Command: c.Command,
+		Timeout: c.Timeout,
+	}, nil
+}
+
+type EventsConfig struct {
+	Instance   string             `json:"instance"`
+	Hooks      []*EventHookConfig `json:"hooks"`
+	QueueSize  uint32             `json:"queueSize"`
+	MaxRetries uint32             `json:"maxRetries"`
+}
+
+// Build implements Buildable.
+func (c *EventsConfig) Build() (*events.Config, error) {
+	config := &events.Config{
+		Instance:   c.Instance,
+		QueueSize:  c.QueueSize,
+		MaxRetries: c.MaxRetries,
+	}
+	for _, h := range c.Hooks {
+		hook, err := h.Build()
+		if err != nil {
+			return nil, err
+		}
+		config.Hook = append(config.Hook, hook)
+	}
+	return config, nil
+}
@@ -0,0 +1,51 @@
+package conf_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	"v2ray.com/core/app/events"
+	"v2ray.com/core/common"
+	. "v2ray.com/core/infra/conf"
+)
+
+func TestEventsConfig(t *testing.T) {
+	parse := func(s string) (*events.Config, error) {
+		c := new(EventsConfig)
+		common.Must(json.Unmarshal([]byte(s), c))
+		return c.Build()
+	}
+
+	config, err := parse(`{
+		"instance": "node-1",
+		"queueSize": 16,
+		"hooks": [
+			{"events": ["inbound.added"], "url": "http://127.0.0.1:8080/hook", "timeout": 5},
+			{"command": ["/usr/local/bin/notify", "--quiet"]}
+		]
+	}`)
+	common.Must(err)
+	expected := &events.Config{
+		Instance:  "node-1",
+		QueueSize: 16,
+		Hook: []*events.Hook{
+			{
+				Event:   []string{"inbound.added"},
+				Url:     "http://127.0.0.1:8080/hook",
+				Timeout: 5,
+			},
+			{
+				Command: []string{"/usr/local/bin/notify", "--quiet"},
+			},
+		},
+	}
+	if !proto.Equal(config, expected) {
+		t.Error("expected ", expected, ", but got ", config)
+	}
+
+	if _, err := parse(`{"hooks": [{"events": ["inbound.added"]}]}`); err == nil {
+		t.Error("expected error for hook without url or command")
+	}
+}
@@ -15,6 +15,56 @@ type FreedomConfig struct {
 	Timeout        *uint32 `json:"timeout"`
 	Redirect       string  `json:"redirect"`
 	UserLevel      uint32  `json:"userLevel"`
+
+	SourceAddressPassthrough bool                    `json:"sourceAddressPassthrough"`
+	DNSServerTag             string                  `json:"dnsServerTag"`
+	Fragment                 *FreedomFragmentConfig  `json:"fragment"`
+	Multicast                *FreedomMulticastConfig `json:"multicast"`
+	UDPSocketStrategy        string                  `json:"udpSocketStrategy"`
+}
+
+type FreedomMulticastConfig struct {
+	Interface string `json:"interface"`
+	TTL       uint32 `json:"ttl"`
+}
+
+// Build implements Buildable
+func (c *FreedomMulticastConfig) Build() (*freedom.Multicast, error) {
+	if len(c.Interface) == 0 {
+		return nil, newError("interface of multicast is not specified")
+	}
+	if c.TTL > 255 {
+		return nil, newError("invalid multicast TTL: ", c.TTL)
+	}
+	return &freedom.Multicast{
+		Interface: c.Interface,
+		Ttl:       c.TTL,
+	}, nil
+}
+
+type FreedomFragmentConfig struct {
+	Length   uint32 `json:"length"`
+	MinSize  uint32 `json:"minSize"`
+	MaxSize  uint32 `json:"maxSize"`
+	MinDelay uint32 `json:"minDelay"`
+	MaxDelay uint32 `json:"maxDelay"`
+}
+
+// Build implements Buildable
+func (c *FreedomFragmentConfig) Build() (*freedom.Fragment, error) {
+	if c.MaxSize > 0 && c.MinSize > c.MaxSize {
+		return nil, newError("invalid fragment size range: ", c.MinSize, "-", c.MaxSize)
+	}
+	if c.MaxDelay > 0 && c.MinDelay > c.MaxDelay {
+		return nil, newError("invalid fragment delay range: ", c.MinDelay, "-", c.MaxDelay)
+	}
+	return &freedom.Fragment{
+		Length:   c.Length,
+		MinSize:  c.MinSize,
+		MaxSize:  c.MaxSize,
+		MinDelay: c.MinDelay,
+		MaxDelay: c.MaxDelay,
+	}, nil
 }
 
 // Build implements Buildable
@@ -34,6 +84,32 @@ func (c *FreedomConfig) Build() (proto.Message, error) {
 		config.Timeout = *c.Timeout
 	}
 	config.UserLevel = c.UserLevel
+	config.SourceAddressPassthrough = c.SourceAddressPassthrough
+	config.DnsServerTag = c.DNSServerTag
+	if c.Fragment != nil {
+		fragment, err := c.Fragment.Build()
+		if err != nil {
+			return nil, err
+		}
+		config.Fragment = fragment
+	}
+	if c.Multicast != nil {
+		multicast, err := c.Multicast.Build()
+		if err != nil {
+			return nil, err
+		}
+		config.Multicast = multicast
+	}
+	switch strings.ToLower(c.UDPSocketStrategy) {
+	case "", "per-destination", "perdestination":
+		config.UdpSocketStrategy = freedom.Config_PER_DESTINATION
+	case "per-session", "persession":
+		config.UdpSocketStrategy = freedom.Config_PER_SESSION
+	case "shared":
+		config.UdpSocketStrategy = freedom.Config_SHARED
+	default:
+		return nil, newError("unknown UDP socket strategy: ", c.UDPSocketStrategy)
+	}
 	if len(c.Redirect) > 0 {
 		host, portStr, err := net.SplitHostPort(c.Redirect)
 		if err != nil {
@@ -39,5 +39,60 @@ func TestFreedomConfig(t *testing.T) {
 				UserLevel: 1,
 			},
 		},
+		{
+			Input: `{
+				"domainStrategy": "UseIP",
+				"sourceAddressPassthrough": true
+			}`,
+			Parser: loadJSON(creator),
+			Output: &freedom.Config{
+				DomainStrategy:           freedom.Config_USE_IP,
+				SourceAddressPassthrough: true,
+			},
+		},
+		{
+			Input: `{
+				"fragment": {
+					"length": 512,
+					"minSize": 5,
+					"maxSize": 50,
+					"maxDelay": 10
+				}
+			}`,
+			Parser: loadJSON(creator),
+			Output: &freedom.Config{
+				DomainStrategy: freedom.Config_AS_IS,
+				Fragment: &freedom.Fragment{
+					Length:   512,
+					MinSize:  5,
+					MaxSize:  50,
+					MaxDelay: 10,
+				},
+			},
+		},
+		{
+			Input: `{
+				"multicast": {
+					"interface": "eth0"
+				}
+			}`,
+			Parser: loadJSON(creator),
+			Output: &freedom.Config{
+				DomainStrategy: freedom.Config_AS_IS,
+				Multicast: &freedom.Multicast{
+					Interface: "eth0",
+				},
+			},
+		},
+		{
+			Input: `{
+				"udpSocketStrategy": "per-session"
+			}`,
+			Parser: loadJSON(creator),
+			Output: &freedom.Config{
+				DomainStrategy:    freedom.Config_AS_IS,
+				UdpSocketStrategy: freedom.Config_PER_SESSION,
+			},
+		},
 	})
 }
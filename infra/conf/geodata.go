@@ -0,0 +1,186 @@
+package conf
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"v2ray.com/core/common/platform"
+	"v2ray.com/core/common/platform/filesystem"
+)
+
+var (
+	geodataAccess sync.Mutex
+	// inlineGeodata is the geodata of the config being built, by the names of the asset files.
+	inlineGeodata map[string][]byte
+)
+
+// useInlineGeodata makes geodata read from the given contents instead of asset files, until the returned
+// function is called. Configs are built one at a time meanwhile.
+func useInlineGeodata(geodata map[string][]byte) func() {
+	geodataAccess.Lock()
+	inlineGeodata = geodata
+	return func() {
+		inlineGeodata = nil
+		geodataAccess.Unlock()
+	}
+}
+
+// readAsset reads an asset file such as geoip.dat, unless the config has its content inline.
+func readAsset(filename string) ([]byte, error) {
+	if content, found := inlineGeodata[filename]; found {
+		return content, nil
+	}
+	return filesystem.ReadAsset(filename)
+}
+
+// externalFile is a file that a config references, to be read when the config is built.
+type externalFile struct {
+	configLocation
+	name string
+	// asset is whether the file is looked up in the asset directories, as geodata files are.
+	asset bool
+}
+
+// referencedFile returns the file that a domain or IP rule loads, if any.
+func referencedFile(rule string) (name string, asset bool, ok bool) {
+	switch {
+	case strings.HasPrefix(rule, "geoip:"):
+		return "geoip.dat", true, true
+	case strings.HasPrefix(rule, "geosite:"):
+		return "geosite.dat", true, true
+	case strings.HasPrefix(rule, extFilePrefix):
+		return rule[len(extFilePrefix):], false, true
+	}
+	for _, prefix := range []string{"ext:", "ext-domain:", "ext-ip:"} {
+		if strings.HasPrefix(rule, prefix) {
+			kv := strings.Split(rule[len(prefix):], ":")
+			if len(kv) != 2 || len(kv[0]) == 0 {
+				// Malformed references fail to build.
+				return "", false, false
+			}
+			return kv[0], true, true
+		}
+	}
+	return "", false, false
+}
+
+// externalFiles returns the files that c references in routing rules, DNS settings and TLS certificates.
+func (c *Config) externalFiles() []externalFile {
+	var files []externalFile
+	addRules := func(loc configLocation, rules []string) {
+		for _, rule := range rules {
+			if name, asset, ok := referencedFile(rule); ok {
+				files = append(files, externalFile{loc, name, asset})
+			}
+		}
+	}
+	addList := func(loc configLocation, list *StringList) {
+		if list != nil {
+			addRules(loc, *list)
+		}
+	}
+
+	if r := c.RouterConfig; r != nil {
+		addRule := func(loc configLocation, rawRule json.RawMessage) {
+			var rule struct {
+				Domain  *StringList `json:"domain"`
+				Domains *StringList `json:"domains"`
+				IP      *StringList `json:"ip"`
+			}
+			if err := json.Unmarshal(rawRule, &rule); err != nil {
+				// Malformed rules fail to build.
+				return
+			}
+			addList(loc.field("domain"), rule.Domain)
+			addList(loc.field("domains"), rule.Domains)
+			addList(loc.field("ip"), rule.IP)
+		}
+		if r.Settings != nil {
+			for i, rule := range r.Settings.RuleList {
+				addRule(configLocation{"", "routing.settings.rules[" + strconv.Itoa(i) + "]"}, rule)
+			}
+		}
+		for i, rule := range r.RuleList {
+			source := ""
+			if i < len(r.ruleSources) {
+				source = r.ruleSources[i]
+			}
+			addRule(configLocation{source, "routing.rules[" + strconv.Itoa(i) + "]"}, rule)
+		}
+	}
+
+	if d := c.DNSConfig; d != nil {
+		for i, server := range d.Servers {
+			if server == nil {
+				continue
+			}
+			loc := configLocation{"", "dns.servers[" + strconv.Itoa(i) + "]"}
+			addRules(loc.field("domains"), server.Domains)
+			addRules(loc.field("expectIps"), server.ExpectIPs)
+		}
+		domains := make([]string, 0, len(d.Hosts))
+		for domain := range d.Hosts {
+			domains = append(domains, domain)
+		}
+		sort.Strings(domains)
+		for _, domain := range domains {
+			addRules(configLocation{"", "dns.hosts[" + domain + "]"}, []string{domain})
+		}
+	}
+
+	addTLS := func(loc configLocation, stream *StreamConfig) {
+		if stream == nil || stream.TLSSettings == nil {
+			return
+		}
+		for i, cert := range stream.TLSSettings.Certs {
+			if cert == nil {
+				continue
+			}
+			certLoc := loc.field("streamSettings.tlsSettings.certificates[" + strconv.Itoa(i) + "]")
+			if len(cert.CertFile) > 0 {
+				files = append(files, externalFile{certLoc.field("certificateFile"), cert.CertFile, false})
+			}
+			if len(cert.KeyFile) > 0 {
+				files = append(files, externalFile{certLoc.field("keyFile"), cert.KeyFile, false})
+			}
+		}
+	}
+	for _, ib := range c.locatedInbounds() {
+		addTLS(ib.configLocation, ib.StreamSetting)
+	}
+	for _, ob := range c.locatedOutbounds() {
+		addTLS(ob.configLocation, ob.StreamSetting)
+	}
+
+	return files
+}
+
+// checkExternalFiles fails for every file that c references but can't be read, such as geodata missing from
+// the asset directories, so that all of them are found at once. Geodata inline in c is not read from files.
+func (v *configValidator) checkExternalFiles(c *Config) {
+	checked := make(map[string]bool)
+	for _, f := range c.externalFiles() {
+		if f.asset {
+			if _, found := c.Geodata[f.name]; found {
+				continue
+			}
+		}
+		path := f.name
+		if f.asset {
+			path = platform.GetAssetLocation(f.name)
+		}
+		if checked[path] {
+			continue
+		}
+		checked[path] = true
+		reader, err := filesystem.NewFileReader(path)
+		if err != nil {
+			v.fail(f.configLocation, "failed to read file ", path, ": ", err)
+			continue
+		}
+		reader.Close()
+	}
+}
@@ -22,10 +22,12 @@ func (v *HTTPAccount) Build() *http.Account {
 }
 
 type HTTPServerConfig struct {
-	Timeout     uint32         `json:"timeout"`
-	Accounts    []*HTTPAccount `json:"accounts"`
-	Transparent bool           `json:"allowTransparent"`
-	UserLevel   uint32         `json:"userLevel"`
+	Timeout     uint32          `json:"timeout"`
+	Accounts    []*HTTPAccount  `json:"accounts"`
+	Transparent bool            `json:"allowTransparent"`
+	UserLevel   uint32          `json:"userLevel"`
+	ConnectUDP  bool            `json:"allowConnectUdp"`
+	Mismatch    *MismatchConfig `json:"mismatch"`
 }
 
 func (c *HTTPServerConfig) Build() (proto.Message, error) {
@@ -33,6 +35,7 @@ func (c *HTTPServerConfig) Build() (proto.Message, error) {
 		Timeout:          c.Timeout,
 		AllowTransparent: c.Transparent,
 		UserLevel:        c.UserLevel,
+		AllowConnectUdp:  c.ConnectUDP,
 	}
 
 	if len(c.Accounts) > 0 {
@@ -41,6 +44,13 @@ func (c *HTTPServerConfig) Build() (proto.Message, error) {
 			config.Accounts[account.Username] = account.Password
 		}
 	}
+	if c.Mismatch != nil {
+		mismatch, err := c.Mismatch.Build()
+		if err != nil {
+			return nil, err
+		}
+		config.Mismatch = mismatch
+	}
 
 	return config, nil
 }
@@ -23,6 +23,7 @@ func TestHTTPServerConfig(t *testing.T) {
 					}
 				],
 				"allowTransparent": true,
+				"allowConnectUdp": true,
 				"userLevel": 1
 			}`,
 			Parser: loadJSON(creator),
@@ -31,6 +32,7 @@ func TestHTTPServerConfig(t *testing.T) {
 					"my-username": "my-password",
 				},
 				AllowTransparent: true,
+				AllowConnectUdp:  true,
 				UserLevel:        1,
 				Timeout:          10,
 			},
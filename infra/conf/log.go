@@ -19,6 +19,8 @@ type LogConfig struct {
 	AccessLog string `json:"access"`
 	ErrorLog  string `json:"error"`
 	LogLevel  string `json:"loglevel"`
+	// SessionID includes the IDs of sessions in their log entries. Defaults to true.
+	SessionID *bool `json:"sessionId"`
 }
 
 func (v *LogConfig) Build() *log.Config {
@@ -43,6 +45,10 @@ func (v *LogConfig) Build() *log.Config {
 		config.ErrorLogType = log.LogType_File
 	}
 
+	if v.SessionID != nil && !*v.SessionID {
+		config.DisableSessionId = true
+	}
+
 	level := strings.ToLower(v.LogLevel)
 	switch level {
 	case "debug":
@@ -0,0 +1,22 @@
+package conf
+
+import (
+	"github.com/golang/protobuf/proto"
+
+	"v2ray.com/core/proxy/loopback"
+)
+
+type LoopbackConfig struct {
+	InboundTag string `json:"inboundTag"`
+	MaxDepth   uint32 `json:"maxDepth"`
+}
+
+func (c *LoopbackConfig) Build() (proto.Message, error) {
+	if len(c.InboundTag) == 0 {
+		return nil, newError("loopback: inboundTag is not specified")
+	}
+	return &loopback.Config{
+		InboundTag: c.InboundTag,
+		MaxDepth:   c.MaxDepth,
+	}, nil
+}
@@ -0,0 +1,28 @@
+package conf_test
+
+import (
+	"testing"
+
+	. "v2ray.com/core/infra/conf"
+	"v2ray.com/core/proxy/loopback"
+)
+
+func TestLoopbackConfig(t *testing.T) {
+	creator := func() Buildable {
+		return new(LoopbackConfig)
+	}
+
+	runMultiTestCase(t, []TestCase{
+		{
+			Input: `{
+				"inboundTag": "second-stage",
+				"maxDepth": 2
+			}`,
+			Parser: loadJSON(creator),
+			Output: &loopback.Config{
+				InboundTag: "second-stage",
+				MaxDepth:   2,
+			},
+		},
+	})
+}
@@ -0,0 +1,172 @@
+package conf
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// mergeFields sets the fields of dst to the ones of src that are set. dst and src must be pointers to
+// structs of the same type.
+func mergeFields(dst, src interface{}) {
+	d := reflect.ValueOf(dst).Elem()
+	s := reflect.ValueOf(src).Elem()
+	for i := 0; i < s.NumField(); i++ {
+		if f := s.Field(i); !f.IsZero() && d.Field(i).CanSet() {
+			d.Field(i).Set(f)
+		}
+	}
+}
+
+// mergeInbounds merges inbounds by tag, if all of them have a tag. Otherwise they replace the
+// existing ones.
+func (c *Config) mergeInbounds(inbounds []InboundDetourConfig, fn string) {
+	for _, ib := range inbounds {
+		if ib.Tag == "" {
+			c.InboundConfigs = inbounds
+			ctllog.Println("[", fn, "] replaced inbounds, as some have no tag")
+			return
+		}
+	}
+	for i := range inbounds {
+		ib := &inbounds[i]
+		if idx := c.findInboundTag(ib.Tag); idx > -1 {
+			mergeFields(&c.InboundConfigs[idx], ib)
+			ctllog.Println("[", fn, "] updated inbound with tag: ", ib.Tag)
+		} else {
+			c.InboundConfigs = append(c.InboundConfigs, *ib)
+			ctllog.Println("[", fn, "] appended inbound with tag: ", ib.Tag)
+		}
+	}
+}
+
+// mergeOutbounds merges outbounds by tag, if all of them have a tag. Otherwise they replace the
+// existing ones. New outbounds are prepended, so that they become the default, unless the name of the
+// file contains "tail".
+func (c *Config) mergeOutbounds(outbounds []OutboundDetourConfig, fn string, tail bool) {
+	for _, ob := range outbounds {
+		if ob.Tag == "" {
+			c.OutboundConfigs = outbounds
+			ctllog.Println("[", fn, "] replaced outbounds, as some have no tag")
+			return
+		}
+	}
+	var prepended []OutboundDetourConfig
+	for i := range outbounds {
+		ob := &outbounds[i]
+		switch idx := c.findOutboundTag(ob.Tag); {
+		case idx > -1:
+			mergeFields(&c.OutboundConfigs[idx], ob)
+			ctllog.Println("[", fn, "] updated outbound with tag: ", ob.Tag)
+		case tail:
+			c.OutboundConfigs = append(c.OutboundConfigs, *ob)
+			ctllog.Println("[", fn, "] appended outbound with tag: ", ob.Tag)
+		default:
+			prepended = append(prepended, *ob)
+			ctllog.Println("[", fn, "] prepended outbound with tag: ", ob.Tag)
+		}
+	}
+	if len(prepended) > 0 {
+		c.OutboundConfigs = append(prepended, c.OutboundConfigs...)
+	}
+}
+
+// override merges the rules and balancers of o into c, by rule tag and balancer tag respectively.
+func (c *RouterConfig) override(o *RouterConfig, fn string) {
+	if o.Settings != nil {
+		c.Settings = o.Settings
+	}
+	if o.DomainStrategy != nil {
+		c.DomainStrategy = o.DomainStrategy
+	}
+	if len(o.RuleList) > 0 {
+		c.mergeRules(o.RuleList, o.ruleSources, fn)
+	}
+	if len(o.Balancers) > 0 {
+		c.mergeBalancers(o.Balancers, fn)
+	}
+}
+
+func ruleTag(rule json.RawMessage) string {
+	var tagged struct {
+		RuleTag string `json:"ruleTag"`
+	}
+	if err := json.Unmarshal(rule, &tagged); err != nil {
+		return ""
+	}
+	return tagged.RuleTag
+}
+
+// mergeRuleFields returns the rule with the fields of dst overridden by the ones of src.
+func mergeRuleFields(dst, src json.RawMessage) json.RawMessage {
+	var d, s map[string]json.RawMessage
+	if json.Unmarshal(dst, &d) != nil || json.Unmarshal(src, &s) != nil {
+		return src
+	}
+	for key, value := range s {
+		d[key] = value
+	}
+	merged, err := json.Marshal(d)
+	if err != nil {
+		return src
+	}
+	return merged
+}
+
+// mergeRules merges rules, read from the files in sources, by rule tag, if all of them have a tag.
+// Otherwise they replace the existing ones.
+func (c *RouterConfig) mergeRules(rules []json.RawMessage, sources []string, fn string) {
+	tags := make([]string, len(rules))
+	for i, rule := range rules {
+		if tags[i] = ruleTag(rule); tags[i] == "" {
+			c.RuleList = rules
+			c.ruleSources = sources
+			ctllog.Println("[", fn, "] replaced routing rules, as some have no ruleTag")
+			return
+		}
+	}
+	for len(c.ruleSources) < len(c.RuleList) {
+		c.ruleSources = append(c.ruleSources, "")
+	}
+	for i, rule := range rules {
+		source := ""
+		if i < len(sources) {
+			source = sources[i]
+		}
+		found := false
+		for idx, existing := range c.RuleList {
+			if ruleTag(existing) == tags[i] {
+				c.RuleList[idx] = mergeRuleFields(existing, rule)
+				c.ruleSources[idx] = source
+				found = true
+				break
+			}
+		}
+		if found {
+			ctllog.Println("[", fn, "] updated routing rule with tag: ", tags[i])
+		} else {
+			c.RuleList = append(c.RuleList, rule)
+			c.ruleSources = append(c.ruleSources, source)
+			ctllog.Println("[", fn, "] appended routing rule with tag: ", tags[i])
+		}
+	}
+}
+
+// mergeBalancers merges balancers by tag.
+func (c *RouterConfig) mergeBalancers(balancers []*BalancingRule, fn string) {
+	for _, b := range balancers {
+		found := false
+		for _, existing := range c.Balancers {
+			if existing.Tag == b.Tag {
+				mergeFields(existing, b)
+				found = true
+				break
+			}
+		}
+		if found {
+			ctllog.Println("[", fn, "] updated balancer with tag: ", b.Tag)
+		} else {
+			c.Balancers = append(c.Balancers, b)
+			ctllog.Println("[", fn, "] appended balancer with tag: ", b.Tag)
+		}
+	}
+}
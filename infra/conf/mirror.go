@@ -0,0 +1,32 @@
+package conf
+
+import (
+	"v2ray.com/core/app/dispatcher"
+)
+
+// MirrorConfig is the config of mirroring the traffic of sessions for debugging.
+type MirrorConfig struct {
+	InboundTags     []string `json:"inboundTag"`
+	RuleTags        []string `json:"ruleTag"`
+	File            string   `json:"file"`
+	UnixSocket      string   `json:"unixSocket"`
+	MaxSessionBytes uint64   `json:"maxSessionBytes"`
+	MaxTotalBytes   uint64   `json:"maxTotalBytes"`
+}
+
+func (c *MirrorConfig) Build() (*dispatcher.MirrorConfig, error) {
+	if len(c.InboundTags) == 0 && len(c.RuleTags) == 0 {
+		return nil, newError("mirror: no inbound or rule to mirror traffic of")
+	}
+	if (len(c.File) > 0) == (len(c.UnixSocket) > 0) {
+		return nil, newError("mirror: exactly one of file and unixSocket must be set")
+	}
+	return &dispatcher.MirrorConfig{
+		InboundTag:      c.InboundTags,
+		RuleTag:         c.RuleTags,
+		File:            c.File,
+		UnixSocket:      c.UnixSocket,
+		MaxSessionBytes: c.MaxSessionBytes,
+		MaxTotalBytes:   c.MaxTotalBytes,
+	}, nil
+}
@@ -0,0 +1,49 @@
+package conf_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	"v2ray.com/core/app/dispatcher"
+	"v2ray.com/core/common"
+	. "v2ray.com/core/infra/conf"
+)
+
+func TestMirrorConfig(t *testing.T) {
+	parse := func(s string) (*dispatcher.MirrorConfig, error) {
+		c := new(MirrorConfig)
+		common.Must(json.Unmarshal([]byte(s), c))
+		return c.Build()
+	}
+
+	config, err := parse(`{
+		"inboundTag": ["debug"],
+		"ruleTag": ["rule"],
+		"file": "/tmp/mirror",
+		"maxSessionBytes": 4096,
+		"maxTotalBytes": 1048576
+	}`)
+	common.Must(err)
+	expected := &dispatcher.MirrorConfig{
+		InboundTag:      []string{"debug"},
+		RuleTag:         []string{"rule"},
+		File:            "/tmp/mirror",
+		MaxSessionBytes: 4096,
+		MaxTotalBytes:   1048576,
+	}
+	if !proto.Equal(config, expected) {
+		t.Error("expected ", expected, ", but got ", config)
+	}
+
+	for _, s := range []string{
+		`{"file": "/tmp/mirror"}`,
+		`{"inboundTag": ["debug"]}`,
+		`{"inboundTag": ["debug"], "file": "/tmp/mirror", "unixSocket": "/tmp/mirror.sock"}`,
+	} {
+		if _, err := parse(s); err == nil {
+			t.Error("expected error for ", s)
+		}
+	}
+}
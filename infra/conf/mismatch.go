@@ -0,0 +1,61 @@
+package conf
+
+import (
+	"encoding/json"
+	"net"
+	"strconv"
+	"strings"
+
+	"v2ray.com/core/proxy"
+)
+
+// MismatchConfig is the config of what an inbound does with connections not of its protocol.
+type MismatchConfig struct {
+	Action   string          `json:"action"`
+	Response string          `json:"response"`
+	Type     string          `json:"type"`
+	Dest     json.RawMessage `json:"dest"`
+}
+
+// Build implements Buildable.
+func (c *MismatchConfig) Build() (*proxy.Mismatch, error) {
+	config := new(proxy.Mismatch)
+	switch strings.ToLower(c.Action) {
+	case "", "close":
+		config.Action = proxy.Mismatch_CLOSE
+	case "respond":
+		config.Action = proxy.Mismatch_RESPOND
+		if len(c.Response) == 0 {
+			return nil, newError("response to protocol mismatch is not specified")
+		}
+		config.Response = []byte(c.Response)
+	case "fallback":
+		config.Action = proxy.Mismatch_FALLBACK
+	default:
+		return nil, newError("unknown action of protocol mismatch: ", c.Action)
+	}
+	if config.Action != proxy.Mismatch_FALLBACK {
+		return config, nil
+	}
+
+	// The dest is a port on localhost, an address, or a path of unix socket, as dest of fallbacks of Trojan.
+	var port uint16
+	if err := json.Unmarshal(c.Dest, &port); err == nil {
+		config.Dest = "127.0.0.1:" + strconv.Itoa(int(port))
+	} else if err := json.Unmarshal(c.Dest, &config.Dest); err != nil || len(config.Dest) == 0 {
+		return nil, newError("fallback of protocol mismatch is not specified")
+	}
+	config.Type = c.Type
+	if len(config.Type) == 0 {
+		switch config.Dest[0] {
+		case '@', '/':
+			config.Type = "unix"
+		default:
+			if _, _, err := net.SplitHostPort(config.Dest); err != nil {
+				return nil, newError("invalid fallback of protocol mismatch: ", config.Dest).Base(err)
+			}
+			config.Type = "tcp"
+		}
+	}
+	return config, nil
+}
@@ -0,0 +1,20 @@
+package conf
+
+import (
+	"v2ray.com/core/app/health"
+)
+
+// ObservabilityConfig is the settings of the HTTP server for health checks.
+type ObservabilityConfig struct {
+	Listen string `json:"listen"`
+}
+
+// Build implements Buildable.
+func (c *ObservabilityConfig) Build() (*health.Config, error) {
+	if c.Listen == "" {
+		return nil, newError("observability: listen address is not set")
+	}
+	return &health.Config{
+		Listen: c.Listen,
+	}, nil
+}
@@ -5,13 +5,17 @@ import (
 )
 
 type Policy struct {
-	Handshake         *uint32 `json:"handshake"`
-	ConnectionIdle    *uint32 `json:"connIdle"`
-	UplinkOnly        *uint32 `json:"uplinkOnly"`
-	DownlinkOnly      *uint32 `json:"downlinkOnly"`
-	StatsUserUplink   bool    `json:"statsUserUplink"`
-	StatsUserDownlink bool    `json:"statsUserDownlink"`
-	BufferSize        *int32  `json:"bufferSize"`
+	Handshake         *uint32   `json:"handshake"`
+	ConnectionIdle    *uint32   `json:"connIdle"`
+	UplinkOnly        *uint32   `json:"uplinkOnly"`
+	DownlinkOnly      *uint32   `json:"downlinkOnly"`
+	UplinkIdle        *uint32   `json:"uplinkIdle"`
+	DownlinkIdle      *uint32   `json:"downlinkIdle"`
+	StatsUserUplink   bool      `json:"statsUserUplink"`
+	StatsUserDownlink bool      `json:"statsUserDownlink"`
+	BufferSize        *int32    `json:"bufferSize"`
+	UDPAllowedPorts   *PortList `json:"udpAllowedPorts"`
+	UDPDeniedPorts    *PortList `json:"udpDeniedPorts"`
 }
 
 func (t *Policy) Build() (*policy.Policy, error) {
@@ -28,6 +32,12 @@ func (t *Policy) Build() (*policy.Policy, error) {
 	if t.DownlinkOnly != nil {
 		config.DownlinkOnly = &policy.Second{Value: *t.DownlinkOnly}
 	}
+	if t.UplinkIdle != nil {
+		config.UplinkIdle = &policy.Second{Value: *t.UplinkIdle}
+	}
+	if t.DownlinkIdle != nil {
+		config.DownlinkIdle = &policy.Second{Value: *t.DownlinkIdle}
+	}
 
 	p := &policy.Policy{
 		Timeout: config,
@@ -47,23 +57,41 @@ func (t *Policy) Build() (*policy.Policy, error) {
 		}
 	}
 
+	if t.UDPAllowedPorts != nil || t.UDPDeniedPorts != nil {
+		p.Udp = new(policy.Policy_Udp)
+		if t.UDPAllowedPorts != nil {
+			p.Udp.AllowedPorts = t.UDPAllowedPorts.Build()
+		}
+		if t.UDPDeniedPorts != nil {
+			p.Udp.DeniedPorts = t.UDPDeniedPorts.Build()
+		}
+	}
+
 	return p, nil
 }
 
 type SystemPolicy struct {
-	StatsInboundUplink    bool `json:"statsInboundUplink"`
-	StatsInboundDownlink  bool `json:"statsInboundDownlink"`
-	StatsOutboundUplink   bool `json:"statsOutboundUplink"`
-	StatsOutboundDownlink bool `json:"statsOutboundDownlink"`
+	StatsInboundUplink      bool `json:"statsInboundUplink"`
+	StatsInboundDownlink    bool `json:"statsInboundDownlink"`
+	StatsOutboundUplink     bool `json:"statsOutboundUplink"`
+	StatsOutboundDownlink   bool `json:"statsOutboundDownlink"`
+	StatsInboundUDPSessions bool `json:"statsInboundUdpSessions"`
+	StatsInboundSessions    bool `json:"statsInboundSessions"`
+	StatsOutboundSessions   bool `json:"statsOutboundSessions"`
+	StatsTransport          bool `json:"statsTransport"`
 }
 
 func (p *SystemPolicy) Build() (*policy.SystemPolicy, error) {
 	return &policy.SystemPolicy{
 		Stats: &policy.SystemPolicy_Stats{
-			InboundUplink:    p.StatsInboundUplink,
-			InboundDownlink:  p.StatsInboundDownlink,
-			OutboundUplink:   p.StatsOutboundUplink,
-			OutboundDownlink: p.StatsOutboundDownlink,
+			InboundUplink:      p.StatsInboundUplink,
+			InboundDownlink:    p.StatsInboundDownlink,
+			OutboundUplink:     p.StatsOutboundUplink,
+			OutboundDownlink:   p.StatsOutboundDownlink,
+			InboundUdpSessions: p.StatsInboundUDPSessions,
+			InboundSessions:    p.StatsInboundSessions,
+			OutboundSessions:   p.StatsOutboundSessions,
+			Transport:          p.StatsTransport,
 		},
 	}, nil
 }
@@ -1,6 +1,7 @@
 package conf_test
 
 import (
+	"encoding/json"
 	"testing"
 
 	"v2ray.com/core/common"
@@ -38,3 +39,32 @@ func TestBufferSize(t *testing.T) {
 		}
 	}
 }
+
+func TestPolicyUDPPorts(t *testing.T) {
+	pConf := new(Policy)
+	common.Must(json.Unmarshal([]byte(`{"udpAllowedPorts": "53,443", "udpDeniedPorts": 53}`), pConf))
+	p, err := pConf.Build()
+	common.Must(err)
+	allowed := p.Udp.AllowedPorts.Range
+	if len(allowed) != 2 || allowed[0].From != 53 || allowed[1].From != 443 {
+		t.Error("unexpected allowed ports: ", allowed)
+	}
+	denied := p.Udp.DeniedPorts.Range
+	if len(denied) != 1 || denied[0].From != 53 || denied[0].To != 53 {
+		t.Error("unexpected denied ports: ", denied)
+	}
+}
+
+func TestPolicyIdleTimeouts(t *testing.T) {
+	pConf := new(Policy)
+	common.Must(json.Unmarshal([]byte(`{"uplinkIdle": 300}`), pConf))
+	p, err := pConf.Build()
+	common.Must(err)
+	if v := p.Timeout.UplinkIdle.GetValue(); v != 300 {
+		t.Error("expected uplink idle 300, but got ", v)
+	}
+	// Unset timeouts are left to the defaults.
+	if p.Timeout.DownlinkIdle != nil {
+		t.Error("expected no downlink idle, but got ", p.Timeout.DownlinkIdle)
+	}
+}
@@ -0,0 +1,35 @@
+package conf
+
+import (
+	"v2ray.com/core"
+	"v2ray.com/core/common/protocol"
+	"v2ray.com/core/proxy/shadowsocks"
+	"v2ray.com/core/proxy/trojan"
+	vlessinbound "v2ray.com/core/proxy/vless/inbound"
+	vmessinbound "v2ray.com/core/proxy/vmess/inbound"
+)
+
+// quotaUser returns the email of a user with a traffic quota in the inbound, or an empty string if there is none.
+func quotaUser(config *core.InboundHandlerConfig) string {
+	settings, err := config.ProxySettings.GetInstance()
+	if err != nil {
+		return ""
+	}
+	var users []*protocol.User
+	switch s := settings.(type) {
+	case *vmessinbound.Config:
+		users = s.User
+	case *vlessinbound.Config:
+		users = s.Clients
+	case *trojan.ServerConfig:
+		users = s.Users
+	case *shadowsocks.ServerConfig:
+		users = []*protocol.User{s.User}
+	}
+	for _, user := range users {
+		if user != nil && user.Quota > 0 && len(user.Email) > 0 {
+			return user.Email
+		}
+	}
+	return ""
+}
@@ -0,0 +1,22 @@
+package conf
+
+import (
+	"github.com/golang/protobuf/proto"
+
+	"v2ray.com/core/proxy/race"
+)
+
+type RaceConfig struct {
+	Outbounds  []string `json:"outbounds"`
+	MaxPayload uint32   `json:"maxPayload"`
+}
+
+func (c *RaceConfig) Build() (proto.Message, error) {
+	if len(c.Outbounds) < 2 {
+		return nil, newError("race: at least two outbounds are needed")
+	}
+	return &race.Config{
+		OutboundTags: c.Outbounds,
+		MaxPayload:   c.MaxPayload,
+	}, nil
+}
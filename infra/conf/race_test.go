@@ -0,0 +1,28 @@
+package conf_test
+
+import (
+	"testing"
+
+	. "v2ray.com/core/infra/conf"
+	"v2ray.com/core/proxy/race"
+)
+
+func TestRaceConfig(t *testing.T) {
+	creator := func() Buildable {
+		return new(RaceConfig)
+	}
+
+	runMultiTestCase(t, []TestCase{
+		{
+			Input: `{
+				"outbounds": ["line-a", "line-b"],
+				"maxPayload": 4096
+			}`,
+			Parser: loadJSON(creator),
+			Output: &race.Config{
+				OutboundTags: []string{"line-a", "line-b"},
+				MaxPayload:   4096,
+			},
+		},
+	})
+}
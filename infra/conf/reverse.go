@@ -5,28 +5,119 @@ import (
 	"v2ray.com/core/app/reverse"
 )
 
+// BridgeServiceConfig is a service that a bridge registers with portals, by its tag.
+type BridgeServiceConfig struct {
+	Tag     string   `json:"tag"`
+	Address *Address `json:"address"`
+	Port    uint16   `json:"port"`
+}
+
+func (c *BridgeServiceConfig) Build() (*reverse.BridgeService, error) {
+	if c.Tag == "" {
+		return nil, newError("tag of service is not specified")
+	}
+	if c.Address == nil || c.Port == 0 {
+		return nil, newError("address of service ", c.Tag, " is not specified")
+	}
+	return &reverse.BridgeService{
+		Tag:     c.Tag,
+		Address: c.Address.Build(),
+		Port:    uint32(c.Port),
+	}, nil
+}
+
 type BridgeConfig struct {
+	Tag              string                `json:"tag"`
+	Domain           string                `json:"domain"`
+	Domains          []string              `json:"domains"`
+	HeartbeatTimeout uint32                `json:"heartbeatTimeout"`
+	Token            string                `json:"token"`
+	Services         []BridgeServiceConfig `json:"services"`
+}
+
+func (c *BridgeConfig) Build() (*reverse.BridgeConfig, error) {
+	config := &reverse.BridgeConfig{
+		Tag:              c.Tag,
+		Domain:           c.Domain,
+		Domains:          c.Domains,
+		HeartbeatTimeout: c.HeartbeatTimeout,
+		Token:            c.Token,
+	}
+	for _, sconfig := range c.Services {
+		s, err := sconfig.Build()
+		if err != nil {
+			return nil, err
+		}
+		config.Service = append(config.Service, s)
+	}
+	return config, nil
+}
+
+type PortalBridgeConfig struct {
 	Tag    string `json:"tag"`
 	Domain string `json:"domain"`
+	Token  string `json:"token"`
 }
 
-func (c *BridgeConfig) Build() (*reverse.BridgeConfig, error) {
-	return &reverse.BridgeConfig{
+func (c *PortalBridgeConfig) Build() (*reverse.PortalBridge, error) {
+	if c.Token == "" {
+		return nil, newError("token of bridge ", c.Tag, " is not specified")
+	}
+	return &reverse.PortalBridge{
 		Tag:    c.Tag,
 		Domain: c.Domain,
+		Token:  c.Token,
+	}, nil
+}
+
+// PortalServiceConfig is an outbound of a portal, that relays traffic to a service of its bridges.
+type PortalServiceConfig struct {
+	Tag     string `json:"tag"`
+	Service string `json:"service"`
+	Bridge  string `json:"bridge"`
+}
+
+func (c *PortalServiceConfig) Build() (*reverse.PortalService, error) {
+	if c.Tag == "" {
+		return nil, newError("tag of portal service is not specified")
+	}
+	if c.Service == "" {
+		return nil, newError("service of ", c.Tag, " is not specified")
+	}
+	return &reverse.PortalService{
+		Tag:     c.Tag,
+		Service: c.Service,
+		Bridge:  c.Bridge,
 	}, nil
 }
 
 type PortalConfig struct {
-	Tag    string `json:"tag"`
-	Domain string `json:"domain"`
+	Tag      string                `json:"tag"`
+	Domain   string                `json:"domain"`
+	Bridges  []PortalBridgeConfig  `json:"bridges"`
+	Services []PortalServiceConfig `json:"services"`
 }
 
 func (c *PortalConfig) Build() (*reverse.PortalConfig, error) {
-	return &reverse.PortalConfig{
+	config := &reverse.PortalConfig{
 		Tag:    c.Tag,
 		Domain: c.Domain,
-	}, nil
+	}
+	for _, bconfig := range c.Bridges {
+		b, err := bconfig.Build()
+		if err != nil {
+			return nil, err
+		}
+		config.Bridge = append(config.Bridge, b)
+	}
+	for _, sconfig := range c.Services {
+		s, err := sconfig.Build()
+		if err != nil {
+			return nil, err
+		}
+		config.Service = append(config.Service, s)
+	}
+	return config, nil
 }
 
 type ReverseConfig struct {
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"v2ray.com/core/app/reverse"
+	"v2ray.com/core/common/net"
 	"v2ray.com/core/infra/conf"
 )
 
@@ -27,6 +28,27 @@ func TestReverseConfig(t *testing.T) {
 				},
 			},
 		},
+		{
+			Input: `{
+				"bridges": [{
+					"tag": "test",
+					"domains": ["a.test.v2ray.com", "b.test.v2ray.com"],
+					"heartbeatTimeout": 10,
+					"token": "secret"
+				}]
+			}`,
+			Parser: loadJSON(creator),
+			Output: &reverse.Config{
+				BridgeConfig: []*reverse.BridgeConfig{
+					{
+						Tag:              "test",
+						Domains:          []string{"a.test.v2ray.com", "b.test.v2ray.com"},
+						HeartbeatTimeout: 10,
+						Token:            "secret",
+					},
+				},
+			},
+		},
 		{
 			Input: `{
 				"portals": [{
@@ -41,5 +63,70 @@ func TestReverseConfig(t *testing.T) {
 				},
 			},
 		},
+		{
+			Input: `{
+				"portals": [{
+					"tag": "test",
+					"bridges": [{
+						"tag": "bridge-a",
+						"domain": "a.test.v2ray.com",
+						"token": "secret-a"
+					}]
+				}]
+			}`,
+			Parser: loadJSON(creator),
+			Output: &reverse.Config{
+				PortalConfig: []*reverse.PortalConfig{
+					{
+						Tag: "test",
+						Bridge: []*reverse.PortalBridge{
+							{Tag: "bridge-a", Domain: "a.test.v2ray.com", Token: "secret-a"},
+						},
+					},
+				},
+			},
+		},
+		{
+			Input: `{
+				"bridges": [{
+					"tag": "bridge",
+					"domain": "test.v2ray.com",
+					"services": [{
+						"tag": "web",
+						"address": "127.0.0.1",
+						"port": 8080
+					}]
+				}],
+				"portals": [{
+					"tag": "portal",
+					"domain": "test.v2ray.com",
+					"services": [{
+						"tag": "to-web",
+						"service": "web"
+					}]
+				}]
+			}`,
+			Parser: loadJSON(creator),
+			Output: &reverse.Config{
+				BridgeConfig: []*reverse.BridgeConfig{
+					{
+						Tag:    "bridge",
+						Domain: "test.v2ray.com",
+						Service: []*reverse.BridgeService{
+							{Tag: "web", Address: net.NewIPOrDomain(net.LocalHostIP), Port: 8080},
+						},
+					},
+				},
+				PortalConfig: []*reverse.PortalConfig{
+					{
+						Tag:    "portal",
+						Domain: "test.v2ray.com",
+						Service: []*reverse.PortalService{
+							{Tag: "to-web", Service: "web"},
+						},
+					},
+				},
+			},
+		},
 	})
 }
@@ -2,13 +2,13 @@ package conf
 
 import (
 	"encoding/json"
+	"net/url"
 	"strconv"
 	"strings"
 
 	"github.com/golang/protobuf/proto"
 	"v2ray.com/core/app/router"
 	"v2ray.com/core/common/net"
-	"v2ray.com/core/common/platform/filesystem"
 )
 
 type RouterRulesConfig struct {
@@ -16,9 +16,61 @@ type RouterRulesConfig struct {
 	DomainStrategy string            `json:"domainStrategy"`
 }
 
+type FailoverConfig struct {
+	ProbeURL          string `json:"probeUrl"`
+	ProbeInterval     uint32 `json:"probeInterval"`
+	ProbeTimeout      uint32 `json:"probeTimeout"`
+	FailThreshold     uint32 `json:"failThreshold"`
+	RecoveryThreshold uint32 `json:"recoveryThreshold"`
+	MinHold           uint32 `json:"minHold"`
+}
+
+// Build implements Buildable.
+func (c *FailoverConfig) Build() (*router.FailoverConfig, error) {
+	if len(c.ProbeURL) > 0 {
+		u, err := url.Parse(c.ProbeURL)
+		if err != nil {
+			return nil, newError("invalid probe URL: ", c.ProbeURL).Base(err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return nil, newError("probe URL must be HTTP or HTTPS: ", c.ProbeURL)
+		}
+	}
+	return &router.FailoverConfig{
+		ProbeUrl:          c.ProbeURL,
+		ProbeInterval:     c.ProbeInterval,
+		ProbeTimeout:      c.ProbeTimeout,
+		FailThreshold:     c.FailThreshold,
+		RecoveryThreshold: c.RecoveryThreshold,
+		MinHold:           c.MinHold,
+	}, nil
+}
+
+// RouteAttributesConfig is the attributes of routes, which outbounds honor instead of their own settings.
+type RouteAttributesConfig struct {
+	HandshakeTimeout uint32 `json:"handshakeTimeout"`
+	FirstByteTimeout uint32 `json:"firstByteTimeout"`
+	Retries          uint32 `json:"retries"`
+}
+
+// Build implements Buildable.
+func (c *RouteAttributesConfig) Build() (*router.RouteAttributes, error) {
+	return &router.RouteAttributes{
+		HandshakeTimeout: c.HandshakeTimeout,
+		FirstByteTimeout: c.FirstByteTimeout,
+		Retries:          c.Retries,
+	}, nil
+}
+
 type BalancingRule struct {
-	Tag       string     `json:"tag"`
-	Selectors StringList `json:"selector"`
+	Tag             string                 `json:"tag"`
+	Selectors       StringList             `json:"selector"`
+	Strategy        string                 `json:"strategy"`
+	Failover        *FailoverConfig        `json:"failover"`
+	RouteAttributes *RouteAttributesConfig `json:"routeAttributes"`
+
+	// source is the file the balancer is read from, if known.
+	source string
 }
 
 func (r *BalancingRule) Build() (*router.BalancingRule, error) {
@@ -29,10 +81,36 @@ func (r *BalancingRule) Build() (*router.BalancingRule, error) {
 		return nil, newError("empty selector list")
 	}
 
-	return &router.BalancingRule{
+	strategy := strings.ToLower(r.Strategy)
+	switch strategy {
+	case "", "random", "healthy", "failover":
+	default:
+		return nil, newError("unknown balancing strategy: ", r.Strategy)
+	}
+
+	rule := &router.BalancingRule{
 		Tag:              r.Tag,
 		OutboundSelector: []string(r.Selectors),
-	}, nil
+		Strategy:         strategy,
+	}
+	if r.Failover != nil {
+		if strategy != "failover" {
+			return nil, newError("failover settings of balancer ", r.Tag, " require the failover strategy")
+		}
+		failover, err := r.Failover.Build()
+		if err != nil {
+			return nil, err
+		}
+		rule.Failover = failover
+	}
+	if r.RouteAttributes != nil {
+		attributes, err := r.RouteAttributes.Build()
+		if err != nil {
+			return nil, err
+		}
+		rule.RouteAttributes = attributes
+	}
+	return rule, nil
 }
 
 type RouterConfig struct {
@@ -40,6 +118,9 @@ type RouterConfig struct {
 	RuleList       []json.RawMessage  `json:"rules"`
 	DomainStrategy *string            `json:"domainStrategy"`
 	Balancers      []*BalancingRule   `json:"balancers"`
+
+	// ruleSources are the files the rules in RuleList are read from, if known.
+	ruleSources []string
 }
 
 func (c *RouterConfig) getDomainStrategy() router.Config_DomainStrategy {
@@ -93,9 +174,11 @@ func (c *RouterConfig) Build() (*router.Config, error) {
 }
 
 type RouterRule struct {
-	Type        string `json:"type"`
-	OutboundTag string `json:"outboundTag"`
-	BalancerTag string `json:"balancerTag"`
+	Type            string                 `json:"type"`
+	OutboundTag     string                 `json:"outboundTag"`
+	BalancerTag     string                 `json:"balancerTag"`
+	RuleTag         string                 `json:"ruleTag"`
+	RouteAttributes *RouteAttributesConfig `json:"routeAttributes"`
 }
 
 func ParseIP(s string) (*router.CIDR, error) {
@@ -151,7 +234,7 @@ func loadGeoIP(country string) ([]*router.CIDR, error) {
 }
 
 func loadIP(filename, country string) ([]*router.CIDR, error) {
-	geoipBytes, err := filesystem.ReadAsset(filename)
+	geoipBytes, err := readAsset(filename)
 	if err != nil {
 		return nil, newError("failed to open file: ", filename).Base(err)
 	}
@@ -170,7 +253,7 @@ func loadIP(filename, country string) ([]*router.CIDR, error) {
 }
 
 func loadSite(filename, list string) ([]*router.Domain, error) {
-	geositeBytes, err := filesystem.ReadAsset(filename)
+	geositeBytes, err := readAsset(filename)
 	if err != nil {
 		return nil, newError("failed to open file: ", filename).Base(err)
 	}
@@ -181,6 +264,9 @@ func loadSite(filename, list string) ([]*router.Domain, error) {
 
 	for _, site := range geositeList.Entry {
 		if strings.EqualFold(site.CountryCode, list) {
+			for _, domain := range site.Domain {
+				normalizeDomainRule(domain)
+			}
 			return site.Domain, nil
 		}
 	}
@@ -272,6 +358,18 @@ func loadGeositeWithAttr(file string, siteWithAttr string) ([]*router.Domain, er
 	return filteredDomains, nil
 }
 
+// normalizeDomainRule converts the value of the rule to the form of domains being matched, which are
+// normalized by net.NormalizeDomain.
+func normalizeDomainRule(rule *router.Domain) {
+	switch rule.Type {
+	case router.Domain_Domain, router.Domain_Full:
+		rule.Value = net.NormalizeDomain(rule.Value)
+	case router.Domain_Plain:
+		// Keywords may be parts of labels, which have no punycode of their own.
+		rule.Value = strings.ToLower(rule.Value)
+	}
+}
+
 func parseDomainRule(domain string) ([]*router.Domain, error) {
 	if strings.HasPrefix(domain, "geosite:") {
 		list := domain[8:]
@@ -286,6 +384,10 @@ func parseDomainRule(domain string) ([]*router.Domain, error) {
 		return domains, nil
 	}
 
+	if strings.HasPrefix(domain, extFilePrefix) {
+		return loadDomainListFile(domain[len(extFilePrefix):])
+	}
+
 	var isExtDatFile = 0
 	{
 		const prefix = "ext:"
@@ -362,6 +464,7 @@ func parseDomainRule(domain string) ([]*router.Domain, error) {
 		domainRule.Type = router.Domain_Plain
 		domainRule.Value = domain
 	}
+	normalizeDomainRule(domainRule)
 	return []*router.Domain{domainRule}, nil
 }
 
@@ -388,6 +491,15 @@ func toCidrList(ips StringList) ([]*router.GeoIP, error) {
 			continue
 		}
 
+		if strings.HasPrefix(ip, extFilePrefix) {
+			cidrs, err := loadIPListFile(ip[len(extFilePrefix):])
+			if err != nil {
+				return nil, err
+			}
+			customCidrs = append(customCidrs, cidrs...)
+			continue
+		}
+
 		var isExtDatFile = 0
 		{
 			const prefix = "ext:"
@@ -474,6 +586,14 @@ func parseFieldRule(msg json.RawMessage) (*router.RoutingRule, error) {
 	default:
 		return nil, newError("neither outboundTag nor balancerTag is specified in routing rule")
 	}
+	rule.RuleTag = rawFieldRule.RuleTag
+	if rawFieldRule.RouteAttributes != nil {
+		attributes, err := rawFieldRule.RouteAttributes.Build()
+		if err != nil {
+			return nil, err
+		}
+		rule.RouteAttributes = attributes
+	}
 
 	if rawFieldRule.Domain != nil {
 		for _, domain := range *rawFieldRule.Domain {
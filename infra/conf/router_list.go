@@ -0,0 +1,114 @@
+package conf
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+
+	"v2ray.com/core/app/router"
+	"v2ray.com/core/common/platform/filesystem"
+)
+
+// extFilePrefix is the prefix of the rules that reference lists in plain text files, such as
+// "ext-file:/etc/v2ray/block.txt".
+const extFilePrefix = "ext-file:"
+
+type listLine struct {
+	number int
+	text   string
+}
+
+// readListFile returns the entries of a list file, one per line. Blank lines and lines starting with
+// '#' are skipped.
+func readListFile(filename string) ([]listLine, error) {
+	if len(filename) == 0 {
+		return nil, newError("empty filename in rule: ", extFilePrefix)
+	}
+	content, err := filesystem.ReadFile(filename)
+	if err != nil {
+		return nil, newError("failed to open list file: ", filename).Base(err)
+	}
+	var lines []listLine
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for number := 1; scanner.Scan(); number++ {
+		text := strings.TrimSpace(scanner.Text())
+		if len(text) == 0 || text[0] == '#' {
+			continue
+		}
+		lines = append(lines, listLine{number: number, text: text})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, newError("failed to read list file: ", filename).Base(err)
+	}
+	return lines, nil
+}
+
+// isListReference returns true if the domain rule loads a list instead of being a pattern.
+func isListReference(rule string) bool {
+	for _, prefix := range []string{"geosite:", "ext:", "ext-domain:", extFilePrefix} {
+		if strings.HasPrefix(rule, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// loadDomainListFile loads the domain patterns of a list file, written as in inline rules. Duplicated
+// patterns are loaded once.
+func loadDomainListFile(filename string) ([]*router.Domain, error) {
+	lines, err := readListFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	type pattern struct {
+		domainType router.Domain_Type
+		value      string
+	}
+	seen := make(map[pattern]bool)
+	var domains []*router.Domain
+	for _, line := range lines {
+		if isListReference(line.text) {
+			return nil, newError(filename, ":", line.number, ": lists can't be referenced in list files: ", line.text)
+		}
+		rules, err := parseDomainRule(line.text)
+		if err != nil {
+			return nil, newError(filename, ":", line.number, ": invalid domain rule").Base(err)
+		}
+		for _, rule := range rules {
+			p := pattern{domainType: rule.Type, value: rule.Value}
+			if seen[p] {
+				continue
+			}
+			seen[p] = true
+			domains = append(domains, rule)
+		}
+	}
+	return domains, nil
+}
+
+// loadIPListFile loads the IPs and CIDRs of a list file. Duplicated entries are loaded once.
+func loadIPListFile(filename string) ([]*router.CIDR, error) {
+	lines, err := readListFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	type network struct {
+		ip     string
+		prefix uint32
+	}
+	seen := make(map[network]bool)
+	var cidrs []*router.CIDR
+	for _, line := range lines {
+		cidr, err := ParseIP(line.text)
+		if err != nil {
+			return nil, newError(filename, ":", line.number, ": invalid IP").Base(err)
+		}
+		n := network{ip: string(cidr.Ip), prefix: cidr.Prefix}
+		if seen[n] {
+			continue
+		}
+		seen[n] = true
+		cidrs = append(cidrs, cidr)
+	}
+	return cidrs, nil
+}
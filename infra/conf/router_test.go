@@ -2,12 +2,19 @@ package conf_test
 
 import (
 	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/golang/protobuf/proto"
+	"github.com/google/go-cmp/cmp"
 
 	"v2ray.com/core/app/router"
+	"v2ray.com/core/common"
 	"v2ray.com/core/common/net"
+	"v2ray.com/core/common/protocol/http"
 	. "v2ray.com/core/infra/conf"
 )
 
@@ -35,7 +42,12 @@ func TestRouterConfig(t *testing.T) {
 								"baidu.com",
 								"qq.com"
 							],
-							"outboundTag": "direct"
+							"outboundTag": "direct",
+							"ruleTag": "cn",
+							"routeAttributes": {
+								"handshakeTimeout": 30,
+								"retries": 2
+							}
 						},
 						{
 							"type": "field",
@@ -67,6 +79,19 @@ func TestRouterConfig(t *testing.T) {
 					{
 						"tag": "b1",
 						"selector": ["test"]
+					},
+					{
+						"tag": "b2",
+						"selector": ["main", "backup"],
+						"strategy": "failover",
+						"failover": {
+							"probeUrl": "http://example.com/",
+							"failThreshold": 2,
+							"minHold": 300
+						},
+						"routeAttributes": {
+							"firstByteTimeout": 60
+						}
 					}
 				]
 			}`,
@@ -78,6 +103,19 @@ func TestRouterConfig(t *testing.T) {
 						Tag:              "b1",
 						OutboundSelector: []string{"test"},
 					},
+					{
+						Tag:              "b2",
+						OutboundSelector: []string{"main", "backup"},
+						Strategy:         "failover",
+						Failover: &router.FailoverConfig{
+							ProbeUrl:      "http://example.com/",
+							FailThreshold: 2,
+							MinHold:       300,
+						},
+						RouteAttributes: &router.RouteAttributes{
+							FirstByteTimeout: 60,
+						},
+					},
 				},
 				Rule: []*router.RoutingRule{
 					{
@@ -94,6 +132,11 @@ func TestRouterConfig(t *testing.T) {
 						TargetTag: &router.RoutingRule_Tag{
 							Tag: "direct",
 						},
+						RuleTag: "cn",
+						RouteAttributes: &router.RouteAttributes{
+							HandshakeTimeout: 30,
+							Retries:          2,
+						},
 					},
 					{
 						Domain: []*router.Domain{
@@ -331,3 +374,85 @@ func TestRouterConfig(t *testing.T) {
 		},
 	})
 }
+
+func TestRouterRuleListFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "v2ray-list")
+	common.Must(err)
+	defer os.RemoveAll(dir)
+
+	domainFile := filepath.Join(dir, "domains.txt")
+	common.Must(ioutil.WriteFile(domainFile, []byte(`# ads
+domain:example.com
+full:www.example.org
+
+keyword:tracker
+domain:example.com
+regexp:^ad[0-9]+\.
+`), 0644))
+	ipFile := filepath.Join(dir, "ips.txt")
+	common.Must(ioutil.WriteFile(ipFile, []byte("10.0.0.0/8\n192.0.2.1\n10.0.0.0/8\n"), 0644))
+
+	config := new(RouterConfig)
+	common.Must(json.Unmarshal([]byte(`{
+		"rules": [{
+			"type": "field",
+			"domain": ["ext-file:`+domainFile+`"],
+			"ip": ["ext-file:`+ipFile+`"],
+			"outboundTag": "block"
+		}]
+	}`), config))
+	built, err := config.Build()
+	common.Must(err)
+
+	rule := built.Rule[0]
+	expectedDomains := []*router.Domain{
+		{Type: router.Domain_Domain, Value: "example.com"},
+		{Type: router.Domain_Full, Value: "www.example.org"},
+		{Type: router.Domain_Plain, Value: "tracker"},
+		{Type: router.Domain_Regex, Value: `^ad[0-9]+\.`},
+	}
+	if r := cmp.Diff(rule.Domain, expectedDomains, cmp.Comparer(proto.Equal)); r != "" {
+		t.Error(r)
+	}
+	expectedIPs := []*router.GeoIP{{
+		Cidr: []*router.CIDR{
+			{Ip: []byte{10, 0, 0, 0}, Prefix: 8},
+			{Ip: []byte{192, 0, 2, 1}, Prefix: 32},
+		},
+	}}
+	if r := cmp.Diff(rule.Geoip, expectedIPs, cmp.Comparer(proto.Equal)); r != "" {
+		t.Error(r)
+	}
+
+	common.Must(ioutil.WriteFile(ipFile, []byte("10.0.0.0/8\n\n10.0.0.0/33\n"), 0644))
+	config = new(RouterConfig)
+	common.Must(json.Unmarshal([]byte(`{
+		"rules": [{"type": "field", "ip": ["ext-file:`+ipFile+`"], "outboundTag": "block"}]
+	}`), config))
+	if _, err := config.Build(); err == nil || !strings.Contains(err.Error(), ipFile+":3:") {
+		t.Error("expected error at line 3, but got ", err)
+	}
+}
+
+func TestRouterConfigNormalizedDomains(t *testing.T) {
+	config := new(RouterConfig)
+	common.Must(json.Unmarshal([]byte(`{
+		"rules": [{
+			"type": "field",
+			"domain": ["domain:例子.测试", "full:WWW.V2Fly.Org", "keyword:Google"],
+			"outboundTag": "direct"
+		}]
+	}`), config))
+	built, err := config.Build()
+	common.Must(err)
+	matcher, err := router.NewDomainMatcher(built.Rule[0].Domain)
+	common.Must(err)
+
+	for _, host := range []string{"www.例子.测试", "WWW.XN--FSQU00A.XN--0ZWM56D", "www.V2FLY.org", "WWW.GOOGLE.COM"} {
+		header, err := http.SniffHTTP([]byte("GET / HTTP/1.1\r\nHost: " + host + "\r\n\r\n"))
+		common.Must(err)
+		if !matcher.ApplyDomain(header.Domain()) {
+			t.Error("expect sniffed host ", host, " to match, but it is sniffed as ", header.Domain())
+		}
+	}
+}
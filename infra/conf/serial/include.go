@@ -0,0 +1,123 @@
+package serial
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"v2ray.com/core/infra/conf"
+)
+
+// ResolveIncludes merges the configs listed in the "include" directive of config, which is read
+// from file, and returns the result. Included configs are merged in order, so later ones override
+// earlier ones, and config itself overrides all of them, in the same way as multiple config files.
+//
+// Includes are paths or glob patterns of local files. Relative ones are resolved from the directory
+// of file, or the working directory if file is not a local path, such as "stdin:" or a URL.
+func ResolveIncludes(config *conf.Config, file string) (*conf.Config, error) {
+	var chain []string
+	if isLocalFile(file) {
+		path, err := filepath.Abs(file)
+		if err != nil {
+			return nil, newError("failed to resolve path of ", file).Base(err)
+		}
+		file = path
+		chain = append(chain, path)
+	}
+	return resolveIncludes(config, file, chain)
+}
+
+func isLocalFile(file string) bool {
+	return file != "" && file != "stdin:" && !strings.Contains(file, "://")
+}
+
+func resolveIncludes(config *conf.Config, file string, chain []string) (*conf.Config, error) {
+	if file != "" {
+		config.MarkSource(file)
+	}
+	if len(config.Include) == 0 {
+		return config, nil
+	}
+
+	dir := ""
+	if isLocalFile(file) {
+		dir = filepath.Dir(file)
+	}
+
+	var merged *conf.Config
+	for _, pattern := range config.Include {
+		paths, err := expandInclude(dir, pattern)
+		if err != nil {
+			return nil, newError("invalid include ", pattern, " in ", describeChain(chain, file)).Base(err)
+		}
+		for _, path := range paths {
+			included, err := loadIncludedFile(path, chain)
+			if err != nil {
+				return nil, err
+			}
+			if merged == nil {
+				merged = included
+				continue
+			}
+			merged.Override(included, path)
+		}
+	}
+
+	config.Include = nil
+	if merged == nil {
+		return config, nil
+	}
+	merged.Override(config, file)
+	return merged, nil
+}
+
+// expandInclude returns the absolute paths of the files matched by the include pattern. A pattern
+// without glob characters must name an existing file.
+func expandInclude(dir string, pattern string) ([]string, error) {
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(dir, pattern)
+	}
+	pattern, err := filepath.Abs(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.ContainsAny(pattern, "*?[") {
+		if _, err := os.Stat(pattern); err != nil {
+			return nil, err
+		}
+		return []string{pattern}, nil
+	}
+	return filepath.Glob(pattern)
+}
+
+func loadIncludedFile(path string, chain []string) (*conf.Config, error) {
+	for _, p := range chain {
+		if p == path {
+			return nil, newError("include cycle: ", strings.Join(append(chain, path), " -> "))
+		}
+	}
+	chain = append(chain[:len(chain):len(chain)], path)
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, newError("failed to open ", describeChain(chain, path)).Base(err)
+	}
+	defer f.Close()
+
+	config, err := DecodeJSONConfig(f)
+	if err != nil {
+		return nil, newError("failed to load ", describeChain(chain, path)).Base(err)
+	}
+	return resolveIncludes(config, path, chain)
+}
+
+// describeChain names the file, along with the files that include it.
+func describeChain(chain []string, file string) string {
+	if len(chain) <= 1 {
+		if file == "" {
+			return "config"
+		}
+		return file
+	}
+	return strings.Join(chain, " -> ")
+}
@@ -0,0 +1,117 @@
+package serial_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"v2ray.com/core/common"
+	"v2ray.com/core/infra/conf/serial"
+)
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "v2ray-include")
+	common.Must(err)
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		common.Must(os.MkdirAll(filepath.Dir(path), 0755))
+		common.Must(ioutil.WriteFile(path, []byte(content), 0644))
+	}
+	return dir
+}
+
+func loadFile(path string) error {
+	content, err := ioutil.ReadFile(path)
+	common.Must(err)
+	config, err := serial.DecodeJSONConfig(bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+	_, err = serial.ResolveIncludes(config, path)
+	return err
+}
+
+func TestResolveIncludes(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"config.json": `{
+			"include": ["base.json", "conf.d/*.json"],
+			"log": {"loglevel": "error"}
+		}`,
+		"base.json": `{
+			"log": {"loglevel": "debug"},
+			"dns": {"servers": ["1.1.1.1"]},
+			"policy": {"levels": {"0": {"handshake": 1}}}
+		}`,
+		"conf.d/10-dns.json": `{
+			"dns": {"servers": ["8.8.8.8"]}
+		}`,
+		"conf.d/20-outbounds.json": `{
+			"include": ["../stats.json"],
+			"outbounds": [{"protocol": "freedom", "tag": "direct"}]
+		}`,
+		"stats.json": `{
+			"stats": {}
+		}`,
+	})
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.json")
+	content, err := ioutil.ReadFile(path)
+	common.Must(err)
+	config, err := serial.DecodeJSONConfig(bytes.NewReader(content))
+	common.Must(err)
+	config, err = serial.ResolveIncludes(config, path)
+	common.Must(err)
+
+	if config.LogConfig == nil || config.LogConfig.LogLevel != "error" {
+		t.Error("including file doesn't override includes: ", config.LogConfig)
+	}
+	if config.DNSConfig == nil || len(config.DNSConfig.Servers) != 1 || config.DNSConfig.Servers[0].Address.String() != "8.8.8.8" {
+		t.Error("later include doesn't override earlier one: ", config.DNSConfig)
+	}
+	if config.Policy == nil || config.Stats == nil {
+		t.Error("included settings missing")
+	}
+	if len(config.OutboundConfigs) != 1 || config.OutboundConfigs[0].Tag != "direct" {
+		t.Error("outbounds: ", config.OutboundConfigs)
+	}
+	if len(config.Include) != 0 {
+		t.Error("includes left: ", config.Include)
+	}
+}
+
+func TestResolveIncludesCycle(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"a.json": `{"include": ["b.json"]}`,
+		"b.json": `{"include": ["a.json"]}`,
+	})
+	defer os.RemoveAll(dir)
+
+	err := loadFile(filepath.Join(dir, "a.json"))
+	if err == nil || !strings.Contains(err.Error(), "include cycle") {
+		t.Error("expected include cycle, but got ", err)
+	}
+}
+
+func TestResolveIncludesError(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"a.json": `{"include": ["b.json"]}`,
+		"b.json": `{"include": ["c.json"]}`,
+		"c.json": `{"log": {`,
+		"d.json": `{"include": ["missing.json"]}`,
+	})
+	defer os.RemoveAll(dir)
+
+	err := loadFile(filepath.Join(dir, "a.json"))
+	chain := strings.Join([]string{filepath.Join(dir, "a.json"), filepath.Join(dir, "b.json"), filepath.Join(dir, "c.json")}, " -> ")
+	if err == nil || !strings.Contains(err.Error(), chain) {
+		t.Error("expected error naming ", chain, ", but got ", err)
+	}
+
+	if err := loadFile(filepath.Join(dir, "d.json")); err == nil || !strings.Contains(err.Error(), "missing.json") {
+		t.Error("expected error of missing include, but got ", err)
+	}
+}
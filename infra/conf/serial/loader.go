@@ -73,6 +73,11 @@ func LoadJSONConfig(reader io.Reader) (*core.Config, error) {
 		return nil, err
 	}
 
+	jsonConfig, err = ResolveIncludes(jsonConfig, "")
+	if err != nil {
+		return nil, err
+	}
+
 	pbConfig, err := jsonConfig.Build()
 	if err != nil {
 		return nil, newError("failed to parse json config").Base(err)
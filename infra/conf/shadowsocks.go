@@ -31,13 +31,19 @@ type ShadowsocksServerConfig struct {
 	UDP         bool         `json:"udp"`
 	Level       byte         `json:"level"`
 	Email       string       `json:"email"`
+	Quota       uint64       `json:"quota"`
 	NetworkList *NetworkList `json:"network"`
+
+	ReplayFilterCapacity uint32 `json:"replayFilterCapacity"`
+	UDPOverTCP           bool   `json:"udpOverTcp"`
 }
 
 func (v *ShadowsocksServerConfig) Build() (proto.Message, error) {
 	config := new(shadowsocks.ServerConfig)
 	config.UdpEnabled = v.UDP
 	config.Network = v.NetworkList.Build()
+	config.ReplayFilterCapacity = v.ReplayFilterCapacity
+	config.UdpOverTcp = v.UDPOverTCP
 
 	if v.Password == "" {
 		return nil, newError("Shadowsocks password is not specified.")
@@ -53,6 +59,7 @@ func (v *ShadowsocksServerConfig) Build() (proto.Message, error) {
 	config.User = &protocol.User{
 		Email:   v.Email,
 		Level:   uint32(v.Level),
+		Quota:   v.Quota,
 		Account: serial.ToTypedMessage(account),
 	}
 
@@ -70,7 +77,8 @@ type ShadowsocksServerTarget struct {
 }
 
 type ShadowsocksClientConfig struct {
-	Servers []*ShadowsocksServerTarget `json:"servers"`
+	Servers    []*ShadowsocksServerTarget `json:"servers"`
+	UDPOverTCP bool                       `json:"udpOverTcp"`
 }
 
 func (v *ShadowsocksClientConfig) Build() (proto.Message, error) {
@@ -115,6 +123,7 @@ func (v *ShadowsocksClientConfig) Build() (proto.Message, error) {
 	}
 
 	config.Server = serverSpecs
+	config.UdpOverTcp = v.UDPOverTCP
 
 	return config, nil
 }
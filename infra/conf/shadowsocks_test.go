@@ -32,5 +32,79 @@ func TestShadowsocksServerConfigParsing(t *testing.T) {
 				Network: []net.Network{net.Network_TCP},
 			},
 		},
+		{
+			Input: `{
+				"method": "chacha20-poly1305",
+				"password": "v2ray-password",
+				"replayFilterCapacity": 10000
+			}`,
+			Parser: loadJSON(creator),
+			Output: &shadowsocks.ServerConfig{
+				User: &protocol.User{
+					Account: serial.ToTypedMessage(&shadowsocks.Account{
+						CipherType: shadowsocks.CipherType_CHACHA20_POLY1305,
+						Password:   "v2ray-password",
+					}),
+				},
+				Network:              []net.Network{net.Network_TCP},
+				ReplayFilterCapacity: 10000,
+			},
+		},
+		{
+			Input: `{
+				"method": "aes-128-gcm",
+				"password": "v2ray-password",
+				"udpOverTcp": true
+			}`,
+			Parser: loadJSON(creator),
+			Output: &shadowsocks.ServerConfig{
+				User: &protocol.User{
+					Account: serial.ToTypedMessage(&shadowsocks.Account{
+						CipherType: shadowsocks.CipherType_AES_128_GCM,
+						Password:   "v2ray-password",
+					}),
+				},
+				Network:    []net.Network{net.Network_TCP},
+				UdpOverTcp: true,
+			},
+		},
+	})
+}
+
+func TestShadowsocksClientConfigParsing(t *testing.T) {
+	creator := func() Buildable {
+		return new(ShadowsocksClientConfig)
+	}
+
+	runMultiTestCase(t, []TestCase{
+		{
+			Input: `{
+				"servers": [{
+					"address": "127.0.0.1",
+					"port": 8388,
+					"method": "aes-128-gcm",
+					"password": "v2ray-password"
+				}],
+				"udpOverTcp": true
+			}`,
+			Parser: loadJSON(creator),
+			Output: &shadowsocks.ClientConfig{
+				Server: []*protocol.ServerEndpoint{
+					{
+						Address: net.NewIPOrDomain(net.LocalHostIP),
+						Port:    8388,
+						User: []*protocol.User{
+							{
+								Account: serial.ToTypedMessage(&shadowsocks.Account{
+									CipherType: shadowsocks.CipherType_AES_128_GCM,
+									Password:   "v2ray-password",
+								}),
+							},
+						},
+					},
+				},
+				UdpOverTcp: true,
+			},
+		},
 	})
 }
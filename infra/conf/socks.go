@@ -33,6 +33,9 @@ type SocksServerConfig struct {
 	Host       *Address        `json:"ip"`
 	Timeout    uint32          `json:"timeout"`
 	UserLevel  uint32          `json:"userLevel"`
+
+	AcceptRoutingHint bool            `json:"acceptRoutingHint"`
+	Mismatch          *MismatchConfig `json:"mismatch"`
 }
 
 func (v *SocksServerConfig) Build() (proto.Message, error) {
@@ -61,6 +64,14 @@ func (v *SocksServerConfig) Build() (proto.Message, error) {
 
 	config.Timeout = v.Timeout
 	config.UserLevel = v.UserLevel
+	config.AcceptRoutingHint = v.AcceptRoutingHint
+	if v.Mismatch != nil {
+		mismatch, err := v.Mismatch.Build()
+		if err != nil {
+			return nil, err
+		}
+		config.Mismatch = mismatch
+	}
 	return config, nil
 }
 
@@ -7,6 +7,7 @@ import (
 	"v2ray.com/core/common/protocol"
 	"v2ray.com/core/common/serial"
 	. "v2ray.com/core/infra/conf"
+	"v2ray.com/core/proxy"
 	"v2ray.com/core/proxy/socks"
 )
 
@@ -46,6 +47,37 @@ func TestSocksInboundConfig(t *testing.T) {
 				UserLevel: 1,
 			},
 		},
+		{
+			Input: `{
+				"mismatch": {
+					"action": "fallback",
+					"dest": 80
+				}
+			}`,
+			Parser: loadJSON(creator),
+			Output: &socks.ServerConfig{
+				Mismatch: &proxy.Mismatch{
+					Action: proxy.Mismatch_FALLBACK,
+					Type:   "tcp",
+					Dest:   "127.0.0.1:80",
+				},
+			},
+		},
+		{
+			Input: `{
+				"mismatch": {
+					"action": "respond",
+					"response": "HTTP/1.1 400 Bad Request\r\n\r\n"
+				}
+			}`,
+			Parser: loadJSON(creator),
+			Output: &socks.ServerConfig{
+				Mismatch: &proxy.Mismatch{
+					Action:   proxy.Mismatch_RESPOND,
+					Response: []byte("HTTP/1.1 400 Bad Request\r\n\r\n"),
+				},
+			},
+		},
 	})
 }
 
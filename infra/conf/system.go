@@ -0,0 +1,58 @@
+package conf
+
+import (
+	"strings"
+
+	"v2ray.com/core"
+)
+
+// SystemConfig is the settings of memory and goroutines, which take precedence over environment variables.
+type SystemConfig struct {
+	// BufferSize is in KiB, and negative for unlimited buffer, as in policies.
+	BufferSize          *int32 `json:"bufferSize"`
+	Readv               string `json:"readv"`
+	GCPercent           *int32 `json:"gcPercent"`
+	UDPWorkerGoroutines uint32 `json:"udpWorkerGoroutines"`
+	// BufferPoolSize is the size of the largest pooled buffers in KiB: 2, 8, 32 or 128.
+	BufferPoolSize uint32 `json:"bufferPoolSize"`
+}
+
+// Build implements Buildable.
+func (c *SystemConfig) Build() (*core.SystemConfig, error) {
+	config := &core.SystemConfig{
+		UdpWorkerGoroutines: c.UDPWorkerGoroutines,
+	}
+	switch c.BufferPoolSize {
+	case 0:
+	case 2, 8, 32, 128:
+		config.BufferPoolSize = int32(c.BufferPoolSize) * 1024
+	default:
+		return nil, newError("buffer pool size must be 2, 8, 32 or 128 KiB, but got ", c.BufferPoolSize)
+	}
+	if c.BufferSize != nil {
+		size := int32(-1)
+		if *c.BufferSize >= 0 {
+			size = *c.BufferSize * 1024
+		}
+		config.Buffer = &core.SystemConfig_Buffer{
+			Connection: size,
+		}
+	}
+	switch strings.ToLower(c.Readv) {
+	case "":
+	case "auto":
+		config.Readv = core.SystemConfig_Auto
+	case "enable":
+		config.Readv = core.SystemConfig_Enable
+	case "disable":
+		config.Readv = core.SystemConfig_Disable
+	default:
+		return nil, newError("unknown readv mode: ", c.Readv)
+	}
+	if c.GCPercent != nil {
+		config.Gc = &core.SystemConfig_GC{
+			Percent: *c.GCPercent,
+		}
+	}
+	return config, nil
+}
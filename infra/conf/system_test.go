@@ -0,0 +1,56 @@
+package conf_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	"v2ray.com/core"
+	"v2ray.com/core/common"
+	. "v2ray.com/core/infra/conf"
+)
+
+func TestSystemConfig(t *testing.T) {
+	parse := func(s string) (*core.SystemConfig, error) {
+		c := new(SystemConfig)
+		common.Must(json.Unmarshal([]byte(s), c))
+		return c.Build()
+	}
+
+	config, err := parse(`{
+		"bufferSize": 64,
+		"readv": "disable",
+		"gcPercent": 50,
+		"udpWorkerGoroutines": 1000,
+		"bufferPoolSize": 8
+	}`)
+	common.Must(err)
+	expected := &core.SystemConfig{
+		Buffer: &core.SystemConfig_Buffer{
+			Connection: 64 * 1024,
+		},
+		Readv: core.SystemConfig_Disable,
+		Gc: &core.SystemConfig_GC{
+			Percent: 50,
+		},
+		UdpWorkerGoroutines: 1000,
+		BufferPoolSize:      8 * 1024,
+	}
+	if !proto.Equal(config, expected) {
+		t.Error("expected ", expected, ", but got ", config)
+	}
+
+	config, err = parse(`{"bufferSize": -1}`)
+	common.Must(err)
+	if config.Buffer.Connection != -1 || config.Readv != core.SystemConfig_AsIs || config.Gc != nil {
+		t.Error("unexpected config: ", config)
+	}
+
+	if _, err := parse(`{"readv": "sometimes"}`); err == nil {
+		t.Error("expected error for unknown readv mode")
+	}
+	if _, err := parse(`{"bufferPoolSize": 16}`); err == nil {
+		t.Error("expected error for invalid buffer pool size")
+	}
+}
@@ -13,6 +13,7 @@ type TransportConfig struct {
 	HTTPConfig *HTTPConfig         `json:"httpSettings"`
 	DSConfig   *DomainSocketConfig `json:"dsSettings"`
 	QUICConfig *QUICConfig         `json:"quicSettings"`
+	H3Config   *H3Config           `json:"h3Settings"`
 }
 
 // Build implements Buildable.
@@ -85,5 +86,16 @@ func (c *TransportConfig) Build() (*transport.Config, error) {
 		})
 	}
 
+	if c.H3Config != nil {
+		hs, err := c.H3Config.Build()
+		if err != nil {
+			return nil, newError("Failed to build HTTP/3 config.").Base(err)
+		}
+		config.TransportSettings = append(config.TransportSettings, &internet.TransportConfig{
+			ProtocolName: "h3",
+			Settings:     serial.ToTypedMessage(hs),
+		})
+	}
+
 	return config, nil
 }
@@ -1,10 +1,12 @@
 package conf
 
 import (
+	"encoding/json"
 	"sort"
 
 	"github.com/golang/protobuf/proto"
 
+	"v2ray.com/core/common/platform/filesystem"
 	"v2ray.com/core/transport/internet/headers/http"
 	"v2ray.com/core/transport/internet/headers/noop"
 	"v2ray.com/core/transport/internet/headers/srtp"
@@ -200,18 +202,52 @@ func (v *AuthenticatorResponse) Build() (*http.ResponseConfig, error) {
 	return config, nil
 }
 
+// Authenticator is the config of HTTP header obfuscation. Clients pick one of the templates of requests,
+// which are the request, the requests, and those in the requests file, for each connection. The
+// default request is a template only if no other one is given.
 type Authenticator struct {
-	Request  AuthenticatorRequest  `json:"request"`
-	Response AuthenticatorResponse `json:"response"`
+	Request      *AuthenticatorRequest   `json:"request"`
+	Requests     []*AuthenticatorRequest `json:"requests"`
+	RequestsFile string                  `json:"requestsFile"`
+	Response     AuthenticatorResponse   `json:"response"`
 }
 
 func (v *Authenticator) Build() (proto.Message, error) {
 	config := new(http.Config)
-	requestConfig, err := v.Request.Build()
-	if err != nil {
-		return nil, err
+
+	requests := v.Requests
+	if len(v.RequestsFile) > 0 {
+		data, err := filesystem.ReadFile(v.RequestsFile)
+		if err != nil {
+			return nil, newError("failed to read HTTP request templates from ", v.RequestsFile).Base(err).AtError()
+		}
+		var fileRequests []*AuthenticatorRequest
+		if err := json.Unmarshal(data, &fileRequests); err != nil {
+			return nil, newError("invalid HTTP request templates in ", v.RequestsFile).Base(err).AtError()
+		}
+		requests = append(append([]*AuthenticatorRequest(nil), requests...), fileRequests...)
+	}
+	if v.Request != nil || len(requests) == 0 {
+		request := v.Request
+		if request == nil {
+			request = new(AuthenticatorRequest)
+		}
+		requests = append([]*AuthenticatorRequest{request}, requests...)
+	}
+	for _, request := range requests {
+		if request == nil {
+			return nil, newError("empty HTTP request template").AtError()
+		}
+		requestConfig, err := request.Build()
+		if err != nil {
+			return nil, err
+		}
+		if config.Request == nil {
+			config.Request = requestConfig
+		} else {
+			config.AlternativeRequest = append(config.AlternativeRequest, requestConfig)
+		}
 	}
-	config.Request = requestConfig
 
 	responseConfig, err := v.Response.Build()
 	if err != nil {
@@ -1,6 +1,7 @@
 package conf
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"strings"
 
@@ -10,6 +11,7 @@ import (
 	"v2ray.com/core/common/serial"
 	"v2ray.com/core/transport/internet"
 	"v2ray.com/core/transport/internet/domainsocket"
+	"v2ray.com/core/transport/internet/h3"
 	"v2ray.com/core/transport/internet/http"
 	"v2ray.com/core/transport/internet/kcp"
 	"v2ray.com/core/transport/internet/quic"
@@ -35,15 +37,19 @@ var (
 )
 
 type KCPConfig struct {
-	Mtu             *uint32         `json:"mtu"`
-	Tti             *uint32         `json:"tti"`
-	UpCap           *uint32         `json:"uplinkCapacity"`
-	DownCap         *uint32         `json:"downlinkCapacity"`
-	Congestion      *bool           `json:"congestion"`
-	ReadBufferSize  *uint32         `json:"readBufferSize"`
-	WriteBufferSize *uint32         `json:"writeBufferSize"`
-	HeaderConfig    json.RawMessage `json:"header"`
-	Seed            *string         `json:"seed"`
+	Mtu               *uint32         `json:"mtu"`
+	Tti               *uint32         `json:"tti"`
+	UpCap             *uint32         `json:"uplinkCapacity"`
+	DownCap           *uint32         `json:"downlinkCapacity"`
+	Congestion        *bool           `json:"congestion"`
+	ReadBufferSize    *uint32         `json:"readBufferSize"`
+	WriteBufferSize   *uint32         `json:"writeBufferSize"`
+	HeaderConfig      json.RawMessage `json:"header"`
+	Seed              *string         `json:"seed"`
+	ProtocolVersion   uint32          `json:"protocolVersion"`
+	DataShards        *uint32         `json:"dataShards"`
+	ParityShards      *uint32         `json:"parityShards"`
+	KeepAliveInterval uint32          `json:"keepAliveInterval"`
 }
 
 // Build implements Buildable.
@@ -104,6 +110,40 @@ func (c *KCPConfig) Build() (proto.Message, error) {
 	if c.Seed != nil {
 		config.Seed = &kcp.EncryptionSeed{Seed: *c.Seed}
 	}
+	if c.ProtocolVersion > 0 {
+		// The version is part of the seed settings, which both sides share.
+		if config.Seed == nil {
+			return nil, newError("mKCP protocol version requires seed").AtError()
+		}
+		if c.ProtocolVersion > 2 {
+			return nil, newError("unsupported mKCP protocol version: ", c.ProtocolVersion).AtError()
+		}
+		config.Seed.ProtocolVersion = c.ProtocolVersion
+	}
+
+	if c.DataShards != nil || c.ParityShards != nil {
+		var data, parity uint32
+		if c.DataShards != nil {
+			data = *c.DataShards
+		}
+		if c.ParityShards != nil {
+			parity = *c.ParityShards
+		}
+		if (data == 0) != (parity == 0) || data > 256 || parity > 256 || data+parity > 256 {
+			return nil, newError("invalid mKCP FEC shards: ", data, "+", parity).AtError()
+		}
+		if data > 0 {
+			config.Fec = &kcp.FEC{DataShards: data, ParityShards: parity}
+		}
+	}
+
+	if c.KeepAliveInterval > 0 {
+		// Connections are closed after 30 seconds without incoming packets.
+		if c.KeepAliveInterval >= 30 {
+			return nil, newError("invalid mKCP keep-alive interval: ", c.KeepAliveInterval).AtError()
+		}
+		config.KeepAlive = &kcp.KeepAlive{Interval: c.KeepAliveInterval}
+	}
 
 	return config, nil
 }
@@ -133,11 +173,35 @@ func (c *TCPConfig) Build() (proto.Message, error) {
 	return config, nil
 }
 
+type WebSocketFallbackConfig struct {
+	Dest       string            `json:"dest"`
+	StatusCode uint32            `json:"statusCode"`
+	Headers    map[string]string `json:"headers"`
+	Body       string            `json:"body"`
+}
+
+// Build implements Buildable.
+func (c *WebSocketFallbackConfig) Build() (*websocket.Fallback, error) {
+	if c.Dest != "" && (c.StatusCode != 0 || len(c.Headers) > 0 || c.Body != "") {
+		return nil, newError("WebSocket fallback can't have both dest and a static response")
+	}
+	if c.StatusCode != 0 && (c.StatusCode < 100 || c.StatusCode > 999) {
+		return nil, newError("invalid status code of WebSocket fallback: ", c.StatusCode)
+	}
+	return &websocket.Fallback{
+		Dest:       c.Dest,
+		StatusCode: c.StatusCode,
+		Header:     c.Headers,
+		Body:       c.Body,
+	}, nil
+}
+
 type WebSocketConfig struct {
-	Path                string            `json:"path"`
-	Path2               string            `json:"Path"` // The key was misspelled. For backward compatibility, we have to keep track the old key.
-	Headers             map[string]string `json:"headers"`
-	AcceptProxyProtocol bool              `json:"acceptProxyProtocol"`
+	Path                string                   `json:"path"`
+	Path2               string                   `json:"Path"` // The key was misspelled. For backward compatibility, we have to keep track the old key.
+	Headers             map[string]string        `json:"headers"`
+	AcceptProxyProtocol bool                     `json:"acceptProxyProtocol"`
+	Fallback            *WebSocketFallbackConfig `json:"fallback"`
 }
 
 // Build implements Buildable.
@@ -160,6 +224,13 @@ func (c *WebSocketConfig) Build() (proto.Message, error) {
 	if c.AcceptProxyProtocol {
 		config.AcceptProxyProtocol = c.AcceptProxyProtocol
 	}
+	if c.Fallback != nil {
+		fallback, err := c.Fallback.Build()
+		if err != nil {
+			return nil, err
+		}
+		config.Fallback = fallback
+	}
 	return config, nil
 }
 
@@ -179,16 +250,44 @@ func (c *HTTPConfig) Build() (proto.Message, error) {
 	return config, nil
 }
 
+type H3Config struct {
+	Host       *StringList `json:"host"`
+	Path       string      `json:"path"`
+	ZeroRTT    bool        `json:"zeroRTT"`
+	H2Fallback bool        `json:"h2Fallback"`
+}
+
+// Build implements Buildable.
+func (c *H3Config) Build() (proto.Message, error) {
+	config := &h3.Config{
+		Path:       c.Path,
+		ZeroRtt:    c.ZeroRTT,
+		H2Fallback: c.H2Fallback,
+	}
+	if c.Host != nil {
+		config.Host = []string(*c.Host)
+	}
+	return config, nil
+}
+
 type QUICConfig struct {
-	Header   json.RawMessage `json:"header"`
-	Security string          `json:"security"`
-	Key      string          `json:"key"`
+	Header    json.RawMessage `json:"header"`
+	Security  string          `json:"security"`
+	Key       string          `json:"key"`
+	KeepAlive bool            `json:"keepAlive"`
+	// KeepAliveInterval is in seconds, and implies KeepAlive.
+	KeepAliveInterval uint32 `json:"keepAliveInterval"`
 }
 
 // Build implements Buildable.
 func (c *QUICConfig) Build() (proto.Message, error) {
+	if c.KeepAliveInterval > 10 {
+		return nil, newError("invalid QUIC keep-alive interval: ", c.KeepAliveInterval).AtError()
+	}
 	config := &quic.Config{
-		Key: c.Key,
+		Key:               c.Key,
+		KeepAlive:         c.KeepAlive,
+		KeepAliveInterval: c.KeepAliveInterval,
 	}
 
 	if len(c.Header) > 0 {
@@ -292,6 +391,10 @@ type TLSConfig struct {
 	ALPN                    *StringList      `json:"alpn"`
 	EnableSessionResumption bool             `json:"enableSessionResumption"`
 	DisableSystemRoot       bool             `json:"disableSystemRoot"`
+	TicketKeyRotation       uint32           `json:"sessionTicketKeyRotation"`
+	TicketKey               string           `json:"sessionTicketKey"`
+	ExpiryWarningDays       uint32           `json:"expiryWarningDays"`
+	FailedChainDir          string           `json:"failedChainDir"`
 }
 
 // Build implements Buildable.
@@ -315,6 +418,19 @@ func (c *TLSConfig) Build() (proto.Message, error) {
 	}
 	config.EnableSessionResumption = c.EnableSessionResumption
 	config.DisableSystemRoot = c.DisableSystemRoot
+	config.SessionTicketKeyRotation = c.TicketKeyRotation
+	if len(c.TicketKey) > 0 {
+		key, err := base64.StdEncoding.DecodeString(c.TicketKey)
+		if err != nil {
+			return nil, newError("invalid session ticket key").Base(err)
+		}
+		if len(key) < 32 {
+			return nil, newError("session ticket key must be at least 32 bytes, but is ", len(key))
+		}
+		config.SessionTicketKey = key
+	}
+	config.ExpiryWarningDays = c.ExpiryWarningDays
+	config.FailedChainDir = c.FailedChainDir
 	return config, nil
 }
 
@@ -335,16 +451,27 @@ func (p TransportProtocol) Build() (string, error) {
 		return "domainsocket", nil
 	case "quic":
 		return "quic", nil
+	case "h3":
+		return "h3", nil
 	default:
 		return "", newError("Config: unknown transport protocol: ", p)
 	}
 }
 
 type SocketConfig struct {
-	Mark                int32  `json:"mark"`
-	TFO                 *bool  `json:"tcpFastOpen"`
-	TProxy              string `json:"tproxy"`
-	AcceptProxyProtocol bool   `json:"acceptProxyProtocol"`
+	Mark                   int32           `json:"mark"`
+	TFO                    *bool           `json:"tcpFastOpen"`
+	TProxy                 string          `json:"tproxy"`
+	AcceptProxyProtocol    bool            `json:"acceptProxyProtocol"`
+	HappyEyeballs          *bool           `json:"happyEyeballs"`
+	SendProxyProtocol      uint32          `json:"sendProxyProtocol"`
+	ProxyProtocolInsideTLS bool            `json:"proxyProtocolInsideTLS"`
+	ReuseAddress           bool            `json:"reuseAddress"`
+	ReusePort              *bool           `json:"reusePort"`
+	TCPCongestion          string          `json:"tcpCongestion"`
+	UDPDemux               *UDPDemuxConfig `json:"udpDemux"`
+	TTL                    uint32          `json:"ttl"`
+	AllowFragmentation     bool            `json:"allowFragmentation"`
 }
 
 // Build implements Buildable.
@@ -366,15 +493,60 @@ func (c *SocketConfig) Build() (*internet.SocketConfig, error) {
 	default:
 		tproxy = internet.SocketConfig_Off
 	}
+	if c.SendProxyProtocol > 2 {
+		return nil, newError("unknown PROXY protocol version: ", c.SendProxyProtocol)
+	}
+	if c.TTL > 255 {
+		return nil, newError("invalid TTL: ", c.TTL)
+	}
+	var udpDemux *internet.UDPDemuxConfig
+	if c.UDPDemux != nil {
+		var err error
+		if udpDemux, err = c.UDPDemux.Build(); err != nil {
+			return nil, err
+		}
+	}
 
 	return &internet.SocketConfig{
-		Mark:                c.Mark,
-		Tfo:                 tfoSettings,
-		Tproxy:              tproxy,
-		AcceptProxyProtocol: c.AcceptProxyProtocol,
+		Mark:                   c.Mark,
+		Tfo:                    tfoSettings,
+		Tproxy:                 tproxy,
+		AcceptProxyProtocol:    c.AcceptProxyProtocol,
+		DisableHappyEyeballs:   c.HappyEyeballs != nil && !*c.HappyEyeballs,
+		SendProxyProtocol:      c.SendProxyProtocol,
+		ProxyProtocolInsideTls: c.ProxyProtocolInsideTLS,
+		ReuseAddress:           c.ReuseAddress,
+		DisableReusePort:       c.ReusePort != nil && !*c.ReusePort,
+		TcpCongestion:          c.TCPCongestion,
+		UdpDemux:               udpDemux,
+		Ttl:                    c.TTL,
+		AllowFragmentation:     c.AllowFragmentation,
 	}, nil
 }
 
+// UDPDemuxConfig is the sharing of a UDP port with other inbounds, which take flows of packets by their types.
+type UDPDemuxConfig struct {
+	PacketTypes []string `json:"packetTypes"`
+}
+
+// Build implements Buildable.
+func (c *UDPDemuxConfig) Build() (*internet.UDPDemuxConfig, error) {
+	config := new(internet.UDPDemuxConfig)
+	for _, t := range c.PacketTypes {
+		switch strings.ToLower(t) {
+		case "quic":
+			config.PacketType = append(config.PacketType, internet.UDPDemuxConfig_QUIC)
+		case "wireguard":
+			config.PacketType = append(config.PacketType, internet.UDPDemuxConfig_WireGuard)
+		case "other":
+			config.PacketType = append(config.PacketType, internet.UDPDemuxConfig_Other)
+		default:
+			return nil, newError("unknown UDP packet type: ", t)
+		}
+	}
+	return config, nil
+}
+
 type StreamConfig struct {
 	Network        *TransportProtocol  `json:"network"`
 	Security       string              `json:"security"`
@@ -385,13 +557,20 @@ type StreamConfig struct {
 	HTTPSettings   *HTTPConfig         `json:"httpSettings"`
 	DSSettings     *DomainSocketConfig `json:"dsSettings"`
 	QUICSettings   *QUICConfig         `json:"quicSettings"`
+	H3Settings     *H3Config           `json:"h3Settings"`
 	SocketSettings *SocketConfig       `json:"sockopt"`
+	// HandshakeTimeout is in seconds, and applies to outbounds.
+	HandshakeTimeout uint32 `json:"handshakeTimeout"`
+	// UDPMaxPacketSize is the size limit in bytes of UDP packets, and applies to outbounds.
+	UDPMaxPacketSize uint32 `json:"udpMaxPacketSize"`
 }
 
 // Build implements Buildable.
 func (c *StreamConfig) Build() (*internet.StreamConfig, error) {
 	config := &internet.StreamConfig{
-		ProtocolName: "tcp",
+		ProtocolName:     "tcp",
+		HandshakeTimeout: c.HandshakeTimeout,
+		UdpMaxPacketSize: c.UDPMaxPacketSize,
 	}
 	if c.Network != nil {
 		protocol, err := c.Network.Build()
@@ -473,6 +652,16 @@ func (c *StreamConfig) Build() (*internet.StreamConfig, error) {
 			Settings:     serial.ToTypedMessage(qs),
 		})
 	}
+	if c.H3Settings != nil {
+		hs, err := c.H3Settings.Build()
+		if err != nil {
+			return nil, newError("Failed to build HTTP/3 config").Base(err)
+		}
+		config.TransportSettings = append(config.TransportSettings, &internet.TransportConfig{
+			ProtocolName: "h3",
+			Settings:     serial.ToTypedMessage(hs),
+		})
+	}
 	if c.SocketSettings != nil {
 		ss, err := c.SocketSettings.Build()
 		if err != nil {
@@ -484,7 +673,8 @@ func (c *StreamConfig) Build() (*internet.StreamConfig, error) {
 }
 
 type ProxyConfig struct {
-	Tag string `json:"tag"`
+	Tag            string `json:"tag"`
+	TransportLayer bool   `json:"transportLayer"`
 }
 
 // Build implements Buildable.
@@ -493,6 +683,7 @@ func (v *ProxyConfig) Build() (*internet.ProxyConfig, error) {
 		return nil, newError("Proxy tag is not set.")
 	}
 	return &internet.ProxyConfig{
-		Tag: v.Tag,
+		Tag:            v.Tag,
+		TransportLayer: v.TransportLayer,
 	}, nil
 }
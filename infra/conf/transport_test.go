@@ -2,20 +2,25 @@ package conf_test
 
 import (
 	"encoding/json"
+	"io/ioutil"
+	"os"
 	"testing"
 
 	"github.com/golang/protobuf/proto"
+	"v2ray.com/core/common"
 	"v2ray.com/core/common/protocol"
 	"v2ray.com/core/common/serial"
 	. "v2ray.com/core/infra/conf"
 	"v2ray.com/core/transport"
 	"v2ray.com/core/transport/internet"
+	"v2ray.com/core/transport/internet/h3"
 	"v2ray.com/core/transport/internet/headers/http"
 	"v2ray.com/core/transport/internet/headers/noop"
 	"v2ray.com/core/transport/internet/headers/tls"
 	"v2ray.com/core/transport/internet/kcp"
 	"v2ray.com/core/transport/internet/quic"
 	"v2ray.com/core/transport/internet/tcp"
+	v2tls "v2ray.com/core/transport/internet/tls"
 	"v2ray.com/core/transport/internet/websocket"
 )
 
@@ -42,6 +47,119 @@ func TestSocketConfig(t *testing.T) {
 				Tfo:  internet.SocketConfig_Enable,
 			},
 		},
+		{
+			Input: `{
+				"happyEyeballs": true
+			}`,
+			Parser: createParser(),
+			Output: &internet.SocketConfig{},
+		},
+		{
+			Input: `{
+				"happyEyeballs": false
+			}`,
+			Parser: createParser(),
+			Output: &internet.SocketConfig{
+				DisableHappyEyeballs: true,
+			},
+		},
+		{
+			Input: `{
+				"acceptProxyProtocol": true,
+				"sendProxyProtocol": 2,
+				"proxyProtocolInsideTLS": true
+			}`,
+			Parser: createParser(),
+			Output: &internet.SocketConfig{
+				AcceptProxyProtocol:    true,
+				SendProxyProtocol:      2,
+				ProxyProtocolInsideTls: true,
+			},
+		},
+		{
+			Input: `{
+				"reuseAddress": true,
+				"reusePort": false
+			}`,
+			Parser: createParser(),
+			Output: &internet.SocketConfig{
+				ReuseAddress:     true,
+				DisableReusePort: true,
+			},
+		},
+		{
+			Input: `{
+				"tcpCongestion": "bbr"
+			}`,
+			Parser: createParser(),
+			Output: &internet.SocketConfig{
+				TcpCongestion: "bbr",
+			},
+		},
+		{
+			Input: `{
+				"udpDemux": {"packetTypes": ["WireGuard", "other"]}
+			}`,
+			Parser: createParser(),
+			Output: &internet.SocketConfig{
+				UdpDemux: &internet.UDPDemuxConfig{
+					PacketType: []internet.UDPDemuxConfig_PacketType{internet.UDPDemuxConfig_WireGuard, internet.UDPDemuxConfig_Other},
+				},
+			},
+		},
+		{
+			Input: `{
+				"ttl": 64,
+				"allowFragmentation": true
+			}`,
+			Parser: createParser(),
+			Output: &internet.SocketConfig{
+				Ttl:                64,
+				AllowFragmentation: true,
+			},
+		},
+	})
+
+	if _, err := createParser()(`{"udpDemux": {"packetTypes": ["dns"]}}`); err == nil {
+		t.Error("expected error for unknown UDP packet type")
+	}
+	if _, err := createParser()(`{"ttl": 256}`); err == nil {
+		t.Error("expected error for invalid TTL")
+	}
+}
+
+func TestProxyConfig(t *testing.T) {
+	createParser := func() func(string) (proto.Message, error) {
+		return func(s string) (proto.Message, error) {
+			config := new(ProxyConfig)
+			if err := json.Unmarshal([]byte(s), config); err != nil {
+				return nil, err
+			}
+			return config.Build()
+		}
+	}
+
+	runMultiTestCase(t, []TestCase{
+		{
+			Input: `{
+				"tag": "proxy"
+			}`,
+			Parser: createParser(),
+			Output: &internet.ProxyConfig{
+				Tag: "proxy",
+			},
+		},
+		{
+			Input: `{
+				"tag": "proxy",
+				"transportLayer": true
+			}`,
+			Parser: createParser(),
+			Output: &internet.ProxyConfig{
+				Tag:            "proxy",
+				TransportLayer: true,
+			},
+		},
 	})
 }
 
@@ -80,18 +198,34 @@ func TestTransportConfig(t *testing.T) {
 				},
 				"kcpSettings": {
 					"mtu": 1200,
+					"seed": "abcd",
+					"protocolVersion": 2,
+					"dataShards": 10,
+					"parityShards": 3,
+					"keepAliveInterval": 10,
 					"header": {
 						"type": "none"
 					}
 				},
 				"wsSettings": {
-					"path": "/t"
+					"path": "/t",
+					"fallback": {
+						"dest": "127.0.0.1:8080"
+					}
 				},
 				"quicSettings": {
 					"key": "abcd",
+					"keepAlive": true,
+					"keepAliveInterval": 5,
 					"header": {
 						"type": "dtls"
 					}
+				},
+				"h3Settings": {
+					"host": ["www.v2fly.org"],
+					"path": "/h3",
+					"zeroRTT": true,
+					"h2Fallback": true
 				}
 			}`,
 			Parser: createParser(),
@@ -143,13 +277,19 @@ func TestTransportConfig(t *testing.T) {
 						ProtocolName: "mkcp",
 						Settings: serial.ToTypedMessage(&kcp.Config{
 							Mtu:          &kcp.MTU{Value: 1200},
+							Seed:         &kcp.EncryptionSeed{Seed: "abcd", ProtocolVersion: 2},
 							HeaderConfig: serial.ToTypedMessage(&noop.Config{}),
+							Fec:          &kcp.FEC{DataShards: 10, ParityShards: 3},
+							KeepAlive:    &kcp.KeepAlive{Interval: 10},
 						}),
 					},
 					{
 						ProtocolName: "websocket",
 						Settings: serial.ToTypedMessage(&websocket.Config{
 							Path: "/t",
+							Fallback: &websocket.Fallback{
+								Dest: "127.0.0.1:8080",
+							},
 						}),
 					},
 					{
@@ -159,7 +299,18 @@ func TestTransportConfig(t *testing.T) {
 							Security: &protocol.SecurityConfig{
 								Type: protocol.SecurityType_NONE,
 							},
-							Header: serial.ToTypedMessage(&tls.PacketConfig{}),
+							Header:            serial.ToTypedMessage(&tls.PacketConfig{}),
+							KeepAlive:         true,
+							KeepAliveInterval: 5,
+						}),
+					},
+					{
+						ProtocolName: "h3",
+						Settings: serial.ToTypedMessage(&h3.Config{
+							Host:       []string{"www.v2fly.org"},
+							Path:       "/h3",
+							ZeroRtt:    true,
+							H2Fallback: true,
 						}),
 					},
 				},
@@ -167,3 +318,153 @@ func TestTransportConfig(t *testing.T) {
 		},
 	})
 }
+
+func TestTLSConfigSessionTickets(t *testing.T) {
+	createParser := func() func(string) (proto.Message, error) {
+		return func(s string) (proto.Message, error) {
+			config := new(TLSConfig)
+			if err := json.Unmarshal([]byte(s), config); err != nil {
+				return nil, err
+			}
+			return config.Build()
+		}
+	}
+
+	runMultiTestCase(t, []TestCase{
+		{
+			Input: `{
+				"enableSessionResumption": true,
+				"sessionTicketKeyRotation": 3600,
+				"sessionTicketKey": "AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8="
+			}`,
+			Parser: createParser(),
+			Output: &v2tls.Config{
+				Certificate:              []*v2tls.Certificate{},
+				EnableSessionResumption:  true,
+				SessionTicketKeyRotation: 3600,
+				SessionTicketKey: []byte{
+					0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15,
+					16, 17, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31,
+				},
+			},
+		},
+	})
+
+	runMultiTestCase(t, []TestCase{
+		{
+			Input: `{
+				"expiryWarningDays": 14,
+				"failedChainDir": "/var/log/v2ray/chains"
+			}`,
+			Parser: createParser(),
+			Output: &v2tls.Config{
+				Certificate:       []*v2tls.Certificate{},
+				ExpiryWarningDays: 14,
+				FailedChainDir:    "/var/log/v2ray/chains",
+			},
+		},
+	})
+
+	config := &TLSConfig{TicketKey: "AAECAw=="}
+	if _, err := config.Build(); err == nil {
+		t.Error("expect error for short session ticket key")
+	}
+}
+
+func TestKCPConfigInvalid(t *testing.T) {
+	for _, input := range []string{
+		`{"dataShards": 10}`,
+		`{"dataShards": 0, "parityShards": 3}`,
+		`{"dataShards": 200, "parityShards": 100}`,
+		`{"keepAliveInterval": 30}`,
+		`{"protocolVersion": 2}`,
+		`{"seed": "abcd", "protocolVersion": 3}`,
+	} {
+		config := new(KCPConfig)
+		common.Must(json.Unmarshal([]byte(input), config))
+		if _, err := config.Build(); err == nil {
+			t.Error("expect error for ", input)
+		}
+	}
+}
+
+func TestQUICConfigInvalid(t *testing.T) {
+	config := new(QUICConfig)
+	common.Must(json.Unmarshal([]byte(`{"keepAliveInterval": 11}`), config))
+	if _, err := config.Build(); err == nil {
+		t.Error("expect error for keep-alive interval longer than 10 seconds")
+	}
+}
+
+func TestHTTPAuthenticatorRequestTemplates(t *testing.T) {
+	file, err := ioutil.TempFile("", "v2ray-requests-*.json")
+	common.Must(err)
+	defer os.Remove(file.Name())
+	common.Must2(file.WriteString(`[{"path": ["/c"], "headers": {"User-Agent": "C"}}]`))
+	common.Must(file.Close())
+
+	createParser := func() func(string) (proto.Message, error) {
+		return loadJSON(func() Buildable {
+			return new(Authenticator)
+		})
+	}
+	response := &http.ResponseConfig{
+		Header: []*http.Header{
+			{Name: "Content-Type", Value: []string{"application/octet-stream", "video/mpeg"}},
+			{Name: "Transfer-Encoding", Value: []string{"chunked"}},
+			{Name: "Connection", Value: []string{"keep-alive"}},
+			{Name: "Pragma", Value: []string{"no-cache"}},
+			{Name: "Cache-Control", Value: []string{"private", "no-cache"}},
+		},
+	}
+
+	runMultiTestCase(t, []TestCase{
+		{
+			Input: `{
+				"requests": [
+					{"path": ["/a"], "headers": {"User-Agent": "A"}},
+					{"path": ["/b"], "headers": {"User-Agent": "B"}}
+				],
+				"requestsFile": "` + file.Name() + `"
+			}`,
+			Parser: createParser(),
+			Output: &http.Config{
+				Request: &http.RequestConfig{
+					Uri:    []string{"/a"},
+					Header: []*http.Header{{Name: "User-Agent", Value: []string{"A"}}},
+				},
+				AlternativeRequest: []*http.RequestConfig{
+					{
+						Uri:    []string{"/b"},
+						Header: []*http.Header{{Name: "User-Agent", Value: []string{"B"}}},
+					},
+					{
+						Uri:    []string{"/c"},
+						Header: []*http.Header{{Name: "User-Agent", Value: []string{"C"}}},
+					},
+				},
+				Response: response,
+			},
+		},
+		{
+			Input: `{
+				"request": {"path": ["/a"], "headers": {"User-Agent": "A"}},
+				"requests": [{"path": ["/b"], "headers": {"User-Agent": "B"}}]
+			}`,
+			Parser: createParser(),
+			Output: &http.Config{
+				Request: &http.RequestConfig{
+					Uri:    []string{"/a"},
+					Header: []*http.Header{{Name: "User-Agent", Value: []string{"A"}}},
+				},
+				AlternativeRequest: []*http.RequestConfig{
+					{
+						Uri:    []string{"/b"},
+						Header: []*http.Header{{Name: "User-Agent", Value: []string{"B"}}},
+					},
+				},
+				Response: response,
+			},
+		},
+	})
+}
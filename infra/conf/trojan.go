@@ -84,6 +84,7 @@ type TrojanUserConfig struct {
 	Password string `json:"password"`
 	Level    byte   `json:"level"`
 	Email    string `json:"email"`
+	Quota    uint64 `json:"quota"`
 }
 
 // TrojanServerConfig is Inbound configuration
@@ -105,6 +106,7 @@ func (c *TrojanServerConfig) Build() (proto.Message, error) {
 
 		user.Email = rawUser.Email
 		user.Level = uint32(rawUser.Level)
+		user.Quota = rawUser.Quota
 		user.Account = serial.ToTypedMessage(account)
 		config.Users[idx] = user
 	}
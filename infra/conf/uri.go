@@ -0,0 +1,358 @@
+package conf
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// OutboundFromURI converts a share link of a server, in the formats of "vmess://" links, with base64
+// encoded JSON of the fields of the server, or of "ss://" URIs of SIP002 and the legacy format, to the
+// JSON config of an outbound to the server. Unknown fields are ignored with warnings.
+func OutboundFromURI(uri string) ([]byte, error) {
+	uri = strings.TrimSpace(uri)
+	i := strings.Index(uri, "://")
+	if i < 0 {
+		return nil, newError("invalid URI: ", uri)
+	}
+	switch scheme := strings.ToLower(uri[:i]); scheme {
+	case "vmess":
+		return outboundFromVMessLink(uri[i+3:])
+	case "ss":
+		return outboundFromShadowsocksURI(uri[i+3:])
+	default:
+		return nil, newError("unsupported URI scheme: ", scheme)
+	}
+}
+
+// URIsFromSubscription returns the URIs in the content of a subscription, which is a list of URIs, one per
+// line, or the base64 encoding of such a list.
+func URIsFromSubscription(content []byte) []string {
+	content = bytes.TrimSpace(content)
+	if !bytes.Contains(content, []byte("://")) {
+		if decoded, err := decodeBase64(string(content)); err == nil {
+			content = decoded
+		}
+	}
+	var uris []string
+	for _, line := range strings.Split(string(content), "\n") {
+		if line = strings.TrimSpace(line); len(line) > 0 {
+			uris = append(uris, line)
+		}
+	}
+	return uris
+}
+
+// decodeBase64 decodes s in standard or URL-safe base64, padded or not, as share links use all of them.
+func decodeBase64(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	var err error
+	for _, encoding := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		var decoded []byte
+		if decoded, err = encoding.DecodeString(s); err == nil {
+			return decoded, nil
+		}
+	}
+	return nil, err
+}
+
+// vmessLinkFields are the fields of vmess links known to the converter.
+var vmessLinkFields = map[string]bool{
+	"v": true, "ps": true, "add": true, "port": true, "id": true, "aid": true, "scy": true,
+	"net": true, "type": true, "host": true, "path": true, "tls": true, "sni": true, "alpn": true,
+}
+
+func outboundFromVMessLink(encoded string) ([]byte, error) {
+	data, err := decodeBase64(encoded)
+	if err != nil {
+		return nil, newError("invalid base64 in vmess link").Base(err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var values map[string]interface{}
+	if err := decoder.Decode(&values); err != nil {
+		return nil, newError("invalid JSON in vmess link").Base(err)
+	}
+
+	var unknown []string
+	fields := make(map[string]string, len(values))
+	for key, value := range values {
+		if !vmessLinkFields[key] {
+			unknown = append(unknown, key)
+			continue
+		}
+		switch value := value.(type) {
+		case string:
+			fields[key] = strings.TrimSpace(value)
+		case json.Number:
+			fields[key] = value.String()
+		case nil:
+		default:
+			return nil, newError("invalid value of field ", key, " in vmess link: ", value)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		newError("ignoring unknown fields of vmess link: ", strings.Join(unknown, ", ")).AtWarning().WriteToLog()
+	}
+
+	if len(fields["add"]) == 0 {
+		return nil, newError("server address is not specified in vmess link")
+	}
+	if len(fields["id"]) == 0 {
+		return nil, newError("user ID is not specified in vmess link")
+	}
+	port, err := strconv.ParseUint(fields["port"], 10, 16)
+	if err != nil || port == 0 {
+		return nil, newError("invalid port in vmess link: ", fields["port"])
+	}
+	user := map[string]interface{}{
+		"id": fields["id"],
+	}
+	if aid := fields["aid"]; len(aid) > 0 {
+		alterID, err := strconv.ParseUint(aid, 10, 16)
+		if err != nil {
+			return nil, newError("invalid alterId in vmess link: ", aid)
+		}
+		user["alterId"] = alterID
+	}
+	if scy := fields["scy"]; len(scy) > 0 {
+		user["security"] = scy
+	}
+
+	stream, err := streamFromVMessLink(fields)
+	if err != nil {
+		return nil, err
+	}
+	outbound := map[string]interface{}{
+		"protocol": "vmess",
+		"settings": map[string]interface{}{
+			"vnext": []interface{}{
+				map[string]interface{}{
+					"address": fields["add"],
+					"port":    port,
+					"users":   []interface{}{user},
+				},
+			},
+		},
+	}
+	if len(stream) > 0 {
+		outbound["streamSettings"] = stream
+	}
+	if ps := fields["ps"]; len(ps) > 0 {
+		outbound["tag"] = ps
+	}
+	return json.Marshal(outbound)
+}
+
+// splitList splits a comma separated list in the fields of vmess links.
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); len(item) > 0 {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// streamFromVMessLink returns the stream settings of the transport and TLS in the fields of a vmess link.
+func streamFromVMessLink(fields map[string]string) (map[string]interface{}, error) {
+	stream := make(map[string]interface{})
+	host, path, headerType := fields["host"], fields["path"], fields["type"]
+	if headerType == "none" {
+		headerType = ""
+	}
+	switch network := strings.ToLower(fields["net"]); network {
+	case "", "tcp":
+		switch headerType {
+		case "":
+		case "http":
+			request := map[string]interface{}{}
+			if paths := splitList(path); len(paths) > 0 {
+				request["path"] = paths
+			}
+			if hosts := splitList(host); len(hosts) > 0 {
+				request["headers"] = map[string]interface{}{"Host": hosts}
+			}
+			stream["network"] = "tcp"
+			stream["tcpSettings"] = map[string]interface{}{
+				"header": map[string]interface{}{"type": "http", "request": request},
+			}
+		default:
+			return nil, newError("unsupported header type of TCP in vmess link: ", headerType)
+		}
+	case "ws", "websocket":
+		settings := map[string]interface{}{}
+		if len(path) > 0 {
+			settings["path"] = path
+		}
+		if len(host) > 0 {
+			settings["headers"] = map[string]interface{}{"Host": host}
+		}
+		stream["network"] = "ws"
+		stream["wsSettings"] = settings
+	case "h2", "http":
+		settings := map[string]interface{}{}
+		if len(path) > 0 {
+			settings["path"] = path
+		}
+		if hosts := splitList(host); len(hosts) > 0 {
+			settings["host"] = hosts
+		}
+		stream["network"] = "http"
+		stream["httpSettings"] = settings
+	case "kcp", "mkcp":
+		settings := map[string]interface{}{}
+		if len(headerType) > 0 {
+			settings["header"] = map[string]interface{}{"type": headerType}
+		}
+		if len(path) > 0 {
+			settings["seed"] = path
+		}
+		stream["network"] = "kcp"
+		stream["kcpSettings"] = settings
+	case "quic":
+		// The host field is the encryption method of QUIC, and the path field is its key.
+		settings := map[string]interface{}{}
+		if len(headerType) > 0 {
+			settings["header"] = map[string]interface{}{"type": headerType}
+		}
+		if len(host) > 0 {
+			settings["security"] = host
+		}
+		if len(path) > 0 {
+			settings["key"] = path
+		}
+		stream["network"] = "quic"
+		stream["quicSettings"] = settings
+	default:
+		return nil, newError("unsupported network in vmess link: ", network)
+	}
+
+	switch security := strings.ToLower(fields["tls"]); security {
+	case "", "none":
+	case "tls":
+		settings := map[string]interface{}{}
+		if sni := fields["sni"]; len(sni) > 0 {
+			settings["serverName"] = sni
+		} else if hosts := splitList(host); len(hosts) == 1 && fields["net"] != "quic" {
+			settings["serverName"] = hosts[0]
+		}
+		if alpn := splitList(fields["alpn"]); len(alpn) > 0 {
+			settings["alpn"] = alpn
+		}
+		stream["security"] = "tls"
+		stream["tlsSettings"] = settings
+	default:
+		return nil, newError("unsupported security in vmess link: ", security)
+	}
+	return stream, nil
+}
+
+func outboundFromShadowsocksURI(uri string) ([]byte, error) {
+	var tag string
+	if i := strings.Index(uri, "#"); i >= 0 {
+		remark, err := url.PathUnescape(uri[i+1:])
+		if err != nil {
+			return nil, newError("invalid remark in ss URI").Base(err)
+		}
+		tag = strings.TrimSpace(remark)
+		uri = uri[:i]
+	}
+
+	var userInfo, hostPort string
+	if i := strings.LastIndex(uri, "@"); i >= 0 {
+		// SIP002: ss://userinfo@host:port/?plugin=...
+		userInfo, hostPort = uri[:i], uri[i+1:]
+		if j := strings.IndexAny(hostPort, "/?"); j >= 0 {
+			params := hostPort[j:]
+			hostPort = hostPort[:j]
+			if k := strings.Index(params, "?"); k >= 0 {
+				query, err := url.ParseQuery(params[k+1:])
+				if err != nil {
+					return nil, newError("invalid parameters in ss URI").Base(err)
+				}
+				if plugin := query.Get("plugin"); len(plugin) > 0 {
+					return nil, newError("plugins of Shadowsocks are not supported: ", plugin)
+				}
+				var unknown []string
+				for key := range query {
+					if key != "plugin" {
+						unknown = append(unknown, key)
+					}
+				}
+				if len(unknown) > 0 {
+					sort.Strings(unknown)
+					newError("ignoring unknown parameters of ss URI: ", strings.Join(unknown, ", ")).AtWarning().WriteToLog()
+				}
+			}
+		}
+		if decoded, err := decodeBase64(userInfo); err == nil {
+			userInfo = string(decoded)
+		} else if unescaped, err := url.PathUnescape(userInfo); err == nil {
+			userInfo = unescaped
+		}
+	} else {
+		// Legacy: ss://base64(method:password@host:port)
+		decoded, err := decodeBase64(uri)
+		if err != nil {
+			return nil, newError("invalid base64 in ss URI").Base(err)
+		}
+		plain := string(decoded)
+		i := strings.LastIndex(plain, "@")
+		if i < 0 {
+			return nil, newError("server address is not specified in ss URI")
+		}
+		userInfo, hostPort = plain[:i], plain[i+1:]
+	}
+
+	i := strings.Index(userInfo, ":")
+	if i < 0 {
+		return nil, newError("method and password are not specified in ss URI")
+	}
+	method, password := userInfo[:i], userInfo[i+1:]
+	host, portStr, err := splitHostPort(hostPort)
+	if err != nil {
+		return nil, newError("invalid server address in ss URI: ", hostPort).Base(err)
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil || port == 0 {
+		return nil, newError("invalid port in ss URI: ", portStr)
+	}
+
+	outbound := map[string]interface{}{
+		"protocol": "shadowsocks",
+		"settings": map[string]interface{}{
+			"servers": []interface{}{
+				map[string]interface{}{
+					"address":  host,
+					"port":     port,
+					"method":   strings.ToLower(method),
+					"password": password,
+				},
+			},
+		},
+	}
+	if len(tag) > 0 {
+		outbound["tag"] = tag
+	}
+	return json.Marshal(outbound)
+}
+
+// splitHostPort splits host:port, where the host may be an IPv6 address in brackets.
+func splitHostPort(hostPort string) (string, string, error) {
+	i := strings.LastIndex(hostPort, ":")
+	if i < 0 {
+		return "", "", newError("missing port")
+	}
+	host := strings.TrimSuffix(strings.TrimPrefix(hostPort[:i], "["), "]")
+	if len(host) == 0 {
+		return "", "", newError("missing host")
+	}
+	return host, hostPort[i+1:], nil
+}
@@ -0,0 +1,132 @@
+package conf_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"v2ray.com/core/common"
+	. "v2ray.com/core/infra/conf"
+)
+
+func vmessLink(fields string) string {
+	return "vmess://" + base64.StdEncoding.EncodeToString([]byte(fields))
+}
+
+func TestOutboundFromURI(t *testing.T) {
+	cases := []struct {
+		uri    string
+		output string
+	}{
+		{
+			uri: vmessLink(`{"v": "2", "ps": "hk", "add": "example.com", "port": "443", "id": "b831381d-6324-4d53-ad4f-8cda48b30811", "aid": 0, "scy": "auto",
+				"net": "ws", "type": "none", "host": "cdn.example.com", "path": "/ray", "tls": "tls", "fp": "chrome"}`),
+			output: `{"protocol": "vmess", "tag": "hk",
+				"settings": {"vnext": [{"address": "example.com", "port": 443, "users": [{"id": "b831381d-6324-4d53-ad4f-8cda48b30811", "alterId": 0, "security": "auto"}]}]},
+				"streamSettings": {"network": "ws", "wsSettings": {"path": "/ray", "headers": {"Host": "cdn.example.com"}},
+					"security": "tls", "tlsSettings": {"serverName": "cdn.example.com"}}}`,
+		},
+		{
+			uri: vmessLink(`{"add": "1.2.3.4", "port": 8443, "id": "b831381d-6324-4d53-ad4f-8cda48b30811", "net": "h2", "host": "a.com,b.com", "path": "/h2",
+				"tls": "tls", "sni": "c.com", "alpn": "h2"}`),
+			output: `{"protocol": "vmess",
+				"settings": {"vnext": [{"address": "1.2.3.4", "port": 8443, "users": [{"id": "b831381d-6324-4d53-ad4f-8cda48b30811"}]}]},
+				"streamSettings": {"network": "http", "httpSettings": {"path": "/h2", "host": ["a.com", "b.com"]},
+					"security": "tls", "tlsSettings": {"serverName": "c.com", "alpn": ["h2"]}}}`,
+		},
+		{
+			uri: vmessLink(`{"add": "1.2.3.4", "port": "80", "id": "b831381d-6324-4d53-ad4f-8cda48b30811", "net": "tcp", "type": "http", "host": "a.com", "path": "/a,/b"}`),
+			output: `{"protocol": "vmess",
+				"settings": {"vnext": [{"address": "1.2.3.4", "port": 80, "users": [{"id": "b831381d-6324-4d53-ad4f-8cda48b30811"}]}]},
+				"streamSettings": {"network": "tcp", "tcpSettings": {"header": {"type": "http", "request": {"path": ["/a", "/b"], "headers": {"Host": ["a.com"]}}}}}}`,
+		},
+		{
+			uri: vmessLink(`{"add": "1.2.3.4", "port": "80", "id": "b831381d-6324-4d53-ad4f-8cda48b30811", "net": "kcp", "type": "wechat-video", "path": "seed"}`),
+			output: `{"protocol": "vmess",
+				"settings": {"vnext": [{"address": "1.2.3.4", "port": 80, "users": [{"id": "b831381d-6324-4d53-ad4f-8cda48b30811"}]}]},
+				"streamSettings": {"network": "kcp", "kcpSettings": {"header": {"type": "wechat-video"}, "seed": "seed"}}}`,
+		},
+		{
+			uri: "ss://" + base64.RawURLEncoding.EncodeToString([]byte("aes-128-gcm:pass")) + "@example.com:8388/?foo=bar#my%20server",
+			output: `{"protocol": "shadowsocks", "tag": "my server",
+				"settings": {"servers": [{"address": "example.com", "port": 8388, "method": "aes-128-gcm", "password": "pass"}]}}`,
+		},
+		{
+			uri: "ss://chacha20-ietf-poly1305:p%40ss@[::1]:8388",
+			output: `{"protocol": "shadowsocks",
+				"settings": {"servers": [{"address": "::1", "port": 8388, "method": "chacha20-ietf-poly1305", "password": "p@ss"}]}}`,
+		},
+		{
+			uri: "ss://" + base64.StdEncoding.EncodeToString([]byte("AES-256-GCM:p@ss:word@1.2.3.4:443")) + "#legacy",
+			output: `{"protocol": "shadowsocks", "tag": "legacy",
+				"settings": {"servers": [{"address": "1.2.3.4", "port": 443, "method": "aes-256-gcm", "password": "p@ss:word"}]}}`,
+		},
+	}
+	for _, c := range cases {
+		actual, err := OutboundFromURI(c.uri)
+		if err != nil {
+			t.Error("failed to convert ", c.uri, ": ", err)
+			continue
+		}
+		var actualValue, expectedValue interface{}
+		common.Must(json.Unmarshal(actual, &actualValue))
+		common.Must(json.Unmarshal([]byte(c.output), &expectedValue))
+		if r := cmp.Diff(actualValue, expectedValue); r != "" {
+			t.Error(c.uri, ": ", r)
+		}
+	}
+}
+
+func TestOutboundFromInvalidURI(t *testing.T) {
+	for _, uri := range []string{
+		"trojan://pass@example.com:443",
+		"example.com:443",
+		vmessLink(`{"add": "1.2.3.4", "port": "80", "id": "b831381d-6324-4d53-ad4f-8cda48b30811", "net": "grpc"}`),
+		vmessLink(`{"add": "1.2.3.4", "port": "80", "id": "b831381d-6324-4d53-ad4f-8cda48b30811", "tls": "reality"}`),
+		vmessLink(`{"add": "1.2.3.4", "id": "b831381d-6324-4d53-ad4f-8cda48b30811"}`),
+		"vmess://not base64",
+		"ss://" + base64.RawURLEncoding.EncodeToString([]byte("aes-128-gcm:pass")) + "@example.com:8388/?plugin=obfs-local",
+		"ss://aes-128-gcm@example.com:8388",
+	} {
+		if _, err := OutboundFromURI(uri); err == nil {
+			t.Error("expect error for ", uri)
+		}
+	}
+}
+
+func TestURIsFromSubscription(t *testing.T) {
+	list := "vmess://abc\r\n\nss://def\n"
+	for _, content := range []string{list, base64.StdEncoding.EncodeToString([]byte(list))} {
+		if r := cmp.Diff(URIsFromSubscription([]byte(content)), []string{"vmess://abc", "ss://def"}); r != "" {
+			t.Error(r)
+		}
+	}
+}
+
+func TestOutboundDetourConfigURI(t *testing.T) {
+	uri := vmessLink(`{"ps": "remark", "add": "example.com", "port": "443", "id": "b831381d-6324-4d53-ad4f-8cda48b30811", "net": "ws", "path": "/ray", "tls": "tls"}`)
+
+	config := new(OutboundDetourConfig)
+	common.Must(json.Unmarshal([]byte(`{"uri": "`+uri+`", "mux": {"enabled": true}}`), config))
+	if config.Tag != "remark" || config.Protocol != "vmess" || config.StreamSetting == nil {
+		t.Error("unexpected outbound converted from uri: ", config.Tag, " ", config.Protocol)
+	}
+	outbound, err := config.Build()
+	common.Must(err)
+	if outbound.Tag != "remark" {
+		t.Error("expect tag remark, but got ", outbound.Tag)
+	}
+
+	config = new(OutboundDetourConfig)
+	common.Must(json.Unmarshal([]byte(`{"uri": "`+uri+`", "tag": "proxy"}`), config))
+	if config.Tag != "proxy" {
+		t.Error("expect tag proxy, but got ", config.Tag)
+	}
+
+	config = new(OutboundDetourConfig)
+	if err := json.Unmarshal([]byte(`{"uri": "`+uri+`", "protocol": "freedom"}`), config); err == nil {
+		t.Error("expect error for protocol with uri")
+	}
+}
@@ -4,18 +4,22 @@ import (
 	"encoding/json"
 	"log"
 	"os"
+	"strconv"
 	"strings"
 
 	"v2ray.com/core"
 	"v2ray.com/core/app/dispatcher"
 	"v2ray.com/core/app/proxyman"
 	"v2ray.com/core/app/stats"
+	"v2ray.com/core/common/net"
 	"v2ray.com/core/common/serial"
+	"v2ray.com/core/transport/internet"
 )
 
 var (
 	inboundConfigLoader = NewJSONConfigLoader(ConfigCreatorCache{
 		"dokodemo-door": func() interface{} { return new(DokodemoConfig) },
+		"dns":           func() interface{} { return new(DNSInboundConfig) },
 		"http":          func() interface{} { return new(HTTPServerConfig) },
 		"shadowsocks":   func() interface{} { return new(ShadowsocksServerConfig) },
 		"socks":         func() interface{} { return new(SocksServerConfig) },
@@ -36,6 +40,8 @@ var (
 		"trojan":      func() interface{} { return new(TrojanClientConfig) },
 		"mtproto":     func() interface{} { return new(MTProtoClientConfig) },
 		"dns":         func() interface{} { return new(DNSOutboundConfig) },
+		"loopback":    func() interface{} { return new(LoopbackConfig) },
+		"race":        func() interface{} { return new(RaceConfig) },
 	}, "protocol", "settings")
 
 	ctllog = log.New(os.Stderr, "v2ctl> ", 0)
@@ -59,6 +65,9 @@ func toProtocolList(s []string) ([]proxyman.KnownProtocols, error) {
 type SniffingConfig struct {
 	Enabled      bool        `json:"enabled"`
 	DestOverride *StringList `json:"destOverride"`
+	// Timeout in milliseconds.
+	Timeout       uint32 `json:"timeout"`
+	RecordRequest bool   `json:"recordRequest"`
 }
 
 // Build implements Buildable.
@@ -80,18 +89,135 @@ func (c *SniffingConfig) Build() (*proxyman.SniffingConfig, error) {
 	return &proxyman.SniffingConfig{
 		Enabled:             c.Enabled,
 		DestinationOverride: p,
+		Timeout:             c.Timeout,
+		RecordRequest:       c.RecordRequest,
 	}, nil
 }
 
+type ConnectionLimitOverride struct {
+	Networks     *StringList `json:"networks"`
+	Rate         uint32      `json:"rate"`
+	Burst        uint32      `json:"burst"`
+	BanThreshold uint32      `json:"banThreshold"`
+}
+
+type UDPSessionConfig struct {
+	MaxSessions  uint32            `json:"maxSessions"`
+	IdleTimeout  uint32            `json:"idleTimeout"`
+	PortTimeouts map[string]uint32 `json:"portTimeouts"`
+}
+
+// Build implements Buildable.
+func (c *UDPSessionConfig) Build() (*proxyman.UDPSessionConfig, error) {
+	config := &proxyman.UDPSessionConfig{
+		MaxSessions: c.MaxSessions,
+		IdleTimeout: c.IdleTimeout,
+	}
+	if len(c.PortTimeouts) > 0 {
+		config.PortTimeout = make(map[uint32]uint32, len(c.PortTimeouts))
+		for portStr, timeout := range c.PortTimeouts {
+			port, err := net.PortFromString(portStr)
+			if err != nil {
+				return nil, newError("invalid port in UDP session timeouts: ", portStr).Base(err)
+			}
+			config.PortTimeout[uint32(port)] = timeout
+		}
+	}
+	return config, nil
+}
+
+type BindRetryConfig struct {
+	Attempts   uint32 `json:"attempts"`
+	Backoff    uint32 `json:"backoff"`
+	MaxBackoff uint32 `json:"maxBackoff"`
+}
+
+// Build implements Buildable.
+func (c *BindRetryConfig) Build() (*proxyman.BindRetryConfig, error) {
+	if c.MaxBackoff > 0 && c.Backoff > c.MaxBackoff {
+		return nil, newError("bind retry backoff ", c.Backoff, " is larger than maxBackoff ", c.MaxBackoff)
+	}
+	return &proxyman.BindRetryConfig{
+		Attempts:   c.Attempts,
+		Backoff:    c.Backoff,
+		MaxBackoff: c.MaxBackoff,
+	}, nil
+}
+
+type ListenerShardingConfig struct {
+	Listeners uint32 `json:"listeners"`
+}
+
+// Build implements Buildable.
+func (c *ListenerShardingConfig) Build() (*proxyman.ListenerShardingConfig, error) {
+	return &proxyman.ListenerShardingConfig{
+		Listeners: c.Listeners,
+	}, nil
+}
+
+type ConnectionLimitConfig struct {
+	Rate         uint32                     `json:"rate"`
+	Burst        uint32                     `json:"burst"`
+	BanThreshold uint32                     `json:"banThreshold"`
+	BanWindow    uint32                     `json:"banWindow"`
+	BanDuration  uint32                     `json:"banDuration"`
+	Overrides    []*ConnectionLimitOverride `json:"overrides"`
+}
+
+// Build implements Buildable.
+func (c *ConnectionLimitConfig) Build() (*proxyman.ConnectionLimitConfig, error) {
+	config := &proxyman.ConnectionLimitConfig{
+		Rate:         c.Rate,
+		Burst:        c.Burst,
+		BanThreshold: c.BanThreshold,
+		BanWindow:    c.BanWindow,
+		BanDuration:  c.BanDuration,
+	}
+	for _, o := range c.Overrides {
+		if o.Networks == nil || len(*o.Networks) == 0 {
+			return nil, newError("networks of connection limit override are not specified")
+		}
+		override := &proxyman.ConnectionLimitConfig_Override{
+			Rate:         o.Rate,
+			Burst:        o.Burst,
+			BanThreshold: o.BanThreshold,
+		}
+		for _, network := range *o.Networks {
+			if !strings.Contains(network, "/") {
+				if ip := net.ParseIP(network); ip != nil && ip.To4() != nil {
+					network += "/32"
+				} else {
+					network += "/128"
+				}
+			}
+			if _, _, err := net.ParseCIDR(network); err != nil {
+				return nil, newError("invalid network: ", network).Base(err)
+			}
+			override.Cidr = append(override.Cidr, network)
+		}
+		config.Override = append(config.Override, override)
+	}
+	return config, nil
+}
+
 type MuxConfig struct {
-	Enabled     bool  `json:"enabled"`
-	Concurrency int16 `json:"concurrency"`
+	Enabled           bool                     `json:"enabled"`
+	Concurrency       int16                    `json:"concurrency"`
+	Bypass            []string                 `json:"bypass"`
+	ConnectionRecycle *ConnectionRecycleConfig `json:"connectionRecycle"`
+}
+
+// ConnectionRecycleConfig limits shared connections: Mux connections, HTTP/2 clients and QUIC sessions.
+// MaxLifetime is in seconds. Other connections are not recycled, as they end with their sessions.
+type ConnectionRecycleConfig struct {
+	MaxLifetime uint32 `json:"maxLifetime"`
+	MaxBytes    uint64 `json:"maxBytes"`
 }
 
 // Build creates MultiplexingConfig, Concurrency < 0 completely disables mux.
-func (m *MuxConfig) Build() *proxyman.MultiplexingConfig {
+func (m *MuxConfig) Build() (*proxyman.MultiplexingConfig, error) {
 	if m.Concurrency < 0 {
-		return nil
+		return nil, nil
 	}
 
 	var con uint32 = 8
@@ -99,10 +225,96 @@ func (m *MuxConfig) Build() *proxyman.MultiplexingConfig {
 		con = uint32(m.Concurrency)
 	}
 
-	return &proxyman.MultiplexingConfig{
+	config := &proxyman.MultiplexingConfig{
 		Enabled:     m.Enabled,
 		Concurrency: con,
 	}
+	for _, b := range m.Bypass {
+		rule, err := parseMuxBypassRule(b)
+		if err != nil {
+			return nil, newError("invalid mux bypass: ", b).Base(err)
+		}
+		config.Bypass = append(config.Bypass, rule)
+	}
+	if m.ConnectionRecycle != nil {
+		config.ConnectionRecycle = &proxyman.ConnectionRecycleConfig{
+			MaxLifetime: m.ConnectionRecycle.MaxLifetime,
+			MaxBytes:    m.ConnectionRecycle.MaxBytes,
+		}
+	}
+	return config, nil
+}
+
+// parseMuxBypassRule parses a rule of sessions that skip Mux, which is one of "tcp", "udp", a network with
+// ports like "udp:443", "port:22,8000-8080", "protocol:bittorrent", or a domain rule as in routing.
+func parseMuxBypassRule(s string) (*proxyman.MuxBypassRule, error) {
+	parsePorts := func(ports string) (*net.PortList, error) {
+		var list PortList
+		if err := json.Unmarshal([]byte(strconv.Quote(ports)), &list); err != nil {
+			return nil, err
+		}
+		if len(list.Range) == 0 {
+			return nil, newError("empty port list")
+		}
+		return list.Build(), nil
+	}
+
+	rule := new(proxyman.MuxBypassRule)
+	prefix, value := s, ""
+	if idx := strings.Index(s, ":"); idx >= 0 {
+		prefix, value = s[:idx], s[idx+1:]
+	}
+	switch strings.ToLower(prefix) {
+	case "tcp", "udp":
+		network := net.Network_TCP
+		if strings.ToLower(prefix) == "udp" {
+			network = net.Network_UDP
+		}
+		rule.Networks = []net.Network{network}
+		if len(value) > 0 {
+			ports, err := parsePorts(value)
+			if err != nil {
+				return nil, err
+			}
+			rule.PortList = ports
+		}
+	case "port":
+		ports, err := parsePorts(value)
+		if err != nil {
+			return nil, err
+		}
+		rule.PortList = ports
+	case "protocol":
+		if len(value) == 0 {
+			return nil, newError("empty protocol")
+		}
+		rule.Protocol = []string{value}
+	default:
+		domains, err := parseDomainRule(s)
+		if err != nil {
+			return nil, err
+		}
+		rule.Domain = domains
+	}
+	return rule, nil
+}
+
+type PreconnectConfig struct {
+	Size    uint32 `json:"size"`
+	MaxIdle uint32 `json:"maxIdle"`
+	MuxOnly bool   `json:"muxOnly"`
+}
+
+// Build implements Buildable.
+func (c *PreconnectConfig) Build() (*proxyman.PreconnectConfig, error) {
+	if c.Size == 0 {
+		return nil, newError("preconnect size must be positive")
+	}
+	return &proxyman.PreconnectConfig{
+		Size:    c.Size,
+		MaxIdle: c.MaxIdle,
+		MuxOnly: c.MuxOnly,
+	}, nil
 }
 
 type InboundDetourAllocationConfig struct {
@@ -140,20 +352,33 @@ func (c *InboundDetourAllocationConfig) Build() (*proxyman.AllocationStrategy, e
 }
 
 type InboundDetourConfig struct {
-	Protocol       string                         `json:"protocol"`
-	PortRange      *PortRange                     `json:"port"`
-	ListenOn       *Address                       `json:"listen"`
-	Settings       *json.RawMessage               `json:"settings"`
-	Tag            string                         `json:"tag"`
-	Allocation     *InboundDetourAllocationConfig `json:"allocate"`
-	StreamSetting  *StreamConfig                  `json:"streamSettings"`
-	DomainOverride *StringList                    `json:"domainOverride"`
-	SniffingConfig *SniffingConfig                `json:"sniffing"`
+	Protocol        string                         `json:"protocol"`
+	PortRange       *PortRange                     `json:"port"`
+	ListenOn        *Address                       `json:"listen"`
+	Settings        *json.RawMessage               `json:"settings"`
+	Tag             string                         `json:"tag"`
+	Allocation      *InboundDetourAllocationConfig `json:"allocate"`
+	StreamSetting   *StreamConfig                  `json:"streamSettings"`
+	DomainOverride  *StringList                    `json:"domainOverride"`
+	SniffingConfig  *SniffingConfig                `json:"sniffing"`
+	ConnectionLimit *ConnectionLimitConfig         `json:"connectionLimit"`
+	UDPSession      *UDPSessionConfig              `json:"udpSession"`
+	BindRetry       *BindRetryConfig               `json:"bindRetry"`
+	Sharding        *ListenerShardingConfig        `json:"listenerSharding"`
+	AllowedSources  *StringList                    `json:"allowedSources"`
+	DeniedSources   *StringList                    `json:"deniedSources"`
+
+	AllowPartialListen bool `json:"allowPartialListen"`
+	LogRejectedSources bool `json:"logRejectedSources"`
+
+	// source is the file the inbound is read from, if known.
+	source string
 }
 
 // Build implements Buildable.
 func (c *InboundDetourConfig) Build() (*core.InboundHandlerConfig, error) {
 	receiverSettings := &proxyman.ReceiverConfig{}
+	var inheritedSocket string
 
 	if c.ListenOn == nil {
 		// Listen on anyip, must set PortRange
@@ -161,6 +386,30 @@ func (c *InboundDetourConfig) Build() (*core.InboundHandlerConfig, error) {
 			return nil, newError("Listen on AnyIP but no Port(s) set in InboundDetour.")
 		}
 		receiverSettings.PortRange = c.PortRange.Build()
+	} else if c.ListenOn.Family().IsDomain() && c.ListenOn.Domain() == "any" {
+		// Listen on both 0.0.0.0 and ::, must set PortRange
+		if c.PortRange == nil {
+			return nil, newError("Listen on any without port in InboundDetour.")
+		}
+		if c.Allocation != nil && c.Allocation.Strategy != "" && c.Allocation.Strategy != "always" {
+			return nil, newError("Listen on any is not supported with allocation strategy: ", c.Allocation.Strategy)
+		}
+		receiverSettings.PortRange = c.PortRange.Build()
+		receiverSettings.DualStack = &proxyman.DualStackConfig{
+			AllowPartial: c.AllowPartialListen,
+		}
+	} else if c.ListenOn.Family().IsDomain() && strings.HasPrefix(c.ListenOn.Domain(), "fd:") {
+		// Adopt a socket passed by systemd, by its file descriptor or name. The port is the one of the socket.
+		inheritedSocket = c.ListenOn.Domain()[3:]
+		if len(inheritedSocket) == 0 {
+			return nil, newError("empty socket in listen: ", c.ListenOn.Domain())
+		}
+		if c.PortRange != nil {
+			return nil, newError("port must not be set when listening on a socket passed by systemd: ", c.ListenOn.Domain())
+		}
+		if c.Allocation != nil {
+			return nil, newError("allocate is not supported when listening on a socket passed by systemd: ", c.ListenOn.Domain())
+		}
 	} else {
 		// Listen on specific IP or Unix Domain Socket
 		receiverSettings.Listen = c.ListenOn.Build()
@@ -207,6 +456,15 @@ func (c *InboundDetourConfig) Build() (*core.InboundHandlerConfig, error) {
 		}
 		receiverSettings.StreamSettings = ss
 	}
+	if len(inheritedSocket) > 0 {
+		if receiverSettings.StreamSettings == nil {
+			receiverSettings.StreamSettings = &internet.StreamConfig{}
+		}
+		if receiverSettings.StreamSettings.SocketSettings == nil {
+			receiverSettings.StreamSettings.SocketSettings = &internet.SocketConfig{}
+		}
+		receiverSettings.StreamSettings.SocketSettings.InheritedSocket = inheritedSocket
+	}
 	if c.SniffingConfig != nil {
 		s, err := c.SniffingConfig.Build()
 		if err != nil {
@@ -214,6 +472,57 @@ func (c *InboundDetourConfig) Build() (*core.InboundHandlerConfig, error) {
 		}
 		receiverSettings.SniffingSettings = s
 	}
+	if c.ConnectionLimit != nil {
+		l, err := c.ConnectionLimit.Build()
+		if err != nil {
+			return nil, newError("failed to build connection limit config").Base(err)
+		}
+		receiverSettings.ConnectionLimit = l
+	}
+	if c.UDPSession != nil {
+		u, err := c.UDPSession.Build()
+		if err != nil {
+			return nil, newError("failed to build UDP session config").Base(err)
+		}
+		receiverSettings.UdpSession = u
+	}
+	if c.BindRetry != nil {
+		r, err := c.BindRetry.Build()
+		if err != nil {
+			return nil, newError("failed to build bind retry config").Base(err)
+		}
+		receiverSettings.BindRetry = r
+	}
+	if c.Sharding != nil {
+		if c.StreamSetting != nil && c.StreamSetting.SocketSettings != nil && c.StreamSetting.SocketSettings.ReusePort != nil && !*c.StreamSetting.SocketSettings.ReusePort {
+			return nil, newError("listenerSharding requires sockopt.reusePort")
+		}
+		s, err := c.Sharding.Build()
+		if err != nil {
+			return nil, newError("failed to build listener sharding config").Base(err)
+		}
+		receiverSettings.ListenerSharding = s
+	}
+	if c.AllowedSources != nil || c.DeniedSources != nil {
+		access := &proxyman.SourceAccessConfig{
+			LogRejected: c.LogRejectedSources,
+		}
+		if c.AllowedSources != nil {
+			allowed, err := toCidrList(*c.AllowedSources)
+			if err != nil {
+				return nil, newError("failed to parse allowedSources").Base(err)
+			}
+			access.Allowed = allowed
+		}
+		if c.DeniedSources != nil {
+			denied, err := toCidrList(*c.DeniedSources)
+			if err != nil {
+				return nil, newError("failed to parse deniedSources").Base(err)
+			}
+			access.Denied = denied
+		}
+		receiverSettings.SourceAccess = access
+	}
 	if c.DomainOverride != nil {
 		kp, err := toProtocolList(*c.DomainOverride)
 		if err != nil {
@@ -246,13 +555,58 @@ func (c *InboundDetourConfig) Build() (*core.InboundHandlerConfig, error) {
 }
 
 type OutboundDetourConfig struct {
-	Protocol      string           `json:"protocol"`
-	SendThrough   *Address         `json:"sendThrough"`
-	Tag           string           `json:"tag"`
-	Settings      *json.RawMessage `json:"settings"`
-	StreamSetting *StreamConfig    `json:"streamSettings"`
-	ProxySettings *ProxyConfig     `json:"proxySettings"`
-	MuxSettings   *MuxConfig       `json:"mux"`
+	Protocol      string            `json:"protocol"`
+	SendThrough   *StringList       `json:"sendThrough"`
+	SendStrategy  string            `json:"sendThroughStrategy"`
+	Tag           string            `json:"tag"`
+	Settings      *json.RawMessage  `json:"settings"`
+	StreamSetting *StreamConfig     `json:"streamSettings"`
+	ProxySettings *ProxyConfig      `json:"proxySettings"`
+	MuxSettings   *MuxConfig        `json:"mux"`
+	Preconnect    *PreconnectConfig `json:"preconnect"`
+	DNSServerTag  string            `json:"dnsServerTag"`
+	// UDPMaxPacketSize is the size limit in bytes of UDP packets to send.
+	UDPMaxPacketSize uint32 `json:"udpMaxPacketSize"`
+
+	// source is the file the outbound is read from, if known.
+	source string
+}
+
+// UnmarshalJSON implements json.Unmarshaler. Besides the fields of the outbound, the "uri" field takes a
+// share link of a server, which OutboundFromURI converts to the protocol, settings and stream settings of
+// the outbound. The remark of the link is the tag of the outbound, if no tag is set.
+func (c *OutboundDetourConfig) UnmarshalJSON(data []byte) error {
+	type outboundDetourConfig OutboundDetourConfig
+	config := struct {
+		*outboundDetourConfig
+		URI string `json:"uri"`
+	}{
+		outboundDetourConfig: (*outboundDetourConfig)(c),
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return err
+	}
+	if len(config.URI) == 0 {
+		return nil
+	}
+	if len(c.Protocol) > 0 || c.Settings != nil || c.StreamSetting != nil {
+		return newError("protocol, settings and streamSettings of outbound are taken from uri")
+	}
+	generated, err := OutboundFromURI(config.URI)
+	if err != nil {
+		return newError("failed to convert uri of outbound").Base(err)
+	}
+	var outbound outboundDetourConfig
+	if err := json.Unmarshal(generated, &outbound); err != nil {
+		return newError("failed to parse outbound converted from uri").Base(err)
+	}
+	c.Protocol = outbound.Protocol
+	c.Settings = outbound.Settings
+	c.StreamSetting = outbound.StreamSetting
+	if len(c.Tag) == 0 {
+		c.Tag = outbound.Tag
+	}
+	return nil
 }
 
 // Build implements Buildable.
@@ -260,11 +614,36 @@ func (c *OutboundDetourConfig) Build() (*core.OutboundHandlerConfig, error) {
 	senderSettings := &proxyman.SenderConfig{}
 
 	if c.SendThrough != nil {
-		address := c.SendThrough
-		if address.Family().IsDomain() {
-			return nil, newError("unable to send through: " + address.String())
+		list := *c.SendThrough
+		if len(list) == 1 && !strings.Contains(list[0], "/") {
+			address := net.ParseAddress(strings.TrimSpace(list[0]))
+			if address.Family().IsDomain() {
+				return nil, newError("unable to send through: " + address.String())
+			}
+			senderSettings.Via = net.NewIPOrDomain(address)
+		} else {
+			pool := &proxyman.ViaPool{}
+			for _, s := range list {
+				s = strings.TrimSpace(s)
+				if strings.Contains(s, "/") {
+					if _, _, err := net.ParseCIDR(s); err != nil {
+						return nil, newError("invalid network to send through: ", s).Base(err)
+					}
+				} else if !net.ParseAddress(s).Family().IsIP() {
+					return nil, newError("unable to send through: " + s)
+				}
+				pool.Cidr = append(pool.Cidr, s)
+			}
+			switch strings.ToLower(c.SendStrategy) {
+			case "", "roundrobin":
+				pool.Strategy = proxyman.ViaPool_RoundRobin
+			case "random":
+				pool.Strategy = proxyman.ViaPool_Random
+			default:
+				return nil, newError("unknown send through strategy: ", c.SendStrategy)
+			}
+			senderSettings.ViaPool = pool
 		}
-		senderSettings.Via = address.Build()
 	}
 
 	if c.StreamSetting != nil {
@@ -284,9 +663,31 @@ func (c *OutboundDetourConfig) Build() (*core.OutboundHandlerConfig, error) {
 	}
 
 	if c.MuxSettings != nil {
-		senderSettings.MultiplexSettings = c.MuxSettings.Build()
+		ms, err := c.MuxSettings.Build()
+		if err != nil {
+			return nil, err
+		}
+		senderSettings.MultiplexSettings = ms
 	}
 
+	if c.Preconnect != nil {
+		switch strings.ToLower(c.Protocol) {
+		case "freedom", "blackhole", "dns":
+			return nil, newError("preconnect is not supported by ", c.Protocol, " outbound")
+		}
+		if c.Preconnect.MuxOnly && (c.MuxSettings == nil || !c.MuxSettings.Enabled) {
+			return nil, newError("preconnect.muxOnly requires mux to be enabled")
+		}
+		pc, err := c.Preconnect.Build()
+		if err != nil {
+			return nil, err
+		}
+		senderSettings.PreconnectSettings = pc
+	}
+
+	senderSettings.DnsServerTag = c.DNSServerTag
+	senderSettings.UdpMaxPacketSize = c.UDPMaxPacketSize
+
 	settings := []byte("{}")
 	if c.Settings != nil {
 		settings = ([]byte)(*c.Settings)
@@ -307,11 +708,17 @@ func (c *OutboundDetourConfig) Build() (*core.OutboundHandlerConfig, error) {
 	}, nil
 }
 
-type StatsConfig struct{}
+type StatsConfig struct {
+	PersistenceFile     string `json:"persistenceFile"`
+	PersistenceInterval uint32 `json:"persistenceInterval"`
+}
 
 // Build implements Buildable.
 func (c *StatsConfig) Build() (*stats.Config, error) {
-	return &stats.Config{}, nil
+	return &stats.Config{
+		PersistenceFile:     c.PersistenceFile,
+		PersistenceInterval: c.PersistenceInterval,
+	}, nil
 }
 
 type Config struct {
@@ -346,6 +753,22 @@ type Config struct {
 	API             *APIConfig             `json:"api"`
 	Stats           *StatsConfig           `json:"stats"`
 	Reverse         *ReverseConfig         `json:"reverse"`
+	Mirror          *MirrorConfig          `json:"mirror"`
+	Events          *EventsConfig          `json:"events"`
+	System          *SystemConfig          `json:"system"`
+	Observability   *ObservabilityConfig   `json:"observability"`
+
+	// DisabledFeatures lists features, by the names, "kind:name" or the config types in
+	// "v2ray -version -verbose", that configs must not use.
+	DisabledFeatures []string `json:"disabledFeatures"`
+
+	// Geodata maps names of geodata files, such as "geoip.dat", to their content in base64. Rules
+	// read these instead of the files in the asset directories.
+	Geodata map[string][]byte `json:"geodata"`
+
+	// Include lists paths or glob patterns of config files to merge into this one. It is resolved
+	// by serial.ResolveIncludes.
+	Include []string `json:"include"`
 }
 
 func (c *Config) findInboundTag(tag string) int {
@@ -370,33 +793,79 @@ func (c *Config) findOutboundTag(tag string) int {
 	return found
 }
 
-// Override method accepts another Config overrides the current attribute
+// Override merges o, which is read from the file fn, into c. Top level objects of o replace the ones of
+// c, except routing, whose rules and balancers are merged. Inbounds, outbounds, routing rules and
+// balancers are merged by tag: fields set in o override the ones of the element with the same tag,
+// and elements with new tags are added. Arrays with untagged elements replace the existing ones.
+// Each step is traced to stderr.
 func (c *Config) Override(o *Config, fn string) {
+	o.MarkSource(fn)
+
 	// only process the non-deprecated members
 
+	var replaced []string
 	if o.LogConfig != nil {
 		c.LogConfig = o.LogConfig
+		replaced = append(replaced, "log")
 	}
 	if o.RouterConfig != nil {
-		c.RouterConfig = o.RouterConfig
+		if c.RouterConfig == nil {
+			c.RouterConfig = o.RouterConfig
+			replaced = append(replaced, "routing")
+		} else {
+			c.RouterConfig.override(o.RouterConfig, fn)
+		}
 	}
 	if o.DNSConfig != nil {
 		c.DNSConfig = o.DNSConfig
+		replaced = append(replaced, "dns")
 	}
 	if o.Transport != nil {
 		c.Transport = o.Transport
+		replaced = append(replaced, "transport")
 	}
 	if o.Policy != nil {
 		c.Policy = o.Policy
+		replaced = append(replaced, "policy")
 	}
 	if o.API != nil {
 		c.API = o.API
+		replaced = append(replaced, "api")
 	}
 	if o.Stats != nil {
 		c.Stats = o.Stats
+		replaced = append(replaced, "stats")
 	}
 	if o.Reverse != nil {
 		c.Reverse = o.Reverse
+		replaced = append(replaced, "reverse")
+	}
+	if o.Mirror != nil {
+		c.Mirror = o.Mirror
+		replaced = append(replaced, "mirror")
+	}
+	if o.Events != nil {
+		c.Events = o.Events
+		replaced = append(replaced, "events")
+	}
+	if o.System != nil {
+		c.System = o.System
+		replaced = append(replaced, "system")
+	}
+	if o.Observability != nil {
+		c.Observability = o.Observability
+		replaced = append(replaced, "observability")
+	}
+	if o.DisabledFeatures != nil {
+		c.DisabledFeatures = o.DisabledFeatures
+		replaced = append(replaced, "disabledFeatures")
+	}
+	if o.Geodata != nil {
+		c.Geodata = o.Geodata
+		replaced = append(replaced, "geodata")
+	}
+	if len(replaced) > 0 {
+		ctllog.Println("[", fn, "] replaced ", strings.Join(replaced, ", "))
 	}
 
 	// deprecated attrs... keep them for now
@@ -414,39 +883,11 @@ func (c *Config) Override(o *Config, fn string) {
 	}
 	// deprecated attrs
 
-	// update the Inbound in slice if the only one in overide config has same tag
 	if len(o.InboundConfigs) > 0 {
-		if len(c.InboundConfigs) > 0 && len(o.InboundConfigs) == 1 {
-			if idx := c.findInboundTag(o.InboundConfigs[0].Tag); idx > -1 {
-				c.InboundConfigs[idx] = o.InboundConfigs[0]
-				ctllog.Println("[", fn, "] updated inbound with tag: ", o.InboundConfigs[0].Tag)
-			} else {
-				c.InboundConfigs = append(c.InboundConfigs, o.InboundConfigs[0])
-				ctllog.Println("[", fn, "] appended inbound with tag: ", o.InboundConfigs[0].Tag)
-			}
-		} else {
-			c.InboundConfigs = o.InboundConfigs
-		}
+		c.mergeInbounds(o.InboundConfigs, fn)
 	}
-
-	// update the Outbound in slice if the only one in overide config has same tag
 	if len(o.OutboundConfigs) > 0 {
-		if len(c.OutboundConfigs) > 0 && len(o.OutboundConfigs) == 1 {
-			if idx := c.findOutboundTag(o.OutboundConfigs[0].Tag); idx > -1 {
-				c.OutboundConfigs[idx] = o.OutboundConfigs[0]
-				ctllog.Println("[", fn, "] updated outbound with tag: ", o.OutboundConfigs[0].Tag)
-			} else {
-				if strings.Contains(strings.ToLower(fn), "tail") {
-					c.OutboundConfigs = append(c.OutboundConfigs, o.OutboundConfigs[0])
-					ctllog.Println("[", fn, "] appended outbound with tag: ", o.OutboundConfigs[0].Tag)
-				} else {
-					c.OutboundConfigs = append(o.OutboundConfigs, c.OutboundConfigs...)
-					ctllog.Println("[", fn, "] prepended outbound with tag: ", o.OutboundConfigs[0].Tag)
-				}
-			}
-		} else {
-			c.OutboundConfigs = o.OutboundConfigs
-		}
+		c.mergeOutbounds(o.OutboundConfigs, fn, strings.Contains(strings.ToLower(fn), "tail"))
 	}
 }
 
@@ -470,9 +911,28 @@ func applyTransportConfig(s *StreamConfig, t *TransportConfig) {
 
 // Build implements Buildable.
 func (c *Config) Build() (*core.Config, error) {
+	warnings, err := c.Validate()
+	for _, w := range warnings {
+		ctllog.Println("[warning]", w)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	defer useInlineGeodata(c.Geodata)()
+
+	dispatcherConfig := &dispatcher.Config{}
+	if c.Mirror != nil {
+		mirror, err := c.Mirror.Build()
+		if err != nil {
+			return nil, err
+		}
+		dispatcherConfig.Mirror = mirror
+	}
+
 	config := &core.Config{
 		App: []*serial.TypedMessage{
-			serial.ToTypedMessage(&dispatcher.Config{}),
+			serial.ToTypedMessage(dispatcherConfig),
 			serial.ToTypedMessage(&proxyman.InboundConfig{}),
 			serial.ToTypedMessage(&proxyman.OutboundConfig{}),
 		},
@@ -502,7 +962,16 @@ func (c *Config) Build() (*core.Config, error) {
 	}
 	// let logger module be the first App to start,
 	// so that other modules could print log during initiating
-	config.App = append([]*serial.TypedMessage{logConfMsg}, config.App...)
+	frontApps := []*serial.TypedMessage{logConfMsg}
+	if c.Observability != nil {
+		// The health check server starts next, to be up while the others start.
+		hc, err := c.Observability.Build()
+		if err != nil {
+			return nil, err
+		}
+		frontApps = append(frontApps, serial.ToTypedMessage(hc))
+	}
+	config.App = append(frontApps, config.App...)
 
 	if c.RouterConfig != nil {
 		routerConfig, err := c.RouterConfig.Build()
@@ -536,6 +1005,24 @@ func (c *Config) Build() (*core.Config, error) {
 		config.App = append(config.App, serial.ToTypedMessage(r))
 	}
 
+	if c.Events != nil {
+		ec, err := c.Events.Build()
+		if err != nil {
+			return nil, err
+		}
+		config.App = append(config.App, serial.ToTypedMessage(ec))
+	}
+
+	if c.System != nil {
+		sc, err := c.System.Build()
+		if err != nil {
+			return nil, err
+		}
+		config.System = sc
+	}
+
+	config.DisabledFeatures = c.DisabledFeatures
+
 	var inbounds []InboundDetourConfig
 
 	if c.InboundConfig != nil {
@@ -569,6 +1056,10 @@ func (c *Config) Build() (*core.Config, error) {
 		if err != nil {
 			return nil, err
 		}
+		// Quotas are enforced by the stats manager, and would be ignored without it.
+		if email := quotaUser(ic); len(email) > 0 && c.Stats == nil {
+			return nil, newError("user ", email, " has a traffic quota, which requires the stats app to be configured")
+		}
 		config.Inbound = append(config.Inbound, ic)
 	}
 
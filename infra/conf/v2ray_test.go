@@ -3,18 +3,22 @@ package conf_test
 import (
 	"encoding/json"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/golang/protobuf/proto"
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 	"v2ray.com/core"
 	"v2ray.com/core/app/dispatcher"
+	"v2ray.com/core/app/health"
 	"v2ray.com/core/app/log"
 	"v2ray.com/core/app/proxyman"
 	"v2ray.com/core/app/router"
 	"v2ray.com/core/common"
 	clog "v2ray.com/core/common/log"
 	"v2ray.com/core/common/net"
+	"v2ray.com/core/common/platform"
 	"v2ray.com/core/common/protocol"
 	"v2ray.com/core/common/serial"
 	. "v2ray.com/core/infra/conf"
@@ -50,7 +54,8 @@ func TestV2RayConfig(t *testing.T) {
 				"log": {
 					"access": "/var/log/v2ray/access.log",
 					"loglevel": "error",
-					"error": "/var/log/v2ray/error.log"
+					"error": "/var/log/v2ray/error.log",
+					"sessionId": false
 				},
 				"inbound": {
 					"streamSettings": {
@@ -141,11 +146,12 @@ func TestV2RayConfig(t *testing.T) {
 			Output: &core.Config{
 				App: []*serial.TypedMessage{
 					serial.ToTypedMessage(&log.Config{
-						ErrorLogType:  log.LogType_File,
-						ErrorLogPath:  "/var/log/v2ray/error.log",
-						ErrorLogLevel: clog.Severity_Error,
-						AccessLogType: log.LogType_File,
-						AccessLogPath: "/var/log/v2ray/access.log",
+						ErrorLogType:     log.LogType_File,
+						ErrorLogPath:     "/var/log/v2ray/error.log",
+						ErrorLogLevel:    clog.Severity_Error,
+						AccessLogType:    log.LogType_File,
+						AccessLogPath:    "/var/log/v2ray/access.log",
+						DisableSessionId: true,
 					}),
 					serial.ToTypedMessage(&dispatcher.Config{}),
 					serial.ToTypedMessage(&proxyman.InboundConfig{}),
@@ -359,12 +365,41 @@ func TestMuxConfig_Build(t *testing.T) {
 			Concurrency: 4,
 		}},
 		{"forbidden", `{"enabled": false, "concurrency": -1}`, nil},
+		{"connection recycle", `{"enabled": true, "connectionRecycle": {"maxLifetime": 600, "maxBytes": 104857600}}`, &proxyman.MultiplexingConfig{
+			Enabled:     true,
+			Concurrency: 8,
+			ConnectionRecycle: &proxyman.ConnectionRecycleConfig{
+				MaxLifetime: 600,
+				MaxBytes:    104857600,
+			},
+		}},
+		{"bypass", `{"enabled": true, "bypass": ["udp:443", "port:22,8000-8080", "protocol:bittorrent", "domain:example.com"]}`, &proxyman.MultiplexingConfig{
+			Enabled:     true,
+			Concurrency: 8,
+			Bypass: []*proxyman.MuxBypassRule{
+				{
+					Networks: []net.Network{net.Network_UDP},
+					PortList: &net.PortList{Range: []*net.PortRange{{From: 443, To: 443}}},
+				},
+				{
+					PortList: &net.PortList{Range: []*net.PortRange{{From: 22, To: 22}, {From: 8000, To: 8080}}},
+				},
+				{
+					Protocol: []string{"bittorrent"},
+				},
+				{
+					Domain: []*router.Domain{{Type: router.Domain_Domain, Value: "example.com"}},
+				},
+			},
+		}},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			m := &MuxConfig{}
 			common.Must(json.Unmarshal([]byte(tt.fields), m))
-			if got := m.Build(); !reflect.DeepEqual(got, tt.want) {
+			got, err := m.Build()
+			common.Must(err)
+			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("MuxConfig.Build() = %v, want %v", got, tt.want)
 			}
 		})
@@ -412,11 +447,21 @@ func TestConfig_Override(t *testing.T) {
 			&Config{InboundConfigs: []InboundDetourConfig{{Tag: "pos1", Protocol: "kcp"}}},
 			"",
 			&Config{InboundConfigs: []InboundDetourConfig{{Tag: "pos0"}, {Tag: "pos1", Protocol: "kcp"}}}},
-		{"replace/inbounds-replaceall",
+		{"merge/inbounds-bytag",
 			&Config{InboundConfigs: []InboundDetourConfig{{Tag: "pos0"}, {Protocol: "vmess", Tag: "pos1"}}},
 			&Config{InboundConfigs: []InboundDetourConfig{{Tag: "pos1", Protocol: "kcp"}, {Tag: "pos2", Protocol: "kcp"}}},
 			"",
-			&Config{InboundConfigs: []InboundDetourConfig{{Tag: "pos1", Protocol: "kcp"}, {Tag: "pos2", Protocol: "kcp"}}}},
+			&Config{InboundConfigs: []InboundDetourConfig{{Tag: "pos0"}, {Tag: "pos1", Protocol: "kcp"}, {Tag: "pos2", Protocol: "kcp"}}}},
+		{"merge/inbounds-fields",
+			&Config{InboundConfigs: []InboundDetourConfig{{Protocol: "vmess", Tag: "pos0", SniffingConfig: &SniffingConfig{Enabled: true}}}},
+			&Config{InboundConfigs: []InboundDetourConfig{{Tag: "pos0", ListenOn: &Address{net.LocalHostIP}}}},
+			"",
+			&Config{InboundConfigs: []InboundDetourConfig{{Protocol: "vmess", Tag: "pos0", ListenOn: &Address{net.LocalHostIP}, SniffingConfig: &SniffingConfig{Enabled: true}}}}},
+		{"replace/inbounds-untagged",
+			&Config{InboundConfigs: []InboundDetourConfig{{Tag: "pos0"}, {Protocol: "vmess", Tag: "pos1"}}},
+			&Config{InboundConfigs: []InboundDetourConfig{{Tag: "pos1", Protocol: "kcp"}, {Protocol: "kcp"}}},
+			"",
+			&Config{InboundConfigs: []InboundDetourConfig{{Tag: "pos1", Protocol: "kcp"}, {Protocol: "kcp"}}}},
 		{"replace/notag-append",
 			&Config{InboundConfigs: []InboundDetourConfig{{}, {Protocol: "vmess"}}},
 			&Config{InboundConfigs: []InboundDetourConfig{{Tag: "pos1", Protocol: "kcp"}}},
@@ -431,19 +476,620 @@ func TestConfig_Override(t *testing.T) {
 			&Config{OutboundConfigs: []OutboundDetourConfig{{Tag: "pos0"}, {Protocol: "vmess", Tag: "pos1"}}},
 			&Config{OutboundConfigs: []OutboundDetourConfig{{Tag: "pos1", Protocol: "kcp"}, {Tag: "pos2", Protocol: "kcp"}}},
 			"config.json",
-			&Config{OutboundConfigs: []OutboundDetourConfig{{Tag: "pos1", Protocol: "kcp"}, {Tag: "pos2", Protocol: "kcp"}}}},
+			&Config{OutboundConfigs: []OutboundDetourConfig{{Tag: "pos2", Protocol: "kcp"}, {Tag: "pos0"}, {Tag: "pos1", Protocol: "kcp"}}}},
 		{"replace/outbounds-append",
 			&Config{OutboundConfigs: []OutboundDetourConfig{{Tag: "pos0"}, {Protocol: "vmess", Tag: "pos1"}}},
 			&Config{OutboundConfigs: []OutboundDetourConfig{{Tag: "pos2", Protocol: "kcp"}}},
 			"config_tail.json",
 			&Config{OutboundConfigs: []OutboundDetourConfig{{Tag: "pos0"}, {Protocol: "vmess", Tag: "pos1"}, {Tag: "pos2", Protocol: "kcp"}}}},
+		{"merge/routing",
+			&Config{RouterConfig: &RouterConfig{
+				RuleList: []json.RawMessage{
+					json.RawMessage(`{"ruleTag":"cn","type":"field","ip":["geoip:cn"],"outboundTag":"direct"}`),
+				},
+				Balancers: []*BalancingRule{{Tag: "b", Strategy: "random"}},
+			}},
+			&Config{RouterConfig: &RouterConfig{
+				RuleList: []json.RawMessage{
+					json.RawMessage(`{"ruleTag":"cn","outboundTag":"block"}`),
+					json.RawMessage(`{"ruleTag":"ads","type":"field","domain":["geosite:ads"],"outboundTag":"block"}`),
+				},
+				Balancers: []*BalancingRule{{Tag: "b", Strategy: "failover"}},
+			}},
+			"",
+			&Config{RouterConfig: &RouterConfig{
+				RuleList: []json.RawMessage{
+					json.RawMessage(`{"ip":["geoip:cn"],"outboundTag":"block","ruleTag":"cn","type":"field"}`),
+					json.RawMessage(`{"ruleTag":"ads","type":"field","domain":["geosite:ads"],"outboundTag":"block"}`),
+				},
+				Balancers: []*BalancingRule{{Tag: "b", Strategy: "failover"}},
+			}}},
+		{"replace/routing-untagged",
+			&Config{RouterConfig: &RouterConfig{
+				RuleList: []json.RawMessage{json.RawMessage(`{"ruleTag":"cn","outboundTag":"direct"}`)},
+			}},
+			&Config{RouterConfig: &RouterConfig{
+				RuleList: []json.RawMessage{json.RawMessage(`{"outboundTag":"block"}`)},
+			}},
+			"",
+			&Config{RouterConfig: &RouterConfig{
+				RuleList: []json.RawMessage{json.RawMessage(`{"outboundTag":"block"}`)},
+			}}},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			tt.orig.Override(tt.over, tt.fn)
-			if r := cmp.Diff(tt.orig, tt.want); r != "" {
+			// The sources of the configs are bookkeeping of the validation.
+			ignoreSources := cmpopts.IgnoreUnexported(RouterConfig{}, BalancingRule{}, InboundDetourConfig{}, OutboundDetourConfig{})
+			if r := cmp.Diff(tt.orig, tt.want, ignoreSources); r != "" {
 				t.Error(r)
 			}
 		})
 	}
 }
+
+func TestSniffingConfig(t *testing.T) {
+	runMultiTestCase(t, []TestCase{
+		{
+			Input: `{
+				"enabled": true,
+				"destOverride": ["http", "tls"],
+				"timeout": 50,
+				"recordRequest": true
+			}`,
+			Parser: func(s string) (proto.Message, error) {
+				config := new(SniffingConfig)
+				if err := json.Unmarshal([]byte(s), config); err != nil {
+					return nil, err
+				}
+				return config.Build()
+			},
+			Output: &proxyman.SniffingConfig{
+				Enabled:             true,
+				DestinationOverride: []string{"http", "tls"},
+				Timeout:             50,
+				RecordRequest:       true,
+			},
+		},
+	})
+}
+
+func TestConnectionLimitConfig(t *testing.T) {
+	parser := func(s string) (proto.Message, error) {
+		config := new(ConnectionLimitConfig)
+		if err := json.Unmarshal([]byte(s), config); err != nil {
+			return nil, err
+		}
+		return config.Build()
+	}
+
+	runMultiTestCase(t, []TestCase{
+		{
+			Input: `{
+				"rate": 5,
+				"burst": 20,
+				"banThreshold": 10,
+				"banWindow": 30,
+				"banDuration": 3600,
+				"overrides": [{
+					"networks": ["10.0.0.0/8", "192.168.1.1"],
+					"rate": 100,
+					"banThreshold": 1000
+				}]
+			}`,
+			Parser: parser,
+			Output: &proxyman.ConnectionLimitConfig{
+				Rate:         5,
+				Burst:        20,
+				BanThreshold: 10,
+				BanWindow:    30,
+				BanDuration:  3600,
+				Override: []*proxyman.ConnectionLimitConfig_Override{
+					{
+						Cidr:         []string{"10.0.0.0/8", "192.168.1.1/32"},
+						Rate:         100,
+						BanThreshold: 1000,
+					},
+				},
+			},
+		},
+	})
+
+	for _, input := range []string{
+		`{"overrides": [{"rate": 100}]}`,
+		`{"overrides": [{"networks": ["10.0.0.0/33"]}]}`,
+	} {
+		if _, err := parser(input); err == nil {
+			t.Error("expected error for ", input)
+		}
+	}
+}
+
+func TestPreconnectConfig(t *testing.T) {
+	runMultiTestCase(t, []TestCase{
+		{
+			Input: `{
+				"size": 2,
+				"maxIdle": 60,
+				"muxOnly": true
+			}`,
+			Parser: func(s string) (proto.Message, error) {
+				config := new(PreconnectConfig)
+				if err := json.Unmarshal([]byte(s), config); err != nil {
+					return nil, err
+				}
+				return config.Build()
+			},
+			Output: &proxyman.PreconnectConfig{
+				Size:    2,
+				MaxIdle: 60,
+				MuxOnly: true,
+			},
+		},
+	})
+
+	for _, input := range []string{
+		`{"protocol": "freedom", "preconnect": {"size": 2}}`,
+		`{"protocol": "socks", "settings": {"servers": [{"address": "127.0.0.1", "port": 1080}]}, "preconnect": {"size": 2, "muxOnly": true}}`,
+		`{"protocol": "socks", "settings": {"servers": [{"address": "127.0.0.1", "port": 1080}]}, "preconnect": {"size": 0}}`,
+	} {
+		config := new(OutboundDetourConfig)
+		common.Must(json.Unmarshal([]byte(input), config))
+		if _, err := config.Build(); err == nil {
+			t.Error("expected error for ", input)
+		}
+	}
+}
+
+func TestInboundDetourDualStack(t *testing.T) {
+	config := new(InboundDetourConfig)
+	common.Must(json.Unmarshal([]byte(`{
+		"protocol": "dokodemo-door",
+		"listen": "any",
+		"port": 1080,
+		"allowPartialListen": true,
+		"settings": {
+			"address": "127.0.0.1",
+			"port": 80
+		}
+	}`), config))
+	handler, err := config.Build()
+	common.Must(err)
+	settings, err := handler.ReceiverSettings.GetInstance()
+	common.Must(err)
+	receiver := settings.(*proxyman.ReceiverConfig)
+	if receiver.Listen != nil {
+		t.Error("unexpected listen address: ", receiver.Listen)
+	}
+	if receiver.DualStack == nil || !receiver.DualStack.AllowPartial {
+		t.Error("dual stack: ", receiver.DualStack)
+	}
+
+	config = new(InboundDetourConfig)
+	common.Must(json.Unmarshal([]byte(`{
+		"protocol": "dokodemo-door",
+		"listen": "any",
+		"settings": {}
+	}`), config))
+	if _, err := config.Build(); err == nil {
+		t.Error("expected error without port")
+	}
+}
+
+func TestInboundDetourInheritedSocket(t *testing.T) {
+	config := new(InboundDetourConfig)
+	common.Must(json.Unmarshal([]byte(`{
+		"protocol": "dokodemo-door",
+		"listen": "fd:https",
+		"streamSettings": {
+			"sockopt": {"acceptProxyProtocol": true}
+		},
+		"settings": {
+			"address": "127.0.0.1",
+			"port": 80
+		}
+	}`), config))
+	handler, err := config.Build()
+	common.Must(err)
+	settings, err := handler.ReceiverSettings.GetInstance()
+	common.Must(err)
+	receiver := settings.(*proxyman.ReceiverConfig)
+	if receiver.Listen != nil || receiver.PortRange != nil {
+		t.Error("unexpected listen address: ", receiver.Listen, " ", receiver.PortRange)
+	}
+	sockopt := receiver.StreamSettings.SocketSettings
+	if sockopt.InheritedSocket != "https" || !sockopt.AcceptProxyProtocol {
+		t.Error("unexpected socket settings: ", sockopt)
+	}
+
+	for _, input := range []string{
+		`{"protocol": "dokodemo-door", "listen": "fd:3", "port": 443, "settings": {}}`,
+		`{"protocol": "dokodemo-door", "listen": "fd:", "settings": {}}`,
+	} {
+		config := new(InboundDetourConfig)
+		common.Must(json.Unmarshal([]byte(input), config))
+		if _, err := config.Build(); err == nil {
+			t.Error("expect error for ", input)
+		}
+	}
+}
+
+func TestInboundDetourListenerSharding(t *testing.T) {
+	config := new(InboundDetourConfig)
+	common.Must(json.Unmarshal([]byte(`{
+		"protocol": "dokodemo-door",
+		"port": 1080,
+		"listenerSharding": {"listeners": 4},
+		"settings": {
+			"address": "127.0.0.1",
+			"port": 80
+		}
+	}`), config))
+	handler, err := config.Build()
+	common.Must(err)
+	settings, err := handler.ReceiverSettings.GetInstance()
+	common.Must(err)
+	receiver := settings.(*proxyman.ReceiverConfig)
+	if receiver.ListenerSharding.GetListeners() != 4 {
+		t.Error("listener sharding: ", receiver.ListenerSharding)
+	}
+
+	config = new(InboundDetourConfig)
+	common.Must(json.Unmarshal([]byte(`{
+		"protocol": "dokodemo-door",
+		"port": 1080,
+		"listenerSharding": {},
+		"streamSettings": {
+			"sockopt": {"reusePort": false}
+		},
+		"settings": {}
+	}`), config))
+	if _, err := config.Build(); err == nil {
+		t.Error("expected error without reusePort")
+	}
+}
+
+func TestUDPSessionConfig(t *testing.T) {
+	parser := func(s string) (proto.Message, error) {
+		config := new(UDPSessionConfig)
+		if err := json.Unmarshal([]byte(s), config); err != nil {
+			return nil, err
+		}
+		return config.Build()
+	}
+
+	runMultiTestCase(t, []TestCase{
+		{
+			Input: `{
+				"maxSessions": 1024,
+				"idleTimeout": 30,
+				"portTimeouts": {
+					"53": 2,
+					"123": 0
+				}
+			}`,
+			Parser: parser,
+			Output: &proxyman.UDPSessionConfig{
+				MaxSessions: 1024,
+				IdleTimeout: 30,
+				PortTimeout: map[uint32]uint32{53: 2, 123: 0},
+			},
+		},
+	})
+}
+
+func TestBindRetryConfig(t *testing.T) {
+	parser := func(s string) (proto.Message, error) {
+		config := new(BindRetryConfig)
+		if err := json.Unmarshal([]byte(s), config); err != nil {
+			return nil, err
+		}
+		return config.Build()
+	}
+
+	runMultiTestCase(t, []TestCase{
+		{
+			Input: `{
+				"attempts": 5,
+				"backoff": 200,
+				"maxBackoff": 2000
+			}`,
+			Parser: parser,
+			Output: &proxyman.BindRetryConfig{
+				Attempts:   5,
+				Backoff:    200,
+				MaxBackoff: 2000,
+			},
+		},
+	})
+
+	if _, err := parser(`{"attempts": 5, "backoff": 3000, "maxBackoff": 2000}`); err == nil {
+		t.Error("expected error for backoff larger than maxBackoff")
+	}
+}
+
+func TestOutboundSendThrough(t *testing.T) {
+	parser := func(s string) (proto.Message, error) {
+		config := new(OutboundDetourConfig)
+		if err := json.Unmarshal([]byte(s), config); err != nil {
+			return nil, err
+		}
+		handler, err := config.Build()
+		if err != nil {
+			return nil, err
+		}
+		return handler.SenderSettings.GetInstance()
+	}
+
+	runMultiTestCase(t, []TestCase{
+		{
+			Input:  `{"protocol": "freedom", "sendThrough": "192.0.2.1"}`,
+			Parser: parser,
+			Output: &proxyman.SenderConfig{
+				Via: net.NewIPOrDomain(net.ParseAddress("192.0.2.1")),
+			},
+		},
+		{
+			Input: `{
+				"protocol": "freedom",
+				"sendThrough": ["203.0.113.8/29", "192.0.2.1"],
+				"sendThroughStrategy": "random"
+			}`,
+			Parser: parser,
+			Output: &proxyman.SenderConfig{
+				ViaPool: &proxyman.ViaPool{
+					Cidr:     []string{"203.0.113.8/29", "192.0.2.1"},
+					Strategy: proxyman.ViaPool_Random,
+				},
+			},
+		},
+		{
+			Input: `{
+				"protocol": "freedom",
+				"udpMaxPacketSize": 1400,
+				"streamSettings": {"udpMaxPacketSize": 1200}
+			}`,
+			Parser: parser,
+			Output: &proxyman.SenderConfig{
+				StreamSettings: &internet.StreamConfig{
+					ProtocolName:     "tcp",
+					UdpMaxPacketSize: 1200,
+				},
+				UdpMaxPacketSize: 1400,
+			},
+		},
+	})
+
+	for _, input := range []string{
+		`{"protocol": "freedom", "sendThrough": "example.com"}`,
+		`{"protocol": "freedom", "sendThrough": "203.0.113.8/33"}`,
+		`{"protocol": "freedom", "sendThrough": ["192.0.2.1", "192.0.2.2"], "sendThroughStrategy": "fastest"}`,
+	} {
+		if _, err := parser(input); err == nil {
+			t.Error("expected error for ", input)
+		}
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	validate := func(s string) ([]string, error) {
+		config := new(Config)
+		common.Must(json.Unmarshal([]byte(s), config))
+		config.MarkSource("test.json")
+		return config.Validate()
+	}
+
+	warnings, err := validate(`{
+		"inbounds": [{
+			"port": 1080,
+			"protocol": "socks",
+			"settings": {"udp": true},
+			"sniffing": {"destOverride": ["http"]}
+		}, {
+			"port": "1000-2000",
+			"protocol": "dokodemo-door",
+			"settings": {"network": "udp"}
+		}, {
+			"listen": "127.0.0.1",
+			"port": 1080,
+			"protocol": "http"
+		}],
+		"outbounds": [{"tag": "direct", "protocol": "freedom"}],
+		"routing": {
+			"balancers": [{"tag": "proxies", "selector": ["proxy"]}],
+			"rules": [{"type": "field", "port": 53, "outboundTag": "direct"}]
+		}
+	}`)
+	common.Must(err)
+	expected := []string{
+		`test.json: routing.balancers[0].selector: selector of balancer "proxies" matches no outbound`,
+		`test.json: inbounds[0].sniffing.destOverride: ignored, as sniffing is not enabled`,
+		`test.json: inbounds[1].port: listening on 0.0.0.0 udp port 1000 as well as test.json: inbounds[0]`,
+	}
+	if r := cmp.Diff(warnings, expected); r != "" {
+		t.Error(r)
+	}
+
+	_, err = validate(`{
+		"outbounds": [{"tag": "direct", "protocol": "freedom"}],
+		"routing": {
+			"rules": [
+				{"type": "field", "port": 53, "outboundTag": "direct"},
+				{"type": "field", "port": 80, "outboundTag": "proxy"}
+			]
+		}
+	}`)
+	if err == nil || !strings.Contains(err.Error(), `test.json: routing.rules[1].outboundTag: outbound "proxy" not found`) {
+		t.Error("expect error of missing outbound, but got ", err)
+	}
+}
+
+func TestInboundDetourSourceAccess(t *testing.T) {
+	config := new(InboundDetourConfig)
+	common.Must(json.Unmarshal([]byte(`{
+		"protocol": "socks",
+		"port": 1080,
+		"allowedSources": ["192.168.0.0/16"],
+		"deniedSources": ["192.168.1.0/24"],
+		"logRejectedSources": true
+	}`), config))
+	handler, err := config.Build()
+	common.Must(err)
+	settings, err := handler.ReceiverSettings.GetInstance()
+	common.Must(err)
+	expected := &proxyman.SourceAccessConfig{
+		Allowed: []*router.GeoIP{
+			{Cidr: []*router.CIDR{{Ip: []byte{192, 168, 0, 0}, Prefix: 16}}},
+		},
+		Denied: []*router.GeoIP{
+			{Cidr: []*router.CIDR{{Ip: []byte{192, 168, 1, 0}, Prefix: 24}}},
+		},
+		LogRejected: true,
+	}
+	if r := cmp.Diff(settings.(*proxyman.ReceiverConfig).SourceAccess, expected, cmp.Comparer(proto.Equal)); r != "" {
+		t.Error(r)
+	}
+
+	config = new(InboundDetourConfig)
+	common.Must(json.Unmarshal([]byte(`{
+		"protocol": "socks",
+		"port": 1080,
+		"allowedSources": ["192.168.0.0/33"]
+	}`), config))
+	if _, err := config.Build(); err == nil {
+		t.Error("expected error of invalid source")
+	}
+}
+
+func TestQuotaRequiresStats(t *testing.T) {
+	build := func(s string) error {
+		config := new(Config)
+		common.Must(json.Unmarshal([]byte(s), config))
+		_, err := config.Build()
+		return err
+	}
+
+	inbounds := `"inbounds": [{
+		"port": 443,
+		"protocol": "trojan",
+		"settings": {"clients": [{"password": "secret", "email": "love@v2fly.org", "quota": 1073741824}]}
+	}]`
+	if err := build(`{` + inbounds + `}`); err == nil || !strings.Contains(err.Error(), "love@v2fly.org") {
+		t.Error("expected error of quota without stats, but got ", err)
+	}
+	if err := build(`{` + inbounds + `, "stats": {}}`); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDisabledFeatures(t *testing.T) {
+	config := new(Config)
+	common.Must(json.Unmarshal([]byte(`{
+		"outbounds": [{"protocol": "freedom"}],
+		"disabledFeatures": ["quic", "transport:mkcp"]
+	}`), config))
+	config.Override(&Config{DisabledFeatures: []string{"dns"}}, "override.json")
+
+	pbConfig, err := config.Build()
+	common.Must(err)
+	if r := cmp.Diff(pbConfig.DisabledFeatures, []string{"dns"}); r != "" {
+		t.Error(r)
+	}
+}
+
+func TestConfigExternalFiles(t *testing.T) {
+	config := new(Config)
+	common.Must(json.Unmarshal([]byte(`{
+		"inbounds": [{
+			"port": 443,
+			"protocol": "vmess",
+			"streamSettings": {
+				"security": "tls",
+				"tlsSettings": {
+					"certificates": [{"certificateFile": "/nonexistent/v2ray.crt", "keyFile": "/nonexistent/v2ray.key"}]
+				}
+			}
+		}],
+		"outbounds": [{"tag": "direct", "protocol": "freedom"}],
+		"routing": {
+			"rules": [
+				{"type": "field", "domain": ["ext:missing.dat:test", "ext:inline.dat:test"], "outboundTag": "direct"},
+				{"type": "field", "ip": ["ext-ip:missing.dat:test"], "outboundTag": "direct"}
+			]
+		}
+	}`), config))
+	config.MarkSource("test.json")
+
+	_, err := config.Validate()
+	if err == nil {
+		t.Fatal("expected error of missing files")
+	}
+	for _, expected := range []string{
+		"test.json: inbounds[0].streamSettings.tlsSettings.certificates[0].certificateFile: failed to read file /nonexistent/v2ray.crt",
+		"test.json: inbounds[0].streamSettings.tlsSettings.certificates[0].keyFile: failed to read file /nonexistent/v2ray.key",
+		"test.json: routing.rules[0].domain: failed to read file " + platform.GetAssetLocation("missing.dat"),
+		"test.json: routing.rules[0].domain: failed to read file " + platform.GetAssetLocation("inline.dat"),
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Error("expected error ", expected, ", but got ", err)
+		}
+	}
+	if strings.Count(err.Error(), "failed to read file "+platform.GetAssetLocation("missing.dat")) != 1 {
+		t.Error("expected each missing file to be reported once, but got ", err)
+	}
+}
+
+func TestConfigInlineGeodata(t *testing.T) {
+	geosite, err := proto.Marshal(&router.GeoSiteList{
+		Entry: []*router.GeoSite{{
+			CountryCode: "TEST",
+			Domain:      []*router.Domain{{Type: router.Domain_Full, Value: "inline.v2fly.org"}},
+		}},
+	})
+	common.Must(err)
+	geodata, err := json.Marshal(map[string][]byte{"inline.dat": geosite})
+	common.Must(err)
+
+	config := new(Config)
+	common.Must(json.Unmarshal([]byte(`{
+		"outbounds": [{"tag": "direct", "protocol": "freedom"}],
+		"routing": {
+			"rules": [{"type": "field", "domain": ["ext:inline.dat:test"], "outboundTag": "direct"}]
+		},
+		"geodata": `+string(geodata)+`
+	}`), config))
+
+	pbConfig, err := config.Build()
+	common.Must(err)
+	for _, app := range pbConfig.App {
+		instance, err := app.GetInstance()
+		common.Must(err)
+		routerConfig, ok := instance.(*router.Config)
+		if !ok {
+			continue
+		}
+		expected := []*router.Domain{{Type: router.Domain_Full, Value: "inline.v2fly.org"}}
+		if r := cmp.Diff(routerConfig.Rule[0].Domain, expected, cmp.Comparer(proto.Equal)); r != "" {
+			t.Error(r)
+		}
+		return
+	}
+	t.Error("router config not found")
+}
+
+func TestObservabilityConfig(t *testing.T) {
+	config := new(Config)
+	common.Must(json.Unmarshal([]byte(`{
+		"observability": {"listen": "127.0.0.1:8080"},
+		"outbounds": [{"protocol": "freedom"}]
+	}`), config))
+
+	pbConfig, err := config.Build()
+	common.Must(err)
+	// The health check server is started right after the logger.
+	instance, err := pbConfig.App[1].GetInstance()
+	common.Must(err)
+	if r := cmp.Diff(instance, &health.Config{Listen: "127.0.0.1:8080"}, cmp.Comparer(proto.Equal)); r != "" {
+		t.Error(r)
+	}
+}
@@ -0,0 +1,345 @@
+package conf
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"strconv"
+	"strings"
+
+	"v2ray.com/core/common/net"
+	"v2ray.com/core/common/serial"
+)
+
+// MarkSource records file as the source of the inbounds, outbounds, routing rules and balancers of c
+// that have none yet, so that issues found in them by Validate name the file.
+func (c *Config) MarkSource(file string) {
+	if file == "" {
+		return
+	}
+	markInbound := func(ib *InboundDetourConfig) {
+		if ib.source == "" {
+			ib.source = file
+		}
+	}
+	markOutbound := func(ob *OutboundDetourConfig) {
+		if ob.source == "" {
+			ob.source = file
+		}
+	}
+	if c.InboundConfig != nil {
+		markInbound(c.InboundConfig)
+	}
+	for i := range c.InboundDetours {
+		markInbound(&c.InboundDetours[i])
+	}
+	for i := range c.InboundConfigs {
+		markInbound(&c.InboundConfigs[i])
+	}
+	if c.OutboundConfig != nil {
+		markOutbound(c.OutboundConfig)
+	}
+	for i := range c.OutboundDetours {
+		markOutbound(&c.OutboundDetours[i])
+	}
+	for i := range c.OutboundConfigs {
+		markOutbound(&c.OutboundConfigs[i])
+	}
+	if r := c.RouterConfig; r != nil {
+		for len(r.ruleSources) < len(r.RuleList) {
+			r.ruleSources = append(r.ruleSources, file)
+		}
+		for _, b := range r.Balancers {
+			if b != nil && b.source == "" {
+				b.source = file
+			}
+		}
+	}
+}
+
+// configLocation is where an issue of a config is, by the file and the path of the field in it.
+type configLocation struct {
+	file string
+	path string
+}
+
+func (l configLocation) field(name string) configLocation {
+	return configLocation{file: l.file, path: l.path + "." + name}
+}
+
+func (l configLocation) String() string {
+	if l.file == "" {
+		return l.path
+	}
+	return l.file + ": " + l.path
+}
+
+type locatedInbound struct {
+	configLocation
+	*InboundDetourConfig
+}
+
+type locatedOutbound struct {
+	configLocation
+	*OutboundDetourConfig
+}
+
+func (c *Config) locatedInbounds() []locatedInbound {
+	var inbounds []locatedInbound
+	if c.InboundConfig != nil {
+		inbounds = append(inbounds, locatedInbound{configLocation{c.InboundConfig.source, "inbound"}, c.InboundConfig})
+	}
+	for i := range c.InboundDetours {
+		ib := &c.InboundDetours[i]
+		inbounds = append(inbounds, locatedInbound{configLocation{ib.source, "inboundDetour[" + strconv.Itoa(i) + "]"}, ib})
+	}
+	for i := range c.InboundConfigs {
+		ib := &c.InboundConfigs[i]
+		inbounds = append(inbounds, locatedInbound{configLocation{ib.source, "inbounds[" + strconv.Itoa(i) + "]"}, ib})
+	}
+	return inbounds
+}
+
+func (c *Config) locatedOutbounds() []locatedOutbound {
+	var outbounds []locatedOutbound
+	if c.OutboundConfig != nil {
+		outbounds = append(outbounds, locatedOutbound{configLocation{c.OutboundConfig.source, "outbound"}, c.OutboundConfig})
+	}
+	for i := range c.OutboundDetours {
+		ob := &c.OutboundDetours[i]
+		outbounds = append(outbounds, locatedOutbound{configLocation{ob.source, "outboundDetour[" + strconv.Itoa(i) + "]"}, ob})
+	}
+	for i := range c.OutboundConfigs {
+		ob := &c.OutboundConfigs[i]
+		outbounds = append(outbounds, locatedOutbound{configLocation{ob.source, "outbounds[" + strconv.Itoa(i) + "]"}, ob})
+	}
+	return outbounds
+}
+
+// configValidator collects the issues of a config.
+type configValidator struct {
+	warnings []string
+	errors   []string
+}
+
+func (v *configValidator) warn(loc configLocation, msg ...interface{}) {
+	v.warnings = append(v.warnings, loc.String()+": "+serial.Concat(msg...))
+}
+
+func (v *configValidator) fail(loc configLocation, msg ...interface{}) {
+	v.errors = append(v.errors, loc.String()+": "+serial.Concat(msg...))
+}
+
+// Validate checks c for mistakes that would otherwise be silently ignored. It returns warnings for
+// suspicious settings, and an error for routing to outbound or balancer tags that don't exist, or
+// for files that can't be read.
+func (c *Config) Validate() ([]string, error) {
+	v := new(configValidator)
+	inbounds := c.locatedInbounds()
+	outbounds := c.locatedOutbounds()
+
+	v.checkRouting(c, outbounds)
+	for _, ib := range inbounds {
+		v.checkSniffing(ib)
+		v.checkServerName(ib)
+	}
+	v.checkListenCollisions(inbounds)
+	v.checkExternalFiles(c)
+
+	if len(v.errors) > 0 {
+		return v.warnings, newError("invalid config: ", strings.Join(v.errors, "; "))
+	}
+	return v.warnings, nil
+}
+
+func (v *configValidator) checkRouting(c *Config, outbounds []locatedOutbound) {
+	outboundTags := make(map[string]bool)
+	for _, ob := range outbounds {
+		if ob.Tag != "" {
+			outboundTags[ob.Tag] = true
+		}
+	}
+	// Outbounds of the API and reverse proxy portals are created by the apps.
+	if c.API != nil && c.API.Tag != "" {
+		outboundTags[c.API.Tag] = true
+	}
+	if c.Reverse != nil {
+		for _, portal := range c.Reverse.Portals {
+			outboundTags[portal.Tag] = true
+		}
+	}
+
+	r := c.RouterConfig
+	if r == nil {
+		return
+	}
+
+	balancerTags := make(map[string]bool)
+	for i, b := range r.Balancers {
+		if b == nil {
+			continue
+		}
+		balancerTags[b.Tag] = true
+		loc := configLocation{b.source, "routing.balancers[" + strconv.Itoa(i) + "].selector"}
+		matched := false
+		for tag := range outboundTags {
+			for _, selector := range b.Selectors {
+				if strings.HasPrefix(tag, selector) {
+					matched = true
+				}
+			}
+		}
+		if !matched {
+			v.warn(loc, "selector of balancer \"", b.Tag, "\" matches no outbound")
+		}
+	}
+
+	checkRule := func(loc configLocation, rawRule json.RawMessage) {
+		var rule RouterRule
+		if err := json.Unmarshal(rawRule, &rule); err != nil {
+			// Malformed rules fail to build.
+			return
+		}
+		if rule.OutboundTag != "" && !outboundTags[rule.OutboundTag] {
+			v.fail(loc.field("outboundTag"), "outbound \"", rule.OutboundTag, "\" not found")
+		}
+		if rule.OutboundTag == "" && rule.BalancerTag != "" && !balancerTags[rule.BalancerTag] {
+			v.fail(loc.field("balancerTag"), "balancer \"", rule.BalancerTag, "\" not found")
+		}
+	}
+	if r.Settings != nil {
+		for i, rule := range r.Settings.RuleList {
+			checkRule(configLocation{"", "routing.settings.rules[" + strconv.Itoa(i) + "]"}, rule)
+		}
+	}
+	for i, rule := range r.RuleList {
+		source := ""
+		if i < len(r.ruleSources) {
+			source = r.ruleSources[i]
+		}
+		checkRule(configLocation{source, "routing.rules[" + strconv.Itoa(i) + "]"}, rule)
+	}
+}
+
+func (v *configValidator) checkSniffing(ib locatedInbound) {
+	s := ib.SniffingConfig
+	if s != nil && !s.Enabled && s.DestOverride != nil && len(*s.DestOverride) > 0 {
+		v.warn(ib.field("sniffing.destOverride"), "ignored, as sniffing is not enabled")
+	}
+	if s != nil && !s.Enabled && s.RecordRequest {
+		v.warn(ib.field("sniffing.recordRequest"), "ignored, as sniffing is not enabled")
+	}
+}
+
+// checkServerName warns if no certificate of the TLS settings of the inbound covers its server name.
+func (v *configValidator) checkServerName(ib locatedInbound) {
+	if ib.StreamSetting == nil || ib.StreamSetting.TLSSettings == nil {
+		return
+	}
+	tlsConfig := ib.StreamSetting.TLSSettings
+	if tlsConfig.ServerName == "" || len(tlsConfig.Certs) == 0 {
+		return
+	}
+	checked := false
+	for _, certConfig := range tlsConfig.Certs {
+		if certConfig == nil {
+			continue
+		}
+		if usage := strings.ToLower(certConfig.Usage); usage != "" && usage != "encipherment" {
+			continue
+		}
+		certPEM, err := readFileOrString(certConfig.CertFile, certConfig.CertStr)
+		if err != nil {
+			// Missing certificates fail to build.
+			return
+		}
+		block, _ := pem.Decode(certPEM)
+		if block == nil {
+			return
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return
+		}
+		if cert.VerifyHostname(tlsConfig.ServerName) == nil {
+			return
+		}
+		checked = true
+	}
+	if checked {
+		v.warn(ib.field("streamSettings.tlsSettings.serverName"), "\"", tlsConfig.ServerName, "\" is not covered by any certificate")
+	}
+}
+
+// listenNetworks returns the networks the inbound listens on, as far as the config tells.
+func listenNetworks(ib *InboundDetourConfig) []net.Network {
+	if ib.StreamSetting != nil && ib.StreamSetting.Network != nil {
+		switch strings.ToLower(string(*ib.StreamSetting.Network)) {
+		case "kcp", "mkcp", "quic":
+			return []net.Network{net.Network_UDP}
+		case "ds", "domainsocket":
+			return nil
+		}
+	}
+	if ib.Settings == nil {
+		return []net.Network{net.Network_TCP}
+	}
+	var settings struct {
+		Network *NetworkList `json:"network"`
+		UDP     bool         `json:"udp"`
+	}
+	if err := json.Unmarshal(*ib.Settings, &settings); err != nil {
+		return []net.Network{net.Network_TCP}
+	}
+	if settings.Network != nil && len(*settings.Network) > 0 {
+		return settings.Network.Build()
+	}
+	if settings.UDP {
+		return []net.Network{net.Network_TCP, net.Network_UDP}
+	}
+	return []net.Network{net.Network_TCP}
+}
+
+// checkListenCollisions warns about inbounds listening on the same address, network and port, which
+// either fail to start or share the connections, as listeners reuse ports by default.
+func (v *configValidator) checkListenCollisions(inbounds []locatedInbound) {
+	type listen struct {
+		loc      configLocation
+		address  string
+		networks []net.Network
+		from, to uint32
+	}
+	var listens []listen
+	for _, ib := range inbounds {
+		if ib.PortRange == nil || ib.PortRange.From == 0 {
+			continue
+		}
+		address := net.AnyIP.String()
+		if ib.ListenOn != nil {
+			if ib.ListenOn.Family().IsDomain() {
+				continue
+			}
+			address = ib.ListenOn.String()
+		}
+		listens = append(listens, listen{
+			loc:      ib.configLocation,
+			address:  address,
+			networks: listenNetworks(ib.InboundDetourConfig),
+			from:     ib.PortRange.From,
+			to:       ib.PortRange.To,
+		})
+	}
+	for i, a := range listens {
+		for _, b := range listens[:i] {
+			if a.address != b.address || a.from > b.to || b.from > a.to {
+				continue
+			}
+			for _, n := range a.networks {
+				if net.HasNetwork(b.networks, n) {
+					v.warn(a.loc.field("port"), "listening on ", a.address, " ", n.SystemString(), " port ", a.from, " as well as ", b.loc)
+					break
+				}
+			}
+		}
+	}
+}
@@ -77,12 +77,21 @@ type VMessInboundConfig struct {
 	Defaults     *VMessDefaultConfig `json:"default"`
 	DetourConfig *VMessDetourConfig  `json:"detour"`
 	SecureOnly   bool                `json:"disableInsecureEncryption"`
+	// SecureEncryptionOnly rejects both insecure ciphers and legacy headers, so it implies DisableLegacyHeader.
+	SecureEncryptionOnly bool `json:"secureEncryptionOnly"`
+
+	ReplayFilterCapacity uint32 `json:"replayFilterCapacity"`
+	// DisableLegacyHeader only rejects legacy headers, whatever the cipher.
+	DisableLegacyHeader bool `json:"disableLegacyHeader"`
 }
 
 // Build implements Buildable
 func (c *VMessInboundConfig) Build() (proto.Message, error) {
 	config := &inbound.Config{
-		SecureEncryptionOnly: c.SecureOnly,
+		SecureEncryptionOnly: c.SecureOnly || c.SecureEncryptionOnly,
+		ReplayFilterCapacity: c.ReplayFilterCapacity,
+		// disableInsecureEncryption only rejects insecure ciphers, as it always has.
+		DisableLegacyHeader: c.DisableLegacyHeader || c.SecureEncryptionOnly,
 	}
 
 	if c.Defaults != nil {
@@ -116,9 +125,16 @@ type VMessOutboundTarget struct {
 	Address *Address          `json:"address"`
 	Port    uint16            `json:"port"`
 	Users   []json.RawMessage `json:"users"`
+	Weight  *uint32           `json:"weight"`
+	// TimeOffset is the seconds added to the time of this machine in the auth of requests to the server.
+	TimeOffset int64 `json:"timeOffset"`
 }
 type VMessOutboundConfig struct {
-	Receivers []*VMessOutboundTarget `json:"vnext"`
+	Receivers   []*VMessOutboundTarget `json:"vnext"`
+	RoundRobin  bool                   `json:"roundRobin"`
+	MaxFailures uint32                 `json:"maxFailures"`
+	Cooldown    uint32                 `json:"cooldown"`
+	ForceAEAD   bool                   `json:"forceAEAD"`
 }
 
 // Build implements Buildable
@@ -129,6 +145,8 @@ func (c *VMessOutboundConfig) Build() (proto.Message, error) {
 		return nil, newError("0 VMess receiver configured")
 	}
 	serverSpecs := make([]*protocol.ServerEndpoint, len(c.Receivers))
+	weights := make([]uint32, len(c.Receivers))
+	hasWeight := false
 	for idx, rec := range c.Receivers {
 		if len(rec.Users) == 0 {
 			return nil, newError("0 user configured for VMess outbound")
@@ -149,11 +167,29 @@ func (c *VMessOutboundConfig) Build() (proto.Message, error) {
 			if err := json.Unmarshal(rawUser, account); err != nil {
 				return nil, newError("invalid VMess user").Base(err)
 			}
-			user.Account = serial.ToTypedMessage(account.Build())
+			vmessAccount := account.Build()
+			vmessAccount.TimeOffset = rec.TimeOffset
+			user.Account = serial.ToTypedMessage(vmessAccount)
 			spec.User = append(spec.User, user)
 		}
 		serverSpecs[idx] = spec
+
+		weights[idx] = 1
+		if rec.Weight != nil {
+			weights[idx] = *rec.Weight
+			hasWeight = true
+		}
 	}
 	config.Receiver = serverSpecs
+	if hasWeight {
+		if c.RoundRobin {
+			return nil, newError("server weights don't apply to round robin VMess outbound")
+		}
+		config.Weight = weights
+	}
+	config.RoundRobin = c.RoundRobin
+	config.MaxFailures = c.MaxFailures
+	config.Cooldown = c.Cooldown
+	config.ForceAead = c.ForceAEAD
 	return config, nil
 }
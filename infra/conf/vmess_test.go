@@ -59,6 +59,70 @@ func TestVMessOutbound(t *testing.T) {
 				},
 			},
 		},
+		{
+			Input: `{
+				"vnext": [{
+					"address": "127.0.0.1",
+					"port": 80,
+					"weight": 3,
+					"users": [{"id": "e641f5ad-9397-41e3-bf1a-e8740dfed019"}]
+				}, {
+					"address": "127.0.0.1",
+					"port": 81,
+					"timeOffset": -30,
+					"users": [{"id": "e641f5ad-9397-41e3-bf1a-e8740dfed019"}]
+				}],
+				"maxFailures": 5,
+				"cooldown": 30,
+				"forceAEAD": true
+			}`,
+			Parser: loadJSON(creator),
+			Output: &outbound.Config{
+				Receiver: []*protocol.ServerEndpoint{
+					{
+						Address: &net.IPOrDomain{
+							Address: &net.IPOrDomain_Ip{
+								Ip: []byte{127, 0, 0, 1},
+							},
+						},
+						Port: 80,
+						User: []*protocol.User{
+							{
+								Account: serial.ToTypedMessage(&vmess.Account{
+									Id: "e641f5ad-9397-41e3-bf1a-e8740dfed019",
+									SecuritySettings: &protocol.SecurityConfig{
+										Type: protocol.SecurityType_AUTO,
+									},
+								}),
+							},
+						},
+					},
+					{
+						Address: &net.IPOrDomain{
+							Address: &net.IPOrDomain_Ip{
+								Ip: []byte{127, 0, 0, 1},
+							},
+						},
+						Port: 81,
+						User: []*protocol.User{
+							{
+								Account: serial.ToTypedMessage(&vmess.Account{
+									Id: "e641f5ad-9397-41e3-bf1a-e8740dfed019",
+									SecuritySettings: &protocol.SecurityConfig{
+										Type: protocol.SecurityType_AUTO,
+									},
+									TimeOffset: -30,
+								}),
+							},
+						},
+					},
+				},
+				Weight:      []uint32{3, 1},
+				MaxFailures: 5,
+				Cooldown:    30,
+				ForceAead:   true,
+			},
+		},
 	})
 }
 
@@ -76,7 +140,8 @@ func TestVMessInbound(t *testing.T) {
 						"level": 0,
 						"alterId": 16,
 						"email": "love@v2ray.com",
-						"security": "aes-128-gcm"
+						"security": "aes-128-gcm",
+						"quota": 1073741824
 					}
 				],
 				"default": {
@@ -94,6 +159,7 @@ func TestVMessInbound(t *testing.T) {
 					{
 						Level: 0,
 						Email: "love@v2ray.com",
+						Quota: 1073741824,
 						Account: serial.ToTypedMessage(&vmess.Account{
 							Id:      "27848739-7e62-4138-9fd3-098a63964b6b",
 							AlterId: 16,
@@ -113,5 +179,28 @@ func TestVMessInbound(t *testing.T) {
 				SecureEncryptionOnly: true,
 			},
 		},
+		{
+			Input: `{
+				"clients": [],
+				"secureEncryptionOnly": true,
+				"replayFilterCapacity": 10000
+			}`,
+			Parser: loadJSON(creator),
+			Output: &inbound.Config{
+				SecureEncryptionOnly: true,
+				ReplayFilterCapacity: 10000,
+				DisableLegacyHeader:  true,
+			},
+		},
+		{
+			Input: `{
+				"clients": [],
+				"disableLegacyHeader": true
+			}`,
+			Parser: loadJSON(creator),
+			Output: &inbound.Config{
+				DisableLegacyHeader: true,
+			},
+		},
 	})
 }
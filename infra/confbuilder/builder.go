@@ -0,0 +1,116 @@
+// Package confbuilder builds V2Ray configs in Go, as an alternative to JSON for applications that
+// embed V2Ray.
+//
+//	config, err := confbuilder.NewConfig().
+//		AddSocksInbound(1080, confbuilder.SocksUDP(true)).
+//		AddVMessOutbound("example.com", 443, id, confbuilder.VMessWebSocket("/ws"), confbuilder.VMessTLS("")).
+//		AddFreedomOutbound("direct").
+//		WithRouting(confbuilder.RouteDomains("direct", "example.org")).
+//		Build()
+package confbuilder
+
+//go:generate go run v2ray.com/core/common/errors/errorgen
+
+import (
+	"github.com/golang/protobuf/proto"
+
+	"v2ray.com/core"
+	"v2ray.com/core/app/dispatcher"
+	"v2ray.com/core/app/log"
+	"v2ray.com/core/app/proxyman"
+	"v2ray.com/core/app/router"
+	clog "v2ray.com/core/common/log"
+	"v2ray.com/core/common/net"
+	"v2ray.com/core/common/serial"
+)
+
+// Builder builds a core.Config. The first error of its methods is returned by Build.
+type Builder struct {
+	inbounds  []*core.InboundHandlerConfig
+	outbounds []*core.OutboundHandlerConfig
+	rules     []*router.RoutingRule
+	err       error
+}
+
+// NewConfig returns a Builder of an empty config.
+func NewConfig() *Builder {
+	return &Builder{}
+}
+
+// Build returns the config, which has the same apps as the ones built from JSON by default.
+func (b *Builder) Build() (*core.Config, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+
+	config := &core.Config{
+		App: []*serial.TypedMessage{
+			serial.ToTypedMessage(&log.Config{
+				AccessLogType: log.LogType_None,
+				ErrorLogType:  log.LogType_Console,
+				ErrorLogLevel: clog.Severity_Warning,
+			}),
+			serial.ToTypedMessage(&dispatcher.Config{}),
+			serial.ToTypedMessage(&proxyman.InboundConfig{}),
+			serial.ToTypedMessage(&proxyman.OutboundConfig{}),
+		},
+		Inbound:  b.inbounds,
+		Outbound: b.outbounds,
+	}
+	if len(b.rules) > 0 {
+		config.App = append(config.App, serial.ToTypedMessage(&router.Config{
+			Rule: b.rules,
+		}))
+	}
+	return config, nil
+}
+
+// AddInbound adds an inbound with the given proxy settings, listening on the port of the address.
+func (b *Builder) AddInbound(tag string, listen net.Address, port net.Port, proxySettings proto.Message) *Builder {
+	b.inbounds = append(b.inbounds, &core.InboundHandlerConfig{
+		Tag: tag,
+		ReceiverSettings: serial.ToTypedMessage(&proxyman.ReceiverConfig{
+			PortRange: net.SinglePortRange(port),
+			Listen:    net.NewIPOrDomain(listen),
+		}),
+		ProxySettings: serial.ToTypedMessage(proxySettings),
+	})
+	return b
+}
+
+// AddOutbound adds an outbound with the given proxy settings, and the stream settings if not nil.
+func (b *Builder) AddOutbound(tag string, proxySettings proto.Message, streamSettings *StreamSettings) *Builder {
+	senderSettings := new(proxyman.SenderConfig)
+	if streamSettings != nil {
+		settings, err := streamSettings.build()
+		if err != nil {
+			return b.fail(err)
+		}
+		senderSettings.StreamSettings = settings
+	}
+	b.outbounds = append(b.outbounds, &core.OutboundHandlerConfig{
+		Tag:            tag,
+		SenderSettings: serial.ToTypedMessage(senderSettings),
+		ProxySettings:  serial.ToTypedMessage(proxySettings),
+	})
+	return b
+}
+
+// WithRouting adds routing rules, which are matched in order.
+func (b *Builder) WithRouting(rules ...Rule) *Builder {
+	for _, rule := range rules {
+		r, err := rule()
+		if err != nil {
+			return b.fail(newError("invalid routing rule").Base(err))
+		}
+		b.rules = append(b.rules, r)
+	}
+	return b
+}
+
+func (b *Builder) fail(err error) *Builder {
+	if b.err == nil {
+		b.err = err
+	}
+	return b
+}
@@ -0,0 +1,134 @@
+package confbuilder_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	"v2ray.com/core"
+	"v2ray.com/core/common"
+	"v2ray.com/core/common/serial"
+	"v2ray.com/core/infra/conf"
+	. "v2ray.com/core/infra/confbuilder"
+)
+
+func buildJSON(t *testing.T, s string) *core.Config {
+	t.Helper()
+	config := new(conf.Config)
+	common.Must(json.Unmarshal([]byte(s), config))
+	c, err := config.Build()
+	common.Must(err)
+	return c
+}
+
+func assertSameConfig(t *testing.T, actual *core.Config, expected *core.Config) {
+	t.Helper()
+	if !proto.Equal(actual, expected) {
+		a, _ := serial.ToCanonicalJSON(actual)
+		e, _ := serial.ToCanonicalJSON(expected)
+		t.Error("expected config\n", string(e), "\nbut got\n", string(a))
+	}
+}
+
+const userID = "b831381d-6324-4d53-ad4f-8cda48b30811"
+
+func TestBuildInlineConfig(t *testing.T) {
+	config, err := NewConfig().
+		AddSocksInbound(1080, SocksUDP(true), SocksLocalIP("127.0.0.1")).
+		AddVMessOutbound("example.com", 443, userID, VMessAlterID(4), VMessWebSocket("/ws"), VMessTLS("example.com")).
+		Build()
+	common.Must(err)
+
+	assertSameConfig(t, config, buildJSON(t, `{
+		"inbounds": [{
+			"port": 1080,
+			"listen": "127.0.0.1",
+			"protocol": "socks",
+			"settings": {"auth": "noauth", "udp": true, "ip": "127.0.0.1", "userLevel": 0}
+		}],
+		"outbounds": [{
+			"protocol": "vmess",
+			"settings": {
+				"vnext": [{
+					"address": "example.com",
+					"port": 443,
+					"users": [{"id": "`+userID+`", "alterId": 4, "level": 0}]
+				}]
+			},
+			"streamSettings": {
+				"network": "ws",
+				"security": "tls",
+				"wsSettings": {"path": "/ws"},
+				"tlsSettings": {"serverName": "example.com"}
+			}
+		}]
+	}`))
+}
+
+func TestBuildRouting(t *testing.T) {
+	config, err := NewConfig().
+		AddSocksInbound(1080, SocksTag("socks"), SocksListen("0.0.0.0"), SocksAccount("user", "pass")).
+		AddVMessOutbound("1.2.3.4", 10086, userID, VMessTag("proxy"), VMessLevel(1)).
+		AddFreedomOutbound("direct").
+		AddBlackholeOutbound("block").
+		WithRouting(
+			RouteDomains("direct", "example.org", "example.net"),
+			RouteIPs("block", "10.0.0.0/8", "1.1.1.1", "::1"),
+		).
+		Build()
+	common.Must(err)
+
+	assertSameConfig(t, config, buildJSON(t, `{
+		"inbounds": [{
+			"tag": "socks",
+			"port": 1080,
+			"listen": "0.0.0.0",
+			"protocol": "socks",
+			"settings": {"auth": "password", "accounts": [{"user": "user", "pass": "pass"}]}
+		}],
+		"outbounds": [{
+			"tag": "proxy",
+			"protocol": "vmess",
+			"settings": {
+				"vnext": [{
+					"address": "1.2.3.4",
+					"port": 10086,
+					"users": [{"id": "`+userID+`", "level": 1}]
+				}]
+			},
+			"streamSettings": {"network": "tcp"}
+		}, {
+			"tag": "direct",
+			"protocol": "freedom"
+		}, {
+			"tag": "block",
+			"protocol": "blackhole"
+		}],
+		"routing": {
+			"rules": [{
+				"type": "field",
+				"domain": ["domain:example.org", "domain:example.net"],
+				"outboundTag": "direct"
+			}, {
+				"type": "field",
+				"ip": ["10.0.0.0/8", "1.1.1.1", "::1"],
+				"outboundTag": "block"
+			}]
+		}
+	}`))
+}
+
+func TestBuildErrors(t *testing.T) {
+	builders := []*Builder{
+		NewConfig().AddVMessOutbound("example.com", 443, "not-a-uuid"),
+		NewConfig().AddOutbound("", nil, &StreamSettings{Network: "carrier-pigeon"}),
+		NewConfig().WithRouting(RouteIPs("direct", "10.0.0.0/33")),
+		NewConfig().WithRouting(RouteDomains("direct")),
+	}
+	for i, b := range builders {
+		if _, err := b.Build(); err == nil {
+			t.Error("expected error in case ", i, ", but got nil")
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package confbuilder
+
+import (
+	"v2ray.com/core/common/net"
+	"v2ray.com/core/proxy/socks"
+)
+
+type socksInbound struct {
+	tag      string
+	listen   net.Address
+	udp      bool
+	localIP  net.Address
+	level    uint32
+	accounts map[string]string
+}
+
+// SocksOption configures a SOCKS inbound.
+type SocksOption func(*socksInbound)
+
+// SocksTag sets the tag of the inbound.
+func SocksTag(tag string) SocksOption {
+	return func(s *socksInbound) {
+		s.tag = tag
+	}
+}
+
+// SocksListen sets the address to listen on, which is 127.0.0.1 by default.
+func SocksListen(address string) SocksOption {
+	return func(s *socksInbound) {
+		s.listen = net.ParseAddress(address)
+	}
+}
+
+// SocksUDP enables or disables UDP ASSOCIATE.
+func SocksUDP(enabled bool) SocksOption {
+	return func(s *socksInbound) {
+		s.udp = enabled
+	}
+}
+
+// SocksLocalIP sets the address sent to clients for UDP ASSOCIATE.
+func SocksLocalIP(ip string) SocksOption {
+	return func(s *socksInbound) {
+		s.localIP = net.ParseAddress(ip)
+	}
+}
+
+// SocksUserLevel sets the user level of connections.
+func SocksUserLevel(level uint32) SocksOption {
+	return func(s *socksInbound) {
+		s.level = level
+	}
+}
+
+// SocksAccount adds an account, and makes the inbound require authentication.
+func SocksAccount(username, password string) SocksOption {
+	return func(s *socksInbound) {
+		if s.accounts == nil {
+			s.accounts = make(map[string]string)
+		}
+		s.accounts[username] = password
+	}
+}
+
+// AddSocksInbound adds a SOCKS inbound on the port.
+func (b *Builder) AddSocksInbound(port net.Port, opts ...SocksOption) *Builder {
+	s := &socksInbound{
+		listen: net.LocalHostIP,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	config := &socks.ServerConfig{
+		AuthType:   socks.AuthType_NO_AUTH,
+		UdpEnabled: s.udp,
+		UserLevel:  s.level,
+	}
+	if len(s.accounts) > 0 {
+		config.AuthType = socks.AuthType_PASSWORD
+		config.Accounts = s.accounts
+	}
+	if s.localIP != nil {
+		config.Address = net.NewIPOrDomain(s.localIP)
+	}
+	return b.AddInbound(s.tag, s.listen, port, config)
+}
@@ -0,0 +1,115 @@
+package confbuilder
+
+import (
+	"v2ray.com/core/common/net"
+	"v2ray.com/core/common/protocol"
+	"v2ray.com/core/common/serial"
+	"v2ray.com/core/common/uuid"
+	"v2ray.com/core/proxy/blackhole"
+	"v2ray.com/core/proxy/freedom"
+	"v2ray.com/core/proxy/vmess"
+	"v2ray.com/core/proxy/vmess/outbound"
+)
+
+type vmessOutbound struct {
+	tag      string
+	alterID  uint32
+	level    uint32
+	security protocol.SecurityType
+	stream   StreamSettings
+}
+
+// VMessOption configures a VMess outbound.
+type VMessOption func(*vmessOutbound)
+
+// VMessTag sets the tag of the outbound.
+func VMessTag(tag string) VMessOption {
+	return func(v *vmessOutbound) {
+		v.tag = tag
+	}
+}
+
+// VMessAlterID sets the alter ID of the user.
+func VMessAlterID(alterID uint32) VMessOption {
+	return func(v *vmessOutbound) {
+		v.alterID = alterID
+	}
+}
+
+// VMessLevel sets the level of the user.
+func VMessLevel(level uint32) VMessOption {
+	return func(v *vmessOutbound) {
+		v.level = level
+	}
+}
+
+// VMessSecurity sets the encryption method, which is auto by default.
+func VMessSecurity(security protocol.SecurityType) VMessOption {
+	return func(v *vmessOutbound) {
+		v.security = security
+	}
+}
+
+// VMessWebSocket makes the outbound connect over WebSocket with the path.
+func VMessWebSocket(path string) VMessOption {
+	return func(v *vmessOutbound) {
+		v.stream.Network = "websocket"
+		v.stream.Path = path
+	}
+}
+
+// VMessTLS makes the outbound connect over TLS. Empty serverName means the address of the server.
+func VMessTLS(serverName string) VMessOption {
+	return func(v *vmessOutbound) {
+		v.stream.TLS = true
+		v.stream.ServerName = serverName
+	}
+}
+
+// AddVMessOutbound adds a VMess outbound to the server at the address and port, as the user of the id.
+func (b *Builder) AddVMessOutbound(address string, port net.Port, id string, opts ...VMessOption) *Builder {
+	v := &vmessOutbound{
+		security: protocol.SecurityType_AUTO,
+	}
+	for _, opt := range opts {
+		opt(v)
+	}
+
+	if _, err := uuid.ParseString(id); err != nil {
+		return b.fail(newError("invalid VMess user id: ", id).Base(err))
+	}
+
+	config := &outbound.Config{
+		Receiver: []*protocol.ServerEndpoint{
+			{
+				Address: net.NewIPOrDomain(net.ParseAddress(address)),
+				Port:    uint32(port),
+				User: []*protocol.User{
+					{
+						Level: v.level,
+						Account: serial.ToTypedMessage(&vmess.Account{
+							Id:      id,
+							AlterId: v.alterID,
+							SecuritySettings: &protocol.SecurityConfig{
+								Type: v.security,
+							},
+						}),
+					},
+				},
+			},
+		},
+	}
+	return b.AddOutbound(v.tag, config, &v.stream)
+}
+
+// AddFreedomOutbound adds an outbound that connects to destinations directly.
+func (b *Builder) AddFreedomOutbound(tag string) *Builder {
+	return b.AddOutbound(tag, &freedom.Config{
+		DomainStrategy: freedom.Config_AS_IS,
+	}, nil)
+}
+
+// AddBlackholeOutbound adds an outbound that drops all connections.
+func (b *Builder) AddBlackholeOutbound(tag string) *Builder {
+	return b.AddOutbound(tag, &blackhole.Config{}, nil)
+}
@@ -0,0 +1,72 @@
+package confbuilder
+
+import (
+	"v2ray.com/core/app/router"
+	"v2ray.com/core/common/net"
+)
+
+// Rule builds a routing rule.
+type Rule func() (*router.RoutingRule, error)
+
+// RouteDomains routes the domains, and their subdomains, to the outbound of the tag.
+func RouteDomains(outboundTag string, domains ...string) Rule {
+	return func() (*router.RoutingRule, error) {
+		if len(domains) == 0 {
+			return nil, newError("no domain to route to ", outboundTag)
+		}
+		rule := &router.RoutingRule{
+			TargetTag: &router.RoutingRule_Tag{
+				Tag: outboundTag,
+			},
+		}
+		for _, domain := range domains {
+			rule.Domain = append(rule.Domain, &router.Domain{
+				Type:  router.Domain_Domain,
+				Value: domain,
+			})
+		}
+		return rule, nil
+	}
+}
+
+// RouteIPs routes the IPs, in the form of 10.0.0.0/8 or a single IP, to the outbound of the tag.
+func RouteIPs(outboundTag string, cidrs ...string) Rule {
+	return func() (*router.RoutingRule, error) {
+		if len(cidrs) == 0 {
+			return nil, newError("no IP to route to ", outboundTag)
+		}
+		geoip := new(router.GeoIP)
+		for _, cidr := range cidrs {
+			c, err := parseCIDR(cidr)
+			if err != nil {
+				return nil, err
+			}
+			geoip.Cidr = append(geoip.Cidr, c)
+		}
+		return &router.RoutingRule{
+			TargetTag: &router.RoutingRule_Tag{
+				Tag: outboundTag,
+			},
+			Geoip: []*router.GeoIP{geoip},
+		}, nil
+	}
+}
+
+func parseCIDR(s string) (*router.CIDR, error) {
+	if ip := net.ParseIP(s); ip != nil {
+		address := net.IPAddress(ip)
+		return &router.CIDR{
+			Ip:     []byte(address.IP()),
+			Prefix: uint32(len(address.IP()) * 8),
+		}, nil
+	}
+	_, network, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil, newError("invalid IP or CIDR: ", s).Base(err)
+	}
+	prefix, _ := network.Mask.Size()
+	return &router.CIDR{
+		Ip:     []byte(network.IP),
+		Prefix: uint32(prefix),
+	}, nil
+}
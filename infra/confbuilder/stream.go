@@ -0,0 +1,48 @@
+package confbuilder
+
+import (
+	"strings"
+
+	"v2ray.com/core/common/serial"
+	"v2ray.com/core/transport/internet"
+	"v2ray.com/core/transport/internet/tls"
+	"v2ray.com/core/transport/internet/websocket"
+)
+
+// StreamSettings are the transport settings of an outbound.
+type StreamSettings struct {
+	// Network is "tcp", the default, or "websocket".
+	Network string
+	// Path is the path of WebSocket.
+	Path string
+	// TLS enables TLS, with the ServerName if not empty.
+	TLS        bool
+	ServerName string
+}
+
+func (s *StreamSettings) build() (*internet.StreamConfig, error) {
+	config := new(internet.StreamConfig)
+	switch strings.ToLower(s.Network) {
+	case "", "tcp":
+		config.ProtocolName = "tcp"
+	case "ws", "websocket":
+		config.ProtocolName = "websocket"
+		config.TransportSettings = append(config.TransportSettings, &internet.TransportConfig{
+			ProtocolName: "websocket",
+			Settings: serial.ToTypedMessage(&websocket.Config{
+				Path: s.Path,
+			}),
+		})
+	default:
+		return nil, newError("unsupported network: ", s.Network)
+	}
+
+	if s.TLS {
+		tlsConfig := &tls.Config{
+			ServerName: s.ServerName,
+		}
+		config.SecurityType = serial.GetMessageType(tlsConfig)
+		config.SecuritySettings = append(config.SecuritySettings, serial.ToTypedMessage(tlsConfig))
+	}
+	return config, nil
+}
@@ -11,7 +11,11 @@ import (
 	"github.com/golang/protobuf/proto"
 	"google.golang.org/grpc"
 
+	commanderService "v2ray.com/core/app/commander"
+	dnsService "v2ray.com/core/app/dns/command"
 	logService "v2ray.com/core/app/log/command"
+	handlerService "v2ray.com/core/app/proxyman/command"
+	routingService "v2ray.com/core/app/router/command"
 	statsService "v2ray.com/core/app/stats/command"
 	"v2ray.com/core/common"
 )
@@ -30,14 +34,32 @@ func (c *APICommand) Description() Description {
 			"Call an API in an V2Ray process.",
 			"The following methods are currently supported:",
 			"\tLoggerService.RestartLogger",
+			"\tLoggerService.SetLogLevel",
+			"\tLoggerService.GetLogLevel",
 			"\tStatsService.GetStats",
 			"\tStatsService.QueryStats",
+			"\tHandlerService.AddInbound",
+			"\tHandlerService.RemoveInbound",
+			"\tHandlerService.AddOutbound",
+			"\tHandlerService.RemoveOutbound",
+			"\tHandlerService.ListHandlers",
+			"\tHandlerService.GetInboundBans",
+			"\tHandlerService.GetSessionStats",
+			"\tRoutingService.GetBalancerInfo",
+			"\tRoutingService.UpdateRouting",
+			"\tDnsService.UpdateDns",
+			"\tServerService.GetServerInfo",
+			"\tServerService.Healthcheck",
 			"API calls in this command have a timeout to the server of 3 seconds.",
 			"Examples:",
 			"v2ctl api --server=127.0.0.1:8080 LoggerService.RestartLogger '' ",
+			"v2ctl api --server=127.0.0.1:8080 LoggerService.SetLogLevel 'level: Debug'",
 			"v2ctl api --server=127.0.0.1:8080 StatsService.QueryStats 'pattern: \"\" reset: false'",
 			"v2ctl api --server=127.0.0.1:8080 StatsService.GetStats 'name: \"inbound>>>statin>>>traffic>>>downlink\" reset: false'",
 			"v2ctl api --server=127.0.0.1:8080 StatsService.GetSysStats ''",
+			"v2ctl api --server=127.0.0.1:8080 HandlerService.AddInbound 'json_config: \"{\\\"tag\\\": \\\"in\\\", \\\"port\\\": 1080, \\\"protocol\\\": \\\"socks\\\"}\"'",
+			"v2ctl api --server=127.0.0.1:8080 HandlerService.ListHandlers ''",
+			"v2ctl api --server=127.0.0.1:8080 ServerService.Healthcheck 'timeout: 1000'",
 		},
 	}
 }
@@ -93,27 +115,41 @@ func getServiceMethod(s string) (string, string) {
 type serviceHandler func(ctx context.Context, conn *grpc.ClientConn, method string, request string) (string, error)
 
 var serivceHandlerMap = map[string]serviceHandler{
-	"statsservice":  callStatsService,
-	"loggerservice": callLogService,
+	"statsservice":   callStatsService,
+	"loggerservice":  callLogService,
+	"handlerservice": callHandlerService,
+	"routingservice": callRoutingService,
+	"serverservice":  callServerService,
+	"dnsservice":     callDNSService,
 }
 
 func callLogService(ctx context.Context, conn *grpc.ClientConn, method string, request string) (string, error) {
 	client := logService.NewLoggerServiceClient(conn)
 
+	var r proto.Message
+	var call func() (proto.Message, error)
 	switch strings.ToLower(method) {
 	case "restartlogger":
-		r := &logService.RestartLoggerRequest{}
-		if err := proto.UnmarshalText(request, r); err != nil {
-			return "", err
-		}
-		resp, err := client.RestartLogger(ctx, r)
-		if err != nil {
-			return "", err
-		}
-		return proto.MarshalTextString(resp), nil
+		req := &logService.RestartLoggerRequest{}
+		r, call = req, func() (proto.Message, error) { return client.RestartLogger(ctx, req) }
+	case "setloglevel":
+		req := &logService.SetLogLevelRequest{}
+		r, call = req, func() (proto.Message, error) { return client.SetLogLevel(ctx, req) }
+	case "getloglevel":
+		req := &logService.GetLogLevelRequest{}
+		r, call = req, func() (proto.Message, error) { return client.GetLogLevel(ctx, req) }
 	default:
 		return "", errors.New("Unknown method: " + method)
 	}
+
+	if err := proto.UnmarshalText(request, r); err != nil {
+		return "", err
+	}
+	resp, err := call()
+	if err != nil {
+		return "", err
+	}
+	return proto.MarshalTextString(resp), nil
 }
 
 func callStatsService(ctx context.Context, conn *grpc.ClientConn, method string, request string) (string, error) {
@@ -153,6 +189,122 @@ func callStatsService(ctx context.Context, conn *grpc.ClientConn, method string,
 	}
 }
 
+func callHandlerService(ctx context.Context, conn *grpc.ClientConn, method string, request string) (string, error) {
+	client := handlerService.NewHandlerServiceClient(conn)
+
+	var r proto.Message
+	var call func() (proto.Message, error)
+	switch strings.ToLower(method) {
+	case "addinbound":
+		req := &handlerService.AddInboundRequest{}
+		r, call = req, func() (proto.Message, error) { return client.AddInbound(ctx, req) }
+	case "removeinbound":
+		req := &handlerService.RemoveInboundRequest{}
+		r, call = req, func() (proto.Message, error) { return client.RemoveInbound(ctx, req) }
+	case "addoutbound":
+		req := &handlerService.AddOutboundRequest{}
+		r, call = req, func() (proto.Message, error) { return client.AddOutbound(ctx, req) }
+	case "removeoutbound":
+		req := &handlerService.RemoveOutboundRequest{}
+		r, call = req, func() (proto.Message, error) { return client.RemoveOutbound(ctx, req) }
+	case "listhandlers":
+		req := &handlerService.ListHandlersRequest{}
+		r, call = req, func() (proto.Message, error) { return client.ListHandlers(ctx, req) }
+	case "getinboundbans":
+		req := &handlerService.GetInboundBansRequest{}
+		r, call = req, func() (proto.Message, error) { return client.GetInboundBans(ctx, req) }
+	case "getsessionstats":
+		req := &handlerService.GetSessionStatsRequest{}
+		r, call = req, func() (proto.Message, error) { return client.GetSessionStats(ctx, req) }
+	default:
+		return "", errors.New("Unknown method: " + method)
+	}
+
+	if err := proto.UnmarshalText(request, r); err != nil {
+		return "", err
+	}
+	resp, err := call()
+	if err != nil {
+		return "", err
+	}
+	return proto.MarshalTextString(resp), nil
+}
+
+func callRoutingService(ctx context.Context, conn *grpc.ClientConn, method string, request string) (string, error) {
+	client := routingService.NewRoutingServiceClient(conn)
+
+	var r proto.Message
+	var call func() (proto.Message, error)
+	switch strings.ToLower(method) {
+	case "getbalancerinfo":
+		req := &routingService.GetBalancerInfoRequest{}
+		r, call = req, func() (proto.Message, error) { return client.GetBalancerInfo(ctx, req) }
+	case "updaterouting":
+		req := &routingService.UpdateRoutingRequest{}
+		r, call = req, func() (proto.Message, error) { return client.UpdateRouting(ctx, req) }
+	default:
+		return "", errors.New("Unknown method: " + method)
+	}
+
+	if err := proto.UnmarshalText(request, r); err != nil {
+		return "", err
+	}
+	resp, err := call()
+	if err != nil {
+		return "", err
+	}
+	return proto.MarshalTextString(resp), nil
+}
+
+func callDNSService(ctx context.Context, conn *grpc.ClientConn, method string, request string) (string, error) {
+	client := dnsService.NewDnsServiceClient(conn)
+
+	var r proto.Message
+	var call func() (proto.Message, error)
+	switch strings.ToLower(method) {
+	case "updatedns":
+		req := &dnsService.UpdateDnsRequest{}
+		r, call = req, func() (proto.Message, error) { return client.UpdateDns(ctx, req) }
+	default:
+		return "", errors.New("Unknown method: " + method)
+	}
+
+	if err := proto.UnmarshalText(request, r); err != nil {
+		return "", err
+	}
+	resp, err := call()
+	if err != nil {
+		return "", err
+	}
+	return proto.MarshalTextString(resp), nil
+}
+
+func callServerService(ctx context.Context, conn *grpc.ClientConn, method string, request string) (string, error) {
+	client := commanderService.NewServerServiceClient(conn)
+
+	var r proto.Message
+	var call func() (proto.Message, error)
+	switch strings.ToLower(method) {
+	case "getserverinfo":
+		req := &commanderService.GetServerInfoRequest{}
+		r, call = req, func() (proto.Message, error) { return client.GetServerInfo(ctx, req) }
+	case "healthcheck":
+		req := &commanderService.HealthcheckRequest{}
+		r, call = req, func() (proto.Message, error) { return client.Healthcheck(ctx, req) }
+	default:
+		return "", errors.New("Unknown method: " + method)
+	}
+
+	if err := proto.UnmarshalText(request, r); err != nil {
+		return "", err
+	}
+	resp, err := call()
+	if err != nil {
+		return "", err
+	}
+	return proto.MarshalTextString(resp), nil
+}
+
 func init() {
 	common.Must(RegisterCommand(&APICommand{}))
 }
@@ -44,6 +44,10 @@ func (c *ConfigCommand) Execute(args []string) error {
 		if err != nil {
 			ctllog.Fatalln(err)
 		}
+		c, err = serial.ResolveIncludes(c, arg)
+		if err != nil {
+			ctllog.Fatalln(err)
+		}
 		conf.Override(c, arg)
 	}
 
@@ -0,0 +1,274 @@
+// +build !confonly
+
+package core
+
+import (
+	"context"
+	"sync"
+
+	"v2ray.com/core/common"
+	"v2ray.com/core/common/buf"
+	"v2ray.com/core/common/errors"
+	"v2ray.com/core/common/log"
+	"v2ray.com/core/common/net"
+	"v2ray.com/core/common/session"
+	"v2ray.com/core/common/signal"
+	"v2ray.com/core/common/task"
+	"v2ray.com/core/features/policy"
+	"v2ray.com/core/features/routing"
+	"v2ray.com/core/features/stats"
+	"v2ray.com/core/transport"
+	"v2ray.com/core/transport/internet"
+)
+
+// injector dispatches connections accepted by the caller as if they arrived on an inbound with its tag.
+type injector struct {
+	dispatcher routing.Dispatcher
+	policy     policy.Session
+	tag        string
+	uplink     stats.Counter
+	downlink   stats.Counter
+}
+
+func newInjector(v *Instance, inboundTag string) (*injector, error) {
+	dispatcher, ok := v.GetFeature(routing.DispatcherType()).(routing.Dispatcher)
+	if !ok {
+		return nil, newError("routing.Dispatcher is not registered in V2Ray core").WithKind(errors.KindInternal)
+	}
+	policyManager := v.GetFeature(policy.ManagerType()).(policy.Manager)
+	i := &injector{
+		dispatcher: dispatcher,
+		policy:     policyManager.ForLevel(0),
+		tag:        inboundTag,
+	}
+	if len(inboundTag) > 0 {
+		statsManager := v.GetFeature(stats.ManagerType()).(stats.Manager)
+		systemStats := policyManager.ForSystem().Stats
+		if systemStats.InboundUplink {
+			i.uplink, _ = stats.GetOrRegisterCounter(statsManager, "inbound>>>"+inboundTag+">>>traffic>>>uplink")
+		}
+		if systemStats.InboundDownlink {
+			i.downlink, _ = stats.GetOrRegisterCounter(statsManager, "inbound>>>"+inboundTag+">>>traffic>>>downlink")
+		}
+	}
+	return i, nil
+}
+
+// addrDestination returns the destination of addr, or an invalid destination if addr is not of a network
+// V2Ray knows, such as addresses of in-memory connections.
+func addrDestination(addr net.Addr) net.Destination {
+	switch addr.(type) {
+	case *net.TCPAddr, *net.UDPAddr, *net.UnixAddr:
+		return net.DestinationFromAddr(addr)
+	default:
+		return net.Destination{}
+	}
+}
+
+// context returns the context of a session from the source, with the sniffing request of the content in
+// ctx, if any.
+func (i *injector) context(ctx context.Context, source net.Addr, gateway net.Addr, dest net.Destination) context.Context {
+	ctx = session.ContextWithID(ctx, session.NewID())
+	ctx = session.ContextWithInbound(ctx, &session.Inbound{
+		Source:  addrDestination(source),
+		Gateway: addrDestination(gateway),
+		Tag:     i.tag,
+	})
+	content := new(session.Content)
+	if c := session.ContentFromContext(ctx); c != nil {
+		content.SniffingRequest = c.SniffingRequest
+	}
+	ctx = session.ContextWithContent(ctx, content)
+	ctx = log.ContextWithAccessMessage(ctx, &log.AccessMessage{
+		From:   source,
+		To:     dest,
+		Status: log.AccessAccepted,
+	})
+	return policy.ContextWithBufferPolicy(ctx, i.policy.Buffer)
+}
+
+// InjectConnection dispatches a connection accepted by the caller to dest through the given V2Ray instance,
+// as if it arrived on an inbound with the given tag, so that it is routed by the tag, and counted in the
+// traffic stats of the inbound. The connection is sniffed if the sniffing request of the content in ctx is
+// enabled, for example:
+//
+//	ctx = session.ContextWithContent(ctx, &session.Content{
+//		SniffingRequest: session.SniffingRequest{
+//			Enabled:                        true,
+//			OverrideDestinationForProtocol: []string{"http", "tls"},
+//		},
+//	})
+//
+// The timeouts of the policy of user level 0 apply. InjectConnection returns when the connection ends, and
+// closes it.
+//
+// v2ray:api:beta
+func InjectConnection(ctx context.Context, v *Instance, conn net.Conn, dest net.Destination, inboundTag string) error {
+	defer conn.Close()
+
+	i, err := newInjector(v, inboundTag)
+	if err != nil {
+		return err
+	}
+	dest.Network = net.Network_TCP
+	ctx = i.context(ctx, conn.RemoteAddr(), conn.LocalAddr(), dest)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	timer := signal.CancelAfterInactivity(ctx, cancel, i.policy.Timeouts.ConnectionIdle)
+
+	link, err := i.dispatcher.Dispatch(ctx, dest)
+	if err != nil {
+		return newError("failed to dispatch connection to ", dest).Base(err)
+	}
+	statConn := internet.NewStatCouterConnection(conn, i.uplink, i.downlink)
+
+	requestDone := func() error {
+		defer timer.SetTimeout(i.policy.Timeouts.DownlinkOnly)
+
+		if err := buf.Copy(buf.NewReader(statConn), link.Writer, buf.UpdateActivity(timer)); err != nil {
+			return newError("failed to transport request").Base(err)
+		}
+		return nil
+	}
+	responseDone := func() error {
+		defer timer.SetTimeout(i.policy.Timeouts.UplinkOnly)
+
+		if err := buf.Copy(link.Reader, buf.NewWriter(statConn), buf.UpdateActivity(timer)); err != nil {
+			return newError("failed to transport response").Base(err)
+		}
+		return nil
+	}
+
+	if err := task.Run(ctx, task.OnSuccess(requestDone, task.Close(link.Writer)), responseDone); err != nil {
+		common.Interrupt(link.Reader)
+		common.Interrupt(link.Writer)
+		return newError("connection ends").Base(err)
+	}
+	return nil
+}
+
+// packetSession is the session of packets from a source address of an injected PacketConn.
+type packetSession struct {
+	link  *transport.Link
+	timer signal.ActivityUpdater
+	close func()
+}
+
+// packetWriter writes packets back to the source address in an injected PacketConn.
+type packetWriter struct {
+	conn    net.PacketConn
+	addr    net.Addr
+	counter stats.Counter
+}
+
+// WriteMultiBuffer implements buf.Writer.
+func (w *packetWriter) WriteMultiBuffer(mb buf.MultiBuffer) error {
+	defer buf.ReleaseMulti(mb)
+
+	for _, b := range mb {
+		if _, err := w.conn.WriteTo(b.Bytes(), w.addr); err != nil {
+			return err
+		}
+		if w.counter != nil {
+			w.counter.Add(int64(b.Len()))
+		}
+	}
+	return nil
+}
+
+// InjectPacketConn dispatches the packets read from a PacketConn of the caller to dest through the given V2Ray
+// instance, as if they arrived on an inbound with the given tag, and writes the responses back to their
+// sources. As in InjectConnection, packets are routed by the tag, counted in the traffic stats of the inbound,
+// and sniffed as requested in ctx.
+//
+// The packets of each source address are dispatched in a session of their own, which ends when it is idle
+// for longer than the idle timeout of the policy of user level 0. InjectPacketConn returns when reading from
+// conn fails, such as after it is closed by the caller, and ends all the sessions.
+//
+// v2ray:api:beta
+func InjectPacketConn(ctx context.Context, v *Instance, conn net.PacketConn, dest net.Destination, inboundTag string) error {
+	i, err := newInjector(v, inboundTag)
+	if err != nil {
+		return err
+	}
+	dest.Network = net.Network_UDP
+
+	var access sync.Mutex
+	sessions := make(map[string]*packetSession)
+	defer func() {
+		access.Lock()
+		closes := make([]func(), 0, len(sessions))
+		for _, s := range sessions {
+			closes = append(closes, s.close)
+		}
+		access.Unlock()
+		for _, close := range closes {
+			close()
+		}
+	}()
+
+	newSession := func(addr net.Addr) (*packetSession, error) {
+		sessionCtx, cancel := context.WithCancel(i.context(ctx, addr, conn.LocalAddr(), dest))
+		link, err := i.dispatcher.Dispatch(sessionCtx, dest)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		s := &packetSession{link: link}
+		var once sync.Once
+		s.close = func() {
+			once.Do(func() {
+				access.Lock()
+				if sessions[addr.String()] == s {
+					delete(sessions, addr.String())
+				}
+				access.Unlock()
+				cancel()
+				common.Interrupt(link.Reader)
+				common.Interrupt(link.Writer)
+			})
+		}
+		s.timer = signal.CancelAfterInactivity(sessionCtx, s.close, i.policy.Timeouts.ConnectionIdle)
+		access.Lock()
+		sessions[addr.String()] = s
+		access.Unlock()
+		go func() {
+			defer s.close()
+			writer := &packetWriter{conn: conn, addr: addr, counter: i.downlink}
+			if err := buf.Copy(link.Reader, writer, buf.UpdateActivity(s.timer)); err != nil {
+				newError("packet session from ", addr, " ends").Base(err).AtDebug().WriteToLog(session.ExportIDToError(sessionCtx))
+			}
+		}()
+		return s, nil
+	}
+
+	for {
+		payload := buf.New()
+		n, addr, err := conn.ReadFrom(payload.Extend(buf.Size))
+		if err != nil {
+			payload.Release()
+			return newError("failed to read packets").Base(err)
+		}
+		payload.Resize(0, int32(n))
+		if i.uplink != nil {
+			i.uplink.Add(int64(n))
+		}
+
+		access.Lock()
+		s, found := sessions[addr.String()]
+		access.Unlock()
+		if !found {
+			s, err = newSession(addr)
+			if err != nil {
+				// The packet is dropped, and later ones from the source are dispatched again.
+				payload.Release()
+				newError("failed to dispatch packets from ", addr, " to ", dest).Base(err).AtDebug().WriteToLog()
+				continue
+			}
+		}
+		s.timer.Update()
+		if err := s.link.Writer.WriteMultiBuffer(buf.MultiBuffer{payload}); err != nil {
+			s.close()
+		}
+	}
+}
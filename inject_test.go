@@ -0,0 +1,178 @@
+package core_test
+
+import (
+	"context"
+	"crypto/rand"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"v2ray.com/core"
+	"v2ray.com/core/app/dispatcher"
+	"v2ray.com/core/app/policy"
+	"v2ray.com/core/app/proxyman"
+	"v2ray.com/core/app/router"
+	"v2ray.com/core/app/stats"
+	"v2ray.com/core/common"
+	"v2ray.com/core/common/net"
+	"v2ray.com/core/common/serial"
+	feature_stats "v2ray.com/core/features/stats"
+	"v2ray.com/core/proxy/blackhole"
+	"v2ray.com/core/proxy/freedom"
+	"v2ray.com/core/testing/servers/tcp"
+	"v2ray.com/core/testing/servers/udp"
+)
+
+// newInjectionInstance returns an instance that only lets connections of the inbound "embedded" out.
+func newInjectionInstance(t *testing.T) *core.Instance {
+	config := &core.Config{
+		App: []*serial.TypedMessage{
+			serial.ToTypedMessage(&dispatcher.Config{}),
+			serial.ToTypedMessage(&proxyman.InboundConfig{}),
+			serial.ToTypedMessage(&proxyman.OutboundConfig{}),
+			serial.ToTypedMessage(&stats.Config{}),
+			serial.ToTypedMessage(&policy.Config{
+				System: &policy.SystemPolicy{
+					Stats: &policy.SystemPolicy_Stats{
+						InboundUplink:   true,
+						InboundDownlink: true,
+					},
+				},
+			}),
+			serial.ToTypedMessage(&router.Config{
+				Rule: []*router.RoutingRule{
+					{
+						InboundTag: []string{"embedded"},
+						TargetTag:  &router.RoutingRule_Tag{Tag: "direct"},
+					},
+				},
+			}),
+		},
+		Outbound: []*core.OutboundHandlerConfig{
+			{
+				Tag:           "blocked",
+				ProxySettings: serial.ToTypedMessage(&blackhole.Config{}),
+			},
+			{
+				Tag:           "direct",
+				ProxySettings: serial.ToTypedMessage(&freedom.Config{}),
+			},
+		},
+	}
+	server, err := core.New(config)
+	common.Must(err)
+	common.Must(server.Start())
+	return server
+}
+
+func counterValue(server *core.Instance, name string) int64 {
+	c := server.GetFeature(feature_stats.ManagerType()).(feature_stats.Manager).GetCounter(name)
+	if c == nil {
+		return -1
+	}
+	return c.Value()
+}
+
+func TestInjectConnection(t *testing.T) {
+	tcpServer := tcp.Server{
+		MsgProcessor: xor,
+	}
+	dest, err := tcpServer.Start()
+	common.Must(err)
+	defer tcpServer.Close()
+
+	server := newInjectionInstance(t)
+	defer server.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	common.Must(err)
+	defer listener.Close()
+
+	inject := func(tag string) net.Conn {
+		client, err := net.Dial("tcp", listener.Addr().String())
+		common.Must(err)
+		conn, err := listener.Accept()
+		common.Must(err)
+		go core.InjectConnection(context.Background(), server, conn, dest, tag)
+		return client
+	}
+
+	client := inject("embedded")
+	defer client.Close()
+	payload := make([]byte, 1024)
+	common.Must2(rand.Read(payload))
+	common.Must2(client.Write(payload))
+	receive := make([]byte, len(payload))
+	common.Must2(io.ReadFull(client, receive))
+	if r := cmp.Diff(xor(receive), payload); r != "" {
+		t.Error(r)
+	}
+	if v := counterValue(server, "inbound>>>embedded>>>traffic>>>uplink"); v != 1024 {
+		t.Error("expect uplink 1024, but got ", v)
+	}
+	if v := counterValue(server, "inbound>>>embedded>>>traffic>>>downlink"); v != 1024 {
+		t.Error("expect downlink 1024, but got ", v)
+	}
+
+	blocked := inject("other")
+	defer blocked.Close()
+	common.Must2(blocked.Write(payload))
+	common.Must(blocked.SetReadDeadline(time.Now().Add(time.Second * 5)))
+	if _, err := blocked.Read(receive); err == nil {
+		t.Error("expect connection of other inbounds blocked")
+	}
+}
+
+func TestInjectPacketConn(t *testing.T) {
+	udpServer := udp.Server{
+		MsgProcessor: xor,
+	}
+	dest, err := udpServer.Start()
+	common.Must(err)
+	defer udpServer.Close()
+
+	server := newInjectionInstance(t)
+	defer server.Close()
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: []byte{127, 0, 0, 1}})
+	common.Must(err)
+	injected := make(chan error, 1)
+	go func() {
+		injected <- core.InjectPacketConn(context.Background(), server, conn, dest, "embedded")
+	}()
+
+	for i := 0; i < 2; i++ {
+		client, err := net.DialUDP("udp", nil, conn.LocalAddr().(*net.UDPAddr))
+		common.Must(err)
+		defer client.Close()
+
+		payload := make([]byte, 1024)
+		common.Must2(rand.Read(payload))
+		common.Must2(client.Write(payload))
+		common.Must(client.SetReadDeadline(time.Now().Add(time.Second * 5)))
+		receive := make([]byte, 2048)
+		n, err := client.Read(receive)
+		common.Must(err)
+		if r := cmp.Diff(xor(receive[:n]), payload); r != "" {
+			t.Error(r)
+		}
+	}
+	if v := counterValue(server, "inbound>>>embedded>>>traffic>>>uplink"); v != 2048 {
+		t.Error("expect uplink 2048, but got ", v)
+	}
+	if v := counterValue(server, "inbound>>>embedded>>>traffic>>>downlink"); v != 2048 {
+		t.Error("expect downlink 2048, but got ", v)
+	}
+
+	conn.Close()
+	select {
+	case err := <-injected:
+		if err == nil {
+			t.Error("expect error after closing the connection")
+		}
+	case <-time.After(time.Second * 5):
+		t.Error("InjectPacketConn doesn't return after closing the connection")
+	}
+}
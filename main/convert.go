@@ -0,0 +1,73 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+
+	"v2ray.com/core"
+	"v2ray.com/core/common/cmdarg"
+	"v2ray.com/core/common/serial"
+)
+
+// convert implements the "convert" subcommand, which loads a config in one format and writes it
+// to stdout in another:
+//
+//	v2ray convert -i json -o pb config.json > config.pb
+//	v2ray convert -i pb -o json config.pb > config.pbjson
+//
+// JSON output is the protobuf config in JSON, which is read back with "-i protojson", or by the
+// ProtoJSON loader for files with the pbjson extension.
+func convert(args []string) error {
+	fs := flag.NewFlagSet("convert", flag.ContinueOnError)
+	input := fs.String("i", "json", "Format of input files: json, pb or protojson.")
+	output := fs.String("o", "pb", "Format of output: pb or json.")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: v2ray convert [-i json|pb|protojson] [-o pb|json] [config files...]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var inputFormat string
+	switch strings.ToLower(*input) {
+	case "json":
+		inputFormat = "json"
+	case "pb", "protobuf":
+		inputFormat = "protobuf"
+	case "protojson":
+		inputFormat = "protojson"
+	default:
+		return newError("unknown input format: ", *input)
+	}
+
+	files := cmdarg.Arg(fs.Args())
+	if len(files) == 0 {
+		files = cmdarg.Arg{"stdin:"}
+	}
+	config, err := core.LoadConfig(inputFormat, "", files)
+	if err != nil {
+		return newError("failed to read config files: [", files.String(), "]").Base(err)
+	}
+
+	var data []byte
+	switch strings.ToLower(*output) {
+	case "pb", "protobuf":
+		data, err = proto.Marshal(config)
+	case "json":
+		if data, err = serial.ToCanonicalJSON(config); err == nil {
+			data = append(data, '\n')
+		}
+	default:
+		return newError("unknown output format: ", *output)
+	}
+	if err != nil {
+		return newError("failed to encode config").Base(err)
+	}
+	_, err = os.Stdout.Write(data)
+	return err
+}
@@ -10,12 +10,16 @@ import (
 
 	// Default commander and all its services. This is an optional feature.
 	_ "v2ray.com/core/app/commander"
+	_ "v2ray.com/core/app/dns/command"
 	_ "v2ray.com/core/app/log/command"
 	_ "v2ray.com/core/app/proxyman/command"
+	_ "v2ray.com/core/app/router/command"
 	_ "v2ray.com/core/app/stats/command"
 
 	// Other optional features.
 	_ "v2ray.com/core/app/dns"
+	_ "v2ray.com/core/app/events"
+	_ "v2ray.com/core/app/health"
 	_ "v2ray.com/core/app/log"
 	_ "v2ray.com/core/app/policy"
 	_ "v2ray.com/core/app/reverse"
@@ -28,7 +32,9 @@ import (
 	_ "v2ray.com/core/proxy/dokodemo"
 	_ "v2ray.com/core/proxy/freedom"
 	_ "v2ray.com/core/proxy/http"
+	_ "v2ray.com/core/proxy/loopback"
 	_ "v2ray.com/core/proxy/mtproto"
+	_ "v2ray.com/core/proxy/race"
 	_ "v2ray.com/core/proxy/shadowsocks"
 	_ "v2ray.com/core/proxy/socks"
 	_ "v2ray.com/core/proxy/trojan"
@@ -39,6 +45,7 @@ import (
 
 	// Transports
 	_ "v2ray.com/core/transport/internet/domainsocket"
+	_ "v2ray.com/core/transport/internet/h3"
 	_ "v2ray.com/core/transport/internet/http"
 	_ "v2ray.com/core/transport/internet/kcp"
 	_ "v2ray.com/core/transport/internet/quic"
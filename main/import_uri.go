@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"v2ray.com/core/common/log"
+	"v2ray.com/core/infra/conf"
+)
+
+// stderrLogHandler writes logs to stderr synchronously, so that warnings are written before the command
+// exits.
+type stderrLogHandler struct{}
+
+func (stderrLogHandler) Handle(msg log.Message) {
+	fmt.Fprintln(os.Stderr, msg.String())
+}
+
+// importURI implements the "import-uri" subcommand, which converts share links of servers, such as
+// "vmess://" and "ss://" URIs, to outbounds, and prints them as the "outbounds" of a JSON config:
+//
+//	v2ray import-uri vmess://eyJhZGQiOi... ss://YWVzLTEyOC1nY206cGFzcw@example.com:8388#server
+//	curl -s https://example.com/subscription | v2ray import-uri
+//
+// Without arguments, the links are read from stdin, one per line, or base64 encoded as subscriptions
+// are. Unknown fields of links are ignored with warnings on stderr.
+func importURI(args []string) error {
+	fs := flag.NewFlagSet("import-uri", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: v2ray import-uri [uri...]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	log.RegisterHandler(stderrLogHandler{})
+
+	uris := fs.Args()
+	if len(uris) == 0 {
+		content, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return newError("failed to read links from stdin").Base(err)
+		}
+		uris = conf.URIsFromSubscription(content)
+	}
+	if len(uris) == 0 {
+		return newError("no links to import")
+	}
+
+	outbounds := make([]json.RawMessage, 0, len(uris))
+	for _, uri := range uris {
+		outbound, err := conf.OutboundFromURI(uri)
+		if err != nil {
+			return newError("failed to import ", uri).Base(err)
+		}
+		// The outbound is built to find invalid values, such as unknown ciphers, before it is used.
+		config := new(conf.OutboundDetourConfig)
+		if err := json.Unmarshal(outbound, config); err != nil {
+			return newError("failed to import ", uri).Base(err)
+		}
+		if _, err := config.Build(); err != nil {
+			return newError("failed to import ", uri).Base(err)
+		}
+		outbounds = append(outbounds, outbound)
+	}
+
+	data, err := json.Marshal(map[string]interface{}{"outbounds": outbounds})
+	if err != nil {
+		return err
+	}
+	var out bytes.Buffer
+	if err := json.Indent(&out, data, "", "  "); err != nil {
+		return err
+	}
+	out.WriteByte('\n')
+	_, err = out.WriteTo(os.Stdout)
+	return err
+}
@@ -25,6 +25,8 @@ func init() {
 					common.Must(err)
 					c, err := serial.DecodeJSONConfig(r)
 					common.Must(err)
+					c, err = serial.ResolveIncludes(c, arg)
+					common.Must(err)
 					if i == 0 {
 						// This ensure even if the muti-json parser do not support a setting,
 						// It is still respected automatically for the first configure file
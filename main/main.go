@@ -3,7 +3,6 @@ package main
 //go:generate go run v2ray.com/core/common/errors/errorgen
 
 import (
-	"encoding/json"
 	"flag"
 	"fmt"
 	"io/ioutil"
@@ -18,8 +17,11 @@ import (
 
 	"v2ray.com/core"
 	"v2ray.com/core/common/cmdarg"
+	"v2ray.com/core/common/errors"
+	"v2ray.com/core/common/net"
 	"v2ray.com/core/common/platform"
-	"v2ray.com/core/infra/conf"
+	"v2ray.com/core/common/serial"
+	"v2ray.com/core/infra/confbuilder"
 	_ "v2ray.com/core/main/distro/all"
 )
 
@@ -27,8 +29,11 @@ var (
 	configFiles cmdarg.Arg // "Config file for V2Ray.", the option is customed type, parse in main
 	configDir   string
 	version     = flag.Bool("version", false, "Show current version of V2Ray.")
+	verbose     = flag.Bool("verbose", false, "With -version, list the features in this build as well.")
 	test        = flag.Bool("test", false, "Test config file only, without launching V2Ray server.")
+	dump        = flag.Bool("dump", false, "Print the config loaded from config files in JSON, without launching V2Ray server.")
 	format      = flag.String("format", "json", "Format of input file.")
+	strict      = flag.Bool("strict", false, "Reject config with unknown fields or types, or features not in this build. On by default with -test.")
 
 	inline                = flag.Bool("inline", false, "Indicate a simple VMess outbound and a SOCKS5 inbound")
 	inlinePort            = flag.Int("port", 1080, "When inline is true, indicate the SOCKS5 inbound's listening port")
@@ -111,12 +116,7 @@ func getConfigFilePath() cmdarg.Arg {
 }
 
 func GetConfigFormat() string {
-	switch strings.ToLower(*format) {
-	case "pb", "protobuf":
-		return "protobuf"
-	default:
-		return "json"
-	}
+	return configFormatName(*format)
 }
 
 func getConfig() (*core.Config, error) {
@@ -134,84 +134,21 @@ func getConfig() (*core.Config, error) {
 			return nil, newError("-vmess-alter-id is required when inline mode is on")
 		}
 
-		type (
-			M map[string]interface{}
-			D []interface{}
-		)
-		streamSettings := M{}
-		security := "none"
-		if *inlineVMessTLS {
-			security = "tls"
+		vmessOpts := []confbuilder.VMessOption{
+			confbuilder.VMessAlterID(uint32(*inlineVMessAlterID)),
 		}
 		if *inlineVMessNetwork == "ws" {
-			streamSettings = M{
-				"network":  "ws",
-				"security": security,
-				"wsSettings": M{
-					"path": *inlineVMessWSPath,
-				},
-			}
-		} else {
-			streamSettings = M{
-				"network":  "tcp",
-				"security": security,
-			}
-		}
-		if *inlineVMessTLS && *inlineVMessWSServName != "" {
-			streamSettings["tlsSettings"] = M{
-				"serverName": *inlineVMessWSServName,
-			}
-		}
-		mConf := M{
-			"inbounds": D{
-				M{
-					"port":     *inlinePort,
-					"listen":   "127.0.0.1",
-					"protocol": "socks",
-					"settings": M{
-						"auth":      "noauth",
-						"udp":       *inlineUDP,
-						"ip":        *inlineLocalIP,
-						"userLevel": 0,
-					},
-				},
-			},
-			"outbounds": D{
-				M{
-					"protocol": "vmess",
-					"settings": M{
-						"vnext": D{
-							M{
-								"address": *inlineVMessAddr,
-								"port":    *inlineVMessPort,
-								"users": D{
-									M{
-										"id":      *inlineVMessID,
-										"alterId": *inlineVMessAlterID,
-										"level":   0,
-									},
-								},
-							},
-						},
-					},
-					"streamSettings": streamSettings,
-				},
-			},
-		}
-		bConf, err := json.Marshal(mConf)
-		if err != nil {
-			panic(fmt.Errorf("failed to marshal conf: %v", err))
+			vmessOpts = append(vmessOpts, confbuilder.VMessWebSocket(*inlineVMessWSPath))
 		}
-		cfConf := &conf.Config{}
-		err = json.Unmarshal(bConf, &cfConf)
-		if err != nil {
-			panic(fmt.Errorf("failed to unmarshal conf: %v", err))
-		}
-		coreConf, err := cfConf.Build()
-		if err != nil {
-			panic(fmt.Errorf("failed to build conf: %v", err))
+		if *inlineVMessTLS {
+			vmessOpts = append(vmessOpts, confbuilder.VMessTLS(*inlineVMessWSServName))
 		}
-		return coreConf, nil
+		return confbuilder.NewConfig().
+			AddSocksInbound(net.Port(*inlinePort),
+				confbuilder.SocksUDP(*inlineUDP),
+				confbuilder.SocksLocalIP(*inlineLocalIP)).
+			AddVMessOutbound(*inlineVMessAddr, net.Port(*inlineVMessPort), *inlineVMessID, vmessOpts...).
+			Build()
 	}
 
 	configFiles := getConfigFilePath()
@@ -224,12 +161,32 @@ func getConfig() (*core.Config, error) {
 	return config, nil
 }
 
+// isStrict returns true if the config is validated before it is used, which is the default of -test.
+func isStrict() bool {
+	if !*test {
+		return *strict
+	}
+	explicit := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "strict" {
+			explicit = true
+		}
+	})
+	return *strict || !explicit
+}
+
 func startV2Ray() (core.Server, error) {
 	config, err := getConfig()
 	if err != nil {
 		return nil, err
 	}
 
+	if isStrict() {
+		if err := core.ValidateConfig(config); err != nil {
+			return nil, err
+		}
+	}
+
 	server, err := core.New(config)
 	if err != nil {
 		return nil, newError("failed to create server").Base(err)
@@ -238,6 +195,23 @@ func startV2Ray() (core.Server, error) {
 	return server, nil
 }
 
+// dumpConfig prints the config loaded from config files, such as outbounds converted from share links, in
+// the JSON form of the protobuf config, as the "convert" subcommand does. The system settings are the ones in
+// effect, including those from environment variables.
+func dumpConfig() error {
+	config, err := getConfig()
+	if err != nil {
+		return err
+	}
+	config.System = core.EffectiveSystemConfig(config.System)
+	data, err := serial.ToCanonicalJSON(config)
+	if err != nil {
+		return newError("failed to encode config").Base(err)
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
 func printVersion() {
 	version := core.VersionStatement()
 	for _, s := range version {
@@ -245,20 +219,85 @@ func printVersion() {
 	}
 }
 
+// printFeatures lists the features in this build, by the names that disabledFeatures takes.
+func printFeatures() {
+	fmt.Println("Features:")
+	for _, f := range core.RegisteredFeatures() {
+		fmt.Println(strings.TrimRight(fmt.Sprintf("  %-10s %-16s %s", f.Kind, f.Name, f.Type), " "))
+	}
+}
+
+// Exit codes tell the kind of the error that V2Ray fails with. Configuration errors exit with a special
+// value to prevent systemd from restarting.
+const (
+	exitConfigError = 23
+	exitBindError   = 24
+	exitAuthError   = 25
+	exitUnreachable = 26
+	exitInternal    = 27
+)
+
+// exitCode returns the exit code for the error, or fallback if the error is not classified.
+func exitCode(err error, fallback int) int {
+	switch errors.KindOf(err) {
+	case errors.KindConfig:
+		return exitConfigError
+	case errors.KindBind:
+		return exitBindError
+	case errors.KindAuth:
+		return exitAuthError
+	case errors.KindUnreachable:
+		return exitUnreachable
+	case errors.KindInternal:
+		return exitInternal
+	default:
+		return fallback
+	}
+}
+
+// subcommands are run by their names as the first argument, instead of the server.
+var subcommands = map[string]func(args []string) error{
+	"convert":    convert,
+	"uuid":       generateUUID,
+	"tls":        tls,
+	"probe":      probe,
+	"import-uri": importURI,
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if run, found := subcommands[os.Args[1]]; found {
+			if err := run(os.Args[2:]); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(exitCode(err, exitConfigError))
+			}
+			return
+		}
+	}
+
 	flag.Parse()
 
+	if *dump {
+		if err := dumpConfig(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(exitCode(err, exitConfigError))
+		}
+		return
+	}
+
 	printVersion()
 
 	if *version {
+		if *verbose {
+			printFeatures()
+		}
 		return
 	}
 
 	server, err := startV2Ray()
 	if err != nil {
 		fmt.Println(err)
-		// Configuration error. Exit with a special value to prevent systemd from restarting.
-		os.Exit(23)
+		os.Exit(exitCode(err, exitConfigError))
 	}
 
 	if *test {
@@ -268,7 +307,7 @@ func main() {
 
 	if err := server.Start(); err != nil {
 		fmt.Println("Failed to start", err)
-		os.Exit(-1)
+		os.Exit(exitCode(err, -1))
 	}
 	defer server.Close()
 
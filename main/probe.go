@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"v2ray.com/core"
+	"v2ray.com/core/common/cmdarg"
+	"v2ray.com/core/common/net"
+	"v2ray.com/core/common/serial"
+	"v2ray.com/core/common/session"
+	"v2ray.com/core/proxy/blackhole"
+	v2http "v2ray.com/core/proxy/http"
+	"v2ray.com/core/proxy/mtproto"
+)
+
+// probe implements the "probe" subcommand, which checks that outbounds work before real traffic is
+// routed through them. It requests the URL through each outbound, and prints the latency and the status:
+//
+//	v2ray probe -config config.json -tag proxy
+//	v2ray probe -config config.json -all -dns 8.8.8.8
+//
+// With -dns, it also sends a DNS query over UDP through each outbound that may carry UDP. The inbounds of
+// the config are not started, and the routing rules are bypassed. It fails if any probe fails.
+func probe(args []string) error {
+	fs := flag.NewFlagSet("probe", flag.ContinueOnError)
+	var files cmdarg.Arg
+	fs.Var(&files, "config", "Config file of the outbounds. Multiple assign is accepted.")
+	fs.Var(&files, "c", "Short alias of -config")
+	configFormat := fs.String("format", "json", "Format of config files.")
+	var tags stringList
+	fs.Var(&tags, "tag", "Tag of the outbound to probe. Multiple assign is accepted.")
+	all := fs.Bool("all", false, "Probe all the outbounds with tags.")
+	target := fs.String("url", "https://www.google.com/generate_204", "URL to request through the outbounds.")
+	dnsServer := fs.String("dns", "", "Also query the domain of the URL from this DNS server over UDP, such as 8.8.8.8.")
+	timeout := fs.Duration("timeout", time.Second*10, "Timeout of each probe.")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: v2ray probe -config file (-tag tag... | -all) [-url url] [-dns server] [-timeout duration]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return newError("-config is required")
+	}
+	if *timeout <= 0 {
+		return newError("invalid timeout: ", *timeout)
+	}
+	targetURL, err := url.Parse(*target)
+	if err != nil || (targetURL.Scheme != "http" && targetURL.Scheme != "https") || targetURL.Hostname() == "" {
+		return newError("invalid URL: ", *target)
+	}
+	var dnsDest net.Destination
+	if *dnsServer != "" {
+		dnsDest, err = parseDNSServer(*dnsServer)
+		if err != nil {
+			return err
+		}
+	}
+
+	config, err := core.LoadConfig(configFormatName(*configFormat), files[0], files)
+	if err != nil {
+		return newError("failed to read config files: [", files.String(), "]").Base(err)
+	}
+	outbounds := make(map[string]*core.OutboundHandlerConfig)
+	for _, ob := range config.Outbound {
+		if ob.Tag != "" {
+			outbounds[ob.Tag] = ob
+		}
+	}
+	if *all {
+		tags = nil
+		for _, ob := range config.Outbound {
+			if ob.Tag == "" {
+				fmt.Fprintln(os.Stderr, "skipping an outbound without tag")
+				continue
+			}
+			tags = append(tags, ob.Tag)
+		}
+	}
+	if len(tags) == 0 {
+		return newError("no outbound to probe, use -tag or -all")
+	}
+	for _, tag := range tags {
+		if outbounds[tag] == nil {
+			return newError("outbound not found: ", tag)
+		}
+	}
+
+	// Only the outbounds are needed, and the ports of the inbounds may be taken by a running instance.
+	config.Inbound = nil
+	server, err := core.New(config)
+	if err != nil {
+		return newError("failed to create server").Base(err)
+	}
+	if err := server.Start(); err != nil {
+		return newError("failed to start server").Base(err)
+	}
+	defer server.Close()
+
+	failed := 0
+	for _, tag := range tags {
+		latency, status, err := probeHTTP(server, tag, targetURL.String(), *timeout)
+		if err != nil {
+			failed++
+			fmt.Printf("%s\thttp\tfailed\t%v\n", tag, err)
+		} else {
+			fmt.Printf("%s\thttp\t%v\t%s\n", tag, latency.Round(time.Millisecond), status)
+		}
+		if dnsDest.IsValid() && !udpCapable(outbounds[tag]) {
+			fmt.Printf("%s\tdns\tskipped\tno UDP\n", tag)
+		} else if dnsDest.IsValid() {
+			latency, rcode, err := probeDNS(server, tag, dnsDest, targetURL.Hostname(), *timeout)
+			if err != nil {
+				failed++
+				fmt.Printf("%s\tdns\tfailed\t%v\n", tag, err)
+			} else {
+				fmt.Printf("%s\tdns\t%v\t%s\n", tag, latency.Round(time.Millisecond), rcode)
+			}
+		}
+	}
+	if failed > 0 {
+		return newError(failed, " probes failed")
+	}
+	return nil
+}
+
+// configFormatName returns the name of the config loader of the format given on the command line.
+func configFormatName(format string) string {
+	switch strings.ToLower(format) {
+	case "pb", "protobuf":
+		return "protobuf"
+	case "protojson":
+		return "protojson"
+	default:
+		return "json"
+	}
+}
+
+// udpCapable returns true if the outbound may carry UDP. HTTP, MTProto and blackhole outbounds carry TCP
+// only, or nothing at all.
+func udpCapable(ob *core.OutboundHandlerConfig) bool {
+	switch ob.GetProxySettings().GetType() {
+	case serial.GetMessageType(&v2http.ClientConfig{}),
+		serial.GetMessageType(&mtproto.ClientConfig{}),
+		serial.GetMessageType(&blackhole.Config{}):
+		return false
+	default:
+		return true
+	}
+}
+
+func parseDNSServer(server string) (net.Destination, error) {
+	host, port := server, "53"
+	if h, p, err := net.SplitHostPort(server); err == nil {
+		host, port = h, p
+	}
+	address := net.ParseAddress(host)
+	if !address.Family().IsIP() {
+		return net.Destination{}, newError("DNS server must be an IP: ", server)
+	}
+	dnsPort, err := net.PortFromString(port)
+	if err != nil {
+		return net.Destination{}, newError("invalid port of DNS server: ", server).Base(err)
+	}
+	return net.UDPDestination(address, dnsPort), nil
+}
+
+// probeContext returns the context of a probe, which is sent through the outbound of the tag.
+func probeContext(tag string) context.Context {
+	ctx := session.ContextWithID(context.Background(), session.NewID())
+	return session.ContextWithOutboundTag(ctx, tag)
+}
+
+// probeHTTP requests the URL through the outbound, and returns the time until the response headers
+// arrive. Redirects are not followed.
+func probeHTTP(server *core.Instance, tag string, target string, timeout time.Duration) (time.Duration, string, error) {
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(_ context.Context, network, addr string) (net.Conn, error) {
+				dest, err := net.ParseDestination(network + ":" + addr)
+				if err != nil {
+					return nil, err
+				}
+				return core.Dial(probeContext(tag), server, dest)
+			},
+			DisableKeepAlives: true,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+		Timeout: timeout,
+	}
+	start := time.Now()
+	resp, err := client.Get(target)
+	if err != nil {
+		return 0, "", err
+	}
+	latency := time.Since(start)
+	io.Copy(ioutil.Discard, resp.Body) // nolint: errcheck
+	resp.Body.Close()
+	return latency, resp.Status, nil
+}
+
+// probeDNS queries the A records of the domain from the DNS server through the outbound, and returns the
+// time until the response arrives.
+func probeDNS(server *core.Instance, tag string, dest net.Destination, domain string, timeout time.Duration) (time.Duration, string, error) {
+	name, err := dnsmessage.NewName(strings.TrimSuffix(domain, ".") + ".")
+	if err != nil {
+		return 0, "", newError("invalid domain: ", domain).Base(err)
+	}
+	id := uint16(session.NewID())
+	query := dnsmessage.Message{
+		Header: dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{
+			Name:  name,
+			Type:  dnsmessage.TypeA,
+			Class: dnsmessage.ClassINET,
+		}},
+	}
+	packet, err := query.Pack()
+	if err != nil {
+		return 0, "", newError("failed to pack DNS query").Base(err)
+	}
+
+	start := time.Now()
+	conn, err := core.Dial(probeContext(tag), server, dest)
+	if err != nil {
+		return 0, "", err
+	}
+	// Connections through the instance have no deadlines, so they are closed on timeout instead.
+	timer := time.AfterFunc(timeout, func() {
+		conn.Close()
+	})
+	defer timer.Stop()
+	defer conn.Close()
+
+	if _, err := conn.Write(packet); err != nil {
+		return 0, "", newError("failed to send DNS query").Base(err)
+	}
+	b := make([]byte, 2048)
+	for {
+		n, err := conn.Read(b)
+		if err != nil {
+			if time.Since(start) >= timeout {
+				return 0, "", newError("no DNS response within ", timeout)
+			}
+			return 0, "", newError("failed to read DNS response").Base(err)
+		}
+		var parser dnsmessage.Parser
+		header, err := parser.Start(b[:n])
+		if err != nil || header.ID != id || !header.Response {
+			continue
+		}
+		return time.Since(start), strings.TrimPrefix(header.RCode.String(), "RCode"), nil
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/dns/dnsmessage"
+
+	"v2ray.com/core"
+	"v2ray.com/core/app/dispatcher"
+	"v2ray.com/core/app/proxyman"
+	"v2ray.com/core/common"
+	"v2ray.com/core/common/net"
+	"v2ray.com/core/common/serial"
+	"v2ray.com/core/proxy/blackhole"
+	"v2ray.com/core/proxy/freedom"
+	v2http "v2ray.com/core/proxy/http"
+	"v2ray.com/core/proxy/mtproto"
+	"v2ray.com/core/proxy/vmess/outbound"
+)
+
+func TestParseDNSServer(t *testing.T) {
+	cases := []struct {
+		Input  string
+		Output net.Destination
+		Error  bool
+	}{
+		{Input: "8.8.8.8", Output: net.UDPDestination(net.ParseAddress("8.8.8.8"), 53)},
+		{Input: "8.8.8.8:5353", Output: net.UDPDestination(net.ParseAddress("8.8.8.8"), 5353)},
+		{Input: "[2001:4860:4860::8888]:53", Output: net.UDPDestination(net.ParseAddress("2001:4860:4860::8888"), 53)},
+		{Input: "dns.google", Error: true},
+		{Input: "8.8.8.8:dns", Error: true},
+	}
+	for _, c := range cases {
+		dest, err := parseDNSServer(c.Input)
+		if c.Error {
+			if err == nil {
+				t.Error("expected error for ", c.Input, ", but got ", dest)
+			}
+			continue
+		}
+		if err != nil {
+			t.Error(c.Input, ": ", err)
+			continue
+		}
+		if dest != c.Output {
+			t.Error(c.Input, ": expected ", c.Output, ", but got ", dest)
+		}
+	}
+}
+
+func TestUDPCapable(t *testing.T) {
+	cases := []struct {
+		Proxy proto.Message
+		UDP   bool
+	}{
+		{Proxy: &freedom.Config{}, UDP: true},
+		{Proxy: &outbound.Config{}, UDP: true},
+		{Proxy: &v2http.ClientConfig{}, UDP: false},
+		{Proxy: &mtproto.ClientConfig{}, UDP: false},
+		{Proxy: &blackhole.Config{}, UDP: false},
+	}
+	for _, c := range cases {
+		ob := &core.OutboundHandlerConfig{ProxySettings: serial.ToTypedMessage(c.Proxy)}
+		if r := udpCapable(ob); r != c.UDP {
+			t.Error(serial.GetMessageType(c.Proxy), ": expected ", c.UDP, ", but got ", r)
+		}
+	}
+}
+
+func TestProbeArguments(t *testing.T) {
+	cases := [][]string{
+		{"-tag", "direct"},
+		{"-config", "config.pb", "-tag", "direct", "-url", "ftp://example.com"},
+		{"-config", "config.pb", "-tag", "direct", "-timeout", "0s"},
+		{"-config", "config.pb", "-tag", "direct", "-dns", "dns.google"},
+	}
+	for _, args := range cases {
+		if err := probe(args); err == nil {
+			t.Error("expected error for ", strings.Join(args, " "))
+		}
+	}
+}
+
+// writeProbeConfig writes a config with a freedom outbound "direct" and a blackhole outbound "block", and
+// returns the path of the file.
+func writeProbeConfig(t *testing.T) string {
+	config := &core.Config{
+		App: []*serial.TypedMessage{
+			serial.ToTypedMessage(&dispatcher.Config{}),
+			serial.ToTypedMessage(&proxyman.InboundConfig{}),
+			serial.ToTypedMessage(&proxyman.OutboundConfig{}),
+		},
+		Outbound: []*core.OutboundHandlerConfig{
+			{
+				Tag:           "direct",
+				ProxySettings: serial.ToTypedMessage(&freedom.Config{}),
+			},
+			{
+				Tag:           "block",
+				ProxySettings: serial.ToTypedMessage(&blackhole.Config{}),
+			},
+		},
+	}
+	data, err := proto.Marshal(config)
+	common.Must(err)
+
+	dir, err := ioutil.TempDir("", "v2ray-probe")
+	common.Must(err)
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+	})
+	file := filepath.Join(dir, "config.pb")
+	common.Must(ioutil.WriteFile(file, data, 0600))
+	return file
+}
+
+// serveDNS answers every query on conn with an empty response of the same ID.
+func serveDNS(conn *net.UDPConn) {
+	b := make([]byte, 2048)
+	for {
+		n, addr, err := conn.ReadFrom(b)
+		if err != nil {
+			return
+		}
+		var parser dnsmessage.Parser
+		header, err := parser.Start(b[:n])
+		if err != nil {
+			continue
+		}
+		response := dnsmessage.Message{
+			Header: dnsmessage.Header{ID: header.ID, Response: true, RCode: dnsmessage.RCodeSuccess},
+		}
+		packet, err := response.Pack()
+		common.Must(err)
+		conn.WriteTo(packet, addr) // nolint: errcheck
+	}
+}
+
+func TestProbe(t *testing.T) {
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer httpServer.Close()
+
+	dnsConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: []byte{127, 0, 0, 1}})
+	common.Must(err)
+	defer dnsConn.Close()
+	go serveDNS(dnsConn)
+
+	file := writeProbeConfig(t)
+	args := func(tag string) []string {
+		return []string{
+			"-config", file,
+			"-tag", tag,
+			"-url", httpServer.URL,
+			"-dns", dnsConn.LocalAddr().String(),
+			"-timeout", "2s",
+		}
+	}
+
+	if err := probe(args("direct")); err != nil {
+		t.Error("failed to probe direct: ", err)
+	}
+	// The HTTP probe through blackhole fails, and the DNS probe is skipped, so only one probe fails.
+	if err := probe(args("block")); err == nil || !strings.Contains(err.Error(), "1 probes failed") {
+		t.Error("expected 1 failed probe of block, but got ", err)
+	}
+	if err := probe(args("missing")); err == nil {
+		t.Error("expected error for missing outbound")
+	}
+}
+
+func TestProbeDNSTimeout(t *testing.T) {
+	// A socket that never answers.
+	dnsConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: []byte{127, 0, 0, 1}})
+	common.Must(err)
+	defer dnsConn.Close()
+
+	config, err := core.LoadConfig("protobuf", "config.pb", mustOpen(t, writeProbeConfig(t)))
+	common.Must(err)
+	server, err := core.New(config)
+	common.Must(err)
+	common.Must(server.Start())
+	defer server.Close()
+
+	dest := net.DestinationFromAddr(dnsConn.LocalAddr())
+	start := time.Now()
+	if _, _, err := probeDNS(server, "direct", dest, "example.com", time.Second); err == nil {
+		t.Error("expected timeout of DNS probe")
+	}
+	if d := time.Since(start); d > 3*time.Second {
+		t.Error("DNS probe took ", d)
+	}
+}
+
+func mustOpen(t *testing.T, file string) *os.File {
+	f, err := os.Open(file)
+	common.Must(err)
+	t.Cleanup(func() {
+		f.Close()
+	})
+	return f
+}
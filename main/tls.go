@@ -0,0 +1,145 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"v2ray.com/core/common/protocol/tls/cert"
+)
+
+// tls implements the "tls" subcommand. "v2ray tls cert" generates a certificate and its key, either self
+// signed or signed by a CA generated before:
+//
+//	v2ray tls cert -ca -name "My CA" -file ca
+//	v2ray tls cert -san example.com -san 127.0.0.1 -issuer ca -client -file leaf
+//
+// Without -file, the certificate is printed in the "certificate" and "key" format of tlsSettings.
+func tls(args []string) error {
+	if len(args) == 0 || args[0] != "cert" {
+		fmt.Fprintln(os.Stderr, "Usage: v2ray tls cert [options]")
+		return newError("unknown tls command")
+	}
+	return generateCertificate(args[1:])
+}
+
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(v string) error {
+	if v == "" {
+		return newError("empty value")
+	}
+	*l = append(*l, v)
+	return nil
+}
+
+type jsonCertificate struct {
+	Certificate []string `json:"certificate"`
+	Key         []string `json:"key"`
+}
+
+func generateCertificate(args []string) error {
+	fs := flag.NewFlagSet("tls cert", flag.ContinueOnError)
+	var names stringList
+	fs.Var(&names, "san", "Subject alternative name, a domain or an IP. Multiple assign is accepted.")
+	commonName := fs.String("name", "V2Ray", "Common name of the certificate.")
+	organization := fs.String("org", "V2Ray", "Organization of the certificate.")
+	expire := fs.Duration("expire", time.Hour*24*90, "Time until the certificate expires.")
+	isCA := fs.Bool("ca", false, "Generate a CA, which signs other certificates.")
+	issuer := fs.String("issuer", "", "Sign the certificate with the CA in the files of this name, as written by -file.")
+	client := fs.Bool("client", false, "The certificate may also authenticate clients, for mutual TLS.")
+	jsonOutput := fs.Bool("json", false, "Print the certificate in JSON, which is the default without -file.")
+	fileOutput := fs.String("file", "", "Write the certificate and the key to NAME_cert.pem and NAME_key.pem.")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: v2ray tls cert [-ca] [-name name] [-san name]... [-expire duration] [-issuer name] [-client] [-json] [-file name]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *expire <= 0 {
+		return newError("invalid expire duration: ", *expire)
+	}
+
+	opts := []cert.Option{
+		cert.CommonName(*commonName),
+		cert.Organization(*organization),
+		cert.NotAfter(time.Now().Add(*expire)),
+	}
+	var domains []string
+	var ips []net.IP
+	for _, name := range names {
+		if ip := net.ParseIP(name); ip != nil {
+			ips = append(ips, ip)
+		} else {
+			domains = append(domains, name)
+		}
+	}
+	if len(domains) > 0 {
+		opts = append(opts, cert.DNSNames(domains...))
+	}
+	if len(ips) > 0 {
+		opts = append(opts, cert.IPAddresses(ips...))
+	}
+	switch {
+	case *isCA:
+		opts = append(opts,
+			cert.Authority(true),
+			cert.KeyUsage(x509.KeyUsageCertSign|x509.KeyUsageCRLSign|x509.KeyUsageDigitalSignature),
+			cert.ExtKeyUsage())
+	case *client:
+		opts = append(opts, cert.ExtKeyUsage(x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth))
+	}
+
+	var parent *cert.Certificate
+	if len(*issuer) > 0 {
+		certPEM, err := ioutil.ReadFile(*issuer + "_cert.pem")
+		if err != nil {
+			return newError("failed to read issuer certificate").Base(err)
+		}
+		keyPEM, err := ioutil.ReadFile(*issuer + "_key.pem")
+		if err != nil {
+			return newError("failed to read issuer key").Base(err)
+		}
+		parent, err = cert.ParseCertificate(certPEM, keyPEM)
+		if err != nil {
+			return newError("failed to parse issuer").Base(err)
+		}
+	}
+
+	certificate, err := cert.Generate(parent, opts...)
+	if err != nil {
+		return newError("failed to generate TLS certificate").Base(err)
+	}
+	certPEM, keyPEM := certificate.ToPEM()
+
+	if len(*fileOutput) > 0 {
+		if err := ioutil.WriteFile(*fileOutput+"_cert.pem", certPEM, 0644); err != nil {
+			return newError("failed to write certificate").Base(err)
+		}
+		if err := ioutil.WriteFile(*fileOutput+"_key.pem", keyPEM, 0600); err != nil {
+			return newError("failed to write key").Base(err)
+		}
+	}
+	if *jsonOutput || len(*fileOutput) == 0 {
+		content, err := json.MarshalIndent(&jsonCertificate{
+			Certificate: strings.Split(strings.TrimSpace(string(certPEM)), "\n"),
+			Key:         strings.Split(strings.TrimSpace(string(keyPEM)), "\n"),
+		}, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(content))
+	}
+	return nil
+}
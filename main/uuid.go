@@ -0,0 +1,32 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"v2ray.com/core/common/uuid"
+)
+
+// generateUUID implements the "uuid" subcommand, which prints new random UUIDs, one per line:
+//
+//	v2ray uuid -n 3
+func generateUUID(args []string) error {
+	fs := flag.NewFlagSet("uuid", flag.ContinueOnError)
+	count := fs.Int("n", 1, "Number of UUIDs to generate.")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: v2ray uuid [-n count]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *count < 1 {
+		return newError("invalid number of UUIDs: ", *count)
+	}
+
+	for i := 0; i < *count; i++ {
+		u := uuid.New()
+		fmt.Println(u.String())
+	}
+	return nil
+}
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"v2ray.com/core/common"
+	"v2ray.com/core/proxy"
 	"v2ray.com/core/transport"
 	"v2ray.com/core/transport/internet"
 )
@@ -25,6 +26,11 @@ func New(ctx context.Context, config *Config) (*Handler, error) {
 	if err != nil {
 		return nil, err
 	}
+	if r, ok := response.(*HTTPResponse); ok && isCustomHTTPResponse(r) {
+		if response, err = newHTTPTemplateResponse(r); err != nil {
+			return nil, err
+		}
+	}
 	return &Handler{
 		response: response,
 	}, nil
@@ -32,7 +38,12 @@ func New(ctx context.Context, config *Config) (*Handler, error) {
 
 // Process implements OutboundHandler.Dispatch().
 func (h *Handler) Process(ctx context.Context, link *transport.Link, dialer internet.Dialer) error {
-	nBytes := h.response.WriteTo(link.Writer)
+	var nBytes int32
+	if response, ok := h.response.(contextualResponse); ok {
+		nBytes = response.Respond(ctx, link)
+	} else {
+		nBytes = h.response.WriteTo(link.Writer)
+	}
 	if nBytes > 0 {
 		// Sleep a little here to make sure the response is sent to client.
 		time.Sleep(time.Second)
@@ -45,4 +56,5 @@ func init() {
 	common.Must(common.RegisterConfig((*Config)(nil), func(ctx context.Context, config interface{}) (interface{}, error) {
 		return New(ctx, config.(*Config))
 	}))
+	common.Must(proxy.RegisterOutboundConfig((*Config)(nil)))
 }
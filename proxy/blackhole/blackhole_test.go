@@ -1,12 +1,18 @@
 package blackhole_test
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"io/ioutil"
+	"net/http"
 	"testing"
 
 	"v2ray.com/core/common"
 	"v2ray.com/core/common/buf"
+	"v2ray.com/core/common/net"
 	"v2ray.com/core/common/serial"
+	"v2ray.com/core/common/session"
 	"v2ray.com/core/proxy/blackhole"
 	"v2ray.com/core/transport"
 	"v2ray.com/core/transport/pipe"
@@ -38,3 +44,62 @@ func TestBlackHoleHTTPResponse(t *testing.T) {
 		t.Error("expect http response, but nothing")
 	}
 }
+
+func TestBlackHoleCustomHTTPResponse(t *testing.T) {
+	handler, err := blackhole.New(context.Background(), &blackhole.Config{
+		Response: serial.ToTypedMessage(&blackhole.HTTPResponse{
+			StatusCode: 451,
+			Header: map[string]string{
+				"X-Blocked": "yes",
+			},
+			Body: "<p>{{.Domain}} blocked by {{.Rule}}</p>",
+		}),
+	})
+	common.Must(err)
+
+	ctx := session.ContextWithOutbound(context.Background(), &session.Outbound{
+		Target:  net.TCPDestination(net.ParseAddress("1.2.3.4"), 80),
+		RuleTag: "ads<>",
+	})
+
+	process := func(request string) *http.Response {
+		uplinkReader, uplinkWriter := pipe.New(pipe.WithoutSizeLimit())
+		downlinkReader, downlinkWriter := pipe.New(pipe.WithoutSizeLimit())
+		common.Must(uplinkWriter.WriteMultiBuffer(buf.MergeBytes(nil, []byte(request))))
+
+		var mb buf.MultiBuffer
+		readerError := make(chan error)
+		go func() {
+			b, e := downlinkReader.ReadMultiBuffer()
+			mb = b
+			readerError <- e
+		}()
+
+		common.Must(handler.Process(ctx, &transport.Link{Reader: uplinkReader, Writer: downlinkWriter}, nil))
+		common.Must(<-readerError)
+		b := make([]byte, mb.Len())
+		mb.Copy(b)
+
+		response, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(b)), nil)
+		common.Must(err)
+		return response
+	}
+
+	response := process("GET / HTTP/1.1\r\nHost: example.com\r\n\r\n")
+	if response.StatusCode != 451 {
+		t.Error("status code: ", response.StatusCode)
+	}
+	if v := response.Header.Get("X-Blocked"); v != "yes" {
+		t.Error("header: ", v)
+	}
+	body, err := ioutil.ReadAll(response.Body)
+	common.Must(err)
+	if string(body) != "<p>example.com blocked by ads&lt;&gt;</p>" {
+		t.Error("body: ", string(body))
+	}
+
+	response = process("\x16\x03\x01\x02\x00")
+	if response.StatusCode != 403 {
+		t.Error("status code of non HTTP request: ", response.StatusCode)
+	}
+}
@@ -0,0 +1,151 @@
+// +build !confonly
+
+package blackhole
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+	"time"
+
+	"v2ray.com/core/common"
+	"v2ray.com/core/common/buf"
+	http_proto "v2ray.com/core/common/protocol/http"
+	"v2ray.com/core/common/session"
+	"v2ray.com/core/transport"
+)
+
+// requestReadTimeout limits how long the blackhole waits for the request it answers.
+const requestReadTimeout = time.Second
+
+// contextualResponse is a response that depends on the connection it answers.
+type contextualResponse interface {
+	ResponseConfig
+
+	// Respond writes the response to the given link, and returns the number of bytes written.
+	Respond(ctx context.Context, link *transport.Link) int32
+}
+
+// httpResponseVars are the variables available to the body template of an HTTP response.
+type httpResponseVars struct {
+	Domain string
+	Rule   string
+}
+
+// httpTemplateResponse is an HTTP response customized by the configuration. Connections that
+// don't carry HTTP get the default response of HTTPResponse.
+type httpTemplateResponse struct {
+	config *HTTPResponse
+	body   *template.Template
+}
+
+func isCustomHTTPResponse(r *HTTPResponse) bool {
+	return r.StatusCode != 0 || len(r.Header) > 0 || len(r.Body) > 0
+}
+
+func newHTTPTemplateResponse(config *HTTPResponse) (*httpTemplateResponse, error) {
+	if config.StatusCode != 0 && (config.StatusCode < 100 || config.StatusCode > 999) {
+		return nil, newError("invalid HTTP status code ", config.StatusCode)
+	}
+	body, err := template.New("body").Parse(config.Body)
+	if err != nil {
+		return nil, newError("invalid template of HTTP response body").Base(err)
+	}
+	return &httpTemplateResponse{
+		config: config,
+		body:   body,
+	}, nil
+}
+
+// WriteTo implements ResponseConfig.
+func (r *httpTemplateResponse) WriteTo(writer buf.Writer) int32 {
+	return r.config.WriteTo(writer)
+}
+
+// Respond implements contextualResponse.
+func (r *httpTemplateResponse) Respond(ctx context.Context, link *transport.Link) int32 {
+	var vars httpResponseVars
+	if outbound := session.OutboundFromContext(ctx); outbound != nil {
+		vars.Rule = outbound.RuleTag
+		if outbound.Target.Address != nil && outbound.Target.Address.Family().IsDomain() {
+			vars.Domain = outbound.Target.Address.Domain()
+		}
+	}
+
+	header, err := readHTTPRequest(link.Reader)
+	if err != nil {
+		newError("responding to non HTTP request with default response").Base(err).AtDebug().WriteToLog(session.ExportIDToError(ctx))
+		return r.WriteTo(link.Writer)
+	}
+	if len(vars.Domain) == 0 {
+		vars.Domain = header.Domain()
+	}
+
+	response, err := r.render(&vars)
+	if err != nil {
+		newError("failed to render HTTP response").Base(err).AtWarning().WriteToLog(session.ExportIDToError(ctx))
+		return r.WriteTo(link.Writer)
+	}
+	mb := buf.MergeBytes(nil, response)
+	n := mb.Len()
+	link.Writer.WriteMultiBuffer(mb)
+	return n
+}
+
+func (r *httpTemplateResponse) render(vars *httpResponseVars) ([]byte, error) {
+	var body bytes.Buffer
+	if err := r.body.Execute(&body, vars); err != nil {
+		return nil, err
+	}
+
+	statusCode := int(r.config.StatusCode)
+	if statusCode == 0 {
+		statusCode = http.StatusForbidden
+	}
+
+	header := make(http.Header)
+	for key, value := range r.config.Header {
+		header.Set(key, value)
+	}
+	if body.Len() > 0 && len(header.Get("Content-Type")) == 0 {
+		header.Set("Content-Type", "text/html; charset=utf-8")
+	}
+	header.Set("Connection", "close")
+	header.Set("Content-Length", fmt.Sprint(body.Len()))
+
+	keys := make([]string, 0, len(header))
+	for key := range header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var response bytes.Buffer
+	fmt.Fprintf(&response, "HTTP/1.1 %d %s\r\n", statusCode, http.StatusText(statusCode))
+	for _, key := range keys {
+		fmt.Fprintf(&response, "%s: %s\r\n", key, header.Get(key))
+	}
+	response.WriteString("\r\n")
+	common.Must2(body.WriteTo(&response))
+	return response.Bytes(), nil
+}
+
+// readHTTPRequest reads the beginning of the request on the connection, and returns its header if
+// it is HTTP.
+func readHTTPRequest(reader buf.Reader) (*http_proto.SniffHeader, error) {
+	timeoutReader, ok := reader.(buf.TimeoutReader)
+	if !ok {
+		return nil, buf.ErrNotTimeoutReader
+	}
+	mb, err := timeoutReader.ReadMultiBufferTimeout(requestReadTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer buf.ReleaseMulti(mb)
+
+	b := make([]byte, mb.Len())
+	mb.Copy(b)
+	return http_proto.SniffHTTP(b)
+}
@@ -17,6 +17,7 @@ import (
 	"v2ray.com/core/common/session"
 	"v2ray.com/core/common/task"
 	"v2ray.com/core/features/dns"
+	"v2ray.com/core/proxy"
 	"v2ray.com/core/transport"
 	"v2ray.com/core/transport/internet"
 )
@@ -31,6 +32,7 @@ func init() {
 		}
 		return h, nil
 	}))
+	common.Must(proxy.RegisterOutboundConfig((*Config)(nil)))
 }
 
 type ownLinkVerifier interface {
@@ -38,24 +40,19 @@ type ownLinkVerifier interface {
 }
 
 type Handler struct {
-	ipv4Lookup      dns.IPv4Lookup
-	ipv6Lookup      dns.IPv6Lookup
+	client          dns.Client
 	ownLinkVerifier ownLinkVerifier
 	server          net.Destination
 }
 
 func (h *Handler) Init(config *Config, dnsClient dns.Client) error {
-	ipv4lookup, ok := dnsClient.(dns.IPv4Lookup)
-	if !ok {
+	if _, ok := dnsClient.(dns.IPv4Lookup); !ok {
 		return newError("dns.Client doesn't implement IPv4Lookup")
 	}
-	h.ipv4Lookup = ipv4lookup
-
-	ipv6lookup, ok := dnsClient.(dns.IPv6Lookup)
-	if !ok {
+	if _, ok := dnsClient.(dns.IPv6Lookup); !ok {
 		return newError("dns.Client doesn't implement IPv6Lookup")
 	}
-	h.ipv6Lookup = ipv6lookup
+	h.client = dnsClient
 
 	if v, ok := dnsClient.(ownLinkVerifier); ok {
 		h.ownLinkVerifier = v
@@ -71,18 +68,18 @@ func (h *Handler) isOwnLink(ctx context.Context) bool {
 	return h.ownLinkVerifier != nil && h.ownLinkVerifier.IsOwnLink(ctx)
 }
 
-func parseIPQuery(b []byte) (r bool, domain string, id uint16, qType dnsmessage.Type) {
+func parseIPQuery(ctx context.Context, b []byte) (r bool, domain string, id uint16, qType dnsmessage.Type) {
 	var parser dnsmessage.Parser
 	header, err := parser.Start(b)
 	if err != nil {
-		newError("parser start").Base(err).WriteToLog()
+		newError("parser start").Base(err).WriteToLog(session.ExportIDToError(ctx))
 		return
 	}
 
 	id = header.ID
 	q, err := parser.Question()
 	if err != nil {
-		newError("question").Base(err).WriteToLog()
+		newError("question").Base(err).WriteToLog(session.ExportIDToError(ctx))
 		return
 	}
 	qType = q.Type
@@ -118,6 +115,7 @@ func (h *Handler) Process(ctx context.Context, link *transport.Link, d internet.
 	newError("handling DNS traffic to ", dest).WriteToLog(session.ExportIDToError(ctx))
 
 	conn := &outboundConn{
+		ctx: ctx,
 		dialer: func() (internet.Connection, error) {
 			return d.Dial(ctx, dest)
 		},
@@ -170,9 +168,9 @@ func (h *Handler) Process(ctx context.Context, link *transport.Link, d internet.
 			}
 
 			if !h.isOwnLink(ctx) {
-				isIPQuery, domain, id, qType := parseIPQuery(b.Bytes())
+				isIPQuery, domain, id, qType := parseIPQuery(ctx, b.Bytes())
 				if isIPQuery {
-					go h.handleIPQuery(id, qType, domain, writer)
+					go h.handleIPQuery(ctx, id, qType, domain, writer)
 					continue
 				}
 			}
@@ -207,20 +205,21 @@ func (h *Handler) Process(ctx context.Context, link *transport.Link, d internet.
 	return nil
 }
 
-func (h *Handler) handleIPQuery(id uint16, qType dnsmessage.Type, domain string, writer dns_proto.MessageWriter) {
+func (h *Handler) handleIPQuery(ctx context.Context, id uint16, qType dnsmessage.Type, domain string, writer dns_proto.MessageWriter) {
 	var ips []net.IP
 	var err error
 
+	client := dns.ClientWithContext(ctx, h.client)
 	switch qType {
 	case dnsmessage.TypeA:
-		ips, err = h.ipv4Lookup.LookupIPv4(domain)
+		ips, err = client.(dns.IPv4Lookup).LookupIPv4(domain)
 	case dnsmessage.TypeAAAA:
-		ips, err = h.ipv6Lookup.LookupIPv6(domain)
+		ips, err = client.(dns.IPv6Lookup).LookupIPv6(domain)
 	}
 
 	rcode := dns.RCodeFromError(err)
 	if rcode == 0 && len(ips) == 0 && err != dns.ErrEmptyResponse {
-		newError("ip query").Base(err).WriteToLog()
+		newError("ip query").Base(err).WriteToLog(session.ExportIDToError(ctx))
 		return
 	}
 
@@ -257,19 +256,20 @@ func (h *Handler) handleIPQuery(id uint16, qType dnsmessage.Type, domain string,
 	}
 	msgBytes, err := builder.Finish()
 	if err != nil {
-		newError("pack message").Base(err).WriteToLog()
+		newError("pack message").Base(err).WriteToLog(session.ExportIDToError(ctx))
 		b.Release()
 		return
 	}
 	b.Resize(0, int32(len(msgBytes)))
 
 	if err := writer.WriteMessage(b); err != nil {
-		newError("write IP answer").Base(err).WriteToLog()
+		newError("write IP answer").Base(err).WriteToLog(session.ExportIDToError(ctx))
 	}
 }
 
 type outboundConn struct {
 	access sync.Mutex
+	ctx    context.Context
 	dialer func() (internet.Connection, error)
 
 	conn      net.Conn
@@ -292,7 +292,7 @@ func (c *outboundConn) Write(b []byte) (int, error) {
 	if c.conn == nil {
 		if err := c.dial(); err != nil {
 			c.access.Unlock()
-			newError("failed to dial outbound connection").Base(err).AtWarning().WriteToLog()
+			newError("failed to dial outbound connection").Base(err).AtWarning().WriteToLog(session.ExportIDToError(c.ctx))
 			return len(b), nil
 		}
 	}
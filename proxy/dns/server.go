@@ -0,0 +1,348 @@
+// +build !confonly
+
+package dns
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"v2ray.com/core"
+	"v2ray.com/core/common"
+	"v2ray.com/core/common/buf"
+	"v2ray.com/core/common/errors"
+	"v2ray.com/core/common/net"
+	"v2ray.com/core/common/protocol"
+	dns_proto "v2ray.com/core/common/protocol/dns"
+	"v2ray.com/core/common/session"
+	"v2ray.com/core/features/dns"
+	"v2ray.com/core/features/policy"
+	"v2ray.com/core/features/routing"
+	"v2ray.com/core/proxy"
+	"v2ray.com/core/transport/internet"
+)
+
+func init() {
+	common.Must(common.RegisterConfig((*ServerConfig)(nil), func(ctx context.Context, config interface{}) (interface{}, error) {
+		s := &Server{config: config.(*ServerConfig)}
+		if err := core.RequireFeatures(ctx, func(dnsClient dns.Client, pm policy.Manager) error {
+			if _, ok := dnsClient.(dns.IPv4Lookup); !ok {
+				return newError("dns.Client doesn't implement IPv4Lookup")
+			}
+			if _, ok := dnsClient.(dns.IPv6Lookup); !ok {
+				return newError("dns.Client doesn't implement IPv6Lookup")
+			}
+			s.client = dnsClient
+			s.policyManager = pm
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+		return s, nil
+	}))
+	common.Must(proxy.RegisterInboundConfig((*ServerConfig)(nil)))
+}
+
+const (
+	// maxUDPSize is the UDP payload size of responses advertised in EDNS0, as recommended by DNS Flag Day 2020
+	// to avoid fragmentation.
+	maxUDPSize = 1232
+	// answerTTL is the TTL of answers, as the DNS app doesn't tell the TTLs of records.
+	answerTTL = 600
+
+	typeIXFR        dnsmessage.Type  = 251
+	rcodeBadVersion dnsmessage.RCode = 16
+)
+
+// Server is an inbound handler that answers DNS queries of clients over UDP and TCP. A and AAAA queries are
+// answered by the DNS app, with its hosts, fake DNS and name servers. Zone transfers and ANY queries are
+// refused. Queries of other types are answered with NOTIMP, as the DNS app only looks up addresses, and an
+// empty answer would tell clients that the domain has no such records.
+type Server struct {
+	client        dns.Client
+	policyManager policy.Manager
+	config        *ServerConfig
+}
+
+// Network implements proxy.Inbound.
+func (s *Server) Network() []net.Network {
+	return []net.Network{net.Network_TCP, net.Network_UDP}
+}
+
+// Process implements proxy.Inbound.
+func (s *Server) Process(ctx context.Context, network net.Network, conn internet.Connection, dispatcher routing.Dispatcher) error {
+	plcy := s.policyManager.ForLevel(s.config.UserLevel)
+	if inbound := session.InboundFromContext(ctx); inbound != nil {
+		inbound.User = &protocol.MemoryUser{
+			Level: s.config.UserLevel,
+		}
+	}
+
+	var reader dns_proto.MessageReader
+	var writer dns_proto.MessageWriter
+	if network == net.Network_TCP {
+		reader = dns_proto.NewTCPReader(buf.NewReader(conn))
+		writer = &dns_proto.TCPWriter{
+			Writer: buf.NewWriter(conn),
+		}
+	} else {
+		reader = &dns_proto.UDPReader{
+			Reader: buf.NewPacketReader(conn),
+		}
+		writer = &dns_proto.UDPWriter{
+			Writer: buf.NewWriter(conn),
+		}
+	}
+
+	// Queries are answered concurrently, as clients match responses by IDs.
+	var access sync.Mutex
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		if network == net.Network_TCP {
+			if err := conn.SetReadDeadline(time.Now().Add(plcy.Timeouts.ConnectionIdle)); err != nil {
+				newError("failed to set read deadline").Base(err).WriteToLog(session.ExportIDToError(ctx))
+			}
+		}
+		b, err := reader.ReadMessage()
+		if err != nil {
+			if errors.Cause(err) == io.EOF {
+				return nil
+			}
+			return newError("failed to read query").Base(err)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			response := s.answer(ctx, b.Bytes(), network)
+			b.Release()
+			if response == nil {
+				return
+			}
+			access.Lock()
+			err := writer.WriteMessage(response)
+			access.Unlock()
+			if err != nil {
+				newError("failed to write response").Base(err).WriteToLog(session.ExportIDToError(ctx))
+			}
+		}()
+	}
+}
+
+// query is a parsed DNS query.
+type query struct {
+	header    dnsmessage.Header
+	questions []dnsmessage.Question
+	// edns is whether the query has an OPT record, with the UDP payload size and the version in it.
+	edns        bool
+	udpSize     int
+	ednsVersion int
+}
+
+// parseQuery parses the query. It returns the query with the header only, and an error, if the rest of the
+// query is malformed, or nil if the query can't be answered at all.
+func parseQuery(b []byte) (*query, error) {
+	var parser dnsmessage.Parser
+	header, err := parser.Start(b)
+	if err != nil {
+		return nil, err
+	}
+	if header.Response {
+		return nil, newError("not a query")
+	}
+	q := &query{header: header}
+
+	questions, err := parser.AllQuestions()
+	if err != nil {
+		return q, err
+	}
+	if err := parser.SkipAllAnswers(); err != nil {
+		return q, err
+	}
+	if err := parser.SkipAllAuthorities(); err != nil {
+		return q, err
+	}
+	for {
+		h, err := parser.AdditionalHeader()
+		if err == dnsmessage.ErrSectionDone {
+			break
+		}
+		if err != nil {
+			return q, err
+		}
+		if h.Type == dnsmessage.TypeOPT {
+			q.edns = true
+			q.udpSize = int(h.Class)
+			q.ednsVersion = int(h.TTL>>16) & 0xff
+		}
+		if err := parser.SkipAdditional(); err != nil {
+			return q, err
+		}
+	}
+	q.questions = questions
+	return q, nil
+}
+
+// response builds the response to the query, with the answers if not truncated.
+func (q *query) response(rcode dnsmessage.RCode, ips []net.IP, truncated bool) ([]byte, error) {
+	builder := dnsmessage.NewBuilder(nil, dnsmessage.Header{
+		ID:                 q.header.ID,
+		Response:           true,
+		OpCode:             q.header.OpCode,
+		Truncated:          truncated,
+		RecursionDesired:   q.header.RecursionDesired,
+		RecursionAvailable: true,
+		// The upper bits of extended RCodes are in the OPT record.
+		RCode: rcode & 0xf,
+	})
+	builder.EnableCompression()
+	if err := builder.StartQuestions(); err != nil {
+		return nil, err
+	}
+	for _, question := range q.questions {
+		if err := builder.Question(question); err != nil {
+			return nil, err
+		}
+	}
+	if err := builder.StartAnswers(); err != nil {
+		return nil, err
+	}
+	if !truncated {
+		for _, ip := range ips {
+			rHeader := dnsmessage.ResourceHeader{Name: q.questions[0].Name, Class: dnsmessage.ClassINET, TTL: answerTTL}
+			if ip4 := ip.To4(); ip4 != nil {
+				var r dnsmessage.AResource
+				copy(r.A[:], ip4)
+				if err := builder.AResource(rHeader, r); err != nil {
+					return nil, err
+				}
+			} else {
+				var r dnsmessage.AAAAResource
+				copy(r.AAAA[:], ip)
+				if err := builder.AAAAResource(rHeader, r); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	if err := builder.StartAdditionals(); err != nil {
+		return nil, err
+	}
+	if q.edns {
+		var rHeader dnsmessage.ResourceHeader
+		if err := rHeader.SetEDNS0(maxUDPSize, rcode, false); err != nil {
+			return nil, err
+		}
+		if err := builder.OPTResource(rHeader, dnsmessage.OPTResource{}); err != nil {
+			return nil, err
+		}
+	}
+	return builder.Finish()
+}
+
+// answer returns the response to the query, or nil if the query is dropped.
+func (s *Server) answer(ctx context.Context, b []byte, network net.Network) *buf.Buffer {
+	q, err := parseQuery(b)
+	if q == nil {
+		newError("dropping invalid query").Base(err).AtDebug().WriteToLog(session.ExportIDToError(ctx))
+		return nil
+	}
+
+	var rcode dnsmessage.RCode
+	var ips []net.IP
+	switch {
+	case err != nil:
+		rcode = dnsmessage.RCodeFormatError
+	case q.ednsVersion > 0:
+		rcode = rcodeBadVersion
+	case q.header.OpCode != 0:
+		rcode = dnsmessage.RCodeNotImplemented
+	case len(q.questions) != 1:
+		rcode = dnsmessage.RCodeFormatError
+	default:
+		rcode, ips = s.lookup(ctx, q.questions[0])
+	}
+
+	// Responses over UDP are truncated to the size the client takes, and over TCP to the size of messages.
+	size := buf.Size
+	if network == net.Network_UDP {
+		size = 512
+		if q.edns && q.udpSize > size {
+			size = q.udpSize
+		}
+		if size > maxUDPSize {
+			size = maxUDPSize
+		}
+	}
+	msg, err := q.response(rcode, ips, false)
+	if err == nil && len(msg) > size {
+		msg, err = q.response(rcode, nil, true)
+	}
+	if err != nil {
+		newError("failed to pack response").Base(err).WriteToLog(session.ExportIDToError(ctx))
+		return nil
+	}
+
+	response := buf.New()
+	common.Must2(response.Write(msg))
+	return response
+}
+
+// lookup answers the question by the DNS app. The domain of the question is the sniffed domain of the
+// session of the lookup.
+func (s *Server) lookup(ctx context.Context, question dnsmessage.Question) (dnsmessage.RCode, []net.IP) {
+	if question.Class != dnsmessage.ClassINET {
+		return dnsmessage.RCodeRefused, nil
+	}
+	switch question.Type {
+	case dnsmessage.TypeAXFR, typeIXFR, dnsmessage.TypeALL:
+		newError("refusing ", question.Type, " query for ", question.Name).AtDebug().WriteToLog(session.ExportIDToError(ctx))
+		return dnsmessage.RCodeRefused, nil
+	case dnsmessage.TypeA, dnsmessage.TypeAAAA:
+	default:
+		newError("unsupported ", question.Type, " query for ", question.Name).AtDebug().WriteToLog(session.ExportIDToError(ctx))
+		return dnsmessage.RCodeNotImplemented, nil
+	}
+
+	domain := strings.TrimSuffix(question.Name.String(), ".")
+	if len(domain) == 0 {
+		return dnsmessage.RCodeSuccess, nil
+	}
+	ctx = session.ContextWithContent(ctx, &session.Content{
+		Protocol:      "dns",
+		SniffedDomain: domain,
+	})
+	client := dns.ClientWithContext(ctx, s.client)
+
+	var ips []net.IP
+	var err error
+	if question.Type == dnsmessage.TypeA {
+		ips, err = client.(dns.IPv4Lookup).LookupIPv4(domain)
+	} else {
+		ips, err = client.(dns.IPv6Lookup).LookupIPv6(domain)
+	}
+	answers := make([]net.IP, 0, len(ips))
+	for _, ip := range ips {
+		if (ip.To4() != nil) == (question.Type == dnsmessage.TypeA) {
+			answers = append(answers, ip)
+		}
+	}
+	if len(answers) > 0 {
+		return dnsmessage.RCodeSuccess, answers
+	}
+	if rcode := dns.RCodeFromError(err); rcode != 0 {
+		return dnsmessage.RCode(rcode), nil
+	}
+	if err == nil || errors.Cause(err) == dns.ErrEmptyResponse {
+		return dnsmessage.RCodeSuccess, nil
+	}
+	newError("failed to lookup ", domain).Base(err).WriteToLog(session.ExportIDToError(ctx))
+	return dnsmessage.RCodeServerFailure, nil
+}
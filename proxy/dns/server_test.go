@@ -0,0 +1,130 @@
+package dns_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"v2ray.com/core"
+	"v2ray.com/core/app/dispatcher"
+	dnsapp "v2ray.com/core/app/dns"
+	"v2ray.com/core/app/policy"
+	"v2ray.com/core/app/proxyman"
+	"v2ray.com/core/common"
+	"v2ray.com/core/common/net"
+	"v2ray.com/core/common/serial"
+	dns_proxy "v2ray.com/core/proxy/dns"
+	"v2ray.com/core/proxy/freedom"
+	"v2ray.com/core/testing/servers/tcp"
+)
+
+func TestDNSServer(t *testing.T) {
+	var manyIPs [][]byte
+	for i := 0; i < 60; i++ {
+		manyIPs = append(manyIPs, []byte{10, 0, 0, byte(i + 1)})
+	}
+
+	serverPort := tcp.PickPort()
+	config := &core.Config{
+		App: []*serial.TypedMessage{
+			serial.ToTypedMessage(&dnsapp.Config{
+				StaticHosts: []*dnsapp.Config_HostMapping{
+					{
+						Type:   dnsapp.DomainMatchingType_Full,
+						Domain: "example.com",
+						Ip:     [][]byte{{1, 2, 3, 4}, net.ParseAddress("2001:db8::1").IP()},
+					},
+					{
+						Type:   dnsapp.DomainMatchingType_Full,
+						Domain: "many.example.com",
+						Ip:     manyIPs,
+					},
+				},
+			}),
+			serial.ToTypedMessage(&dispatcher.Config{}),
+			serial.ToTypedMessage(&proxyman.OutboundConfig{}),
+			serial.ToTypedMessage(&proxyman.InboundConfig{}),
+			serial.ToTypedMessage(&policy.Config{}),
+		},
+		Inbound: []*core.InboundHandlerConfig{
+			{
+				ProxySettings: serial.ToTypedMessage(&dns_proxy.ServerConfig{}),
+				ReceiverSettings: serial.ToTypedMessage(&proxyman.ReceiverConfig{
+					PortRange: net.SinglePortRange(serverPort),
+					Listen:    net.NewIPOrDomain(net.LocalHostIP),
+				}),
+			},
+		},
+		Outbound: []*core.OutboundHandlerConfig{
+			{
+				ProxySettings: serial.ToTypedMessage(&freedom.Config{}),
+			},
+		},
+	}
+
+	v, err := core.New(config)
+	common.Must(err)
+	common.Must(v.Start())
+	defer v.Close()
+
+	server := "127.0.0.1:" + serverPort.String()
+	exchange := func(network string, name string, qtype uint16, edns bool) *dns.Msg {
+		m := new(dns.Msg)
+		m.SetQuestion(name, qtype)
+		if edns {
+			m.SetEdns0(1232, false)
+		}
+		c := &dns.Client{Net: network, Timeout: time.Second * 5}
+		in, _, err := c.Exchange(m, server)
+		if err != nil {
+			t.Fatal("failed to exchange ", name, " over ", network, ": ", err)
+		}
+		if in.Id != m.Id {
+			t.Error("unexpected ID: ", in.Id)
+		}
+		return in
+	}
+
+	for _, network := range []string{"udp", "tcp"} {
+		in := exchange(network, "example.com.", dns.TypeA, false)
+		if in.Rcode != dns.RcodeSuccess || len(in.Answer) != 1 {
+			t.Fatal("unexpected response over ", network, ": ", in)
+		}
+		if a, ok := in.Answer[0].(*dns.A); !ok || !a.A.Equal(net.IP{1, 2, 3, 4}) {
+			t.Error("unexpected answer: ", in.Answer[0])
+		}
+	}
+
+	if in := exchange("udp", "example.com.", dns.TypeAAAA, false); len(in.Answer) != 1 {
+		t.Error("unexpected AAAA response: ", in)
+	} else if aaaa, ok := in.Answer[0].(*dns.AAAA); !ok || aaaa.AAAA.String() != "2001:db8::1" {
+		t.Error("unexpected AAAA answer: ", in.Answer[0])
+	}
+
+	for _, qtype := range []uint16{dns.TypeANY, dns.TypeAXFR} {
+		if in := exchange("tcp", "example.com.", qtype, false); in.Rcode != dns.RcodeRefused {
+			t.Error("expected REFUSED for type ", qtype, ", but got ", in.Rcode)
+		}
+	}
+
+	for _, qtype := range []uint16{dns.TypeMX, dns.TypeTXT, dns.TypeSRV} {
+		if in := exchange("udp", "example.com.", qtype, false); in.Rcode != dns.RcodeNotImplemented || len(in.Answer) != 0 {
+			t.Error("expected NOTIMP for type ", qtype, ", but got ", in)
+		}
+	}
+
+	if in := exchange("udp", "example.com.", dns.TypeA, true); in.IsEdns0() == nil || in.IsEdns0().UDPSize() != 1232 {
+		t.Error("expected OPT record in response: ", in)
+	}
+
+	if in := exchange("udp", "many.example.com.", dns.TypeA, false); !in.Truncated || len(in.Answer) != 0 {
+		t.Error("expected truncated response: ", in)
+	}
+	if in := exchange("udp", "many.example.com.", dns.TypeA, true); in.Truncated || len(in.Answer) != len(manyIPs) {
+		t.Error("expected full response with EDNS0, but got ", len(in.Answer), " answers")
+	}
+	if in := exchange("tcp", "many.example.com.", dns.TypeA, false); in.Truncated || len(in.Answer) != len(manyIPs) {
+		t.Error("expected full response over TCP, but got ", len(in.Answer), " answers")
+	}
+}
@@ -6,6 +6,7 @@ package dokodemo
 
 import (
 	"context"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -20,25 +21,37 @@ import (
 	"v2ray.com/core/common/task"
 	"v2ray.com/core/features/policy"
 	"v2ray.com/core/features/routing"
+	"v2ray.com/core/features/stats"
+	"v2ray.com/core/proxy"
 	"v2ray.com/core/transport/internet"
 )
 
 func init() {
 	common.Must(common.RegisterConfig((*Config)(nil), func(ctx context.Context, config interface{}) (interface{}, error) {
 		d := new(Door)
-		err := core.RequireFeatures(ctx, func(pm policy.Manager) error {
+		err := core.RequireFeatures(ctx, func(pm policy.Manager, sm stats.Manager) error {
+			d.statsManager = sm
 			return d.Init(config.(*Config), pm, session.SockoptFromContext(ctx))
 		})
 		return d, err
 	}))
+	common.Must(proxy.RegisterInboundConfig((*Config)(nil)))
 }
 
+// routingHintTimeout bounds the wait for a routing hint. Clients send hints as soon as they connect, while
+// clients of protocols where the server speaks first send nothing until the server does.
+const routingHintTimeout = time.Second
+
 type Door struct {
 	policyManager policy.Manager
+	statsManager  stats.Manager
 	config        *Config
 	address       net.Address
 	port          net.Port
 	sockopt       *session.Sockopt
+
+	redirectAccess sync.Mutex
+	redirect       redirector
 }
 
 // Init initializes the Door instance with necessary parameters.
@@ -52,6 +65,10 @@ func (d *Door) Init(config *Config, pm policy.Manager, sockopt *session.Sockopt)
 	d.policyManager = pm
 	d.sockopt = sockopt
 
+	if config.AutoRedirect != nil && !config.FollowRedirect {
+		return newError("auto redirect requires followRedirect")
+	}
+
 	return nil
 }
 
@@ -103,6 +120,12 @@ func (d *Door) Process(ctx context.Context, network net.Network, conn internet.C
 		return newError("unable to get destination")
 	}
 
+	multicast := network == net.Network_UDP && net.IsMulticastOrBroadcast(dest.Address)
+	if multicast && d.config.MulticastOutbound == "" && d.config.DropMulticast {
+		d.countMulticastDropped(ctx)
+		return nil
+	}
+
 	if inbound := session.InboundFromContext(ctx); inbound != nil {
 		inbound.User = &protocol.MemoryUser{
 			Level: d.config.UserLevel,
@@ -118,6 +141,35 @@ func (d *Door) Process(ctx context.Context, network net.Network, conn internet.C
 	newError("received request for ", conn.RemoteAddr()).WriteToLog(session.ExportIDToError(ctx))
 
 	plcy := d.policy()
+
+	var hintReader *buf.BufferedReader
+	if multicast && d.config.MulticastOutbound != "" {
+		newError("sending multicast to outbound [", d.config.MulticastOutbound, "]").AtDebug().WriteToLog(session.ExportIDToError(ctx))
+		ctx = session.ContextWithOutboundTag(ctx, d.config.MulticastOutbound)
+	}
+
+	if network == net.Network_TCP && d.config.AcceptRoutingHint {
+		wait := routingHintTimeout
+		if plcy.Timeouts.Handshake < wait {
+			wait = plcy.Timeouts.Handshake
+		}
+		if err := conn.SetReadDeadline(time.Now().Add(wait)); err != nil {
+			newError("failed to set deadline").Base(err).WriteToLog(session.ExportIDToError(ctx))
+		}
+		hintReader = &buf.BufferedReader{Reader: buf.NewReader(conn)}
+		tag, err := proxy.ReadRoutingHint(hintReader)
+		if err != nil {
+			return newError("failed to read routing hint").Base(err)
+		}
+		if err := conn.SetReadDeadline(time.Time{}); err != nil {
+			newError("failed to clear deadline").Base(err).WriteToLog(session.ExportIDToError(ctx))
+		}
+		if tag != "" {
+			newError("routing hint requests outbound [", tag, "]").WriteToLog(session.ExportIDToError(ctx))
+			ctx = session.ContextWithOutboundTag(ctx, tag)
+		}
+	}
+
 	ctx, cancel := context.WithCancel(ctx)
 	timer := signal.CancelAfterInactivity(ctx, cancel, plcy.Timeouts.ConnectionIdle)
 
@@ -136,7 +188,9 @@ func (d *Door) Process(ctx context.Context, network net.Network, conn internet.C
 		}()
 
 		var reader buf.Reader
-		if dest.Network == net.Network_UDP {
+		if hintReader != nil {
+			reader = hintReader
+		} else if dest.Network == net.Network_UDP {
 			reader = buf.NewPacketReader(conn)
 		} else {
 			reader = buf.NewReader(conn)
@@ -157,7 +211,9 @@ func (d *Door) Process(ctx context.Context, network net.Network, conn internet.C
 		writer = buf.NewWriter(conn)
 	} else {
 		// if we are in TPROXY mode, use linux's udp forging functionality
-		if !destinationOverridden {
+		// Replies to multicast come from the hosts that answer, not from the multicast address, which can't
+		// be a source.
+		if !destinationOverridden || multicast {
 			writer = &buf.SequentialWriter{Writer: conn}
 		} else {
 			sockopt := &internet.SocketConfig{
@@ -212,3 +268,14 @@ func (d *Door) Process(ctx context.Context, network net.Network, conn internet.C
 
 	return nil
 }
+
+// countMulticastDropped counts a dropped multicast packet in the stats of the inbound.
+func (d *Door) countMulticastDropped(ctx context.Context) {
+	inbound := session.InboundFromContext(ctx)
+	if inbound == nil || len(inbound.Tag) == 0 {
+		return
+	}
+	if c, _ := stats.GetOrRegisterCounter(d.statsManager, "inbound>>>"+inbound.Tag+">>>multicast>>>dropped"); c != nil {
+		c.Add(1)
+	}
+}
@@ -0,0 +1,79 @@
+// +build !confonly
+
+package dokodemo
+
+import (
+	"v2ray.com/core/common/net"
+)
+
+const (
+	defaultRedirectFwmark     = 1
+	defaultRedirectRouteTable = 100
+)
+
+// redirectSettings returns the effective auto redirect settings, or nil if auto redirect is disabled.
+func (d *Door) redirectSettings() *AutoRedirect {
+	config := d.config.AutoRedirect
+	if config == nil {
+		return nil
+	}
+
+	settings := &AutoRedirect{
+		Fwmark:     config.Fwmark,
+		RouteTable: config.RouteTable,
+		BypassMark: config.BypassMark,
+	}
+	if settings.Fwmark == 0 {
+		settings.Fwmark = defaultRedirectFwmark
+	}
+	if settings.RouteTable == 0 {
+		settings.RouteTable = defaultRedirectRouteTable
+	}
+	if settings.BypassMark == 0 && d.sockopt != nil {
+		settings.BypassMark = uint32(d.sockopt.Mark)
+	}
+	return settings
+}
+
+// OnListen implements proxy.ListenObserver. It installs TPROXY rules for the listening port, if auto redirect is enabled.
+func (d *Door) OnListen(address net.Address, ports []net.Port) error {
+	settings := d.redirectSettings()
+	if settings == nil {
+		return nil
+	}
+	if len(ports) == 0 {
+		return newError("auto redirect requires a listening port")
+	}
+	if len(ports) > 1 {
+		newError("auto redirect only redirects to the first port ", ports[0]).AtWarning().WriteToLog()
+	}
+	if settings.BypassMark == settings.Fwmark {
+		return newError("bypass mark of auto redirect must differ from its fwmark ", settings.Fwmark)
+	}
+
+	d.redirectAccess.Lock()
+	defer d.redirectAccess.Unlock()
+
+	if d.redirect != nil {
+		return nil
+	}
+	r, err := installRedirect(settings, ports[0])
+	if err != nil {
+		return newError("failed to install auto redirect rules").Base(err)
+	}
+	d.redirect = r
+	return nil
+}
+
+// Close implements common.Closable. It removes TPROXY rules installed by auto redirect.
+func (d *Door) Close() error {
+	d.redirectAccess.Lock()
+	defer d.redirectAccess.Unlock()
+
+	if d.redirect == nil {
+		return nil
+	}
+	err := d.redirect.remove()
+	d.redirect = nil
+	return err
+}
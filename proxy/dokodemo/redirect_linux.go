@@ -0,0 +1,291 @@
+// +build linux
+// +build !confonly
+
+package dokodemo
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"v2ray.com/core/common/net"
+)
+
+const capNetAdmin = 12
+
+var (
+	// Destinations that are never redirected.
+	reservedIPv4 = []string{"0.0.0.0/8", "10.0.0.0/8", "127.0.0.0/8", "169.254.0.0/16", "172.16.0.0/12", "192.168.0.0/16", "224.0.0.0/4", "240.0.0.0/4"}
+	reservedIPv6 = []string{"::1/128", "fc00::/7", "fe80::/10", "ff00::/8"}
+)
+
+type redirector interface {
+	remove() error
+}
+
+type command struct {
+	name  string
+	args  []string
+	stdin string
+}
+
+func (c command) String() string {
+	return c.name + " " + strings.Join(c.args, " ")
+}
+
+// runCommand runs the given command, and returns its combined output on failure.
+var runCommand = func(c command) error {
+	cmd := exec.Command(c.name, c.args...)
+	if c.stdin != "" {
+		cmd.Stdin = strings.NewReader(c.stdin)
+	}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return newError("failed to run '", c, "': ", strings.TrimSpace(string(output))).Base(err)
+	}
+	return nil
+}
+
+var lookPath = exec.LookPath
+
+// hasNetAdmin returns whether the current process has CAP_NET_ADMIN in its effective capabilities.
+func hasNetAdmin() (bool, error) {
+	f, err := os.Open("/proc/self/status")
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "CapEff:") {
+			continue
+		}
+		caps, err := strconv.ParseUint(strings.TrimSpace(line[len("CapEff:"):]), 16, 64)
+		if err != nil {
+			return false, err
+		}
+		return caps&(1<<capNetAdmin) != 0, nil
+	}
+	return false, newError("effective capabilities not found")
+}
+
+// redirectRules is a set of TPROXY rules in a dedicated nftables table or iptables chains,
+// along with the policy routing for redirected packets.
+type redirectRules struct {
+	settings *AutoRedirect
+	port     net.Port
+	nft      bool
+	ipv6     bool
+
+	// undo holds commands to remove what has been installed, in reverse order.
+	undo []command
+}
+
+func installRedirect(settings *AutoRedirect, port net.Port) (redirector, error) {
+	if ok, err := hasNetAdmin(); err != nil {
+		return nil, newError("failed to read capabilities").Base(err)
+	} else if !ok {
+		return nil, newError("auto redirect requires CAP_NET_ADMIN, run V2Ray as root or grant it with setcap")
+	}
+
+	r := &redirectRules{
+		settings: settings,
+		port:     port,
+	}
+
+	if _, err := lookPath("ip"); err != nil {
+		return nil, newError("ip command not found").Base(err)
+	}
+	if _, err := lookPath("nft"); err == nil {
+		r.nft = true
+		r.ipv6 = true
+	} else if _, err := lookPath("iptables"); err == nil {
+		_, err := lookPath("ip6tables")
+		r.ipv6 = err == nil
+	} else {
+		return nil, newError("neither nft nor iptables is found")
+	}
+
+	if err := r.install(); err != nil {
+		r.remove()
+		return nil, err
+	}
+
+	backend := "iptables"
+	if r.nft {
+		backend = "nftables"
+	}
+	newError("installed auto redirect rules to port ", port, " with ", backend).AtInfo().WriteToLog()
+	return r, nil
+}
+
+func (r *redirectRules) name() string {
+	return "v2ray_tproxy_" + r.port.String()
+}
+
+func (r *redirectRules) chain() string {
+	return strings.ToUpper(r.name())
+}
+
+func (r *redirectRules) install() error {
+	if r.nft {
+		if err := r.installNftables(); err != nil {
+			return err
+		}
+	} else {
+		if err := r.installIptables("iptables", reservedIPv4); err != nil {
+			return err
+		}
+		if r.ipv6 {
+			if err := r.installIptables("ip6tables", reservedIPv6); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := r.installRoute("-4"); err != nil {
+		return err
+	}
+	if r.ipv6 {
+		if err := r.installRoute("-6"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nftablesScript returns the nftables table that redirects traffic to the listening port.
+func (r *redirectRules) nftablesScript() string {
+	fwmark := strconv.FormatUint(uint64(r.settings.Fwmark), 10)
+	bypass := strconv.FormatUint(uint64(r.settings.BypassMark), 10)
+	reserved := "\t\tip daddr { " + strings.Join(reservedIPv4, ", ") + " } return\n" +
+		"\t\tip6 daddr { " + strings.Join(reservedIPv6, ", ") + " } return\n"
+
+	var b bytes.Buffer
+	b.WriteString("table inet " + r.name() + " {\n")
+	b.WriteString("\tchain prerouting {\n")
+	b.WriteString("\t\ttype filter hook prerouting priority mangle; policy accept;\n")
+	if r.settings.BypassMark != 0 {
+		b.WriteString("\t\tmeta mark " + bypass + " return\n")
+	}
+	b.WriteString("\t\tfib daddr type local return\n")
+	b.WriteString(reserved)
+	b.WriteString("\t\tmeta l4proto { tcp, udp } meta mark set " + fwmark + " tproxy to :" + r.port.String() + " accept\n")
+	b.WriteString("\t}\n")
+	if r.settings.BypassMark != 0 {
+		b.WriteString("\tchain output {\n")
+		b.WriteString("\t\ttype route hook output priority mangle; policy accept;\n")
+		b.WriteString("\t\tmeta mark " + bypass + " return\n")
+		b.WriteString(reserved)
+		b.WriteString("\t\tmeta l4proto { tcp, udp } meta mark set " + fwmark + "\n")
+		b.WriteString("\t}\n")
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+func (r *redirectRules) installNftables() error {
+	table := command{name: "nft", args: []string{"delete", "table", "inet", r.name()}}
+	// Remove the table left by a previous run, if any.
+	runCommand(table)
+
+	if err := runCommand(command{name: "nft", args: []string{"-f", "-"}, stdin: r.nftablesScript()}); err != nil {
+		return err
+	}
+	r.undo = append(r.undo, table)
+	return nil
+}
+
+// iptablesCommands returns commands to create chains for redirection, and commands to remove them.
+func (r *redirectRules) iptablesCommands(name string, reserved []string) ([]command, []command) {
+	fwmark := strconv.FormatUint(uint64(r.settings.Fwmark), 10)
+	bypass := strconv.FormatUint(uint64(r.settings.BypassMark), 10)
+	port := r.port.String()
+
+	var install, remove []command
+	mangle := func(args ...string) command {
+		return command{name: name, args: append([]string{"-t", "mangle"}, args...)}
+	}
+	addChain := func(chain string, hook string, rules [][]string) {
+		install = append(install, mangle("-N", chain))
+		if r.settings.BypassMark != 0 {
+			install = append(install, mangle("-A", chain, "-m", "mark", "--mark", bypass, "-j", "RETURN"))
+		}
+		install = append(install, mangle("-A", chain, "-m", "addrtype", "--dst-type", "LOCAL", "-j", "RETURN"))
+		for _, cidr := range reserved {
+			install = append(install, mangle("-A", chain, "-d", cidr, "-j", "RETURN"))
+		}
+		for _, rule := range rules {
+			install = append(install, mangle(append([]string{"-A", chain}, rule...)...))
+		}
+		install = append(install, mangle("-A", hook, "-j", chain))
+		remove = append(remove, mangle("-D", hook, "-j", chain), mangle("-F", chain), mangle("-X", chain))
+	}
+
+	addChain(r.chain(), "PREROUTING", [][]string{
+		{"-p", "tcp", "-j", "TPROXY", "--on-port", port, "--tproxy-mark", fwmark},
+		{"-p", "udp", "-j", "TPROXY", "--on-port", port, "--tproxy-mark", fwmark},
+	})
+	if r.settings.BypassMark != 0 {
+		addChain(r.chain()+"_OUT", "OUTPUT", [][]string{
+			{"-p", "tcp", "-j", "MARK", "--set-mark", fwmark},
+			{"-p", "udp", "-j", "MARK", "--set-mark", fwmark},
+		})
+	}
+	return install, remove
+}
+
+func (r *redirectRules) installIptables(name string, reserved []string) error {
+	install, remove := r.iptablesCommands(name, reserved)
+	// Remove the chains left by a previous run, if any.
+	for _, c := range remove {
+		runCommand(c)
+	}
+
+	for i := len(remove) - 1; i >= 0; i-- {
+		r.undo = append(r.undo, remove[i])
+	}
+	for _, c := range install {
+		if err := runCommand(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// installRoute routes packets with fwmark to local. An existing identical route is left untouched on removal.
+func (r *redirectRules) installRoute(family string) error {
+	fwmark := strconv.FormatUint(uint64(r.settings.Fwmark), 10)
+	table := strconv.FormatUint(uint64(r.settings.RouteTable), 10)
+
+	if err := runCommand(command{name: "ip", args: []string{family, "rule", "add", "fwmark", fwmark, "lookup", table}}); err != nil {
+		return err
+	}
+	r.undo = append(r.undo, command{name: "ip", args: []string{family, "rule", "del", "fwmark", fwmark, "lookup", table}})
+
+	err := runCommand(command{name: "ip", args: []string{family, "route", "add", "local", "default", "dev", "lo", "table", table}})
+	switch {
+	case err == nil:
+		r.undo = append(r.undo, command{name: "ip", args: []string{family, "route", "del", "local", "default", "dev", "lo", "table", table}})
+	case strings.Contains(err.Error(), "File exists"):
+	default:
+		return err
+	}
+	return nil
+}
+
+func (r *redirectRules) remove() error {
+	var lastErr error
+	for i := len(r.undo) - 1; i >= 0; i-- {
+		if err := runCommand(r.undo[i]); err != nil {
+			newError("failed to remove auto redirect rule").Base(err).AtWarning().WriteToLog()
+			lastErr = err
+		}
+	}
+	r.undo = nil
+	return lastErr
+}
@@ -0,0 +1,89 @@
+// +build linux
+
+package dokodemo
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRedirectNftablesScript(t *testing.T) {
+	r := &redirectRules{
+		settings: &AutoRedirect{Fwmark: 1, RouteTable: 100, BypassMark: 255},
+		port:     12345,
+		nft:      true,
+	}
+
+	script := r.nftablesScript()
+	for _, s := range []string{
+		"table inet v2ray_tproxy_12345 {",
+		"meta mark 255 return",
+		"meta l4proto { tcp, udp } meta mark set 1 tproxy to :12345 accept",
+		"type route hook output priority mangle",
+	} {
+		if !strings.Contains(script, s) {
+			t.Error("expected ", s, " in script:\n", script)
+		}
+	}
+
+	r.settings.BypassMark = 0
+	script = r.nftablesScript()
+	if strings.Contains(script, "hook output") || strings.Contains(script, "meta mark 0") {
+		t.Error("unexpected output chain without bypass mark:\n", script)
+	}
+}
+
+func TestRedirectIptablesCommands(t *testing.T) {
+	r := &redirectRules{
+		settings: &AutoRedirect{Fwmark: 1, RouteTable: 100, BypassMark: 255},
+		port:     12345,
+	}
+
+	install, remove := r.iptablesCommands("iptables", reservedIPv4)
+	if c := install[0].String(); c != "iptables -t mangle -N V2RAY_TPROXY_12345" {
+		t.Error("unexpected first command: ", c)
+	}
+	var hooks []string
+	for _, c := range install {
+		if s := c.String(); strings.Contains(s, "-A PREROUTING") || strings.Contains(s, "-A OUTPUT") {
+			hooks = append(hooks, s)
+		}
+	}
+	if len(hooks) != 2 {
+		t.Error("expected both PREROUTING and OUTPUT to jump to dedicated chains, but got ", hooks)
+	}
+	if c := remove[0].String(); c != "iptables -t mangle -D PREROUTING -j V2RAY_TPROXY_12345" {
+		t.Error("unexpected first removal: ", c)
+	}
+}
+
+func TestRedirectRouteExists(t *testing.T) {
+	origRun := runCommand
+	defer func() { runCommand = origRun }()
+
+	var commands []string
+	runCommand = func(c command) error {
+		commands = append(commands, c.String())
+		if c.args[1] == "route" && c.args[2] == "add" {
+			return errors.New("RTNETLINK answers: File exists")
+		}
+		return nil
+	}
+
+	r := &redirectRules{
+		settings: &AutoRedirect{Fwmark: 1, RouteTable: 100},
+		port:     12345,
+	}
+	if err := r.installRoute("-4"); err != nil {
+		t.Fatal(err)
+	}
+
+	commands = nil
+	if err := r.remove(); err != nil {
+		t.Fatal(err)
+	}
+	if len(commands) != 1 || commands[0] != "ip -4 rule del fwmark 1 lookup 100" {
+		t.Error("existing route should be kept, but got ", commands)
+	}
+}
@@ -0,0 +1,16 @@
+// +build !linux
+// +build !confonly
+
+package dokodemo
+
+import (
+	"v2ray.com/core/common/net"
+)
+
+type redirector interface {
+	remove() error
+}
+
+func installRedirect(settings *AutoRedirect, port net.Port) (redirector, error) {
+	return nil, newError("auto redirect is only supported on Linux")
+}
@@ -0,0 +1,94 @@
+// +build !confonly
+
+package freedom
+
+import (
+	"io"
+	"time"
+
+	"v2ray.com/core/common/buf"
+	"v2ray.com/core/common/dice"
+)
+
+const (
+	defaultFragmentMinSize = 10
+	defaultFragmentMaxSize = 100
+)
+
+// fragmentWriter splits the beginning of a TCP stream into segments of random sizes. Once the
+// configured length is written, it passes the data through to the underlying writer.
+type fragmentWriter struct {
+	config  *Fragment
+	conn    io.Writer
+	writer  buf.Writer
+	pending int32
+}
+
+func newFragmentWriter(config *Fragment, conn io.Writer) *fragmentWriter {
+	return &fragmentWriter{
+		config:  config,
+		conn:    conn,
+		writer:  buf.NewWriter(conn),
+		pending: int32(config.Length),
+	}
+}
+
+// WriteMultiBuffer implements buf.Writer.
+func (w *fragmentWriter) WriteMultiBuffer(mb buf.MultiBuffer) error {
+	if w.pending < 0 || mb.IsEmpty() {
+		return w.writer.WriteMultiBuffer(mb)
+	}
+	defer buf.ReleaseMulti(mb)
+
+	b := make([]byte, mb.Len())
+	mb.Copy(b)
+
+	// Only the first write is split if no length is configured.
+	limit := w.pending
+	if limit == 0 || limit > int32(len(b)) {
+		limit = int32(len(b))
+	}
+	head, tail := b[:limit], b[limit:]
+	w.pending -= limit
+	if w.pending <= 0 {
+		w.pending = -1
+	}
+
+	for len(head) > 0 {
+		size := randomBetween(w.config.MinSize, w.config.MaxSize, defaultFragmentMinSize, defaultFragmentMaxSize)
+		if size > len(head) {
+			size = len(head)
+		}
+		if _, err := w.conn.Write(head[:size]); err != nil {
+			return err
+		}
+		head = head[size:]
+		if len(head) > 0 || len(tail) > 0 || w.pending > 0 {
+			if delay := randomBetween(w.config.MinDelay, w.config.MaxDelay, 0, 0); delay > 0 {
+				time.Sleep(time.Duration(delay) * time.Millisecond)
+			}
+		}
+	}
+
+	if len(tail) > 0 {
+		if _, err := w.conn.Write(tail); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// randomBetween returns a random value in [min, max], using the defaults if the range is unset.
+func randomBetween(min, max uint32, defaultMin, defaultMax int) int {
+	lo, hi := int(min), int(max)
+	if lo == 0 && hi == 0 {
+		lo, hi = defaultMin, defaultMax
+	}
+	if lo < 1 && defaultMin > 0 {
+		lo = 1
+	}
+	if hi <= lo {
+		return lo
+	}
+	return lo + dice.Roll(hi-lo+1)
+}
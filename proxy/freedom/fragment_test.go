@@ -0,0 +1,46 @@
+package freedom
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+
+	"v2ray.com/core/common"
+	"v2ray.com/core/common/buf"
+)
+
+type recordWriter struct {
+	writes [][]byte
+}
+
+func (w *recordWriter) Write(b []byte) (int, error) {
+	w.writes = append(w.writes, append([]byte(nil), b...))
+	return len(b), nil
+}
+
+func TestFragmentWriter(t *testing.T) {
+	conn := new(recordWriter)
+	writer := newFragmentWriter(&Fragment{Length: 300, MinSize: 10, MaxSize: 20}, conn)
+
+	payload := make([]byte, 500)
+	common.Must2(rand.Read(payload))
+	common.Must(writer.WriteMultiBuffer(buf.MergeBytes(nil, payload[:200])))
+	common.Must(writer.WriteMultiBuffer(buf.MergeBytes(nil, payload[200:])))
+
+	fragmented := 0
+	for _, b := range conn.writes {
+		if fragmented == 300 {
+			break
+		}
+		if len(b) > 20 {
+			t.Fatal("segment of ", len(b), " bytes at offset ", fragmented)
+		}
+		fragmented += len(b)
+	}
+	if fragmented != 300 {
+		t.Error("fragmented ", fragmented, " bytes")
+	}
+	if !bytes.Equal(bytes.Join(conn.writes, nil), payload) {
+		t.Error("data mismatch")
+	}
+}
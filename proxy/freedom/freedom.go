@@ -6,12 +6,15 @@ package freedom
 
 import (
 	"context"
+	"runtime"
+	"syscall"
 	"time"
 
 	"v2ray.com/core"
 	"v2ray.com/core/common"
 	"v2ray.com/core/common/buf"
 	"v2ray.com/core/common/dice"
+	"v2ray.com/core/common/errors"
 	"v2ray.com/core/common/net"
 	"v2ray.com/core/common/retry"
 	"v2ray.com/core/common/session"
@@ -19,8 +22,10 @@ import (
 	"v2ray.com/core/common/task"
 	"v2ray.com/core/features/dns"
 	"v2ray.com/core/features/policy"
+	"v2ray.com/core/proxy"
 	"v2ray.com/core/transport"
 	"v2ray.com/core/transport/internet"
+	"v2ray.com/core/transport/internet/udp"
 )
 
 func init() {
@@ -33,6 +38,7 @@ func init() {
 		}
 		return h, nil
 	}))
+	common.Must(proxy.RegisterOutboundConfig((*Config)(nil)))
 }
 
 // Handler handles Freedom connections.
@@ -40,10 +46,26 @@ type Handler struct {
 	policyManager policy.Manager
 	dns           dns.Client
 	config        *Config
+	udpSockets    udpSocketPool
 }
 
 // Init initializes the Handler with necessary parameters.
 func (h *Handler) Init(config *Config, pm policy.Manager, d dns.Client) error {
+	if config.SourceAddressPassthrough && runtime.GOOS != "linux" {
+		return newError("source address passthrough is only supported on Linux")
+	}
+	if config.Multicast != nil && len(config.Multicast.Interface) == 0 {
+		return newError("interface of multicast is not specified")
+	}
+
+	if len(config.DnsServerTag) > 0 {
+		client, err := dns.ClientWithServerTag(d, config.DnsServerTag)
+		if err != nil {
+			return newError("failed to select DNS servers").Base(err)
+		}
+		d = client
+	}
+
 	h.config = config
 	h.policyManager = pm
 	h.dns = d
@@ -59,15 +81,18 @@ func (h *Handler) policy() policy.Session {
 	return p
 }
 
-func (h *Handler) resolveIP(ctx context.Context, domain string, localAddr net.Address) net.Address {
-	var lookupFunc func(string) ([]net.IP, error) = h.dns.LookupIP
+// resolveIP picks one of the addresses of the domain, and returns all of them for the dialer to
+// fall back on.
+func (h *Handler) resolveIP(ctx context.Context, domain string, localAddr net.Address) (net.Address, []net.IP) {
+	client := dns.ClientWithContext(ctx, h.dns)
+	var lookupFunc func(string) ([]net.IP, error) = client.LookupIP
 
 	if h.config.DomainStrategy == Config_USE_IP4 || (localAddr != nil && localAddr.Family().IsIPv4()) {
-		if lookupIPv4, ok := h.dns.(dns.IPv4Lookup); ok {
+		if lookupIPv4, ok := client.(dns.IPv4Lookup); ok {
 			lookupFunc = lookupIPv4.LookupIPv4
 		}
 	} else if h.config.DomainStrategy == Config_USE_IP6 || (localAddr != nil && localAddr.Family().IsIPv6()) {
-		if lookupIPv6, ok := h.dns.(dns.IPv6Lookup); ok {
+		if lookupIPv6, ok := client.(dns.IPv6Lookup); ok {
 			lookupFunc = lookupIPv6.LookupIPv6
 		}
 	}
@@ -77,9 +102,24 @@ func (h *Handler) resolveIP(ctx context.Context, domain string, localAddr net.Ad
 		newError("failed to get IP address for domain ", domain).Base(err).WriteToLog(session.ExportIDToError(ctx))
 	}
 	if len(ips) == 0 {
-		return nil
+		return nil, nil
+	}
+	return net.IPAddress(ips[dice.Roll(len(ips))]), ips
+}
+
+// isUnreachable returns true if the error is caused by an ICMP unreachable message, which is
+// reported as an error on the next read or write of a connected UDP socket.
+func isUnreachable(err error) bool {
+	err = errors.Cause(err)
+	if opErr, ok := err.(*net.OpError); ok {
+		err = errors.Cause(opErr.Err)
+	}
+	switch err {
+	case syscall.ECONNREFUSED, syscall.EHOSTUNREACH, syscall.ENETUNREACH:
+		return true
+	default:
+		return false
 	}
-	return net.IPAddress(ips[dice.Roll(len(ips))])
 }
 
 func isValidAddress(addr *net.IPOrDomain) bool {
@@ -112,30 +152,64 @@ func (h *Handler) Process(ctx context.Context, link *transport.Link, dialer inte
 	input := link.Reader
 	output := link.Writer
 
+	dialCtx := ctx
+	if destination.Network == net.Network_UDP {
+		dialCtx = internet.ContextWithUnreachableErrors(dialCtx)
+	}
+
+	localAddr := dialer.Address()
+	var transparentSource net.Address
+	if h.config.SourceAddressPassthrough {
+		if inbound := session.InboundFromContext(ctx); inbound != nil && inbound.Source.IsValid() && inbound.Source.Address.Family().IsIP() {
+			transparentSource = inbound.Source.Address
+			localAddr = transparentSource
+		}
+	}
+
+	multicast := h.config.Multicast != nil && destination.Network == net.Network_UDP && net.IsMulticastOrBroadcast(destination.Address)
+	if destination.Network == net.Network_UDP && h.config.UdpSocketStrategy != Config_PER_DESTINATION && !multicast && transparentSource == nil {
+		var sockopt *internet.SocketConfig
+		if d, ok := dialer.(internet.SocketSettingsDialer); ok {
+			sockopt = d.SocketSettings()
+		}
+		return h.processUDPSocket(ctx, link, destination, localAddr, sockopt)
+	}
+
 	var conn internet.Connection
-	err := retry.ExponentialBackoff(5, 100).On(func() error {
-		dialDest := destination
-		if h.config.useIP() && dialDest.Address.Family().IsDomain() {
-			ip := h.resolveIP(ctx, dialDest.Address.Domain(), dialer.Address())
-			if ip != nil {
-				dialDest = net.Destination{
-					Network: dialDest.Network,
-					Address: ip,
-					Port:    dialDest.Port,
+	var err error
+	if multicast {
+		conn, err = listenMulticast(h.config.Multicast, destination)
+	} else {
+		err = retry.ExponentialBackoff(5, 100).On(func() error {
+			dialDest := destination
+			dialCtx := dialCtx
+			if h.config.useIP() && dialDest.Address.Family().IsDomain() {
+				ip, ips := h.resolveIP(ctx, dialDest.Address.Domain(), localAddr)
+				if ip != nil {
+					dialDest = net.Destination{
+						Network: dialDest.Network,
+						Address: ip,
+						Port:    dialDest.Port,
+					}
+					dialCtx = internet.ContextWithFallbackIPs(dialCtx, ip.IP(), ips)
+					newError("dialing to to ", dialDest).WriteToLog(session.ExportIDToError(ctx))
 				}
-				newError("dialing to to ", dialDest).WriteToLog(session.ExportIDToError(ctx))
 			}
-		}
+			// A source address can only be used for destinations of the same family.
+			if transparentSource != nil && (dialDest.Address.Family().IsDomain() || dialDest.Address.Family() == transparentSource.Family()) {
+				dialCtx = internet.ContextWithTransparentSource(dialCtx, transparentSource, dialDest.Address)
+			}
 
-		rawConn, err := dialer.Dial(ctx, dialDest)
-		if err != nil {
-			return err
-		}
-		conn = rawConn
-		return nil
-	})
+			rawConn, err := dialer.Dial(dialCtx, dialDest)
+			if err != nil {
+				return err
+			}
+			conn = rawConn
+			return nil
+		})
+	}
 	if err != nil {
-		return newError("failed to open connection to ", destination).Base(err)
+		return newError("failed to open connection to ", destination).Base(err).WithKind(errors.KindUnreachable)
 	}
 	defer conn.Close()
 
@@ -148,7 +222,11 @@ func (h *Handler) Process(ctx context.Context, link *transport.Link, dialer inte
 
 		var writer buf.Writer
 		if destination.Network == net.Network_TCP {
-			writer = buf.NewWriter(conn)
+			if h.config.Fragment != nil {
+				writer = newFragmentWriter(h.config.Fragment, conn)
+			} else {
+				writer = buf.NewWriter(conn)
+			}
 		} else {
 			writer = &buf.SequentialWriter{Writer: conn}
 		}
@@ -177,6 +255,18 @@ func (h *Handler) Process(ctx context.Context, link *transport.Link, dialer inte
 	}
 
 	if err := task.Run(ctx, requestDone, task.OnSuccess(responseDone, task.Close(output))); err != nil {
+		if destination.Network == net.Network_UDP {
+			if isUnreachable(err) {
+				err := newError("destination ", destination, " is unreachable").Base(err)
+				udp.ReportFailure(ctx, err)
+				return err
+			}
+			if errors.Cause(err) == context.Canceled {
+				// An idle UDP session is not a failure. Let the link be closed normally so
+				// that inbounds don't tear down the whole association.
+				return nil
+			}
+		}
 		return newError("connection ends").Base(err)
 	}
 
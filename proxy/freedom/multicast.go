@@ -0,0 +1,87 @@
+// +build !confonly
+
+package freedom
+
+import (
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+
+	"v2ray.com/core/common/net"
+)
+
+// multicastConn sends packets to a multicast or broadcast destination, and reads the replies from any
+// source, which a connected socket would drop.
+type multicastConn struct {
+	*net.UDPConn
+	dest *net.UDPAddr
+}
+
+func (c *multicastConn) Write(b []byte) (int, error) {
+	return c.WriteTo(b, c.dest)
+}
+
+// listenMulticast opens a socket on an address of the interface in the config, for sending packets to
+// the multicast or broadcast destination.
+func listenMulticast(config *Multicast, dest net.Destination) (*multicastConn, error) {
+	iface, err := net.InterfaceByName(config.Interface)
+	if err != nil {
+		return nil, newError("failed to find interface ", config.Interface).Base(err)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, newError("failed to get addresses of interface ", config.Interface).Base(err)
+	}
+	isIPv4 := dest.Address.Family().IsIPv4()
+	local := &net.UDPAddr{}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && (ipNet.IP.To4() != nil) == isIPv4 {
+			local.IP = ipNet.IP
+			break
+		}
+	}
+	if local.IP == nil {
+		return nil, newError("no address of the family of ", dest.Address, " on interface ", config.Interface)
+	}
+	if !isIPv4 && local.IP.IsLinkLocalUnicast() {
+		local.Zone = iface.Name
+	}
+
+	conn, err := net.ListenUDP("udp", local)
+	if err != nil {
+		return nil, newError("failed to listen on ", local).Base(err)
+	}
+	ttl := int(config.Ttl)
+	if ttl == 0 {
+		ttl = 1
+	}
+	if isIPv4 {
+		p := ipv4.NewPacketConn(conn)
+		err = p.SetMulticastInterface(iface)
+		if err == nil {
+			err = p.SetMulticastTTL(ttl)
+		}
+		if err == nil {
+			// Broadcast packets use the unicast TTL.
+			err = p.SetTTL(ttl)
+		}
+	} else {
+		p := ipv6.NewPacketConn(conn)
+		err = p.SetMulticastInterface(iface)
+		if err == nil {
+			err = p.SetMulticastHopLimit(ttl)
+		}
+	}
+	if err != nil {
+		conn.Close()
+		return nil, newError("failed to set multicast options on interface ", config.Interface).Base(err)
+	}
+
+	return &multicastConn{
+		UDPConn: conn,
+		dest: &net.UDPAddr{
+			IP:   dest.Address.IP(),
+			Port: int(dest.Port),
+			Zone: local.Zone,
+		},
+	}, nil
+}
@@ -0,0 +1,242 @@
+// +build !confonly
+
+package freedom
+
+import (
+	"context"
+	"sync"
+
+	"v2ray.com/core/common"
+	"v2ray.com/core/common/buf"
+	"v2ray.com/core/common/errors"
+	"v2ray.com/core/common/net"
+	"v2ray.com/core/common/session"
+	"v2ray.com/core/common/signal"
+	"v2ray.com/core/common/task"
+	"v2ray.com/core/transport"
+	"v2ray.com/core/transport/internet"
+	"v2ray.com/core/transport/internet/udp"
+	"v2ray.com/core/transport/pipe"
+)
+
+// Unlike connected sockets of PER_DESTINATION, the sockets of PER_SESSION and SHARED are not connected, and
+// send the packets of all sessions using them from the same source port. That is an endpoint-independent
+// mapping in the terms of RFC 4787, so that the address learned from a STUN server is also the one that other
+// peers see. The filtering is still address and port dependent, as the packets from a peer are delivered to
+// the session to it, and dropped if there is none. With SHARED, the sessions of all clients send from the
+// same port, and a peer that two of them talk to can only reply to the one that talks to it last.
+
+// sharedUDPSocketKey is the key of the socket of the SHARED strategy.
+type sharedUDPSocketKey struct{}
+
+// udpSocket is an unconnected socket used by the sessions of the same key, each to a destination.
+type udpSocket struct {
+	key  interface{}
+	conn net.PacketConn
+	refs int
+
+	access sync.RWMutex
+	routes map[net.Destination]*pipe.Writer
+}
+
+// udpSocketPool keeps the sockets in use by the keys of sessions.
+type udpSocketPool struct {
+	access  sync.Mutex
+	sockets map[interface{}]*udpSocket
+}
+
+// acquire returns the socket of the key, opening it on the local address with the socket options if it is not
+// in use.
+func (p *udpSocketPool) acquire(ctx context.Context, key interface{}, localAddr net.Address, sockopt *internet.SocketConfig) (*udpSocket, error) {
+	p.access.Lock()
+	defer p.access.Unlock()
+
+	if s, found := p.sockets[key]; found {
+		s.refs++
+		return s, nil
+	}
+	addr := &net.UDPAddr{}
+	if localAddr != nil && localAddr.Family().IsIP() {
+		addr.IP = localAddr.IP()
+	}
+	conn, err := internet.ListenSystemPacket(ctx, addr, sockopt)
+	if err != nil {
+		return nil, newError("failed to open UDP socket on ", addr).Base(err)
+	}
+	s := &udpSocket{
+		key:    key,
+		conn:   conn,
+		refs:   1,
+		routes: make(map[net.Destination]*pipe.Writer),
+	}
+	if p.sockets == nil {
+		p.sockets = make(map[interface{}]*udpSocket)
+	}
+	p.sockets[key] = s
+	go s.readPackets()
+	return s, nil
+}
+
+// release closes the socket when no session uses it.
+func (p *udpSocketPool) release(s *udpSocket) {
+	p.access.Lock()
+	defer p.access.Unlock()
+
+	s.refs--
+	if s.refs > 0 {
+		return
+	}
+	delete(p.sockets, s.key)
+	s.conn.Close()
+}
+
+// route delivers the packets from the destination to the returned reader, in place of the session that
+// talks to it before, if any.
+func (s *udpSocket) route(dest net.Destination) (*pipe.Reader, *pipe.Writer) {
+	reader, writer := pipe.New(pipe.WithSizeLimit(16*buf.Size), pipe.DiscardOverflow())
+
+	s.access.Lock()
+	if w, found := s.routes[dest]; found {
+		common.Close(w)
+	}
+	s.routes[dest] = writer
+	s.access.Unlock()
+
+	return reader, writer
+}
+
+// unroute stops delivering the packets from the destination to the writer, if it is still the route.
+func (s *udpSocket) unroute(dest net.Destination, writer *pipe.Writer) {
+	s.access.Lock()
+	if s.routes[dest] == writer {
+		delete(s.routes, dest)
+	}
+	s.access.Unlock()
+
+	common.Close(writer)
+}
+
+func (s *udpSocket) readPackets() {
+	defer func() {
+		s.access.Lock()
+		for _, w := range s.routes {
+			common.Close(w)
+		}
+		s.access.Unlock()
+	}()
+
+	for {
+		b := buf.New()
+		n, addr, err := s.conn.ReadFrom(b.Extend(buf.Size))
+		if err != nil {
+			b.Release()
+			return
+		}
+		b.Resize(0, int32(n))
+		udpAddr, ok := addr.(*net.UDPAddr)
+		if !ok {
+			b.Release()
+			continue
+		}
+		source := net.UDPDestination(net.IPAddress(udpAddr.IP), net.Port(udpAddr.Port))
+
+		s.access.RLock()
+		w := s.routes[source]
+		s.access.RUnlock()
+		if w == nil {
+			b.Release()
+			continue
+		}
+		// The pipe drops the packet if it is full, or the session has ended.
+		w.WriteMultiBuffer(buf.MultiBuffer{b})
+	}
+}
+
+// udpSocketWriter writes packets to a destination through an unconnected socket.
+type udpSocketWriter struct {
+	conn net.PacketConn
+	dest *net.UDPAddr
+}
+
+// WriteMultiBuffer implements buf.Writer.
+func (w *udpSocketWriter) WriteMultiBuffer(mb buf.MultiBuffer) error {
+	defer buf.ReleaseMulti(mb)
+
+	for _, b := range mb {
+		if _, err := w.conn.WriteTo(b.Bytes(), w.dest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// udpSocketKey returns the key of the socket for the session in ctx. Without the association of the session,
+// sessions from the same source of the same inbound use the same socket.
+func (h *Handler) udpSocketKey(ctx context.Context) interface{} {
+	if h.config.UdpSocketStrategy == Config_SHARED {
+		return sharedUDPSocketKey{}
+	}
+	if association := udp.AssociationFromContext(ctx); association != nil {
+		return association
+	}
+	if inbound := session.InboundFromContext(ctx); inbound != nil && inbound.Source.IsValid() {
+		return inbound.Tag + ">>>" + inbound.Source.String()
+	}
+	// A socket of its own, as there is nothing to tell the sessions of the client.
+	return new(int)
+}
+
+// processUDPSocket sends the packets of the session through the socket of the UDP socket strategy.
+func (h *Handler) processUDPSocket(ctx context.Context, link *transport.Link, destination net.Destination, localAddr net.Address, sockopt *internet.SocketConfig) error {
+	dest := destination
+	if dest.Address.Family().IsDomain() {
+		ip, _ := h.resolveIP(ctx, dest.Address.Domain(), localAddr)
+		if ip == nil {
+			return newError("failed to resolve ", dest.Address).WithKind(errors.KindUnreachable)
+		}
+		dest.Address = ip
+	}
+
+	socket, err := h.udpSockets.acquire(ctx, h.udpSocketKey(ctx), localAddr, sockopt)
+	if err != nil {
+		return newError("failed to open connection to ", destination).Base(err).WithKind(errors.KindUnreachable)
+	}
+	defer h.udpSockets.release(socket)
+	responses, route := socket.route(dest)
+	defer socket.unroute(dest, route)
+
+	plcy := h.policy()
+	ctx, cancel := context.WithCancel(ctx)
+	timer := signal.CancelAfterInactivity(ctx, cancel, plcy.Timeouts.ConnectionIdle)
+
+	requestDone := func() error {
+		defer timer.SetTimeout(plcy.Timeouts.DownlinkOnly)
+
+		writer := &udpSocketWriter{
+			conn: socket.conn,
+			dest: &net.UDPAddr{IP: dest.Address.IP(), Port: int(dest.Port)},
+		}
+		if err := buf.Copy(link.Reader, writer, buf.UpdateActivity(timer)); err != nil {
+			return newError("failed to process request").Base(err)
+		}
+		return nil
+	}
+
+	responseDone := func() error {
+		defer timer.SetTimeout(plcy.Timeouts.UplinkOnly)
+
+		if err := buf.Copy(responses, link.Writer, buf.UpdateActivity(timer)); err != nil {
+			return newError("failed to process response").Base(err)
+		}
+		return nil
+	}
+
+	if err := task.Run(ctx, requestDone, task.OnSuccess(responseDone, task.Close(link.Writer))); err != nil {
+		common.Interrupt(responses)
+		if errors.Cause(err) == context.Canceled {
+			return nil
+		}
+		return newError("connection ends").Base(err)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+// +build linux
+
+package freedom
+
+import (
+	"syscall"
+	"testing"
+
+	"v2ray.com/core/common"
+	"v2ray.com/core/common/net"
+	"v2ray.com/core/features/dns/localdns"
+	"v2ray.com/core/features/policy"
+	"v2ray.com/core/transport/internet"
+)
+
+type sockoptDialer struct {
+	systemDialer
+	sockopt *internet.SocketConfig
+}
+
+func (d sockoptDialer) SocketSettings() *internet.SocketConfig {
+	return d.sockopt
+}
+
+func TestUDPSocketOptions(t *testing.T) {
+	stun := startSTUNServer(t)
+	h := new(Handler)
+	common.Must(h.Init(&Config{UdpSocketStrategy: Config_PER_SESSION}, policy.DefaultManager{}, localdns.New()))
+
+	dialer := sockoptDialer{sockopt: &internet.SocketConfig{Ttl: 7}}
+	mappedAddressWith(t, h, dialer, net.UDPDestination(net.ParseAddress("10.0.0.1"), 5000), stun)
+
+	h.udpSockets.access.Lock()
+	defer h.udpSockets.access.Unlock()
+	if len(h.udpSockets.sockets) != 1 {
+		t.Fatal("expect a socket in use, but got ", len(h.udpSockets.sockets))
+	}
+	for _, s := range h.udpSockets.sockets {
+		rawConn, err := s.conn.(syscall.Conn).SyscallConn()
+		common.Must(err)
+		var ttl int
+		common.Must(rawConn.Control(func(fd uintptr) {
+			ttl, err = syscall.GetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_TTL)
+		}))
+		common.Must(err)
+		if ttl != 7 {
+			t.Error("expect TTL 7, but got ", ttl)
+		}
+	}
+}
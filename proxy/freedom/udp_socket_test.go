@@ -0,0 +1,104 @@
+package freedom
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"v2ray.com/core/common"
+	"v2ray.com/core/common/buf"
+	"v2ray.com/core/common/net"
+	"v2ray.com/core/common/session"
+	"v2ray.com/core/features/dns/localdns"
+	"v2ray.com/core/features/policy"
+	"v2ray.com/core/transport"
+	"v2ray.com/core/transport/internet"
+	"v2ray.com/core/transport/pipe"
+)
+
+type systemDialer struct{}
+
+func (systemDialer) Dial(ctx context.Context, dest net.Destination) (internet.Connection, error) {
+	return internet.DialSystem(ctx, dest, nil)
+}
+
+func (systemDialer) Address() net.Address {
+	return nil
+}
+
+// startSTUNServer starts a server that answers each request with the address it sees the request from, as
+// a STUN server does in binding responses.
+func startSTUNServer(t *testing.T) net.Destination {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: []byte{127, 0, 0, 1}})
+	common.Must(err)
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		b := make([]byte, 1500)
+		for {
+			_, addr, err := conn.ReadFromUDP(b)
+			if err != nil {
+				return
+			}
+			conn.WriteToUDP([]byte(addr.String()), addr)
+		}
+	}()
+	return net.DestinationFromAddr(conn.LocalAddr())
+}
+
+// mappedAddress sends a binding request to the STUN server through the handler, in a session from the
+// source, and returns the mapped address in the response.
+func mappedAddress(t *testing.T, h *Handler, source net.Destination, server net.Destination) string {
+	return mappedAddressWith(t, h, systemDialer{}, source, server)
+}
+
+func mappedAddressWith(t *testing.T, h *Handler, dialer internet.Dialer, source net.Destination, server net.Destination) string {
+	ctx := session.ContextWithInbound(context.Background(), &session.Inbound{Source: source, Tag: "in"})
+	ctx = session.ContextWithOutbound(ctx, &session.Outbound{Target: server})
+	uplinkReader, uplinkWriter := pipe.New()
+	downlinkReader, downlinkWriter := pipe.New()
+	t.Cleanup(func() { uplinkWriter.Close() })
+	go h.Process(ctx, &transport.Link{Reader: uplinkReader, Writer: downlinkWriter}, dialer)
+
+	b := buf.New()
+	common.Must2(b.WriteString("binding request"))
+	common.Must(uplinkWriter.WriteMultiBuffer(buf.MultiBuffer{b}))
+	mb, err := downlinkReader.ReadMultiBufferTimeout(time.Second * 5)
+	if err != nil {
+		t.Fatal("no binding response: ", err)
+	}
+	defer buf.ReleaseMulti(mb)
+	return mb.String()
+}
+
+func TestUDPSocketStrategy(t *testing.T) {
+	stun1 := startSTUNServer(t)
+	stun2 := startSTUNServer(t)
+	client1 := net.UDPDestination(net.ParseAddress("10.0.0.1"), 5000)
+	client2 := net.UDPDestination(net.ParseAddress("10.0.0.2"), 5000)
+
+	newHandler := func(strategy Config_UdpSocketStrategy) *Handler {
+		h := new(Handler)
+		common.Must(h.Init(&Config{UdpSocketStrategy: strategy}, policy.DefaultManager{}, localdns.New()))
+		return h
+	}
+
+	h := newHandler(Config_PER_DESTINATION)
+	if a, b := mappedAddress(t, h, client1, stun1), mappedAddress(t, h, client1, stun2); a == b {
+		t.Error("expect different mappings per destination, but both are ", a)
+	}
+
+	h = newHandler(Config_PER_SESSION)
+	a := mappedAddress(t, h, client1, stun1)
+	if b := mappedAddress(t, h, client1, stun2); a != b {
+		t.Error("expect the same mapping for destinations of a session, but got ", a, " and ", b)
+	}
+	if b := mappedAddress(t, h, client2, stun1); a == b {
+		t.Error("expect different mappings for sessions, but both are ", a)
+	}
+
+	h = newHandler(Config_SHARED)
+	a = mappedAddress(t, h, client1, stun1)
+	if b := mappedAddress(t, h, client2, stun2); a != b {
+		t.Error("expect the same mapping for all sessions, but got ", a, " and ", b)
+	}
+}
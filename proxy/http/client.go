@@ -16,6 +16,7 @@ import (
 	"v2ray.com/core/common"
 	"v2ray.com/core/common/buf"
 	"v2ray.com/core/common/bytespool"
+	"v2ray.com/core/common/errors"
 	"v2ray.com/core/common/net"
 	"v2ray.com/core/common/protocol"
 	"v2ray.com/core/common/retry"
@@ -23,6 +24,7 @@ import (
 	"v2ray.com/core/common/signal"
 	"v2ray.com/core/common/task"
 	"v2ray.com/core/features/policy"
+	"v2ray.com/core/proxy"
 	"v2ray.com/core/transport"
 	"v2ray.com/core/transport/internet"
 	"v2ray.com/core/transport/internet/tls"
@@ -31,6 +33,9 @@ import (
 type Client struct {
 	serverPicker  protocol.ServerPicker
 	policyManager policy.Manager
+
+	cachedH2Mutex sync.Mutex
+	cachedH2Conns map[net.Destination]h2Conn
 }
 
 type h2Conn struct {
@@ -38,11 +43,6 @@ type h2Conn struct {
 	h2Conn  *http2.ClientConn
 }
 
-var (
-	cachedH2Mutex sync.Mutex
-	cachedH2Conns map[net.Destination]h2Conn
-)
-
 // NewClient create a new http client based on the given config.
 func NewClient(ctx context.Context, config *ClientConfig) (*Client, error) {
 	serverList := protocol.NewServerList()
@@ -94,7 +94,7 @@ func (c *Client) Process(ctx context.Context, link *transport.Link, dialer inter
 		dest := server.Destination()
 		user = server.PickUser()
 
-		netConn, err := setUpHTTPTunnel(ctx, dest, targetAddr, user, dialer, firstPayload)
+		netConn, err := c.setUpHTTPTunnel(ctx, dest, targetAddr, user, dialer, firstPayload)
 		if netConn != nil {
 			if _, ok := netConn.(*http2Conn); !ok {
 				if _, err := netConn.Write(firstPayload); err != nil {
@@ -106,7 +106,7 @@ func (c *Client) Process(ctx context.Context, link *transport.Link, dialer inter
 		}
 		return err
 	}); err != nil {
-		return newError("failed to find an available destination").Base(err)
+		return newError("failed to find an available destination").Base(err).WithKind(errors.KindUnreachable)
 	}
 
 	defer func() {
@@ -141,7 +141,7 @@ func (c *Client) Process(ctx context.Context, link *transport.Link, dialer inter
 }
 
 // setUpHTTPTunnel will create a socket tunnel via HTTP CONNECT method
-func setUpHTTPTunnel(ctx context.Context, dest net.Destination, target string, user *protocol.MemoryUser, dialer internet.Dialer, firstPayload []byte) (net.Conn, error) {
+func (c *Client) setUpHTTPTunnel(ctx context.Context, dest net.Destination, target string, user *protocol.MemoryUser, dialer internet.Dialer, firstPayload []byte) (net.Conn, error) {
 	req := &http.Request{
 		Method: http.MethodConnect,
 		URL:    &url.URL{Host: target},
@@ -210,9 +210,9 @@ func setUpHTTPTunnel(ctx context.Context, dest net.Destination, target string, u
 		return newHTTP2Conn(rawConn, pw, resp.Body), nil
 	}
 
-	cachedH2Mutex.Lock()
-	cachedConn, cachedConnFound := cachedH2Conns[dest]
-	cachedH2Mutex.Unlock()
+	c.cachedH2Mutex.Lock()
+	cachedConn, cachedConnFound := c.cachedH2Conns[dest]
+	c.cachedH2Mutex.Unlock()
 
 	if cachedConnFound {
 		rc, cc := cachedConn.rawConn, cachedConn.h2Conn
@@ -262,16 +262,16 @@ func setUpHTTPTunnel(ctx context.Context, dest net.Destination, target string, u
 			return nil, err
 		}
 
-		cachedH2Mutex.Lock()
-		if cachedH2Conns == nil {
-			cachedH2Conns = make(map[net.Destination]h2Conn)
+		c.cachedH2Mutex.Lock()
+		if c.cachedH2Conns == nil {
+			c.cachedH2Conns = make(map[net.Destination]h2Conn)
 		}
 
-		cachedH2Conns[dest] = h2Conn{
+		c.cachedH2Conns[dest] = h2Conn{
 			rawConn: rawConn,
 			h2Conn:  h2clientConn,
 		}
-		cachedH2Mutex.Unlock()
+		c.cachedH2Mutex.Unlock()
 
 		return proxyConn, err
 	default:
@@ -306,4 +306,5 @@ func init() {
 	common.Must(common.RegisterConfig((*ClientConfig)(nil), func(ctx context.Context, config interface{}) (interface{}, error) {
 		return NewClient(ctx, config.(*ClientConfig))
 	}))
+	common.Must(proxy.RegisterOutboundConfig((*ClientConfig)(nil)))
 }
@@ -0,0 +1,254 @@
+// +build !confonly
+
+package http
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"v2ray.com/core/common"
+	"v2ray.com/core/common/buf"
+	"v2ray.com/core/common/log"
+	"v2ray.com/core/common/net"
+	"v2ray.com/core/common/session"
+	"v2ray.com/core/common/signal"
+	"v2ray.com/core/common/task"
+	"v2ray.com/core/features/policy"
+	"v2ray.com/core/features/routing"
+	"v2ray.com/core/transport/internet"
+)
+
+const (
+	// connectUDPPathPrefix is the start of the default URI template of connect-udp,
+	// "/.well-known/masque/udp/{target_host}/{target_port}/".
+	connectUDPPathPrefix = "/.well-known/masque/udp/"
+
+	capsuleTypeDatagram = 0x00
+	// contextIDUDPPayload is the context ID of the datagrams that carry UDP payloads.
+	contextIDUDPPayload = 0
+)
+
+// isConnectUDP returns true if the request is an HTTP/1.1 upgrade to connect-udp, as in RFC 9298. Extended
+// CONNECT of HTTP/2 is served by serveHTTP2.
+func isConnectUDP(request *http.Request) bool {
+	if !strings.EqualFold(request.Method, "GET") {
+		return false
+	}
+	for _, value := range request.Header.Values("Upgrade") {
+		for _, token := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "connect-udp") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseConnectUDPTarget returns the UDP destination in the path of a connect-udp request.
+func parseConnectUDPTarget(request *http.Request) (net.Destination, error) {
+	path := request.URL.EscapedPath()
+	if !strings.HasPrefix(path, connectUDPPathPrefix) {
+		return net.Destination{}, newError("unexpected path of connect-udp: ", path)
+	}
+	parts := strings.Split(strings.TrimSuffix(path[len(connectUDPPathPrefix):], "/"), "/")
+	if len(parts) != 2 {
+		return net.Destination{}, newError("unexpected path of connect-udp: ", path)
+	}
+	host, err := url.PathUnescape(parts[0])
+	if err != nil || len(host) == 0 {
+		return net.Destination{}, newError("invalid target host of connect-udp: ", parts[0]).Base(err)
+	}
+	port, err := net.PortFromString(parts[1])
+	if err != nil {
+		return net.Destination{}, newError("invalid target port of connect-udp: ", parts[1]).Base(err)
+	}
+	return net.UDPDestination(net.ParseAddress(host), port), nil
+}
+
+func writeStatus(writer io.Writer, statusCode int) error {
+	response := &http.Response{
+		Status:        http.StatusText(statusCode),
+		StatusCode:    statusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header(make(map[string][]string)),
+		Body:          nil,
+		ContentLength: 0,
+		Close:         true,
+	}
+	response.Header.Set("Connection", "close")
+	return response.Write(writer)
+}
+
+func (s *Server) handleConnectUDP(ctx context.Context, request *http.Request, reader *bufio.Reader, conn internet.Connection, dispatcher routing.Dispatcher) error {
+	if !s.config.AllowConnectUdp {
+		newError("connect-udp is not allowed").AtInfo().WriteToLog(session.ExportIDToError(ctx))
+		return writeStatus(conn, http.StatusNotImplemented)
+	}
+	dest, err := parseConnectUDPTarget(request)
+	if err != nil {
+		if err := writeStatus(conn, http.StatusBadRequest); err != nil {
+			return err
+		}
+		return err
+	}
+	ctx = log.ContextWithAccessMessage(ctx, &log.AccessMessage{
+		From:   conn.RemoteAddr(),
+		To:     dest,
+		Status: log.AccessAccepted,
+		Reason: "",
+	})
+
+	if _, err := conn.Write([]byte("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: connect-udp\r\nCapsule-Protocol: ?1\r\n\r\n")); err != nil {
+		return newError("failed to write back upgrade response").Base(err)
+	}
+
+	return s.relayConnectUDP(ctx, dest, reader, buf.NewWriter(conn), dispatcher)
+}
+
+// relayConnectUDP relays the capsules of a connect-udp stream, read from reader and written to writer, to
+// the UDP destination.
+func (s *Server) relayConnectUDP(ctx context.Context, dest net.Destination, reader *bufio.Reader, writer buf.Writer, dispatcher routing.Dispatcher) error {
+	plcy := s.policy()
+	ctx, cancel := context.WithCancel(ctx)
+	timer := signal.CancelAfterInactivity(ctx, cancel, plcy.Timeouts.ConnectionIdle)
+
+	ctx = policy.ContextWithBufferPolicy(ctx, plcy.Buffer)
+	link, err := dispatcher.Dispatch(ctx, dest)
+	if err != nil {
+		return err
+	}
+
+	requestDone := func() error {
+		defer timer.SetTimeout(plcy.Timeouts.DownlinkOnly)
+
+		return buf.Copy(&capsuleReader{reader: reader}, link.Writer, buf.UpdateActivity(timer))
+	}
+
+	responseDone := func() error {
+		defer timer.SetTimeout(plcy.Timeouts.UplinkOnly)
+
+		return buf.Copy(link.Reader, &capsuleWriter{writer: writer}, buf.UpdateActivity(timer))
+	}
+
+	var closeWriter = task.OnSuccess(requestDone, task.Close(link.Writer))
+	if err := task.Run(ctx, closeWriter, responseDone); err != nil {
+		common.Interrupt(link.Reader)
+		common.Interrupt(link.Writer)
+		return newError("connection ends").Base(err)
+	}
+
+	return nil
+}
+
+// readVarInt reads a variable-length integer of QUIC (RFC 9000, Section 16), and returns it with the number
+// of bytes read.
+func readVarInt(reader io.ByteReader) (uint64, int, error) {
+	b, err := reader.ReadByte()
+	if err != nil {
+		return 0, 0, err
+	}
+	size := 1 << (b >> 6)
+	value := uint64(b & 0x3f)
+	for i := 1; i < size; i++ {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return 0, 0, err
+		}
+		value = value<<8 | uint64(b)
+	}
+	return value, size, nil
+}
+
+// appendVarInt appends v as a variable-length integer of QUIC to b.
+func appendVarInt(b []byte, v uint64) []byte {
+	switch {
+	case v < 1<<6:
+		return append(b, byte(v))
+	case v < 1<<14:
+		return append(b, byte(v>>8)|0x40, byte(v))
+	case v < 1<<30:
+		return append(b, byte(v>>24)|0x80, byte(v>>16), byte(v>>8), byte(v))
+	default:
+		return append(b, byte(v>>56)|0xc0, byte(v>>48), byte(v>>40), byte(v>>32), byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	}
+}
+
+// capsuleReader reads UDP payloads from the DATAGRAM capsules of a stream, one payload per buffer. Other
+// capsules, and datagrams with other context IDs or too large for a buffer, are skipped.
+type capsuleReader struct {
+	reader *bufio.Reader
+}
+
+func (r *capsuleReader) skip(n uint64) error {
+	_, err := io.CopyN(ioutil.Discard, r.reader, int64(n))
+	return err
+}
+
+// ReadMultiBuffer implements buf.Reader.
+func (r *capsuleReader) ReadMultiBuffer() (buf.MultiBuffer, error) {
+	for {
+		capsuleType, _, err := readVarInt(r.reader)
+		if err != nil {
+			return nil, err
+		}
+		length, _, err := readVarInt(r.reader)
+		if err != nil {
+			return nil, newError("failed to read capsule length").Base(err)
+		}
+		if capsuleType != capsuleTypeDatagram || length == 0 {
+			if err := r.skip(length); err != nil {
+				return nil, newError("failed to skip capsule").Base(err)
+			}
+			continue
+		}
+
+		contextID, size, err := readVarInt(r.reader)
+		if err != nil {
+			return nil, newError("failed to read context ID").Base(err)
+		}
+		if uint64(size) > length {
+			return nil, newError("malformed datagram capsule")
+		}
+		length -= uint64(size)
+		if contextID != contextIDUDPPayload || length > buf.Size {
+			if err := r.skip(length); err != nil {
+				return nil, newError("failed to skip datagram").Base(err)
+			}
+			continue
+		}
+
+		payload := buf.New()
+		if _, err := payload.ReadFullFrom(r.reader, int32(length)); err != nil {
+			payload.Release()
+			return nil, newError("failed to read datagram").Base(err)
+		}
+		return buf.MultiBuffer{payload}, nil
+	}
+}
+
+// capsuleWriter writes each buffer as a UDP payload in a DATAGRAM capsule.
+type capsuleWriter struct {
+	writer buf.Writer
+}
+
+// WriteMultiBuffer implements buf.Writer.
+func (w *capsuleWriter) WriteMultiBuffer(mb buf.MultiBuffer) error {
+	capsules := make(buf.MultiBuffer, 0, len(mb)*2)
+	for _, payload := range mb {
+		var b [16]byte
+		h := appendVarInt(b[:0], capsuleTypeDatagram)
+		h = appendVarInt(h, uint64(payload.Len())+1)
+		h = appendVarInt(h, contextIDUDPPayload)
+		header := buf.New()
+		common.Must2(header.Write(h))
+		capsules = append(capsules, header, payload)
+	}
+	return w.writer.WriteMultiBuffer(capsules)
+}
@@ -0,0 +1,547 @@
+// +build !confonly
+
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+
+	"v2ray.com/core/common/buf"
+	"v2ray.com/core/common/errors"
+	"v2ray.com/core/common/log"
+	"v2ray.com/core/common/protocol"
+	"v2ray.com/core/common/session"
+	"v2ray.com/core/features/routing"
+	"v2ray.com/core/transport/internet"
+)
+
+const (
+	// settingEnableConnectProtocol is SETTINGS_ENABLE_CONNECT_PROTOCOL of RFC 8441, which allows extended
+	// CONNECT requests with the :protocol pseudo-header.
+	settingEnableConnectProtocol http2.SettingID = 0x8
+
+	// initialWindowSize is the initial flow control window of HTTP/2 connections and streams.
+	initialWindowSize = 65535
+	// defaultMaxFrameSize is the initial maximum size of the payload of HTTP/2 frames.
+	defaultMaxFrameSize = 16384
+	// maxHeaderBlockSize is the maximum size of encoded header blocks, and of decoded header lists, from clients.
+	maxHeaderBlockSize = 16384
+	// maxConcurrentStreams is the maximum number of connect-udp streams of an HTTP/2 connection.
+	maxConcurrentStreams = 100
+)
+
+// isHTTP2Preface returns true if the request is the start of the HTTP/2 client preface, "PRI * HTTP/2.0".
+func isHTTP2Preface(request *http.Request) bool {
+	return request.Method == "PRI" && request.ProtoMajor == 2 && request.URL.Path == "*" && len(request.Header) == 0
+}
+
+// h2ServerConn is an HTTP/2 connection to the inbound. It serves extended CONNECT requests of connect-udp, as in
+// RFC 9220 and RFC 9298. Other requests are answered with 501.
+type h2ServerConn struct {
+	server     *Server
+	dispatcher routing.Dispatcher
+	conn       internet.Connection
+	framer     *http2.Framer
+	decoder    *hpack.Decoder
+
+	// writeAccess serializes the frames written to the connection.
+	writeAccess sync.Mutex
+	encoder     *hpack.Encoder
+	headerBuf   bytes.Buffer
+
+	// access guards the fields below. cond is signaled when flow control windows grow or streams close.
+	access            sync.Mutex
+	cond              *sync.Cond
+	streams           map[uint32]*h2Stream
+	sendWindow        int64
+	peerInitialWindow int64
+	peerMaxFrameSize  uint32
+	closed            bool
+
+	wg sync.WaitGroup
+}
+
+// h2Stream is a connect-udp stream. Payloads of DATA frames are passed to the relay through a pipe, whose
+// writer blocks the connection until the relay reads them.
+type h2Stream struct {
+	conn       *h2ServerConn
+	id         uint32
+	reader     *io.PipeReader
+	writer     *io.PipeWriter
+	sendWindow int64
+	reset      bool
+	cancel     context.CancelFunc
+}
+
+// serveHTTP2 serves the HTTP/2 connection, after the "PRI * HTTP/2.0" request of the client preface is read.
+func (s *Server) serveHTTP2(ctx context.Context, reader *bufio.Reader, conn internet.Connection, dispatcher routing.Dispatcher) error {
+	var preface [6]byte
+	if _, err := io.ReadFull(reader, preface[:]); err != nil || string(preface[:]) != http2.ClientPreface[len(http2.ClientPreface)-6:] {
+		return newError("invalid HTTP/2 client preface").Base(err)
+	}
+
+	c := &h2ServerConn{
+		server:            s,
+		dispatcher:        dispatcher,
+		conn:              conn,
+		framer:            http2.NewFramer(conn, reader),
+		decoder:           hpack.NewDecoder(4096, nil),
+		streams:           make(map[uint32]*h2Stream),
+		sendWindow:        initialWindowSize,
+		peerInitialWindow: initialWindowSize,
+		peerMaxFrameSize:  defaultMaxFrameSize,
+	}
+	c.framer.SetMaxReadFrameSize(defaultMaxFrameSize)
+	c.decoder.SetMaxStringLength(maxHeaderBlockSize)
+	c.encoder = hpack.NewEncoder(&c.headerBuf)
+	c.cond = sync.NewCond(&c.access)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer func() {
+		cancel()
+		c.close()
+		c.wg.Wait()
+	}()
+
+	if err := c.writeFrame(func(fr *http2.Framer) error {
+		return fr.WriteSettings(
+			http2.Setting{ID: settingEnableConnectProtocol, Val: 1},
+			http2.Setting{ID: http2.SettingMaxConcurrentStreams, Val: maxConcurrentStreams},
+			http2.Setting{ID: http2.SettingMaxHeaderListSize, Val: maxHeaderBlockSize},
+		)
+	}); err != nil {
+		return newError("failed to write HTTP/2 settings").Base(err)
+	}
+
+	err := c.serve(ctx)
+	if errors.Cause(err) == io.EOF {
+		return nil
+	}
+	return err
+}
+
+func (c *h2ServerConn) writeFrame(write func(*http2.Framer) error) error {
+	c.writeAccess.Lock()
+	defer c.writeAccess.Unlock()
+	return write(c.framer)
+}
+
+func (c *h2ServerConn) writeHeaders(streamID uint32, endStream bool, fields ...hpack.HeaderField) error {
+	c.writeAccess.Lock()
+	defer c.writeAccess.Unlock()
+
+	c.headerBuf.Reset()
+	for _, field := range fields {
+		if err := c.encoder.WriteField(field); err != nil {
+			return err
+		}
+	}
+	return c.framer.WriteHeaders(http2.HeadersFrameParam{
+		StreamID:      streamID,
+		BlockFragment: c.headerBuf.Bytes(),
+		EndStream:     endStream,
+		EndHeaders:    true,
+	})
+}
+
+func (c *h2ServerConn) writeStatus(streamID uint32, statusCode int, fields ...hpack.HeaderField) error {
+	fields = append([]hpack.HeaderField{{Name: ":status", Value: strconv.Itoa(statusCode)}}, fields...)
+	return c.writeHeaders(streamID, true, fields...)
+}
+
+func (c *h2ServerConn) serve(ctx context.Context) error {
+	for {
+		frame, err := c.framer.ReadFrame()
+		if err != nil {
+			return err
+		}
+		switch f := frame.(type) {
+		case *http2.SettingsFrame:
+			if f.IsAck() {
+				continue
+			}
+			if err := c.applySettings(f); err != nil {
+				return err
+			}
+			if err := c.writeFrame(func(fr *http2.Framer) error { return fr.WriteSettingsAck() }); err != nil {
+				return err
+			}
+		case *http2.PingFrame:
+			if f.IsAck() {
+				continue
+			}
+			data := f.Data
+			if err := c.writeFrame(func(fr *http2.Framer) error { return fr.WritePing(true, data) }); err != nil {
+				return err
+			}
+		case *http2.WindowUpdateFrame:
+			c.addSendWindow(f.StreamID, f.Increment)
+		case *http2.HeadersFrame:
+			if err := c.handleHeaders(ctx, f); err != nil {
+				return err
+			}
+		case *http2.DataFrame:
+			if err := c.handleData(f); err != nil {
+				return err
+			}
+		case *http2.RSTStreamFrame:
+			if stream := c.stream(f.StreamID); stream != nil {
+				c.resetStream(stream)
+			}
+		case *http2.GoAwayFrame:
+			return nil
+		}
+	}
+}
+
+func (c *h2ServerConn) applySettings(f *http2.SettingsFrame) error {
+	c.access.Lock()
+	defer c.access.Unlock()
+
+	return f.ForeachSetting(func(setting http2.Setting) error {
+		if err := setting.Valid(); err != nil {
+			return err
+		}
+		switch setting.ID {
+		case http2.SettingInitialWindowSize:
+			delta := int64(setting.Val) - c.peerInitialWindow
+			c.peerInitialWindow = int64(setting.Val)
+			for _, stream := range c.streams {
+				stream.sendWindow += delta
+			}
+			c.cond.Broadcast()
+		case http2.SettingMaxFrameSize:
+			c.peerMaxFrameSize = setting.Val
+		}
+		return nil
+	})
+}
+
+func (c *h2ServerConn) addSendWindow(streamID uint32, increment uint32) {
+	c.access.Lock()
+	defer c.access.Unlock()
+
+	if streamID == 0 {
+		c.sendWindow += int64(increment)
+	} else if stream, found := c.streams[streamID]; found {
+		stream.sendWindow += int64(increment)
+	}
+	c.cond.Broadcast()
+}
+
+func (c *h2ServerConn) stream(id uint32) *h2Stream {
+	c.access.Lock()
+	defer c.access.Unlock()
+	return c.streams[id]
+}
+
+// readHeaderBlock returns the header block of the HEADERS frame, with the fragments of its CONTINUATION
+// frames. The connection is closed with ENHANCE_YOUR_CALM if the block exceeds maxHeaderBlockSize, as the
+// decoder can't skip the block.
+func (c *h2ServerConn) readHeaderBlock(f *http2.HeadersFrame) ([]byte, error) {
+	block := append([]byte(nil), f.HeaderBlockFragment()...)
+	for ended := f.HeadersEnded(); !ended; {
+		if len(block) > maxHeaderBlockSize {
+			c.writeFrame(func(fr *http2.Framer) error { // nolint: errcheck
+				return fr.WriteGoAway(f.StreamID, http2.ErrCodeEnhanceYourCalm, nil)
+			})
+			return nil, newError("HTTP/2 header block exceeds ", maxHeaderBlockSize, " bytes")
+		}
+		frame, err := c.framer.ReadFrame()
+		if err != nil {
+			return nil, err
+		}
+		continuation, ok := frame.(*http2.ContinuationFrame)
+		if !ok {
+			return nil, newError("unexpected HTTP/2 frame in header block: ", frame.Header().Type)
+		}
+		block = append(block, continuation.HeaderBlockFragment()...)
+		ended = continuation.HeadersEnded()
+	}
+	if len(block) > maxHeaderBlockSize {
+		c.writeFrame(func(fr *http2.Framer) error { // nolint: errcheck
+			return fr.WriteGoAway(f.StreamID, http2.ErrCodeEnhanceYourCalm, nil)
+		})
+		return nil, newError("HTTP/2 header block exceeds ", maxHeaderBlockSize, " bytes")
+	}
+	return block, nil
+}
+
+// decodeHeaders decodes the header block. It returns false if the header list exceeds maxHeaderBlockSize, in
+// which case the fields are dropped but the block is still decoded to keep the state of the decoder.
+func (c *h2ServerConn) decodeHeaders(block []byte) ([]hpack.HeaderField, bool, error) {
+	var fields []hpack.HeaderField
+	size := 0
+	c.decoder.SetEmitEnabled(true)
+	c.decoder.SetEmitFunc(func(field hpack.HeaderField) {
+		size += int(field.Size())
+		if size > maxHeaderBlockSize {
+			c.decoder.SetEmitEnabled(false)
+			fields = nil
+			return
+		}
+		fields = append(fields, field)
+	})
+	if _, err := c.decoder.Write(block); err != nil {
+		return nil, false, err
+	}
+	if err := c.decoder.Close(); err != nil {
+		return nil, false, err
+	}
+	return fields, size <= maxHeaderBlockSize, nil
+}
+
+func (c *h2ServerConn) handleHeaders(ctx context.Context, f *http2.HeadersFrame) error {
+	block, err := c.readHeaderBlock(f)
+	if err != nil {
+		return err
+	}
+	fields, ok, err := c.decodeHeaders(block)
+	if err != nil {
+		return newError("failed to decode HTTP/2 headers").Base(err)
+	}
+	if !ok {
+		if stream := c.stream(f.StreamID); stream != nil {
+			c.resetStream(stream)
+		}
+		return c.writeStatus(f.StreamID, http.StatusRequestHeaderFieldsTooLarge)
+	}
+
+	if stream := c.stream(f.StreamID); stream != nil {
+		// Trailers of the stream.
+		if f.StreamEnded() {
+			stream.writer.Close()
+		}
+		return nil
+	}
+
+	pseudo := make(map[string]string)
+	header := make(http.Header)
+	for _, field := range fields {
+		if field.IsPseudo() {
+			pseudo[field.Name] = field.Value
+		} else {
+			header.Add(field.Name, field.Value)
+		}
+	}
+	return c.handleRequest(ctx, f.StreamID, pseudo, header)
+}
+
+func (c *h2ServerConn) handleRequest(ctx context.Context, streamID uint32, pseudo map[string]string, header http.Header) error {
+	s := c.server
+	if pseudo[":method"] != "CONNECT" || pseudo[":protocol"] != "connect-udp" {
+		newError("unsupported HTTP/2 request ", pseudo[":method"], " ", pseudo[":protocol"]).AtInfo().WriteToLog(session.ExportIDToError(ctx))
+		return c.writeStatus(streamID, http.StatusNotImplemented)
+	}
+
+	if len(s.config.Accounts) > 0 {
+		user, pass, ok := parseBasicAuth(header.Get("Proxy-Authorization"))
+		if !ok || !s.config.HasAccount(user, pass) {
+			return c.writeStatus(streamID, http.StatusProxyAuthRequired, hpack.HeaderField{Name: "proxy-authenticate", Value: "Basic realm=\"proxy\""})
+		}
+		// Streams of the connection may be of different users.
+		if inbound := session.InboundFromContext(ctx); inbound != nil {
+			streamInbound := *inbound
+			streamInbound.User = &protocol.MemoryUser{
+				Email: user,
+				Level: s.config.UserLevel,
+			}
+			ctx = session.ContextWithInbound(ctx, &streamInbound)
+		}
+	}
+
+	if !s.config.AllowConnectUdp {
+		newError("connect-udp is not allowed").AtInfo().WriteToLog(session.ExportIDToError(ctx))
+		return c.writeStatus(streamID, http.StatusNotImplemented)
+	}
+	target, err := url.ParseRequestURI(pseudo[":path"])
+	if err != nil {
+		newError("invalid path of connect-udp: ", pseudo[":path"]).Base(err).WriteToLog(session.ExportIDToError(ctx))
+		return c.writeStatus(streamID, http.StatusBadRequest)
+	}
+	dest, err := parseConnectUDPTarget(&http.Request{URL: target})
+	if err != nil {
+		newError("failed to parse connect-udp target").Base(err).WriteToLog(session.ExportIDToError(ctx))
+		return c.writeStatus(streamID, http.StatusBadRequest)
+	}
+
+	ctx = session.ContextWithID(ctx, session.NewID())
+	ctx = log.ContextWithAccessMessage(ctx, &log.AccessMessage{
+		From:   c.conn.RemoteAddr(),
+		To:     dest,
+		Status: log.AccessAccepted,
+		Reason: "",
+	})
+	ctx, cancel := context.WithCancel(ctx)
+	stream := &h2Stream{
+		conn:   c,
+		id:     streamID,
+		cancel: cancel,
+	}
+	stream.reader, stream.writer = io.Pipe()
+
+	c.access.Lock()
+	if c.closed {
+		c.access.Unlock()
+		cancel()
+		return nil
+	}
+	if len(c.streams) >= maxConcurrentStreams {
+		c.access.Unlock()
+		cancel()
+		newError("refusing connect-udp stream beyond ", maxConcurrentStreams, " streams").AtInfo().WriteToLog(session.ExportIDToError(ctx))
+		return c.writeFrame(func(fr *http2.Framer) error {
+			return fr.WriteRSTStream(streamID, http2.ErrCodeRefusedStream)
+		})
+	}
+	stream.sendWindow = c.peerInitialWindow
+	c.streams[streamID] = stream
+	c.access.Unlock()
+
+	if err := c.writeHeaders(streamID, false, hpack.HeaderField{Name: ":status", Value: "200"}, hpack.HeaderField{Name: "capsule-protocol", Value: "?1"}); err != nil {
+		return err
+	}
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		err := s.relayConnectUDP(ctx, dest, bufio.NewReader(stream.reader), buf.NewWriter(stream), c.dispatcher)
+		if err != nil {
+			newError("connect-udp stream ends").Base(err).WriteToLog(session.ExportIDToError(ctx))
+		}
+		c.closeStream(stream, err)
+	}()
+	return nil
+}
+
+func (c *h2ServerConn) handleData(f *http2.DataFrame) error {
+	stream := c.stream(f.StreamID)
+	if stream != nil && len(f.Data()) > 0 {
+		// The relay may have ended, in which case the payload is dropped.
+		stream.writer.Write(f.Data()) // nolint: errcheck
+	}
+	if stream != nil && f.StreamEnded() {
+		stream.writer.Close()
+	}
+
+	// Payloads are consumed once they are written to the pipe, so the windows are restored at once.
+	if f.Length > 0 {
+		if err := c.writeFrame(func(fr *http2.Framer) error {
+			if err := fr.WriteWindowUpdate(0, f.Length); err != nil {
+				return err
+			}
+			if stream != nil && !f.StreamEnded() {
+				return fr.WriteWindowUpdate(f.StreamID, f.Length)
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *h2ServerConn) resetStream(stream *h2Stream) {
+	c.access.Lock()
+	stream.reset = true
+	c.cond.Broadcast()
+	c.access.Unlock()
+
+	stream.writer.CloseWithError(newError("stream reset by client"))
+	stream.cancel()
+}
+
+// closeStream ends the stream after its relay, with END_STREAM if the relay succeeds, or RST_STREAM if not.
+func (c *h2ServerConn) closeStream(stream *h2Stream, err error) {
+	c.access.Lock()
+	delete(c.streams, stream.id)
+	done := stream.reset || c.closed
+	stream.reset = true
+	c.cond.Broadcast()
+	c.access.Unlock()
+
+	stream.cancel()
+	stream.reader.Close()
+	if done {
+		return
+	}
+	c.writeFrame(func(fr *http2.Framer) error { // nolint: errcheck
+		if err != nil {
+			return fr.WriteRSTStream(stream.id, http2.ErrCodeCancel)
+		}
+		return fr.WriteData(stream.id, true, nil)
+	})
+}
+
+// close ends the streams of the connection.
+func (c *h2ServerConn) close() {
+	c.access.Lock()
+	c.closed = true
+	streams := make([]*h2Stream, 0, len(c.streams))
+	for _, stream := range c.streams {
+		streams = append(streams, stream)
+	}
+	c.cond.Broadcast()
+	c.access.Unlock()
+
+	for _, stream := range streams {
+		stream.writer.CloseWithError(io.ErrClosedPipe)
+		stream.cancel()
+	}
+}
+
+// reserve waits until the flow control windows allow at most size bytes to be sent on the stream, and
+// returns the number of bytes allowed.
+func (c *h2ServerConn) reserve(stream *h2Stream, size int) (int, error) {
+	c.access.Lock()
+	defer c.access.Unlock()
+
+	for c.sendWindow <= 0 || stream.sendWindow <= 0 {
+		if c.closed || stream.reset {
+			return 0, io.ErrClosedPipe
+		}
+		c.cond.Wait()
+	}
+	if c.closed || stream.reset {
+		return 0, io.ErrClosedPipe
+	}
+	n := int64(size)
+	if n > c.sendWindow {
+		n = c.sendWindow
+	}
+	if n > stream.sendWindow {
+		n = stream.sendWindow
+	}
+	if n > int64(c.peerMaxFrameSize) {
+		n = int64(c.peerMaxFrameSize)
+	}
+	c.sendWindow -= n
+	stream.sendWindow -= n
+	return int(n), nil
+}
+
+// Write implements io.Writer. It sends b in DATA frames of the stream.
+func (s *h2Stream) Write(b []byte) (int, error) {
+	written := 0
+	for written < len(b) {
+		n, err := s.conn.reserve(s, len(b)-written)
+		if err != nil {
+			return written, err
+		}
+		data := b[written : written+n]
+		if err := s.conn.writeFrame(func(fr *http2.Framer) error { return fr.WriteData(s.id, false, data) }); err != nil {
+			return written, err
+		}
+		written += n
+	}
+	return written, nil
+}
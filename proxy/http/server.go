@@ -24,6 +24,7 @@ import (
 	"v2ray.com/core/common/task"
 	"v2ray.com/core/features/policy"
 	"v2ray.com/core/features/routing"
+	"v2ray.com/core/proxy"
 	"v2ray.com/core/transport/internet"
 )
 
@@ -93,12 +94,21 @@ func (s *Server) Process(ctx context.Context, network net.Network, conn internet
 	}
 
 	reader := bufio.NewReaderSize(readerOnly{conn}, buf.Size)
+	firstRequest := true
 
 Start:
 	if err := conn.SetReadDeadline(time.Now().Add(s.policy().Timeouts.Handshake)); err != nil {
 		newError("failed to set read deadline").Base(err).WriteToLog(session.ExportIDToError(ctx))
 	}
 
+	if firstRequest {
+		firstRequest = false
+		// Methods of HTTP are in upper case, while other protocols, such as Socks and TLS, start with binary bytes.
+		if first, err := reader.Peek(1); err == nil && (first[0] < 'A' || first[0] > 'Z') {
+			return proxy.HandleMismatch(ctx, s.config.Mismatch, conn, buf.NewReader(reader), s.policy())
+		}
+	}
+
 	request, err := http.ReadRequest(reader)
 	if err != nil {
 		trace := newError("failed to read http request").Base(err)
@@ -108,6 +118,17 @@ Start:
 		return trace
 	}
 
+	if isHTTP2Preface(request) {
+		// HTTP/2 only serves connect-udp.
+		if !s.config.AllowConnectUdp {
+			return newError("HTTP/2 is not served, as connect-udp is not allowed")
+		}
+		if err := conn.SetReadDeadline(time.Time{}); err != nil {
+			newError("failed to clear read deadline").Base(err).WriteToLog(session.ExportIDToError(ctx))
+		}
+		return s.serveHTTP2(ctx, reader, conn, dispatcher)
+	}
+
 	if len(s.config.Accounts) > 0 {
 		user, pass, ok := parseBasicAuth(request.Header.Get("Proxy-Authorization"))
 		if !ok || !s.config.HasAccount(user, pass) {
@@ -123,6 +144,10 @@ Start:
 		newError("failed to clear read deadline").Base(err).WriteToLog(session.ExportIDToError(ctx))
 	}
 
+	if isConnectUDP(request) {
+		return s.handleConnectUDP(ctx, request, reader, conn, dispatcher)
+	}
+
 	defaultPort := net.Port(80)
 	if strings.EqualFold(request.URL.Scheme, "https") {
 		defaultPort = net.Port(443)
@@ -327,4 +352,5 @@ func init() {
 	common.Must(common.RegisterConfig((*ServerConfig)(nil), func(ctx context.Context, config interface{}) (interface{}, error) {
 		return NewServer(ctx, config.(*ServerConfig))
 	}))
+	common.Must(proxy.RegisterInboundConfig((*ServerConfig)(nil)))
 }
@@ -0,0 +1,119 @@
+// +build !confonly
+
+// Package loopback is an outbound handler that sends connections back to routing, as if they came
+// from an inbound with the given tag.
+package loopback
+
+//go:generate go run v2ray.com/core/common/errors/errorgen
+
+import (
+	"context"
+
+	"v2ray.com/core"
+	"v2ray.com/core/common"
+	"v2ray.com/core/common/buf"
+	"v2ray.com/core/common/session"
+	"v2ray.com/core/common/task"
+	"v2ray.com/core/features/routing"
+	"v2ray.com/core/proxy"
+	"v2ray.com/core/transport"
+	"v2ray.com/core/transport/internet"
+)
+
+const defaultMaxDepth = 8
+
+type loopbackKey int
+
+const depthKey loopbackKey = 0
+
+func depthFromContext(ctx context.Context) uint32 {
+	if depth, ok := ctx.Value(depthKey).(uint32); ok {
+		return depth
+	}
+	return 0
+}
+
+// Loopback is an outbound handler that dispatches connections again.
+type Loopback struct {
+	inboundTag string
+	maxDepth   uint32
+	dispatcher routing.Dispatcher
+}
+
+// New creates a new loopback handler.
+func New(ctx context.Context, config *Config) (*Loopback, error) {
+	l := &Loopback{
+		inboundTag: config.InboundTag,
+		maxDepth:   config.MaxDepth,
+	}
+	if l.maxDepth == 0 {
+		l.maxDepth = defaultMaxDepth
+	}
+	if err := core.RequireFeatures(ctx, func(d routing.Dispatcher) {
+		l.dispatcher = d
+	}); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Process implements proxy.Outbound.
+func (l *Loopback) Process(ctx context.Context, link *transport.Link, _ internet.Dialer) error {
+	outbound := session.OutboundFromContext(ctx)
+	if outbound == nil || !outbound.Target.IsValid() {
+		return newError("target not specified")
+	}
+	destination := outbound.Target
+
+	depth := depthFromContext(ctx) + 1
+	if depth > l.maxDepth {
+		return newError("connection to ", destination, " looped back more than ", l.maxDepth, " times")
+	}
+	ctx = context.WithValue(ctx, depthKey, depth)
+
+	// The user is left out, so that the traffic is not counted twice for them.
+	inbound := &session.Inbound{
+		Tag: l.inboundTag,
+	}
+	if original := session.InboundFromContext(ctx); original != nil {
+		inbound.Source = original.Source
+		inbound.Gateway = original.Gateway
+	}
+	ctx = session.ContextWithInbound(ctx, inbound)
+
+	newError("looping back to inbound [", l.inboundTag, "] for ", destination).WriteToLog(session.ExportIDToError(ctx))
+
+	loopLink, err := l.dispatcher.Dispatch(ctx, destination)
+	if err != nil {
+		return newError("failed to dispatch ", destination).Base(err)
+	}
+
+	requestDone := func() error {
+		if err := buf.Copy(link.Reader, loopLink.Writer); err != nil {
+			return newError("failed to process request").Base(err)
+		}
+		return nil
+	}
+
+	responseDone := func() error {
+		if err := buf.Copy(loopLink.Reader, link.Writer); err != nil {
+			return newError("failed to process response").Base(err)
+		}
+		return nil
+	}
+
+	if err := task.Run(ctx, task.OnSuccess(requestDone, task.Close(loopLink.Writer)), task.OnSuccess(responseDone, task.Close(link.Writer))); err != nil {
+		common.Interrupt(loopLink.Reader)
+		common.Interrupt(loopLink.Writer)
+		return newError("connection ends").Base(err)
+	}
+
+	return nil
+}
+
+func init() {
+	common.Must(common.RegisterConfig((*Config)(nil), func(ctx context.Context, config interface{}) (interface{}, error) {
+		return New(ctx, config.(*Config))
+	}))
+	common.Must(proxy.RegisterOutboundConfig((*Config)(nil)))
+}
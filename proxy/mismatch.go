@@ -0,0 +1,98 @@
+package proxy
+
+import (
+	"context"
+	"time"
+
+	"v2ray.com/core/common"
+	"v2ray.com/core/common/buf"
+	"v2ray.com/core/common/net"
+	"v2ray.com/core/common/session"
+	"v2ray.com/core/common/signal"
+	"v2ray.com/core/common/task"
+	"v2ray.com/core/features/policy"
+	"v2ray.com/core/transport/internet"
+)
+
+// HandleMismatch handles a connection that doesn't start with bytes of the protocol of the inbound, as the
+// config says. The reader returns the bytes already read from the connection first, for the fallback. The
+// connection counts as an authentication failure of the source, so that sources repeating it may be banned.
+//
+// Mismatches are only logged at debug level, as scanners are frequent.
+func HandleMismatch(ctx context.Context, config *Mismatch, conn internet.Connection, reader buf.Reader, sessionPolicy policy.Session) error {
+	if inbound := session.InboundFromContext(ctx); inbound != nil {
+		inbound.AuthFailed = true
+	}
+	if config == nil {
+		config = new(Mismatch)
+	}
+
+	switch config.Action {
+	case Mismatch_RESPOND:
+		newError("responding to protocol mismatch from ", conn.RemoteAddr()).AtDebug().WriteToLog(session.ExportIDToError(ctx))
+		if _, err := conn.Write(config.Response); err != nil {
+			newError("failed to write response of protocol mismatch").Base(err).AtDebug().WriteToLog(session.ExportIDToError(ctx))
+		}
+		return nil
+	case Mismatch_FALLBACK:
+		newError("forwarding protocol mismatch from ", conn.RemoteAddr(), " to ", config.Dest).AtDebug().WriteToLog(session.ExportIDToError(ctx))
+		return fallbackMismatch(ctx, config, conn, reader, sessionPolicy)
+	default:
+		newError("closing protocol mismatch from ", conn.RemoteAddr()).AtDebug().WriteToLog(session.ExportIDToError(ctx))
+		return nil
+	}
+}
+
+func fallbackMismatch(ctx context.Context, config *Mismatch, conn internet.Connection, reader buf.Reader, sessionPolicy policy.Session) error {
+	if err := conn.SetReadDeadline(time.Time{}); err != nil {
+		newError("failed to clear read deadline").Base(err).WriteToLog(session.ExportIDToError(ctx))
+	}
+
+	network := config.Type
+	if len(network) == 0 {
+		network = "tcp"
+	}
+	var dialer net.Dialer
+	fallbackConn, err := dialer.DialContext(ctx, network, config.Dest)
+	if err != nil {
+		return newError("failed to dial fallback ", config.Dest).Base(err).AtWarning()
+	}
+	defer fallbackConn.Close()
+
+	ctx, cancel := context.WithCancel(ctx)
+	timer := signal.CancelAfterInactivity(ctx, cancel, sessionPolicy.Timeouts.ConnectionIdle)
+
+	fallbackWriter := buf.NewWriter(fallbackConn)
+	requestDone := func() error {
+		defer timer.SetTimeout(sessionPolicy.Timeouts.DownlinkOnly)
+		if err := buf.Copy(reader, fallbackWriter, buf.UpdateActivity(timer)); err != nil {
+			return newError("failed to forward request to fallback").Base(err)
+		}
+		return nil
+	}
+
+	fallbackReader := buf.NewReader(fallbackConn)
+	writer := buf.NewWriter(conn)
+	responseDone := func() error {
+		defer timer.SetTimeout(sessionPolicy.Timeouts.UplinkOnly)
+		if err := buf.Copy(fallbackReader, writer, buf.UpdateActivity(timer)); err != nil {
+			return newError("failed to deliver response of fallback").Base(err)
+		}
+		return nil
+	}
+
+	// Only the sending side is closed after the request, for the fallback to finish its response.
+	closeWrite := func() error {
+		if c, ok := fallbackConn.(interface{ CloseWrite() error }); ok {
+			return c.CloseWrite()
+		}
+		return nil
+	}
+
+	if err := task.Run(ctx, task.OnSuccess(requestDone, closeWrite), responseDone); err != nil {
+		common.Interrupt(fallbackReader)
+		common.Interrupt(fallbackWriter)
+		return newError("fallback ends").Base(err).AtInfo()
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package proxy_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"v2ray.com/core/common"
+	"v2ray.com/core/common/buf"
+	"v2ray.com/core/common/net"
+	"v2ray.com/core/common/session"
+	"v2ray.com/core/features/policy"
+	. "v2ray.com/core/proxy"
+	"v2ray.com/core/testing/servers/tcp"
+)
+
+// handleMismatch handles a mismatch of the connection to a listener, whose first bytes are read already, and
+// returns the client side of the connection.
+func handleMismatch(t *testing.T, config *Mismatch, first []byte) (net.Conn, *session.Inbound, <-chan error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	common.Must(err)
+	defer listener.Close()
+	client, err := net.Dial("tcp", listener.Addr().String())
+	common.Must(err)
+	conn, err := listener.Accept()
+	common.Must(err)
+
+	inbound := &session.Inbound{}
+	ctx := session.ContextWithInbound(context.Background(), inbound)
+	reader := &buf.BufferedReader{Reader: buf.NewReader(conn)}
+	b := buf.New()
+	common.Must2(b.Write(first))
+	reader.Buffer = buf.MultiBuffer{b}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- HandleMismatch(ctx, config, conn, reader, policy.SessionDefault())
+		conn.Close()
+	}()
+	return client, inbound, done
+}
+
+func TestMismatchRespond(t *testing.T) {
+	client, inbound, done := handleMismatch(t, &Mismatch{
+		Action:   Mismatch_RESPOND,
+		Response: []byte("HTTP/1.1 400 Bad Request\r\n\r\n"),
+	}, []byte("GET / HTTP/1.1\r\n"))
+	defer client.Close()
+
+	response, err := ioutil.ReadAll(client)
+	common.Must(err)
+	if string(response) != "HTTP/1.1 400 Bad Request\r\n\r\n" {
+		t.Error("unexpected response: ", string(response))
+	}
+	common.Must(<-done)
+	if !inbound.AuthFailed {
+		t.Error("expect mismatch counted as authentication failure")
+	}
+}
+
+func TestMismatchFallback(t *testing.T) {
+	server := &tcp.Server{
+		MsgProcessor: bytes.ToUpper,
+	}
+	dest, err := server.Start()
+	common.Must(err)
+	defer server.Close()
+
+	client, _, done := handleMismatch(t, &Mismatch{
+		Action: Mismatch_FALLBACK,
+		Type:   "tcp",
+		Dest:   dest.NetAddr(),
+	}, []byte("get / "))
+	common.Must2(client.Write([]byte("http/1.1\r\n")))
+
+	common.Must(client.SetReadDeadline(time.Now().Add(time.Second * 5)))
+	response := make([]byte, 16)
+	common.Must2(io.ReadFull(client, response))
+	if string(response) != "GET / HTTP/1.1\r\n" {
+		t.Error("expect first bytes replayed to fallback, but got ", string(response))
+	}
+	client.Close()
+	select {
+	case <-done:
+	case <-time.After(time.Second * 5):
+		t.Error("fallback doesn't end after the client closes")
+	}
+}
@@ -18,6 +18,7 @@ import (
 	"v2ray.com/core/common/task"
 	"v2ray.com/core/features/policy"
 	"v2ray.com/core/features/routing"
+	"v2ray.com/core/proxy"
 	"v2ray.com/core/transport/internet"
 )
 
@@ -159,4 +160,5 @@ func init() {
 	common.Must(common.RegisterConfig((*ServerConfig)(nil), func(ctx context.Context, config interface{}) (interface{}, error) {
 		return NewServer(ctx, config.(*ServerConfig))
 	}))
+	common.Must(proxy.RegisterInboundConfig((*ServerConfig)(nil)))
 }
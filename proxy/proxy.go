@@ -3,10 +3,14 @@
 // To implement an inbound or outbound proxy, one needs to do the following:
 // 1. Implement the interface(s) below.
 // 2. Register a config creator through common.RegisterConfig.
+// 3. Register the config type through RegisterInboundConfig or RegisterOutboundConfig.
 package proxy
 
+//go:generate go run v2ray.com/core/common/errors/errorgen
+
 import (
 	"context"
+	"reflect"
 
 	"v2ray.com/core/common/net"
 	"v2ray.com/core/common/protocol"
@@ -39,6 +43,12 @@ type UserManager interface {
 	RemoveUser(context.Context, string) error
 }
 
+// ListenObserver is the interface for Inbounds that need to know the ports they listen on.
+type ListenObserver interface {
+	// OnListen is called after all listeners of the inbound handler are started.
+	OnListen(address net.Address, ports []net.Port) error
+}
+
 type GetInbound interface {
 	GetInbound() Inbound
 }
@@ -46,3 +56,38 @@ type GetInbound interface {
 type GetOutbound interface {
 	GetOutbound() Outbound
 }
+
+var (
+	inboundConfigTypes  = make(map[reflect.Type]bool)
+	outboundConfigTypes = make(map[reflect.Type]bool)
+)
+
+// RegisterInboundConfig marks the type of the config as the config of an inbound proxy.
+func RegisterInboundConfig(config interface{}) error {
+	configType := reflect.TypeOf(config)
+	if inboundConfigTypes[configType] {
+		return newError(configType.String(), " is already registered as inbound").AtError()
+	}
+	inboundConfigTypes[configType] = true
+	return nil
+}
+
+// RegisterOutboundConfig marks the type of the config as the config of an outbound proxy.
+func RegisterOutboundConfig(config interface{}) error {
+	configType := reflect.TypeOf(config)
+	if outboundConfigTypes[configType] {
+		return newError(configType.String(), " is already registered as outbound").AtError()
+	}
+	outboundConfigTypes[configType] = true
+	return nil
+}
+
+// IsInboundConfigType returns true if the config type is registered through RegisterInboundConfig().
+func IsInboundConfigType(configType reflect.Type) bool {
+	return inboundConfigTypes[configType]
+}
+
+// IsOutboundConfigType returns true if the config type is registered through RegisterOutboundConfig().
+func IsOutboundConfigType(configType reflect.Type) bool {
+	return outboundConfigTypes[configType]
+}
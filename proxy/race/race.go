@@ -0,0 +1,462 @@
+// +build !confonly
+
+// Package race is an outbound handler that sends each connection through multiple outbounds at the same
+// time, and keeps the one that responds first, trading bandwidth for latency and reliability of small
+// connections on lossy networks.
+package race
+
+//go:generate go run v2ray.com/core/common/errors/errorgen
+
+import (
+	"context"
+	"hash/fnv"
+	"io"
+	"sync"
+	"time"
+
+	"v2ray.com/core"
+	"v2ray.com/core/common"
+	"v2ray.com/core/common/buf"
+	"v2ray.com/core/common/errors"
+	"v2ray.com/core/common/net"
+	"v2ray.com/core/common/session"
+	"v2ray.com/core/common/task"
+	"v2ray.com/core/features/outbound"
+	"v2ray.com/core/features/stats"
+	"v2ray.com/core/proxy"
+	"v2ray.com/core/transport"
+	"v2ray.com/core/transport/internet"
+	"v2ray.com/core/transport/pipe"
+)
+
+const defaultMaxPayload = 32 * 1024
+
+type raceKey int
+
+const racingKey raceKey = 0
+
+// racingFromContext returns the tags of the race outbounds that the connection in ctx is sent through, which
+// are left out of their own races to break loops.
+func racingFromContext(ctx context.Context) []string {
+	tags, _ := ctx.Value(racingKey).([]string)
+	return tags
+}
+
+// Handler is an outbound handler that races connections through other outbounds.
+type Handler struct {
+	tags       []string
+	maxPayload int32
+	outbounds  outbound.Manager
+	stats      stats.Manager
+}
+
+// New creates a new race handler.
+func New(ctx context.Context, config *Config) (*Handler, error) {
+	if len(config.OutboundTags) < 2 {
+		return nil, newError("at least two outbounds are needed for a race")
+	}
+	h := &Handler{
+		tags:       config.OutboundTags,
+		maxPayload: int32(config.MaxPayload),
+	}
+	if h.maxPayload == 0 {
+		h.maxPayload = defaultMaxPayload
+	}
+	if err := core.RequireFeatures(ctx, func(om outbound.Manager, sm stats.Manager) {
+		h.outbounds = om
+		h.stats = sm
+	}); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// contender is an outbound in a race, with the link of the connection through it.
+type contender struct {
+	index  int
+	tag    string
+	writer *pipe.Writer
+	reader *pipe.Reader
+	failed bool
+	won    stats.Counter
+}
+
+func (c *contender) interrupt() {
+	c.writer.Interrupt()
+	c.reader.Interrupt()
+}
+
+// race is the state of a connection sent through the contenders.
+type race struct {
+	access     sync.Mutex
+	contenders []*contender
+	winner     *contender
+	// leader is the contender that delivers the first response, if any.
+	leader     *contender
+	uplink     int32
+	maxPayload int32
+	// lost is signaled when no contender may respond any more.
+	lost chan error
+}
+
+// commit keeps the contender, and drops the others. It returns false if another contender is kept already.
+func (r *race) commit(c *contender) bool {
+	r.access.Lock()
+	defer r.access.Unlock()
+
+	return r.commitLocked(c)
+}
+
+func (r *race) commitLocked(c *contender) bool {
+	if r.winner != nil {
+		return r.winner == c
+	}
+	r.winner = c
+	for _, other := range r.contenders {
+		if other != c {
+			other.interrupt()
+		}
+	}
+	return true
+}
+
+// fail drops the contender, and signals lost if it is the winner or the last one.
+func (r *race) fail(c *contender, err error) {
+	r.access.Lock()
+	defer r.access.Unlock()
+
+	if c.failed {
+		return
+	}
+	c.failed = true
+	c.interrupt()
+	if r.winner == c {
+		r.signalLost(err)
+		return
+	}
+	if r.winner != nil {
+		return
+	}
+	for _, other := range r.contenders {
+		if !other.failed {
+			return
+		}
+	}
+	r.signalLost(err)
+}
+
+func (r *race) signalLost(err error) {
+	select {
+	case r.lost <- err:
+	default:
+	}
+}
+
+// targets returns the contenders that the uplink of the size is sent to. After the racing payload is used up,
+// the leader, or the first contender in the config, is kept.
+func (r *race) targets(ctx context.Context, size int32) []*contender {
+	r.access.Lock()
+	defer r.access.Unlock()
+
+	if r.winner == nil {
+		r.uplink += size
+		if r.uplink > r.maxPayload {
+			keep := r.leader
+			for _, c := range r.contenders {
+				if keep != nil {
+					break
+				}
+				if !c.failed {
+					keep = c
+				}
+			}
+			if keep != nil {
+				newError("racing stops after ", r.uplink, " bytes of uplink, keeping outbound [", keep.tag, "]").AtDebug().WriteToLog(session.ExportIDToError(ctx))
+				r.commitLocked(keep)
+			}
+		}
+	}
+	if r.winner != nil {
+		if r.winner.failed {
+			return nil
+		}
+		return []*contender{r.winner}
+	}
+	targets := make([]*contender, 0, len(r.contenders))
+	for _, c := range r.contenders {
+		if !c.failed {
+			targets = append(targets, c)
+		}
+	}
+	return targets
+}
+
+func (r *race) interruptAll() {
+	for _, c := range r.contenders {
+		c.interrupt()
+	}
+}
+
+// copyMultiBuffer returns a copy of the buffers.
+func copyMultiBuffer(mb buf.MultiBuffer) buf.MultiBuffer {
+	copied := make(buf.MultiBuffer, 0, len(mb))
+	for _, b := range mb {
+		c := buf.New()
+		common.Must2(c.Write(b.Bytes()))
+		copied = append(copied, c)
+	}
+	return copied
+}
+
+// sendUplink sends the uplink to the contenders, and closes them at the end of it.
+func (r *race) sendUplink(ctx context.Context, reader buf.Reader) error {
+	for {
+		mb, err := reader.ReadMultiBuffer()
+		if err != nil {
+			for _, c := range r.targets(ctx, 0) {
+				c.writer.Close()
+			}
+			if errors.Cause(err) == io.EOF {
+				return nil
+			}
+			return err
+		}
+		targets := r.targets(ctx, mb.Len())
+		if len(targets) == 0 {
+			buf.ReleaseMulti(mb)
+			return newError("no outbound to send uplink to")
+		}
+		for i, c := range targets {
+			data := mb
+			if i < len(targets)-1 {
+				data = copyMultiBuffer(mb)
+			}
+			if err := c.writer.WriteMultiBuffer(data); err != nil {
+				r.fail(c, err)
+			}
+		}
+	}
+}
+
+// Process implements proxy.Outbound.
+func (h *Handler) Process(ctx context.Context, link *transport.Link, _ internet.Dialer) error {
+	ob := session.OutboundFromContext(ctx)
+	if ob == nil || !ob.Target.IsValid() {
+		return newError("target not specified")
+	}
+	destination := ob.Target
+
+	racing := racingFromContext(ctx)
+	if len(ob.Tag) > 0 {
+		racing = append(append([]string(nil), racing...), ob.Tag)
+	}
+	ctx = context.WithValue(ctx, racingKey, racing)
+
+	r := &race{
+		maxPayload: h.maxPayload,
+		lost:       make(chan error, 1),
+	}
+Contenders:
+	for _, tag := range h.tags {
+		for _, t := range racing {
+			if t == tag {
+				newError("skipping outbound [", tag, "] that races the connection already").AtWarning().WriteToLog(session.ExportIDToError(ctx))
+				continue Contenders
+			}
+		}
+		handler := h.outbounds.GetHandler(tag)
+		if handler == nil {
+			newError("outbound [", tag, "] is not found").AtWarning().WriteToLog(session.ExportIDToError(ctx))
+			continue
+		}
+		uplinkReader, uplinkWriter := pipe.New(pipe.OptionsFromContext(ctx)...)
+		downlinkReader, downlinkWriter := pipe.New(pipe.OptionsFromContext(ctx)...)
+		c := &contender{
+			index:  len(r.contenders),
+			tag:    tag,
+			writer: uplinkWriter,
+			reader: downlinkReader,
+		}
+		if len(ob.Tag) > 0 {
+			c.won, _ = stats.GetOrRegisterCounter(h.stats, "outbound>>>"+ob.Tag+">>>race>>>"+tag+">>>won")
+		}
+		r.contenders = append(r.contenders, c)
+
+		childOutbound := *ob
+		childOutbound.Tag = tag
+		childCtx := session.ContextWithOutbound(ctx, &childOutbound)
+		go handler.Dispatch(childCtx, &transport.Link{Reader: uplinkReader, Writer: downlinkWriter})
+	}
+	if len(r.contenders) == 0 {
+		return newError("no outbound to race ", destination)
+	}
+
+	var responseDone func() error
+	if destination.Network == net.Network_UDP {
+		responseDone = func() error {
+			return r.receivePackets(link.Writer)
+		}
+	} else {
+		responseDone = func() error {
+			return r.receiveStream(ctx, link.Writer)
+		}
+	}
+	requestDone := func() error {
+		return r.sendUplink(ctx, link.Reader)
+	}
+
+	if err := task.Run(ctx, requestDone, task.OnSuccess(responseDone, task.Close(link.Writer))); err != nil {
+		r.interruptAll()
+		return newError("connection ends").Base(err)
+	}
+	return nil
+}
+
+type firstResponse struct {
+	contender *contender
+	mb        buf.MultiBuffer
+}
+
+// receiveStream waits for the first contender that responds, keeps it, and copies its response.
+func (r *race) receiveStream(ctx context.Context, writer buf.Writer) error {
+	first := make(chan firstResponse, 1)
+	for _, c := range r.contenders {
+		go func(c *contender) {
+			for {
+				mb, err := c.reader.ReadMultiBuffer()
+				if err != nil {
+					r.fail(c, err)
+					return
+				}
+				if mb.IsEmpty() {
+					continue
+				}
+				if !r.commit(c) {
+					buf.ReleaseMulti(mb)
+					return
+				}
+				first <- firstResponse{contender: c, mb: mb}
+				return
+			}
+		}(c)
+	}
+
+	var response firstResponse
+	select {
+	case response = <-first:
+	case err := <-r.lost:
+		if errors.Cause(err) == io.EOF {
+			// The connection is closed by the destination through all outbounds without a response.
+			return nil
+		}
+		return newError("no response through any outbound").Base(err)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	c := response.contender
+	newError("outbound [", c.tag, "] wins the race").AtDebug().WriteToLog(session.ExportIDToError(ctx))
+	if c.won != nil {
+		c.won.Add(1)
+	}
+	if err := writer.WriteMultiBuffer(response.mb); err != nil {
+		return err
+	}
+	return buf.Copy(c.reader, writer)
+}
+
+// receivePackets copies the packets from all contenders, in the order of their first arrivals.
+func (r *race) receivePackets(writer buf.Writer) error {
+	d := &dedup{
+		contenders: len(r.contenders),
+		entries:    make(map[uint64]*dedupEntry),
+	}
+	var wg sync.WaitGroup
+	for _, c := range r.contenders {
+		wg.Add(1)
+		go func(c *contender) {
+			defer wg.Done()
+			for {
+				mb, err := c.reader.ReadMultiBuffer()
+				if err != nil {
+					r.fail(c, err)
+					return
+				}
+				for _, b := range mb {
+					if !d.first(c.index, b) {
+						b.Release()
+						continue
+					}
+					r.access.Lock()
+					if r.leader == nil {
+						r.leader = c
+					}
+					r.access.Unlock()
+					if c.won != nil {
+						c.won.Add(1)
+					}
+					if err := writer.WriteMultiBuffer(buf.MultiBuffer{b}); err != nil {
+						r.fail(c, err)
+					}
+				}
+			}
+		}(c)
+	}
+	wg.Wait()
+	return nil
+}
+
+const dedupTimeout = time.Second * 10
+
+// dedup tells the first arrivals of packets from the contenders. The n-th copies of a packet from the
+// contenders are the same packet, so that packets repeated by the destination are not dropped.
+type dedup struct {
+	access     sync.Mutex
+	contenders int
+	entries    map[uint64]*dedupEntry
+	lastSweep  time.Time
+}
+
+type dedupEntry struct {
+	delivered int
+	arrived   []int
+	last      time.Time
+}
+
+func (d *dedup) first(index int, b *buf.Buffer) bool {
+	h := fnv.New64a()
+	h.Write(b.Bytes())
+	key := h.Sum64()
+
+	d.access.Lock()
+	defer d.access.Unlock()
+
+	now := time.Now()
+	if now.Sub(d.lastSweep) > dedupTimeout {
+		for k, e := range d.entries {
+			if now.Sub(e.last) > dedupTimeout {
+				delete(d.entries, k)
+			}
+		}
+		d.lastSweep = now
+	}
+	e, found := d.entries[key]
+	if !found {
+		e = &dedupEntry{arrived: make([]int, d.contenders)}
+		d.entries[key] = e
+	}
+	e.last = now
+	e.arrived[index]++
+	if e.arrived[index] > e.delivered {
+		e.delivered = e.arrived[index]
+		return true
+	}
+	return false
+}
+
+func init() {
+	common.Must(common.RegisterConfig((*Config)(nil), func(ctx context.Context, config interface{}) (interface{}, error) {
+		return New(ctx, config.(*Config))
+	}))
+	common.Must(proxy.RegisterOutboundConfig((*Config)(nil)))
+}
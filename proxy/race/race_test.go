@@ -0,0 +1,198 @@
+package race_test
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"v2ray.com/core"
+	"v2ray.com/core/app/dispatcher"
+	"v2ray.com/core/app/proxyman"
+	_ "v2ray.com/core/app/proxyman/outbound"
+	"v2ray.com/core/app/stats"
+	"v2ray.com/core/common"
+	"v2ray.com/core/common/net"
+	"v2ray.com/core/common/protocol"
+	"v2ray.com/core/common/serial"
+	feature_stats "v2ray.com/core/features/stats"
+	"v2ray.com/core/proxy/blackhole"
+	"v2ray.com/core/proxy/freedom"
+	"v2ray.com/core/proxy/race"
+	"v2ray.com/core/testing/servers/tcp"
+	"v2ray.com/core/testing/servers/udp"
+	_ "v2ray.com/core/transport/internet/tcp"
+	_ "v2ray.com/core/transport/internet/udp"
+)
+
+func xor(b []byte) []byte {
+	r := make([]byte, len(b))
+	for i, v := range b {
+		r[i] = v ^ 'c'
+	}
+	return r
+}
+
+// redirect returns an outbound that sends connections to the destination.
+func redirect(tag string, dest net.Destination) *core.OutboundHandlerConfig {
+	return &core.OutboundHandlerConfig{
+		Tag: tag,
+		ProxySettings: serial.ToTypedMessage(&freedom.Config{
+			DestinationOverride: &freedom.DestinationOverride{
+				Server: &protocol.ServerEndpoint{
+					Address: net.NewIPOrDomain(dest.Address),
+					Port:    uint32(dest.Port),
+				},
+			},
+		}),
+	}
+}
+
+func startInstance(t *testing.T, config *race.Config, outbounds ...*core.OutboundHandlerConfig) *core.Instance {
+	server, err := core.New(&core.Config{
+		App: []*serial.TypedMessage{
+			serial.ToTypedMessage(&dispatcher.Config{}),
+			serial.ToTypedMessage(&proxyman.OutboundConfig{}),
+			serial.ToTypedMessage(&stats.Config{}),
+		},
+		Outbound: append([]*core.OutboundHandlerConfig{
+			{
+				Tag:           "race",
+				ProxySettings: serial.ToTypedMessage(config),
+			},
+		}, outbounds...),
+	})
+	common.Must(err)
+	common.Must(server.Start())
+	return server
+}
+
+func wins(server *core.Instance, tag string) int64 {
+	c := server.GetFeature(feature_stats.ManagerType()).(feature_stats.Manager).GetCounter("outbound>>>race>>>race>>>" + tag + ">>>won")
+	if c == nil {
+		return 0
+	}
+	return c.Value()
+}
+
+func TestRaceTCP(t *testing.T) {
+	slowServer := tcp.Server{
+		MsgProcessor: func(b []byte) []byte {
+			time.Sleep(time.Millisecond * 500)
+			return xor(b)
+		},
+	}
+	slowDest, err := slowServer.Start()
+	common.Must(err)
+	defer slowServer.Close()
+
+	fastServer := tcp.Server{
+		MsgProcessor: xor,
+	}
+	fastDest, err := fastServer.Start()
+	common.Must(err)
+	defer fastServer.Close()
+
+	server := startInstance(t, &race.Config{OutboundTags: []string{"blocked", "slow", "fast"}},
+		&core.OutboundHandlerConfig{
+			Tag:           "blocked",
+			ProxySettings: serial.ToTypedMessage(&blackhole.Config{}),
+		},
+		redirect("slow", slowDest),
+		redirect("fast", fastDest))
+	defer server.Close()
+
+	conn, err := core.Dial(context.Background(), server, fastDest)
+	common.Must(err)
+	defer conn.Close()
+
+	payload := []byte("client hello")
+	for i := 0; i < 3; i++ {
+		common.Must2(conn.Write(payload))
+		response := make([]byte, len(payload))
+		common.Must2(io.ReadFull(conn, response))
+		if r := cmp.Diff(xor(response), payload); r != "" {
+			t.Error(r)
+		}
+	}
+	if v := wins(server, "fast"); v != 1 {
+		t.Error("expect fast outbound to win once, but got ", v)
+	}
+	if v := wins(server, "slow") + wins(server, "blocked"); v != 0 {
+		t.Error("expect other outbounds not to win, but got ", v)
+	}
+}
+
+func TestRaceTCPMaxPayload(t *testing.T) {
+	tcpServer := tcp.Server{
+		MsgProcessor: xor,
+	}
+	dest, err := tcpServer.Start()
+	common.Must(err)
+	defer tcpServer.Close()
+
+	server := startInstance(t, &race.Config{OutboundTags: []string{"first", "second"}, MaxPayload: 16},
+		redirect("first", dest),
+		redirect("second", dest))
+	defer server.Close()
+
+	conn, err := core.Dial(context.Background(), server, dest)
+	common.Must(err)
+	defer conn.Close()
+
+	// The first outbound is kept once the payload is over the limit, before any response.
+	payload := make([]byte, 32)
+	common.Must2(conn.Write(payload))
+	response := make([]byte, len(payload))
+	common.Must2(io.ReadFull(conn, response))
+	if r := cmp.Diff(xor(response), payload); r != "" {
+		t.Error(r)
+	}
+	if v := wins(server, "first"); v != 1 {
+		t.Error("expect first outbound kept, but got ", v, " wins")
+	}
+}
+
+func TestRaceUDP(t *testing.T) {
+	udpServer := udp.Server{
+		MsgProcessor: xor,
+	}
+	dest, err := udpServer.Start()
+	common.Must(err)
+	defer udpServer.Close()
+
+	server := startInstance(t, &race.Config{OutboundTags: []string{"a", "b"}},
+		redirect("a", dest),
+		redirect("b", dest))
+	defer server.Close()
+
+	conn, err := core.Dial(context.Background(), server, dest)
+	common.Must(err)
+	defer conn.Close()
+
+	payload := []byte("dns query")
+	common.Must2(conn.Write(payload))
+	response := make([]byte, 1024)
+	n, err := conn.Read(response)
+	common.Must(err)
+	if r := cmp.Diff(xor(response[:n]), payload); r != "" {
+		t.Error(r)
+	}
+
+	// The copy of the response through the other outbound is dropped.
+	result := make(chan int, 1)
+	go func() {
+		n, _ := conn.Read(response)
+		result <- n
+	}()
+	select {
+	case n := <-result:
+		t.Error("expect duplicate response dropped, but got ", n, " bytes")
+	case <-time.After(time.Millisecond * 500):
+	}
+	if v := wins(server, "a") + wins(server, "b"); v != 1 {
+		t.Error("expect a single first arrival, but got ", v)
+	}
+}
@@ -0,0 +1,69 @@
+package proxy
+
+import (
+	"bytes"
+
+	"v2ray.com/core/common/buf"
+	"v2ray.com/core/common/errors"
+	"v2ray.com/core/common/net"
+)
+
+// RoutingHintMagic starts a routing hint, which a trusted client may send at the start of a TCP stream to
+// choose the outbound of the connection. The magic is followed by the length of the outbound tag in a byte,
+// and the tag.
+var RoutingHintMagic = []byte{0x00, 'v', '2', 'h'}
+
+// ReadRoutingHint reads the routing hint at the start of the stream, and returns the outbound tag in it.
+// If the stream doesn't start with a routing hint, it returns an empty tag, and the bytes read are kept
+// in the reader. A read timeout before the magic is complete is taken as a stream without a routing hint,
+// so that the reader may bound the wait for it, e.g. for protocols where the server speaks first.
+func ReadRoutingHint(reader *buf.BufferedReader) (string, error) {
+	header := buf.New()
+	for header.Len() < int32(len(RoutingHintMagic)) {
+		if _, err := header.ReadFullFrom(reader, 1); err != nil {
+			if header.IsEmpty() {
+				header.Release()
+			} else {
+				reader.Buffer = append(buf.MultiBuffer{header}, reader.Buffer...)
+			}
+			if netErr, ok := errors.Cause(err).(net.Error); ok && netErr.Timeout() {
+				return "", nil
+			}
+			return "", err
+		}
+		if !bytes.HasPrefix(RoutingHintMagic, header.Bytes()) {
+			reader.Buffer = append(buf.MultiBuffer{header}, reader.Buffer...)
+			return "", nil
+		}
+	}
+
+	header.Clear()
+	if _, err := header.ReadFullFrom(reader, 1); err != nil {
+		header.Release()
+		return "", newError("failed to read length of routing hint").Base(err)
+	}
+	length := int32(header.Byte(0))
+	if length == 0 {
+		header.Release()
+		return "", newError("empty outbound tag in routing hint")
+	}
+	header.Clear()
+	if _, err := header.ReadFullFrom(reader, length); err != nil {
+		header.Release()
+		return "", newError("failed to read routing hint").Base(err)
+	}
+	tag := header.String()
+	header.Release()
+	return tag, nil
+}
+
+// WriteRoutingHint returns the routing hint of the outbound tag, to be sent at the start of a stream.
+func WriteRoutingHint(tag string) ([]byte, error) {
+	if len(tag) == 0 || len(tag) > 255 {
+		return nil, newError("invalid length of outbound tag in routing hint: ", len(tag))
+	}
+	hint := make([]byte, 0, len(RoutingHintMagic)+1+len(tag))
+	hint = append(hint, RoutingHintMagic...)
+	hint = append(hint, byte(len(tag)))
+	return append(hint, tag...), nil
+}
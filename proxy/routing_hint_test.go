@@ -0,0 +1,80 @@
+package proxy_test
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"v2ray.com/core/common"
+	"v2ray.com/core/common/buf"
+	. "v2ray.com/core/proxy"
+)
+
+func TestReadRoutingHint(t *testing.T) {
+	hint, err := WriteRoutingHint("direct")
+	common.Must(err)
+
+	for _, c := range []struct {
+		input []byte
+		tag   string
+		rest  []byte
+	}{
+		{append(hint, "payload"...), "direct", []byte("payload")},
+		{[]byte("GET / HTTP/1.1\r\n"), "", []byte("GET / HTTP/1.1\r\n")},
+		// The stream may start with a part of the magic.
+		{append(RoutingHintMagic[:2:2], 0x16, 0x03), "", append(RoutingHintMagic[:2:2], 0x16, 0x03)},
+	} {
+		reader := &buf.BufferedReader{Reader: buf.NewReader(bytes.NewReader(c.input))}
+		tag, err := ReadRoutingHint(reader)
+		common.Must(err)
+		if tag != c.tag {
+			t.Error("expected tag ", c.tag, ", but got ", tag)
+		}
+		var rest bytes.Buffer
+		common.Must2(io.Copy(&rest, reader))
+		if !bytes.Equal(rest.Bytes(), c.rest) {
+			t.Error("expected remaining ", c.rest, ", but got ", rest.Bytes())
+		}
+	}
+
+	reader := &buf.BufferedReader{Reader: buf.NewReader(bytes.NewReader(hint[:len(hint)-1]))}
+	if _, err := ReadRoutingHint(reader); err == nil {
+		t.Error("expected error of truncated hint")
+	}
+	if _, err := WriteRoutingHint(""); err == nil {
+		t.Error("expected error of empty tag")
+	}
+}
+
+func TestReadRoutingHintTimeout(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	// Clients of protocols where the server speaks first send nothing.
+	common.Must(server.SetReadDeadline(time.Now().Add(100 * time.Millisecond)))
+	reader := &buf.BufferedReader{Reader: buf.NewReader(server)}
+	tag, err := ReadRoutingHint(reader)
+	common.Must(err)
+	if tag != "" {
+		t.Error("expected no tag, but got ", tag)
+	}
+
+	// A part of the magic is kept for the payload.
+	go func() {
+		common.Must2(client.Write(RoutingHintMagic[:2]))
+	}()
+	common.Must(server.SetReadDeadline(time.Now().Add(100 * time.Millisecond)))
+	tag, err = ReadRoutingHint(reader)
+	common.Must(err)
+	if tag != "" {
+		t.Error("expected no tag, but got ", tag)
+	}
+	rest := make([]byte, 2)
+	common.Must2(io.ReadFull(reader, rest))
+	if !bytes.Equal(rest, RoutingHintMagic[:2]) {
+		t.Error("expected remaining ", RoutingHintMagic[:2], ", but got ", rest)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"v2ray.com/core"
 	"v2ray.com/core/common"
 	"v2ray.com/core/common/buf"
+	"v2ray.com/core/common/errors"
 	"v2ray.com/core/common/net"
 	"v2ray.com/core/common/protocol"
 	"v2ray.com/core/common/retry"
@@ -15,6 +16,7 @@ import (
 	"v2ray.com/core/common/signal"
 	"v2ray.com/core/common/task"
 	"v2ray.com/core/features/policy"
+	"v2ray.com/core/proxy"
 	"v2ray.com/core/transport"
 	"v2ray.com/core/transport/internet"
 )
@@ -23,6 +25,7 @@ import (
 type Client struct {
 	serverPicker  protocol.ServerPicker
 	policyManager policy.Manager
+	udpOverTCP    bool
 }
 
 // NewClient create a new Shadowsocks client.
@@ -43,6 +46,7 @@ func NewClient(ctx context.Context, config *ClientConfig) (*Client, error) {
 	client := &Client{
 		serverPicker:  protocol.NewRoundRobinServerPicker(serverList),
 		policyManager: v.GetFeature(policy.ManagerType()).(policy.Manager),
+		udpOverTCP:    config.UdpOverTcp,
 	}
 	return client, nil
 }
@@ -55,6 +59,10 @@ func (c *Client) Process(ctx context.Context, link *transport.Link, dialer inter
 	}
 	destination := outbound.Target
 	network := destination.Network
+	udpOverTCP := network == net.Network_UDP && c.udpOverTCP
+	if udpOverTCP {
+		network = net.Network_TCP
+	}
 
 	var server *protocol.ServerSpec
 	var conn internet.Connection
@@ -72,7 +80,7 @@ func (c *Client) Process(ctx context.Context, link *transport.Link, dialer inter
 		return nil
 	})
 	if err != nil {
-		return newError("failed to find an available destination").AtWarning().Base(err)
+		return newError("failed to find an available destination").AtWarning().Base(err).WithKind(errors.KindUnreachable)
 	}
 	newError("tunneling request to ", destination, " via ", server.Destination()).WriteToLog(session.ExportIDToError(ctx))
 
@@ -83,7 +91,11 @@ func (c *Client) Process(ctx context.Context, link *transport.Link, dialer inter
 		Address: destination.Address,
 		Port:    destination.Port,
 	}
-	if destination.Network == net.Network_TCP {
+	if udpOverTCP {
+		request.Command = protocol.RequestCommandTCP
+		request.Address = net.DomainAddress(UDPOverTCPMagicAddress)
+		request.Port = 0
+	} else if destination.Network == net.Network_TCP {
 		request.Command = protocol.RequestCommandTCP
 	} else {
 		request.Command = protocol.RequestCommandUDP
@@ -106,6 +118,9 @@ func (c *Client) Process(ctx context.Context, link *transport.Link, dialer inter
 		if err != nil {
 			return newError("failed to write request").Base(err)
 		}
+		if udpOverTCP {
+			bodyWriter = &UDPOverTCPWriter{Writer: bodyWriter, Target: destination}
+		}
 
 		if err := bufferedWriter.SetBuffered(false); err != nil {
 			return err
@@ -123,6 +138,9 @@ func (c *Client) Process(ctx context.Context, link *transport.Link, dialer inter
 			if err != nil {
 				return err
 			}
+			if udpOverTCP {
+				responseReader = &UDPOverTCPReader{Reader: &buf.BufferedReader{Reader: responseReader}}
+			}
 
 			return buf.Copy(responseReader, link.Writer, buf.UpdateActivity(timer))
 		}
@@ -179,4 +197,5 @@ func init() {
 	common.Must(common.RegisterConfig((*ClientConfig)(nil), func(ctx context.Context, config interface{}) (interface{}, error) {
 		return NewClient(ctx, config.(*ClientConfig))
 	}))
+	common.Must(proxy.RegisterOutboundConfig((*ClientConfig)(nil)))
 }
@@ -1,6 +1,7 @@
 package shadowsocks_test
 
 import (
+	"bytes"
 	"crypto/rand"
 	"testing"
 
@@ -37,3 +38,48 @@ func TestAEADCipherUDP(t *testing.T) {
 		t.Error(diff)
 	}
 }
+
+func benchmarkAEADCipherStream(b *testing.B, cipherType shadowsocks.CipherType) {
+	const payloadSize = 16 * 1024
+
+	rawAccount := &shadowsocks.Account{
+		CipherType: cipherType,
+		Password:   "test",
+	}
+	account, err := rawAccount.AsAccount()
+	common.Must(err)
+	cipher := account.(*shadowsocks.MemoryAccount).Cipher
+
+	key := make([]byte, cipher.KeySize())
+	iv := make([]byte, cipher.IVSize())
+	payload := make([]byte, payloadSize)
+	common.Must2(rand.Read(payload))
+
+	cache := bytes.NewBuffer(make([]byte, 0, payloadSize*2))
+	writer, err := cipher.NewEncryptionWriter(key, iv, cache)
+	common.Must(err)
+	reader, err := cipher.NewDecryptionReader(key, iv, cache)
+	common.Must(err)
+
+	b.SetBytes(payloadSize)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		common.Must(writer.WriteMultiBuffer(buf.MergeBytes(nil, payload)))
+		var n int32
+		for n < payloadSize {
+			mb, err := reader.ReadMultiBuffer()
+			common.Must(err)
+			n += mb.Len()
+			buf.ReleaseMulti(mb)
+		}
+	}
+}
+
+func BenchmarkAES128GCMStream(b *testing.B) {
+	benchmarkAEADCipherStream(b, shadowsocks.CipherType_AES_128_GCM)
+}
+
+func BenchmarkChaCha20Poly1305Stream(b *testing.B) {
+	benchmarkAEADCipherStream(b, shadowsocks.CipherType_CHACHA20_POLY1305)
+}
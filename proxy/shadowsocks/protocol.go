@@ -11,6 +11,7 @@ import (
 	"io/ioutil"
 
 	"v2ray.com/core/common"
+	"v2ray.com/core/common/antireplay"
 	"v2ray.com/core/common/buf"
 	"v2ray.com/core/common/dice"
 	"v2ray.com/core/common/net"
@@ -19,8 +20,14 @@ import (
 
 const (
 	Version = 1
+
+	// replayFilterInterval is the time in seconds a salt is remembered at least.
+	replayFilterInterval = 120
 )
 
+// ErrReplay is returned by ReadTCPSession when the salt of the request has been seen recently.
+var ErrReplay = newError("replayed request")
+
 var addrParser = protocol.NewAddressParser(
 	protocol.AddressFamilyByte(0x01, net.AddressFamilyIPv4),
 	protocol.AddressFamilyByte(0x04, net.AddressFamilyIPv6),
@@ -31,7 +38,8 @@ var addrParser = protocol.NewAddressParser(
 )
 
 // ReadTCPSession reads a Shadowsocks TCP session from the given reader, returns its header and remaining parts.
-func ReadTCPSession(user *protocol.MemoryUser, reader io.Reader) (*protocol.RequestHeader, buf.Reader, error) {
+// If filter is not nil, requests with a salt in the filter are rejected as replays.
+func ReadTCPSession(user *protocol.MemoryUser, reader io.Reader, filter *antireplay.ReplayFilter) (*protocol.RequestHeader, buf.Reader, error) {
 	account := user.Account.(*MemoryAccount)
 
 	hashkdf := hmac.New(sha256.New, []byte("SSBSKDF"))
@@ -94,6 +102,12 @@ func ReadTCPSession(user *protocol.MemoryUser, reader io.Reader) (*protocol.Requ
 		return nil, nil, newError("invalid remote address.")
 	}
 
+	// The salt is checked only after the header is authenticated, so that garbage doesn't fill the filter.
+	if filter != nil && len(iv) > 0 && !filter.Check(iv) {
+		DrainConnN(reader, readSizeRemain)
+		return nil, nil, ErrReplay
+	}
+
 	return request, br, nil
 }
 
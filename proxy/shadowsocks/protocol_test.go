@@ -6,6 +6,7 @@ import (
 	"github.com/google/go-cmp/cmp"
 
 	"v2ray.com/core/common"
+	"v2ray.com/core/common/antireplay"
 	"v2ray.com/core/common/buf"
 	"v2ray.com/core/common/net"
 	"v2ray.com/core/common/protocol"
@@ -123,7 +124,7 @@ func TestTCPRequest(t *testing.T) {
 
 		common.Must(writer.WriteMultiBuffer(buf.MultiBuffer{data}))
 
-		decodedRequest, reader, err := ReadTCPSession(request.User, cache)
+		decodedRequest, reader, err := ReadTCPSession(request.User, cache, nil)
 		common.Must(err)
 		if equalRequestHeader(decodedRequest, request) == false {
 			t.Error("different request")
@@ -190,3 +191,78 @@ func TestUDPReaderWriter(t *testing.T) {
 		}
 	}
 }
+
+func TestTCPReplay(t *testing.T) {
+	request := &protocol.RequestHeader{
+		Version: Version,
+		Command: protocol.RequestCommandTCP,
+		Address: net.DomainAddress("v2fly.org"),
+		Port:    1234,
+		User: &protocol.MemoryUser{
+			Email: "love@v2fly.org",
+			Account: toAccount(&Account{
+				Password:   "password",
+				CipherType: CipherType_AES_128_GCM,
+			}),
+		},
+	}
+
+	cache := buf.New()
+	defer cache.Release()
+
+	writer, err := WriteTCPRequest(request, cache)
+	common.Must(err)
+	common.Must(writer.WriteMultiBuffer(buf.MultiBuffer{}))
+
+	replayed := buf.New()
+	defer replayed.Release()
+	common.Must2(replayed.Write(cache.Bytes()))
+
+	filter := antireplay.NewReplayFilter(120)
+	if _, _, err := ReadTCPSession(request.User, cache, filter); err != nil {
+		t.Fatal("failed to read request: ", err)
+	}
+	if _, _, err := ReadTCPSession(request.User, replayed, filter); err != ErrReplay {
+		t.Error("expected replayed request to be rejected, but got ", err)
+	}
+}
+
+func TestUDPOverTCPReaderWriter(t *testing.T) {
+	cache := buf.New()
+	defer cache.Release()
+
+	writer := &UDPOverTCPWriter{
+		Writer: buf.NewWriter(cache),
+		Target: net.UDPDestination(net.LocalHostIP, 53),
+	}
+	b := buf.New()
+	common.Must2(b.WriteString("hi"))
+	common.Must(writer.WriteMultiBuffer(buf.MultiBuffer{b}))
+
+	// Packets are framed as in version 1 of the UDP-over-TCP protocol.
+	if r := cmp.Diff(cache.Bytes(), []byte{0x01, 127, 0, 0, 1, 0, 53, 0, 2, 'h', 'i'}); r != "" {
+		t.Error(r)
+	}
+
+	b = buf.New()
+	common.Must2(b.WriteString("test payload"))
+	common.Must(writer.WritePacket(net.UDPDestination(net.DomainAddress("v2fly.org"), 123), b))
+
+	reader := &UDPOverTCPReader{Reader: cache}
+	for _, expected := range []struct {
+		dest    net.Destination
+		payload string
+	}{
+		{net.UDPDestination(net.LocalHostIP, 53), "hi"},
+		{net.UDPDestination(net.DomainAddress("v2fly.org"), 123), "test payload"},
+	} {
+		dest, payload, err := reader.ReadPacket()
+		common.Must(err)
+		if dest != expected.dest {
+			t.Error("unexpected destination: ", dest)
+		}
+		if payload.String() != expected.payload {
+			t.Error("unexpected output: ", payload.String())
+		}
+	}
+}
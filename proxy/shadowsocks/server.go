@@ -4,10 +4,12 @@ package shadowsocks
 
 import (
 	"context"
+	"sync"
 	"time"
 
 	"v2ray.com/core"
 	"v2ray.com/core/common"
+	"v2ray.com/core/common/antireplay"
 	"v2ray.com/core/common/buf"
 	"v2ray.com/core/common/log"
 	"v2ray.com/core/common/net"
@@ -18,6 +20,8 @@ import (
 	"v2ray.com/core/common/task"
 	"v2ray.com/core/features/policy"
 	"v2ray.com/core/features/routing"
+	"v2ray.com/core/features/stats"
+	"v2ray.com/core/proxy"
 	"v2ray.com/core/transport/internet"
 	"v2ray.com/core/transport/internet/udp"
 )
@@ -26,6 +30,8 @@ type Server struct {
 	config        *ServerConfig
 	user          *protocol.MemoryUser
 	policyManager policy.Manager
+	statsManager  stats.Manager
+	replayFilter  *antireplay.ReplayFilter
 }
 
 // NewServer create a new Shadowsocks server.
@@ -44,6 +50,8 @@ func NewServer(ctx context.Context, config *ServerConfig) (*Server, error) {
 		config:        config,
 		user:          mUser,
 		policyManager: v.GetFeature(policy.ManagerType()).(policy.Manager),
+		statsManager:  v.GetFeature(stats.ManagerType()).(stats.Manager),
+		replayFilter:  antireplay.NewReplayFilterWithCapacity(replayFilterInterval, config.ReplayFilterCapacity),
 	}
 
 	return s, nil
@@ -108,11 +116,12 @@ func (s *Server) handlerUDPPayload(ctx context.Context, conn internet.Connection
 			if err != nil {
 				if inbound := session.InboundFromContext(ctx); inbound != nil && inbound.Source.IsValid() {
 					newError("dropping invalid UDP packet from: ", inbound.Source).Base(err).WriteToLog(session.ExportIDToError(ctx))
-					log.Record(&log.AccessMessage{
-						From:   inbound.Source,
-						To:     "",
-						Status: log.AccessRejected,
-						Reason: err,
+					log.RecordContext(ctx, &log.AccessMessage{
+						From:      inbound.Source,
+						To:        "",
+						Status:    log.AccessRejected,
+						Reason:    err,
+						SessionID: uint32(session.IDFromContext(ctx)),
 					})
 				}
 				payload.Release()
@@ -140,19 +149,37 @@ func (s *Server) handlerUDPPayload(ctx context.Context, conn internet.Connection
 	return nil
 }
 
+// countReplay counts a replayed request in the stats of the inbound.
+func (s *Server) countReplay(ctx context.Context) {
+	inbound := session.InboundFromContext(ctx)
+	if inbound == nil || len(inbound.Tag) == 0 {
+		return
+	}
+	if c, _ := stats.GetOrRegisterCounter(s.statsManager, "inbound>>>"+inbound.Tag+">>>replay>>>rejected"); c != nil {
+		c.Add(1)
+	}
+}
+
 func (s *Server) handleConnection(ctx context.Context, conn internet.Connection, dispatcher routing.Dispatcher) error {
 	sessionPolicy := s.policyManager.ForLevel(s.user.Level)
 	conn.SetReadDeadline(time.Now().Add(sessionPolicy.Timeouts.Handshake))
 
 	bufferedReader := buf.BufferedReader{Reader: buf.NewReader(conn)}
-	request, bodyReader, err := ReadTCPSession(s.user, &bufferedReader)
+	request, bodyReader, err := ReadTCPSession(s.user, &bufferedReader, s.replayFilter)
 	if err != nil {
-		log.Record(&log.AccessMessage{
-			From:   conn.RemoteAddr(),
-			To:     "",
-			Status: log.AccessRejected,
-			Reason: err,
+		if err == ErrReplay {
+			s.countReplay(ctx)
+		}
+		log.RecordContext(ctx, &log.AccessMessage{
+			From:      conn.RemoteAddr(),
+			To:        "",
+			Status:    log.AccessRejected,
+			Reason:    err,
+			SessionID: uint32(session.IDFromContext(ctx)),
 		})
+		if inbound := session.InboundFromContext(ctx); inbound != nil {
+			inbound.AuthFailed = true
+		}
 		return newError("failed to create request from: ", conn.RemoteAddr()).Base(err)
 	}
 	conn.SetReadDeadline(time.Time{})
@@ -163,6 +190,13 @@ func (s *Server) handleConnection(ctx context.Context, conn internet.Connection,
 	}
 	inbound.User = s.user
 
+	if IsUDPOverTCPRequest(request.Address) {
+		if !s.config.UdpOverTcp {
+			return newError("UDP over TCP is not enabled")
+		}
+		return s.handleUDPOverTCP(ctx, conn, request, bodyReader, dispatcher)
+	}
+
 	dest := request.Destination()
 	ctx = log.ContextWithAccessMessage(ctx, &log.AccessMessage{
 		From:   conn.RemoteAddr(),
@@ -232,8 +266,63 @@ func (s *Server) handleConnection(ctx context.Context, conn internet.Connection,
 	return nil
 }
 
+// handleUDPOverTCP relays the UDP packets tunneled in the TCP connection of the request.
+func (s *Server) handleUDPOverTCP(ctx context.Context, conn internet.Connection, request *protocol.RequestHeader, bodyReader buf.Reader, dispatcher routing.Dispatcher) error {
+	sessionPolicy := s.policyManager.ForLevel(s.user.Level)
+	ctx, cancel := context.WithCancel(ctx)
+	timer := signal.CancelAfterInactivity(ctx, cancel, sessionPolicy.Timeouts.ConnectionIdle)
+
+	bufferedWriter := buf.NewBufferedWriter(buf.NewWriter(conn))
+	responseWriter, err := WriteTCPResponse(request, bufferedWriter)
+	if err != nil {
+		return newError("failed to write response").Base(err)
+	}
+	if err := bufferedWriter.SetBuffered(false); err != nil {
+		return err
+	}
+
+	var writeAccess sync.Mutex
+	writer := &UDPOverTCPWriter{Writer: responseWriter}
+	udpServer := udp.NewDispatcher(dispatcher, func(ctx context.Context, packet *udp_proto.Packet) {
+		writeAccess.Lock()
+		defer writeAccess.Unlock()
+		if err := writer.WritePacket(packet.Source, packet.Payload); err != nil {
+			newError("failed to write UDP packet").Base(err).WriteToLog(session.ExportIDToError(ctx))
+			return
+		}
+		timer.Update()
+	})
+
+	requestDone := func() error {
+		reader := &UDPOverTCPReader{Reader: &buf.BufferedReader{Reader: bodyReader}}
+		for {
+			dest, payload, err := reader.ReadPacket()
+			if err != nil {
+				return newError("failed to read UDP packet").Base(err)
+			}
+			timer.Update()
+
+			currentPacketCtx := log.ContextWithAccessMessage(ctx, &log.AccessMessage{
+				From:   conn.RemoteAddr(),
+				To:     dest,
+				Status: log.AccessAccepted,
+				Reason: "",
+				Email:  request.User.Email,
+			})
+			newError("tunnelling request to ", dest, " over TCP").WriteToLog(session.ExportIDToError(currentPacketCtx))
+			udpServer.Dispatch(currentPacketCtx, dest, payload)
+		}
+	}
+
+	if err := task.Run(ctx, requestDone); err != nil {
+		return newError("connection ends").Base(err)
+	}
+	return nil
+}
+
 func init() {
 	common.Must(common.RegisterConfig((*ServerConfig)(nil), func(ctx context.Context, config interface{}) (interface{}, error) {
 		return NewServer(ctx, config.(*ServerConfig))
 	}))
+	common.Must(proxy.RegisterInboundConfig((*ServerConfig)(nil)))
 }
@@ -0,0 +1,109 @@
+// +build !confonly
+
+package shadowsocks
+
+import (
+	"encoding/binary"
+	"io"
+
+	"v2ray.com/core/common/buf"
+	"v2ray.com/core/common/net"
+)
+
+// UDPOverTCPMagicAddress is the destination of the TCP requests that carry UDP packets, in version 1 of the
+// UDP-over-TCP protocol. In such a request, each packet is framed as its address, port, length and payload.
+const UDPOverTCPMagicAddress = "sp.udp-over-tcp.arpa"
+
+// IsUDPOverTCPRequest returns true if the TCP request carries UDP packets.
+func IsUDPOverTCPRequest(address net.Address) bool {
+	return address.Family().IsDomain() && address.Domain() == UDPOverTCPMagicAddress
+}
+
+// UDPOverTCPWriter writes UDP packets into a TCP stream.
+type UDPOverTCPWriter struct {
+	Writer buf.Writer
+	// Target is the destination of the packets written by WriteMultiBuffer.
+	Target net.Destination
+}
+
+func (w *UDPOverTCPWriter) appendPacket(mb buf.MultiBuffer, dest net.Destination, payload *buf.Buffer) (buf.MultiBuffer, error) {
+	header := buf.New()
+	if err := addrParser.WriteAddressPort(header, dest.Address, dest.Port); err != nil {
+		header.Release()
+		return mb, newError("failed to write address").Base(err)
+	}
+	binary.BigEndian.PutUint16(header.Extend(2), uint16(payload.Len()))
+	return append(mb, header, payload), nil
+}
+
+// WritePacket writes a packet from or to the destination.
+func (w *UDPOverTCPWriter) WritePacket(dest net.Destination, payload *buf.Buffer) error {
+	mb, err := w.appendPacket(nil, dest, payload)
+	if err != nil {
+		payload.Release()
+		return err
+	}
+	return w.Writer.WriteMultiBuffer(mb)
+}
+
+// WriteMultiBuffer implements buf.Writer. Each buffer is a packet to Target.
+func (w *UDPOverTCPWriter) WriteMultiBuffer(mb buf.MultiBuffer) error {
+	packets := make(buf.MultiBuffer, 0, len(mb)*2)
+	for i, payload := range mb {
+		var err error
+		packets, err = w.appendPacket(packets, w.Target, payload)
+		if err != nil {
+			buf.ReleaseMulti(mb[i:])
+			buf.ReleaseMulti(packets)
+			return err
+		}
+	}
+	return w.Writer.WriteMultiBuffer(packets)
+}
+
+// UDPOverTCPReader reads UDP packets from a TCP stream.
+type UDPOverTCPReader struct {
+	Reader io.Reader
+}
+
+// ReadPacket reads a packet, and returns the destination it is from or to.
+func (r *UDPOverTCPReader) ReadPacket() (net.Destination, *buf.Buffer, error) {
+	for {
+		header := buf.New()
+		addr, port, err := addrParser.ReadAddressPort(header, r.Reader)
+		if err != nil {
+			header.Release()
+			return net.Destination{}, nil, newError("failed to read address").Base(err)
+		}
+		header.Clear()
+		if _, err := header.ReadFullFrom(r.Reader, 2); err != nil {
+			header.Release()
+			return net.Destination{}, nil, newError("failed to read length").Base(err)
+		}
+		length := int32(binary.BigEndian.Uint16(header.Bytes()))
+		header.Release()
+
+		if length > buf.Size {
+			// Packets too large for a buffer are dropped, as they would be by the UDP relay.
+			if err := DrainConnN(r.Reader, int(length)); err != nil {
+				return net.Destination{}, nil, newError("failed to skip packet").Base(err)
+			}
+			continue
+		}
+		payload := buf.New()
+		if _, err := payload.ReadFullFrom(r.Reader, length); err != nil {
+			payload.Release()
+			return net.Destination{}, nil, newError("failed to read payload").Base(err)
+		}
+		return net.UDPDestination(addr, port), payload, nil
+	}
+}
+
+// ReadMultiBuffer implements buf.Reader.
+func (r *UDPOverTCPReader) ReadMultiBuffer() (buf.MultiBuffer, error) {
+	_, payload, err := r.ReadPacket()
+	if err != nil {
+		return nil, err
+	}
+	return buf.MultiBuffer{payload}, nil
+}
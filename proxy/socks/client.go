@@ -4,11 +4,13 @@ package socks
 
 import (
 	"context"
+	"io"
 	"time"
 
 	"v2ray.com/core"
 	"v2ray.com/core/common"
 	"v2ray.com/core/common/buf"
+	"v2ray.com/core/common/errors"
 	"v2ray.com/core/common/net"
 	"v2ray.com/core/common/protocol"
 	"v2ray.com/core/common/retry"
@@ -16,8 +18,10 @@ import (
 	"v2ray.com/core/common/signal"
 	"v2ray.com/core/common/task"
 	"v2ray.com/core/features/policy"
+	"v2ray.com/core/proxy"
 	"v2ray.com/core/transport"
 	"v2ray.com/core/transport/internet"
+	"v2ray.com/core/transport/internet/udp"
 )
 
 // Client is a Socks5 client.
@@ -74,7 +78,7 @@ func (c *Client) Process(ctx context.Context, link *transport.Link, dialer inter
 
 		return nil
 	}); err != nil {
-		return newError("failed to find an available destination").Base(err)
+		return newError("failed to find an available destination").Base(err).WithKind(errors.KindUnreachable)
 	}
 
 	defer func() {
@@ -150,7 +154,20 @@ func (c *Client) Process(ctx context.Context, link *transport.Link, dialer inter
 	}
 
 	var responseDonePost = task.OnSuccess(responseFunc, task.Close(link.Writer))
-	if err := task.Run(ctx, requestFunc, responseDonePost); err != nil {
+	tasks := []func() error{requestFunc, responseDonePost}
+	if request.Command == protocol.RequestCommandUDP {
+		// The server closes the control connection when the association ends, e.g. after the
+		// destination turned out to be unreachable.
+		tasks = append(tasks, func() error {
+			if err := common.Error2(io.Copy(buf.DiscardBytes, conn)); err != nil {
+				return newError("UDP association control connection failed").Base(err)
+			}
+			err := newError("UDP association closed by server")
+			udp.ReportFailure(ctx, err)
+			return err
+		})
+	}
+	if err := task.Run(ctx, tasks...); err != nil {
 		return newError("connection ends").Base(err)
 	}
 
@@ -161,4 +178,5 @@ func init() {
 	common.Must(common.RegisterConfig((*ClientConfig)(nil), func(ctx context.Context, config interface{}) (interface{}, error) {
 		return NewClient(ctx, config.(*ClientConfig))
 	}))
+	common.Must(proxy.RegisterOutboundConfig((*ClientConfig)(nil)))
 }
@@ -8,6 +8,7 @@ import (
 
 	"v2ray.com/core/common"
 	"v2ray.com/core/common/buf"
+	"v2ray.com/core/common/errors"
 	"v2ray.com/core/common/net"
 	"v2ray.com/core/common/protocol"
 )
@@ -25,8 +26,8 @@ const (
 	socks4RequestGranted  = 90
 	socks4RequestRejected = 91
 
-	authNotRequired = 0x00
-	// authGssAPI           = 0x01
+	authNotRequired      = 0x00
+	authGssAPI           = 0x01
 	authPassword         = 0x02
 	authNoMatchingMethod = 0xFF
 
@@ -50,7 +51,7 @@ type ServerSession struct {
 func (s *ServerSession) handshake4(cmd byte, reader io.Reader, writer io.Writer) (*protocol.RequestHeader, error) {
 	if s.config.AuthType == AuthType_PASSWORD {
 		writeSocks4Response(writer, socks4RequestRejected, net.AnyIP, net.Port(0))
-		return nil, newError("socks 4 is not allowed when auth is required.")
+		return nil, newError("socks 4 is not allowed when auth is required.").WithKind(errors.KindAuth)
 	}
 
 	var port net.Port
@@ -126,7 +127,7 @@ func (s *ServerSession) auth5(nMethod byte, reader io.Reader, writer io.Writer)
 
 		if !s.config.HasAccount(username, password) {
 			writeSocks5AuthenticationResponse(writer, 0x01, 0xFF)
-			return "", newError("invalid username or password")
+			return "", newError("invalid username or password").WithKind(errors.KindAuth)
 		}
 
 		if err := writeSocks5AuthenticationResponse(writer, 0x01, 0x00); err != nil {
@@ -369,15 +370,21 @@ func NewUDPReader(reader io.Reader) *UDPReader {
 	return &UDPReader{reader: reader}
 }
 
+// ReadMultiBuffer implements buf.Reader. Packets that fail to decode, e.g. fragments, are dropped.
 func (r *UDPReader) ReadMultiBuffer() (buf.MultiBuffer, error) {
-	b := buf.New()
-	if _, err := b.ReadFrom(r.reader); err != nil {
-		return nil, err
-	}
-	if _, err := DecodeUDPPacket(b); err != nil {
-		return nil, err
+	for {
+		b := buf.New()
+		if _, err := b.ReadFrom(r.reader); err != nil {
+			b.Release()
+			return nil, err
+		}
+		if _, err := DecodeUDPPacket(b); err != nil {
+			b.Release()
+			newError("dropping UDP packet").Base(err).AtDebug().WriteToLog()
+			continue
+		}
+		return buf.MultiBuffer{b}, nil
 	}
-	return buf.MultiBuffer{b}, nil
 }
 
 type UDPWriter struct {
@@ -437,8 +444,14 @@ func ClientHandshake(request *protocol.RequestHeader, reader io.Reader, writer i
 	if b.Byte(0) != socks5Version {
 		return nil, newError("unexpected server version: ", b.Byte(0)).AtWarning()
 	}
-	if b.Byte(1) != authByte {
-		return nil, newError("auth method not supported.").AtWarning()
+	switch b.Byte(1) {
+	case authByte:
+	case authNoMatchingMethod:
+		return nil, newError("server accepts none of the offered auth methods.").AtWarning()
+	case authGssAPI:
+		return nil, newError("server requires GSSAPI auth, which is not supported.").AtWarning()
+	default:
+		return nil, newError("auth method not supported: ", b.Byte(1)).AtWarning()
 	}
 
 	if authByte == authPassword {
@@ -454,11 +467,16 @@ func ClientHandshake(request *protocol.RequestHeader, reader io.Reader, writer i
 	b.Clear()
 
 	command := byte(cmdTCPConnect)
+	address, port := request.Address, request.Port
 	if request.Command == protocol.RequestCommandUDP {
 		command = byte(cmdUDPAssociate)
+		// The address in UDP ASSOCIATE is where the client sends datagrams from, rather than the destination.
+		// It is unknown before the UDP connection is dialed, so it is all zeros, as RFC 1928 asks. Servers that
+		// filter datagrams by the address would drop all of them, given the destination.
+		address, port = net.AnyIP, 0
 	}
 	common.Must2(b.Write([]byte{socks5Version, command, 0x00 /* reserved */}))
-	if err := addrParser.WriteAddressPort(b, request.Address, request.Port); err != nil {
+	if err := addrParser.WriteAddressPort(b, address, port); err != nil {
 		return nil, err
 	}
 
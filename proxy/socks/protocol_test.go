@@ -2,6 +2,8 @@ package socks_test
 
 import (
 	"bytes"
+	"io"
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -109,6 +111,94 @@ func TestReadUntilNull(t *testing.T) {
 	}
 }
 
+type packetReader [][]byte
+
+func (r *packetReader) Read(b []byte) (int, error) {
+	if len(*r) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(b, (*r)[0])
+	*r = (*r)[1:]
+	return n, nil
+}
+
+func TestUDPReaderDropsFragments(t *testing.T) {
+	reader := NewUDPReader(&packetReader{
+		{0, 0, 1 /* fragment */, 1, 1, 2, 3, 4, 0, 53, 'a'},
+		{0, 0, 0, 1, 1, 2, 3, 4, 0, 53, 'b'},
+	})
+
+	mb, err := reader.ReadMultiBuffer()
+	common.Must(err)
+	if r := cmp.Diff(mb[0].Bytes(), []byte{'b'}); r != "" {
+		t.Error(r)
+	}
+	buf.ReleaseMulti(mb)
+
+	if _, err := reader.ReadMultiBuffer(); err != io.EOF {
+		t.Error("expect EOF, but actually ", err)
+	}
+}
+
+func TestClientHandshakeAuthMethod(t *testing.T) {
+	testCases := []struct {
+		Response []byte
+		Error    string
+	}{
+		{
+			Response: []byte{0x05, 0xFF},
+			Error:    "none of the offered auth methods",
+		},
+		{
+			Response: []byte{0x05, 0x01},
+			Error:    "GSSAPI",
+		},
+		{
+			Response: []byte{0x05, 0x02},
+			Error:    "auth method not supported",
+		},
+	}
+
+	for _, testCase := range testCases {
+		request := &protocol.RequestHeader{
+			Command: protocol.RequestCommandTCP,
+			Address: net.DomainAddress("v2fly.org"),
+			Port:    80,
+		}
+		var output bytes.Buffer
+		_, err := ClientHandshake(request, bytes.NewReader(testCase.Response), &output)
+		if err == nil || !strings.Contains(err.Error(), testCase.Error) {
+			t.Error("for response: ", testCase.Response, " expect error ", testCase.Error, ", but actually ", err)
+		}
+	}
+}
+
+func TestClientHandshakeUDPAssociate(t *testing.T) {
+	request := &protocol.RequestHeader{
+		Command: protocol.RequestCommandUDP,
+		Address: net.DomainAddress("v2fly.org"),
+		Port:    53,
+	}
+	response := []byte{
+		0x05, 0x00, // method selection
+		0x05, 0x00, 0x00, 0x01, 0, 0, 0, 0, 0x04, 0x38, // reply with relay address
+	}
+	var output bytes.Buffer
+	udpRequest, err := ClientHandshake(request, bytes.NewReader(response), &output)
+	common.Must(err)
+
+	expectedOutput := []byte{
+		0x05, 0x01, 0x00, // methods
+		0x05, 0x03, 0x00, 0x01, 0, 0, 0, 0, 0, 0, // UDP ASSOCIATE with all zeros
+	}
+	if r := cmp.Diff(output.Bytes(), expectedOutput); r != "" {
+		t.Error(r)
+	}
+	if udpRequest.Address != net.AnyIP || udpRequest.Port != 1080 {
+		t.Error("unexpected relay address: ", udpRequest.Destination())
+	}
+}
+
 func BenchmarkReadUsernamePassword(b *testing.B) {
 	input := []byte{0x05, 0x01, 'a', 0x02, 'b', 'c'}
 	buffer := buf.New()
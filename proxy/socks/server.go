@@ -5,11 +5,13 @@ package socks
 import (
 	"context"
 	"io"
+	"sync"
 	"time"
 
 	"v2ray.com/core"
 	"v2ray.com/core/common"
 	"v2ray.com/core/common/buf"
+	"v2ray.com/core/common/errors"
 	"v2ray.com/core/common/log"
 	"v2ray.com/core/common/net"
 	"v2ray.com/core/common/protocol"
@@ -20,6 +22,7 @@ import (
 	"v2ray.com/core/features"
 	"v2ray.com/core/features/policy"
 	"v2ray.com/core/features/routing"
+	"v2ray.com/core/proxy"
 	"v2ray.com/core/transport/internet"
 	"v2ray.com/core/transport/internet/udp"
 )
@@ -28,6 +31,17 @@ import (
 type Server struct {
 	config        *ServerConfig
 	policyManager policy.Manager
+
+	associationAccess sync.Mutex
+	associations      map[string][]*udpAssociation
+}
+
+// udpAssociation is the TCP control connection of a UDP ASSOCIATE request. The association
+// lives as long as the control connection stays open.
+type udpAssociation struct {
+	conn internet.Connection
+	// port is the UDP source port the client declared in its request, or 0.
+	port net.Port
 }
 
 // NewServer creates a new Server object.
@@ -36,6 +50,7 @@ func NewServer(ctx context.Context, config *ServerConfig) (*Server, error) {
 	s := &Server{
 		config:        config,
 		policyManager: v.GetFeature(policy.ManagerType()).(policy.Manager),
+		associations:  make(map[string][]*udpAssociation),
 	}
 	return s, nil
 }
@@ -79,6 +94,17 @@ func (s *Server) Process(ctx context.Context, network net.Network, conn internet
 	}
 }
 
+// peekVersion returns the version byte at the start of the stream, which is kept in the reader.
+func peekVersion(reader *buf.BufferedReader) (byte, error) {
+	b := buf.New()
+	if _, err := b.ReadFullFrom(reader, 1); err != nil {
+		b.Release()
+		return 0, err
+	}
+	reader.Buffer = append(buf.MultiBuffer{b}, reader.Buffer...)
+	return b.Byte(0), nil
+}
+
 func (s *Server) processTCP(ctx context.Context, conn internet.Connection, dispatcher routing.Dispatcher) error {
 	plcy := s.policy()
 	if err := conn.SetReadDeadline(time.Now().Add(plcy.Timeouts.Handshake)); err != nil {
@@ -98,16 +124,36 @@ func (s *Server) processTCP(ctx context.Context, conn internet.Connection, dispa
 	}
 
 	reader := &buf.BufferedReader{Reader: buf.NewReader(conn)}
+	if s.config.AcceptRoutingHint {
+		tag, err := proxy.ReadRoutingHint(reader)
+		if err != nil {
+			return newError("failed to read routing hint").Base(err)
+		}
+		if tag != "" {
+			newError("routing hint requests outbound [", tag, "]").WriteToLog(session.ExportIDToError(ctx))
+			ctx = session.ContextWithOutboundTag(ctx, tag)
+		}
+	}
+	version, err := peekVersion(reader)
+	if err != nil {
+		return newError("failed to read request").Base(err)
+	}
+	if version != socks4Version && version != socks5Version {
+		return proxy.HandleMismatch(ctx, s.config.Mismatch, conn, reader, plcy)
+	}
 	request, err := svrSession.Handshake(reader, conn)
 	if err != nil {
 		if inbound != nil && inbound.Source.IsValid() {
-			log.Record(&log.AccessMessage{
+			log.RecordContext(ctx, &log.AccessMessage{
 				From:   inbound.Source,
 				To:     "",
 				Status: log.AccessRejected,
 				Reason: err,
 			})
 		}
+		if inbound != nil && errors.Cause(err) != io.EOF {
+			inbound.AuthFailed = true
+		}
 		return newError("failed to read request").Base(err)
 	}
 	if request.User != nil {
@@ -134,16 +180,74 @@ func (s *Server) processTCP(ctx context.Context, conn internet.Connection, dispa
 	}
 
 	if request.Command == protocol.RequestCommandUDP {
-		return s.handleUDP(conn)
+		return s.handleUDP(conn, inbound.Source.Address, request.Port)
 	}
 
 	return nil
 }
 
-func (*Server) handleUDP(c io.Reader) error {
+func (s *Server) handleUDP(conn internet.Connection, client net.Address, port net.Port) error {
+	association := &udpAssociation{
+		conn: conn,
+		port: port,
+	}
+	key := client.String()
+
+	s.associationAccess.Lock()
+	s.associations[key] = append(s.associations[key], association)
+	s.associationAccess.Unlock()
+
+	defer func() {
+		s.associationAccess.Lock()
+		defer s.associationAccess.Unlock()
+
+		list := s.associations[key]
+		for i, a := range list {
+			if a == association {
+				list = append(list[:i], list[i+1:]...)
+				break
+			}
+		}
+		if len(list) == 0 {
+			delete(s.associations, key)
+		} else {
+			s.associations[key] = list
+		}
+	}()
+
 	// The TCP connection closes after this method returns. We need to wait until
 	// the client closes it.
-	return common.Error2(io.Copy(buf.DiscardBytes, c))
+	return common.Error2(io.Copy(buf.DiscardBytes, conn))
+}
+
+// closeAssociations closes the control connection of the UDP association the given UDP source
+// belongs to, so that the client stops sending to a destination that is known to be unreachable.
+// Associations that the source can't be told from are left open.
+func (s *Server) closeAssociations(source net.Destination) {
+	s.associationAccess.Lock()
+	list := s.associations[source.Address.String()]
+	var matched []*udpAssociation
+	for _, a := range list {
+		if a.port == source.Port {
+			matched = append(matched, a)
+		}
+	}
+	if len(matched) == 0 && len(list) == 1 {
+		// The source port of clients behind NAT, or ones that don't declare it, differs from the
+		// request. It still tells the association if it is the only one from the address.
+		matched = list
+	}
+	s.associationAccess.Unlock()
+
+	if len(matched) == 0 && len(list) > 0 {
+		newError("UDP association of ", source, " is ambiguous, leaving ", len(list), " associations open").AtDebug().WriteToLog()
+	}
+
+	for _, a := range matched {
+		if err := a.conn.Close(); err != nil {
+			newError("failed to close UDP association of ", source).Base(err).WriteToLog()
+		}
+	}
 }
 
 func (s *Server) transport(ctx context.Context, reader io.Reader, writer io.Writer, dest net.Destination, dispatcher routing.Dispatcher) error {
@@ -205,7 +309,14 @@ func (s *Server) handleUDPPayload(ctx context.Context, conn internet.Connection,
 		}
 
 		conn.Write(udpMessage.Bytes())
-	})
+	}, udp.OnFailure(func(ctx context.Context, dest net.Destination, err error) {
+		inbound := session.InboundFromContext(ctx)
+		if inbound == nil || !inbound.Source.IsValid() {
+			return
+		}
+		newError("closing UDP association of ", inbound.Source, " as ", dest, " failed").Base(err).WriteToLog(session.ExportIDToError(ctx))
+		s.closeAssociations(inbound.Source)
+	}))
 
 	if inbound := session.InboundFromContext(ctx); inbound != nil && inbound.Source.IsValid() {
 		newError("client UDP connection from ", inbound.Source).WriteToLog(session.ExportIDToError(ctx))
@@ -252,4 +363,5 @@ func init() {
 	common.Must(common.RegisterConfig((*ServerConfig)(nil), func(ctx context.Context, config interface{}) (interface{}, error) {
 		return NewServer(ctx, config.(*ServerConfig))
 	}))
+	common.Must(proxy.RegisterInboundConfig((*ServerConfig)(nil)))
 }
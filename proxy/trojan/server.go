@@ -23,6 +23,7 @@ import (
 	"v2ray.com/core/common/task"
 	"v2ray.com/core/features/policy"
 	"v2ray.com/core/features/routing"
+	"v2ray.com/core/proxy"
 	"v2ray.com/core/transport/internet"
 	"v2ray.com/core/transport/internet/udp"
 )
@@ -31,6 +32,7 @@ func init() {
 	common.Must(common.RegisterConfig((*ServerConfig)(nil), func(ctx context.Context, config interface{}) (interface{}, error) {
 		return NewServer(ctx, config.(*ServerConfig))
 	}))
+	common.Must(proxy.RegisterInboundConfig((*ServerConfig)(nil)))
 }
 
 // Server is an inbound connection handler that handles messages in trojan protocol.
@@ -136,7 +138,7 @@ func (s *Server) Process(ctx context.Context, network net.Network, conn internet
 	if firstLen < 58 || first.Byte(56) != '\r' {
 		// invalid protocol
 		err = newError("not trojan protocol")
-		log.Record(&log.AccessMessage{
+		log.RecordContext(ctx, &log.AccessMessage{
 			From:   conn.RemoteAddr(),
 			To:     "",
 			Status: log.AccessRejected,
@@ -149,7 +151,7 @@ func (s *Server) Process(ctx context.Context, network net.Network, conn internet
 		if user == nil {
 			// invalid user, let's fallback
 			err = newError("not a valid user")
-			log.Record(&log.AccessMessage{
+			log.RecordContext(ctx, &log.AccessMessage{
 				From:   conn.RemoteAddr(),
 				To:     "",
 				Status: log.AccessRejected,
@@ -163,12 +165,15 @@ func (s *Server) Process(ctx context.Context, network net.Network, conn internet
 	if isfb && shouldFallback {
 		return s.fallback(ctx, sid, err, sessionPolicy, conn, iConn, apfb, first, firstLen, bufferedReader)
 	} else if shouldFallback {
+		if inbound := session.InboundFromContext(ctx); inbound != nil {
+			inbound.AuthFailed = true
+		}
 		return newError("invalid protocol or invalid user")
 	}
 
 	clientReader := &ConnReader{Reader: bufferedReader}
 	if err := clientReader.ParseHeader(); err != nil {
-		log.Record(&log.AccessMessage{
+		log.RecordContext(ctx, &log.AccessMessage{
 			From:   conn.RemoteAddr(),
 			To:     "",
 			Status: log.AccessRejected,
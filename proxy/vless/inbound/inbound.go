@@ -25,6 +25,7 @@ import (
 	feature_inbound "v2ray.com/core/features/inbound"
 	"v2ray.com/core/features/policy"
 	"v2ray.com/core/features/routing"
+	"v2ray.com/core/proxy"
 	"v2ray.com/core/proxy/vless"
 	"v2ray.com/core/proxy/vless/encoding"
 	"v2ray.com/core/transport/internet"
@@ -42,6 +43,7 @@ func init() {
 		}
 		return New(ctx, config.(*Config), dc)
 	}))
+	common.Must(proxy.RegisterInboundConfig((*Config)(nil)))
 }
 
 // Handler is an inbound connection handler that handles messages in VLess protocol.
@@ -330,12 +332,15 @@ func (h *Handler) Process(ctx context.Context, network net.Network, connection i
 		}
 
 		if errors.Cause(err) != io.EOF {
-			log.Record(&log.AccessMessage{
+			log.RecordContext(ctx, &log.AccessMessage{
 				From:   connection.RemoteAddr(),
 				To:     "",
 				Status: log.AccessRejected,
 				Reason: err,
 			})
+			if inbound := session.InboundFromContext(ctx); inbound != nil {
+				inbound.AuthFailed = true
+			}
 			err = newError("invalid request from ", connection.RemoteAddr()).Base(err).AtInfo()
 		}
 		return err
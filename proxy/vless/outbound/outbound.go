@@ -11,6 +11,7 @@ import (
 	"v2ray.com/core"
 	"v2ray.com/core/common"
 	"v2ray.com/core/common/buf"
+	"v2ray.com/core/common/errors"
 	"v2ray.com/core/common/net"
 	"v2ray.com/core/common/protocol"
 	"v2ray.com/core/common/retry"
@@ -18,6 +19,7 @@ import (
 	"v2ray.com/core/common/signal"
 	"v2ray.com/core/common/task"
 	"v2ray.com/core/features/policy"
+	"v2ray.com/core/proxy"
 	"v2ray.com/core/proxy/vless"
 	"v2ray.com/core/proxy/vless/encoding"
 	"v2ray.com/core/transport"
@@ -28,6 +30,7 @@ func init() {
 	common.Must(common.RegisterConfig((*Config)(nil), func(ctx context.Context, config interface{}) (interface{}, error) {
 		return New(ctx, config.(*Config))
 	}))
+	common.Must(proxy.RegisterOutboundConfig((*Config)(nil)))
 }
 
 // Handler is an outbound connection handler for VLess protocol.
@@ -72,7 +75,7 @@ func (h *Handler) Process(ctx context.Context, link *transport.Link, dialer inte
 		}
 		return nil
 	}); err != nil {
-		return newError("failed to find an available destination").Base(err).AtWarning()
+		return newError("failed to find an available destination").Base(err).AtWarning().WithKind(errors.KindUnreachable)
 	}
 	defer conn.Close()
 
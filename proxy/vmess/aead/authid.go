@@ -10,6 +10,7 @@ import (
 	"hash/crc32"
 	"io"
 	"math"
+	"strconv"
 	"time"
 
 	"v2ray.com/core/common"
@@ -21,6 +22,17 @@ var (
 	ErrReplay   = errors.New("replayed request")
 )
 
+// ClockSkewError is returned when an auth ID belongs to a user, but its timestamp is out of the accepted
+// window, which most likely means the clock of the client is off.
+type ClockSkewError struct {
+	// Offset is the time of the client minus the time of the server, in seconds.
+	Offset int64
+}
+
+func (e *ClockSkewError) Error() string {
+	return "possible clock skew: client appears " + strconv.FormatInt(e.Offset, 10) + " seconds off"
+}
+
 func CreateAuthID(cmdKey []byte, time int64) [16]byte {
 	buf := bytes.NewBuffer(nil)
 	common.Must(binary.Write(buf, binary.BigEndian, time))
@@ -86,6 +98,11 @@ func NewAuthIDDecoderItem(key [16]byte, ticket interface{}) *AuthIDDecoderItem {
 	}
 }
 
+// SetReplayFilter replaces the filter of replayed auth IDs.
+func (a *AuthIDDecoderHolder) SetReplayFilter(filter *antireplay.ReplayFilter) {
+	a.filter = filter
+}
+
 func (a *AuthIDDecoderHolder) AddUser(key [16]byte, ticket interface{}) {
 	a.decoders[string(key[:])] = NewAuthIDDecoderItem(key, ticket)
 }
@@ -94,7 +111,10 @@ func (a *AuthIDDecoderHolder) RemoveUser(key [16]byte) {
 	delete(a.decoders, string(key[:]))
 }
 
+// Match returns the ticket of the user of the auth ID. If the auth ID belongs to no user in time, but to
+// one out of time, a ClockSkewError is returned.
 func (a *AuthIDDecoderHolder) Match(authID [16]byte) (interface{}, error) {
+	var skew *ClockSkewError
 	for _, v := range a.decoders {
 		t, z, _, d := v.dec.Decode(authID)
 		if z != crc32.ChecksumIEEE(d[:12]) {
@@ -105,7 +125,8 @@ func (a *AuthIDDecoderHolder) Match(authID [16]byte) (interface{}, error) {
 			continue
 		}
 
-		if math.Abs(math.Abs(float64(t))-float64(time.Now().Unix())) > 120 {
+		if now := time.Now().Unix(); math.Abs(math.Abs(float64(t))-float64(now)) > 120 {
+			skew = &ClockSkewError{Offset: t - now}
 			continue
 		}
 
@@ -115,5 +136,8 @@ func (a *AuthIDDecoderHolder) Match(authID [16]byte) (interface{}, error) {
 
 		return v.ticket, nil
 	}
+	if skew != nil {
+		return nil, skew
+	}
 	return nil, ErrNotFound
 }
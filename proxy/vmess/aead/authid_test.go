@@ -60,6 +60,25 @@ func TestCreateAuthIDAndDecode2(t *testing.T) {
 	assert.Nil(t, res2)
 }
 
+func TestCreateAuthIDAndDecodeSkewed(t *testing.T) {
+	key := KDF16([]byte("Demo Key for Auth ID Test"), "Demo Path for Auth ID Test")
+	authid := CreateAuthID(key, time.Now().Unix()-300)
+
+	AuthDecoder := NewAuthIDDecoderHolder()
+	var keyw [16]byte
+	copy(keyw[:], key)
+	AuthDecoder.AddUser(keyw, "Demo User")
+	res, err := AuthDecoder.Match(authid)
+	assert.Nil(t, res)
+	skew, ok := err.(*ClockSkewError)
+	if !ok {
+		t.Fatal("expect clock skew, but got ", err)
+	}
+	if skew.Offset > -299 || skew.Offset < -301 {
+		t.Error("unexpected offset: ", skew.Offset)
+	}
+}
+
 func TestCreateAuthIDAndDecodeMassive(t *testing.T) {
 	key := KDF16([]byte("Demo Key for Auth ID Test"), "Demo Path for Auth ID Test")
 	authid := CreateAuthID(key, time.Now().Unix())
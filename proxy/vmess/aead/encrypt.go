@@ -13,7 +13,12 @@ import (
 )
 
 func SealVMessAEADHeader(key [16]byte, data []byte) []byte {
-	generatedAuthID := CreateAuthID(key[:], time.Now().Unix())
+	return SealVMessAEADHeaderAt(key, data, time.Now().Unix())
+}
+
+// SealVMessAEADHeaderAt seals the header with an auth ID of the given Unix time.
+func SealVMessAEADHeaderAt(key [16]byte, data []byte, timestamp int64) []byte {
+	generatedAuthID := CreateAuthID(key[:], timestamp)
 
 	connectionNonce := make([]byte, 8)
 	if _, err := io.ReadFull(rand.Reader, connectionNonce); err != nil {
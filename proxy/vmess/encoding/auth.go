@@ -51,11 +51,22 @@ func (*FnvAuthenticator) Overhead() int {
 	return 4
 }
 
-// Seal implements AEAD.Seal().
+// Seal implements AEAD.Seal(). As other AEADs, it seals in place, with plaintext[:0] as dst.
 func (*FnvAuthenticator) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
-	dst = append(dst, 0, 0, 0, 0)
-	binary.BigEndian.PutUint32(dst, Authenticate(plaintext))
-	return append(dst, plaintext...)
+	hash := Authenticate(plaintext)
+	total := len(dst) + 4 + len(plaintext)
+	var ret []byte
+	if cap(dst) >= total {
+		ret = dst[:total]
+	} else {
+		ret = make([]byte, total)
+		copy(ret, dst)
+	}
+	out := ret[len(dst):]
+	// plaintext is moved before the hash is written over its head.
+	copy(out[4:], plaintext)
+	binary.BigEndian.PutUint32(out, hash)
+	return ret
 }
 
 // Open implements AEAD.Open().
@@ -25,3 +25,19 @@ func TestFnvAuth(t *testing.T) {
 		t.Error(r)
 	}
 }
+
+func TestFnvAuthInPlace(t *testing.T) {
+	fnvAuth := new(FnvAuthenticator)
+
+	expectedText := make([]byte, 256)
+	common.Must2(rand.Read(expectedText))
+
+	buffer := make([]byte, 512)
+	copy(buffer, expectedText)
+	b := fnvAuth.Seal(buffer[:0], nil, buffer[:256], nil)
+	b, err := fnvAuth.Open(b[:0], nil, b, nil)
+	common.Must(err)
+	if r := cmp.Diff(b, expectedText); r != "" {
+		t.Error(r)
+	}
+}
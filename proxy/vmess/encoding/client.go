@@ -12,6 +12,7 @@ import (
 	"hash"
 	"hash/fnv"
 	"io"
+	"time"
 
 	"golang.org/x/crypto/chacha20poly1305"
 
@@ -73,8 +74,8 @@ func NewClientSession(ctx context.Context, isAEAD bool, idHash protocol.IDHash)
 }
 
 func (c *ClientSession) EncodeRequestHeader(header *protocol.RequestHeader, writer io.Writer) error {
-	timestamp := protocol.NewTimestampGenerator(protocol.NowTime(), 30)()
 	account := header.User.Account.(*vmess.MemoryAccount)
+	timestamp := protocol.NewTimestampGenerator(protocol.NowTime()+protocol.Timestamp(account.TimeOffset), 30)()
 	if !c.isAEAD {
 		idHash := c.idHash(account.AnyValidID().Bytes())
 		common.Must2(serial.WriteUint64(idHash, uint64(timestamp)))
@@ -119,7 +120,7 @@ func (c *ClientSession) EncodeRequestHeader(header *protocol.RequestHeader, writ
 	} else {
 		var fixedLengthCmdKey [16]byte
 		copy(fixedLengthCmdKey[:], account.ID.CmdKey())
-		vmessout := vmessaead.SealVMessAEADHeader(fixedLengthCmdKey, buffer.Bytes())
+		vmessout := vmessaead.SealVMessAEADHeaderAt(fixedLengthCmdKey, buffer.Bytes(), time.Now().Unix()+account.TimeOffset)
 		common.Must2(io.Copy(writer, bytes.NewReader(vmessout)))
 	}
 
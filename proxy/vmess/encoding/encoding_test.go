@@ -8,6 +8,7 @@ import (
 
 	"v2ray.com/core/common"
 	"v2ray.com/core/common/buf"
+	"v2ray.com/core/common/errors"
 	"v2ray.com/core/common/net"
 	"v2ray.com/core/common/protocol"
 	"v2ray.com/core/common/uuid"
@@ -155,3 +156,51 @@ func TestMuxRequest(t *testing.T) {
 		t.Error(r)
 	}
 }
+
+func TestLegacyRequestRejected(t *testing.T) {
+	user := &protocol.MemoryUser{
+		Level: 0,
+		Email: "test@v2ray.com",
+	}
+	id := uuid.New()
+	account := &vmess.Account{
+		Id:      id.String(),
+		AlterId: 0,
+	}
+	user.Account = toAccount(account)
+
+	request := &protocol.RequestHeader{
+		Version:  1,
+		User:     user,
+		Command:  protocol.RequestCommandTCP,
+		Address:  net.DomainAddress("www.v2ray.com"),
+		Port:     net.Port(443),
+		Security: protocol.SecurityType_AES128_GCM,
+	}
+
+	sessionHistory := NewSessionHistory()
+	defer common.Close(sessionHistory)
+
+	userValidator := vmess.NewTimedUserValidator(protocol.DefaultIDHash)
+	userValidator.DisableLegacy()
+	userValidator.Add(user)
+	defer common.Close(userValidator)
+
+	legacy := buf.New()
+	common.Must(NewClientSession(context.TODO(), false, protocol.DefaultIDHash).EncodeRequestHeader(request, legacy))
+
+	server := NewServerSession(userValidator, sessionHistory)
+	server.SetAEADForced(true)
+	if _, err := server.DecodeRequestHeader(legacy); errors.Cause(err) != ErrLegacyRejected {
+		t.Error("expected legacy request to be rejected, but got ", err)
+	}
+
+	aead := buf.New()
+	common.Must(NewClientSession(context.TODO(), true, protocol.DefaultIDHash).EncodeRequestHeader(request, aead))
+
+	server = NewServerSession(userValidator, sessionHistory)
+	server.SetAEADForced(true)
+	if _, err := server.DecodeRequestHeader(aead); err != nil {
+		t.Error("AEAD request rejected: ", err)
+	}
+}
@@ -109,6 +109,10 @@ type ServerSession struct {
 	isAEADForced bool
 }
 
+// ErrLegacyRejected is returned by DecodeRequestHeader when a legacy (non-AEAD) request header is
+// received, while only AEAD headers are accepted.
+var ErrLegacyRejected = newError("legacy request header rejected")
+
 // NewServerSession creates a new ServerSession, using the given UserValidator.
 // The ServerSession instance doesn't take ownership of the validator.
 func NewServerSession(validator *vmess.TimedUserValidator, sessionHistory *SessionHistory) *ServerSession {
@@ -118,6 +122,11 @@ func NewServerSession(validator *vmess.TimedUserValidator, sessionHistory *Sessi
 	}
 }
 
+// SetAEADForced sets whether legacy (non-AEAD) request headers are rejected without looking them up.
+func (s *ServerSession) SetAEADForced(forced bool) {
+	s.isAEADForced = forced
+}
+
 func parseSecurityType(b byte) protocol.SecurityType {
 	if _, f := protocol.SecurityType_name[int32(b)]; f {
 		st := protocol.SecurityType(b)
@@ -188,6 +197,11 @@ func (s *ServerSession) DecodeRequestHeader(reader io.Reader) (*protocol.Request
 	case !s.isAEADForced && errorAEAD == vmessaead.ErrNotFound:
 		userLegacy, timestamp, valid, userValidationError := s.userValidator.Get(buffer.Bytes())
 		if !valid || userValidationError != nil {
+			if userValidationError == vmess.ErrNotFound {
+				if offset, found := s.userValidator.LegacyClockSkew(buffer.Bytes()); found {
+					userValidationError = &vmessaead.ClockSkewError{Offset: offset}
+				}
+			}
 			return nil, drainConnection(newError("invalid user").Base(userValidationError))
 		}
 		user = userLegacy
@@ -197,6 +211,9 @@ func (s *ServerSession) DecodeRequestHeader(reader io.Reader) (*protocol.Request
 		aesStream := crypto.NewAesDecryptionStream(vmessAccount.ID.CmdKey(), iv)
 		decryptor = crypto.NewCryptionReader(aesStream, reader)
 
+	case errorAEAD == vmessaead.ErrNotFound:
+		return nil, drainConnection(ErrLegacyRejected)
+
 	default:
 		return nil, drainConnection(newError("invalid user").Base(errorAEAD))
 	}
@@ -25,9 +25,13 @@ import (
 	feature_inbound "v2ray.com/core/features/inbound"
 	"v2ray.com/core/features/policy"
 	"v2ray.com/core/features/routing"
+	"v2ray.com/core/features/stats"
+	"v2ray.com/core/proxy"
 	"v2ray.com/core/proxy/vmess"
+	vmessaead "v2ray.com/core/proxy/vmess/aead"
 	"v2ray.com/core/proxy/vmess/encoding"
 	"v2ray.com/core/transport/internet"
+	"v2ray.com/core/transport/internet/udp"
 )
 
 type userByEmail struct {
@@ -109,6 +113,8 @@ type Handler struct {
 	detours               *DetourConfig
 	sessionHistory        *encoding.SessionHistory
 	secure                bool
+	legacyDisabled        bool
+	statsManager          stats.Manager
 }
 
 // New creates a new VMess inbound handler.
@@ -122,6 +128,14 @@ func New(ctx context.Context, config *Config) (*Handler, error) {
 		usersByEmail:          newUserByEmail(config.GetDefaultValue()),
 		sessionHistory:        encoding.NewSessionHistory(),
 		secure:                config.SecureEncryptionOnly,
+		legacyDisabled:        config.DisableLegacyHeader,
+		statsManager:          v.GetFeature(stats.ManagerType()).(stats.Manager),
+	}
+	if handler.legacyDisabled {
+		handler.clients.DisableLegacy()
+	}
+	if config.ReplayFilterCapacity > 0 {
+		handler.clients.SetReplayFilterCapacity(config.ReplayFilterCapacity)
 	}
 
 	for _, user := range config.User {
@@ -177,21 +191,28 @@ func (h *Handler) RemoveUser(ctx context.Context, email string) error {
 	return nil
 }
 
-func transferResponse(timer signal.ActivityUpdater, session *encoding.ServerSession, request *protocol.RequestHeader, response *protocol.ResponseHeader, input buf.Reader, output *buf.BufferedWriter) error {
+// transferResponse writes the response of a session to output. If the session fails before any response with
+// a failure recorded in failure, the response header tells the client so, and there is no body.
+func transferResponse(timer signal.ActivityUpdater, session *encoding.ServerSession, request *protocol.RequestHeader, response *protocol.ResponseHeader, input buf.Reader, output *buf.BufferedWriter, failure *udp.FailureRecorder) error {
+	// Optimize for small response packet
+	data, err := input.ReadMultiBuffer()
+	if err != nil {
+		if cause := failure.Failure(); cause != nil {
+			response.Option.Set(protocol.ResponseOptionFailure)
+			session.EncodeResponseHeader(response, output)
+			if err := output.SetBuffered(false); err != nil {
+				return err
+			}
+			return newError("session to ", request.Destination(), " failed").Base(cause)
+		}
+		return err
+	}
+
 	session.EncodeResponseHeader(response, output)
 
 	bodyWriter := session.EncodeResponseBody(request, output)
-
-	{
-		// Optimize for small response packet
-		data, err := input.ReadMultiBuffer()
-		if err != nil {
-			return err
-		}
-
-		if err := bodyWriter.WriteMultiBuffer(data); err != nil {
-			return err
-		}
+	if err := bodyWriter.WriteMultiBuffer(data); err != nil {
+		return err
 	}
 
 	if err := output.SetBuffered(false); err != nil {
@@ -215,6 +236,17 @@ func isInsecureEncryption(s protocol.SecurityType) bool {
 	return s == protocol.SecurityType_NONE || s == protocol.SecurityType_LEGACY || s == protocol.SecurityType_UNKNOWN
 }
 
+// countRejected counts a rejected request in the stats of the inbound, under the given name.
+func (h *Handler) countRejected(ctx context.Context, name string) {
+	inbound := session.InboundFromContext(ctx)
+	if inbound == nil || len(inbound.Tag) == 0 {
+		return
+	}
+	if c, _ := stats.GetOrRegisterCounter(h.statsManager, "inbound>>>"+inbound.Tag+">>>"+name); c != nil {
+		c.Add(1)
+	}
+}
+
 // Process implements proxy.Inbound.Process().
 func (h *Handler) Process(ctx context.Context, network net.Network, connection internet.Connection, dispatcher routing.Dispatcher) error {
 	sessionPolicy := h.policyManager.ForLevel(0)
@@ -224,29 +256,48 @@ func (h *Handler) Process(ctx context.Context, network net.Network, connection i
 
 	reader := &buf.BufferedReader{Reader: buf.NewReader(connection)}
 	svrSession := encoding.NewServerSession(h.clients, h.sessionHistory)
+	svrSession.SetAEADForced(h.legacyDisabled)
 	request, err := svrSession.DecodeRequestHeader(reader)
 	if err != nil {
+		switch cause := errors.Cause(err).(type) {
+		case *vmessaead.ClockSkewError:
+			newError("possible clock skew: client ", connection.RemoteAddr(), " appears ", cause.Offset, " seconds off").AtWarning().WriteToLog(session.ExportIDToError(ctx))
+			h.countRejected(ctx, "vmess>>>clockskew")
+		default:
+			switch cause {
+			case encoding.ErrLegacyRejected:
+				h.countRejected(ctx, "vmess>>>rejected")
+			case vmessaead.ErrReplay:
+				h.countRejected(ctx, "replay>>>rejected")
+			}
+		}
 		if errors.Cause(err) != io.EOF {
-			log.Record(&log.AccessMessage{
-				From:   connection.RemoteAddr(),
-				To:     "",
-				Status: log.AccessRejected,
-				Reason: err,
+			log.RecordContext(ctx, &log.AccessMessage{
+				From:      connection.RemoteAddr(),
+				To:        "",
+				Status:    log.AccessRejected,
+				Reason:    err,
+				SessionID: uint32(session.IDFromContext(ctx)),
 			})
-			err = newError("invalid request from ", connection.RemoteAddr()).Base(err).AtInfo()
+			if inbound := session.InboundFromContext(ctx); inbound != nil {
+				inbound.AuthFailed = true
+			}
+			err = newError("invalid request from ", connection.RemoteAddr()).Base(err).AtInfo().WithKind(errors.KindAuth)
 		}
 		return err
 	}
 
 	if h.secure && isInsecureEncryption(request.Security) {
-		log.Record(&log.AccessMessage{
-			From:   connection.RemoteAddr(),
-			To:     "",
-			Status: log.AccessRejected,
-			Reason: "Insecure encryption",
-			Email:  request.User.Email,
+		log.RecordContext(ctx, &log.AccessMessage{
+			From:      connection.RemoteAddr(),
+			To:        "",
+			Status:    log.AccessRejected,
+			Reason:    "Insecure encryption",
+			Email:     request.User.Email,
+			SessionID: uint32(session.IDFromContext(ctx)),
 		})
-		return newError("client is using insecure encryption: ", request.Security)
+		h.countRejected(ctx, "vmess>>>rejected")
+		return newError("client ", connection.RemoteAddr(), " is using insecure encryption: ", request.Security).AtInfo()
 	}
 
 	if request.Command != protocol.RequestCommandMux {
@@ -277,6 +328,12 @@ func (h *Handler) Process(ctx context.Context, network net.Network, connection i
 	timer := signal.CancelAfterInactivity(ctx, cancel, sessionPolicy.Timeouts.ConnectionIdle)
 
 	ctx = policy.ContextWithBufferPolicy(ctx, sessionPolicy.Buffer)
+	var failure *udp.FailureRecorder
+	if request.Command == protocol.RequestCommandUDP {
+		// Failures of UDP sessions, e.g. unreachable destinations, are passed on to the client.
+		failure = new(udp.FailureRecorder)
+		ctx = udp.ContextWithFailureRecorder(ctx, failure)
+	}
 	link, err := dispatcher.Dispatch(ctx, request.Destination())
 	if err != nil {
 		return newError("failed to dispatch request to ", request.Destination()).Base(err)
@@ -301,7 +358,7 @@ func (h *Handler) Process(ctx context.Context, network net.Network, connection i
 		response := &protocol.ResponseHeader{
 			Command: h.generateCommand(ctx, request),
 		}
-		return transferResponse(timer, svrSession, request, response, link.Reader, writer)
+		return transferResponse(timer, svrSession, request, response, link.Reader, writer, failure)
 	}
 
 	var requestDonePost = task.OnSuccess(requestDone, task.Close(link.Writer))
@@ -354,4 +411,5 @@ func init() {
 	common.Must(common.RegisterConfig((*Config)(nil), func(ctx context.Context, config interface{}) (interface{}, error) {
 		return New(ctx, config.(*Config))
 	}))
+	common.Must(proxy.RegisterInboundConfig((*Config)(nil)))
 }
@@ -11,6 +11,7 @@ import (
 	"v2ray.com/core"
 	"v2ray.com/core/common"
 	"v2ray.com/core/common/buf"
+	"v2ray.com/core/common/errors"
 	"v2ray.com/core/common/net"
 	"v2ray.com/core/common/platform"
 	"v2ray.com/core/common/protocol"
@@ -19,10 +20,18 @@ import (
 	"v2ray.com/core/common/signal"
 	"v2ray.com/core/common/task"
 	"v2ray.com/core/features/policy"
+	"v2ray.com/core/features/stats"
+	"v2ray.com/core/proxy"
 	"v2ray.com/core/proxy/vmess"
 	"v2ray.com/core/proxy/vmess/encoding"
 	"v2ray.com/core/transport"
 	"v2ray.com/core/transport/internet"
+	"v2ray.com/core/transport/internet/udp"
+)
+
+const (
+	defaultMaxFailures = 3
+	defaultCooldown    = 60 * time.Second
 )
 
 // Handler is an outbound connection handler for VMess protocol.
@@ -30,29 +39,84 @@ type Handler struct {
 	serverList    *protocol.ServerList
 	serverPicker  protocol.ServerPicker
 	policyManager policy.Manager
+	statsManager  stats.Manager
+	tag           string
+	forceAEAD     bool
 }
 
 // New creates a new VMess outbound handler.
 func New(ctx context.Context, config *Config) (*Handler, error) {
 	serverList := protocol.NewServerList()
+	var servers []*protocol.ServerSpec
 	for _, rec := range config.Receiver {
 		s, err := protocol.NewServerSpecFromPB(rec)
 		if err != nil {
 			return nil, newError("failed to parse server spec").Base(err)
 		}
 		serverList.AddServer(s)
+		servers = append(servers, s)
+	}
+
+	var serverPicker protocol.ServerPicker
+	if config.RoundRobin {
+		serverPicker = protocol.NewRoundRobinServerPicker(serverList)
+	} else {
+		maxFailures := config.MaxFailures
+		if maxFailures == 0 {
+			maxFailures = defaultMaxFailures
+		}
+		cooldown := defaultCooldown
+		if config.Cooldown > 0 {
+			cooldown = time.Duration(config.Cooldown) * time.Second
+		}
+		picker := protocol.NewWeightedServerPicker(serverList, maxFailures, cooldown)
+		for idx, weight := range config.Weight {
+			if idx < len(servers) {
+				picker.SetWeight(servers[idx], weight)
+			}
+		}
+		serverPicker = picker
 	}
 
 	v := core.MustFromContext(ctx)
 	handler := &Handler{
 		serverList:    serverList,
-		serverPicker:  protocol.NewRoundRobinServerPicker(serverList),
+		serverPicker:  serverPicker,
 		policyManager: v.GetFeature(policy.ManagerType()).(policy.Manager),
+		statsManager:  v.GetFeature(stats.ManagerType()).(stats.Manager),
+		tag:           session.HandlerTagFromContext(ctx),
+		forceAEAD:     config.ForceAead,
 	}
 
 	return handler, nil
 }
 
+func (h *Handler) reportServer(ctx context.Context, rec *protocol.ServerSpec, err error) {
+	result := "success"
+	if err != nil {
+		if ctx.Err() != nil {
+			// The session ended for other reasons. It is not the server's fault.
+			return
+		}
+		result = "failure"
+	}
+
+	if picker, ok := h.serverPicker.(protocol.FailoverServerPicker); ok {
+		if err != nil {
+			picker.ReportFailure(rec)
+		} else {
+			picker.ReportSuccess(rec)
+		}
+	}
+
+	if len(h.tag) > 0 {
+		name := "outbound>>>" + h.tag + ">>>server>>>" + rec.Destination().NetAddr() + ">>>" + result
+		if c, _ := stats.GetOrRegisterCounter(h.statsManager, name); c != nil {
+			c.Add(1)
+		}
+	}
+}
+
 // Process implements proxy.Outbound.Process().
 func (h *Handler) Process(ctx context.Context, link *transport.Link, dialer internet.Dialer) error {
 	var rec *protocol.ServerSpec
@@ -60,8 +124,12 @@ func (h *Handler) Process(ctx context.Context, link *transport.Link, dialer inte
 
 	err := retry.ExponentialBackoff(5, 200).On(func() error {
 		rec = h.serverPicker.PickServer()
+		if rec == nil {
+			return newError("no server available")
+		}
 		rawConn, err := dialer.Dial(ctx, rec.Destination())
 		if err != nil {
+			h.reportServer(ctx, rec, err)
 			return err
 		}
 		conn = rawConn
@@ -69,7 +137,7 @@ func (h *Handler) Process(ctx context.Context, link *transport.Link, dialer inte
 		return nil
 	})
 	if err != nil {
-		return newError("failed to find an available destination").Base(err).AtWarning()
+		return newError("failed to find an available destination").Base(err).AtWarning().WithKind(errors.KindUnreachable)
 	}
 	defer conn.Close()
 
@@ -114,7 +182,7 @@ func (h *Handler) Process(ctx context.Context, link *transport.Link, dialer inte
 	output := link.Writer
 
 	isAEAD := false
-	if !aeadDisabled && len(account.AlterIDs) == 0 {
+	if h.forceAEAD || (!aeadDisabled && len(account.AlterIDs) == 0) {
 		isAEAD = true
 	}
 
@@ -159,10 +227,18 @@ func (h *Handler) Process(ctx context.Context, link *transport.Link, dialer inte
 
 		reader := &buf.BufferedReader{Reader: buf.NewReader(conn)}
 		header, err := session.DecodeResponseHeader(reader)
+		h.reportServer(ctx, rec, err)
 		if err != nil {
 			return newError("failed to read header").Base(err)
 		}
 		h.handleCommand(rec.Destination(), header.Command)
+		if header.Option.Has(protocol.ResponseOptionFailure) {
+			// The server tells the failure of a UDP session, e.g. an unreachable destination. UDP sessions
+			// multiplexed by Mux.Cool don't carry it.
+			err := newError("session to ", request.Destination(), " failed on the server")
+			udp.ReportFailure(ctx, err)
+			return err
+		}
 
 		bodyReader := session.DecodeResponseBody(request, reader)
 
@@ -190,6 +266,7 @@ func init() {
 	common.Must(common.RegisterConfig((*Config)(nil), func(ctx context.Context, config interface{}) (interface{}, error) {
 		return New(ctx, config.(*Config))
 	}))
+	common.Must(proxy.RegisterOutboundConfig((*Config)(nil)))
 
 	const defaultFlagValue = "NOT_DEFINED_AT_ALL"
 
@@ -3,6 +3,7 @@
 package vmess
 
 import (
+	"bytes"
 	"crypto/hmac"
 	"crypto/sha256"
 	"hash/crc64"
@@ -12,6 +13,7 @@ import (
 	"time"
 
 	"v2ray.com/core/common"
+	"v2ray.com/core/common/antireplay"
 	"v2ray.com/core/common/dice"
 	"v2ray.com/core/common/protocol"
 	"v2ray.com/core/common/serial"
@@ -22,6 +24,11 @@ import (
 const (
 	updateInterval   = 10 * time.Second
 	cacheDurationSec = 120
+	// maxClockSkewSec is how far from now the time of legacy requests is looked for, when reporting clock skew.
+	maxClockSkewSec = 600
+	// maxSkewProbeHashes is how many hashes a clock skew probe computes at most, so that probes take little
+	// CPU however many users there are.
+	maxSkewProbeHashes = 1 << 14
 )
 
 type user struct {
@@ -31,6 +38,9 @@ type user struct {
 
 // TimedUserValidator is a user Validator based on time.
 type TimedUserValidator struct {
+	// lastSkewProbe is the second of the last LegacyClockSkew probe. It is accessed atomically.
+	lastSkewProbe int64
+
 	sync.RWMutex
 	users    []*user
 	userHash map[[16]byte]indexTimePair
@@ -41,6 +51,8 @@ type TimedUserValidator struct {
 	behaviorSeed  uint64
 	behaviorFused bool
 
+	legacyDisabled bool
+
 	aeadDecoderHolder *aead.AuthIDDecoderHolder
 }
 
@@ -72,6 +84,10 @@ func NewTimedUserValidator(hasher protocol.IDHash) *TimedUserValidator {
 }
 
 func (v *TimedUserValidator) generateNewHashes(nowSec protocol.Timestamp, user *user) {
+	if v.legacyDisabled {
+		return
+	}
+
 	var hashValue [16]byte
 	genEndSec := nowSec + cacheDurationSec
 	genHashForID := func(id *protocol.ID) {
@@ -154,6 +170,25 @@ func (v *TimedUserValidator) Add(u *protocol.MemoryUser) error {
 	return nil
 }
 
+// SetReplayFilterCapacity sets the number of AEAD auth IDs remembered to detect replayed requests.
+func (v *TimedUserValidator) SetReplayFilterCapacity(capacity uint32) {
+	v.Lock()
+	defer v.Unlock()
+
+	v.aeadDecoderHolder.SetReplayFilter(antireplay.NewReplayFilterWithCapacity(cacheDurationSec, capacity))
+}
+
+// DisableLegacy stops maintaining the hashes of legacy (non-AEAD) request headers, so that legacy
+// requests never validate and their per-second hashes are no longer computed. The table of the hashes
+// is released, which takes hundreds of entries per ID of each user.
+func (v *TimedUserValidator) DisableLegacy() {
+	v.Lock()
+	defer v.Unlock()
+
+	v.legacyDisabled = true
+	v.userHash = nil
+}
+
 func (v *TimedUserValidator) Get(userHash []byte) (*protocol.MemoryUser, protocol.Timestamp, bool, error) {
 	v.RLock()
 	defer v.RUnlock()
@@ -173,6 +208,50 @@ func (v *TimedUserValidator) Get(userHash []byte) (*protocol.MemoryUser, protoco
 	return nil, 0, false, ErrNotFound
 }
 
+// LegacyClockSkew looks for the user of a legacy user hash at times out of the accepted window, and
+// returns the offset of the matching time from now, in seconds. As the hashes are computed on demand, at
+// most one probe is made each second, and the others find nothing. A probe gives up after
+// maxSkewProbeHashes hashes, so skews of users beyond that are not found.
+func (v *TimedUserValidator) LegacyClockSkew(userHash []byte) (int64, bool) {
+	now := time.Now().Unix()
+	last := atomic.LoadInt64(&v.lastSkewProbe)
+	if last == now || !atomic.CompareAndSwapInt64(&v.lastSkewProbe, last, now) {
+		return 0, false
+	}
+
+	v.RLock()
+	defer v.RUnlock()
+
+	if v.legacyDisabled {
+		return 0, false
+	}
+
+	var hashValue [16]byte
+	budget := maxSkewProbeHashes
+	for _, u := range v.users {
+		account := u.user.Account.(*MemoryAccount)
+		ids := append([]*protocol.ID{account.ID}, account.AlterIDs...)
+		for _, id := range ids {
+			idHash := v.hasher(id.Bytes())
+			for delta := int64(cacheDurationSec + 1); delta <= maxClockSkewSec; delta++ {
+				for _, offset := range [2]int64{-delta, delta} {
+					if budget == 0 {
+						return 0, false
+					}
+					budget--
+					common.Must2(serial.WriteUint64(idHash, uint64(now+offset)))
+					idHash.Sum(hashValue[:0])
+					idHash.Reset()
+					if bytes.Equal(hashValue[:], userHash) {
+						return offset, true
+					}
+				}
+			}
+		}
+	}
+	return 0, false
+}
+
 func (v *TimedUserValidator) GetAEAD(userHash []byte) (*protocol.MemoryUser, bool, error) {
 	v.RLock()
 	defer v.RUnlock()
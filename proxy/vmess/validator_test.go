@@ -1,6 +1,7 @@
 package vmess_test
 
 import (
+	"runtime"
 	"testing"
 	"time"
 
@@ -89,6 +90,122 @@ func TestUserValidator(t *testing.T) {
 	}
 }
 
+func TestUserValidatorClockSkew(t *testing.T) {
+	hasher := protocol.DefaultIDHash
+	v := NewTimedUserValidator(hasher)
+	defer common.Close(v)
+
+	id := uuid.New()
+	common.Must(v.Add(&protocol.MemoryUser{
+		Email: "test",
+		Account: toAccount(&Account{
+			Id:      id.String(),
+			AlterId: 4,
+		}),
+	}))
+
+	// Wait for a new second, so that the probe is not rate limited and ends within it.
+	time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+	ts := protocol.Timestamp(time.Now().Unix() - 300)
+	idHash := hasher(id.Bytes())
+	common.Must2(serial.WriteUint64(idHash, uint64(ts)))
+	userHash := idHash.Sum(nil)
+
+	if _, _, found, _ := v.Get(userHash); found {
+		t.Fatal("unexpected user")
+	}
+	offset, found := v.LegacyClockSkew(userHash)
+	if !found {
+		t.Fatal("clock skew not found")
+	}
+	if offset != -300 {
+		t.Error("unexpected offset: ", offset)
+	}
+	if _, found := v.LegacyClockSkew(userHash); found {
+		t.Error("probe is not rate limited")
+	}
+}
+
+func TestUserValidatorClockSkewBounded(t *testing.T) {
+	hasher := protocol.DefaultIDHash
+	v := NewTimedUserValidator(hasher)
+	defer common.Close(v)
+
+	var id uuid.UUID
+	for i := 0; i < 20; i++ {
+		id = uuid.New()
+		common.Must(v.Add(&protocol.MemoryUser{
+			Email: "test" + serial.ToString(i),
+			Account: toAccount(&Account{
+				Id: id.String(),
+			}),
+		}))
+	}
+
+	// The skew of the last user is beyond what a probe computes.
+	time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+	idHash := hasher(id.Bytes())
+	common.Must2(serial.WriteUint64(idHash, uint64(time.Now().Unix()-300)))
+	if _, found := v.LegacyClockSkew(idHash.Sum(nil)); found {
+		t.Error("probe is not bounded")
+	}
+}
+
+func TestUserValidatorLegacyDisabledMemory(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode")
+	}
+
+	const users = 5000
+	ids := make([]uuid.UUID, users)
+	for i := range ids {
+		ids[i] = uuid.New()
+	}
+
+	heapOf := func(disableLegacy bool) uint64 {
+		var before, after runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+
+		v := NewTimedUserValidator(protocol.DefaultIDHash)
+		defer common.Close(v)
+		if disableLegacy {
+			v.DisableLegacy()
+		}
+		for i := range ids {
+			common.Must(v.Add(&protocol.MemoryUser{
+				Email: "test",
+				Account: toAccount(&Account{
+					Id: ids[i].String(),
+				}),
+			}))
+		}
+
+		runtime.GC()
+		runtime.ReadMemStats(&after)
+		runtime.KeepAlive(v)
+
+		if disableLegacy {
+			idHash := protocol.DefaultIDHash(ids[0].Bytes())
+			common.Must2(serial.WriteUint64(idHash, uint64(time.Now().Unix())))
+			if _, _, found, _ := v.Get(idHash.Sum(nil)); found {
+				t.Error("legacy user hash is valid with legacy disabled")
+			}
+		}
+		if after.HeapAlloc < before.HeapAlloc {
+			return 0
+		}
+		return after.HeapAlloc - before.HeapAlloc
+	}
+
+	aeadOnly := heapOf(true)
+	legacy := heapOf(false)
+	t.Logf("heap of %d users: %d KiB with legacy headers, %d KiB without, %d KiB saved", users, legacy/1024, aeadOnly/1024, (legacy-aeadOnly)/1024)
+	if aeadOnly*2 > legacy {
+		t.Error("disabling legacy headers saves too little memory")
+	}
+}
+
 func BenchmarkUserValidator(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		hasher := protocol.DefaultIDHash
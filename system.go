@@ -0,0 +1,120 @@
+// +build !confonly
+
+package core
+
+import (
+	"context"
+	"runtime/debug"
+	"sync"
+
+	"v2ray.com/core/common/buf"
+	"v2ray.com/core/common/bytespool"
+	"v2ray.com/core/common/errors"
+	"v2ray.com/core/features/policy"
+	"v2ray.com/core/transport/internet"
+	"v2ray.com/core/transport/internet/udp"
+)
+
+var (
+	// defaultGCPercent is the GC percent that GOGC sets.
+	defaultGCPercent = gcPercent()
+
+	// gcAccess guards gcConfigured, which is whether the GC percent of the process is set by a config.
+	gcAccess     sync.Mutex
+	gcConfigured bool
+)
+
+// applySystemConfig returns the context of an instance with the settings of the instance in config, and
+// applies the settings of the process, except GC, which applies when the instance starts. The buffer pool
+// size is reset to its default if config doesn't set it.
+func applySystemConfig(ctx context.Context, config *SystemConfig) (context.Context, error) {
+	if b := config.GetBuffer(); b != nil {
+		if b.Connection < -1 {
+			return nil, newError("invalid buffer size: ", b.Connection).WithKind(errors.KindConfig)
+		}
+		ctx = policy.ContextWithDefaultBufferSize(ctx, b.Connection)
+	}
+	if n := config.GetUdpWorkerGoroutines(); n > 0 {
+		ctx = udp.ContextWithMaxHubSessions(ctx, n)
+	}
+	if mode := config.GetReadv(); mode != SystemConfig_AsIs {
+		ctx = internet.ContextWithReadv(ctx, readvEnabled(mode))
+	}
+
+	if size := config.GetBufferPoolSize(); size < 0 {
+		return nil, newError("invalid buffer pool size: ", size).WithKind(errors.KindConfig)
+	}
+	bytespool.SetMaxPoolSize(bufferPoolSize(config.GetBufferPoolSize()))
+	return ctx, nil
+}
+
+// readvEnabled returns whether readv is enabled in the mode.
+func readvEnabled(mode SystemConfig_ReadvMode) bool {
+	switch mode {
+	case SystemConfig_Auto:
+		return buf.ReadvPreferred()
+	case SystemConfig_Enable:
+		return true
+	case SystemConfig_Disable:
+		return false
+	default:
+		return buf.ReadvEnabled()
+	}
+}
+
+// bufferPoolSize returns the size of the largest pool in effect with the size of a config.
+func bufferPoolSize(size int32) int32 {
+	if size == 0 {
+		return bytespool.DefaultMaxPoolSize()
+	}
+	return bytespool.RoundPoolSize(size)
+}
+
+// applyGCConfig applies the GC settings of the process, when the instance starts. If config doesn't set
+// them, GC is reset to the default only if another config has set it, so as to keep the setting of programs
+// that embed V2Ray.
+func applyGCConfig(config *SystemConfig) {
+	gcAccess.Lock()
+	defer gcAccess.Unlock()
+
+	if gc := config.GetGc(); gc != nil {
+		debug.SetGCPercent(int(gc.Percent))
+		gcConfigured = true
+	} else if gcConfigured {
+		debug.SetGCPercent(int(defaultGCPercent))
+		gcConfigured = false
+	}
+}
+
+// gcPercent returns the GC percent in effect.
+func gcPercent() int32 {
+	percent := debug.SetGCPercent(100)
+	debug.SetGCPercent(percent)
+	return int32(percent)
+}
+
+// EffectiveSystemConfig returns the settings that are in effect with the config, where unset fields are
+// taken from environment variables, or their defaults.
+func EffectiveSystemConfig(config *SystemConfig) *SystemConfig {
+	effective := &SystemConfig{
+		Buffer: &SystemConfig_Buffer{
+			Connection: policy.DefaultBufferSize(),
+		},
+		Readv: SystemConfig_Disable,
+		Gc: &SystemConfig_GC{
+			Percent: defaultGCPercent,
+		},
+		UdpWorkerGoroutines: config.GetUdpWorkerGoroutines(),
+		BufferPoolSize:      bufferPoolSize(config.GetBufferPoolSize()),
+	}
+	if b := config.GetBuffer(); b != nil {
+		effective.Buffer.Connection = b.Connection
+	}
+	if readvEnabled(config.GetReadv()) {
+		effective.Readv = SystemConfig_Enable
+	}
+	if gc := config.GetGc(); gc != nil {
+		effective.Gc.Percent = gc.Percent
+	}
+	return effective
+}
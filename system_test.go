@@ -0,0 +1,99 @@
+package core_test
+
+import (
+	"runtime/debug"
+	"testing"
+
+	. "v2ray.com/core"
+	"v2ray.com/core/app/dispatcher"
+	"v2ray.com/core/app/proxyman"
+	"v2ray.com/core/common"
+	"v2ray.com/core/common/buf"
+	"v2ray.com/core/common/bytespool"
+	"v2ray.com/core/common/serial"
+	"v2ray.com/core/features/policy"
+)
+
+func TestSystemConfig(t *testing.T) {
+	percent := debug.SetGCPercent(100)
+	debug.SetGCPercent(percent)
+	readv := buf.ReadvEnabled()
+
+	newServer := func(system *SystemConfig) *Instance {
+		server, err := New(&Config{
+			App: []*serial.TypedMessage{
+				serial.ToTypedMessage(&dispatcher.Config{}),
+				serial.ToTypedMessage(&proxyman.InboundConfig{}),
+				serial.ToTypedMessage(&proxyman.OutboundConfig{}),
+			},
+			System: system,
+		})
+		common.Must(err)
+		return server
+	}
+	bufferSize := func(server *Instance) int32 {
+		return server.GetFeature(policy.ManagerType()).(policy.Manager).ForLevel(0).Buffer.PerConnection
+	}
+
+	configured := newServer(&SystemConfig{
+		Buffer: &SystemConfig_Buffer{
+			Connection: 8 * 1024,
+		},
+		Readv: SystemConfig_Disable,
+		Gc: &SystemConfig_GC{
+			Percent: 42,
+		},
+		UdpWorkerGoroutines: 100,
+		BufferPoolSize:      10000,
+	})
+	if size := bufferSize(configured); size != 8*1024 {
+		t.Error("unexpected buffer size: ", size)
+	}
+	if buf.ReadvEnabled() != readv {
+		t.Error("readv of the process is changed")
+	}
+	if size := bytespool.MaxPoolSize(); size != 8192 {
+		t.Error("unexpected buffer pool size: ", size)
+	}
+	if bytespool.GetPool(32*1024) != nil {
+		t.Error("expected no pool larger than the buffer pool size")
+	}
+
+	// GC applies when the server starts.
+	common.Must(configured.Start())
+	defer configured.Close()
+	if p := debug.SetGCPercent(100); p != 42 {
+		t.Error("unexpected GC percent: ", p)
+	}
+
+	// Another instance without the settings doesn't inherit them, while the first one keeps its buffer size.
+	other := newServer(nil)
+	if size := bufferSize(other); size != policy.DefaultBufferSize() {
+		t.Error("unexpected buffer size of the other instance: ", size)
+	}
+	if size := bufferSize(configured); size != 8*1024 {
+		t.Error("unexpected buffer size after the other instance is created: ", size)
+	}
+	if size := bytespool.MaxPoolSize(); size != bytespool.DefaultMaxPoolSize() {
+		t.Error("buffer pool size is not reset: ", size)
+	}
+	common.Must(other.Start())
+	defer other.Close()
+	if p := debug.SetGCPercent(percent); p != percent {
+		t.Error("GC percent is not reset: ", p)
+	}
+
+	effective := EffectiveSystemConfig(&SystemConfig{Readv: SystemConfig_Enable, BufferPoolSize: 10000})
+	if effective.Buffer.Connection != policy.DefaultBufferSize() || effective.Readv != SystemConfig_Enable || effective.Gc.Percent != int32(percent) || effective.UdpWorkerGoroutines != 0 || effective.BufferPoolSize != 8192 {
+		t.Error("unexpected effective config: ", effective)
+	}
+
+	for _, system := range []*SystemConfig{
+		{Buffer: &SystemConfig_Buffer{Connection: -2}},
+		{BufferPoolSize: -1},
+	} {
+		if _, err := New(&Config{System: system}); err == nil {
+			t.Error("expected error for invalid config: ", system)
+		}
+	}
+}
@@ -4,6 +4,11 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -11,12 +16,16 @@ import (
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 	"v2ray.com/core"
 	"v2ray.com/core/app/commander"
 	"v2ray.com/core/app/policy"
 	"v2ray.com/core/app/proxyman"
 	"v2ray.com/core/app/proxyman/command"
 	"v2ray.com/core/app/router"
+	routercmd "v2ray.com/core/app/router/command"
 	"v2ray.com/core/app/stats"
 	statscmd "v2ray.com/core/app/stats/command"
 	"v2ray.com/core/common"
@@ -127,6 +136,319 @@ func TestCommanderRemoveHandler(t *testing.T) {
 	}
 }
 
+func TestCommanderHandlerJSONConfig(t *testing.T) {
+	tcpServer := tcp.Server{
+		MsgProcessor: xor,
+	}
+	dest, err := tcpServer.Start()
+	common.Must(err)
+	defer tcpServer.Close()
+
+	clientPort := tcp.PickPort()
+	cmdPort := tcp.PickPort()
+	clientConfig := &core.Config{
+		App: []*serial.TypedMessage{
+			serial.ToTypedMessage(&commander.Config{
+				Tag: "api",
+				Service: []*serial.TypedMessage{
+					serial.ToTypedMessage(&command.Config{}),
+				},
+			}),
+			serial.ToTypedMessage(&router.Config{
+				Rule: []*router.RoutingRule{
+					{
+						InboundTag: []string{"api"},
+						TargetTag: &router.RoutingRule_Tag{
+							Tag: "api",
+						},
+					},
+				},
+			}),
+		},
+		Inbound: []*core.InboundHandlerConfig{
+			{
+				Tag: "api",
+				ReceiverSettings: serial.ToTypedMessage(&proxyman.ReceiverConfig{
+					PortRange: net.SinglePortRange(cmdPort),
+					Listen:    net.NewIPOrDomain(net.LocalHostIP),
+				}),
+				ProxySettings: serial.ToTypedMessage(&dokodemo.Config{
+					Address:  net.NewIPOrDomain(dest.Address),
+					Port:     uint32(dest.Port),
+					Networks: []net.Network{net.Network_TCP},
+				}),
+			},
+		},
+		Outbound: []*core.OutboundHandlerConfig{
+			{
+				Tag:           "default-outbound",
+				ProxySettings: serial.ToTypedMessage(&freedom.Config{}),
+			},
+		},
+	}
+
+	servers, err := InitializeServerConfigs(clientConfig)
+	common.Must(err)
+	defer CloseAllServers(servers)
+
+	cmdConn, err := grpc.Dial(fmt.Sprintf("127.0.0.1:%d", cmdPort), grpc.WithInsecure(), grpc.WithBlock())
+	common.Must(err)
+	defer cmdConn.Close()
+
+	hsClient := command.NewHandlerServiceClient(cmdConn)
+	_, err = hsClient.AddInbound(context.Background(), &command.AddInboundRequest{
+		JsonConfig: fmt.Sprintf(`{
+			"tag": "d",
+			"listen": "127.0.0.1",
+			"port": %d,
+			"protocol": "dokodemo-door",
+			"settings": {"address": "%s", "port": %d, "network": "tcp"},
+			"sniffing": {"enabled": true, "destOverride": ["http", "tls"]},
+			"streamSettings": {"sockopt": {"tcpFastOpen": false}}
+		}`, clientPort, dest.Address, dest.Port),
+	})
+	common.Must(err)
+
+	_, err = hsClient.AddOutbound(context.Background(), &command.AddOutboundRequest{
+		JsonConfig: `{"tag": "blocked", "protocol": "blackhole"}`,
+	})
+	common.Must(err)
+
+	if err := testTCPConn(clientPort, 1024, time.Second*5)(); err != nil {
+		t.Fatal(err)
+	}
+
+	listResp, err := hsClient.ListHandlers(context.Background(), &command.ListHandlersRequest{})
+	common.Must(err)
+	if r := cmp.Diff(listResp.Inbound, []*command.HandlerInfo{
+		{Tag: "api", Protocol: "dokodemo", Port: uint32(cmdPort)},
+		{Tag: "d", Protocol: "dokodemo", Port: uint32(clientPort)},
+	}, cmpopts.SortSlices(func(a, b *command.HandlerInfo) bool { return a.Tag < b.Tag }), cmpopts.IgnoreUnexported(command.HandlerInfo{})); r != "" {
+		t.Error(r)
+	}
+	if r := cmp.Diff(listResp.Outbound, []*command.HandlerInfo{
+		{Tag: "api", Protocol: "commander"},
+		{Tag: "blocked", Protocol: "blackhole"},
+		{Tag: "default-outbound", Protocol: "freedom"},
+	}, cmpopts.SortSlices(func(a, b *command.HandlerInfo) bool { return a.Tag < b.Tag }), cmpopts.IgnoreUnexported(command.HandlerInfo{})); r != "" {
+		t.Error(r)
+	}
+
+	_, err = hsClient.RemoveInbound(context.Background(), &command.RemoveInboundRequest{
+		Tag: "d",
+	})
+	common.Must(err)
+
+	if _, err := net.DialTCP("tcp", nil, &net.TCPAddr{
+		IP:   []byte{127, 0, 0, 1},
+		Port: int(clientPort),
+	}); err == nil {
+		t.Error("unexpected nil error")
+	}
+
+	if _, err := hsClient.AddInbound(context.Background(), &command.AddInboundRequest{
+		JsonConfig: `{"protocol": "unknown"}`,
+	}); err == nil {
+		t.Error("expected error for invalid JSON config, but got nil")
+	}
+
+	if _, err := hsClient.AddOutbound(context.Background(), &command.AddOutboundRequest{
+		JsonConfig: `{"protocol": "blackhole"}], "include": ["/dev/null"], "outbounds": [{"protocol": "blackhole"}`,
+	}); err == nil {
+		t.Error("expected error for JSON config of more than one object, but got nil")
+	}
+}
+
+func TestCommanderSessionStats(t *testing.T) {
+	tcpServer := tcp.Server{
+		MsgProcessor: xor,
+	}
+	dest, err := tcpServer.Start()
+	common.Must(err)
+	defer tcpServer.Close()
+
+	clientPort := tcp.PickPort()
+	cmdPort := tcp.PickPort()
+	clientConfig := &core.Config{
+		App: []*serial.TypedMessage{
+			serial.ToTypedMessage(&commander.Config{
+				Tag: "api",
+				Service: []*serial.TypedMessage{
+					serial.ToTypedMessage(&command.Config{}),
+					serial.ToTypedMessage(&statscmd.Config{}),
+				},
+			}),
+			serial.ToTypedMessage(&router.Config{
+				Rule: []*router.RoutingRule{
+					{
+						InboundTag: []string{"api"},
+						TargetTag: &router.RoutingRule_Tag{
+							Tag: "api",
+						},
+					},
+				},
+			}),
+			serial.ToTypedMessage(&stats.Config{}),
+			serial.ToTypedMessage(&policy.Config{
+				System: &policy.SystemPolicy{
+					Stats: &policy.SystemPolicy_Stats{
+						InboundSessions: true,
+					},
+				},
+			}),
+		},
+		Inbound: []*core.InboundHandlerConfig{
+			{
+				Tag: "d",
+				ReceiverSettings: serial.ToTypedMessage(&proxyman.ReceiverConfig{
+					PortRange: net.SinglePortRange(clientPort),
+					Listen:    net.NewIPOrDomain(net.LocalHostIP),
+				}),
+				ProxySettings: serial.ToTypedMessage(&dokodemo.Config{
+					Address:  net.NewIPOrDomain(dest.Address),
+					Port:     uint32(dest.Port),
+					Networks: []net.Network{net.Network_TCP},
+				}),
+			},
+			{
+				Tag: "api",
+				ReceiverSettings: serial.ToTypedMessage(&proxyman.ReceiverConfig{
+					PortRange: net.SinglePortRange(cmdPort),
+					Listen:    net.NewIPOrDomain(net.LocalHostIP),
+				}),
+				ProxySettings: serial.ToTypedMessage(&dokodemo.Config{
+					Address:  net.NewIPOrDomain(dest.Address),
+					Port:     uint32(dest.Port),
+					Networks: []net.Network{net.Network_TCP},
+				}),
+			},
+		},
+		Outbound: []*core.OutboundHandlerConfig{
+			{
+				Tag:           "default-outbound",
+				ProxySettings: serial.ToTypedMessage(&freedom.Config{}),
+			},
+		},
+	}
+
+	servers, err := InitializeServerConfigs(clientConfig)
+	common.Must(err)
+	defer CloseAllServers(servers)
+
+	cmdConn, err := grpc.Dial(fmt.Sprintf("127.0.0.1:%d", cmdPort), grpc.WithInsecure(), grpc.WithBlock())
+	common.Must(err)
+	defer cmdConn.Close()
+	hsClient := command.NewHandlerServiceClient(cmdConn)
+
+	conn, err := net.DialTCP("tcp", nil, &net.TCPAddr{
+		IP:   []byte{127, 0, 0, 1},
+		Port: int(clientPort),
+	})
+	common.Must(err)
+	payload := []byte("session")
+	common.Must2(conn.Write(payload))
+	common.Must2(io.ReadFull(conn, make([]byte, len(payload))))
+
+	resp, err := hsClient.GetSessionStats(context.Background(), &command.GetSessionStatsRequest{
+		Tag:    "d",
+		Oldest: 5,
+	})
+	common.Must(err)
+	if len(resp.Inbound) != 1 {
+		t.Fatal("unexpected inbound stats: ", resp.Inbound)
+	}
+	if s := resp.Inbound[0]; s.LiveSessions != 1 || s.TotalSessions != 1 || s.Goroutines < 1 || len(s.OldestSessionAge) != 1 {
+		t.Error("unexpected inbound stats: ", s)
+	}
+
+	resp, err = hsClient.GetSessionStats(context.Background(), &command.GetSessionStatsRequest{})
+	common.Must(err)
+	for _, s := range resp.Outbound {
+		if s.Tag == "default-outbound" && (s.LiveSessions != 1 || s.TotalSessions != 1) {
+			t.Error("unexpected outbound stats: ", s)
+		}
+	}
+
+	conn.Close()
+	time.Sleep(time.Second)
+
+	resp, err = hsClient.GetSessionStats(context.Background(), &command.GetSessionStatsRequest{
+		Tag: "d",
+	})
+	common.Must(err)
+	if s := resp.Inbound[0]; s.LiveSessions != 0 || s.TotalSessions != 1 || s.Goroutines != 0 {
+		t.Error("unexpected inbound stats after the session ends: ", s)
+	}
+
+	sClient := statscmd.NewStatsServiceClient(cmdConn)
+	sresp, err := sClient.GetStats(context.Background(), &statscmd.GetStatsRequest{
+		Name: "inbound>>>d>>>sessions>>>total",
+	})
+	common.Must(err)
+	if sresp.Stat.Value != 1 {
+		t.Error("unexpected total sessions: ", sresp.Stat.Value)
+	}
+}
+
+func TestCommanderUnixSocketWithToken(t *testing.T) {
+	dir, err := ioutil.TempDir("", "v2ray-api")
+	common.Must(err)
+	defer os.RemoveAll(dir)
+	socketPath := filepath.Join(dir, "api.sock")
+
+	serverConfig := &core.Config{
+		App: []*serial.TypedMessage{
+			serial.ToTypedMessage(&commander.Config{
+				UnixSocket: socketPath,
+				Token:      "secret",
+				Service: []*serial.TypedMessage{
+					serial.ToTypedMessage(&command.Config{}),
+				},
+			}),
+		},
+		Outbound: []*core.OutboundHandlerConfig{
+			{
+				Tag:           "default-outbound",
+				ProxySettings: serial.ToTypedMessage(&freedom.Config{}),
+			},
+		},
+	}
+
+	servers, err := InitializeServerConfigs(serverConfig)
+	common.Must(err)
+	defer CloseAllServers(servers)
+
+	info, err := os.Stat(socketPath)
+	common.Must(err)
+	if info.Mode().Perm() != 0600 {
+		t.Error("unexpected socket permission: ", info.Mode().Perm())
+	}
+
+	cmdConn, err := grpc.Dial(socketPath, grpc.WithInsecure(), grpc.WithBlock(), grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "unix", addr)
+	}))
+	common.Must(err)
+	defer cmdConn.Close()
+
+	hsClient := command.NewHandlerServiceClient(cmdConn)
+	if _, err := hsClient.ListHandlers(context.Background(), &command.ListHandlersRequest{}); status.Code(err) != codes.Unauthenticated {
+		t.Error("expected unauthenticated error, but got ", err)
+	}
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer wrong")
+	if _, err := hsClient.ListHandlers(ctx, &command.ListHandlersRequest{}); status.Code(err) != codes.Unauthenticated {
+		t.Error("expected unauthenticated error, but got ", err)
+	}
+
+	ctx = metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer secret")
+	resp, err := hsClient.ListHandlers(ctx, &command.ListHandlersRequest{})
+	common.Must(err)
+	if len(resp.Outbound) != 1 || resp.Outbound[0].Tag != "default-outbound" {
+		t.Error("unexpected outbound handlers: ", resp.Outbound)
+	}
+}
+
 func TestCommanderAddRemoveUser(t *testing.T) {
 	tcpServer := tcp.Server{
 		MsgProcessor: xor,
@@ -495,3 +817,135 @@ func TestCommanderStats(t *testing.T) {
 		t.Error("value < 10240*1024: ", sresp.Stat.Value)
 	}
 }
+
+func TestCommanderFailoverBalancer(t *testing.T) {
+	tcpServer := tcp.Server{
+		MsgProcessor: xor,
+	}
+	dest, err := tcpServer.Start()
+	common.Must(err)
+	defer tcpServer.Close()
+
+	probeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer probeServer.Close()
+
+	clientPort := tcp.PickPort()
+	cmdPort := tcp.PickPort()
+	clientConfig := &core.Config{
+		App: []*serial.TypedMessage{
+			serial.ToTypedMessage(&commander.Config{
+				Tag: "api",
+				Service: []*serial.TypedMessage{
+					serial.ToTypedMessage(&routercmd.Config{}),
+				},
+			}),
+			serial.ToTypedMessage(&router.Config{
+				Rule: []*router.RoutingRule{
+					{
+						InboundTag: []string{"api"},
+						TargetTag: &router.RoutingRule_Tag{
+							Tag: "api",
+						},
+					},
+					{
+						InboundTag: []string{"d"},
+						TargetTag: &router.RoutingRule_BalancingTag{
+							BalancingTag: "failover",
+						},
+					},
+				},
+				BalancingRule: []*router.BalancingRule{
+					{
+						Tag:              "failover",
+						OutboundSelector: []string{"main", "backup"},
+						Strategy:         "failover",
+						Failover: &router.FailoverConfig{
+							ProbeUrl:      probeServer.URL,
+							ProbeInterval: 1,
+							FailThreshold: 1,
+						},
+					},
+				},
+			}),
+		},
+		Inbound: []*core.InboundHandlerConfig{
+			{
+				Tag: "d",
+				ReceiverSettings: serial.ToTypedMessage(&proxyman.ReceiverConfig{
+					PortRange: net.SinglePortRange(clientPort),
+					Listen:    net.NewIPOrDomain(net.LocalHostIP),
+				}),
+				ProxySettings: serial.ToTypedMessage(&dokodemo.Config{
+					Address:  net.NewIPOrDomain(dest.Address),
+					Port:     uint32(dest.Port),
+					Networks: []net.Network{net.Network_TCP},
+				}),
+			},
+			{
+				Tag: "api",
+				ReceiverSettings: serial.ToTypedMessage(&proxyman.ReceiverConfig{
+					PortRange: net.SinglePortRange(cmdPort),
+					Listen:    net.NewIPOrDomain(net.LocalHostIP),
+				}),
+				ProxySettings: serial.ToTypedMessage(&dokodemo.Config{
+					Address:  net.NewIPOrDomain(dest.Address),
+					Port:     uint32(dest.Port),
+					Networks: []net.Network{net.Network_TCP},
+				}),
+			},
+		},
+		Outbound: []*core.OutboundHandlerConfig{
+			{
+				// Nothing listens on the redirected port, so that the main outbound fails.
+				Tag: "main",
+				ProxySettings: serial.ToTypedMessage(&freedom.Config{
+					DestinationOverride: &freedom.DestinationOverride{
+						Server: &protocol.ServerEndpoint{
+							Address: net.NewIPOrDomain(net.LocalHostIP),
+							Port:    uint32(tcp.PickPort()),
+						},
+					},
+				}),
+			},
+			{
+				Tag:           "backup",
+				ProxySettings: serial.ToTypedMessage(&freedom.Config{}),
+			},
+		},
+	}
+
+	servers, err := InitializeServerConfigs(clientConfig)
+	common.Must(err)
+	defer CloseAllServers(servers)
+
+	cmdConn, err := grpc.Dial(fmt.Sprintf("127.0.0.1:%d", cmdPort), grpc.WithInsecure(), grpc.WithBlock())
+	common.Must(err)
+	defer cmdConn.Close()
+
+	client := routercmd.NewRoutingServiceClient(cmdConn)
+	var info *routercmd.GetBalancerInfoResponse
+	for i := 0; i < 10; i++ {
+		info, err = client.GetBalancerInfo(context.Background(), &routercmd.GetBalancerInfoRequest{Tag: "failover"})
+		common.Must(err)
+		if info.Active == "backup" {
+			break
+		}
+		time.Sleep(time.Second)
+	}
+	expected := &routercmd.GetBalancerInfoResponse{
+		Active: "backup",
+		Outbounds: []*routercmd.BalancerOutbound{
+			{Tag: "main", Healthy: false},
+			{Tag: "backup", Healthy: true},
+		},
+	}
+	if r := cmp.Diff(info, expected, cmpopts.IgnoreUnexported(routercmd.GetBalancerInfoResponse{}, routercmd.BalancerOutbound{})); r != "" {
+		t.Fatal(r)
+	}
+
+	if err := testTCPConn(clientPort, 1024, time.Second*5)(); err != nil {
+		t.Error(err)
+	}
+}
@@ -14,6 +14,8 @@ import (
 	"v2ray.com/core/common/protocol"
 	"v2ray.com/core/common/serial"
 	"v2ray.com/core/common/uuid"
+	"v2ray.com/core/proxy"
+	"v2ray.com/core/proxy/blackhole"
 	"v2ray.com/core/proxy/dokodemo"
 	"v2ray.com/core/proxy/freedom"
 	"v2ray.com/core/proxy/vmess"
@@ -206,3 +208,61 @@ func TestDokodemoUDP(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestDokodemoRoutingHint(t *testing.T) {
+	tcpServer := tcp.Server{
+		MsgProcessor: xor,
+	}
+	dest, err := tcpServer.Start()
+	common.Must(err)
+	defer tcpServer.Close()
+
+	serverPort := tcp.PickPort()
+	serverConfig := &core.Config{
+		Inbound: []*core.InboundHandlerConfig{
+			{
+				ReceiverSettings: serial.ToTypedMessage(&proxyman.ReceiverConfig{
+					PortRange: net.SinglePortRange(serverPort),
+					Listen:    net.NewIPOrDomain(net.LocalHostIP),
+				}),
+				ProxySettings: serial.ToTypedMessage(&dokodemo.Config{
+					Address:           net.NewIPOrDomain(dest.Address),
+					Port:              uint32(dest.Port),
+					Networks:          []net.Network{net.Network_TCP},
+					AcceptRoutingHint: true,
+				}),
+			},
+		},
+		Outbound: []*core.OutboundHandlerConfig{
+			{
+				ProxySettings: serial.ToTypedMessage(&blackhole.Config{}),
+			},
+			{
+				Tag:           "direct",
+				ProxySettings: serial.ToTypedMessage(&freedom.Config{}),
+			},
+		},
+	}
+
+	servers, err := InitializeServerConfigs(serverConfig)
+	common.Must(err)
+	defer CloseAllServers(servers)
+
+	hint, err := proxy.WriteRoutingHint("direct")
+	common.Must(err)
+	conn, err := net.DialTCP("tcp", nil, &net.TCPAddr{
+		IP:   []byte{127, 0, 0, 1},
+		Port: int(serverPort),
+	})
+	common.Must(err)
+	defer conn.Close()
+	common.Must2(conn.Write(hint))
+	if err := testTCPConn2(conn, 1024, time.Second*2)(); err != nil {
+		t.Error(err)
+	}
+
+	// Without a hint, the connection is routed to the default outbound.
+	if err := testTCPConn(serverPort, 1024, time.Second)(); err == nil {
+		t.Error("expected connection without routing hint to be blocked")
+	}
+}
@@ -26,6 +26,7 @@ import (
 	"v2ray.com/core/proxy/dokodemo"
 	"v2ray.com/core/proxy/freedom"
 	v2http "v2ray.com/core/proxy/http"
+	"v2ray.com/core/proxy/loopback"
 	"v2ray.com/core/proxy/socks"
 	"v2ray.com/core/proxy/vmess"
 	"v2ray.com/core/proxy/vmess/inbound"
@@ -92,6 +93,106 @@ func TestPassiveConnection(t *testing.T) {
 	}
 }
 
+func TestPortRangeInbound(t *testing.T) {
+	tcpServer := tcp.Server{
+		MsgProcessor: xor,
+	}
+	dest, err := tcpServer.Start()
+	common.Must(err)
+	defer tcpServer.Close()
+
+	serverPort := tcp.PickPort()
+	// A port in the middle of the range is taken. The others should still work.
+	occupied, err := net.ListenTCP("tcp", &net.TCPAddr{
+		IP:   []byte{127, 0, 0, 1},
+		Port: int(serverPort + 1),
+	})
+	common.Must(err)
+	defer occupied.Close()
+
+	serverConfig := &core.Config{
+		Inbound: []*core.InboundHandlerConfig{
+			{
+				ReceiverSettings: serial.ToTypedMessage(&proxyman.ReceiverConfig{
+					PortRange: &net.PortRange{From: uint32(serverPort), To: uint32(serverPort + 2)},
+					Listen:    net.NewIPOrDomain(net.LocalHostIP),
+				}),
+				ProxySettings: serial.ToTypedMessage(&dokodemo.Config{
+					Address: net.NewIPOrDomain(dest.Address),
+					Port:    uint32(dest.Port),
+					NetworkList: &net.NetworkList{
+						Network: []net.Network{net.Network_TCP},
+					},
+				}),
+			},
+		},
+		Outbound: []*core.OutboundHandlerConfig{
+			{
+				ProxySettings: serial.ToTypedMessage(&freedom.Config{}),
+			},
+		},
+	}
+
+	servers, err := InitializeServerConfigs(serverConfig)
+	common.Must(err)
+	defer CloseAllServers(servers)
+
+	for _, port := range []net.Port{serverPort, serverPort + 2} {
+		if err := testTCPConn(port, 1024, time.Second*5)(); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestDualStackInbound(t *testing.T) {
+	tcpServer := tcp.Server{
+		MsgProcessor: xor,
+	}
+	dest, err := tcpServer.Start()
+	common.Must(err)
+	defer tcpServer.Close()
+
+	serverPort := tcp.PickPort()
+	serverConfig := &core.Config{
+		Inbound: []*core.InboundHandlerConfig{
+			{
+				ReceiverSettings: serial.ToTypedMessage(&proxyman.ReceiverConfig{
+					PortRange: net.SinglePortRange(serverPort),
+					DualStack: &proxyman.DualStackConfig{},
+				}),
+				ProxySettings: serial.ToTypedMessage(&dokodemo.Config{
+					Address: net.NewIPOrDomain(dest.Address),
+					Port:    uint32(dest.Port),
+					NetworkList: &net.NetworkList{
+						Network: []net.Network{net.Network_TCP},
+					},
+				}),
+			},
+		},
+		Outbound: []*core.OutboundHandlerConfig{
+			{
+				ProxySettings: serial.ToTypedMessage(&freedom.Config{}),
+			},
+		},
+	}
+
+	servers, err := InitializeServerConfigs(serverConfig)
+	common.Must(err)
+	defer CloseAllServers(servers)
+
+	for _, ip := range []net.IP{net.LocalHostIP.IP(), net.LocalHostIPv6.IP()} {
+		conn, err := net.DialTCP("tcp", nil, &net.TCPAddr{
+			IP:   ip,
+			Port: int(serverPort),
+		})
+		common.Must(err)
+		if err := testTCPConn2(conn, 1024, time.Second*5)(); err != nil {
+			t.Error(err)
+		}
+		conn.Close()
+	}
+}
+
 func TestProxy(t *testing.T) {
 	tcpServer := tcp.Server{
 		MsgProcessor: xor,
@@ -446,6 +547,80 @@ func TestBlackhole(t *testing.T) {
 	}
 }
 
+func TestLoopback(t *testing.T) {
+	tcpServer := tcp.Server{
+		MsgProcessor: xor,
+	}
+	dest, err := tcpServer.Start()
+	common.Must(err)
+	defer tcpServer.Close()
+
+	createConfig := func(port net.Port, loopbackTag string) *core.Config {
+		return &core.Config{
+			Inbound: []*core.InboundHandlerConfig{
+				{
+					Tag: "in",
+					ReceiverSettings: serial.ToTypedMessage(&proxyman.ReceiverConfig{
+						PortRange: net.SinglePortRange(port),
+						Listen:    net.NewIPOrDomain(net.LocalHostIP),
+					}),
+					ProxySettings: serial.ToTypedMessage(&dokodemo.Config{
+						Address: net.NewIPOrDomain(dest.Address),
+						Port:    uint32(dest.Port),
+						NetworkList: &net.NetworkList{
+							Network: []net.Network{net.Network_TCP},
+						},
+					}),
+				},
+			},
+			Outbound: []*core.OutboundHandlerConfig{
+				{
+					Tag: "loop",
+					ProxySettings: serial.ToTypedMessage(&loopback.Config{
+						InboundTag: loopbackTag,
+						MaxDepth:   2,
+					}),
+				},
+				{
+					Tag:           "direct",
+					ProxySettings: serial.ToTypedMessage(&freedom.Config{}),
+				},
+			},
+			App: []*serial.TypedMessage{
+				serial.ToTypedMessage(&router.Config{
+					Rule: []*router.RoutingRule{
+						{
+							TargetTag: &router.RoutingRule_Tag{
+								Tag: "direct",
+							},
+							InboundTag: []string{"second-stage"},
+						},
+					},
+				}),
+			},
+		}
+	}
+
+	serverPort := tcp.PickPort()
+	servers, err := InitializeServerConfigs(createConfig(serverPort, "second-stage"))
+	common.Must(err)
+	defer CloseAllServers(servers)
+
+	if err := testTCPConn(serverPort, 1024, time.Second*5)(); err != nil {
+		t.Error(err)
+	}
+
+	// Connections looping back to their own inbound are dropped.
+	loopPort := tcp.PickPort()
+	loopServers, err := InitializeServerConfigs(createConfig(loopPort, "in"))
+	common.Must(err)
+	defer CloseAllServers(loopServers)
+
+	if err := testTCPConn(loopPort, 1024, time.Second*5)(); err == nil {
+		t.Error("nil error")
+	}
+}
+
 func TestForward(t *testing.T) {
 	tcpServer := tcp.Server{
 		MsgProcessor: xor,
@@ -1,6 +1,7 @@
 package scenarios
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"crypto/rand"
@@ -12,6 +13,8 @@ import (
 	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
 	"v2ray.com/core"
 	"v2ray.com/core/app/proxyman"
 	"v2ray.com/core/common"
@@ -22,6 +25,7 @@ import (
 	v2http "v2ray.com/core/proxy/http"
 	v2httptest "v2ray.com/core/testing/servers/http"
 	"v2ray.com/core/testing/servers/tcp"
+	"v2ray.com/core/testing/servers/udp"
 )
 
 func TestHttpConformance(t *testing.T) {
@@ -375,3 +379,237 @@ func TestHttpBasicAuth(t *testing.T) {
 		}
 	}
 }
+
+func TestHTTPConnectUDP(t *testing.T) {
+	udpServer := udp.Server{
+		MsgProcessor: xor,
+	}
+	dest, err := udpServer.Start()
+	common.Must(err)
+	defer udpServer.Close()
+
+	serverPort := tcp.PickPort()
+	disabledPort := tcp.PickPort()
+	serverConfig := &core.Config{
+		Inbound: []*core.InboundHandlerConfig{
+			{
+				ReceiverSettings: serial.ToTypedMessage(&proxyman.ReceiverConfig{
+					PortRange: net.SinglePortRange(serverPort),
+					Listen:    net.NewIPOrDomain(net.LocalHostIP),
+				}),
+				ProxySettings: serial.ToTypedMessage(&v2http.ServerConfig{
+					AllowConnectUdp: true,
+				}),
+			},
+			{
+				ReceiverSettings: serial.ToTypedMessage(&proxyman.ReceiverConfig{
+					PortRange: net.SinglePortRange(disabledPort),
+					Listen:    net.NewIPOrDomain(net.LocalHostIP),
+				}),
+				ProxySettings: serial.ToTypedMessage(&v2http.ServerConfig{}),
+			},
+		},
+		Outbound: []*core.OutboundHandlerConfig{
+			{
+				ProxySettings: serial.ToTypedMessage(&freedom.Config{}),
+			},
+		},
+	}
+
+	servers, err := InitializeServerConfigs(serverConfig)
+	common.Must(err)
+	defer CloseAllServers(servers)
+
+	connectUDP := func(port net.Port) (net.Conn, *bufio.Reader, *http.Response) {
+		conn, err := net.DialTCP("tcp", nil, &net.TCPAddr{
+			IP:   []byte{127, 0, 0, 1},
+			Port: int(port),
+		})
+		common.Must(err)
+		common.Must2(conn.Write([]byte("GET /.well-known/masque/udp/127.0.0.1/" + dest.Port.String() + "/ HTTP/1.1\r\n" +
+			"Host: 127.0.0.1:" + port.String() + "\r\n" +
+			"Connection: Upgrade\r\n" +
+			"Upgrade: connect-udp\r\n" +
+			"Capsule-Protocol: ?1\r\n\r\n")))
+		reader := bufio.NewReader(conn)
+		resp, err := http.ReadResponse(reader, nil)
+		common.Must(err)
+		return conn, reader, resp
+	}
+
+	{
+		conn, _, resp := connectUDP(disabledPort)
+		defer conn.Close()
+		if resp.StatusCode != http.StatusNotImplemented {
+			t.Error("status: ", resp.StatusCode)
+		}
+	}
+
+	conn, reader, resp := connectUDP(serverPort)
+	defer conn.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatal("status: ", resp.StatusCode)
+	}
+
+	for i := 0; i < 4; i++ {
+		payload := make([]byte, 32)
+		common.Must2(rand.Read(payload))
+
+		// DATAGRAM capsule, with the length of context ID 0 and the payload.
+		capsule := append([]byte{0x00, byte(len(payload) + 1), 0x00}, payload...)
+		common.Must2(conn.Write(capsule))
+
+		response := make([]byte, len(capsule))
+		common.Must(conn.SetReadDeadline(time.Now().Add(time.Second * 5)))
+		common.Must2(io.ReadFull(reader, response))
+		if r := cmp.Diff(response[:3], capsule[:3]); r != "" {
+			t.Fatal(r)
+		}
+		if r := cmp.Diff(response[3:], xor(payload)); r != "" {
+			t.Fatal(r)
+		}
+	}
+}
+
+func TestHTTPConnectUDPHTTP2(t *testing.T) {
+	udpServer := udp.Server{
+		MsgProcessor: xor,
+	}
+	dest, err := udpServer.Start()
+	common.Must(err)
+	defer udpServer.Close()
+
+	serverPort := tcp.PickPort()
+	serverConfig := &core.Config{
+		Inbound: []*core.InboundHandlerConfig{
+			{
+				ReceiverSettings: serial.ToTypedMessage(&proxyman.ReceiverConfig{
+					PortRange: net.SinglePortRange(serverPort),
+					Listen:    net.NewIPOrDomain(net.LocalHostIP),
+				}),
+				ProxySettings: serial.ToTypedMessage(&v2http.ServerConfig{
+					AllowConnectUdp: true,
+				}),
+			},
+		},
+		Outbound: []*core.OutboundHandlerConfig{
+			{
+				ProxySettings: serial.ToTypedMessage(&freedom.Config{}),
+			},
+		},
+	}
+
+	servers, err := InitializeServerConfigs(serverConfig)
+	common.Must(err)
+	defer CloseAllServers(servers)
+
+	conn, err := net.DialTCP("tcp", nil, &net.TCPAddr{
+		IP:   []byte{127, 0, 0, 1},
+		Port: int(serverPort),
+	})
+	common.Must(err)
+	defer conn.Close()
+	common.Must(conn.SetDeadline(time.Now().Add(time.Second * 10)))
+
+	common.Must2(conn.Write([]byte(http2.ClientPreface)))
+	framer := http2.NewFramer(conn, conn)
+	common.Must(framer.WriteSettings())
+
+	var headerBuf bytes.Buffer
+	encoder := hpack.NewEncoder(&headerBuf)
+	decoder := hpack.NewDecoder(4096, nil)
+	request := func(streamID uint32, method string, protocol string) {
+		headerBuf.Reset()
+		fields := []hpack.HeaderField{
+			{Name: ":method", Value: method},
+			{Name: ":scheme", Value: "http"},
+			{Name: ":authority", Value: "127.0.0.1:" + serverPort.String()},
+			{Name: ":path", Value: "/.well-known/masque/udp/127.0.0.1/" + dest.Port.String() + "/"},
+			{Name: "capsule-protocol", Value: "?1"},
+		}
+		if protocol != "" {
+			fields = append(fields, hpack.HeaderField{Name: ":protocol", Value: protocol})
+		}
+		for _, field := range fields {
+			common.Must(encoder.WriteField(field))
+		}
+		common.Must(framer.WriteHeaders(http2.HeadersFrameParam{
+			StreamID:      streamID,
+			BlockFragment: headerBuf.Bytes(),
+			EndHeaders:    true,
+		}))
+	}
+	// readStream returns the status of the response headers, or the data of the stream.
+	readStream := func(streamID uint32) (string, []byte) {
+		for {
+			frame, err := framer.ReadFrame()
+			common.Must(err)
+			if frame.Header().StreamID != streamID {
+				continue
+			}
+			switch f := frame.(type) {
+			case *http2.HeadersFrame:
+				fields, err := decoder.DecodeFull(f.HeaderBlockFragment())
+				common.Must(err)
+				for _, field := range fields {
+					if field.Name == ":status" {
+						return field.Value, nil
+					}
+				}
+			case *http2.DataFrame:
+				return "", append([]byte(nil), f.Data()...)
+			}
+		}
+	}
+
+	request(1, "GET", "")
+	if status, _ := readStream(1); status != "501" {
+		t.Error("status of GET: ", status)
+	}
+
+	request(3, "CONNECT", "connect-udp")
+	if status, _ := readStream(3); status != "200" {
+		t.Fatal("status of connect-udp: ", status)
+	}
+
+	for i := 0; i < 4; i++ {
+		payload := make([]byte, 32)
+		common.Must2(rand.Read(payload))
+
+		// DATAGRAM capsule, with the length of context ID 0 and the payload.
+		capsule := append([]byte{0x00, byte(len(payload) + 1), 0x00}, payload...)
+		common.Must(framer.WriteData(3, false, capsule))
+
+		var response []byte
+		for len(response) < len(capsule) {
+			_, data := readStream(3)
+			response = append(response, data...)
+		}
+		if r := cmp.Diff(response[:3], capsule[:3]); r != "" {
+			t.Fatal(r)
+		}
+		if r := cmp.Diff(response[3:], xor(payload)); r != "" {
+			t.Fatal(r)
+		}
+	}
+	// Header blocks beyond the limit close the connection.
+	common.Must(framer.WriteHeaders(http2.HeadersFrameParam{
+		StreamID:      5,
+		BlockFragment: make([]byte, 8192),
+	}))
+	for i := 0; i < 4; i++ {
+		common.Must(framer.WriteContinuation(5, false, make([]byte, 8192)))
+	}
+	for {
+		frame, err := framer.ReadFrame()
+		if err != nil {
+			t.Fatal("expected GOAWAY, but got ", err)
+		}
+		if goAway, ok := frame.(*http2.GoAwayFrame); ok {
+			if goAway.ErrCode != http2.ErrCodeEnhanceYourCalm {
+				t.Error("error code of GOAWAY: ", goAway.ErrCode)
+			}
+			break
+		}
+	}
+}
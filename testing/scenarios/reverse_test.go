@@ -1,6 +1,7 @@
 package scenarios
 
 import (
+	"os/exec"
 	"testing"
 	"time"
 
@@ -393,3 +394,573 @@ func TestReverseProxyLongRunning(t *testing.T) {
 		}
 	}
 }
+
+func TestReverseProxyMultiplePortals(t *testing.T) {
+	tcpServer := tcp.Server{
+		MsgProcessor: xor,
+	}
+	dest, err := tcpServer.Start()
+	common.Must(err)
+
+	defer tcpServer.Close()
+
+	userID := protocol.NewID(uuid.New())
+
+	portalConfig := func(domain string, externalPort, reversePort net.Port) *core.Config {
+		return &core.Config{
+			App: []*serial.TypedMessage{
+				serial.ToTypedMessage(&reverse.Config{
+					PortalConfig: []*reverse.PortalConfig{
+						{
+							Tag:    "portal",
+							Domain: domain,
+						},
+					},
+				}),
+				serial.ToTypedMessage(&router.Config{
+					Rule: []*router.RoutingRule{
+						{
+							Domain: []*router.Domain{
+								{Type: router.Domain_Full, Value: domain},
+							},
+							TargetTag: &router.RoutingRule_Tag{
+								Tag: "portal",
+							},
+						},
+						{
+							InboundTag: []string{"external"},
+							TargetTag: &router.RoutingRule_Tag{
+								Tag: "portal",
+							},
+						},
+					},
+				}),
+			},
+			Inbound: []*core.InboundHandlerConfig{
+				{
+					Tag: "external",
+					ReceiverSettings: serial.ToTypedMessage(&proxyman.ReceiverConfig{
+						PortRange: net.SinglePortRange(externalPort),
+						Listen:    net.NewIPOrDomain(net.LocalHostIP),
+					}),
+					ProxySettings: serial.ToTypedMessage(&dokodemo.Config{
+						Address: net.NewIPOrDomain(dest.Address),
+						Port:    uint32(dest.Port),
+						NetworkList: &net.NetworkList{
+							Network: []net.Network{net.Network_TCP},
+						},
+					}),
+				},
+				{
+					ReceiverSettings: serial.ToTypedMessage(&proxyman.ReceiverConfig{
+						PortRange: net.SinglePortRange(reversePort),
+						Listen:    net.NewIPOrDomain(net.LocalHostIP),
+					}),
+					ProxySettings: serial.ToTypedMessage(&inbound.Config{
+						User: []*protocol.User{
+							{
+								Account: serial.ToTypedMessage(&vmess.Account{
+									Id:      userID.String(),
+									AlterId: 64,
+								}),
+							},
+						},
+					}),
+				},
+			},
+			Outbound: []*core.OutboundHandlerConfig{
+				{
+					ProxySettings: serial.ToTypedMessage(&blackhole.Config{}),
+				},
+			},
+		}
+	}
+
+	portalOutbound := func(tag string, reversePort net.Port) *core.OutboundHandlerConfig {
+		return &core.OutboundHandlerConfig{
+			Tag: tag,
+			ProxySettings: serial.ToTypedMessage(&outbound.Config{
+				Receiver: []*protocol.ServerEndpoint{
+					{
+						Address: net.NewIPOrDomain(net.LocalHostIP),
+						Port:    uint32(reversePort),
+						User: []*protocol.User{
+							{
+								Account: serial.ToTypedMessage(&vmess.Account{
+									Id:      userID.String(),
+									AlterId: 64,
+									SecuritySettings: &protocol.SecurityConfig{
+										Type: protocol.SecurityType_AES128_GCM,
+									},
+								}),
+							},
+						},
+					},
+				},
+			}),
+		}
+	}
+
+	externalPortA := tcp.PickPort()
+	reversePortA := tcp.PickPort()
+	externalPortB := tcp.PickPort()
+	reversePortB := tcp.PickPort()
+
+	bridgeConfig := &core.Config{
+		App: []*serial.TypedMessage{
+			serial.ToTypedMessage(&reverse.Config{
+				BridgeConfig: []*reverse.BridgeConfig{
+					{
+						Tag:              "bridge",
+						Domains:          []string{"a.test.v2ray.com", "b.test.v2ray.com"},
+						HeartbeatTimeout: 3,
+					},
+				},
+			}),
+			serial.ToTypedMessage(&router.Config{
+				Rule: []*router.RoutingRule{
+					{
+						Domain: []*router.Domain{
+							{Type: router.Domain_Full, Value: "a.test.v2ray.com"},
+						},
+						TargetTag: &router.RoutingRule_Tag{
+							Tag: "portal-a",
+						},
+					},
+					{
+						Domain: []*router.Domain{
+							{Type: router.Domain_Full, Value: "b.test.v2ray.com"},
+						},
+						TargetTag: &router.RoutingRule_Tag{
+							Tag: "portal-b",
+						},
+					},
+					{
+						InboundTag: []string{"bridge"},
+						TargetTag: &router.RoutingRule_Tag{
+							Tag: "freedom",
+						},
+					},
+				},
+			}),
+		},
+		Outbound: []*core.OutboundHandlerConfig{
+			{
+				Tag:           "freedom",
+				ProxySettings: serial.ToTypedMessage(&freedom.Config{}),
+			},
+			portalOutbound("portal-a", reversePortA),
+			portalOutbound("portal-b", reversePortB),
+		},
+	}
+
+	portalA, err := InitializeServerConfig(portalConfig("a.test.v2ray.com", externalPortA, reversePortA))
+	common.Must(err)
+	defer CloseAllServers([]*exec.Cmd{portalA})
+
+	servers, err := InitializeServerConfigs(portalConfig("b.test.v2ray.com", externalPortB, reversePortB), bridgeConfig)
+	common.Must(err)
+	defer CloseAllServers(servers)
+
+	// Wait for the bridge to connect to both portals.
+	time.Sleep(time.Second * 3)
+
+	for _, port := range []net.Port{externalPortA, externalPortB} {
+		if err := testTCPConn(port, 1024, time.Second*10)(); err != nil {
+			t.Fatal("portal on port ", port, ": ", err)
+		}
+	}
+
+	CloseAllServers([]*exec.Cmd{portalA})
+	time.Sleep(time.Second * 5)
+
+	var errg errgroup.Group
+	for i := 0; i < 8; i++ {
+		errg.Go(testTCPConn(externalPortB, 10240, time.Second*10))
+	}
+	if err := errg.Wait(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReverseProxyBridgeAuthentication(t *testing.T) {
+	tcpServer := tcp.Server{
+		MsgProcessor: xor,
+	}
+	dest, err := tcpServer.Start()
+	common.Must(err)
+
+	defer tcpServer.Close()
+
+	userID := protocol.NewID(uuid.New())
+	externalPortA := tcp.PickPort()
+	externalPortB := tcp.PickPort()
+	reversePort := tcp.PickPort()
+
+	externalInbound := func(tag string, port net.Port) *core.InboundHandlerConfig {
+		return &core.InboundHandlerConfig{
+			Tag: tag,
+			ReceiverSettings: serial.ToTypedMessage(&proxyman.ReceiverConfig{
+				PortRange: net.SinglePortRange(port),
+				Listen:    net.NewIPOrDomain(net.LocalHostIP),
+			}),
+			ProxySettings: serial.ToTypedMessage(&dokodemo.Config{
+				Address: net.NewIPOrDomain(dest.Address),
+				Port:    uint32(dest.Port),
+				NetworkList: &net.NetworkList{
+					Network: []net.Network{net.Network_TCP},
+				},
+			}),
+		}
+	}
+
+	serverConfig := &core.Config{
+		App: []*serial.TypedMessage{
+			serial.ToTypedMessage(&reverse.Config{
+				PortalConfig: []*reverse.PortalConfig{
+					{
+						Tag: "portal",
+						Bridge: []*reverse.PortalBridge{
+							{Tag: "bridge-a", Domain: "a.test.v2ray.com", Token: "token-a"},
+							{Tag: "bridge-b", Domain: "b.test.v2ray.com", Token: "token-b"},
+						},
+					},
+				},
+			}),
+			serial.ToTypedMessage(&router.Config{
+				Rule: []*router.RoutingRule{
+					{
+						Domain: []*router.Domain{
+							{Type: router.Domain_Full, Value: "a.test.v2ray.com"},
+							{Type: router.Domain_Full, Value: "b.test.v2ray.com"},
+						},
+						TargetTag: &router.RoutingRule_Tag{
+							Tag: "portal",
+						},
+					},
+					{
+						InboundTag: []string{"external-a"},
+						TargetTag: &router.RoutingRule_Tag{
+							Tag: "bridge-a",
+						},
+					},
+					{
+						InboundTag: []string{"external-b"},
+						TargetTag: &router.RoutingRule_Tag{
+							Tag: "bridge-b",
+						},
+					},
+				},
+			}),
+		},
+		Inbound: []*core.InboundHandlerConfig{
+			externalInbound("external-a", externalPortA),
+			externalInbound("external-b", externalPortB),
+			{
+				ReceiverSettings: serial.ToTypedMessage(&proxyman.ReceiverConfig{
+					PortRange: net.SinglePortRange(reversePort),
+					Listen:    net.NewIPOrDomain(net.LocalHostIP),
+				}),
+				ProxySettings: serial.ToTypedMessage(&inbound.Config{
+					User: []*protocol.User{
+						{
+							Account: serial.ToTypedMessage(&vmess.Account{
+								Id:      userID.String(),
+								AlterId: 64,
+							}),
+						},
+					},
+				}),
+			},
+		},
+		Outbound: []*core.OutboundHandlerConfig{
+			{
+				ProxySettings: serial.ToTypedMessage(&blackhole.Config{}),
+			},
+		},
+	}
+
+	clientConfig := &core.Config{
+		App: []*serial.TypedMessage{
+			serial.ToTypedMessage(&reverse.Config{
+				BridgeConfig: []*reverse.BridgeConfig{
+					{
+						Tag:    "bridge",
+						Domain: "a.test.v2ray.com",
+						Token:  "token-a",
+					},
+					{
+						Tag:    "impostor",
+						Domain: "b.test.v2ray.com",
+						Token:  "token-a",
+					},
+				},
+			}),
+			serial.ToTypedMessage(&router.Config{
+				Rule: []*router.RoutingRule{
+					{
+						Domain: []*router.Domain{
+							{Type: router.Domain_Full, Value: "a.test.v2ray.com"},
+							{Type: router.Domain_Full, Value: "b.test.v2ray.com"},
+						},
+						TargetTag: &router.RoutingRule_Tag{
+							Tag: "reverse",
+						},
+					},
+					{
+						InboundTag: []string{"bridge", "impostor"},
+						TargetTag: &router.RoutingRule_Tag{
+							Tag: "freedom",
+						},
+					},
+				},
+			}),
+		},
+		Outbound: []*core.OutboundHandlerConfig{
+			{
+				Tag:           "freedom",
+				ProxySettings: serial.ToTypedMessage(&freedom.Config{}),
+			},
+			{
+				Tag: "reverse",
+				ProxySettings: serial.ToTypedMessage(&outbound.Config{
+					Receiver: []*protocol.ServerEndpoint{
+						{
+							Address: net.NewIPOrDomain(net.LocalHostIP),
+							Port:    uint32(reversePort),
+							User: []*protocol.User{
+								{
+									Account: serial.ToTypedMessage(&vmess.Account{
+										Id:      userID.String(),
+										AlterId: 64,
+										SecuritySettings: &protocol.SecurityConfig{
+											Type: protocol.SecurityType_AES128_GCM,
+										},
+									}),
+								},
+							},
+						},
+					},
+				}),
+			},
+		},
+	}
+
+	servers, err := InitializeServerConfigs(serverConfig, clientConfig)
+	common.Must(err)
+
+	defer CloseAllServers(servers)
+
+	time.Sleep(time.Second * 3)
+
+	if err := testTCPConn(externalPortA, 1024, time.Second*10)(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The impostor presents the token of bridge A, so traffic for bridge B is never relayed.
+	if err := testTCPConn(externalPortB, 1024, time.Second*2)(); err == nil {
+		t.Fatal("expected traffic for bridge B to fail, but succeeded")
+	}
+}
+
+func TestReverseProxyServices(t *testing.T) {
+	tcpServerA := tcp.Server{
+		MsgProcessor: xor,
+	}
+	destA, err := tcpServerA.Start()
+	common.Must(err)
+	defer tcpServerA.Close()
+
+	tcpServerB := tcp.Server{
+		MsgProcessor: xor,
+	}
+	destB, err := tcpServerB.Start()
+	common.Must(err)
+	defer tcpServerB.Close()
+
+	userID := protocol.NewID(uuid.New())
+	externalPortA := tcp.PickPort()
+	externalPortB := tcp.PickPort()
+	externalPortMismatch := tcp.PickPort()
+	reversePort := tcp.PickPort()
+
+	// The destination of external inbounds is ignored, as services are relayed to their own addresses.
+	externalInbound := func(tag string, port net.Port) *core.InboundHandlerConfig {
+		return &core.InboundHandlerConfig{
+			Tag: tag,
+			ReceiverSettings: serial.ToTypedMessage(&proxyman.ReceiverConfig{
+				PortRange: net.SinglePortRange(port),
+				Listen:    net.NewIPOrDomain(net.LocalHostIP),
+			}),
+			ProxySettings: serial.ToTypedMessage(&dokodemo.Config{
+				Address: net.NewIPOrDomain(net.LocalHostIP),
+				Port:    1,
+				NetworkList: &net.NetworkList{
+					Network: []net.Network{net.Network_TCP},
+				},
+			}),
+		}
+	}
+	routeInbound := func(inboundTag string, outboundTag string) *router.RoutingRule {
+		return &router.RoutingRule{
+			InboundTag: []string{inboundTag},
+			TargetTag: &router.RoutingRule_Tag{
+				Tag: outboundTag,
+			},
+		}
+	}
+
+	serverConfig := &core.Config{
+		App: []*serial.TypedMessage{
+			serial.ToTypedMessage(&reverse.Config{
+				PortalConfig: []*reverse.PortalConfig{
+					{
+						Tag: "portal",
+						Bridge: []*reverse.PortalBridge{
+							{Tag: "bridge-a", Domain: "a.test.v2ray.com", Token: "token-a"},
+							{Tag: "bridge-b", Domain: "b.test.v2ray.com", Token: "token-b"},
+						},
+						Service: []*reverse.PortalService{
+							{Tag: "service-a", Service: "alpha"},
+							{Tag: "service-b", Service: "beta"},
+							{Tag: "service-mismatch", Service: "beta", Bridge: "bridge-a"},
+						},
+					},
+				},
+			}),
+			serial.ToTypedMessage(&router.Config{
+				Rule: []*router.RoutingRule{
+					{
+						Domain: []*router.Domain{
+							{Type: router.Domain_Full, Value: "a.test.v2ray.com"},
+							{Type: router.Domain_Full, Value: "b.test.v2ray.com"},
+						},
+						TargetTag: &router.RoutingRule_Tag{
+							Tag: "portal",
+						},
+					},
+					routeInbound("external-a", "service-a"),
+					routeInbound("external-b", "service-b"),
+					routeInbound("external-mismatch", "service-mismatch"),
+				},
+			}),
+		},
+		Inbound: []*core.InboundHandlerConfig{
+			externalInbound("external-a", externalPortA),
+			externalInbound("external-b", externalPortB),
+			externalInbound("external-mismatch", externalPortMismatch),
+			{
+				ReceiverSettings: serial.ToTypedMessage(&proxyman.ReceiverConfig{
+					PortRange: net.SinglePortRange(reversePort),
+					Listen:    net.NewIPOrDomain(net.LocalHostIP),
+				}),
+				ProxySettings: serial.ToTypedMessage(&inbound.Config{
+					User: []*protocol.User{
+						{
+							Account: serial.ToTypedMessage(&vmess.Account{
+								Id:      userID.String(),
+								AlterId: 64,
+							}),
+						},
+					},
+				}),
+			},
+		},
+		Outbound: []*core.OutboundHandlerConfig{
+			{
+				ProxySettings: serial.ToTypedMessage(&blackhole.Config{}),
+			},
+		},
+	}
+
+	bridgeConfig := func(domain string, token string, service *reverse.BridgeService) *core.Config {
+		return &core.Config{
+			App: []*serial.TypedMessage{
+				serial.ToTypedMessage(&reverse.Config{
+					BridgeConfig: []*reverse.BridgeConfig{
+						{
+							Tag:     "bridge",
+							Domain:  domain,
+							Token:   token,
+							Service: []*reverse.BridgeService{service},
+						},
+					},
+				}),
+				serial.ToTypedMessage(&router.Config{
+					Rule: []*router.RoutingRule{
+						{
+							Domain: []*router.Domain{
+								{Type: router.Domain_Full, Value: domain},
+							},
+							TargetTag: &router.RoutingRule_Tag{
+								Tag: "reverse",
+							},
+						},
+						routeInbound("bridge", "freedom"),
+					},
+				}),
+			},
+			Outbound: []*core.OutboundHandlerConfig{
+				{
+					Tag:           "freedom",
+					ProxySettings: serial.ToTypedMessage(&freedom.Config{}),
+				},
+				{
+					Tag: "reverse",
+					ProxySettings: serial.ToTypedMessage(&outbound.Config{
+						Receiver: []*protocol.ServerEndpoint{
+							{
+								Address: net.NewIPOrDomain(net.LocalHostIP),
+								Port:    uint32(reversePort),
+								User: []*protocol.User{
+									{
+										Account: serial.ToTypedMessage(&vmess.Account{
+											Id:      userID.String(),
+											AlterId: 64,
+											SecuritySettings: &protocol.SecurityConfig{
+												Type: protocol.SecurityType_AES128_GCM,
+											},
+										}),
+									},
+								},
+							},
+						},
+					}),
+				},
+			},
+		}
+	}
+
+	servers, err := InitializeServerConfigs(
+		serverConfig,
+		bridgeConfig("a.test.v2ray.com", "token-a", &reverse.BridgeService{
+			Tag:     "alpha",
+			Address: net.NewIPOrDomain(destA.Address),
+			Port:    uint32(destA.Port),
+		}),
+		bridgeConfig("b.test.v2ray.com", "token-b", &reverse.BridgeService{
+			Tag:     "beta",
+			Address: net.NewIPOrDomain(destB.Address),
+			Port:    uint32(destB.Port),
+		}),
+	)
+	common.Must(err)
+
+	defer CloseAllServers(servers)
+
+	time.Sleep(time.Second * 3)
+
+	var errg errgroup.Group
+	for i := 0; i < 4; i++ {
+		errg.Go(testTCPConn(externalPortA, 1024, time.Second*10))
+		errg.Go(testTCPConn(externalPortB, 1024, time.Second*10))
+	}
+	if err := errg.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only bridge B provides service beta, so it is never relayed through bridge A.
+	if err := testTCPConn(externalPortMismatch, 1024, time.Second*2)(); err == nil {
+		t.Fatal("expected traffic for service beta through bridge A to fail, but succeeded")
+	}
+}
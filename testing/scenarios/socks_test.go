@@ -1,6 +1,7 @@
 package scenarios
 
 import (
+	"io"
 	"testing"
 	"time"
 
@@ -11,6 +12,7 @@ import (
 	"v2ray.com/core/app/proxyman"
 	"v2ray.com/core/app/router"
 	"v2ray.com/core/common"
+	"v2ray.com/core/common/buf"
 	"v2ray.com/core/common/net"
 	"v2ray.com/core/common/protocol"
 	"v2ray.com/core/common/serial"
@@ -369,3 +371,157 @@ func TestSocksConformanceMod(t *testing.T) {
 		}
 	}
 }
+
+func TestSocksSniffingServerSpeaksFirst(t *testing.T) {
+	banner := []byte("SSH-2.0-OpenSSH_8.4\r\n")
+	tcpServer := tcp.Server{
+		MsgProcessor: xor,
+		SendFirst:    banner,
+	}
+	dest, err := tcpServer.Start()
+	common.Must(err)
+	defer tcpServer.Close()
+
+	serverPort := tcp.PickPort()
+	serverConfig := &core.Config{
+		Inbound: []*core.InboundHandlerConfig{
+			{
+				ReceiverSettings: serial.ToTypedMessage(&proxyman.ReceiverConfig{
+					PortRange: net.SinglePortRange(serverPort),
+					Listen:    net.NewIPOrDomain(net.LocalHostIP),
+					SniffingSettings: &proxyman.SniffingConfig{
+						Enabled:             true,
+						DestinationOverride: []string{"http", "tls"},
+						Timeout:             100,
+					},
+				}),
+				ProxySettings: serial.ToTypedMessage(&socks.ServerConfig{
+					AuthType: socks.AuthType_NO_AUTH,
+					Address:  net.NewIPOrDomain(net.LocalHostIP),
+				}),
+			},
+		},
+		Outbound: []*core.OutboundHandlerConfig{
+			{
+				ProxySettings: serial.ToTypedMessage(&freedom.Config{}),
+			},
+		},
+	}
+
+	servers, err := InitializeServerConfigs(serverConfig)
+	common.Must(err)
+	defer CloseAllServers(servers)
+
+	dialer, err := xproxy.SOCKS5("tcp", net.TCPDestination(net.LocalHostIP, serverPort).NetAddr(), nil, xproxy.Direct)
+	common.Must(err)
+	conn, err := dialer.Dial("tcp", dest.NetAddr())
+	common.Must(err)
+	defer conn.Close()
+
+	// The client sends nothing until the server has spoken, so sniffing must give up on its own.
+	start := time.Now()
+	response, err := readFrom2(conn, time.Second*2, len(banner))
+	common.Must(err)
+	if string(response) != string(banner) {
+		t.Fatal("unexpected banner: ", string(response))
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Error("banner took too long: ", elapsed)
+	}
+
+	if err := testTCPConn2(conn, 1024, time.Second*5)(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSocksUDPUnreachable(t *testing.T) {
+	serverPort := tcp.PickPort()
+	serverConfig := &core.Config{
+		Inbound: []*core.InboundHandlerConfig{
+			{
+				ReceiverSettings: serial.ToTypedMessage(&proxyman.ReceiverConfig{
+					PortRange: net.SinglePortRange(serverPort),
+					Listen:    net.NewIPOrDomain(net.LocalHostIP),
+				}),
+				ProxySettings: serial.ToTypedMessage(&socks.ServerConfig{
+					AuthType:   socks.AuthType_NO_AUTH,
+					Address:    net.NewIPOrDomain(net.LocalHostIP),
+					UdpEnabled: true,
+				}),
+			},
+		},
+		Outbound: []*core.OutboundHandlerConfig{
+			{
+				ProxySettings: serial.ToTypedMessage(&freedom.Config{}),
+			},
+		},
+	}
+
+	clientPort := tcp.PickPort()
+	clientConfig := &core.Config{
+		Inbound: []*core.InboundHandlerConfig{
+			{
+				ReceiverSettings: serial.ToTypedMessage(&proxyman.ReceiverConfig{
+					PortRange: net.SinglePortRange(clientPort),
+					Listen:    net.NewIPOrDomain(net.LocalHostIP),
+				}),
+				ProxySettings: serial.ToTypedMessage(&socks.ServerConfig{
+					AuthType:   socks.AuthType_NO_AUTH,
+					Address:    net.NewIPOrDomain(net.LocalHostIP),
+					UdpEnabled: true,
+				}),
+			},
+		},
+		Outbound: []*core.OutboundHandlerConfig{
+			{
+				ProxySettings: serial.ToTypedMessage(&socks.ClientConfig{
+					Server: []*protocol.ServerEndpoint{
+						{
+							Address: net.NewIPOrDomain(net.LocalHostIP),
+							Port:    uint32(serverPort),
+						},
+					},
+				}),
+			},
+		},
+	}
+
+	servers, err := InitializeServerConfigs(serverConfig, clientConfig)
+	common.Must(err)
+	defer CloseAllServers(servers)
+
+	conn, err := net.DialTCP("tcp", nil, &net.TCPAddr{
+		IP:   []byte{127, 0, 0, 1},
+		Port: int(clientPort),
+	})
+	common.Must(err)
+	defer conn.Close()
+
+	// Nothing listens on this port, so the freedom outbound gets an ICMP port unreachable.
+	request := &protocol.RequestHeader{
+		Version: 5,
+		Command: protocol.RequestCommandUDP,
+		Address: net.LocalHostIP,
+		Port:    udp.PickPort(),
+	}
+	udpRequest, err := socks.ClientHandshake(request, conn, conn)
+	common.Must(err)
+
+	udpConn, err := net.DialUDP("udp", nil, &net.UDPAddr{
+		IP:   udpRequest.Address.IP(),
+		Port: int(udpRequest.Port),
+	})
+	common.Must(err)
+	defer udpConn.Close()
+
+	writer := socks.NewUDPWriter(request, udpConn)
+	for i := 0; i < 3; i++ {
+		common.Must2(writer.Write([]byte("ping")))
+		time.Sleep(time.Millisecond * 200)
+	}
+
+	common.Must(conn.SetReadDeadline(time.Now().Add(time.Second * 10)))
+	if _, err := io.Copy(buf.DiscardBytes, conn); err != nil {
+		t.Error("expected the UDP association to be closed, but got ", err)
+	}
+}
@@ -1,6 +1,7 @@
 package scenarios
 
 import (
+	"io"
 	"os"
 	"testing"
 	"time"
@@ -10,6 +11,7 @@ import (
 	"v2ray.com/core/app/log"
 	"v2ray.com/core/app/proxyman"
 	"v2ray.com/core/common"
+	"v2ray.com/core/common/buf"
 	clog "v2ray.com/core/common/log"
 	"v2ray.com/core/common/net"
 	"v2ray.com/core/common/protocol"
@@ -17,6 +19,7 @@ import (
 	"v2ray.com/core/common/uuid"
 	"v2ray.com/core/proxy/dokodemo"
 	"v2ray.com/core/proxy/freedom"
+	"v2ray.com/core/proxy/socks"
 	"v2ray.com/core/proxy/vmess"
 	"v2ray.com/core/proxy/vmess/inbound"
 	"v2ray.com/core/proxy/vmess/outbound"
@@ -463,6 +466,113 @@ func TestVMessGCMUDP(t *testing.T) {
 	}
 }
 
+func TestVMessUDPUnreachable(t *testing.T) {
+	userID := protocol.NewID(uuid.New())
+	serverPort := tcp.PickPort()
+	serverConfig := &core.Config{
+		Inbound: []*core.InboundHandlerConfig{
+			{
+				ReceiverSettings: serial.ToTypedMessage(&proxyman.ReceiverConfig{
+					PortRange: net.SinglePortRange(serverPort),
+					Listen:    net.NewIPOrDomain(net.LocalHostIP),
+				}),
+				ProxySettings: serial.ToTypedMessage(&inbound.Config{
+					User: []*protocol.User{
+						{
+							Account: serial.ToTypedMessage(&vmess.Account{
+								Id: userID.String(),
+							}),
+						},
+					},
+				}),
+			},
+		},
+		Outbound: []*core.OutboundHandlerConfig{
+			{
+				ProxySettings: serial.ToTypedMessage(&freedom.Config{}),
+			},
+		},
+	}
+
+	clientPort := tcp.PickPort()
+	clientConfig := &core.Config{
+		Inbound: []*core.InboundHandlerConfig{
+			{
+				ReceiverSettings: serial.ToTypedMessage(&proxyman.ReceiverConfig{
+					PortRange: net.SinglePortRange(clientPort),
+					Listen:    net.NewIPOrDomain(net.LocalHostIP),
+				}),
+				ProxySettings: serial.ToTypedMessage(&socks.ServerConfig{
+					AuthType:   socks.AuthType_NO_AUTH,
+					Address:    net.NewIPOrDomain(net.LocalHostIP),
+					UdpEnabled: true,
+				}),
+			},
+		},
+		Outbound: []*core.OutboundHandlerConfig{
+			{
+				ProxySettings: serial.ToTypedMessage(&outbound.Config{
+					Receiver: []*protocol.ServerEndpoint{
+						{
+							Address: net.NewIPOrDomain(net.LocalHostIP),
+							Port:    uint32(serverPort),
+							User: []*protocol.User{
+								{
+									Account: serial.ToTypedMessage(&vmess.Account{
+										Id: userID.String(),
+										SecuritySettings: &protocol.SecurityConfig{
+											Type: protocol.SecurityType_AES128_GCM,
+										},
+									}),
+								},
+							},
+						},
+					},
+				}),
+			},
+		},
+	}
+
+	servers, err := InitializeServerConfigs(serverConfig, clientConfig)
+	common.Must(err)
+	defer CloseAllServers(servers)
+
+	conn, err := net.DialTCP("tcp", nil, &net.TCPAddr{
+		IP:   []byte{127, 0, 0, 1},
+		Port: int(clientPort),
+	})
+	common.Must(err)
+	defer conn.Close()
+
+	// Nothing listens on this port, so the freedom outbound of the server gets an ICMP port unreachable.
+	request := &protocol.RequestHeader{
+		Version: 5,
+		Command: protocol.RequestCommandUDP,
+		Address: net.LocalHostIP,
+		Port:    udp.PickPort(),
+	}
+	udpRequest, err := socks.ClientHandshake(request, conn, conn)
+	common.Must(err)
+
+	udpConn, err := net.DialUDP("udp", nil, &net.UDPAddr{
+		IP:   udpRequest.Address.IP(),
+		Port: int(udpRequest.Port),
+	})
+	common.Must(err)
+	defer udpConn.Close()
+
+	writer := socks.NewUDPWriter(request, udpConn)
+	for i := 0; i < 3; i++ {
+		common.Must2(writer.Write([]byte("ping")))
+		time.Sleep(time.Millisecond * 200)
+	}
+
+	common.Must(conn.SetReadDeadline(time.Now().Add(time.Second * 10)))
+	if _, err := io.Copy(buf.DiscardBytes, conn); err != nil {
+		t.Error("expected the UDP association to be closed, but got ", err)
+	}
+}
+
 func TestVMessChacha20(t *testing.T) {
 	tcpServer := tcp.Server{
 		MsgProcessor: xor,
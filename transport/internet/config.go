@@ -1,6 +1,8 @@
 package internet
 
 import (
+	"context"
+
 	"v2ray.com/core/common/serial"
 	"v2ray.com/core/features"
 )
@@ -41,6 +43,15 @@ func RegisterProtocolConfigCreator(name string, creator ConfigCreator) error {
 	return nil
 }
 
+// RegisteredProtocols returns the names of all transport protocols registered through RegisterProtocolConfigCreator().
+func RegisteredProtocols() []string {
+	names := make([]string, 0, len(globalTransportConfigCreatorCache))
+	for name := range globalTransportConfigCreatorCache {
+		names = append(names, name)
+	}
+	return names
+}
+
 func CreateTransportConfig(name string) (interface{}, error) {
 	creator, ok := globalTransportConfigCreatorCache[name]
 	if !ok {
@@ -79,6 +90,12 @@ func (c *StreamConfig) GetEffectiveTransportSettings() (interface{}, error) {
 }
 
 func (c *StreamConfig) GetTransportSettingsFor(protocol string) (interface{}, error) {
+	return c.getTransportSettingsFor(context.Background(), protocol)
+}
+
+// getTransportSettingsFor returns the settings of protocol in c, or the default ones in ctx, or the
+// global ones.
+func (c *StreamConfig) getTransportSettingsFor(ctx context.Context, protocol string) (interface{}, error) {
 	if c != nil {
 		for _, settings := range c.TransportSettings {
 			if settings.GetUnifiedProtocolName() == protocol {
@@ -87,6 +104,14 @@ func (c *StreamConfig) GetTransportSettingsFor(protocol string) (interface{}, er
 		}
 	}
 
+	if defaults, ok := ctx.Value(transportSettingsKey).([]*TransportConfig); ok {
+		for _, settings := range defaults {
+			if settings.GetUnifiedProtocolName() == protocol {
+				return settings.GetTypedSettings()
+			}
+		}
+	}
+
 	for _, settings := range globalTransportSettings {
 		if settings.GetUnifiedProtocolName() == protocol {
 			return settings.GetTypedSettings()
@@ -109,6 +134,19 @@ func (c *StreamConfig) HasSecuritySettings() bool {
 	return len(c.SecurityType) > 0
 }
 
+type configKey int
+
+const transportSettingsKey configKey = iota
+
+// ContextWithTransportSettings returns a context in which stream settings made by
+// ToMemoryStreamConfigWithContext default to the given transport settings. It scopes the deprecated
+// global transport settings to a V2Ray instance.
+func ContextWithTransportSettings(ctx context.Context, settings []*TransportConfig) context.Context {
+	return context.WithValue(ctx, transportSettingsKey, settings)
+}
+
+// ApplyGlobalTransportSettings sets the transport settings of all stream settings in the process.
+// Use ContextWithTransportSettings to set them for an instance.
 func ApplyGlobalTransportSettings(settings []*TransportConfig) error {
 	features.PrintDeprecatedFeatureWarning("global transport settings")
 	globalTransportSettings = settings
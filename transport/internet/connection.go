@@ -32,3 +32,58 @@ func (c *StatCouterConnection) Write(b []byte) (int, error) {
 	}
 	return nBytes, err
 }
+
+// NewStatCouterConnection returns a connection counting bytes read and written with the counters, which
+// may be nil. If conn is a StatCouterConnection already, it is replaced by one counting with both its
+// counters and the given ones, as proxies unwrap only one StatCouterConnection to reach the underlying
+// connection.
+func NewStatCouterConnection(conn Connection, readCounter, writeCounter stats.Counter) Connection {
+	if readCounter == nil && writeCounter == nil {
+		return conn
+	}
+	if c, ok := conn.(*StatCouterConnection); ok {
+		return &StatCouterConnection{
+			Connection:   c.Connection,
+			ReadCounter:  joinCounters(c.ReadCounter, readCounter),
+			WriteCounter: joinCounters(c.WriteCounter, writeCounter),
+		}
+	}
+	return &StatCouterConnection{
+		Connection:   conn,
+		ReadCounter:  readCounter,
+		WriteCounter: writeCounter,
+	}
+}
+
+// counterGroup adds values to all of its counters. Its value is the value of the first counter.
+type counterGroup []stats.Counter
+
+func joinCounters(a, b stats.Counter) stats.Counter {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	return counterGroup{a, b}
+}
+
+func (g counterGroup) Value() int64 {
+	return g[0].Value()
+}
+
+func (g counterGroup) Set(v int64) int64 {
+	prev := g[0].Set(v)
+	for _, c := range g[1:] {
+		c.Set(v)
+	}
+	return prev
+}
+
+func (g counterGroup) Add(v int64) int64 {
+	prev := g[0].Add(v)
+	for _, c := range g[1:] {
+		c.Add(v)
+	}
+	return prev
+}
@@ -2,7 +2,9 @@ package internet
 
 import (
 	"context"
+	"time"
 
+	"v2ray.com/core/common/errors"
 	"v2ray.com/core/common/net"
 	"v2ray.com/core/common/session"
 )
@@ -16,6 +18,15 @@ type Dialer interface {
 	Address() net.Address
 }
 
+// SocketSettingsDialer is a Dialer that dials with socket options. Proxies that open sockets by themselves
+// apply the same options.
+type SocketSettingsDialer interface {
+	Dialer
+
+	// SocketSettings returns the socket options of the Dialer. Maybe nil if there is none.
+	SocketSettings() *SocketConfig
+}
+
 // dialFunc is an interface to dial network connection to a specific destination.
 type dialFunc func(ctx context.Context, dest net.Destination, streamSettings *MemoryStreamConfig) (Connection, error)
 
@@ -36,7 +47,7 @@ func RegisterTransportDialer(protocol string, dialer dialFunc) error {
 func Dial(ctx context.Context, dest net.Destination, streamSettings *MemoryStreamConfig) (Connection, error) {
 	if dest.Network == net.Network_TCP {
 		if streamSettings == nil {
-			s, err := ToMemoryStreamConfig(nil)
+			s, err := ToMemoryStreamConfigWithContext(ctx, nil)
 			if err != nil {
 				return nil, newError("failed to create default stream settings").Base(err)
 			}
@@ -48,7 +59,11 @@ func Dial(ctx context.Context, dest net.Destination, streamSettings *MemoryStrea
 		if dialer == nil {
 			return nil, newError(protocol, " dialer not registered").AtError()
 		}
-		return dialer(ctx, dest, streamSettings)
+		conn, err := dialer(ctx, dest, streamSettings)
+		if err == nil {
+			conn = withReadv(ctx, conn)
+		}
+		return countDial(ctx, protocol, conn, err)
 	}
 
 	if dest.Network == net.Network_UDP {
@@ -56,17 +71,50 @@ func Dial(ctx context.Context, dest net.Destination, streamSettings *MemoryStrea
 		if udpDialer == nil {
 			return nil, newError("UDP dialer not registered").AtError()
 		}
-		return udpDialer(ctx, dest, streamSettings)
+		conn, err := udpDialer(ctx, dest, streamSettings)
+		return countDial(ctx, "udp", conn, err)
 	}
 
 	return nil, newError("unknown network ", dest.Network)
 }
 
+// ContextWithSystemDialer returns a context in which transports make their connections with the
+// given dialer instead of the system dialer, so that they can be layered over other connections.
+func ContextWithSystemDialer(ctx context.Context, dialer SystemDialer) context.Context {
+	return context.WithValue(ctx, systemDialerKey, dialer)
+}
+
+// ContextWithHandshakeTimeout returns a context in which dialers connect, including the handshakes of
+// transports, within timeout from now, instead of their own timeouts.
+func ContextWithHandshakeTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, handshakeDeadlineKey, time.Now().Add(timeout))
+}
+
+// HandshakeDeadline returns the time by which dialers must connect, if set by ContextWithHandshakeTimeout.
+func HandshakeDeadline(ctx context.Context) (time.Time, bool) {
+	deadline, ok := ctx.Value(handshakeDeadlineKey).(time.Time)
+	return deadline, ok
+}
+
 // DialSystem calls system dialer to create a network connection.
 func DialSystem(ctx context.Context, dest net.Destination, sockopt *SocketConfig) (net.Conn, error) {
 	var src net.Address
 	if outbound := session.OutboundFromContext(ctx); outbound != nil {
 		src = outbound.Gateway
 	}
-	return effectiveSystemDialer.Dial(ctx, src, dest, sockopt)
+	dialer := effectiveSystemDialer
+	if d, ok := ctx.Value(systemDialerKey).(SystemDialer); ok {
+		dialer = d
+	}
+	conn, err := dialer.Dial(ctx, src, dest, sockopt)
+	if err != nil {
+		return nil, errors.Classify(err, errors.KindUnreachable)
+	}
+	if sockopt != nil && sockopt.SendProxyProtocol > 0 && !sockopt.ProxyProtocolInsideTls && dest.Network == net.Network_TCP {
+		if err := WriteProxyProtocol(ctx, conn, sockopt.SendProxyProtocol); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
 }
@@ -25,3 +25,81 @@ func TestDialWithLocalAddr(t *testing.T) {
 	}
 	conn.Close()
 }
+
+func TestDialHappyEyeballsFallback(t *testing.T) {
+	server := &tcp.Server{}
+	dest, err := server.Start()
+	common.Must(err)
+	defer server.Close()
+
+	// Nothing listens on the IPv6 loopback, so the dialer has to fall back to IPv4.
+	primary := net.TCPDestination(net.LocalHostIPv6, dest.Port)
+	ctx := ContextWithFallbackIPs(context.Background(), primary.Address.IP(), []net.IP{net.LocalHostIP.IP()})
+
+	conn, err := DialSystem(ctx, primary, nil)
+	common.Must(err)
+	if r := cmp.Diff(conn.RemoteAddr().String(), "127.0.0.1:"+dest.Port.String()); r != "" {
+		t.Error(r)
+	}
+	conn.Close()
+
+	if conn, err := DialSystem(ctx, primary, &SocketConfig{DisableHappyEyeballs: true}); err == nil {
+		conn.Close()
+		t.Error("expected dialing without Happy Eyeballs to fail")
+	}
+
+	// The addresses of domains come from the resolver of the context.
+	lookupCtx := ContextWithLookupIP(context.Background(), func(string) ([]net.IP, error) {
+		return []net.IP{net.LocalHostIPv6.IP(), net.LocalHostIP.IP()}, nil
+	})
+	for i := 0; i < 4; i++ {
+		conn, err := DialSystem(lookupCtx, net.TCPDestination(net.DomainAddress("v2fly.org"), dest.Port), nil)
+		common.Must(err)
+		conn.Close()
+	}
+}
+
+func TestDialHappyEyeballsPrefersIPv6(t *testing.T) {
+	listener6, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		t.Skip("IPv6 is not available: ", err)
+	}
+	defer listener6.Close()
+	port := net.Port(listener6.Addr().(*net.TCPAddr).Port)
+	listener4, err := net.Listen("tcp", "127.0.0.1:"+port.String())
+	common.Must(err)
+	defer listener4.Close()
+
+	// IPv6 goes first, even though the resolver picks the IPv4 address.
+	primary := net.TCPDestination(net.LocalHostIP, port)
+	ctx := ContextWithFallbackIPs(context.Background(), primary.Address.IP(), []net.IP{net.LocalHostIP.IP(), net.LocalHostIPv6.IP()})
+	conn, err := DialSystem(ctx, primary, nil)
+	common.Must(err)
+	if r := cmp.Diff(conn.RemoteAddr().String(), "[::1]:"+port.String()); r != "" {
+		t.Error(r)
+	}
+	conn.Close()
+}
+
+func TestDialWithLookupIP(t *testing.T) {
+	server := &tcp.Server{}
+	dest, err := server.Start()
+	common.Must(err)
+	defer server.Close()
+
+	var domains []string
+	ctx := ContextWithLookupIP(context.Background(), func(domain string) ([]net.IP, error) {
+		domains = append(domains, domain)
+		return []net.IP{net.LocalHostIP.IP()}, nil
+	})
+
+	conn, err := DialSystem(ctx, net.TCPDestination(net.DomainAddress("v2fly.org"), dest.Port), nil)
+	common.Must(err)
+	if r := cmp.Diff(conn.RemoteAddr().String(), "127.0.0.1:"+dest.Port.String()); r != "" {
+		t.Error(r)
+	}
+	conn.Close()
+	if r := cmp.Diff(domains, []string{"v2fly.org"}); r != "" {
+		t.Error(r)
+	}
+}
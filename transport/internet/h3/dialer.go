@@ -0,0 +1,247 @@
+// +build !confonly
+
+package h3
+
+import (
+	"context"
+	gotls "crypto/tls"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/http3"
+
+	"v2ray.com/core/common"
+	"v2ray.com/core/common/buf"
+	"v2ray.com/core/common/net"
+	"v2ray.com/core/common/session"
+	"v2ray.com/core/transport/internet"
+	v2http "v2ray.com/core/transport/internet/http"
+	"v2ray.com/core/transport/internet/tls"
+	"v2ray.com/core/transport/pipe"
+)
+
+const (
+	defaultHandshakeTimeout = time.Second * 8
+	// h2FallbackDuration is how long clients dial HTTP/2 instead, after a QUIC handshake to the destination fails.
+	h2FallbackDuration = time.Minute * 10
+)
+
+// dialerConf identifies a cached client. The TLS and socket settings belong to the stream settings of a
+// handler, so that handlers, possibly of different instances, do not share clients.
+type dialerConf struct {
+	net.Destination
+	*tls.Config
+	*internet.SocketConfig
+}
+
+var (
+	globalDialerMap    map[dialerConf]*http3.RoundTripper
+	globalFallbackMap  map[dialerConf]time.Time
+	globalDialerAccess sync.Mutex
+)
+
+// getHTTPClient returns the cached client for key, or a new one. It returns whether the client is cached, as
+// the QUIC session of a cached client may have been closed.
+func getHTTPClient(key dialerConf, handshakeTimeout time.Duration) (*http3.RoundTripper, bool) {
+	globalDialerAccess.Lock()
+	defer globalDialerAccess.Unlock()
+
+	if globalDialerMap == nil {
+		globalDialerMap = make(map[dialerConf]*http3.RoundTripper)
+	}
+
+	if client, found := globalDialerMap[key]; found {
+		return client, true
+	}
+
+	dest := key.Destination
+	sockopt := key.SocketConfig
+
+	client := &http3.RoundTripper{
+		// Disable any compression method from server.
+		DisableCompression: true,
+		TLSClientConfig:    key.Config.GetTLSConfig(tls.WithDestination(dest)),
+		QuicConfig: &quic.Config{
+			HandshakeTimeout: handshakeTimeout,
+			MaxIdleTimeout:   time.Second * 30,
+			KeepAlive:        true,
+		},
+		Dial: func(network, addr string, tlsConfig *gotls.Config, quicConfig *quic.Config) (quic.EarlySession, error) {
+			destAddr, err := net.ResolveUDPAddr("udp", dest.NetAddr())
+			if err != nil {
+				return nil, err
+			}
+			rawConn, err := internet.ListenSystemPacket(context.Background(), &net.UDPAddr{
+				IP:   []byte{0, 0, 0, 0},
+				Port: 0,
+			}, sockopt)
+			if err != nil {
+				return nil, err
+			}
+			session, err := quic.DialEarly(rawConn, destAddr, addr, tlsConfig, quicConfig)
+			if err != nil {
+				key.Config.ReportVerifyError(tlsConfig.ServerName, err)
+				rawConn.Close()
+				return nil, err
+			}
+			go func() {
+				<-session.Context().Done()
+				rawConn.Close()
+			}()
+			return session, nil
+		},
+	}
+
+	globalDialerMap[key] = client
+	return client, false
+}
+
+// removeHTTPClient removes the client from cache, as its QUIC session is closed or fails to be set up.
+func removeHTTPClient(key dialerConf, client *http3.RoundTripper) {
+	globalDialerAccess.Lock()
+	if globalDialerMap[key] == client {
+		delete(globalDialerMap, key)
+	}
+	globalDialerAccess.Unlock()
+
+	if err := client.Close(); err != nil {
+		newError("failed to close HTTP/3 client").Base(err).WriteToLog()
+	}
+}
+
+func shouldFallback(key dialerConf) bool {
+	globalDialerAccess.Lock()
+	defer globalDialerAccess.Unlock()
+
+	until, found := globalFallbackMap[key]
+	if found && time.Now().After(until) {
+		delete(globalFallbackMap, key)
+		return false
+	}
+	return found
+}
+
+func setFallback(key dialerConf) {
+	globalDialerAccess.Lock()
+	defer globalDialerAccess.Unlock()
+
+	if globalFallbackMap == nil {
+		globalFallbackMap = make(map[dialerConf]time.Time)
+	}
+	globalFallbackMap[key] = time.Now().Add(h2FallbackDuration)
+}
+
+func newRequest(ctx context.Context, dest net.Destination, h3Settings *Config) (*http.Request, *pipe.Writer) {
+	opts := pipe.OptionsFromContext(ctx)
+	preader, pwriter := pipe.New(opts...)
+	method := http.MethodPut
+	if h3Settings.ZeroRtt {
+		// Requests are sent in 0-RTT data only by this method, which is sent as GET.
+		method = http3.MethodGet0RTT
+	}
+	request := &http.Request{
+		Method: method,
+		Host:   h3Settings.getRandomHost(),
+		Body:   &buf.BufferedReader{Reader: preader},
+		URL: &url.URL{
+			Scheme: "https",
+			Host:   dest.NetAddr(),
+			Path:   h3Settings.getNormalizedPath(),
+		},
+		Proto:      "HTTP/3",
+		ProtoMajor: 3,
+		ProtoMinor: 0,
+		Header:     make(http.Header),
+	}
+	// Disable any compression method from server.
+	request.Header.Set("Accept-Encoding", "identity")
+	return request, pwriter
+}
+
+// roundTrip sends a request with a new QUIC stream. The request is sent again with a new client, if the session
+// of the cached client is closed.
+func roundTrip(ctx context.Context, key dialerConf, h3Settings *Config) (*http.Request, *pipe.Writer, *http.Response, error) {
+	handshakeTimeout := defaultHandshakeTimeout
+	if deadline, ok := internet.HandshakeDeadline(ctx); ok {
+		handshakeTimeout = time.Until(deadline)
+		if h3Settings.H2Fallback {
+			// The rest is for HTTP/2.
+			handshakeTimeout /= 2
+		}
+	}
+	for {
+		client, cached := getHTTPClient(key, handshakeTimeout)
+		request, pwriter := newRequest(ctx, key.Destination, h3Settings)
+		response, err := client.RoundTrip(request) // nolint: bodyclose
+		if err == nil {
+			return request, pwriter, response, nil
+		}
+		pwriter.Close()
+		removeHTTPClient(key, client)
+		if !cached {
+			return nil, nil, nil, newError("failed to dial to ", key.Destination).Base(err).AtWarning()
+		}
+	}
+}
+
+func dialHTTP2(ctx context.Context, dest net.Destination, h3Settings *Config, streamSettings *internet.MemoryStreamConfig) (internet.Connection, error) {
+	return v2http.Dial(ctx, net.TCPDestination(dest.Address, dest.Port), &internet.MemoryStreamConfig{
+		ProtocolName: "http",
+		ProtocolSettings: &v2http.Config{
+			Host: h3Settings.Host,
+			Path: h3Settings.Path,
+		},
+		SecurityType:     streamSettings.SecurityType,
+		SecuritySettings: streamSettings.SecuritySettings,
+		SocketSettings:   streamSettings.SocketSettings,
+		HandshakeTimeout: streamSettings.HandshakeTimeout,
+	})
+}
+
+// Dial dials a new HTTP/3 stream to the given destination, or an HTTP/2 stream over TCP if QUIC doesn't get through
+// and fallback is enabled.
+func Dial(ctx context.Context, dest net.Destination, streamSettings *internet.MemoryStreamConfig) (internet.Connection, error) {
+	if _, isUnix := dest.UnixPath(); isUnix {
+		return nil, newError("unix domain socket is not supported by HTTP/3 transport").AtWarning()
+	}
+	h3Settings := streamSettings.ProtocolSettings.(*Config)
+	tlsConfig := tls.ConfigFromStreamSettings(streamSettings)
+	if tlsConfig == nil {
+		return nil, newError("TLS must be enabled for HTTP/3 transport.").AtWarning()
+	}
+	key := dialerConf{net.UDPDestination(dest.Address, dest.Port), tlsConfig, streamSettings.SocketSettings}
+
+	if h3Settings.H2Fallback && shouldFallback(key) {
+		return dialHTTP2(ctx, dest, h3Settings, streamSettings)
+	}
+
+	request, pwriter, response, err := roundTrip(ctx, key, h3Settings)
+	if err != nil {
+		if !h3Settings.H2Fallback {
+			return nil, err
+		}
+		newError("falling back to HTTP/2 for ", dest).Base(err).WriteToLog(session.ExportIDToError(ctx))
+		setFallback(key)
+		return dialHTTP2(ctx, dest, h3Settings, streamSettings)
+	}
+	if response.StatusCode != 200 {
+		pwriter.Close()
+		response.Body.Close()
+		return nil, newError("unexpected status", response.StatusCode).AtWarning()
+	}
+
+	bwriter := buf.NewBufferedWriter(pwriter)
+	common.Must(bwriter.SetBuffered(false))
+	return net.NewConnection(
+		net.ConnectionOutput(response.Body),
+		net.ConnectionInput(bwriter),
+		net.ConnectionOnClose(common.ChainedClosable{request.Body, bwriter, response.Body}),
+	), nil
+}
+
+func init() {
+	common.Must(internet.RegisterTransportDialer(protocolName, Dial))
+}
@@ -0,0 +1,3 @@
+package h3
+
+//go:generate go run v2ray.com/core/common/errors/errorgen
@@ -0,0 +1,148 @@
+package h3_test
+
+import (
+	"context"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"v2ray.com/core/common"
+	"v2ray.com/core/common/buf"
+	"v2ray.com/core/common/net"
+	"v2ray.com/core/common/protocol/tls/cert"
+	"v2ray.com/core/testing/servers/udp"
+	"v2ray.com/core/transport/internet"
+	. "v2ray.com/core/transport/internet/h3"
+	"v2ray.com/core/transport/internet/http"
+	"v2ray.com/core/transport/internet/tls"
+)
+
+var certificate = tls.ParseCertificate(cert.MustGenerate(nil, cert.CommonName("www.v2fly.org")))
+
+func echo(conn internet.Connection) {
+	go func() {
+		defer conn.Close()
+
+		b := buf.New()
+		defer b.Release()
+
+		for {
+			if _, err := b.ReadFrom(conn); err != nil {
+				return
+			}
+			_, err := conn.Write(b.Bytes())
+			common.Must(err)
+		}
+	}()
+}
+
+func testEcho(t *testing.T, conn internet.Connection) {
+	const N = 1024
+	b1 := make([]byte, N)
+	common.Must2(rand.Read(b1))
+	b2 := buf.New()
+	defer b2.Release()
+
+	for i := 0; i < 2; i++ {
+		nBytes, err := conn.Write(b1)
+		common.Must(err)
+		if nBytes != N {
+			t.Error("write: ", nBytes)
+		}
+
+		b2.Clear()
+		common.Must2(b2.ReadFullFrom(conn, N))
+		if r := cmp.Diff(b2.Bytes(), b1); r != "" {
+			t.Error(r)
+		}
+	}
+}
+
+func TestHTTP3Connection(t *testing.T) {
+	port := udp.PickPort()
+
+	listener, err := Listen(context.Background(), net.LocalHostIP, port, &internet.MemoryStreamConfig{
+		ProtocolName:     "h3",
+		ProtocolSettings: &Config{Path: "/h3"},
+		SecurityType:     "tls",
+		SecuritySettings: &tls.Config{
+			Certificate: []*tls.Certificate{certificate},
+		},
+	}, echo)
+	common.Must(err)
+	defer listener.Close()
+
+	for _, zeroRTT := range []bool{false, true} {
+		conn, err := Dial(context.Background(), net.UDPDestination(net.LocalHostIP, port), &internet.MemoryStreamConfig{
+			ProtocolName:     "h3",
+			ProtocolSettings: &Config{Path: "/h3", ZeroRtt: zeroRTT},
+			SecurityType:     "tls",
+			SecuritySettings: &tls.Config{
+				ServerName:    "www.v2fly.org",
+				AllowInsecure: true,
+			},
+		})
+		common.Must(err)
+		testEcho(t, conn)
+		conn.Close()
+	}
+
+	if _, err := Dial(context.Background(), net.UDPDestination(net.LocalHostIP, port), &internet.MemoryStreamConfig{
+		ProtocolName:     "h3",
+		ProtocolSettings: &Config{Path: "/h2"},
+		SecurityType:     "tls",
+		SecuritySettings: &tls.Config{
+			ServerName:    "www.v2fly.org",
+			AllowInsecure: true,
+		},
+	}); err == nil {
+		t.Error("dialed with wrong path")
+	}
+}
+
+func TestHTTP3FallbackToH2(t *testing.T) {
+	port := udp.PickPort()
+
+	// QUIC packets are dropped silently by the socket, as if UDP were blocked.
+	blackhole, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.LocalHostIP.IP(), Port: int(port)})
+	common.Must(err)
+	defer blackhole.Close()
+
+	listener, err := http.Listen(context.Background(), net.LocalHostIP, port, &internet.MemoryStreamConfig{
+		ProtocolName:     "http",
+		ProtocolSettings: &http.Config{Path: "/h3"},
+		SecurityType:     "tls",
+		SecuritySettings: &tls.Config{
+			Certificate: []*tls.Certificate{certificate},
+		},
+	}, echo)
+	common.Must(err)
+	defer listener.Close()
+
+	time.Sleep(time.Second)
+
+	streamSettings := &internet.MemoryStreamConfig{
+		ProtocolName:     "h3",
+		ProtocolSettings: &Config{Path: "/h3", H2Fallback: true},
+		SecurityType:     "tls",
+		SecuritySettings: &tls.Config{
+			ServerName:    "www.v2fly.org",
+			AllowInsecure: true,
+		},
+	}
+	for i := 0; i < 2; i++ {
+		start := time.Now()
+		ctx := internet.ContextWithHandshakeTimeout(context.Background(), time.Second)
+		conn, err := Dial(ctx, net.UDPDestination(net.LocalHostIP, port), streamSettings)
+		common.Must(err)
+		testEcho(t, conn)
+		conn.Close()
+
+		// HTTP/3 is not tried again for a while after it fails.
+		if i > 0 && time.Since(start) > time.Second {
+			t.Error("HTTP/3 is dialed again: ", time.Since(start))
+		}
+	}
+}
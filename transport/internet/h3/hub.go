@@ -0,0 +1,186 @@
+// +build !confonly
+
+package h3
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/http3"
+
+	"v2ray.com/core/common"
+	"v2ray.com/core/common/net"
+	http_proto "v2ray.com/core/common/protocol/http"
+	"v2ray.com/core/common/session"
+	"v2ray.com/core/common/signal/done"
+	"v2ray.com/core/transport/internet"
+	v2http "v2ray.com/core/transport/internet/http"
+	"v2ray.com/core/transport/internet/tls"
+)
+
+type Listener struct {
+	server  *http3.Server
+	rawConn net.PacketConn
+	h2      internet.Listener
+	handler internet.ConnHandler
+	local   net.Addr
+	config  *Config
+}
+
+func (l *Listener) Addr() net.Addr {
+	return l.local
+}
+
+func (l *Listener) Close() error {
+	var errs []error
+	if err := l.server.Close(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := l.rawConn.Close(); err != nil {
+		errs = append(errs, err)
+	}
+	if l.h2 != nil {
+		if err := l.h2.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return newError("failed to close listener").Base(errs[0])
+	}
+	return nil
+}
+
+type flushWriter struct {
+	w io.Writer
+	d *done.Instance
+}
+
+func (fw flushWriter) Write(p []byte) (n int, err error) {
+	if fw.d.Done() {
+		return 0, io.ErrClosedPipe
+	}
+
+	n, err = fw.w.Write(p)
+	if f, ok := fw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return
+}
+
+func (l *Listener) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	host := request.Host
+	if !l.config.isValidHost(host) {
+		writer.WriteHeader(404)
+		return
+	}
+	path := l.config.getNormalizedPath()
+	if !strings.HasPrefix(request.URL.Path, path) {
+		writer.WriteHeader(404)
+		return
+	}
+
+	writer.Header().Set("Cache-Control", "no-store")
+	writer.WriteHeader(200)
+	if f, ok := writer.(http.Flusher); ok {
+		f.Flush()
+	}
+
+	remoteAddr := l.Addr()
+	dest, err := net.ParseDestination(request.RemoteAddr)
+	if err != nil {
+		newError("failed to parse request remote addr: ", request.RemoteAddr).Base(err).WriteToLog()
+	} else {
+		remoteAddr = &net.UDPAddr{
+			IP:   dest.Address.IP(),
+			Port: int(dest.Port),
+		}
+	}
+
+	forwardedAddress := http_proto.ParseXForwardedFor(request.Header)
+	if len(forwardedAddress) > 0 && forwardedAddress[0].Family().IsIP() {
+		remoteAddr = &net.TCPAddr{
+			IP:   forwardedAddress[0].IP(),
+			Port: 0,
+		}
+	}
+
+	done := done.New()
+	conn := net.NewConnection(
+		net.ConnectionOutput(request.Body),
+		net.ConnectionInput(flushWriter{w: writer, d: done}),
+		net.ConnectionOnClose(common.ChainedClosable{done, request.Body}),
+		net.ConnectionLocalAddr(l.Addr()),
+		net.ConnectionRemoteAddr(remoteAddr),
+	)
+	l.handler(conn)
+	<-done.Wait()
+}
+
+func Listen(ctx context.Context, address net.Address, port net.Port, streamSettings *internet.MemoryStreamConfig, handler internet.ConnHandler) (internet.Listener, error) {
+	if port == net.Port(0) { // unix
+		return nil, newError("unix domain socket is not supported by HTTP/3 transport")
+	}
+	h3Settings := streamSettings.ProtocolSettings.(*Config)
+	config := tls.ConfigFromStreamSettings(streamSettings)
+	if config == nil {
+		return nil, newError("TLS must be enabled for HTTP/3 transport.")
+	}
+
+	rawConn, err := internet.ListenSystemPacket(ctx, &net.UDPAddr{
+		IP:   address.IP(),
+		Port: int(port),
+	}, streamSettings.SocketSettings)
+	if err != nil {
+		return nil, newError("failed to listen on ", address, ":", port).Base(err)
+	}
+
+	listener := &Listener{
+		rawConn: rawConn,
+		handler: handler,
+		local:   rawConn.LocalAddr(),
+		config:  h3Settings,
+	}
+	listener.server = &http3.Server{
+		Server: &http.Server{
+			TLSConfig: config.GetTLSConfig(),
+			Handler:   listener,
+		},
+		QuicConfig: &quic.Config{
+			MaxIdleTimeout: time.Second * 30,
+		},
+	}
+
+	if h3Settings.H2Fallback {
+		h2, err := v2http.Listen(ctx, address, port, &internet.MemoryStreamConfig{
+			ProtocolName: "http",
+			ProtocolSettings: &v2http.Config{
+				Host: h3Settings.Host,
+				Path: h3Settings.Path,
+			},
+			SecurityType:     streamSettings.SecurityType,
+			SecuritySettings: streamSettings.SecuritySettings,
+			SocketSettings:   streamSettings.SocketSettings,
+		}, handler)
+		if err != nil {
+			rawConn.Close()
+			return nil, newError("failed to listen HTTP/2 for fallback").Base(err)
+		}
+		listener.h2 = h2
+	}
+
+	go func() {
+		if err := listener.server.Serve(rawConn); err != nil {
+			newError("stopping serving HTTP/3").Base(err).WriteToLog(session.ExportIDToError(ctx))
+		}
+	}()
+
+	return listener, nil
+}
+
+func init() {
+	common.Must(internet.RegisterTransportListener(protocolName, Listen))
+}
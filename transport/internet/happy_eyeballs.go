@@ -0,0 +1,155 @@
+package internet
+
+import (
+	"context"
+	"time"
+
+	"v2ray.com/core/common/net"
+)
+
+// happyEyeballsDelay is the head start of a connection attempt before the next address is tried,
+// as recommended by RFC 8305.
+const happyEyeballsDelay = 250 * time.Millisecond
+
+type fallbackIPs struct {
+	primary net.IP
+	ips     []net.IP
+}
+
+// ContextWithFallbackIPs returns a context carrying other addresses of a host, when it is dialed
+// by the primary address. Unless Happy Eyeballs is disabled, the system dialer races them against the
+// primary address.
+func ContextWithFallbackIPs(ctx context.Context, primary net.IP, ips []net.IP) context.Context {
+	return context.WithValue(ctx, fallbackIPsKey, &fallbackIPs{
+		primary: primary,
+		ips:     ips,
+	})
+}
+
+func fallbackIPsFromContext(ctx context.Context, primary net.IP) []net.IP {
+	fallback, ok := ctx.Value(fallbackIPsKey).(*fallbackIPs)
+	if !ok || !fallback.primary.Equal(primary) {
+		return nil
+	}
+	return fallback.ips
+}
+
+// happyEyeballsAddresses returns the addresses to race for dest, in the order they are tried. They
+// are the fallback addresses of the resolver of the outbound, so domains are not resolved here. The
+// primary address doesn't go first, as it is picked at random by resolvers.
+func happyEyeballsAddresses(ctx context.Context, dest net.Destination, src net.Addr) []net.IP {
+	if !dest.Address.Family().IsIP() {
+		return nil
+	}
+	ips := []net.IP{dest.Address.IP()}
+	for _, ip := range fallbackIPsFromContext(ctx, dest.Address.IP()) {
+		if !ip.Equal(dest.Address.IP()) {
+			ips = append(ips, ip)
+		}
+	}
+
+	// A bound source address only works with addresses of its own family.
+	if tcpAddr, ok := src.(*net.TCPAddr); ok && tcpAddr != nil {
+		isIPv4 := tcpAddr.IP.To4() != nil
+		var filtered []net.IP
+		for _, ip := range ips {
+			if (ip.To4() != nil) == isIPv4 {
+				filtered = append(filtered, ip)
+			}
+		}
+		ips = filtered
+	}
+
+	return interleaveFamilies(ips)
+}
+
+// interleaveFamilies reorders addresses so that the two families alternate, starting with IPv6 as
+// preferred by RFC 6724. Addresses of each family keep their order.
+func interleaveFamilies(ips []net.IP) []net.IP {
+	if len(ips) == 0 {
+		return ips
+	}
+	var primaries, fallbacks []net.IP
+	for _, ip := range ips {
+		if ip.To4() == nil {
+			primaries = append(primaries, ip)
+		} else {
+			fallbacks = append(fallbacks, ip)
+		}
+	}
+
+	result := make([]net.IP, 0, len(ips))
+	for len(primaries) > 0 || len(fallbacks) > 0 {
+		if len(primaries) > 0 {
+			result = append(result, primaries[0])
+			primaries = primaries[1:]
+		}
+		if len(fallbacks) > 0 {
+			result = append(result, fallbacks[0])
+			fallbacks = fallbacks[1:]
+		}
+	}
+	return result
+}
+
+type dialResult struct {
+	conn net.Conn
+	err  error
+}
+
+// dialHappyEyeballs starts a connection attempt to each address in order, giving every attempt a
+// head start of delay, or until it fails. The first established connection wins and the other
+// attempts are canceled.
+func dialHappyEyeballs(ctx context.Context, dial func(ctx context.Context, address string) (net.Conn, error), ips []net.IP, port net.Port, delay time.Duration) (net.Conn, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan dialResult, len(ips))
+	next := 0
+	pending := 0
+	var headStart <-chan time.Time
+
+	startNext := func() {
+		address := net.TCPDestination(net.IPAddress(ips[next]), port).NetAddr()
+		next++
+		pending++
+		go func() {
+			conn, err := dial(ctx, address)
+			results <- dialResult{conn: conn, err: err}
+		}()
+		headStart = nil
+		if next < len(ips) {
+			headStart = time.After(delay)
+		}
+	}
+
+	startNext()
+
+	var firstErr error
+	for pending > 0 {
+		select {
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				go func(n int) {
+					for i := 0; i < n; i++ {
+						if r := <-results; r.conn != nil {
+							r.conn.Close()
+						}
+					}
+				}(pending)
+				return r.conn, nil
+			}
+			if firstErr == nil {
+				firstErr = r.err
+			}
+			if next < len(ips) {
+				startNext()
+			}
+		case <-headStart:
+			startNext()
+		}
+	}
+
+	return nil, firstErr
+}
@@ -18,6 +18,24 @@ func pickString(arr []string) string {
 	}
 }
 
+// AllRequests returns the templates of requests, which are the request followed by the alternative ones.
+func (c *Config) AllRequests() []*RequestConfig {
+	var requests []*RequestConfig
+	if c.Request != nil {
+		requests = append(requests, c.Request)
+	}
+	return append(requests, c.AlternativeRequest...)
+}
+
+// PickRequest returns one of the templates of requests at random, or nil if there is none.
+func (c *Config) PickRequest() *RequestConfig {
+	requests := c.AllRequests()
+	if len(requests) == 0 {
+		return nil
+	}
+	return requests[dice.Roll(len(requests))]
+}
+
 func (v *RequestConfig) PickURI() string {
 	return pickString(v.Uri)
 }
@@ -54,23 +54,93 @@ func (NoOpWriter) Write(io.Writer) error {
 }
 
 type HeaderReader struct {
-	req            *http.Request
-	expectedHeader *RequestConfig
+	req              *http.Request
+	expectedRequests []*RequestConfig
+	expectResponse   bool
 }
 
 func (h *HeaderReader) ExpectThisRequest(expectedHeader *RequestConfig) *HeaderReader {
-	h.expectedHeader = expectedHeader
+	return h.ExpectRequests(expectedHeader)
+}
+
+// ExpectRequests makes the reader accept requests to the URIs of any of the given requests only.
+func (h *HeaderReader) ExpectRequests(expectedHeaders ...*RequestConfig) *HeaderReader {
+	h.expectedRequests = nil
+	for _, header := range expectedHeaders {
+		if header != nil {
+			h.expectedRequests = append(h.expectedRequests, header)
+		}
+	}
+	return h
+}
+
+// ExpectResponse makes the reader read a response instead of a request. Any HTTP/1.x response is
+// accepted, so that the connection works even if the response of the server differs from the
+// configured one, for example in its status or headers.
+func (h *HeaderReader) ExpectResponse() *HeaderReader {
+	h.expectResponse = true
 	return h
 }
 
+// checkPartialHeader returns an error if the header read so far can't be the start of a valid one.
+func (h *HeaderReader) checkPartialHeader(header []byte) error {
+	if h.expectResponse {
+		line := header
+		if n := bytes.Index(header, []byte(CRLF)); n != -1 {
+			line = header[:n]
+		}
+		prefix := []byte("HTTP/1.")
+		if len(line) < len(prefix) {
+			prefix = prefix[:len(line)]
+		}
+		if !bytes.HasPrefix(line, prefix) {
+			return ErrHeaderMisMatch
+		}
+		return nil
+	}
+	if _, err := readRequest(bufio.NewReader(bytes.NewReader(header)), false); err != io.ErrUnexpectedEOF {
+		return err
+	}
+	return nil
+}
+
+func (h *HeaderReader) checkHeader(header []byte) error {
+	if h.expectResponse {
+		if _, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(header)), nil); err != nil {
+			return ErrHeaderMisMatch
+		}
+		return nil
+	}
+
+	if len(h.expectedRequests) == 0 {
+		return nil
+	}
+
+	// Parse the request
+	if req, err := readRequest(bufio.NewReader(bytes.NewReader(header)), false); err != nil {
+		return err
+	} else { // nolint: golint
+		h.req = req
+	}
+
+	// Check req
+	path := h.req.URL.Path
+	for _, expected := range h.expectedRequests {
+		for _, u := range expected.Uri {
+			if u == path {
+				return nil
+			}
+		}
+	}
+	return ErrHeaderMisMatch
+}
+
 func (h *HeaderReader) Read(reader io.Reader) (*buf.Buffer, error) {
 	buffer := buf.New()
-	totalBytes := int32(0)
-	endingDetected := false
 
 	var headerBuf bytes.Buffer
 
-	for totalBytes < maxHeaderLength {
+	for {
 		_, err := buffer.ReadFrom(reader)
 		if err != nil {
 			buffer.Release()
@@ -79,54 +149,29 @@ func (h *HeaderReader) Read(reader io.Reader) (*buf.Buffer, error) {
 		if n := bytes.Index(buffer.Bytes(), []byte(ENDING)); n != -1 {
 			headerBuf.Write(buffer.BytesRange(0, int32(n+len(ENDING))))
 			buffer.Advance(int32(n + len(ENDING)))
-			endingDetected = true
 			break
 		}
+		// The ending may be split between reads, so its possible start is kept in the buffer.
 		lenEnding := int32(len(ENDING))
 		if buffer.Len() >= lenEnding {
-			totalBytes += buffer.Len() - lenEnding
 			headerBuf.Write(buffer.BytesRange(0, buffer.Len()-lenEnding))
 			leftover := buffer.BytesFrom(-lenEnding)
 			buffer.Clear()
 			copy(buffer.Extend(lenEnding), leftover)
-
-			if _, err := readRequest(bufio.NewReader(bytes.NewReader(headerBuf.Bytes())), false); err != io.ErrUnexpectedEOF {
-				return nil, err
-			}
 		}
-	}
-
-	if !endingDetected {
-		buffer.Release()
-		return nil, ErrHeaderToLong
-	}
-
-	if h.expectedHeader == nil {
-		if buffer.IsEmpty() {
+		if headerBuf.Len() >= maxHeaderLength {
 			buffer.Release()
-			return nil, nil
+			return nil, ErrHeaderToLong
 		}
-		return buffer, nil
-	}
-
-	// Parse the request
-	if req, err := readRequest(bufio.NewReader(bytes.NewReader(headerBuf.Bytes())), false); err != nil {
-		return nil, err
-	} else { // nolint: golint
-		h.req = req
-	}
-
-	// Check req
-	path := h.req.URL.Path
-	hasThisURI := false
-	for _, u := range h.expectedHeader.Uri {
-		if u == path {
-			hasThisURI = true
+		if err := h.checkPartialHeader(headerBuf.Bytes()); err != nil {
+			buffer.Release()
+			return nil, err
 		}
 	}
 
-	if !hasThisURI {
-		return nil, ErrHeaderMisMatch
+	if err := h.checkHeader(headerBuf.Bytes()); err != nil {
+		buffer.Release()
+		return nil, err
 	}
 
 	if buffer.IsEmpty() {
@@ -263,7 +308,7 @@ type Authenticator struct {
 
 func (a Authenticator) GetClientWriter() *HeaderWriter {
 	header := buf.New()
-	config := a.config.Request
+	config := a.config.PickRequest()
 	common.Must2(header.WriteString(strings.Join([]string{config.GetMethodValue(), config.PickURI(), config.GetFullVersion()}, " ")))
 	common.Must2(header.WriteString(CRLF))
 
@@ -283,12 +328,13 @@ func (a Authenticator) GetServerWriter() *HeaderWriter {
 }
 
 func (a Authenticator) Client(conn net.Conn) net.Conn {
-	if a.config.Request == nil && a.config.Response == nil {
+	requests := a.config.AllRequests()
+	if len(requests) == 0 && a.config.Response == nil {
 		return conn
 	}
 	var reader Reader = NoOpReader{}
-	if a.config.Request != nil {
-		reader = new(HeaderReader)
+	if len(requests) > 0 {
+		reader = new(HeaderReader).ExpectResponse()
 	}
 
 	var writer Writer = NoOpWriter{}
@@ -299,10 +345,11 @@ func (a Authenticator) Client(conn net.Conn) net.Conn {
 }
 
 func (a Authenticator) Server(conn net.Conn) net.Conn {
-	if a.config.Request == nil && a.config.Response == nil {
+	requests := a.config.AllRequests()
+	if len(requests) == 0 && a.config.Response == nil {
 		return conn
 	}
-	return NewConn(conn, new(HeaderReader).ExpectThisRequest(a.config.Request), a.GetServerWriter(),
+	return NewConn(conn, new(HeaderReader).ExpectRequests(requests...), a.GetServerWriter(),
 		formResponseHeader(resp400),
 		formResponseHeader(resp404),
 		formResponseHeader(resp400))
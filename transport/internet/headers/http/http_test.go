@@ -5,8 +5,11 @@ import (
 	"bytes"
 	"context"
 	"crypto/rand"
+	"io"
+	"io/ioutil"
 	"strings"
 	"testing"
+	"testing/iotest"
 	"time"
 
 	"v2ray.com/core/common"
@@ -303,3 +306,109 @@ func TestConnectionInvReq(t *testing.T) {
 		t.Error("Resp to non http conn", string(l))
 	}
 }
+
+func TestFragmentedResponse(t *testing.T) {
+	response := "HTTP/1.1 404 Not Found\r\nContent-Length: 0\r\nConnection: keep-alive\r\n\r\npayload"
+	reader := strings.NewReader(response)
+
+	buffer, err := new(HeaderReader).ExpectResponse().Read(iotest.OneByteReader(reader))
+	common.Must(err)
+	if buffer != nil {
+		t.Error("unexpected payload: ", buffer.String())
+	}
+	if rest, _ := ioutil.ReadAll(reader); string(rest) != "payload" {
+		t.Error("payload: ", string(rest))
+	}
+}
+
+func TestResponseMismatch(t *testing.T) {
+	for _, header := range []string{
+		"GET / HTTP/1.1\r\nHost: www.v2ray.com\r\n\r\n",
+		"HTTP/2.0 200 OK\r\n\r\n",
+		"HTTP/1.1 OK\r\n\r\n",
+	} {
+		_, err := new(HeaderReader).ExpectResponse().Read(iotest.OneByteReader(strings.NewReader(header)))
+		if err != ErrHeaderMisMatch {
+			t.Error("expect mismatch for ", header, ", but got ", err)
+		}
+	}
+}
+
+func TestAlternativeRequest(t *testing.T) {
+	response := &ResponseConfig{
+		Status: &Status{
+			Code:   "200",
+			Reason: "OK",
+		},
+	}
+	auth, err := NewAuthenticator(context.Background(), &Config{
+		Request: &RequestConfig{
+			Uri: []string{"/a"},
+		},
+		AlternativeRequest: []*RequestConfig{
+			{
+				Uri: []string{"/b"},
+			},
+		},
+		Response: response,
+	})
+	common.Must(err)
+
+	uris := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		cache := buf.New()
+		common.Must(auth.GetClientWriter().Write(cache))
+		uris[cache.String()] = true
+		cache.Release()
+	}
+	if len(uris) != 2 {
+		t.Error("requests: ", uris)
+	}
+
+	// A client of one template only, which receives a response different from the configured one.
+	authB, err := NewAuthenticator(context.Background(), &Config{
+		Request: &RequestConfig{
+			Uri: []string{"/b"},
+		},
+		Response: &ResponseConfig{
+			Status: &Status{
+				Code:   "404",
+				Reason: "Not Found",
+			},
+		},
+	})
+	common.Must(err)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	common.Must(err)
+	defer listener.Close()
+
+	go func() {
+		conn, err := listener.Accept()
+		common.Must(err)
+		authConn := auth.Server(conn)
+		b := make([]byte, 256)
+		for {
+			n, err := authConn.Read(b)
+			if err != nil {
+				authConn.Close()
+				break
+			}
+			_, err = authConn.Write(b[:n])
+			common.Must(err)
+		}
+	}()
+
+	conn, err := net.DialTCP("tcp", nil, listener.Addr().(*net.TCPAddr))
+	common.Must(err)
+
+	authConn := authB.Client(conn)
+	defer authConn.Close()
+
+	common.Must2(authConn.Write([]byte("Test payload")))
+	actualResponse := make([]byte, 12)
+	common.Must2(io.ReadFull(authConn, actualResponse))
+	if string(actualResponse) != "Test payload" {
+		t.Error("response: ", string(actualResponse))
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"net/http"
 	"net/url"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"golang.org/x/net/http2"
 	"v2ray.com/core/common"
@@ -18,49 +20,125 @@ import (
 	"v2ray.com/core/transport/pipe"
 )
 
+// dialerConf identifies a cached client. The TLS settings belong to the stream settings of a handler,
+// so that handlers, possibly of different instances, do not share clients.
+type dialerConf struct {
+	net.Destination
+	*tls.Config
+}
+
+// recycleCheckInterval is how often a recycled client closes its connections that have no more streams.
+const recycleCheckInterval = 10 * time.Second
+
+// cachedClient is an HTTP/2 client shared by the sessions to a destination.
+type cachedClient struct {
+	// bytes is the traffic of the connections of the client.
+	bytes     uint64
+	conns     int32
+	client    *http.Client
+	transport *http2.Transport
+	created   time.Time
+	recycle   *internet.ConnectionRecycle
+}
+
+// closeWhenIdle closes the connections of the client after their streams end.
+func (c *cachedClient) closeWhenIdle() {
+	for {
+		c.transport.CloseIdleConnections()
+		if atomic.LoadInt32(&c.conns) == 0 {
+			return
+		}
+		time.Sleep(recycleCheckInterval)
+	}
+}
+
+// countingConn counts the traffic of a connection of a cached client.
+type countingConn struct {
+	net.Conn
+	client *cachedClient
+	closed int32
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	atomic.AddUint64(&c.client.bytes, uint64(n))
+	return n, err
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	atomic.AddUint64(&c.client.bytes, uint64(n))
+	return n, err
+}
+
+func (c *countingConn) Close() error {
+	if atomic.CompareAndSwapInt32(&c.closed, 0, 1) {
+		atomic.AddInt32(&c.client.conns, -1)
+	}
+	return c.Conn.Close()
+}
+
 var (
-	globalDialerMap    map[net.Destination]*http.Client
+	globalDialerMap    map[dialerConf]*cachedClient
 	globalDialerAccess sync.Mutex
 )
 
+// getHTTPClient returns the client to dest. Clients are recycled by the ConnectionRecycle of ctx, after which
+// their connections take no new streams, and are closed when their streams end.
 func getHTTPClient(ctx context.Context, dest net.Destination, tlsSettings *tls.Config) *http.Client {
 	globalDialerAccess.Lock()
 	defer globalDialerAccess.Unlock()
 
 	if globalDialerMap == nil {
-		globalDialerMap = make(map[net.Destination]*http.Client)
+		globalDialerMap = make(map[dialerConf]*cachedClient)
 	}
 
-	if client, found := globalDialerMap[dest]; found {
-		return client
+	key := dialerConf{dest, tlsSettings}
+	if cached, found := globalDialerMap[key]; found {
+		if !cached.recycle.Expired(cached.created, atomic.LoadUint64(&cached.bytes)) {
+			return cached.client
+		}
+		delete(globalDialerMap, key)
+		cached.recycle.Recycled()
+		go cached.closeWhenIdle()
+	}
+
+	cached := &cachedClient{
+		created: time.Now(),
+		recycle: internet.ConnectionRecycleFromContext(ctx),
 	}
 
 	transport := &http2.Transport{
 		DialTLS: func(network string, addr string, tlsConfig *gotls.Config) (net.Conn, error) {
-			rawHost, rawPort, err := net.SplitHostPort(addr)
-			if err != nil {
-				return nil, err
-			}
-			if len(rawPort) == 0 {
-				rawPort = "443"
-			}
-			port, err := net.PortFromString(rawPort)
-			if err != nil {
-				return nil, err
+			target := dest
+			if _, isUnix := dest.UnixPath(); !isUnix {
+				rawHost, rawPort, err := net.SplitHostPort(addr)
+				if err != nil {
+					return nil, err
+				}
+				if len(rawPort) == 0 {
+					rawPort = "443"
+				}
+				port, err := net.PortFromString(rawPort)
+				if err != nil {
+					return nil, err
+				}
+				target = net.TCPDestination(net.ParseAddress(rawHost), port)
 			}
-			address := net.ParseAddress(rawHost)
 
-			pconn, err := internet.DialSystem(ctx, net.TCPDestination(address, port), nil)
+			pconn, err := internet.DialSystem(ctx, target, nil)
 			if err != nil {
 				return nil, err
 			}
 
 			cn := gotls.Client(pconn, tlsConfig)
 			if err := cn.Handshake(); err != nil {
+				tlsSettings.ReportVerifyError(tlsConfig.ServerName, err)
 				return nil, err
 			}
 			if !tlsConfig.InsecureSkipVerify {
 				if err := cn.VerifyHostname(tlsConfig.ServerName); err != nil {
+					tlsSettings.ReportVerifyError(tlsConfig.ServerName, err)
 					return nil, err
 				}
 			}
@@ -68,17 +146,18 @@ func getHTTPClient(ctx context.Context, dest net.Destination, tlsSettings *tls.C
 			if p := state.NegotiatedProtocol; p != http2.NextProtoTLS {
 				return nil, newError("http2: unexpected ALPN protocol " + p + "; want q" + http2.NextProtoTLS).AtError()
 			}
-			return cn, nil
+			atomic.AddInt32(&cached.conns, 1)
+			return &countingConn{Conn: cn, client: cached}, nil
 		},
 		TLSClientConfig: tlsSettings.GetTLSConfig(tls.WithDestination(dest)),
 	}
 
-	client := &http.Client{
+	cached.transport = transport
+	cached.client = &http.Client{
 		Transport: transport,
 	}
-
-	globalDialerMap[dest] = client
-	return client
+	globalDialerMap[key] = cached
+	return cached.client
 }
 
 // Dial dials a new TCP connection to the given destination.
@@ -90,6 +169,12 @@ func Dial(ctx context.Context, dest net.Destination, streamSettings *internet.Me
 	}
 	client := getHTTPClient(ctx, dest, tlsConfig)
 
+	host := dest.NetAddr()
+	if _, isUnix := dest.UnixPath(); isUnix {
+		// The socket path is not a valid host. DialTLS connects to dest regardless.
+		host = "localhost"
+	}
+
 	opts := pipe.OptionsFromContext(ctx)
 	preader, pwriter := pipe.New(opts...)
 	breader := &buf.BufferedReader{Reader: preader}
@@ -99,7 +184,7 @@ func Dial(ctx context.Context, dest net.Destination, streamSettings *internet.Me
 		Body:   breader,
 		URL: &url.URL{
 			Scheme: "https",
-			Host:   dest.NetAddr(),
+			Host:   host,
 			Path:   httpSettings.getNormalizedPath(),
 		},
 		Proto:      "HTTP/2",
@@ -8,6 +8,7 @@ import (
 
 	"github.com/google/go-cmp/cmp"
 
+	"v2ray.com/core/app/stats"
 	"v2ray.com/core/common"
 	"v2ray.com/core/common/buf"
 	"v2ray.com/core/common/net"
@@ -92,3 +93,58 @@ func TestHTTPConnection(t *testing.T) {
 		t.Error(r)
 	}
 }
+
+func TestHTTPConnectionRecycle(t *testing.T) {
+	port := tcp.PickPort()
+
+	listener, err := Listen(context.Background(), net.LocalHostIP, port, &internet.MemoryStreamConfig{
+		ProtocolName:     "http",
+		ProtocolSettings: &Config{},
+		SecurityType:     "tls",
+		SecuritySettings: &tls.Config{
+			Certificate: []*tls.Certificate{tls.ParseCertificate(cert.MustGenerate(nil, cert.CommonName("www.v2fly.org")))},
+		},
+	}, func(conn internet.Connection) {
+		go func() {
+			defer conn.Close()
+			buf.Copy(buf.NewReader(conn), buf.NewWriter(conn)) // nolint: errcheck
+		}()
+	})
+	common.Must(err)
+	defer listener.Close()
+
+	time.Sleep(time.Second)
+
+	recycles := new(stats.Counter)
+	ctx := internet.ContextWithConnectionRecycle(context.Background(), &internet.ConnectionRecycle{
+		MaxBytes: 1024,
+		Recycles: recycles,
+	})
+	streamSettings := &internet.MemoryStreamConfig{
+		ProtocolName:     "http",
+		ProtocolSettings: &Config{},
+		SecurityType:     "tls",
+		SecuritySettings: &tls.Config{
+			ServerName:    "www.v2fly.org",
+			AllowInsecure: true,
+		},
+	}
+	// The first connection carries more than the limit, so the second goes to a new client.
+	for i := 0; i < 2; i++ {
+		conn, err := Dial(ctx, net.TCPDestination(net.LocalHostIP, port), streamSettings)
+		common.Must(err)
+		payload := make([]byte, 2048)
+		common.Must2(rand.Read(payload))
+		common.Must2(conn.Write(payload))
+		b := buf.New()
+		common.Must2(b.ReadFullFrom(conn, int32(len(payload))))
+		if r := cmp.Diff(b.Bytes(), payload); r != "" {
+			t.Error(r)
+		}
+		b.Release()
+		conn.Close()
+	}
+	if v := recycles.Value(); v != 1 {
+		t.Error("expected 1 recycled client, but got ", v)
+	}
+}
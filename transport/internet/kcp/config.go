@@ -11,6 +11,14 @@ import (
 
 const protocolName = "mkcp"
 
+const (
+	// protocolVersionOriginal is the protocol of clients and servers without the version setting.
+	protocolVersionOriginal = 1
+	// protocolVersionCookie requires clients to echo a cookie bound to their address and session nonce, before
+	// servers keep any state for them.
+	protocolVersionCookie = 2
+)
+
 // GetMTUValue returns the value of MTU settings.
 func (c *Config) GetMTUValue() uint32 {
 	if c == nil || c.Mtu == nil {
@@ -59,6 +67,11 @@ func (c *Config) GetReadBufferSize() uint32 {
 	return c.ReadBuffer.Size
 }
 
+// GetKeepAliveInterval returns the interval of keep-alive in milli-sec, or 0 if it is disabled.
+func (c *Config) GetKeepAliveInterval() uint32 {
+	return c.GetKeepAlive().GetInterval() * 1000
+}
+
 // GetSecurity returns the security settings.
 func (c *Config) GetSecurity() (cipher.AEAD, error) {
 	if c.Seed != nil {
@@ -67,6 +80,34 @@ func (c *Config) GetSecurity() (cipher.AEAD, error) {
 	return NewSimpleAuthenticator(), nil
 }
 
+// GetProtocolVersion returns the version of the mKCP protocol, or an error if this build doesn't support it.
+func (c *Config) GetProtocolVersion() (uint32, error) {
+	version := c.GetSeed().GetProtocolVersion()
+	switch {
+	case version == 0:
+		return protocolVersionOriginal, nil
+	case version > protocolVersionCookie:
+		return 0, newError("unsupported mKCP protocol version: ", version)
+	}
+	return version, nil
+}
+
+// GetFECEncoder returns a new encoder of forward error correction, or nil if it is disabled.
+func (c *Config) GetFECEncoder() (*FECEncoder, error) {
+	if c.Fec.GetDataShards() == 0 {
+		return nil, nil
+	}
+	return NewFECEncoder(int(c.Fec.DataShards), int(c.Fec.ParityShards))
+}
+
+// GetFECDecoder returns a new decoder of forward error correction, or nil if it is disabled.
+func (c *Config) GetFECDecoder() (*FECDecoder, error) {
+	if c.Fec.GetDataShards() == 0 {
+		return nil, nil
+	}
+	return NewFECDecoder(int(c.Fec.DataShards), int(c.Fec.ParityShards))
+}
+
 func (c *Config) GetPackerHeader() (internet.PacketHeader, error) {
 	if c.HeaderConfig != nil {
 		rawConfig, err := c.HeaderConfig.GetInstance()
@@ -190,6 +190,8 @@ type Connection struct {
 	stateBeginTime   uint32
 	lastIncomingTime uint32
 	lastPingTime     uint32
+	lastDataTime     uint32
+	keepAlive        uint32
 
 	mss       uint32
 	roundTrip *RoundTripInfo
@@ -216,6 +218,7 @@ func NewConnection(meta ConnMetadata, writer PacketWriter, closer io.Closer, con
 		Config:     config,
 		output:     NewRetryableWriter(NewSegmentWriter(writer)),
 		mss:        config.GetMTUValue() - uint32(writer.Overhead()) - DataSegmentOverhead,
+		keepAlive:  config.GetKeepAliveInterval(),
 		roundTrip: &RoundTripInfo{
 			rto:    100,
 			minRtt: config.GetTTIValue(),
@@ -238,8 +241,12 @@ func NewConnection(meta ConnMetadata, writer PacketWriter, closer io.Closer, con
 		},
 		isTerminating,
 		conn.updateTask)
+	pingInterval := uint32(5000) // 5 seconds
+	if conn.keepAlive > 0 {
+		pingInterval = conn.keepAlive
+	}
 	conn.pingUpdater = NewUpdater(
-		5000, // 5 seconds
+		pingInterval,
 		func() bool { return !isTerminated() },
 		isTerminated,
 		conn.updateTask)
@@ -568,6 +575,7 @@ func (c *Connection) Input(segments []Segment) {
 
 		switch seg := seg.(type) {
 		case *DataSegment:
+			atomic.StoreUint32(&c.lastDataTime, current)
 			c.HandleOption(seg.Option)
 			c.receivingWorker.ProcessSegment(seg)
 			if c.receivingWorker.IsDataAvailable() {
@@ -637,12 +645,29 @@ func (c *Connection) flush() {
 	// flush acknowledges
 	c.receivingWorker.Flush(current)
 	c.sendingWorker.Flush(current)
+	if !c.sendingWorker.IsEmpty() {
+		atomic.StoreUint32(&c.lastDataTime, current)
+	}
 
-	if current-atomic.LoadUint32(&c.lastPingTime) >= 3000 {
+	if c.shouldPing(current) {
 		c.Ping(current, CommandPing)
 	}
 }
 
+// shouldPing returns true if a ping is due. With keep-alive, pings are sent after the connection has
+// been idle for the interval, and suspended while data is flowing.
+func (c *Connection) shouldPing(current uint32) bool {
+	lastPing := atomic.LoadUint32(&c.lastPingTime)
+	if c.keepAlive == 0 {
+		return current-lastPing >= 3000
+	}
+	last := lastPing
+	if lastData := atomic.LoadUint32(&c.lastDataTime); lastData > last {
+		last = lastData
+	}
+	return current-last >= c.keepAlive
+}
+
 func (c *Connection) State() State {
 	return State(atomic.LoadInt32((*int32)(&c.state)))
 }
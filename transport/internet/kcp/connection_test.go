@@ -2,9 +2,11 @@ package kcp_test
 
 import (
 	"io"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"v2ray.com/core/common"
 	"v2ray.com/core/common/buf"
 	. "v2ray.com/core/transport/internet/kcp"
 )
@@ -30,6 +32,101 @@ func TestConnectionReadTimeout(t *testing.T) {
 	conn.Terminate()
 }
 
+// segmentLink is the output of a connection, which counts the pings and hands the segments to the peer.
+type segmentLink struct {
+	pings    int32
+	segments chan []byte
+}
+
+func newSegmentLink() *segmentLink {
+	return &segmentLink{segments: make(chan []byte, 1024)}
+}
+
+func (l *segmentLink) Write(b []byte) (int, error) {
+	for payload := b; len(payload) > 0; {
+		seg, extra := ReadSegment(payload)
+		if seg == nil {
+			break
+		}
+		if seg.Command() == CommandPing {
+			atomic.AddInt32(&l.pings, 1)
+		}
+		seg.Release()
+		payload = extra
+	}
+	l.segments <- append([]byte(nil), b...)
+	return len(b), nil
+}
+
+// connect hands the segments written to the link to conn.
+func (l *segmentLink) connect(conn *Connection) {
+	go func() {
+		for b := range l.segments {
+			var segments []Segment
+			for len(b) > 0 {
+				seg, extra := ReadSegment(b)
+				if seg == nil {
+					break
+				}
+				segments = append(segments, seg)
+				b = extra
+			}
+			conn.Input(segments)
+		}
+	}()
+}
+
+func TestConnectionKeepAlive(t *testing.T) {
+	idleLink := newSegmentLink()
+	idle := NewConnection(ConnMetadata{Conversation: 1}, &KCPPacketWriter{
+		Writer: idleLink,
+	}, NoOpCloser(0), &Config{})
+	defer idle.Terminate()
+
+	toServer, toClient := newSegmentLink(), newSegmentLink()
+	client := NewConnection(ConnMetadata{Conversation: 2}, &KCPPacketWriter{
+		Writer: toServer,
+	}, NoOpCloser(0), &Config{KeepAlive: &KeepAlive{Interval: 1}})
+	defer client.Terminate()
+	server := NewConnection(ConnMetadata{Conversation: 2}, &KCPPacketWriter{
+		Writer: toClient,
+	}, NoOpCloser(0), &Config{})
+	defer server.Terminate()
+	toServer.connect(server)
+	toClient.connect(client)
+	received := make(chan error, 1)
+	go func() {
+		b := make([]byte, 100)
+		_, err := io.ReadFull(client, b)
+		received <- err
+	}()
+
+	// Pings are suspended while data is flowing.
+	for i := 0; i < 25; i++ {
+		common.Must2(server.Write([]byte("data")))
+		time.Sleep(time.Millisecond * 100)
+	}
+	if err := <-received; err != nil {
+		t.Fatal("failed to read data: ", err)
+	}
+	if n := atomic.LoadInt32(&toServer.pings); n != 0 {
+		t.Error("unexpected pings while data is flowing: ", n)
+	}
+	// Without keep-alive, an idle connection pings every 5 seconds.
+	if n := atomic.LoadInt32(&idleLink.pings); n != 0 {
+		t.Error("unexpected pings without keep-alive: ", n)
+	}
+
+	// Pings are sent every interval on the idle connection.
+	time.Sleep(time.Millisecond * 2500)
+	if n := atomic.LoadInt32(&toServer.pings); n < 2 {
+		t.Error("expect at least 2 keep-alive pings, but got ", n)
+	}
+	if state := client.State(); state != StateActive {
+		t.Error("unexpected state of the idle connection: ", state)
+	}
+}
+
 func TestConnectionInterface(t *testing.T) {
 	_ = (io.Writer)(new(Connection))
 	_ = (io.Reader)(new(Connection))
@@ -0,0 +1,221 @@
+// +build !confonly
+
+package kcp
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"sync/atomic"
+	"time"
+
+	"v2ray.com/core/common"
+	"v2ray.com/core/common/buf"
+	"v2ray.com/core/common/net"
+	"v2ray.com/core/transport/internet"
+)
+
+const (
+	// cookiePeriod is how long cookies are made with the same time input. Cookies of the previous period
+	// are still accepted, so they are valid for at least this long.
+	cookiePeriod = 30 * time.Second
+	// cookieRetryInterval is how long clients wait for a challenge, before asking again.
+	cookieRetryInterval = 500 * time.Millisecond
+	// defaultCookieTimeout is how long clients ask for cookies, if the dial has no handshake deadline.
+	defaultCookieTimeout = 8 * time.Second
+)
+
+// cookieJar makes and verifies the cookies of a server. Cookies are derived from a secret of the server, the
+// address of the client, and its session, so that servers verify them without keeping state.
+type cookieJar struct {
+	secret [32]byte
+}
+
+func newCookieJar() *cookieJar {
+	j := new(cookieJar)
+	common.Must2(rand.Read(j.secret[:]))
+	return j
+}
+
+func (j *cookieJar) make(src net.Destination, conv uint16, nonce uint32, period int64) [cookieSize]byte {
+	var input [8 + 2 + 4 + 2]byte
+	binary.BigEndian.PutUint64(input[:], uint64(period))
+	binary.BigEndian.PutUint16(input[8:], conv)
+	binary.BigEndian.PutUint32(input[10:], nonce)
+	binary.BigEndian.PutUint16(input[14:], uint16(src.Port))
+
+	mac := hmac.New(sha256.New, j.secret[:])
+	common.Must2(mac.Write(input[:]))
+	common.Must2(mac.Write(src.Address.IP()))
+
+	var cookie [cookieSize]byte
+	copy(cookie[:], mac.Sum(nil))
+	return cookie
+}
+
+func currentCookiePeriod() int64 {
+	return time.Now().UnixNano() / int64(cookiePeriod)
+}
+
+// Challenge returns the answer to the cookie request from src.
+func (j *cookieJar) Challenge(src net.Destination, request *CookieSegment) *CookieSegment {
+	return &CookieSegment{
+		Conv:   request.Conv,
+		Cmd:    CommandCookieChallenge,
+		Nonce:  request.Nonce,
+		Cookie: j.make(src, request.Conv, request.Nonce, currentCookiePeriod()),
+	}
+}
+
+// Verify returns true if the echo from src carries a cookie of the current or the previous period.
+func (j *cookieJar) Verify(src net.Destination, echo *CookieSegment) bool {
+	period := currentCookiePeriod()
+	for _, p := range []int64{period, period - 1} {
+		cookie := j.make(src, echo.Conv, echo.Nonce, p)
+		if hmac.Equal(cookie[:], echo.Cookie[:]) {
+			return true
+		}
+	}
+	return false
+}
+
+func serializeSegment(seg Segment) []byte {
+	b := make([]byte, seg.ByteSize())
+	seg.Serialize(b)
+	return b
+}
+
+// requestCookie asks the server over conn for a cookie of the session, until a challenge arrives or the
+// handshake deadline passes. The exchange has its own FEC state, as the session starts with fresh one.
+func requestCookie(ctx context.Context, conn net.Conn, config *Config, conv uint16, nonce uint32) (*CookieSegment, error) {
+	header, err := config.GetPackerHeader()
+	if err != nil {
+		return nil, newError("failed to create packet header").Base(err)
+	}
+	security, err := config.GetSecurity()
+	if err != nil {
+		return nil, newError("failed to create security").Base(err)
+	}
+	fecEncoder, _ := config.GetFECEncoder()
+	fecDecoder, _ := config.GetFECDecoder()
+	writer := &KCPPacketWriter{
+		Header:   header,
+		Security: security,
+		Writer:   conn,
+		FEC:      fecEncoder,
+	}
+	reader := &KCPPacketReader{
+		Header:   header,
+		Security: security,
+		FEC:      fecDecoder,
+	}
+
+	deadline, ok := internet.HandshakeDeadline(ctx)
+	if !ok {
+		deadline = time.Now().Add(defaultCookieTimeout)
+	}
+	defer conn.SetReadDeadline(time.Time{}) // nolint: errcheck
+
+	request := serializeSegment(&CookieSegment{
+		Conv:  conv,
+		Cmd:   CommandCookieRequest,
+		Nonce: nonce,
+	})
+	payload := buf.New()
+	defer payload.Release()
+
+	for time.Now().Before(deadline) {
+		if _, err := writer.Write(request); err != nil {
+			return nil, newError("failed to request cookie").Base(err)
+		}
+		retry := time.Now().Add(cookieRetryInterval)
+		if retry.After(deadline) {
+			retry = deadline
+		}
+		if err := conn.SetReadDeadline(retry); err != nil {
+			return nil, err
+		}
+		for {
+			payload.Clear()
+			if _, err := payload.ReadFrom(conn); err != nil {
+				if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+					break
+				}
+				return nil, newError("failed to read cookie").Base(err)
+			}
+			for _, seg := range reader.Read(payload.Bytes()) {
+				challenge, ok := seg.(*CookieSegment)
+				if ok && challenge.Cmd == CommandCookieChallenge && challenge.Conv == conv && challenge.Nonce == nonce {
+					return challenge, nil
+				}
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+	}
+	return nil, newError("no cookie from server")
+}
+
+// cookieWriter prepends the echo of the cookie to the packets of a session, until the server answers, so
+// that the server accepts the session whichever packet arrives first.
+type cookieWriter struct {
+	PacketWriter
+	echo        []byte
+	established uint32
+}
+
+func newCookieWriter(writer PacketWriter, challenge *CookieSegment) *cookieWriter {
+	echo := *challenge
+	echo.Cmd = CommandCookieEcho
+	return &cookieWriter{
+		PacketWriter: writer,
+		echo:         serializeSegment(&echo),
+	}
+}
+
+// Overhead implements PacketWriter. Packets leave room for the echo even after the server answers, as
+// segments are sized once for the session.
+func (w *cookieWriter) Overhead() int {
+	return w.PacketWriter.Overhead() + cookieSegmentSize
+}
+
+func (w *cookieWriter) Write(b []byte) (int, error) {
+	if atomic.LoadUint32(&w.established) == 1 {
+		return w.PacketWriter.Write(b)
+	}
+	packet := buf.StackNew()
+	defer packet.Release()
+	common.Must2(packet.Write(w.echo))
+	common.Must2(packet.Write(b))
+	if _, err := w.PacketWriter.Write(packet.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// cookieReader drops the segments of the cookie exchange, such as challenges to repeated requests, and
+// stops the echo once the server answers.
+type cookieReader struct {
+	PacketReader
+	writer *cookieWriter
+}
+
+func (r *cookieReader) Read(b []byte) []Segment {
+	segments := r.PacketReader.Read(b)
+	filtered := segments[:0]
+	for _, seg := range segments {
+		if _, ok := seg.(*CookieSegment); ok {
+			continue
+		}
+		filtered = append(filtered, seg)
+	}
+	if len(filtered) > 0 {
+		atomic.StoreUint32(&r.writer.established, 1)
+	}
+	return filtered
+}
@@ -58,6 +58,11 @@ func DialKCP(ctx context.Context, dest net.Destination, streamSettings *internet
 
 	kcpSettings := streamSettings.ProtocolSettings.(*Config)
 
+	version, err := kcpSettings.GetProtocolVersion()
+	if err != nil {
+		rawConn.Close()
+		return nil, err
+	}
 	header, err := kcpSettings.GetPackerHeader()
 	if err != nil {
 		return nil, newError("failed to create packet header").Base(err)
@@ -66,17 +71,40 @@ func DialKCP(ctx context.Context, dest net.Destination, streamSettings *internet
 	if err != nil {
 		return nil, newError("failed to create security").Base(err)
 	}
-	reader := &KCPPacketReader{
+	fecEncoder, err := kcpSettings.GetFECEncoder()
+	if err != nil {
+		return nil, newError("failed to create FEC encoder").Base(err)
+	}
+	fecDecoder, err := kcpSettings.GetFECDecoder()
+	if err != nil {
+		return nil, newError("failed to create FEC decoder").Base(err)
+	}
+	var reader PacketReader = &KCPPacketReader{
 		Header:   header,
 		Security: security,
+		FEC:      fecDecoder,
 	}
-	writer := &KCPPacketWriter{
+	var writer PacketWriter = &KCPPacketWriter{
 		Header:   header,
 		Security: security,
 		Writer:   rawConn,
+		FEC:      fecEncoder,
 	}
 
 	conv := uint16(atomic.AddUint32(&globalConv, 1))
+	if version >= protocolVersionCookie {
+		challenge, err := requestCookie(ctx, rawConn, kcpSettings, conv, uint32(dice.RollUint64()))
+		if err != nil {
+			rawConn.Close()
+			return nil, newError("failed to get cookie from ", dest).Base(err).AtWarning()
+		}
+		cookieWriter := newCookieWriter(writer, challenge)
+		writer = cookieWriter
+		reader = &cookieReader{
+			PacketReader: reader,
+			writer:       cookieWriter,
+		}
+	}
 	session := NewConnection(ConnMetadata{
 		LocalAddr:    rawConn.LocalAddr(),
 		RemoteAddr:   rawConn.RemoteAddr(),
@@ -88,7 +116,7 @@ func DialKCP(ctx context.Context, dest net.Destination, streamSettings *internet
 	var iConn internet.Connection = session
 
 	if config := tls.ConfigFromStreamSettings(streamSettings); config != nil {
-		iConn = tls.Client(iConn, config.GetTLSConfig(tls.WithDestination(dest)))
+		iConn = config.Client(iConn, tls.WithDestination(dest))
 	}
 
 	return iConn, nil
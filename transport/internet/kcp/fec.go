@@ -0,0 +1,232 @@
+// +build !confonly
+
+package kcp
+
+import (
+	"encoding/binary"
+
+	"v2ray.com/core/common"
+	"v2ray.com/core/common/reedsolomon"
+)
+
+const (
+	fecHeaderSize = 6
+	// fecSizeSize is the size of the length prefix of the payload in data shards.
+	fecSizeSize = 2
+
+	fecTypeData   = 0xf1
+	fecTypeParity = 0xf2
+
+	// maxFECGroups is the number of groups a FECDecoder keeps, so that shards reordered across that many
+	// groups are still used.
+	maxFECGroups = 8
+)
+
+// FECEncoder frames the packets of a connection as data shards, and adds parity packets after every
+// group of them. A packet is a 4-byte sequence number, 2-byte type, and a shard. A data shard is the
+// payload prefixed by its size, and parity shards are computed over data shards padded to the same size.
+type FECEncoder struct {
+	codec   *reedsolomon.Codec
+	next    uint32
+	paws    uint32
+	shards  [][]byte
+	count   int
+	packets [][]byte
+	out     [][]byte
+}
+
+// NewFECEncoder creates a FECEncoder of the given number of shards in each group.
+func NewFECEncoder(dataShards, parityShards int) (*FECEncoder, error) {
+	codec, err := reedsolomon.New(dataShards, parityShards)
+	if err != nil {
+		return nil, err
+	}
+	total := dataShards + parityShards
+	return &FECEncoder{
+		codec: codec,
+		// Sequence numbers wrap at a multiple of the group size, so that groups stay aligned.
+		paws:    0xffffffff / uint32(total) * uint32(total),
+		shards:  make([][]byte, total),
+		packets: make([][]byte, total),
+	}, nil
+}
+
+// Overhead returns the number of bytes the encoder adds to each packet.
+func (e *FECEncoder) Overhead() int {
+	return fecHeaderSize + fecSizeSize
+}
+
+func (e *FECEncoder) packet(idx int, typ uint16) []byte {
+	p := append(e.packets[idx][:0], make([]byte, fecHeaderSize)...)
+	binary.BigEndian.PutUint32(p, e.next+uint32(idx))
+	binary.BigEndian.PutUint16(p[4:], typ)
+	p = append(p, e.shards[idx]...)
+	e.packets[idx] = p
+	return p
+}
+
+// Encode returns the packets to send for the payload, which are the data packet, followed by the parity
+// packets if the payload completes a group. The packets are valid until the next call.
+func (e *FECEncoder) Encode(payload []byte) [][]byte {
+	dataShards := e.codec.DataShards()
+
+	shard := e.shards[e.count][:0]
+	shard = append(shard, byte((len(payload)+fecSizeSize)>>8), byte(len(payload)+fecSizeSize))
+	shard = append(shard, payload...)
+	e.shards[e.count] = shard
+
+	e.out = e.out[:0]
+	e.out = append(e.out, e.packet(e.count, fecTypeData))
+	e.count++
+	if e.count < dataShards {
+		return e.out
+	}
+
+	maxSize := 0
+	for _, s := range e.shards[:dataShards] {
+		if len(s) > maxSize {
+			maxSize = len(s)
+		}
+	}
+	for i := range e.shards {
+		s := e.shards[i]
+		if cap(s) < maxSize {
+			s = append(make([]byte, 0, maxSize), s...)
+		}
+		size := len(s)
+		s = s[:maxSize]
+		for j := size; j < maxSize; j++ {
+			s[j] = 0
+		}
+		e.shards[i] = s
+	}
+	common.Must(e.codec.Encode(e.shards))
+	for i := dataShards; i < len(e.shards); i++ {
+		e.out = append(e.out, e.packet(i, fecTypeParity))
+	}
+	e.count = 0
+	e.next = (e.next + uint32(len(e.shards))) % e.paws
+	return e.out
+}
+
+type fecGroup struct {
+	base   uint32
+	shards [][]byte
+	count  int
+	done   bool
+}
+
+// FECDecoder returns the payloads of data packets from a FECEncoder as they arrive, and recovers lost
+// ones once enough packets of their group arrive. Memory is bounded by the number of groups kept.
+type FECDecoder struct {
+	codec  *reedsolomon.Codec
+	groups []*fecGroup
+}
+
+// NewFECDecoder creates a FECDecoder of the given number of shards in each group.
+func NewFECDecoder(dataShards, parityShards int) (*FECDecoder, error) {
+	codec, err := reedsolomon.New(dataShards, parityShards)
+	if err != nil {
+		return nil, err
+	}
+	return &FECDecoder{
+		codec: codec,
+	}, nil
+}
+
+func (d *FECDecoder) group(base uint32) *fecGroup {
+	for _, g := range d.groups {
+		if g.base == base {
+			return g
+		}
+	}
+	g := &fecGroup{
+		base:   base,
+		shards: make([][]byte, d.codec.DataShards()+d.codec.ParityShards()),
+	}
+	if len(d.groups) == maxFECGroups {
+		copy(d.groups, d.groups[1:])
+		d.groups = d.groups[:maxFECGroups-1]
+	}
+	d.groups = append(d.groups, g)
+	return g
+}
+
+func dataShardPayload(shard []byte) []byte {
+	if len(shard) < fecSizeSize {
+		return nil
+	}
+	size := int(binary.BigEndian.Uint16(shard))
+	if size < fecSizeSize || size > len(shard) {
+		return nil
+	}
+	return shard[fecSizeSize:size]
+}
+
+// Decode returns the payloads delivered by the packet, which are its own payload if it is a data
+// packet, and those recovered from its group.
+func (d *FECDecoder) Decode(packet []byte) [][]byte {
+	if len(packet) <= fecHeaderSize {
+		return nil
+	}
+	seq := binary.BigEndian.Uint32(packet)
+	typ := binary.BigEndian.Uint16(packet[4:])
+	shard := packet[fecHeaderSize:]
+
+	var result [][]byte
+	switch typ {
+	case fecTypeData:
+		payload := dataShardPayload(shard)
+		if payload == nil {
+			return nil
+		}
+		result = append(result, payload)
+	case fecTypeParity:
+	default:
+		return nil
+	}
+
+	dataShards := d.codec.DataShards()
+	total := uint32(dataShards + d.codec.ParityShards())
+	idx := int(seq % total)
+	if (typ == fecTypeData) != (idx < dataShards) {
+		return result
+	}
+	g := d.group(seq - uint32(idx))
+	if g.done || g.shards[idx] != nil {
+		return result
+	}
+	g.shards[idx] = append([]byte(nil), shard...)
+	g.count++
+	if g.count < dataShards {
+		return result
+	}
+
+	g.done = true
+	var missing []int
+	maxSize := 0
+	for i, s := range g.shards {
+		if i < dataShards && s == nil {
+			missing = append(missing, i)
+		}
+		if len(s) > maxSize {
+			maxSize = len(s)
+		}
+	}
+	if len(missing) > 0 {
+		for i, s := range g.shards {
+			if s != nil && len(s) < maxSize {
+				g.shards[i] = append(s, make([]byte, maxSize-len(s))...)
+			}
+		}
+		if err := d.codec.ReconstructData(g.shards); err == nil {
+			for _, i := range missing {
+				if payload := dataShardPayload(g.shards[i]); payload != nil {
+					result = append(result, payload)
+				}
+			}
+		}
+	}
+	g.shards = nil
+	return result
+}
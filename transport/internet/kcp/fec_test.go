@@ -0,0 +1,186 @@
+package kcp_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"v2ray.com/core/common"
+	"v2ray.com/core/common/dice"
+	"v2ray.com/core/common/net"
+	"v2ray.com/core/transport/internet"
+	. "v2ray.com/core/transport/internet/kcp"
+)
+
+func TestFECRecovery(t *testing.T) {
+	encoder, err := NewFECEncoder(4, 2)
+	common.Must(err)
+	decoder, err := NewFECDecoder(4, 2)
+	common.Must(err)
+
+	// Each group has 6 packets. Up to 2 lost packets of a group are recovered.
+	lost := map[int]bool{
+		0: true, 5: true, // group 0: a data packet and a parity packet
+		7: true, 9: true, // group 1: two data packets
+		12: true, 13: true, 14: true, // group 2: too many
+	}
+	var sent, received [][]byte
+	packetIndex := 0
+	for i := 0; i < 12; i++ {
+		payload := make([]byte, 1+dice.Roll(1000))
+		common.Must2(rand.Read(payload))
+		sent = append(sent, payload)
+
+		for _, packet := range encoder.Encode(payload) {
+			if !lost[packetIndex] {
+				for _, p := range decoder.Decode(packet) {
+					received = append(received, append([]byte(nil), p...))
+				}
+			}
+			packetIndex++
+		}
+	}
+
+	// The first 3 payloads of group 2 are lost.
+	expected := append(append([][]byte{}, sent[:8]...), sent[11])
+	if len(received) != len(expected) {
+		t.Fatal("expect ", len(expected), " payloads, but got ", len(received))
+	}
+	for _, e := range expected {
+		found := false
+		for _, r := range received {
+			if bytes.Equal(e, r) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Error("payload of size ", len(e), " is not received")
+		}
+	}
+}
+
+// lossyDialer dials UDP connections that drop the given permille of packets they write.
+type lossyDialer struct {
+	loss int
+}
+
+type lossyConn struct {
+	net.Conn
+	loss int
+}
+
+func (c *lossyConn) Write(b []byte) (int, error) {
+	if dice.Roll(1000) < c.loss {
+		return len(b), nil
+	}
+	return c.Conn.Write(b)
+}
+
+func (d lossyDialer) Dial(ctx context.Context, source net.Address, dest net.Destination, sockopt *internet.SocketConfig) (net.Conn, error) {
+	conn, err := net.DialUDP("udp", nil, &net.UDPAddr{
+		IP:   dest.Address.IP(),
+		Port: int(dest.Port),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &lossyConn{Conn: conn, loss: d.loss}, nil
+}
+
+// listenDiscard listens on mKCP and counts the bytes received.
+func listenDiscard(config *Config, received *int64) (*Listener, error) {
+	return NewListener(context.Background(), net.LocalHostIP, net.Port(0), &internet.MemoryStreamConfig{
+		ProtocolName:     "mkcp",
+		ProtocolSettings: config,
+	}, func(conn internet.Connection) {
+		go func() {
+			payload := make([]byte, 4096)
+			for {
+				n, err := conn.Read(payload)
+				if err != nil {
+					break
+				}
+				atomic.AddInt64(received, int64(n))
+			}
+			conn.Close()
+		}()
+	})
+}
+
+func TestDialAndListenWithFEC(t *testing.T) {
+	config := &Config{
+		Fec:  &FEC{DataShards: 10, ParityShards: 3},
+		Seed: &EncryptionSeed{Seed: "fec"},
+	}
+	listener, err := NewListener(context.Background(), net.LocalHostIP, net.Port(0), &internet.MemoryStreamConfig{
+		ProtocolName:     "mkcp",
+		ProtocolSettings: config,
+	}, func(conn internet.Connection) {
+		go func() {
+			io.Copy(conn, conn)
+			conn.Close()
+		}()
+	})
+	common.Must(err)
+	defer listener.Close()
+
+	port := net.Port(listener.Addr().(*net.UDPAddr).Port)
+	ctx := internet.ContextWithSystemDialer(context.Background(), lossyDialer{loss: 50})
+	conn, err := DialKCP(ctx, net.UDPDestination(net.LocalHostIP, port), &internet.MemoryStreamConfig{
+		ProtocolName:     "mkcp",
+		ProtocolSettings: config,
+	})
+	common.Must(err)
+	defer conn.Close()
+
+	sent := make([]byte, 256*1024)
+	common.Must2(rand.Read(sent))
+	go conn.Write(sent)
+
+	received := make([]byte, len(sent))
+	common.Must2(io.ReadFull(conn, received))
+	if !bytes.Equal(sent, received) {
+		t.Error("data corrupted")
+	}
+}
+
+func BenchmarkUploadWithLoss(b *testing.B) {
+	const size = 512 * 1024
+	for _, loss := range []int{10, 30, 50} {
+		for _, fec := range []*FEC{nil, {DataShards: 10, ParityShards: 3}} {
+			name := fmt.Sprint("loss=", loss/10, "%/fec=", fec.GetDataShards(), "+", fec.GetParityShards())
+			b.Run(name, func(b *testing.B) {
+				config := &Config{Fec: fec}
+				var received int64
+				listener, err := listenDiscard(config, &received)
+				common.Must(err)
+				defer listener.Close()
+
+				port := net.Port(listener.Addr().(*net.UDPAddr).Port)
+				ctx := internet.ContextWithSystemDialer(context.Background(), lossyDialer{loss: loss})
+				conn, err := DialKCP(ctx, net.UDPDestination(net.LocalHostIP, port), &internet.MemoryStreamConfig{
+					ProtocolName:     "mkcp",
+					ProtocolSettings: config,
+				})
+				common.Must(err)
+				defer conn.Close()
+
+				payload := make([]byte, size)
+				b.SetBytes(size)
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					common.Must2(conn.Write(payload))
+					for atomic.LoadInt64(&received) < int64(i+1)*size {
+						time.Sleep(time.Millisecond)
+					}
+				}
+			})
+		}
+	}
+}
@@ -24,9 +24,27 @@ type PacketWriter interface {
 type KCPPacketReader struct { // nolint: golint
 	Security cipher.AEAD
 	Header   internet.PacketHeader
+	// FEC decodes the packets if not nil.
+	FEC *FECDecoder
 }
 
 func (r *KCPPacketReader) Read(b []byte) []Segment {
+	b = r.open(b)
+	if b == nil {
+		return nil
+	}
+	if r.FEC == nil {
+		return readSegments(b)
+	}
+	var result []Segment
+	for _, payload := range r.FEC.Decode(b) {
+		result = append(result, readSegments(payload)...)
+	}
+	return result
+}
+
+// open returns the payload of the packet without its header and encryption, or nil if it is invalid.
+func (r *KCPPacketReader) open(b []byte) []byte {
 	if r.Header != nil {
 		if int32(len(b)) <= r.Header.Size() {
 			return nil
@@ -45,6 +63,10 @@ func (r *KCPPacketReader) Read(b []byte) []Segment {
 		}
 		b = out
 	}
+	return b
+}
+
+func readSegments(b []byte) []Segment {
 	var result []Segment
 	for len(b) > 0 {
 		seg, x := ReadSegment(b)
@@ -61,6 +83,8 @@ type KCPPacketWriter struct { // nolint: golint
 	Header   internet.PacketHeader
 	Security cipher.AEAD
 	Writer   io.Writer
+	// FEC encodes the packets if not nil.
+	FEC *FECEncoder
 }
 
 func (w *KCPPacketWriter) Overhead() int {
@@ -71,10 +95,25 @@ func (w *KCPPacketWriter) Overhead() int {
 	if w.Security != nil {
 		overhead += w.Security.Overhead()
 	}
+	if w.FEC != nil {
+		overhead += w.FEC.Overhead()
+	}
 	return overhead
 }
 
 func (w *KCPPacketWriter) Write(b []byte) (int, error) {
+	if w.FEC == nil {
+		return len(b), w.write(b)
+	}
+	for _, packet := range w.FEC.Encode(b) {
+		if err := w.write(packet); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+func (w *KCPPacketWriter) write(b []byte) error {
 	bb := buf.StackNew()
 	defer bb.Release()
 
@@ -93,5 +132,5 @@ func (w *KCPPacketWriter) Write(b []byte) (int, error) {
 	}
 
 	_, err := w.Writer.Write(bb.Bytes())
-	return len(b), err
+	return err
 }
@@ -1,6 +1,7 @@
 package kcp_test
 
 import (
+	"bytes"
 	"context"
 	"crypto/rand"
 	"io"
@@ -83,3 +84,198 @@ func TestDialAndListen(t *testing.T) {
 		t.Error("active connections: ", v)
 	}
 }
+
+func TestDialAndListenWithCookie(t *testing.T) {
+	streamSettings := &internet.MemoryStreamConfig{
+		ProtocolName: "mkcp",
+		ProtocolSettings: &Config{
+			Seed: &EncryptionSeed{Seed: "test", ProtocolVersion: 2},
+			Fec:  &FEC{DataShards: 4, ParityShards: 1},
+		},
+	}
+	listener, err := NewListener(context.Background(), net.LocalHostIP, net.Port(0), streamSettings, func(conn internet.Connection) {
+		go func(c internet.Connection) {
+			defer c.Close()
+			io.Copy(c, c)
+		}(conn)
+	})
+	common.Must(err)
+	defer listener.Close()
+
+	port := net.Port(listener.Addr().(*net.UDPAddr).Port)
+
+	var errg errgroup.Group
+	for i := 0; i < 4; i++ {
+		errg.Go(func() error {
+			conn, err := DialKCP(context.Background(), net.UDPDestination(net.LocalHostIP, port), streamSettings)
+			if err != nil {
+				return err
+			}
+			defer conn.Close()
+
+			sent := make([]byte, 64*1024)
+			common.Must2(rand.Read(sent))
+			go conn.Write(sent)
+
+			received := make([]byte, len(sent))
+			if _, err := io.ReadFull(conn, received); err != nil {
+				return err
+			}
+			if r := cmp.Diff(received, sent); r != "" {
+				return errors.New(r)
+			}
+			return nil
+		})
+	}
+	if err := errg.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 60 && listener.ActiveConnections() > 0; i++ {
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+func TestListenerVerifiesCookie(t *testing.T) {
+	config := &Config{
+		Seed: &EncryptionSeed{Seed: "test", ProtocolVersion: 2},
+	}
+	listener, err := NewListener(context.Background(), net.LocalHostIP, net.Port(0), &internet.MemoryStreamConfig{
+		ProtocolName:     "mkcp",
+		ProtocolSettings: config,
+	}, func(conn internet.Connection) {})
+	common.Must(err)
+	defer listener.Close()
+
+	conn, err := net.DialUDP("udp", nil, listener.Addr().(*net.UDPAddr))
+	common.Must(err)
+	defer conn.Close()
+
+	security, err := config.GetSecurity()
+	common.Must(err)
+	reader := &KCPPacketReader{Security: security}
+	send := func(segments ...Segment) int {
+		var payload []byte
+		for _, seg := range segments {
+			b := make([]byte, seg.ByteSize())
+			seg.Serialize(b)
+			payload = append(payload, b...)
+		}
+		var packet bytes.Buffer
+		writer := &KCPPacketWriter{Security: security, Writer: &packet}
+		common.Must2(writer.Write(payload))
+		common.Must2(conn.Write(packet.Bytes()))
+		return packet.Len()
+	}
+	receive := func(timeout time.Duration) ([]byte, error) {
+		b := make([]byte, 2048)
+		common.Must(conn.SetReadDeadline(time.Now().Add(timeout)))
+		n, err := conn.Read(b)
+		return b[:n], err
+	}
+	ping := &CmdOnlySegment{Conv: 1, Cmd: CommandPing}
+
+	// Packets without cookies are dropped silently.
+	send(ping)
+	if _, err := receive(time.Millisecond * 500); err == nil {
+		t.Fatal("expected no answer without cookie")
+	}
+
+	// Challenges are no larger than requests.
+	requestSize := send(&CookieSegment{Conv: 1, Cmd: CommandCookieRequest, Nonce: 7})
+	packet, err := receive(time.Second * 2)
+	common.Must(err)
+	if len(packet) > requestSize {
+		t.Error("challenge of ", len(packet), " bytes for request of ", requestSize, " bytes")
+	}
+	segments := reader.Read(packet)
+	if len(segments) != 1 {
+		t.Fatal("unexpected challenge: ", segments)
+	}
+	challenge, ok := segments[0].(*CookieSegment)
+	if !ok || challenge.Cmd != CommandCookieChallenge || challenge.Nonce != 7 {
+		t.Fatal("unexpected challenge: ", segments[0])
+	}
+
+	forged := &CookieSegment{Conv: 1, Cmd: CommandCookieEcho, Nonce: 8, Cookie: challenge.Cookie}
+	send(forged, ping)
+	time.Sleep(time.Millisecond * 500)
+	if v := listener.ActiveConnections(); v != 0 {
+		t.Error("active connections with forged cookie: ", v)
+	}
+
+	echo := *challenge
+	echo.Cmd = CommandCookieEcho
+	send(&echo, ping)
+	for i := 0; i < 10 && listener.ActiveConnections() == 0; i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if v := listener.ActiveConnections(); v != 1 {
+		t.Error("active connections with cookie: ", v)
+	}
+}
+
+func TestListenerKeepsFECDecoder(t *testing.T) {
+	config := &Config{
+		Fec: &FEC{DataShards: 2, ParityShards: 1},
+	}
+	accepted := make(chan internet.Connection, 1)
+	listener, err := NewListener(context.Background(), net.LocalHostIP, net.Port(0), &internet.MemoryStreamConfig{
+		ProtocolName:     "mkcp",
+		ProtocolSettings: config,
+	}, func(conn internet.Connection) {
+		accepted <- conn
+	})
+	common.Must(err)
+	defer listener.Close()
+
+	conn, err := net.DialUDP("udp", nil, listener.Addr().(*net.UDPAddr))
+	common.Must(err)
+	defer conn.Close()
+
+	security, err := config.GetSecurity()
+	common.Must(err)
+	encoder, err := config.GetFECEncoder()
+	common.Must(err)
+	var packets [][]byte
+	for i, payload := range []string{"abc", "def"} {
+		seg := NewDataSegment()
+		seg.Conv = 1
+		seg.Number = uint32(i)
+		common.Must2(seg.Data().WriteString(payload))
+		b := make([]byte, seg.ByteSize())
+		seg.Serialize(b)
+		seg.Release()
+		for _, p := range encoder.Encode(b) {
+			packets = append(packets, append([]byte(nil), p...))
+		}
+	}
+	send := func(p []byte) {
+		var packet bytes.Buffer
+		writer := &KCPPacketWriter{Security: security, Writer: &packet}
+		common.Must2(writer.Write(p))
+		common.Must2(conn.Write(packet.Bytes()))
+	}
+
+	// The first data packet is lost, and the parity packet arrives before the second one. The decoder
+	// created for the parity packet recovers the first payload.
+	send(packets[2])
+	time.Sleep(100 * time.Millisecond)
+	send(packets[1])
+
+	var c internet.Connection
+	select {
+	case c = <-accepted:
+	case <-time.After(2 * time.Second):
+		t.Fatal("no connection accepted")
+	}
+	defer c.Close()
+	common.Must(c.SetReadDeadline(time.Now().Add(2 * time.Second)))
+	received := make([]byte, 6)
+	if _, err := io.ReadFull(c, received); err != nil {
+		t.Fatal("failed to read recovered payload: ", err)
+	}
+	if r := cmp.Diff(string(received), "abcdef"); r != "" {
+		t.Error(r)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"crypto/cipher"
 	gotls "crypto/tls"
 	"sync"
+	"sync/atomic"
 
 	"v2ray.com/core/common"
 	"v2ray.com/core/common/buf"
@@ -16,23 +17,42 @@ import (
 	"v2ray.com/core/transport/internet/udp"
 )
 
+// maxPendingDecoders is the number of FEC decoders a Listener keeps for sources without sessions.
+const maxPendingDecoders = 256
+
 type ConnectionID struct {
 	Remote net.Address
 	Port   net.Port
 	Conv   uint16
 }
 
+// session is a connection accepted by a Listener.
+type session struct {
+	conn   *Connection
+	writer *Writer
+	// nonce is the session nonce of the client, if cookies are enabled.
+	nonce uint32
+}
+
 // Listener defines a server listening for connections
 type Listener struct {
 	sync.Mutex
-	sessions  map[ConnectionID]*Connection
+	sessions  map[ConnectionID]*session
 	hub       *udp.Hub
 	tlsConfig *gotls.Config
 	config    *Config
-	reader    PacketReader
+	reader    *KCPPacketReader
 	header    internet.PacketHeader
 	security  cipher.AEAD
 	addConn   internet.ConnHandler
+
+	// decoders has the FEC decoder of each source of sessions, if FEC is enabled.
+	decoders map[net.Destination]*FECDecoder
+	// pendingDecoders has the FEC decoders of sources whose packets delivered no segments yet, such as
+	// when parity shards arrive first, so that they are used for recovery once a session starts.
+	pendingDecoders map[net.Destination]*FECDecoder
+	// cookies verifies clients before sessions are created for them, from protocol version 2 on.
+	cookies *cookieJar
 }
 
 func NewListener(ctx context.Context, address net.Address, port net.Port, streamSettings *internet.MemoryStreamConfig, addConn internet.ConnHandler) (*Listener, error) {
@@ -45,6 +65,13 @@ func NewListener(ctx context.Context, address net.Address, port net.Port, stream
 	if err != nil {
 		return nil, newError("failed to create security").Base(err).AtError()
 	}
+	if _, err := kcpSettings.GetFECEncoder(); err != nil {
+		return nil, newError("invalid FEC settings").Base(err).AtError()
+	}
+	version, err := kcpSettings.GetProtocolVersion()
+	if err != nil {
+		return nil, err
+	}
 	l := &Listener{
 		header:   header,
 		security: security,
@@ -52,9 +79,14 @@ func NewListener(ctx context.Context, address net.Address, port net.Port, stream
 			Header:   header,
 			Security: security,
 		},
-		sessions: make(map[ConnectionID]*Connection),
-		config:   kcpSettings,
-		addConn:  addConn,
+		sessions:        make(map[ConnectionID]*session),
+		decoders:        make(map[net.Destination]*FECDecoder),
+		pendingDecoders: make(map[net.Destination]*FECDecoder),
+		config:          kcpSettings,
+		addConn:         addConn,
+	}
+	if version >= protocolVersionCookie {
+		l.cookies = newCookieJar()
 	}
 
 	if config := tls.ConfigFromStreamSettings(streamSettings); config != nil {
@@ -82,16 +114,88 @@ func (l *Listener) handlePackets() {
 	}
 }
 
+// read returns the segments in the payload from src, and the FEC decoder of src if it is not kept yet.
+func (l *Listener) read(payload []byte, src net.Destination) ([]Segment, *FECDecoder) {
+	if l.config.Fec.GetDataShards() == 0 {
+		return l.reader.Read(payload), nil
+	}
+	payload = l.reader.open(payload)
+	if payload == nil {
+		return nil, nil
+	}
+
+	l.Lock()
+	decoder, found := l.decoders[src]
+	if !found {
+		decoder = l.pendingDecoders[src]
+	}
+	l.Unlock()
+	var newDecoder *FECDecoder
+	if !found {
+		if decoder == nil {
+			decoder, _ = l.config.GetFECDecoder()
+		}
+		newDecoder = decoder
+	}
+
+	var segments []Segment
+	for _, p := range decoder.Decode(payload) {
+		segments = append(segments, readSegments(p)...)
+	}
+	return segments, newDecoder
+}
+
+// sendChallenge answers the cookie request from src. The answer is a single packet as large as the request,
+// as FEC parity is never sent for it.
+func (l *Listener) sendChallenge(src net.Destination, request *CookieSegment) {
+	payload := serializeSegment(l.cookies.Challenge(src, request))
+	if encoder, _ := l.config.GetFECEncoder(); encoder != nil {
+		payload = encoder.Encode(payload)[0]
+	}
+	writer := &KCPPacketWriter{
+		Header:   l.header,
+		Security: l.security,
+		Writer:   &Writer{dest: src, hub: l.hub},
+	}
+	if _, err := writer.Write(payload); err != nil {
+		newError("failed to send cookie to ", src).Base(err).AtDebug().WriteToLog()
+	}
+}
+
 func (l *Listener) OnReceive(payload *buf.Buffer, src net.Destination) {
-	segments := l.reader.Read(payload.Bytes())
+	segments, decoder := l.read(payload.Bytes(), src)
 	payload.Release()
 
 	if len(segments) == 0 {
+		if decoder != nil {
+			l.keepPendingDecoder(src, decoder)
+			return
+		}
 		newError("discarding invalid payload from ", src).WriteToLog()
 		return
 	}
 
 	conv := segments[0].Conversation()
+
+	// With cookies, sessions are created only by packets that start with a valid echo.
+	var echo *CookieSegment
+	if l.cookies != nil {
+		if cookie, ok := segments[0].(*CookieSegment); ok {
+			switch {
+			case cookie.Cmd == CommandCookieRequest:
+				// The session starts with fresh FEC state after the cookie exchange.
+				l.dropPendingDecoder(src)
+				l.sendChallenge(src, cookie)
+				return
+			case cookie.Cmd == CommandCookieEcho && l.cookies.Verify(src, cookie):
+				echo = cookie
+			}
+			segments = segments[1:]
+			if len(segments) == 0 {
+				return
+			}
+		}
+	}
 	cmd := segments[0].Command()
 
 	id := ConnectionID{
@@ -103,12 +207,22 @@ func (l *Listener) OnReceive(payload *buf.Buffer, src net.Destination) {
 	l.Lock()
 	defer l.Unlock()
 
-	conn, found := l.sessions[id]
+	s, found := l.sessions[id]
+	if found && echo != nil && echo.Nonce != s.nonce {
+		// Another client takes the address and conversation ID of a session, such as after a NAT rebinding.
+		// Packets of the session are from the new client ever since, so the old one is dropped silently.
+		newError("#", conv, " replacing session from ", src).AtDebug().WriteToLog()
+		l.detach(id, s)
+		found = false
+	}
 
 	if !found {
 		if cmd == CommandTerminate {
 			return
 		}
+		if l.cookies != nil && echo == nil {
+			return
+		}
 		writer := &Writer{
 			id:       id,
 			hub:      l.hub,
@@ -120,7 +234,8 @@ func (l *Listener) OnReceive(payload *buf.Buffer, src net.Destination) {
 			Port: int(src.Port),
 		}
 		localAddr := l.hub.Addr()
-		conn = NewConnection(ConnMetadata{
+		fecEncoder, _ := l.config.GetFECEncoder()
+		conn := NewConnection(ConnMetadata{
 			LocalAddr:    localAddr,
 			RemoteAddr:   remoteAddr,
 			Conversation: conv,
@@ -128,6 +243,7 @@ func (l *Listener) OnReceive(payload *buf.Buffer, src net.Destination) {
 			Header:   l.header,
 			Security: l.security,
 			Writer:   writer,
+			FEC:      fecEncoder,
 		}, writer, l.config)
 		var netConn internet.Connection = conn
 		if l.tlsConfig != nil {
@@ -135,15 +251,64 @@ func (l *Listener) OnReceive(payload *buf.Buffer, src net.Destination) {
 		}
 
 		l.addConn(netConn)
-		l.sessions[id] = conn
+		s = &session{
+			conn:   conn,
+			writer: writer,
+		}
+		if echo != nil {
+			s.nonce = echo.Nonce
+		}
+		l.sessions[id] = s
+	}
+	// Decoders are kept only for sources of sessions, so that packets from elsewhere take no memory.
+	if decoder != nil {
+		l.decoders[src] = decoder
+		delete(l.pendingDecoders, src)
 	}
-	conn.Input(segments)
+	s.conn.Input(segments)
+}
+
+// keepPendingDecoder keeps the decoder of src until a session starts from there. At most
+// maxPendingDecoders are kept, so that packets from elsewhere take little memory.
+func (l *Listener) keepPendingDecoder(src net.Destination, decoder *FECDecoder) {
+	l.Lock()
+	defer l.Unlock()
+
+	if _, found := l.pendingDecoders[src]; !found && len(l.pendingDecoders) >= maxPendingDecoders {
+		for other := range l.pendingDecoders {
+			delete(l.pendingDecoders, other)
+			break
+		}
+	}
+	l.pendingDecoders[src] = decoder
+}
+
+func (l *Listener) dropPendingDecoder(src net.Destination) {
+	l.Lock()
+	defer l.Unlock()
+
+	delete(l.pendingDecoders, src)
+}
+
+// detach removes the session, and terminates it without sending anything to its address any more.
+func (l *Listener) detach(id ConnectionID, s *session) {
+	atomic.StoreUint32(&s.writer.detached, 1)
+	delete(l.sessions, id)
+	s.conn.SetState(StateTerminated)
 }
 
 func (l *Listener) Remove(id ConnectionID) {
 	l.Lock()
+	defer l.Unlock()
+
 	delete(l.sessions, id)
-	l.Unlock()
+	for other := range l.sessions {
+		if other.Remote == id.Remote && other.Port == id.Port {
+			return
+		}
+	}
+	delete(l.decoders, net.UDPDestination(id.Remote, id.Port))
+	delete(l.pendingDecoders, net.UDPDestination(id.Remote, id.Port))
 }
 
 // Close stops listening on the UDP address. Already Accepted connections are not closed.
@@ -153,8 +318,8 @@ func (l *Listener) Close() error {
 	l.Lock()
 	defer l.Unlock()
 
-	for _, conn := range l.sessions {
-		go conn.Terminate()
+	for _, s := range l.sessions {
+		go s.conn.Terminate()
 	}
 
 	return nil
@@ -177,13 +342,21 @@ type Writer struct {
 	dest     net.Destination
 	hub      *udp.Hub
 	listener *Listener
+	// detached is set when the session is replaced, after which its packets are dropped.
+	detached uint32
 }
 
 func (w *Writer) Write(payload []byte) (int, error) {
+	if atomic.LoadUint32(&w.detached) == 1 {
+		return len(payload), nil
+	}
 	return w.hub.WriteTo(payload, w.dest)
 }
 
 func (w *Writer) Close() error {
+	if atomic.LoadUint32(&w.detached) == 1 {
+		return nil
+	}
 	w.listener.Remove(w.id)
 	return nil
 }
@@ -20,6 +20,12 @@ const (
 	CommandTerminate Command = 2
 	// CommandPing indicates a ping.
 	CommandPing Command = 3
+	// CommandCookieRequest indicates that the client asks for a cookie, from protocol version 2 on.
+	CommandCookieRequest Command = 4
+	// CommandCookieChallenge indicates a cookie for the client to echo.
+	CommandCookieChallenge Command = 5
+	// CommandCookieEcho indicates that the client echoes its cookie, so that the server accepts the session.
+	CommandCookieEcho Command = 6
 )
 
 type SegmentOption byte
@@ -275,6 +281,69 @@ func (s *CmdOnlySegment) Serialize(b []byte) {
 
 func (*CmdOnlySegment) Release() {}
 
+const (
+	cookieSize        = 16
+	cookieSegmentSize = 2 + 1 + 1 + 4 + cookieSize
+)
+
+// CookieSegment is a step of the cookie exchange, which servers of protocol version 2 require before keeping
+// any state for a session. Requests are as large as challenges, so that servers never send more than they
+// receive from unverified addresses.
+type CookieSegment struct {
+	Conv   uint16
+	Cmd    Command
+	Option SegmentOption
+	// Nonce is chosen by the client for each session, so that sessions of the same conversation ID from the
+	// same address are told apart.
+	Nonce uint32
+	// Cookie is empty in requests.
+	Cookie [cookieSize]byte
+}
+
+func NewCookieSegment() *CookieSegment {
+	return new(CookieSegment)
+}
+
+func (s *CookieSegment) parse(conv uint16, cmd Command, opt SegmentOption, buf []byte) (bool, []byte) {
+	s.Conv = conv
+	s.Cmd = cmd
+	s.Option = opt
+
+	if len(buf) < 4+cookieSize {
+		return false, nil
+	}
+
+	s.Nonce = binary.BigEndian.Uint32(buf)
+	buf = buf[4:]
+
+	copy(s.Cookie[:], buf)
+	buf = buf[cookieSize:]
+
+	return true, buf
+}
+
+func (s *CookieSegment) Conversation() uint16 {
+	return s.Conv
+}
+
+func (s *CookieSegment) Command() Command {
+	return s.Cmd
+}
+
+func (*CookieSegment) ByteSize() int32 {
+	return cookieSegmentSize
+}
+
+func (s *CookieSegment) Serialize(b []byte) {
+	binary.BigEndian.PutUint16(b, s.Conv)
+	b[2] = byte(s.Cmd)
+	b[3] = byte(s.Option)
+	binary.BigEndian.PutUint32(b[4:], s.Nonce)
+	copy(b[8:], s.Cookie[:])
+}
+
+func (*CookieSegment) Release() {}
+
 func ReadSegment(buf []byte) (Segment, []byte) {
 	if len(buf) < 4 {
 		return nil, nil
@@ -293,6 +362,8 @@ func ReadSegment(buf []byte) (Segment, []byte) {
 		seg = NewDataSegment()
 	case CommandACK:
 		seg = NewAckSegment()
+	case CommandCookieRequest, CommandCookieChallenge, CommandCookieEcho:
+		seg = NewCookieSegment()
 	default:
 		seg = NewCmdOnlySegment()
 	}
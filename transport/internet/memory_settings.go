@@ -1,5 +1,10 @@
 package internet
 
+import (
+	"context"
+	"time"
+)
+
 // MemoryStreamConfig is a parsed form of StreamConfig. This is used to reduce number of Protobuf parsing.
 type MemoryStreamConfig struct {
 	ProtocolName     string
@@ -7,11 +12,18 @@ type MemoryStreamConfig struct {
 	SecurityType     string
 	SecuritySettings interface{}
 	SocketSettings   *SocketConfig
+	// HandshakeTimeout is the time for outbounds to connect. Zero for the defaults of transports.
+	HandshakeTimeout time.Duration
 }
 
 // ToMemoryStreamConfig converts a StreamConfig to MemoryStreamConfig. It returns a default non-nil MemoryStreamConfig for nil input.
 func ToMemoryStreamConfig(s *StreamConfig) (*MemoryStreamConfig, error) {
-	ets, err := s.GetEffectiveTransportSettings()
+	return ToMemoryStreamConfigWithContext(context.Background(), s)
+}
+
+// ToMemoryStreamConfigWithContext is ToMemoryStreamConfig with default transport settings from ctx, if any.
+func ToMemoryStreamConfigWithContext(ctx context.Context, s *StreamConfig) (*MemoryStreamConfig, error) {
+	ets, err := s.getTransportSettingsFor(ctx, s.GetEffectiveProtocol())
 	if err != nil {
 		return nil, err
 	}
@@ -23,6 +35,9 @@ func ToMemoryStreamConfig(s *StreamConfig) (*MemoryStreamConfig, error) {
 
 	if s != nil {
 		mss.SocketSettings = s.SocketSettings
+		checkTCPCongestion(s.SocketSettings)
+		checkUDPOptions(s.SocketSettings)
+		mss.HandshakeTimeout = time.Duration(s.HandshakeTimeout) * time.Second
 	}
 
 	if s != nil && s.HasSecuritySettings() {
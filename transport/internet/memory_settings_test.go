@@ -0,0 +1,46 @@
+package internet_test
+
+import (
+	"context"
+	"testing"
+
+	"v2ray.com/core/common"
+	"v2ray.com/core/common/serial"
+	. "v2ray.com/core/transport/internet"
+	"v2ray.com/core/transport/internet/websocket"
+)
+
+func TestMemoryStreamConfigWithContext(t *testing.T) {
+	ctx := ContextWithTransportSettings(context.Background(), []*TransportConfig{
+		{
+			ProtocolName: "websocket",
+			Settings:     serial.ToTypedMessage(&websocket.Config{Path: "/default"}),
+		},
+	})
+
+	mss, err := ToMemoryStreamConfigWithContext(ctx, &StreamConfig{ProtocolName: "websocket"})
+	common.Must(err)
+	if path := mss.ProtocolSettings.(*websocket.Config).Path; path != "/default" {
+		t.Error("expected settings from context, but got path ", path)
+	}
+
+	mss, err = ToMemoryStreamConfigWithContext(ctx, &StreamConfig{
+		ProtocolName: "websocket",
+		TransportSettings: []*TransportConfig{
+			{
+				ProtocolName: "websocket",
+				Settings:     serial.ToTypedMessage(&websocket.Config{Path: "/own"}),
+			},
+		},
+	})
+	common.Must(err)
+	if path := mss.ProtocolSettings.(*websocket.Config).Path; path != "/own" {
+		t.Error("expected own settings, but got path ", path)
+	}
+
+	mss, err = ToMemoryStreamConfig(&StreamConfig{ProtocolName: "websocket"})
+	common.Must(err)
+	if path := mss.ProtocolSettings.(*websocket.Config).Path; path != "" {
+		t.Error("expected default settings, but got path ", path)
+	}
+}
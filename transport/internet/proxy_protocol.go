@@ -0,0 +1,133 @@
+package internet
+
+import (
+	"bufio"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pires/go-proxyproto"
+
+	"v2ray.com/core/common/net"
+	"v2ray.com/core/common/session"
+)
+
+// proxyProtocolTimeout limits how long a connection may take to send its PROXY protocol header.
+const proxyProtocolTimeout = 8 * time.Second
+
+type proxyProtocolListener struct {
+	net.Listener
+}
+
+// NewProxyProtocolListener returns a listener whose connections start with a PROXY protocol
+// header, as they do in NewProxyProtocolConn.
+func NewProxyProtocolListener(l net.Listener) net.Listener {
+	return &proxyProtocolListener{Listener: l}
+}
+
+func (l *proxyProtocolListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return NewProxyProtocolConn(conn), nil
+}
+
+// proxyProtocolConn reads the PROXY protocol header of a connection on first use. The header is
+// read without blocking Accept, as the first call to RemoteAddr usually comes from the goroutine
+// serving the connection.
+type proxyProtocolConn struct {
+	net.Conn
+	reader *bufio.Reader
+	once   sync.Once
+	header *proxyproto.Header
+	err    error
+}
+
+// NewProxyProtocolConn returns a connection that starts with a PROXY protocol header of version 1
+// or 2. The source and destination addresses advertised by the header replace the remote and
+// local address of the connection. If the header is missing or malformed, the connection is
+// closed.
+func NewProxyProtocolConn(conn net.Conn) net.Conn {
+	return &proxyProtocolConn{
+		Conn:   conn,
+		reader: bufio.NewReader(conn),
+	}
+}
+
+func (c *proxyProtocolConn) readHeader() error {
+	c.once.Do(func() {
+		c.Conn.SetReadDeadline(time.Now().Add(proxyProtocolTimeout))
+		header, err := proxyproto.Read(c.reader)
+		c.Conn.SetReadDeadline(time.Time{})
+		if err != nil {
+			e := newError("invalid PROXY protocol header from ", c.Conn.RemoteAddr()).Base(err).AtWarning()
+			e.WriteToLog()
+			c.err = e
+			c.Conn.Close()
+			return
+		}
+		if !header.Command.IsLocal() {
+			c.header = header
+		}
+	})
+	return c.err
+}
+
+func (c *proxyProtocolConn) Read(b []byte) (int, error) {
+	if err := c.readHeader(); err != nil {
+		return 0, err
+	}
+	return c.reader.Read(b)
+}
+
+func (c *proxyProtocolConn) RemoteAddr() net.Addr {
+	if c.readHeader() == nil && c.header != nil {
+		return c.header.SourceAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+func (c *proxyProtocolConn) LocalAddr() net.Addr {
+	if c.readHeader() == nil && c.header != nil {
+		return c.header.DestinationAddr
+	}
+	return c.Conn.LocalAddr()
+}
+
+// WriteProxyProtocol writes a PROXY protocol header of the given version to conn. The header
+// advertises the source of the inbound connection in ctx, or the local address of conn if there
+// is none. For multiplexed connections, this is the source of the first session only.
+func WriteProxyProtocol(ctx context.Context, conn net.Conn, version uint32) error {
+	if version != 1 && version != 2 {
+		return newError("unknown PROXY protocol version ", version)
+	}
+
+	src := conn.LocalAddr()
+	if inbound := session.InboundFromContext(ctx); inbound != nil && inbound.Source.IsValid() && inbound.Source.Address.Family().IsIP() {
+		src = &net.TCPAddr{
+			IP:   inbound.Source.Address.IP(),
+			Port: int(inbound.Source.Port),
+		}
+	}
+	dst := conn.RemoteAddr()
+
+	header := proxyproto.HeaderProxyFromAddrs(byte(version), src, dst)
+	if srcAddr, ok := src.(*net.TCPAddr); ok {
+		if dstAddr, ok := dst.(*net.TCPAddr); ok && (srcAddr.IP.To4() == nil) != (dstAddr.IP.To4() == nil) {
+			if version == 1 {
+				// Version 1 can't mix address families.
+				header = proxyproto.HeaderProxyFromAddrs(1, nil, nil)
+			} else {
+				header.TransportProtocol = proxyproto.TCPv6
+				header.SourceAddr = &net.TCPAddr{IP: srcAddr.IP.To16(), Port: srcAddr.Port}
+				header.DestinationAddr = &net.TCPAddr{IP: dstAddr.IP.To16(), Port: dstAddr.Port}
+			}
+		}
+	}
+
+	if _, err := header.WriteTo(conn); err != nil {
+		return newError("failed to write PROXY protocol header").Base(err)
+	}
+	return nil
+}
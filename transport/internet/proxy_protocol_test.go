@@ -0,0 +1,72 @@
+package internet_test
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"v2ray.com/core/common"
+	"v2ray.com/core/common/net"
+	"v2ray.com/core/common/session"
+	. "v2ray.com/core/transport/internet"
+)
+
+func TestProxyProtocol(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	common.Must(err)
+	listener = NewProxyProtocolListener(listener)
+	defer listener.Close()
+
+	ctx := session.ContextWithInbound(context.Background(), &session.Inbound{
+		Source: net.TCPDestination(net.ParseAddress("1.2.3.4"), 5678),
+	})
+
+	for _, version := range []uint32{1, 2} {
+		client, err := net.Dial("tcp", listener.Addr().String())
+		common.Must(err)
+		common.Must(WriteProxyProtocol(ctx, client, version))
+		common.Must2(client.Write([]byte("hello")))
+
+		conn, err := listener.Accept()
+		common.Must(err)
+		if addr := conn.RemoteAddr().String(); addr != "1.2.3.4:5678" {
+			t.Error("version ", version, " remote address: ", addr)
+		}
+		if addr := conn.LocalAddr().String(); addr != client.RemoteAddr().String() {
+			t.Error("version ", version, " local address: ", addr)
+		}
+		var b [5]byte
+		common.Must2(io.ReadFull(conn, b[:]))
+		if string(b[:]) != "hello" {
+			t.Error("version ", version, " payload: ", string(b[:]))
+		}
+
+		client.Close()
+		conn.Close()
+	}
+}
+
+func TestProxyProtocolMalformed(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	common.Must(err)
+	listener = NewProxyProtocolListener(listener)
+	defer listener.Close()
+
+	client, err := net.Dial("tcp", listener.Addr().String())
+	common.Must(err)
+	defer client.Close()
+	common.Must2(client.Write([]byte("GET / HTTP/1.1\r\n\r\n")))
+
+	conn, err := listener.Accept()
+	common.Must(err)
+	defer conn.Close()
+
+	var b [16]byte
+	if _, err := conn.Read(b[:]); err == nil {
+		t.Error("expected error on malformed header")
+	}
+	// The connection is closed by the server.
+	if _, err := client.Read(b[:]); err == nil {
+		t.Error("expected closed connection")
+	}
+}
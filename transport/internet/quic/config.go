@@ -6,6 +6,7 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/sha256"
+	"time"
 
 	"golang.org/x/crypto/chacha20poly1305"
 	"v2ray.com/core/common"
@@ -47,3 +48,18 @@ func getHeader(config *Config) (internet.PacketHeader, error) {
 
 	return internet.CreatePacketHeader(msg)
 }
+
+// keepAlive returns whether sessions of the config send PING frames when idle.
+func (c *Config) keepAlive() bool {
+	return c.KeepAlive || c.KeepAliveInterval > 0
+}
+
+// maxIdleTimeout returns the idle timeout of sessions of the config, where idle is the default. quic-go
+// sends a PING frame after a quarter of the idle timeout without packets, so the idle timeout is 4 times
+// of the keep-alive interval when it is set.
+func (c *Config) maxIdleTimeout(idle time.Duration) time.Duration {
+	if c.KeepAliveInterval > 0 {
+		return time.Duration(c.KeepAliveInterval) * time.Second * 4
+	}
+	return idle
+}
@@ -6,6 +6,7 @@ import (
 	"crypto/cipher"
 	"crypto/rand"
 	"errors"
+	"sync/atomic"
 	"time"
 
 	"github.com/lucas-clemente/quic-go"
@@ -145,10 +146,17 @@ type interConn struct {
 	stream quic.Stream
 	local  net.Addr
 	remote net.Addr
+	// context is the session of the stream, if it is dialed by the client.
+	context *sessionContext
+	closed  int32
 }
 
 func (c *interConn) Read(b []byte) (int, error) {
-	return c.stream.Read(b)
+	n, err := c.stream.Read(b)
+	if c.context != nil {
+		atomic.AddUint64(&c.context.bytes, uint64(n))
+	}
+	return n, err
 }
 
 func (c *interConn) WriteMultiBuffer(mb buf.MultiBuffer) error {
@@ -159,11 +167,19 @@ func (c *interConn) WriteMultiBuffer(mb buf.MultiBuffer) error {
 }
 
 func (c *interConn) Write(b []byte) (int, error) {
-	return c.stream.Write(b)
+	n, err := c.stream.Write(b)
+	if c.context != nil {
+		atomic.AddUint64(&c.context.bytes, uint64(n))
+	}
+	return n, err
 }
 
 func (c *interConn) Close() error {
-	return c.stream.Close()
+	err := c.stream.Close()
+	if c.context != nil && atomic.CompareAndSwapInt32(&c.closed, 0, 1) {
+		c.context.streamClosed()
+	}
+	return err
 }
 
 func (c *interConn) LocalAddr() net.Addr {
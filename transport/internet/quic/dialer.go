@@ -5,6 +5,7 @@ package quic
 import (
 	"context"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/lucas-clemente/quic-go"
@@ -16,31 +17,66 @@ import (
 )
 
 type sessionContext struct {
+	// bytes is the traffic of the streams of the session.
+	bytes   uint64
+	streams int32
+	expired int32
+
 	rawConn *sysConn
 	session quic.Session
+	created time.Time
+	recycle *internet.ConnectionRecycle
 }
 
-var errSessionClosed = newError("session closed")
+var (
+	errSessionClosed  = newError("session closed")
+	errSessionExpired = newError("session recycled")
+)
 
 func (c *sessionContext) openStream(destAddr net.Addr) (*interConn, error) {
 	if !isActive(c.session) {
 		return nil, errSessionClosed
 	}
+	if c.isExpired() {
+		return nil, errSessionExpired
+	}
 
 	stream, err := c.session.OpenStream()
 	if err != nil {
 		return nil, err
 	}
+	atomic.AddInt32(&c.streams, 1)
 
 	conn := &interConn{
-		stream: stream,
-		local:  c.session.LocalAddr(),
-		remote: destAddr,
+		stream:  stream,
+		local:   c.session.LocalAddr(),
+		remote:  destAddr,
+		context: c,
 	}
 
 	return conn, nil
 }
 
+// isExpired returns true if the session takes no new streams, after it reaches the limits of its
+// ConnectionRecycle. Expired sessions are closed by the cleanup after their streams end.
+func (c *sessionContext) isExpired() bool {
+	if atomic.LoadInt32(&c.expired) != 0 {
+		return true
+	}
+	if !c.recycle.Expired(c.created, atomic.LoadUint64(&c.bytes)) {
+		return false
+	}
+	if atomic.CompareAndSwapInt32(&c.expired, 0, 1) {
+		c.recycle.Recycled()
+	}
+	return true
+}
+
+// streamClosed is called when a stream of the session is closed.
+func (c *sessionContext) streamClosed() {
+	atomic.AddInt32(&c.streams, -1)
+}
+
 type clientSessions struct {
 	access   sync.Mutex
 	sessions map[net.Destination][]*sessionContext
@@ -56,10 +92,12 @@ func isActive(s quic.Session) bool {
 	}
 }
 
-func removeInactiveSessions(sessions []*sessionContext) []*sessionContext {
+// removeInactiveSessions closes the sessions that are closed by the server, and the expired sessions whose
+// streams end, if closeExpired is set.
+func removeInactiveSessions(sessions []*sessionContext, closeExpired bool) []*sessionContext {
 	activeSessions := make([]*sessionContext, 0, len(sessions))
 	for _, s := range sessions {
-		if isActive(s.session) {
+		if isActive(s.session) && (!closeExpired || !s.isExpired() || atomic.LoadInt32(&s.streams) > 0) {
 			activeSessions = append(activeSessions, s)
 			continue
 		}
@@ -106,7 +144,8 @@ func (s *clientSessions) cleanSessions() error {
 	newSessionMap := make(map[net.Destination][]*sessionContext)
 
 	for dest, sessions := range s.sessions {
-		sessions = removeInactiveSessions(sessions)
+		// The cleanup runs every minute, which gives data of streams that just end time to be sent.
+		sessions = removeInactiveSessions(sessions, true)
 		if len(sessions) > 0 {
 			newSessionMap[dest] = sessions
 		}
@@ -116,7 +155,7 @@ func (s *clientSessions) cleanSessions() error {
 	return nil
 }
 
-func (s *clientSessions) openConnection(destAddr net.Addr, config *Config, tlsConfig *tls.Config, sockopt *internet.SocketConfig) (internet.Connection, error) {
+func (s *clientSessions) openConnection(destAddr net.Addr, config *Config, tlsConfig *tls.Config, sockopt *internet.SocketConfig, recycle *internet.ConnectionRecycle) (internet.Connection, error) {
 	s.access.Lock()
 	defer s.access.Unlock()
 
@@ -138,7 +177,7 @@ func (s *clientSessions) openConnection(destAddr net.Addr, config *Config, tlsCo
 		}
 	}
 
-	sessions = removeInactiveSessions(sessions)
+	sessions = removeInactiveSessions(sessions, false)
 
 	rawConn, err := internet.ListenSystemPacket(context.Background(), &net.UDPAddr{
 		IP:   []byte{0, 0, 0, 0},
@@ -151,7 +190,8 @@ func (s *clientSessions) openConnection(destAddr net.Addr, config *Config, tlsCo
 	quicConfig := &quic.Config{
 		ConnectionIDLength: 12,
 		HandshakeTimeout:   time.Second * 8,
-		MaxIdleTimeout:     time.Second * 30,
+		MaxIdleTimeout:     config.maxIdleTimeout(time.Second * 30),
+		KeepAlive:          config.keepAlive(),
 	}
 
 	conn, err := wrapSysConn(rawConn, config)
@@ -160,8 +200,10 @@ func (s *clientSessions) openConnection(destAddr net.Addr, config *Config, tlsCo
 		return nil, err
 	}
 
-	session, err := quic.DialContext(context.Background(), conn, destAddr, "", tlsConfig.GetTLSConfig(tls.WithDestination(dest)), quicConfig)
+	clientTLSConfig := tlsConfig.GetTLSConfig(tls.WithDestination(dest))
+	session, err := quic.DialContext(context.Background(), conn, destAddr, "", clientTLSConfig, quicConfig)
 	if err != nil {
+		tlsConfig.ReportVerifyError(clientTLSConfig.ServerName, err)
 		conn.Close()
 		return nil, err
 	}
@@ -169,6 +211,8 @@ func (s *clientSessions) openConnection(destAddr net.Addr, config *Config, tlsCo
 	context := &sessionContext{
 		session: session,
 		rawConn: conn,
+		created: time.Now(),
+		recycle: recycle,
 	}
 	s.sessions[dest] = append(sessions, context)
 	return context.openStream(destAddr)
@@ -210,7 +254,7 @@ func Dial(ctx context.Context, dest net.Destination, streamSettings *internet.Me
 
 	config := streamSettings.ProtocolSettings.(*Config)
 
-	return client.openConnection(destAddr, config, tlsConfig, streamSettings.SocketSettings)
+	return client.openConnection(destAddr, config, tlsConfig, streamSettings.SocketSettings, internet.ConnectionRecycleFromContext(ctx))
 }
 
 func init() {
@@ -106,9 +106,10 @@ func Listen(ctx context.Context, address net.Address, port net.Port, streamSetti
 	quicConfig := &quic.Config{
 		ConnectionIDLength:    12,
 		HandshakeTimeout:      time.Second * 8,
-		MaxIdleTimeout:        time.Second * 45,
+		MaxIdleTimeout:        config.maxIdleTimeout(time.Second * 45),
 		MaxIncomingStreams:    32,
 		MaxIncomingUniStreams: -1,
+		KeepAlive:             config.keepAlive(),
 	}
 
 	conn, err := wrapSysConn(rawConn, config)
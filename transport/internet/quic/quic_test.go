@@ -3,11 +3,13 @@ package quic_test
 import (
 	"context"
 	"crypto/rand"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/google/go-cmp/cmp"
 
+	"v2ray.com/core/app/stats"
 	"v2ray.com/core/common"
 	"v2ray.com/core/common/buf"
 	"v2ray.com/core/common/net"
@@ -221,3 +223,149 @@ func TestQuicConnectionAuthHeader(t *testing.T) {
 		t.Error(r)
 	}
 }
+
+func TestQuicConnectionRecycle(t *testing.T) {
+	port := udp.PickPort()
+
+	listener, err := quic.Listen(context.Background(), net.LocalHostIP, port, &internet.MemoryStreamConfig{
+		ProtocolName:     "quic",
+		ProtocolSettings: &quic.Config{},
+		SecurityType:     "tls",
+		SecuritySettings: &tls.Config{
+			Certificate: []*tls.Certificate{
+				tls.ParseCertificate(cert.MustGenerate(nil, cert.DNSNames("www.v2fly.org"))),
+			},
+		},
+	}, func(conn internet.Connection) {
+		go func() {
+			defer conn.Close()
+			buf.Copy(buf.NewReader(conn), buf.NewWriter(conn)) // nolint: errcheck
+		}()
+	})
+	common.Must(err)
+	defer listener.Close()
+
+	time.Sleep(time.Second)
+
+	recycles := new(stats.Counter)
+	ctx := internet.ContextWithConnectionRecycle(context.Background(), &internet.ConnectionRecycle{
+		MaxBytes: 1024,
+		Recycles: recycles,
+	})
+	streamSettings := &internet.MemoryStreamConfig{
+		ProtocolName:     "quic",
+		ProtocolSettings: &quic.Config{},
+		SecurityType:     "tls",
+		SecuritySettings: &tls.Config{
+			ServerName:    "www.v2fly.org",
+			AllowInsecure: true,
+		},
+	}
+	// The first session carries more than the limit, so the second stream goes to a new session.
+	for i := 0; i < 2; i++ {
+		conn, err := quic.Dial(ctx, net.TCPDestination(net.LocalHostIP, port), streamSettings)
+		common.Must(err)
+		payload := make([]byte, 2048)
+		common.Must2(rand.Read(payload))
+		common.Must2(conn.Write(payload))
+		b := buf.New()
+		common.Must2(b.ReadFullFrom(conn, int32(len(payload))))
+		if r := cmp.Diff(b.Bytes(), payload); r != "" {
+			t.Error(r)
+		}
+		b.Release()
+		conn.Close()
+	}
+	if v := recycles.Value(); v != 1 {
+		t.Error("expected 1 recycled session, but got ", v)
+	}
+}
+
+// packetRelay forwards UDP packets between a client and a server, and counts the packets from the client.
+type packetRelay struct {
+	conn    *net.UDPConn
+	server  *net.UDPAddr
+	packets uint32
+}
+
+func newPacketRelay(server net.Port) *packetRelay {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.LocalHostIP.IP()})
+	common.Must(err)
+	r := &packetRelay{
+		conn:   conn,
+		server: &net.UDPAddr{IP: net.LocalHostIP.IP(), Port: int(server)},
+	}
+	go r.run()
+	return r
+}
+
+func (r *packetRelay) run() {
+	var client *net.UDPAddr
+	b := make([]byte, 2048)
+	for {
+		n, addr, err := r.conn.ReadFromUDP(b)
+		if err != nil {
+			return
+		}
+		if addr.Port == r.server.Port {
+			if client != nil {
+				r.conn.WriteToUDP(b[:n], client) // nolint: errcheck
+			}
+			continue
+		}
+		client = addr
+		atomic.AddUint32(&r.packets, 1)
+		r.conn.WriteToUDP(b[:n], r.server) // nolint: errcheck
+	}
+}
+
+func (r *packetRelay) port() net.Port {
+	return net.Port(r.conn.LocalAddr().(*net.UDPAddr).Port)
+}
+
+func TestQuicKeepAliveInterval(t *testing.T) {
+	port := udp.PickPort()
+
+	listener, err := quic.Listen(context.Background(), net.LocalHostIP, port, &internet.MemoryStreamConfig{
+		ProtocolName:     "quic",
+		ProtocolSettings: &quic.Config{},
+	}, func(conn internet.Connection) {
+		go func() {
+			defer conn.Close()
+			buf.Copy(buf.NewReader(conn), buf.NewWriter(conn)) // nolint: errcheck
+		}()
+	})
+	common.Must(err)
+	defer listener.Close()
+
+	time.Sleep(time.Second)
+
+	for _, interval := range []uint32{0, 1} {
+		relay := newPacketRelay(port)
+		defer relay.conn.Close()
+
+		conn, err := quic.Dial(context.Background(), net.UDPDestination(net.LocalHostIP, relay.port()), &internet.MemoryStreamConfig{
+			ProtocolName:     "quic",
+			ProtocolSettings: &quic.Config{KeepAliveInterval: interval},
+		})
+		common.Must(err)
+		defer conn.Close()
+
+		common.Must2(conn.Write([]byte("ping")))
+		b := buf.New()
+		common.Must2(b.ReadFullFrom(conn, 4))
+		b.Release()
+
+		// Leave time for the last ACKs, and count the packets of the idle session.
+		time.Sleep(time.Millisecond * 500)
+		idle := atomic.LoadUint32(&relay.packets)
+		time.Sleep(time.Millisecond * 3500)
+		packets := atomic.LoadUint32(&relay.packets) - idle
+		if interval == 0 && packets != 0 {
+			t.Error("expected no packets without keep-alive, but got ", packets)
+		}
+		if interval > 0 && packets < 2 {
+			t.Error("expected at least 2 keep-alive packets, but got ", packets)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package internet
+
+import (
+	"context"
+	"syscall"
+
+	"v2ray.com/core/common/buf"
+)
+
+type readvKey int
+
+const readvKeyValue readvKey = 0
+
+// ContextWithReadv returns a context in which readers of the connections that transports make use readv if
+// enabled, instead of the default of the process.
+func ContextWithReadv(ctx context.Context, enabled bool) context.Context {
+	return context.WithValue(ctx, readvKeyValue, enabled)
+}
+
+// readvConn is a connection whose readers use readv as its instance sets.
+type readvConn struct {
+	Connection
+	rawConn syscall.Conn
+	readv   bool
+}
+
+// SyscallConn implements syscall.Conn.
+func (c *readvConn) SyscallConn() (syscall.RawConn, error) {
+	return c.rawConn.SyscallConn()
+}
+
+// ReadvEnabled implements buf.ReadvConn.
+func (c *readvConn) ReadvEnabled() bool {
+	return c.readv
+}
+
+// withReadv returns conn with the readv setting in ctx, if conn reads from a socket, and the setting differs
+// from the default of the process.
+func withReadv(ctx context.Context, conn Connection) Connection {
+	enabled, ok := ctx.Value(readvKeyValue).(bool)
+	if !ok || enabled == buf.ReadvEnabled() {
+		return conn
+	}
+	rawConn, ok := conn.(syscall.Conn)
+	if !ok {
+		return conn
+	}
+	return &readvConn{
+		Connection: conn,
+		rawConn:    rawConn,
+		readv:      enabled,
+	}
+}
+
+// acceptWithReadv returns a handler of the connections that transports accept, with the readv setting in ctx.
+func acceptWithReadv(ctx context.Context, handler ConnHandler) ConnHandler {
+	if _, ok := ctx.Value(readvKeyValue).(bool); !ok {
+		return handler
+	}
+	return func(conn Connection) {
+		handler(withReadv(ctx, conn))
+	}
+}
@@ -0,0 +1,56 @@
+package internet_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"v2ray.com/core/common"
+	"v2ray.com/core/common/buf"
+	"v2ray.com/core/common/net"
+	"v2ray.com/core/testing/servers/tcp"
+	. "v2ray.com/core/transport/internet"
+	_ "v2ray.com/core/transport/internet/tcp"
+)
+
+func TestReadvOfConnections(t *testing.T) {
+	// Connections of a context that sets readv against the default of the process are read as it sets.
+	enabled := !buf.ReadvEnabled()
+	ctx := ContextWithReadv(context.Background(), enabled)
+	usesReadv := func(conn Connection) bool {
+		_, ok := buf.NewReader(conn).(*buf.ReadVReader)
+		return ok
+	}
+
+	accepted := make(chan Connection, 1)
+	listener, err := ListenTCP(ctx, net.LocalHostIP, tcp.PickPort(), nil, func(conn Connection) {
+		accepted <- conn
+	})
+	common.Must(err)
+	defer listener.Close()
+	dest := net.DestinationFromAddr(listener.Addr())
+
+	conn, err := Dial(ctx, dest, nil)
+	common.Must(err)
+	defer conn.Close()
+	if v := usesReadv(conn); v != enabled {
+		t.Error("expected readv of dialed connection ", enabled, ", but got ", v)
+	}
+	select {
+	case conn := <-accepted:
+		defer conn.Close()
+		if v := usesReadv(conn); v != enabled {
+			t.Error("expected readv of accepted connection ", enabled, ", but got ", v)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("connection not accepted")
+	}
+
+	// Other connections keep the default.
+	conn, err = Dial(context.Background(), dest, nil)
+	common.Must(err)
+	defer conn.Close()
+	if v := usesReadv(conn); v != buf.ReadvEnabled() {
+		t.Error("expected readv of connection of no instance ", buf.ReadvEnabled(), ", but got ", v)
+	}
+}
@@ -0,0 +1,52 @@
+package internet
+
+import (
+	"context"
+	"time"
+
+	"v2ray.com/core/features/stats"
+)
+
+// ConnectionRecycle limits the transport connections that carry the streams of many sessions, such as those
+// of HTTP/2 and QUIC. After a connection reaches either limit, it takes no new streams, and is closed when its
+// streams end.
+type ConnectionRecycle struct {
+	// MaxLifetime is the time that a connection takes new streams for. Zero for no limit.
+	MaxLifetime time.Duration
+	// MaxBytes is the traffic in both directions, after which a connection takes no new streams. Zero for no
+	// limit.
+	MaxBytes uint64
+	// Recycles counts the recycled connections, if not nil.
+	Recycles stats.Counter
+}
+
+// Expired returns true if a connection created at the time, which has carried the bytes, takes no new
+// streams. A nil ConnectionRecycle never expires connections.
+func (r *ConnectionRecycle) Expired(created time.Time, bytes uint64) bool {
+	if r == nil {
+		return false
+	}
+	return (r.MaxLifetime > 0 && time.Since(created) >= r.MaxLifetime) || (r.MaxBytes > 0 && bytes >= r.MaxBytes)
+}
+
+// Recycled counts a recycled connection.
+func (r *ConnectionRecycle) Recycled() {
+	if r != nil && r.Recycles != nil {
+		r.Recycles.Add(1)
+	}
+}
+
+// ContextWithConnectionRecycle returns a context in which transports recycle the connections they dial with
+// r, if they share connections among sessions.
+func ContextWithConnectionRecycle(ctx context.Context, r *ConnectionRecycle) context.Context {
+	if r == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, connectionRecycleKey, r)
+}
+
+// ConnectionRecycleFromContext returns the ConnectionRecycle of ctx, or nil if there is none.
+func ConnectionRecycleFromContext(ctx context.Context) *ConnectionRecycle {
+	r, _ := ctx.Value(connectionRecycleKey).(*ConnectionRecycle)
+	return r
+}
@@ -1,5 +1,51 @@
 package internet
 
+import (
+	"io/ioutil"
+	"runtime"
+	"strings"
+)
+
+const allowedTCPCongestionPath = "/proc/sys/net/ipv4/tcp_allowed_congestion_control"
+
+// checkTCPCongestion warns if the TCP congestion control algorithm of the config can't be used, in which case
+// sockets keep the system default.
+func checkTCPCongestion(config *SocketConfig) {
+	algorithm := config.GetTcpCongestion()
+	if len(algorithm) == 0 {
+		return
+	}
+	if runtime.GOOS != "linux" {
+		newError("TCP congestion control algorithm is only supported on Linux, ignoring ", algorithm).AtWarning().WriteToLog()
+		return
+	}
+	content, err := ioutil.ReadFile(allowedTCPCongestionPath)
+	if err != nil {
+		newError("failed to read allowed TCP congestion control algorithms").Base(err).AtWarning().WriteToLog()
+		return
+	}
+	allowed := strings.Fields(string(content))
+	for _, a := range allowed {
+		if a == algorithm {
+			return
+		}
+	}
+	newError("TCP congestion control algorithm ", algorithm, " is not allowed, which may be one of ", allowed).AtWarning().WriteToLog()
+}
+
+// checkUDPOptions warns if the options of UDP sockets in the config are ignored on this platform.
+func checkUDPOptions(config *SocketConfig) {
+	if config.GetTtl() == 0 && !config.GetAllowFragmentation() {
+		return
+	}
+	switch runtime.GOOS {
+	case "linux", "darwin", "freebsd", "windows":
+		// Fragmentation is allowed by default except on Linux, where path MTU discovery is disabled for it.
+		return
+	}
+	newError("TTL and fragmentation of UDP sockets are not supported on ", runtime.GOOS, ", ignoring").AtWarning().WriteToLog()
+}
+
 func isTCPSocket(network string) bool {
 	switch network {
 	case "tcp", "tcp4", "tcp6":
@@ -17,3 +63,9 @@ func isUDPSocket(network string) bool {
 		return false
 	}
 }
+
+// isIPv6Socket returns true if the socket is of AF_INET6, which may be dual stack. Dialers and listeners
+// pass the network with the address family, such as "udp6", to the control of their sockets.
+func isIPv6Socket(network string) bool {
+	return strings.HasSuffix(network, "6")
+}
@@ -1,9 +1,111 @@
 package internet
 
 import (
+	"encoding/binary"
+	"net"
+	"os"
 	"syscall"
+	"unsafe"
 )
 
+const (
+	sysPFIN        = 0x1
+	sysPFOUT       = 0x2
+	sysDIOCNATLOOK = 0xc0544417
+)
+
+// pfiocNatlook is struct pfioc_natlook of darwin, where ports are in unions of 4 bytes.
+type pfiocNatlook struct {
+	Saddr        [16]byte /* pf_addr */
+	Daddr        [16]byte /* pf_addr */
+	Rsaddr       [16]byte /* pf_addr */
+	Rdaddr       [16]byte /* pf_addr */
+	Sxport       [4]byte  /* pf_state_xport */
+	Dxport       [4]byte  /* pf_state_xport */
+	Rsxport      [4]byte  /* pf_state_xport */
+	Rdxport      [4]byte  /* pf_state_xport */
+	Af           uint8
+	Proto        uint8
+	ProtoVariant uint8
+	Direction    uint8
+}
+
+func ioctl(s uintptr, ioc int, b []byte) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, s, uintptr(ioc), uintptr(unsafe.Pointer(&b[0]))); errno != 0 {
+		return error(errno)
+	}
+	return nil
+}
+
+// OriginalDst uses ioctl to read original destination from /dev/pf
+func OriginalDst(la, ra net.Addr) (net.IP, int, error) {
+	f, err := os.Open("/dev/pf")
+	if err != nil {
+		return net.IP{}, -1, newError("failed to open device /dev/pf").Base(err)
+	}
+	defer f.Close()
+	fd := f.Fd()
+	b := make([]byte, unsafe.Sizeof(pfiocNatlook{}))
+	nl := (*pfiocNatlook)(unsafe.Pointer(&b[0]))
+	var raIP, laIP net.IP
+	var raPort, laPort int
+	switch la.(type) {
+	case *net.TCPAddr:
+		raIP = ra.(*net.TCPAddr).IP
+		laIP = la.(*net.TCPAddr).IP
+		raPort = ra.(*net.TCPAddr).Port
+		laPort = la.(*net.TCPAddr).Port
+		nl.Proto = syscall.IPPROTO_TCP
+	case *net.UDPAddr:
+		raIP = ra.(*net.UDPAddr).IP
+		laIP = la.(*net.UDPAddr).IP
+		raPort = ra.(*net.UDPAddr).Port
+		laPort = la.(*net.UDPAddr).Port
+		nl.Proto = syscall.IPPROTO_UDP
+	default:
+		return net.IP{}, -1, newError("unsupported address ", la)
+	}
+	if raIP.To4() != nil {
+		if laIP.IsUnspecified() {
+			laIP = net.ParseIP("127.0.0.1")
+		}
+		copy(nl.Saddr[:net.IPv4len], raIP.To4())
+		copy(nl.Daddr[:net.IPv4len], laIP.To4())
+		nl.Af = syscall.AF_INET
+	} else {
+		if laIP.IsUnspecified() {
+			laIP = net.ParseIP("::1")
+		}
+		copy(nl.Saddr[:], raIP.To16())
+		copy(nl.Daddr[:], laIP.To16())
+		nl.Af = syscall.AF_INET6
+	}
+	binary.BigEndian.PutUint16(nl.Sxport[:], uint16(raPort))
+	binary.BigEndian.PutUint16(nl.Dxport[:], uint16(laPort))
+	for _, dir := range []byte{sysPFOUT, sysPFIN} {
+		nl.Direction = dir
+		err = ioctl(fd, sysDIOCNATLOOK, b)
+		if err == nil || err != syscall.ENOENT {
+			break
+		}
+	}
+	if err != nil {
+		return net.IP{}, -1, os.NewSyscallError("ioctl", err)
+	}
+
+	odPort := int(binary.BigEndian.Uint16(nl.Rdxport[:]))
+	var odIP net.IP
+	switch nl.Af {
+	case syscall.AF_INET:
+		odIP = make(net.IP, net.IPv4len)
+		copy(odIP, nl.Rdaddr[:net.IPv4len])
+	case syscall.AF_INET6:
+		odIP = make(net.IP, net.IPv6len)
+		copy(odIP, nl.Rdaddr[:])
+	}
+	return odIP, odPort, nil
+}
+
 const (
 	// TCP_FASTOPEN is the socket option on darwin for TCP fast open.
 	TCP_FASTOPEN = 0x105 // nolint: golint,stylecheck
@@ -27,6 +129,11 @@ func applyOutboundSocketOptions(network string, address string, fd uintptr, conf
 		}
 	}
 
+	if isUDPSocket(network) {
+		if err := setUDPTTL(fd, network, config.Ttl); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -44,6 +151,33 @@ func applyInboundSocketOptions(network string, fd uintptr, config *SocketConfig)
 		}
 	}
 
+	if isUDPSocket(network) {
+		if err := setUDPTTL(fd, network, config.Ttl); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setUDPTTL sets the TTL of packets sent from the UDP socket, if ttl is not 0. Fragmentation is allowed by
+// default on darwin.
+func setUDPTTL(fd uintptr, network string, ttl uint32) error {
+	if ttl == 0 {
+		return nil
+	}
+	if !isIPv6Socket(network) {
+		if err := syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_TTL, int(ttl)); err != nil {
+			return newError("failed to set IP_TTL").Base(err)
+		}
+		return nil
+	}
+	if err := syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_UNICAST_HOPS, int(ttl)); err != nil {
+		return newError("failed to set IPV6_UNICAST_HOPS").Base(err)
+	}
+	// IPv4 packets of dual stack sockets have the TTL of IP_TTL, which AF_INET6 sockets may not accept.
+	if err := syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_TTL, int(ttl)); err != nil {
+		newError("failed to set IP_TTL of IPv6 socket").Base(err).AtDebug().WriteToLog()
+	}
 	return nil
 }
 
@@ -58,3 +192,7 @@ func setReuseAddr(fd uintptr) error {
 func setReusePort(fd uintptr) error {
 	return nil
 }
+
+func setRecvErr(fd uintptr) error {
+	return nil
+}
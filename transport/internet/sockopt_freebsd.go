@@ -142,6 +142,12 @@ func applyOutboundSocketOptions(network string, address string, fd uintptr, conf
 		}
 	}
 
+	if isUDPSocket(network) {
+		if err := setUDPTTL(fd, network, config.Ttl); err != nil {
+			return err
+		}
+	}
+
 	if config.Tproxy.IsEnabled() {
 		ip, _, _ := net.SplitHostPort(address)
 		if net.ParseIP(ip).To4() != nil {
@@ -176,6 +182,12 @@ func applyInboundSocketOptions(network string, fd uintptr, config *SocketConfig)
 		}
 	}
 
+	if isUDPSocket(network) {
+		if err := setUDPTTL(fd, network, config.Ttl); err != nil {
+			return err
+		}
+	}
+
 	if config.Tproxy.IsEnabled() {
 		if err := syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_BINDANY, 1); err != nil {
 			if err := syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_BINDANY, 1); err != nil {
@@ -187,6 +199,28 @@ func applyInboundSocketOptions(network string, fd uintptr, config *SocketConfig)
 	return nil
 }
 
+// setUDPTTL sets the TTL of packets sent from the UDP socket, if ttl is not 0. Fragmentation is allowed by
+// default on FreeBSD.
+func setUDPTTL(fd uintptr, network string, ttl uint32) error {
+	if ttl == 0 {
+		return nil
+	}
+	if !isIPv6Socket(network) {
+		if err := syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_TTL, int(ttl)); err != nil {
+			return newError("failed to set IP_TTL").Base(err)
+		}
+		return nil
+	}
+	if err := syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_UNICAST_HOPS, int(ttl)); err != nil {
+		return newError("failed to set IPV6_UNICAST_HOPS").Base(err)
+	}
+	// IPv4 packets of dual stack sockets have the TTL of IP_TTL, which AF_INET6 sockets may not accept.
+	if err := syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_TTL, int(ttl)); err != nil {
+		newError("failed to set IP_TTL of IPv6 socket").Base(err).AtDebug().WriteToLog()
+	}
+	return nil
+}
+
 func bindAddr(fd uintptr, ip []byte, port uint32) error {
 	setReuseAddr(fd)
 	setReusePort(fd)
@@ -228,3 +262,7 @@ func setReusePort(fd uintptr) error {
 	}
 	return nil
 }
+
+func setRecvErr(fd uintptr) error {
+	return nil
+}
@@ -58,6 +58,13 @@ func applyOutboundSocketOptions(network string, address string, fd uintptr, conf
 				return newError("failed to set TCP_FASTOPEN_CONNECT=0").Base(err)
 			}
 		}
+		setTCPCongestion(fd, config.TcpCongestion)
+	}
+
+	if isUDPSocket(network) {
+		if err := setUDPOptions(fd, config); err != nil {
+			return err
+		}
 	}
 
 	if config.Tproxy.IsEnabled() {
@@ -86,6 +93,15 @@ func applyInboundSocketOptions(network string, fd uintptr, config *SocketConfig)
 				return newError("failed to set TCP_FASTOPEN=0").Base(err)
 			}
 		}
+		// Sockets accepted by the listener inherit the algorithm.
+		setTCPCongestion(fd, config.TcpCongestion)
+	}
+
+	// Outgoing UDP sockets of the system dialer are created as listeners too.
+	if isUDPSocket(network) {
+		if err := setUDPOptions(fd, config); err != nil {
+			return err
+		}
 	}
 
 	if config.Tproxy.IsEnabled() {
@@ -118,3 +134,48 @@ func setReusePort(fd uintptr) error {
 	}
 	return nil
 }
+
+func setRecvErr(fd uintptr) error {
+	if err := syscall.SetsockoptInt(int(fd), syscall.SOL_IP, syscall.IP_RECVERR, 1); err != nil {
+		return newError("failed to set IP_RECVERR").Base(err)
+	}
+	// The socket may be dual stack, in which case both options apply.
+	if err := syscall.SetsockoptInt(int(fd), syscall.SOL_IPV6, syscall.IPV6_RECVERR, 1); err != nil && err != syscall.ENOPROTOOPT {
+		return newError("failed to set IPV6_RECVERR").Base(err)
+	}
+	return nil
+}
+
+// setTCPCongestion sets the congestion control algorithm of the socket, if any. Failures are not fatal, as
+// unsupported algorithms are warned about when the config is loaded.
+func setTCPCongestion(fd uintptr, algorithm string) {
+	if len(algorithm) == 0 {
+		return
+	}
+	if err := unix.SetsockoptString(int(fd), unix.IPPROTO_TCP, unix.TCP_CONGESTION, algorithm); err != nil {
+		newError("failed to set TCP_CONGESTION to ", algorithm).Base(err).AtDebug().WriteToLog()
+	}
+}
+
+// setUDPOptions sets the TTL of packets sent from the UDP socket, and disables path MTU discovery if
+// fragmentation is allowed, so that DF bit is cleared. The socket may be dual stack, in which case both IPv4
+// and IPv6 options apply.
+func setUDPOptions(fd uintptr, config *SocketConfig) error {
+	if config.Ttl > 0 {
+		if err := syscall.SetsockoptInt(int(fd), syscall.SOL_IP, syscall.IP_TTL, int(config.Ttl)); err != nil {
+			return newError("failed to set IP_TTL").Base(err)
+		}
+		if err := syscall.SetsockoptInt(int(fd), syscall.SOL_IPV6, syscall.IPV6_UNICAST_HOPS, int(config.Ttl)); err != nil && err != syscall.ENOPROTOOPT {
+			return newError("failed to set IPV6_UNICAST_HOPS").Base(err)
+		}
+	}
+	if config.AllowFragmentation {
+		if err := syscall.SetsockoptInt(int(fd), syscall.SOL_IP, syscall.IP_MTU_DISCOVER, syscall.IP_PMTUDISC_DONT); err != nil {
+			return newError("failed to set IP_MTU_DISCOVER").Base(err)
+		}
+		if err := syscall.SetsockoptInt(int(fd), syscall.SOL_IPV6, syscall.IPV6_MTU_DISCOVER, unix.IPV6_PMTUDISC_DONT); err != nil && err != syscall.ENOPROTOOPT {
+			return newError("failed to set IPV6_MTU_DISCOVER").Base(err)
+		}
+	}
+	return nil
+}
@@ -2,9 +2,12 @@ package internet_test
 
 import (
 	"context"
+	"strings"
 	"syscall"
 	"testing"
 
+	"golang.org/x/sys/unix"
+
 	"v2ray.com/core/common"
 	"v2ray.com/core/common/net"
 	"v2ray.com/core/testing/servers/tcp"
@@ -40,3 +43,106 @@ func TestSockOptMark(t *testing.T) {
 	})
 	common.Must(err)
 }
+
+func TestDialTransparentSource(t *testing.T) {
+	server := &tcp.Server{}
+	dest, err := server.Start()
+	common.Must(err)
+	defer server.Close()
+
+	source := net.ParseAddress("127.0.0.2")
+	ctx := ContextWithTransparentSource(context.Background(), source, dest.Address)
+	conn, err := DialSystem(ctx, dest, nil)
+	common.Must(err)
+	if ip := conn.LocalAddr().(*net.TCPAddr).IP; !ip.Equal(source.IP()) {
+		t.Error("expected source address ", source, ", but got ", ip)
+	}
+	conn.Close()
+
+	// The source address only applies to the destination it is set for.
+	ctx = ContextWithTransparentSource(context.Background(), source, net.LocalHostIPv6)
+	conn, err = DialSystem(ctx, dest, nil)
+	common.Must(err)
+	if ip := conn.LocalAddr().(*net.TCPAddr).IP; ip.Equal(source.IP()) {
+		t.Error("unexpected source address ", ip)
+	}
+	conn.Close()
+}
+
+func getTCPCongestion(conn syscall.Conn) string {
+	rawConn, err := conn.SyscallConn()
+	common.Must(err)
+	var algorithm string
+	common.Must(rawConn.Control(func(fd uintptr) {
+		algorithm, err = unix.GetsockoptString(int(fd), unix.IPPROTO_TCP, unix.TCP_CONGESTION)
+		common.Must(err)
+	}))
+	// The name is padded with NULs to the size of the option.
+	return strings.TrimRight(algorithm, "\x00")
+}
+
+func TestSockOptTCPCongestion(t *testing.T) {
+	// Reno is always built in, and allowed for unprivileged processes.
+	config := &SocketConfig{TcpCongestion: "reno"}
+
+	listener, err := ListenSystem(context.Background(), &net.TCPAddr{IP: net.LocalHostIP.IP()}, config)
+	common.Must(err)
+	defer listener.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			close(accepted)
+			return
+		}
+		accepted <- conn
+	}()
+
+	dest := net.DestinationFromAddr(listener.Addr())
+	conn, err := (&DefaultSystemDialer{}).Dial(context.Background(), nil, dest, config)
+	common.Must(err)
+	defer conn.Close()
+	if algorithm := getTCPCongestion(conn.(*net.TCPConn)); algorithm != "reno" {
+		t.Error("expect reno on dialed socket, but got ", algorithm)
+	}
+
+	serverConn := <-accepted
+	if serverConn == nil {
+		t.Fatal("failed to accept connection")
+	}
+	defer serverConn.Close()
+	if algorithm := getTCPCongestion(serverConn.(*net.TCPConn)); algorithm != "reno" {
+		t.Error("expect reno on accepted socket, but got ", algorithm)
+	}
+}
+
+func TestSockOptUDP(t *testing.T) {
+	config := &SocketConfig{Ttl: 42, AllowFragmentation: true}
+
+	for _, ip := range []net.IP{net.LocalHostIP.IP(), net.AnyIPv6.IP()} {
+		conn, err := ListenSystemPacket(context.Background(), &net.UDPAddr{IP: ip}, config)
+		common.Must(err)
+
+		rawConn, err := conn.(*net.UDPConn).SyscallConn()
+		common.Must(err)
+		common.Must(rawConn.Control(func(fd uintptr) {
+			if ttl, err := syscall.GetsockoptInt(int(fd), syscall.SOL_IP, syscall.IP_TTL); err != nil || ttl != 42 {
+				t.Error("expect IP_TTL 42 on ", ip, ", but got ", ttl, err)
+			}
+			if mode, err := syscall.GetsockoptInt(int(fd), syscall.SOL_IP, syscall.IP_MTU_DISCOVER); err != nil || mode != syscall.IP_PMTUDISC_DONT {
+				t.Error("expect IP_PMTUDISC_DONT on ", ip, ", but got ", mode, err)
+			}
+			if len(ip) != net.IPv6len {
+				return
+			}
+			if hops, err := syscall.GetsockoptInt(int(fd), syscall.SOL_IPV6, syscall.IPV6_UNICAST_HOPS); err != nil || hops != 42 {
+				t.Error("expect IPV6_UNICAST_HOPS 42 on ", ip, ", but got ", hops, err)
+			}
+			if mode, err := syscall.GetsockoptInt(int(fd), syscall.SOL_IPV6, syscall.IPV6_MTU_DISCOVER); err != nil || mode != unix.IPV6_PMTUDISC_DONT {
+				t.Error("expect IPV6_PMTUDISC_DONT on ", ip, ", but got ", mode, err)
+			}
+		}))
+		conn.Close()
+	}
+}
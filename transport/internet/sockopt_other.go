@@ -21,3 +21,7 @@ func setReuseAddr(fd uintptr) error {
 func setReusePort(fd uintptr) error {
 	return nil
 }
+
+func setRecvErr(fd uintptr) error {
+	return nil
+}
@@ -20,6 +20,25 @@ func setTFO(fd syscall.Handle, settings SocketConfig_TCPFastOpenState) error {
 	return nil
 }
 
+// setUDPTTL sets the TTL of packets sent from the UDP socket, if ttl is not 0. Fragmentation is allowed by
+// default on Windows.
+func setUDPTTL(fd syscall.Handle, network string, ttl uint32) error {
+	if ttl == 0 {
+		return nil
+	}
+	if !isIPv6Socket(network) {
+		return syscall.SetsockoptInt(fd, syscall.IPPROTO_IP, syscall.IP_TTL, int(ttl))
+	}
+	if err := syscall.SetsockoptInt(fd, syscall.IPPROTO_IPV6, syscall.IPV6_UNICAST_HOPS, int(ttl)); err != nil {
+		return err
+	}
+	// IPv4 packets of dual stack sockets have the TTL of IP_TTL.
+	if err := syscall.SetsockoptInt(fd, syscall.IPPROTO_IP, syscall.IP_TTL, int(ttl)); err != nil {
+		newError("failed to set IP_TTL of IPv6 socket").Base(err).AtDebug().WriteToLog()
+	}
+	return nil
+}
+
 func applyOutboundSocketOptions(network string, address string, fd uintptr, config *SocketConfig) error {
 	if isTCPSocket(network) {
 		if err := setTFO(syscall.Handle(fd), config.Tfo); err != nil {
@@ -27,6 +46,11 @@ func applyOutboundSocketOptions(network string, address string, fd uintptr, conf
 		}
 
 	}
+	if isUDPSocket(network) {
+		if err := setUDPTTL(syscall.Handle(fd), network, config.Ttl); err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
@@ -37,6 +61,11 @@ func applyInboundSocketOptions(network string, fd uintptr, config *SocketConfig)
 			return err
 		}
 	}
+	if isUDPSocket(network) {
+		if err := setUDPTTL(syscall.Handle(fd), network, config.Ttl); err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
@@ -52,3 +81,7 @@ func setReuseAddr(fd uintptr) error {
 func setReusePort(fd uintptr) error {
 	return nil
 }
+
+func setRecvErr(fd uintptr) error {
+	return nil
+}
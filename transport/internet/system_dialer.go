@@ -2,9 +2,14 @@ package internet
 
 import (
 	"context"
+	"os"
 	"syscall"
 	"time"
 
+	"github.com/golang/protobuf/proto"
+
+	"v2ray.com/core/common/dice"
+	"v2ray.com/core/common/errors"
 	"v2ray.com/core/common/net"
 	"v2ray.com/core/common/session"
 )
@@ -21,6 +26,104 @@ type DefaultSystemDialer struct {
 	controllers []controller
 }
 
+type dialerKey int
+
+const (
+	unreachableErrorsKey dialerKey = iota
+	fallbackIPsKey
+	transparentSourceKey
+	systemDialerKey
+	handshakeDeadlineKey
+	transportStatsKey
+	lookupIPKey
+	connectionRecycleKey
+)
+
+// ContextWithUnreachableErrors returns a context in which UDP connections dialed by the system
+// dialer report ICMP unreachable messages as read errors, like connected sockets do.
+func ContextWithUnreachableErrors(ctx context.Context) context.Context {
+	return context.WithValue(ctx, unreachableErrorsKey, true)
+}
+
+func unreachableErrorsFromContext(ctx context.Context) bool {
+	enabled, _ := ctx.Value(unreachableErrorsKey).(bool)
+	return enabled
+}
+
+// LookupIPFunc resolves a domain to its IP addresses.
+type LookupIPFunc func(domain string) ([]net.IP, error)
+
+// ContextWithLookupIP returns a context in which the system dialer resolves domains of destinations with
+// lookup, instead of the system resolver. Only sockets are dialed by the resolved addresses, while transports
+// and security layers over them still see the domains, e.g. for TLS server names.
+func ContextWithLookupIP(ctx context.Context, lookup LookupIPFunc) context.Context {
+	return context.WithValue(ctx, lookupIPKey, lookup)
+}
+
+func lookupIPFromContext(ctx context.Context) LookupIPFunc {
+	lookup, _ := ctx.Value(lookupIPKey).(LookupIPFunc)
+	return lookup
+}
+
+// resolveDestination resolves the domain of dest with the lookup function of ctx if any, and returns the
+// context carrying the other addresses for fallback.
+func resolveDestination(ctx context.Context, dest net.Destination) (context.Context, net.Destination, error) {
+	lookup := lookupIPFromContext(ctx)
+	if lookup == nil || !dest.Address.Family().IsDomain() {
+		return ctx, dest, nil
+	}
+	ips, err := lookup(dest.Address.Domain())
+	if err != nil {
+		return nil, dest, newError("failed to resolve ", dest.Address).Base(err)
+	}
+	if len(ips) == 0 {
+		return nil, dest, newError("no IP address for ", dest.Address)
+	}
+	ip := ips[dice.Roll(len(ips))]
+	dest.Address = net.IPAddress(ip)
+	return ContextWithFallbackIPs(ctx, ip, ips), dest, nil
+}
+
+type transparentSource struct {
+	source net.Address
+	dest   net.Address
+}
+
+// ContextWithTransparentSource returns a context in which the system dialer binds connections to
+// dest to the given source address with IP_TRANSPARENT, even if the address doesn't belong to this
+// host. If it can't, the connections are dialed from a local address instead.
+func ContextWithTransparentSource(ctx context.Context, source net.Address, dest net.Address) context.Context {
+	return context.WithValue(ctx, transparentSourceKey, &transparentSource{
+		source: source,
+		dest:   dest,
+	})
+}
+
+func transparentSourceFromContext(ctx context.Context, dest net.Address) net.Address {
+	transparent, ok := ctx.Value(transparentSourceKey).(*transparentSource)
+	if !ok || transparent.dest != dest {
+		return nil
+	}
+	return transparent.source
+}
+
+// isBindError returns true if the error means the source address could not be used.
+func isBindError(err error) bool {
+	err = errors.Cause(err)
+	if opErr, ok := err.(*net.OpError); ok {
+		err = opErr.Err
+	}
+	if sysErr, ok := err.(*os.SyscallError); ok {
+		err = sysErr.Err
+	}
+	switch err {
+	case syscall.EADDRNOTAVAIL, syscall.EADDRINUSE, syscall.EPERM, syscall.EACCES:
+		return true
+	default:
+		return false
+	}
+}
+
 func resolveSrcAddr(network net.Network, src net.Address) net.Addr {
 	if src == nil || src == net.AnyIP {
 		return nil
@@ -44,6 +147,41 @@ func hasBindAddr(sockopt *SocketConfig) bool {
 }
 
 func (d *DefaultSystemDialer) Dial(ctx context.Context, src net.Address, dest net.Destination, sockopt *SocketConfig) (net.Conn, error) {
+	if source := transparentSourceFromContext(ctx, dest.Address); source != nil {
+		transparentSockopt := &SocketConfig{}
+		if sockopt != nil {
+			transparentSockopt = proto.Clone(sockopt).(*SocketConfig)
+		}
+		transparentSockopt.Tproxy = SocketConfig_TProxy
+		transparentSockopt.BindAddress = nil
+		transparentSockopt.BindPort = 0
+
+		conn, err := d.dial(ctx, source, dest, transparentSockopt)
+		if err == nil || !isBindError(err) {
+			return conn, err
+		}
+		newError("failed to dial from original source ", source, ", using local address").Base(err).AtWarning().WriteToLog(session.ExportIDToError(ctx))
+	}
+
+	return d.dial(ctx, src, dest, sockopt)
+}
+
+func (d *DefaultSystemDialer) dial(ctx context.Context, src net.Address, dest net.Destination, sockopt *SocketConfig) (net.Conn, error) {
+	if path, ok := dest.UnixPath(); ok && dest.Network != net.Network_UDP {
+		if isAbstractUnixSocket(path) {
+			path = abstractUnixSocketName(path)
+		}
+		dialer := &net.Dialer{
+			Timeout: time.Second * 16,
+		}
+		return dialer.DialContext(ctx, "unix", path)
+	}
+
+	ctx, dest, err := resolveDestination(ctx, dest)
+	if err != nil {
+		return nil, err
+	}
+
 	if dest.Network == net.Network_UDP && !hasBindAddr(sockopt) {
 		srcAddr := resolveSrcAddr(net.Network_UDP, src)
 		if srcAddr == nil {
@@ -56,6 +194,11 @@ func (d *DefaultSystemDialer) Dial(ctx context.Context, src net.Address, dest ne
 		if err != nil {
 			return nil, err
 		}
+		if unreachableErrorsFromContext(ctx) {
+			if err := reportUnreachableErrors(packetConn); err != nil {
+				newError("failed to enable unreachable errors").Base(err).WriteToLog(session.ExportIDToError(ctx))
+			}
+		}
 		destAddr, err := net.ResolveUDPAddr("udp", dest.NetAddr())
 		if err != nil {
 			return nil, err
@@ -67,9 +210,18 @@ func (d *DefaultSystemDialer) Dial(ctx context.Context, src net.Address, dest ne
 	}
 
 	dialer := &net.Dialer{
-		Timeout:   time.Second * 16,
-		DualStack: true,
-		LocalAddr: resolveSrcAddr(dest.Network, src),
+		Timeout:       time.Second * 16,
+		DualStack:     true,
+		FallbackDelay: happyEyeballsDelay,
+		LocalAddr:     resolveSrcAddr(dest.Network, src),
+	}
+	if sockopt.GetDisableHappyEyeballs() {
+		// The system resolver races the families of domains unless the delay is negative.
+		dialer.FallbackDelay = -1
+	}
+	if deadline, ok := HandshakeDeadline(ctx); ok {
+		dialer.Timeout = 0
+		dialer.Deadline = deadline
 	}
 
 	if sockopt != nil || len(d.controllers) > 0 {
@@ -95,9 +247,35 @@ func (d *DefaultSystemDialer) Dial(ctx context.Context, src net.Address, dest ne
 		}
 	}
 
+	if dest.Network == net.Network_TCP && !sockopt.GetDisableHappyEyeballs() {
+		if ips := happyEyeballsAddresses(ctx, dest, dialer.LocalAddr); len(ips) > 1 {
+			return dialHappyEyeballs(ctx, func(ctx context.Context, address string) (net.Conn, error) {
+				return dialer.DialContext(ctx, "tcp", address)
+			}, ips, dest.Port, happyEyeballsDelay)
+		}
+	}
+
 	return dialer.DialContext(ctx, dest.Network.SystemString(), dest.NetAddr())
 }
 
+func reportUnreachableErrors(conn net.PacketConn) error {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return nil
+	}
+	rawConn, err := sc.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var setErr error
+	if err := rawConn.Control(func(fd uintptr) {
+		setErr = setRecvErr(fd)
+	}); err != nil {
+		return err
+	}
+	return setErr
+}
+
 type packetConnWrapper struct {
 	conn net.PacketConn
 	dest net.Addr
@@ -2,10 +2,10 @@ package internet
 
 import (
 	"context"
+	"os"
 	"runtime"
 	"syscall"
 
-	"github.com/pires/go-proxyproto"
 	"v2ray.com/core/common/net"
 	"v2ray.com/core/common/session"
 )
@@ -29,7 +29,14 @@ func getControlFunc(ctx context.Context, sockopt *SocketConfig, controllers []co
 				}
 			}
 
-			setReusePort(fd) // nolint: staticcheck
+			if sockopt == nil || !sockopt.DisableReusePort {
+				setReusePort(fd) // nolint: staticcheck
+			}
+			if sockopt != nil && sockopt.ReuseAddress {
+				if err := setReuseAddr(fd); err != nil {
+					newError("failed to reuse address ", address).Base(err).WriteToLog(session.ExportIDToError(ctx))
+				}
+			}
 
 			for _, controller := range controllers {
 				if err := controller(network, address, fd); err != nil {
@@ -41,54 +48,114 @@ func getControlFunc(ctx context.Context, sockopt *SocketConfig, controllers []co
 }
 
 func (dl *DefaultListener) Listen(ctx context.Context, addr net.Addr, sockopt *SocketConfig) (net.Listener, error) {
+	if ref := sockopt.GetInheritedSocket(); len(ref) > 0 {
+		// Options of the socket are set by systemd instead.
+		l, err := adoptListener(ref)
+		if err != nil {
+			return nil, err
+		}
+		if sockopt.AcceptProxyProtocol && !sockopt.ProxyProtocolInsideTls {
+			l = NewProxyProtocolListener(l)
+		}
+		return l, nil
+	}
+
 	var lc net.ListenConfig
-	var l net.Listener
-	var err error
+	var locker *FileLocker
 	var network, address string
 	switch addr := addr.(type) {
 	case *net.TCPAddr:
-		network = addr.Network()
+		network = ipNetwork(addr.Network(), addr.IP, sockopt)
 		address = addr.String()
 		lc.Control = getControlFunc(ctx, sockopt, dl.controllers)
 	case *net.UnixAddr:
 		lc.Control = nil
 		network = addr.Network()
 		address = addr.Name
-		if (runtime.GOOS == "linux" || runtime.GOOS == "android") && address[0] == '@' {
+		if isAbstractUnixSocket(address) {
 			// linux abstract unix domain socket is lockfree
-			if len(address) > 1 && address[1] == '@' {
-				// but may need padding to work with haproxy
-				fullAddr := make([]byte, len(syscall.RawSockaddrUnix{}.Path))
-				copy(fullAddr, address[1:])
-				address = string(fullAddr)
-			}
+			address = abstractUnixSocketName(address)
 		} else {
 			// normal unix domain socket needs lock
-			locker := &FileLocker{
+			locker = &FileLocker{
 				path: address + ".lock",
 			}
-			err := locker.Acquire()
-			if err != nil {
+			if err := locker.Acquire(); err != nil {
 				return nil, err
 			}
-			ctx = context.WithValue(ctx, address, locker) // nolint: golint,staticcheck
+			// With the lock held, an existing socket file is a leftover of a previous process.
+			if info, err := os.Lstat(address); err == nil && info.Mode()&os.ModeSocket != 0 {
+				os.Remove(address)
+			}
 		}
 	}
 
-	l, err = lc.Listen(ctx, network, address)
-	if sockopt != nil && sockopt.AcceptProxyProtocol {
-		policyFunc := func(upstream net.Addr) (proxyproto.Policy, error) { return proxyproto.REQUIRE, nil }
-		l = &proxyproto.Listener{Listener: l, Policy: policyFunc}
+	l, err := lc.Listen(ctx, network, address)
+	if err != nil {
+		if locker != nil {
+			locker.Release()
+		}
+		return nil, err
+	}
+	if locker != nil {
+		l = &unixListener{Listener: l, locker: locker}
+	}
+	if sockopt != nil && sockopt.AcceptProxyProtocol && !sockopt.ProxyProtocolInsideTls {
+		l = NewProxyProtocolListener(l)
+	}
+	return l, nil
+}
+
+// unixListener releases the lock of the socket file when it is closed. The socket file itself is
+// removed by the underlying listener.
+type unixListener struct {
+	net.Listener
+	locker *FileLocker
+}
+
+func (l *unixListener) Close() error {
+	err := l.Listener.Close()
+	l.locker.Release()
+	return err
+}
+
+func isAbstractUnixSocket(address string) bool {
+	return (runtime.GOOS == "linux" || runtime.GOOS == "android") && len(address) > 0 && address[0] == '@'
+}
+
+func abstractUnixSocketName(address string) string {
+	if len(address) > 1 && address[1] == '@' {
+		// but may need padding to work with haproxy
+		fullAddr := make([]byte, len(syscall.RawSockaddrUnix{}.Path))
+		copy(fullAddr, address[1:])
+		return string(fullAddr)
 	}
-	return l, err
+	return address
 }
 
 func (dl *DefaultListener) ListenPacket(ctx context.Context, addr net.Addr, sockopt *SocketConfig) (net.PacketConn, error) {
+	if ref := sockopt.GetInheritedSocket(); len(ref) > 0 {
+		return adoptPacketConn(ref)
+	}
+
 	var lc net.ListenConfig
 
 	lc.Control = getControlFunc(ctx, sockopt, dl.controllers)
 
-	return lc.ListenPacket(ctx, addr.Network(), addr.String())
+	network := addr.Network()
+	if addr, ok := addr.(*net.UDPAddr); ok {
+		network = ipNetwork(network, addr.IP, sockopt)
+	}
+	return lc.ListenPacket(ctx, network, addr.String())
+}
+
+// ipNetwork returns the network to listen on the IP. IPv6 listeners are restricted to IPv6 if the
+// socket config asks for it.
+func ipNetwork(network string, ip net.IP, sockopt *SocketConfig) string {
+	if sockopt != nil && sockopt.V6Only && len(ip) == net.IPv6len && ip.To4() == nil {
+		return network + "6"
+	}
+	return network
 }
 
 // RegisterListenerController adds a controller to the effective system listener.
@@ -0,0 +1,142 @@
+package internet
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"v2ray.com/core/common/net"
+)
+
+// listenFdsStart is the first file descriptor passed by systemd socket activation. See sd_listen_fds(3).
+const listenFdsStart = 3
+
+type inheritedSocket struct {
+	fd   int
+	file *os.File
+	name string
+}
+
+// matches returns true if the socket is referred by ref, which is either the number of its file descriptor,
+// or its FileDescriptorName.
+func (s *inheritedSocket) matches(ref string) bool {
+	if fd, err := strconv.Atoi(ref); err == nil {
+		return fd == s.fd
+	}
+	return s.name == ref
+}
+
+var (
+	inheritedSocketsOnce sync.Once
+	inheritedSockets     []*inheritedSocket
+	inheritedSocketsErr  error
+)
+
+// loadInheritedSockets returns the sockets passed by systemd. The environment is read once, and cleared
+// afterwards, so that child processes don't take the sockets as theirs.
+func loadInheritedSockets() ([]*inheritedSocket, error) {
+	inheritedSocketsOnce.Do(func() {
+		pid := os.Getenv("LISTEN_PID")
+		fds := os.Getenv("LISTEN_FDS")
+		names := os.Getenv("LISTEN_FDNAMES")
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+
+		if len(fds) == 0 {
+			inheritedSocketsErr = newError("no sockets passed by systemd, LISTEN_FDS is not set")
+			return
+		}
+		if pid != strconv.Itoa(os.Getpid()) {
+			inheritedSocketsErr = newError("sockets passed by systemd are for process ", pid, " instead of ", os.Getpid())
+			return
+		}
+		n, err := strconv.Atoi(fds)
+		if err != nil || n <= 0 {
+			inheritedSocketsErr = newError("invalid LISTEN_FDS: ", fds)
+			return
+		}
+		nameList := strings.Split(names, ":")
+		for i := 0; i < n; i++ {
+			fd := listenFdsStart + i
+			socket := &inheritedSocket{
+				fd:   fd,
+				file: os.NewFile(uintptr(fd), "LISTEN_FD_"+strconv.Itoa(fd)),
+			}
+			if i < len(nameList) {
+				socket.name = nameList[i]
+			}
+			inheritedSockets = append(inheritedSockets, socket)
+		}
+	})
+	return inheritedSockets, inheritedSocketsErr
+}
+
+// findInheritedSockets returns the sockets passed by systemd that ref refers to.
+func findInheritedSockets(ref string) ([]*inheritedSocket, error) {
+	sockets, err := loadInheritedSockets()
+	if err != nil {
+		return nil, err
+	}
+	var found []*inheritedSocket
+	for _, socket := range sockets {
+		if socket.matches(ref) {
+			found = append(found, socket)
+		}
+	}
+	if len(found) == 0 {
+		return nil, newError("socket not passed by systemd: ", ref)
+	}
+	return found, nil
+}
+
+// adoptListener returns a listener of the stream socket passed by systemd that ref refers to. The file
+// descriptor is duplicated, so the socket may be adopted again after the listener is closed.
+func adoptListener(ref string) (net.Listener, error) {
+	sockets, err := findInheritedSockets(ref)
+	if err != nil {
+		return nil, err
+	}
+	for _, socket := range sockets {
+		if l, err := net.FileListener(socket.file); err == nil {
+			return l, nil
+		}
+	}
+	return nil, newError("no listening stream socket passed by systemd: ", ref)
+}
+
+// adoptPacketConn returns a connection of the datagram socket passed by systemd that ref refers to. The
+// file descriptor is duplicated, as in adoptListener.
+func adoptPacketConn(ref string) (net.PacketConn, error) {
+	sockets, err := findInheritedSockets(ref)
+	if err != nil {
+		return nil, err
+	}
+	for _, socket := range sockets {
+		if conn, err := net.FilePacketConn(socket.file); err == nil {
+			return conn, nil
+		}
+	}
+	return nil, newError("no datagram socket passed by systemd: ", ref)
+}
+
+// InheritedSocketAddr returns the local address of the socket passed by systemd that ref refers to. If
+// ref refers to both a stream and a datagram socket, the address of the stream socket is returned.
+//
+// v2ray:api:beta
+func InheritedSocketAddr(ref string) (net.Addr, error) {
+	if _, err := findInheritedSockets(ref); err != nil {
+		return nil, err
+	}
+	if l, err := adoptListener(ref); err == nil {
+		defer l.Close()
+		return l.Addr(), nil
+	}
+	conn, err := adoptPacketConn(ref)
+	if err != nil {
+		return nil, newError("neither a listening stream socket nor a datagram socket passed by systemd: ", ref)
+	}
+	defer conn.Close()
+	return conn.LocalAddr(), nil
+}
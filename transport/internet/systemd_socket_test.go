@@ -0,0 +1,101 @@
+// +build linux
+
+package internet_test
+
+import (
+	"context"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"testing"
+
+	"v2ray.com/core/common"
+	"v2ray.com/core/transport/internet"
+)
+
+// TestInheritedSocket passes a TCP and a UDP socket to a child process as systemd does, and adopts them
+// in the child.
+func TestInheritedSocket(t *testing.T) {
+	if os.Getenv("V2RAY_TEST_INHERITED_SOCKET") == "1" {
+		adoptInheritedSockets(t)
+		return
+	}
+
+	if _, err := internet.InheritedSocketAddr("3"); err == nil {
+		t.Error("expect error without sockets passed by systemd")
+	}
+
+	tcpListener, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	common.Must(err)
+	defer tcpListener.Close()
+	udpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	common.Must(err)
+	defer udpConn.Close()
+	tcpFile, err := tcpListener.File()
+	common.Must(err)
+	defer tcpFile.Close()
+	udpFile, err := udpConn.File()
+	common.Must(err)
+	defer udpFile.Close()
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestInheritedSocket$")
+	cmd.Env = append(os.Environ(),
+		"V2RAY_TEST_INHERITED_SOCKET=1",
+		"LISTEN_FDS=2",
+		"LISTEN_FDNAMES=web:web",
+		"TEST_TCP_ADDR="+tcpListener.Addr().String(),
+		"TEST_UDP_ADDR="+udpConn.LocalAddr().String(),
+	)
+	cmd.ExtraFiles = []*os.File{tcpFile, udpFile}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatal(err, "\n", string(output))
+	}
+}
+
+func adoptInheritedSockets(t *testing.T) {
+	os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	tcpAddr := os.Getenv("TEST_TCP_ADDR")
+	udpAddr := os.Getenv("TEST_UDP_ADDR")
+
+	addr, err := internet.InheritedSocketAddr("web")
+	common.Must(err)
+	if addr.String() != tcpAddr {
+		t.Error("expect address ", tcpAddr, " of socket web, but got ", addr)
+	}
+	if _, err := internet.InheritedSocketAddr("api"); err == nil {
+		t.Error("expect error for socket not passed")
+	}
+	if os.Getenv("LISTEN_FDS") != "" {
+		t.Error("expect LISTEN_FDS to be cleared")
+	}
+
+	listener, err := internet.ListenSystem(context.Background(), &net.TCPAddr{}, &internet.SocketConfig{InheritedSocket: "web"})
+	common.Must(err)
+	if listener.Addr().String() != tcpAddr {
+		t.Error("expect listener on ", tcpAddr, ", but got ", listener.Addr())
+	}
+	conn, err := net.Dial("tcp", tcpAddr)
+	common.Must(err)
+	conn.Close()
+	accepted, err := listener.Accept()
+	common.Must(err)
+	accepted.Close()
+	common.Must(listener.Close())
+
+	packetConn, err := internet.ListenSystemPacket(context.Background(), &net.UDPAddr{}, &internet.SocketConfig{InheritedSocket: "4"})
+	common.Must(err)
+	if packetConn.LocalAddr().String() != udpAddr {
+		t.Error("expect packet conn on ", udpAddr, ", but got ", packetConn.LocalAddr())
+	}
+	common.Must(packetConn.Close())
+
+	if _, err := internet.ListenSystemPacket(context.Background(), &net.UDPAddr{}, &internet.SocketConfig{InheritedSocket: "3"}); err == nil {
+		t.Error("expect error for adopting a stream socket as datagram socket")
+	}
+
+	// The socket may be adopted again after its listener is closed.
+	listener, err = internet.ListenSystem(context.Background(), &net.TCPAddr{}, &internet.SocketConfig{InheritedSocket: "3"})
+	common.Must(err)
+	common.Must(listener.Close())
+}
@@ -4,6 +4,7 @@ package tcp
 
 import (
 	"context"
+	"time"
 
 	"v2ray.com/core/common"
 	"v2ray.com/core/common/net"
@@ -21,7 +22,6 @@ func Dial(ctx context.Context, dest net.Destination, streamSettings *internet.Me
 	}
 
 	if config := tls.ConfigFromStreamSettings(streamSettings); config != nil {
-		tlsConfig := config.GetTLSConfig(tls.WithDestination(dest))
 		/*
 			if config.IsExperiment8357() {
 				conn = tls.UClient(conn, tlsConfig)
@@ -29,7 +29,19 @@ func Dial(ctx context.Context, dest net.Destination, streamSettings *internet.Me
 				conn = tls.Client(conn, tlsConfig)
 			}
 		*/
-		conn = tls.Client(conn, tlsConfig)
+		conn = config.Client(conn, tls.WithDestination(dest))
+		if deadline, ok := internet.HandshakeDeadline(ctx); ok {
+			if err := handshakeTLS(conn.(*tls.Conn), deadline); err != nil {
+				conn.Close()
+				return nil, err
+			}
+		}
+		if sockopt := streamSettings.SocketSettings; sockopt != nil && sockopt.SendProxyProtocol > 0 && sockopt.ProxyProtocolInsideTls {
+			if err := internet.WriteProxyProtocol(ctx, conn, sockopt.SendProxyProtocol); err != nil {
+				conn.Close()
+				return nil, err
+			}
+		}
 	}
 
 	tcpSettings := streamSettings.ProtocolSettings.(*Config)
@@ -47,6 +59,17 @@ func Dial(ctx context.Context, dest net.Destination, streamSettings *internet.Me
 	return internet.Connection(conn), nil
 }
 
+// handshakeTLS completes the TLS handshake of conn by the deadline, instead of on the first read or write.
+func handshakeTLS(conn *tls.Conn, deadline time.Time) error {
+	if err := conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+	if err := conn.Handshake(); err != nil {
+		return newError("failed to complete TLS handshake").Base(err)
+	}
+	return conn.SetDeadline(time.Time{})
+}
+
 func init() {
 	common.Must(internet.RegisterTransportDialer(protocolName, Dial))
 }
@@ -22,7 +22,8 @@ type Listener struct {
 	authConfig internet.ConnectionAuthenticator
 	config     *Config
 	addConn    internet.ConnHandler
-	locker     *internet.FileLocker // for unix domain socket
+	// proxyProtocol is set if the PROXY protocol header is read after the TLS handshake.
+	proxyProtocol bool
 }
 
 // ListenTCP creates a new Listener based on configurations.
@@ -32,11 +33,11 @@ func ListenTCP(ctx context.Context, address net.Address, port net.Port, streamSe
 	}
 	tcpSettings := streamSettings.ProtocolSettings.(*Config)
 	l.config = tcpSettings
-	if l.config != nil {
+	if l.config != nil && l.config.AcceptProxyProtocol {
 		if streamSettings.SocketSettings == nil {
 			streamSettings.SocketSettings = &internet.SocketConfig{}
 		}
-		streamSettings.SocketSettings.AcceptProxyProtocol = l.config.AcceptProxyProtocol
+		streamSettings.SocketSettings.AcceptProxyProtocol = true
 	}
 	var listener net.Listener
 	var err error
@@ -49,10 +50,6 @@ func ListenTCP(ctx context.Context, address net.Address, port net.Port, streamSe
 			return nil, newError("failed to listen Unix Domain Socket on ", address).Base(err)
 		}
 		newError("listening Unix Domain Socket on ", address).WriteToLog(session.ExportIDToError(ctx))
-		locker := ctx.Value(address.Domain())
-		if locker != nil {
-			l.locker = locker.(*internet.FileLocker)
-		}
 	} else {
 		listener, err = internet.ListenSystem(ctx, &net.TCPAddr{
 			IP:   address.IP(),
@@ -72,6 +69,9 @@ func ListenTCP(ctx context.Context, address net.Address, port net.Port, streamSe
 
 	if config := tls.ConfigFromStreamSettings(streamSettings); config != nil {
 		l.tlsConfig = config.GetTLSConfig(tls.WithNextProto("h2"))
+		if sockopt := streamSettings.SocketSettings; sockopt != nil && sockopt.AcceptProxyProtocol && sockopt.ProxyProtocolInsideTls {
+			l.proxyProtocol = true
+		}
 	}
 
 	if tcpSettings.HeaderSettings != nil {
@@ -107,6 +107,9 @@ func (v *Listener) keepAccepting() {
 
 		if v.tlsConfig != nil {
 			conn = tls.Server(conn, v.tlsConfig)
+			if v.proxyProtocol {
+				conn = internet.NewProxyProtocolConn(conn)
+			}
 		}
 		if v.authConfig != nil {
 			conn = v.authConfig.Server(conn)
@@ -123,9 +126,6 @@ func (v *Listener) Addr() net.Addr {
 
 // Close implements internet.Listener.Close.
 func (v *Listener) Close() error {
-	if v.locker != nil {
-		v.locker.Release()
-	}
 	return v.listener.Close()
 }
 
@@ -3,6 +3,7 @@ package internet
 import (
 	"context"
 
+	"v2ray.com/core/common/errors"
 	"v2ray.com/core/common/net"
 )
 
@@ -30,7 +31,7 @@ type Listener interface {
 // ListenUnix is the UDS version of ListenTCP
 func ListenUnix(ctx context.Context, address net.Address, settings *MemoryStreamConfig, handler ConnHandler) (Listener, error) {
 	if settings == nil {
-		s, err := ToMemoryStreamConfig(nil)
+		s, err := ToMemoryStreamConfigWithContext(ctx, nil)
 		if err != nil {
 			return nil, newError("failed to create default unix stream settings").Base(err)
 		}
@@ -42,7 +43,7 @@ func ListenUnix(ctx context.Context, address net.Address, settings *MemoryStream
 	if listenFunc == nil {
 		return nil, newError(protocol, " unix istener not registered.").AtError()
 	}
-	listener, err := listenFunc(ctx, address, net.Port(0), settings, handler)
+	listener, err := listenFunc(ctx, address, net.Port(0), settings, acceptWithReadv(ctx, countAccepted(ctx, protocol, handler)))
 	if err != nil {
 		return nil, newError("failed to listen on unix address: ", address).Base(err)
 	}
@@ -50,7 +51,7 @@ func ListenUnix(ctx context.Context, address net.Address, settings *MemoryStream
 }
 func ListenTCP(ctx context.Context, address net.Address, port net.Port, settings *MemoryStreamConfig, handler ConnHandler) (Listener, error) {
 	if settings == nil {
-		s, err := ToMemoryStreamConfig(nil)
+		s, err := ToMemoryStreamConfigWithContext(ctx, nil)
 		if err != nil {
 			return nil, newError("failed to create default stream settings").Base(err)
 		}
@@ -70,7 +71,7 @@ func ListenTCP(ctx context.Context, address net.Address, port net.Port, settings
 	if listenFunc == nil {
 		return nil, newError(protocol, " listener not registered.").AtError()
 	}
-	listener, err := listenFunc(ctx, address, port, settings, handler)
+	listener, err := listenFunc(ctx, address, port, settings, acceptWithReadv(ctx, countAccepted(ctx, protocol, handler)))
 	if err != nil {
 		return nil, newError("failed to listen on address: ", address, ":", port).Base(err)
 	}
@@ -81,12 +82,26 @@ func ListenTCP(ctx context.Context, address net.Address, port net.Port, settings
 //
 // v2ray:api:beta
 func ListenSystem(ctx context.Context, addr net.Addr, sockopt *SocketConfig) (net.Listener, error) {
-	return effectiveListener.Listen(ctx, addr, sockopt)
+	l, err := effectiveListener.Listen(ctx, addr, sockopt)
+	if err != nil {
+		return nil, errors.Classify(err, errors.KindBind)
+	}
+	return l, nil
 }
 
 // ListenSystemPacket listens on a local address for incoming UDP connections.
 //
 // v2ray:api:beta
 func ListenSystemPacket(ctx context.Context, addr net.Addr, sockopt *SocketConfig) (net.PacketConn, error) {
-	return effectiveListener.ListenPacket(ctx, addr, sockopt)
+	var conn net.PacketConn
+	var err error
+	if udpAddr := demuxAddress(addr, sockopt); udpAddr != nil {
+		conn, err = listenDemux(ctx, udpAddr, sockopt)
+	} else {
+		conn, err = effectiveListener.ListenPacket(ctx, addr, sockopt)
+	}
+	if err != nil {
+		return nil, errors.Classify(err, errors.KindBind)
+	}
+	return conn, nil
 }
@@ -211,10 +211,27 @@ func (c *Config) GetTLSConfig(opts ...Option) *tls.Config {
 		config.ServerName = sn
 	}
 
+	if !c.AllowInsecure && len(c.FailedChainDir) > 0 && len(config.ServerName) > 0 {
+		config.InsecureSkipVerify = true
+		config.VerifyPeerCertificate = verifyPeerCertificate(config.RootCAs, config.ServerName)
+	}
+
+	if !c.AllowInsecure && c.ExpiryWarningDays > 0 {
+		config.VerifyConnection = c.verifyConnection(config.ServerName)
+	}
+
 	if len(config.NextProtos) == 0 {
 		config.NextProtos = []string{"h2", "http/1.1"}
 	}
 
+	if c.EnableSessionResumption && (c.SessionTicketKeyRotation > 0 || len(c.SessionTicketKey) > 0) {
+		keys := newSessionTicketKeys(config, c.SessionTicketKey, c.SessionTicketKeyRotation)
+		keys.update(time.Now())
+		if c.SessionTicketKeyRotation > 0 {
+			config.GetConfigForClient = keys.getConfigForClient
+		}
+	}
+
 	return config
 }
 
@@ -224,6 +241,9 @@ type Option func(*tls.Config)
 // WithDestination sets the server name in TLS config.
 func WithDestination(dest net.Destination) Option {
 	return func(config *tls.Config) {
+		if _, isUnix := dest.UnixPath(); isUnix {
+			return
+		}
 		if dest.Address.Family().IsDomain() && config.ServerName == "" {
 			config.ServerName = dest.Address.Domain()
 		}
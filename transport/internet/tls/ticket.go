@@ -0,0 +1,90 @@
+// +build !confonly
+
+package tls
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"v2ray.com/core/common"
+)
+
+// sessionTicketKeys sets the session ticket keys of a server config, and rotates them when handshakes
+// start in a new interval.
+type sessionTicketKeys struct {
+	sync.Mutex
+	config   *tls.Config
+	secret   []byte
+	interval int64
+	epoch    int64
+	current  [32]byte
+	started  bool
+}
+
+func newSessionTicketKeys(config *tls.Config, secret []byte, interval uint32) *sessionTicketKeys {
+	return &sessionTicketKeys{
+		config:   config,
+		secret:   secret,
+		interval: int64(interval),
+	}
+}
+
+// deriveKey returns the key of the epoch, derived from the shared secret.
+func (k *sessionTicketKeys) deriveKey(epoch int64) [32]byte {
+	var key [32]byte
+	var e [8]byte
+	binary.BigEndian.PutUint64(e[:], uint64(epoch))
+	mac := hmac.New(sha256.New, k.secret)
+	common.Must2(mac.Write([]byte("v2ray session ticket key")))
+	common.Must2(mac.Write(e[:]))
+	copy(key[:], mac.Sum(nil))
+	return key
+}
+
+func (k *sessionTicketKeys) newKey(epoch int64) [32]byte {
+	if len(k.secret) > 0 {
+		return k.deriveKey(epoch)
+	}
+	var key [32]byte
+	common.Must2(rand.Read(key[:]))
+	return key
+}
+
+// update sets the keys of the interval of now, if they are not set yet. The key of the previous interval
+// is kept for resuming the sessions it encrypted.
+func (k *sessionTicketKeys) update(now time.Time) {
+	var epoch int64
+	if k.interval > 0 {
+		epoch = now.Unix() / k.interval
+	}
+
+	k.Lock()
+	defer k.Unlock()
+
+	if k.started && epoch == k.epoch {
+		return
+	}
+	keys := make([][32]byte, 0, 2)
+	keys = append(keys, k.newKey(epoch))
+	switch {
+	case len(k.secret) > 0 && k.interval > 0:
+		keys = append(keys, k.deriveKey(epoch-1))
+	case k.started && epoch == k.epoch+1:
+		keys = append(keys, k.current)
+	}
+	k.config.SetSessionTicketKeys(keys)
+	k.current = keys[0]
+	k.epoch = epoch
+	k.started = true
+}
+
+// getConfigForClient rotates the keys before handshakes, without changing the config.
+func (k *sessionTicketKeys) getConfigForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	k.update(time.Now())
+	return nil, nil
+}
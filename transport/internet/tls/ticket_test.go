@@ -0,0 +1,108 @@
+package tls
+
+import (
+	"crypto/tls"
+	"net"
+	"testing"
+	"time"
+
+	"v2ray.com/core/common"
+	"v2ray.com/core/common/protocol/tls/cert"
+)
+
+func newTicketTestServer(t *testing.T, keys func(*tls.Config) *sessionTicketKeys) (*tls.Config, *sessionTicketKeys) {
+	certPEM, keyPEM := cert.MustGenerate(nil, cert.DNSNames("v2fly.org")).ToPEM()
+	certificate, err := tls.X509KeyPair(certPEM, keyPEM)
+	common.Must(err)
+	config := &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+	}
+	return config, keys(config)
+}
+
+// handshake connects to a server with the config, and returns whether the session is resumed.
+func handshake(t *testing.T, serverConfig *tls.Config, clientConfig *tls.Config) bool {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	common.Must(err)
+	defer listener.Close()
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		server := tls.Server(conn, serverConfig)
+		b := make([]byte, 1)
+		if _, err := server.Read(b); err != nil {
+			return
+		}
+		server.Write(b)
+	}()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	common.Must(err)
+	defer conn.Close()
+	client := tls.Client(conn, clientConfig)
+	common.Must2(client.Write([]byte{1}))
+	common.Must2(client.Read(make([]byte, 1)))
+	return client.ConnectionState().DidResume
+}
+
+func newTicketTestClient() *tls.Config {
+	return &tls.Config{
+		ServerName:         "v2fly.org",
+		InsecureSkipVerify: true,
+		ClientSessionCache: tls.NewLRUClientSessionCache(8),
+	}
+}
+
+func TestSessionTicketKeyRotation(t *testing.T) {
+	now := time.Now()
+	server, keys := newTicketTestServer(t, func(config *tls.Config) *sessionTicketKeys {
+		return newSessionTicketKeys(config, nil, 3600)
+	})
+	keys.update(now)
+
+	client := newTicketTestClient()
+	if handshake(t, server, client) {
+		t.Error("first handshake is resumed")
+	}
+	if !handshake(t, server, client) {
+		t.Error("session is not resumed")
+	}
+
+	keys.update(now.Add(time.Hour))
+	if !handshake(t, server, client) {
+		t.Error("session is not resumed with the previous key")
+	}
+
+	client = newTicketTestClient()
+	handshake(t, server, client)
+	keys.update(now.Add(time.Hour * 3))
+	if handshake(t, server, client) {
+		t.Error("session is resumed with an expired key")
+	}
+}
+
+func TestSharedSessionTicketKey(t *testing.T) {
+	secret := make([]byte, 32)
+	now := time.Now()
+	newServer := func() *tls.Config {
+		server, keys := newTicketTestServer(t, func(config *tls.Config) *sessionTicketKeys {
+			return newSessionTicketKeys(config, secret, 3600)
+		})
+		keys.update(now)
+		return server
+	}
+	serverA := newServer()
+	serverB := newServer()
+
+	client := newTicketTestClient()
+	if handshake(t, serverA, client) {
+		t.Error("first handshake is resumed")
+	}
+	if !handshake(t, serverB, client) {
+		t.Error("session is not resumed by another server")
+	}
+}
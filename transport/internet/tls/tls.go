@@ -4,6 +4,7 @@ package tls
 
 import (
 	"crypto/tls"
+	"sync/atomic"
 
 	"v2ray.com/core/common/buf"
 	"v2ray.com/core/common/net"
@@ -17,6 +18,32 @@ var (
 
 type Conn struct {
 	*tls.Conn
+	// handshakeError is called with the error of the handshake, once, if the handshake fails.
+	handshakeError func(error)
+	reported       uint32
+}
+
+// Handshake runs the handshake if it has not run yet, and reports its error.
+func (c *Conn) Handshake() error {
+	err := c.Conn.Handshake()
+	if err != nil && c.handshakeError != nil && atomic.CompareAndSwapUint32(&c.reported, 0, 1) {
+		c.handshakeError(err)
+	}
+	return err
+}
+
+func (c *Conn) Read(b []byte) (int, error) {
+	if err := c.Handshake(); err != nil {
+		return 0, err
+	}
+	return c.Conn.Read(b)
+}
+
+func (c *Conn) Write(b []byte) (int, error) {
+	if err := c.Handshake(); err != nil {
+		return 0, err
+	}
+	return c.Conn.Write(b)
 }
 
 func (c *Conn) WriteMultiBuffer(mb buf.MultiBuffer) error {
@@ -43,6 +70,18 @@ func Client(c net.Conn, config *tls.Config) net.Conn {
 	return &Conn{Conn: tlsConn}
 }
 
+// Client initiates a TLS client handshake on the given connection, with the TLS config built from c and opts.
+// The certificate of the server is reported if it fails the verification.
+func (c *Config) Client(conn net.Conn, opts ...Option) net.Conn {
+	config := c.GetTLSConfig(opts...)
+	return &Conn{
+		Conn: tls.Client(conn, config),
+		handshakeError: func(err error) {
+			c.ReportVerifyError(config.ServerName, err)
+		},
+	}
+}
+
 /*
 func copyConfig(c *tls.Config) *utls.Config {
 	return &utls.Config{
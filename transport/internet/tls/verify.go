@@ -0,0 +1,183 @@
+// +build !confonly
+
+package tls
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const serverReportInterval = time.Hour
+
+// serverReports limits reports about the certificates of a server to one per interval.
+type serverReports struct {
+	access sync.Mutex
+	last   map[string]time.Time
+}
+
+func (r *serverReports) allow(serverName string, now time.Time) bool {
+	r.access.Lock()
+	defer r.access.Unlock()
+
+	if last, found := r.last[serverName]; found && now.Sub(last) < serverReportInterval {
+		return false
+	}
+	if r.last == nil {
+		r.last = make(map[string]time.Time)
+	}
+	r.last[serverName] = now
+	return true
+}
+
+var (
+	expiryWarnings serverReports
+	chainDumps     serverReports
+)
+
+// describeCertificate returns the fields of the certificate that tell what is wrong with it.
+func describeCertificate(c *x509.Certificate) string {
+	names := append([]string(nil), c.DNSNames...)
+	for _, ip := range c.IPAddresses {
+		names = append(names, ip.String())
+	}
+	return fmt.Sprintf("subject: %s, issuer: %s, SANs: [%s], notAfter: %s",
+		c.Subject, c.Issuer, strings.Join(names, ", "), c.NotAfter.Format(time.RFC3339))
+}
+
+// dumpChain saves the chain in PEM to a file of the server in the directory.
+func dumpChain(dir string, serverName string, rawCerts [][]byte, now time.Time) (string, error) {
+	var content bytes.Buffer
+	for _, raw := range rawCerts {
+		if err := pem.Encode(&content, &pem.Block{Type: "CERTIFICATE", Bytes: raw}); err != nil {
+			return "", err
+		}
+	}
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' {
+			return r
+		}
+		return '_'
+	}, serverName)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%s-%d.pem", name, now.Unix()))
+	return path, ioutil.WriteFile(path, content.Bytes(), 0600)
+}
+
+// verifyConnection returns a function that warns about the certificate of the server when it expires soon. It
+// runs after the TLS library verifies the server, including on resumed sessions.
+func (c *Config) verifyConnection(serverName string) func(tls.ConnectionState) error {
+	return func(state tls.ConnectionState) error {
+		if len(state.PeerCertificates) == 0 {
+			return nil
+		}
+		serverName := serverName
+		if len(serverName) == 0 {
+			serverName = state.ServerName
+		}
+		now := time.Now()
+		leaf := state.PeerCertificates[0]
+		left := leaf.NotAfter.Sub(now)
+		if left < time.Duration(c.ExpiryWarningDays)*24*time.Hour && expiryWarnings.allow(serverName, now) {
+			newError("certificate of server ", serverName, " expires in ", left.Round(time.Hour), " (", describeCertificate(leaf), ")").AtWarning().WriteToLog()
+		}
+		return nil
+	}
+}
+
+// chainError is a failure to verify the certificate of a server, which keeps the chain that the server presents.
+type chainError struct {
+	err      error
+	rawCerts [][]byte
+}
+
+func (e *chainError) Error() string {
+	return e.err.Error()
+}
+
+func (e *chainError) Unwrap() error {
+	return e.err
+}
+
+// verifyPeerCertificate returns a function that verifies the chain of the server as the TLS library does, and
+// keeps the whole chain in the error if it fails. The TLS library only tells the certificate that fails, so it
+// replaces the verification of the library when failed chains are saved.
+func verifyPeerCertificate(roots *x509.CertPool, serverName string) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return newError("server ", serverName, " presents no certificate")
+		}
+		certs := make([]*x509.Certificate, len(rawCerts))
+		for i, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return &chainError{err: err, rawCerts: rawCerts}
+			}
+			certs[i] = cert
+		}
+		opts := x509.VerifyOptions{
+			Roots:         roots,
+			DNSName:       serverName,
+			Intermediates: x509.NewCertPool(),
+		}
+		for _, cert := range certs[1:] {
+			opts.Intermediates.AddCert(cert)
+		}
+		if _, err := certs[0].Verify(opts); err != nil {
+			return &chainError{err: err, rawCerts: rawCerts}
+		}
+		return nil
+	}
+}
+
+// verifyErrorCertificate returns the certificate that the TLS library failed to verify, if err is of the failure.
+func verifyErrorCertificate(err error) *x509.Certificate {
+	var invalid x509.CertificateInvalidError
+	if errors.As(err, &invalid) {
+		return invalid.Cert
+	}
+	var hostname x509.HostnameError
+	if errors.As(err, &hostname) {
+		return hostname.Certificate
+	}
+	var unknownAuthority x509.UnknownAuthorityError
+	if errors.As(err, &unknownAuthority) {
+		return unknownAuthority.Cert
+	}
+	return nil
+}
+
+// ReportVerifyError reports the certificate of the server, if err is from a handshake that failed to verify it.
+// Errors of other causes are ignored.
+func (c *Config) ReportVerifyError(serverName string, err error) {
+	cert := verifyErrorCertificate(err)
+	if cert == nil {
+		return
+	}
+	newError("failed to verify certificate of server ", serverName, " (", describeCertificate(cert), ")").Base(err).AtError().WriteToLog()
+
+	now := time.Now()
+	if len(c.FailedChainDir) > 0 && chainDumps.allow(serverName, now) {
+		rawCerts := [][]byte{cert.Raw}
+		var chain *chainError
+		if errors.As(err, &chain) {
+			rawCerts = chain.rawCerts
+		}
+		if path, err := dumpChain(c.FailedChainDir, serverName, rawCerts, now); err != nil {
+			newError("failed to save certificate of server ", serverName).Base(err).AtWarning().WriteToLog()
+		} else {
+			newError("certificate of server ", serverName, " is saved to ", path).AtWarning().WriteToLog()
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package tls_test
+
+import (
+	gotls "crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"v2ray.com/core/common"
+	"v2ray.com/core/common/protocol/tls/cert"
+	. "v2ray.com/core/transport/internet/tls"
+)
+
+// handshakeWith runs a handshake of the client config against a server of the certificate.
+func handshakeWith(certificate *Certificate, config *Config) (gotls.ConnectionState, error) {
+	serverConfig := (&Config{
+		Certificate:             []*Certificate{certificate},
+		EnableSessionResumption: true,
+		SessionTicketKey:        []byte("verify"),
+	}).GetTLSConfig()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	common.Must(err)
+	defer listener.Close()
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		server := gotls.Server(conn, serverConfig)
+		if server.Handshake() == nil {
+			// Session tickets of TLS 1.3 are sent after the handshake.
+			server.Write([]byte{0})
+		}
+	}()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	common.Must(err)
+	defer conn.Close()
+	client := config.Client(conn).(*Conn)
+	if err := client.Handshake(); err != nil {
+		return gotls.ConnectionState{}, err
+	}
+	client.Read(make([]byte, 1))
+	return client.ConnectionState(), nil
+}
+
+func TestVerifyCertificate(t *testing.T) {
+	caCert := cert.MustGenerate(nil, cert.Authority(true), cert.KeyUsage(x509.KeyUsageCertSign))
+	serverCert := cert.MustGenerate(caCert, cert.CommonName("www.v2fly.org"), cert.DNSNames("www.v2fly.org"))
+	ca := ParseCertificate(caCert)
+	ca.Usage = Certificate_AUTHORITY_VERIFY
+
+	config := &Config{
+		ServerName:        "www.v2fly.org",
+		Certificate:       []*Certificate{ca},
+		DisableSystemRoot: true,
+		ExpiryWarningDays: 30,
+	}
+	if _, err := handshakeWith(ParseCertificate(serverCert), config); err != nil {
+		t.Error("expect certificate verified, but got ", err)
+	}
+
+	config.ServerName = "www.v2ray.com"
+	if _, err := handshakeWith(ParseCertificate(serverCert), config); err == nil {
+		t.Error("expect certificate of another server rejected")
+	}
+}
+
+func TestVerifyFailureSavesChain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "v2ray-tls")
+	common.Must(err)
+	defer os.RemoveAll(dir)
+
+	caCert := cert.MustGenerate(nil, cert.Authority(true), cert.KeyUsage(x509.KeyUsageCertSign))
+	intermediateCert := cert.MustGenerate(caCert, cert.CommonName("intermediate"), cert.Authority(true), cert.KeyUsage(x509.KeyUsageCertSign))
+	serverCert := cert.MustGenerate(intermediateCert, cert.CommonName("chain.v2fly.org"), cert.DNSNames("chain.v2fly.org"))
+	// The server presents its certificate and the intermediate, which the client has no root of.
+	chain := ParseCertificate(serverCert)
+	intermediatePEM, _ := intermediateCert.ToPEM()
+	chain.Certificate = append(chain.Certificate, intermediatePEM...)
+
+	config := &Config{
+		ServerName:        "chain.v2fly.org",
+		DisableSystemRoot: true,
+		FailedChainDir:    dir,
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := handshakeWith(chain, config); err == nil {
+			t.Fatal("expect certificate of unknown authority rejected")
+		}
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "chain.v2fly.org-*.pem"))
+	common.Must(err)
+	if len(files) != 1 {
+		t.Fatal("expect a single chain saved, but got ", files)
+	}
+	content, err := ioutil.ReadFile(files[0])
+	common.Must(err)
+	var names []string
+	for {
+		var block *pem.Block
+		block, content = pem.Decode(content)
+		if block == nil {
+			break
+		}
+		saved, err := x509.ParseCertificate(block.Bytes)
+		common.Must(err)
+		names = append(names, saved.Subject.CommonName)
+	}
+	if r := cmp.Diff(names, []string{"chain.v2fly.org", "intermediate"}); r != "" {
+		t.Error(r)
+	}
+
+	// The chain passes the same verification with the root.
+	ca := ParseCertificate(caCert)
+	ca.Usage = Certificate_AUTHORITY_VERIFY
+	config.Certificate = []*Certificate{ca}
+	if _, err := handshakeWith(chain, config); err != nil {
+		t.Error("expect chain verified, but got ", err)
+	}
+}
+
+func TestAllowInsecureSkipsVerification(t *testing.T) {
+	serverCert := cert.MustGenerate(nil, cert.DNSNames("www.v2fly.org"))
+	config := &Config{
+		ServerName:        "www.v2fly.org",
+		AllowInsecure:     true,
+		DisableSystemRoot: true,
+	}
+	if _, err := handshakeWith(ParseCertificate(serverCert), config); err != nil {
+		t.Error("expect insecure handshake, but got ", err)
+	}
+}
+
+func TestVerifyResumedSession(t *testing.T) {
+	caCert := cert.MustGenerate(nil, cert.Authority(true), cert.KeyUsage(x509.KeyUsageCertSign))
+	serverCert := cert.MustGenerate(caCert, cert.CommonName("resume.v2fly.org"), cert.DNSNames("resume.v2fly.org"))
+	ca := ParseCertificate(caCert)
+	ca.Usage = Certificate_AUTHORITY_VERIFY
+
+	config := &Config{
+		ServerName:              "resume.v2fly.org",
+		Certificate:             []*Certificate{ca},
+		DisableSystemRoot:       true,
+		EnableSessionResumption: true,
+		ExpiryWarningDays:       30,
+	}
+	if _, err := handshakeWith(ParseCertificate(serverCert), config); err != nil {
+		t.Fatal("expect certificate verified, but got ", err)
+	}
+	state, err := handshakeWith(ParseCertificate(serverCert), config)
+	if err != nil {
+		t.Fatal("expect resumed session verified, but got ", err)
+	}
+	if !state.DidResume {
+		t.Error("expect session resumed")
+	}
+}
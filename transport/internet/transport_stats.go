@@ -0,0 +1,120 @@
+package internet
+
+import (
+	"context"
+	"sync"
+
+	"v2ray.com/core/features/stats"
+)
+
+// TransportStats counts the traffic, connections and failed dials of each transport, regardless of the
+// handlers using it, as counters named by the protocol name of the transport:
+//
+//	transport>>>websocket>>>traffic>>>uplink
+//	transport>>>websocket>>>traffic>>>downlink
+//	transport>>>websocket>>>connections>>>inbound
+//	transport>>>websocket>>>connections>>>outbound
+//	transport>>>websocket>>>handshake>>>failed
+//
+// Uplink is the traffic from clients to servers, that is, read from accepted connections, and written to
+// dialed connections. Failed dials include transport handshakes, such as WebSocket upgrades, done in Dial.
+type TransportStats struct {
+	manager stats.Manager
+
+	access   sync.Mutex
+	counters map[string]*transportCounters
+}
+
+type transportCounters struct {
+	uplink   stats.Counter
+	downlink stats.Counter
+	inbound  stats.Counter
+	outbound stats.Counter
+	failed   stats.Counter
+}
+
+// NewTransportStats creates a TransportStats with counters registered in the manager. It returns nil if
+// the manager is nil.
+func NewTransportStats(manager stats.Manager) *TransportStats {
+	if manager == nil {
+		return nil
+	}
+	return &TransportStats{
+		manager:  manager,
+		counters: make(map[string]*transportCounters),
+	}
+}
+
+// get returns the counters of the transport, or nil if the manager doesn't register counters, such as when
+// the stats feature is not enabled.
+func (s *TransportStats) get(protocol string) *transportCounters {
+	s.access.Lock()
+	defer s.access.Unlock()
+
+	if c, found := s.counters[protocol]; found {
+		return c
+	}
+	prefix := "transport>>>" + protocol + ">>>"
+	names := []string{"traffic>>>uplink", "traffic>>>downlink", "connections>>>inbound", "connections>>>outbound", "handshake>>>failed"}
+	counters := make([]stats.Counter, len(names))
+	for i, name := range names {
+		counter, err := stats.GetOrRegisterCounter(s.manager, prefix+name)
+		if err != nil {
+			s.counters[protocol] = nil
+			return nil
+		}
+		counters[i] = counter
+	}
+	c := &transportCounters{
+		uplink:   counters[0],
+		downlink: counters[1],
+		inbound:  counters[2],
+		outbound: counters[3],
+		failed:   counters[4],
+	}
+	s.counters[protocol] = c
+	return c
+}
+
+// ContextWithTransportStats returns a context in which Dial, ListenTCP and ListenUnix count connections
+// with the TransportStats, if it is not nil.
+func ContextWithTransportStats(ctx context.Context, s *TransportStats) context.Context {
+	if s == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, transportStatsKey, s)
+}
+
+func transportCountersFromContext(ctx context.Context, protocol string) *transportCounters {
+	s, ok := ctx.Value(transportStatsKey).(*TransportStats)
+	if !ok {
+		return nil
+	}
+	return s.get(protocol)
+}
+
+// countDial counts the connection dialed by the transport, or the failure to dial it.
+func countDial(ctx context.Context, protocol string, conn Connection, err error) (Connection, error) {
+	c := transportCountersFromContext(ctx, protocol)
+	if c == nil {
+		return conn, err
+	}
+	if err != nil {
+		c.failed.Add(1)
+		return conn, err
+	}
+	c.outbound.Add(1)
+	return NewStatCouterConnection(conn, c.downlink, c.uplink), nil
+}
+
+// countAccepted returns a handler counting the connections accepted by the transport.
+func countAccepted(ctx context.Context, protocol string, handler ConnHandler) ConnHandler {
+	c := transportCountersFromContext(ctx, protocol)
+	if c == nil {
+		return handler
+	}
+	return func(conn Connection) {
+		c.inbound.Add(1)
+		handler(NewStatCouterConnection(conn, c.uplink, c.downlink))
+	}
+}
@@ -0,0 +1,127 @@
+package internet_test
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"v2ray.com/core/app/stats"
+	"v2ray.com/core/common"
+	"v2ray.com/core/common/net"
+	feature_stats "v2ray.com/core/features/stats"
+	"v2ray.com/core/testing/servers/tcp"
+	. "v2ray.com/core/transport/internet"
+	_ "v2ray.com/core/transport/internet/tcp"
+)
+
+func TestTransportStats(t *testing.T) {
+	m, err := stats.NewManager(context.Background(), &stats.Config{})
+	common.Must(err)
+	ctx := ContextWithTransportStats(context.Background(), NewTransportStats(m))
+	value := func(name string) int64 {
+		c := m.GetCounter("transport>>>tcp>>>" + name)
+		if c == nil {
+			t.Fatal("counter not registered: ", name)
+		}
+		return c.Value()
+	}
+
+	server := &tcp.Server{
+		MsgProcessor: func(b []byte) []byte { return b },
+	}
+	dest, err := server.Start()
+	common.Must(err)
+	defer server.Close()
+
+	conn, err := Dial(ctx, dest, nil)
+	common.Must(err)
+	common.Must2(conn.Write([]byte("hello")))
+	common.Must2(io.ReadFull(conn, make([]byte, 5)))
+	conn.Close()
+	if v := value("traffic>>>uplink"); v != 5 {
+		t.Error("expect uplink 5, but got ", v)
+	}
+	if v := value("traffic>>>downlink"); v != 5 {
+		t.Error("expect downlink 5, but got ", v)
+	}
+	if v := value("connections>>>outbound"); v != 1 {
+		t.Error("expect 1 outbound connection, but got ", v)
+	}
+
+	server.Close()
+	if _, err := Dial(ctx, dest, nil); err == nil {
+		t.Fatal("expect error dialing closed server")
+	}
+	if v := value("handshake>>>failed"); v != 1 {
+		t.Error("expect 1 failed dial, but got ", v)
+	}
+
+	accepted := make(chan Connection, 1)
+	listener, err := ListenTCP(ctx, net.LocalHostIP, tcp.PickPort(), nil, func(conn Connection) {
+		accepted <- conn
+	})
+	common.Must(err)
+	defer listener.Close()
+	client, err := net.Dial("tcp", listener.Addr().String())
+	common.Must(err)
+	defer client.Close()
+	common.Must2(client.Write([]byte("hi")))
+	select {
+	case conn := <-accepted:
+		common.Must2(io.ReadFull(conn, make([]byte, 2)))
+		conn.Close()
+	case <-time.After(time.Second * 5):
+		t.Fatal("connection not accepted")
+	}
+	if v := value("connections>>>inbound"); v != 1 {
+		t.Error("expect 1 inbound connection, but got ", v)
+	}
+	if v := value("traffic>>>uplink"); v != 7 {
+		t.Error("expect uplink 7, but got ", v)
+	}
+}
+
+func TestTransportStatsDisabled(t *testing.T) {
+	server := &tcp.Server{
+		MsgProcessor: func(b []byte) []byte { return b },
+	}
+	dest, err := server.Start()
+	common.Must(err)
+	defer server.Close()
+
+	ctx := ContextWithTransportStats(context.Background(), NewTransportStats(feature_stats.NoopManager{}))
+	conn, err := Dial(ctx, dest, nil)
+	common.Must(err)
+	defer conn.Close()
+	if _, ok := conn.(*StatCouterConnection); ok {
+		t.Error("expect connection not counted without stats")
+	}
+}
+
+func TestNewStatCouterConnection(t *testing.T) {
+	m, err := stats.NewManager(context.Background(), &stats.Config{})
+	common.Must(err)
+	a, _ := m.RegisterCounter("a")
+	b, _ := m.RegisterCounter("b")
+
+	server := &tcp.Server{
+		MsgProcessor: func(b []byte) []byte { return b },
+	}
+	dest, err := server.Start()
+	common.Must(err)
+	defer server.Close()
+	client, err := net.Dial("tcp", dest.NetAddr())
+	common.Must(err)
+	defer client.Close()
+
+	conn := NewStatCouterConnection(NewStatCouterConnection(client, nil, a), nil, b)
+	statConn, ok := conn.(*StatCouterConnection)
+	if !ok || statConn.Connection != client {
+		t.Fatal("expect a single StatCouterConnection over the connection")
+	}
+	common.Must2(conn.Write([]byte("abc")))
+	if a.Value() != 3 || b.Value() != 3 {
+		t.Error("expect both counters 3, but got ", a.Value(), " and ", b.Value())
+	}
+}
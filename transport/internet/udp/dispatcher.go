@@ -20,10 +20,79 @@ import (
 
 type ResponseCallback func(ctx context.Context, packet *udp.Packet)
 
+// FailureCallback is called when the session to a destination fails fatally, e.g. the outbound
+// reported the destination as unreachable.
+type FailureCallback func(ctx context.Context, dest net.Destination, err error)
+
+// DispatcherOption customizes a Dispatcher.
+type DispatcherOption func(*Dispatcher)
+
+// OnFailure registers a callback for fatal session failures, which outbounds report by ReportFailure.
+func OnFailure(callback FailureCallback) DispatcherOption {
+	return func(d *Dispatcher) {
+		d.onFailure = callback
+	}
+}
+
+type associationKey int
+
+const (
+	associationKeyValue associationKey = iota
+	failureReporterKey
+)
+
+// AssociationFromContext returns the identity of the UDP association that the session to a destination in
+// ctx belongs to, if the session is dispatched by a Dispatcher. Sessions to all destinations of the same
+// Dispatcher, that is, from the same client, have the same association.
+func AssociationFromContext(ctx context.Context) interface{} {
+	return ctx.Value(associationKeyValue)
+}
+
+// ReportFailure tells the Dispatcher that dispatched the session in ctx that the session failed fatally, e.g.
+// its destination is unreachable. It does nothing for sessions not dispatched by a Dispatcher with OnFailure,
+// or not recorded by a FailureRecorder.
+func ReportFailure(ctx context.Context, err error) {
+	if recorder, ok := ctx.Value(failureReporterKey).(*FailureRecorder); ok {
+		recorder.Report(err)
+	}
+}
+
+// ContextWithFailureRecorder returns a context where ReportFailure records the failure of the session in
+// recorder. Inbounds that carry UDP sessions from other instances use it to pass failures on to the client.
+func ContextWithFailureRecorder(ctx context.Context, recorder *FailureRecorder) context.Context {
+	return context.WithValue(ctx, failureReporterKey, recorder)
+}
+
+// FailureRecorder records the first failure reported for a session.
+type FailureRecorder struct {
+	access sync.Mutex
+	err    error
+}
+
+// Report records err, unless a failure is recorded already.
+func (r *FailureRecorder) Report(err error) {
+	r.access.Lock()
+	defer r.access.Unlock()
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+// Failure returns the recorded failure, or nil if none is reported.
+func (r *FailureRecorder) Failure() error {
+	if r == nil {
+		return nil
+	}
+	r.access.Lock()
+	defer r.access.Unlock()
+	return r.err
+}
+
 type connEntry struct {
-	link   *transport.Link
-	timer  signal.ActivityUpdater
-	cancel context.CancelFunc
+	link    *transport.Link
+	timer   signal.ActivityUpdater
+	cancel  context.CancelFunc
+	failure FailureRecorder
 }
 
 type Dispatcher struct {
@@ -31,14 +100,19 @@ type Dispatcher struct {
 	conns      map[net.Destination]*connEntry
 	dispatcher routing.Dispatcher
 	callback   ResponseCallback
+	onFailure  FailureCallback
 }
 
-func NewDispatcher(dispatcher routing.Dispatcher, callback ResponseCallback) *Dispatcher {
-	return &Dispatcher{
+func NewDispatcher(dispatcher routing.Dispatcher, callback ResponseCallback, options ...DispatcherOption) *Dispatcher {
+	d := &Dispatcher{
 		conns:      make(map[net.Destination]*connEntry),
 		dispatcher: dispatcher,
 		callback:   callback,
 	}
+	for _, option := range options {
+		option(d)
+	}
+	return d
 }
 
 func (v *Dispatcher) RemoveRay(dest net.Destination) {
@@ -59,22 +133,29 @@ func (v *Dispatcher) getInboundRay(ctx context.Context, dest net.Destination) *c
 		return entry
 	}
 
-	newError("establishing new connection for ", dest).WriteToLog()
-
+	entry := new(connEntry)
+	ctx = context.WithValue(ctx, associationKeyValue, v)
+	if v.onFailure != nil {
+		ctx = ContextWithFailureRecorder(ctx, &entry.failure)
+	}
 	ctx, cancel := context.WithCancel(ctx)
+	link, err := v.dispatcher.Dispatch(ctx, dest)
+	if err != nil {
+		cancel()
+		newError("failed to dispatch UDP packets to ", dest).Base(err).AtDebug().WriteToLog(session.ExportIDToError(ctx))
+		return nil
+	}
+	newError("establishing new connection for ", dest).WriteToLog(session.ExportIDToError(ctx))
 	removeRay := func() {
 		cancel()
 		v.RemoveRay(dest)
 	}
 	timer := signal.CancelAfterInactivity(ctx, removeRay, time.Second*4)
-	link, _ := v.dispatcher.Dispatch(ctx, dest)
-	entry := &connEntry{
-		link:   link,
-		timer:  timer,
-		cancel: removeRay,
-	}
+	entry.link = link
+	entry.timer = timer
+	entry.cancel = removeRay
 	v.conns[dest] = entry
-	go handleInput(ctx, entry, dest, v.callback)
+	go v.handleInput(ctx, entry, dest)
 	return entry
 }
 
@@ -83,6 +164,11 @@ func (v *Dispatcher) Dispatch(ctx context.Context, destination net.Destination,
 	newError("dispatch request to: ", destination).AtDebug().WriteToLog(session.ExportIDToError(ctx))
 
 	conn := v.getInboundRay(ctx, destination)
+	if conn == nil {
+		// The packet is dropped, and later ones to the destination are dispatched again.
+		payload.Release()
+		return
+	}
 	outputStream := conn.link.Writer
 	if outputStream != nil {
 		if err := outputStream.WriteMultiBuffer(buf.MultiBuffer{payload}); err != nil {
@@ -93,7 +179,7 @@ func (v *Dispatcher) Dispatch(ctx context.Context, destination net.Destination,
 	}
 }
 
-func handleInput(ctx context.Context, conn *connEntry, dest net.Destination, callback ResponseCallback) {
+func (v *Dispatcher) handleInput(ctx context.Context, conn *connEntry, dest net.Destination) {
 	defer conn.cancel()
 
 	input := conn.link.Reader
@@ -108,12 +194,17 @@ func handleInput(ctx context.Context, conn *connEntry, dest net.Destination, cal
 
 		mb, err := input.ReadMultiBuffer()
 		if err != nil {
+			if failure := conn.failure.Failure(); failure != nil && ctx.Err() == nil {
+				newError("UDP session to ", dest, " failed").Base(failure).WriteToLog(session.ExportIDToError(ctx))
+				v.onFailure(ctx, dest, failure)
+				return
+			}
 			newError("failed to handle UDP input").Base(err).WriteToLog(session.ExportIDToError(ctx))
 			return
 		}
 		timer.Update()
 		for _, b := range mb {
-			callback(ctx, &udp.Packet{
+			v.callback(ctx, &udp.Packet{
 				Payload: b,
 				Source:  dest,
 			})
@@ -122,13 +213,17 @@ func handleInput(ctx context.Context, conn *connEntry, dest net.Destination, cal
 }
 
 type dispatcherConn struct {
+	ctx        context.Context
 	dispatcher *Dispatcher
 	cache      chan *udp.Packet
 	done       *done.Instance
 }
 
+// DialDispatcher returns a PacketConn that dispatches packets with the session in ctx. The PacketConn is
+// not affected by the deadline or cancellation of ctx.
 func DialDispatcher(ctx context.Context, dispatcher routing.Dispatcher) (net.PacketConn, error) {
 	c := &dispatcherConn{
+		ctx:   session.Detach(ctx),
 		cache: make(chan *udp.Packet, 16),
 		done:  done.New(),
 	}
@@ -169,8 +264,7 @@ func (c *dispatcherConn) WriteTo(p []byte, addr net.Addr) (int, error) {
 	n := copy(raw, p)
 	buffer.Resize(0, int32(n))
 
-	ctx := context.Background()
-	c.dispatcher.Dispatch(ctx, net.DestinationFromAddr(addr), buffer)
+	c.dispatcher.Dispatch(c.ctx, net.DestinationFromAddr(addr), buffer)
 	return n, nil
 }
 
@@ -2,6 +2,7 @@ package udp_test
 
 import (
 	"context"
+	"errors"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -84,3 +85,68 @@ func TestSameDestinationDispatching(t *testing.T) {
 		t.Error("msgCount: ", v)
 	}
 }
+
+func TestDispatcherFailure(t *testing.T) {
+	for _, fatal := range []bool{true, false} {
+		_, uplinkWriter := pipe.New(pipe.WithSizeLimit(1024))
+		downlinkReader, downlinkWriter := pipe.New(pipe.WithSizeLimit(1024))
+
+		td := &TestDispatcher{
+			OnDispatch: func(ctx context.Context, dest net.Destination) (*transport.Link, error) {
+				if fatal {
+					ReportFailure(ctx, errors.New("unreachable"))
+				}
+				return &transport.Link{Reader: downlinkReader, Writer: uplinkWriter}, nil
+			},
+		}
+		dest := net.UDPDestination(net.LocalHostIP, 53)
+
+		var failures uint32
+		dispatcher := NewDispatcher(td, func(ctx context.Context, packet *udp.Packet) {}, OnFailure(func(ctx context.Context, d net.Destination, err error) {
+			if d != dest {
+				t.Error("unexpected destination: ", d)
+			}
+			atomic.AddUint32(&failures, 1)
+		}))
+
+		b := buf.New()
+		b.WriteString("abcd")
+		dispatcher.Dispatch(context.Background(), dest, b)
+
+		// Outbounds are interrupted whenever they fail, but only reported failures are fatal.
+		downlinkWriter.Interrupt()
+
+		time.Sleep(time.Millisecond * 500)
+
+		expected := uint32(0)
+		if fatal {
+			expected = 1
+		}
+		if v := atomic.LoadUint32(&failures); v != expected {
+			t.Error("fatal: ", fatal, " failures: ", v)
+		}
+	}
+}
+
+func TestDispatchingFailure(t *testing.T) {
+	var count uint32
+	td := &TestDispatcher{
+		OnDispatch: func(ctx context.Context, dest net.Destination) (*transport.Link, error) {
+			atomic.AddUint32(&count, 1)
+			return nil, errors.New("blocked")
+		},
+	}
+	dispatcher := NewDispatcher(td, func(ctx context.Context, packet *udp.Packet) {
+		t.Error("unexpected response")
+	})
+	dest := net.UDPDestination(net.LocalHostIP, 53)
+	for i := 0; i < 3; i++ {
+		b := buf.New()
+		b.WriteString("abcd")
+		dispatcher.Dispatch(context.Background(), dest, b)
+	}
+	// Packets are dropped, and each is dispatched again.
+	if v := atomic.LoadUint32(&count); v != 3 {
+		t.Error("expect 3 dispatches, but got ", v)
+	}
+}
@@ -9,6 +9,23 @@ import (
 	"v2ray.com/core/transport/internet"
 )
 
+type hubKey int
+
+const maxHubSessionsKey hubKey = iota
+
+// ContextWithMaxHubSessions returns a context in which inbounds serve at most n sessions, each with a
+// goroutine, from a hub at the same time. Zero means no limit.
+func ContextWithMaxHubSessions(ctx context.Context, n uint32) context.Context {
+	return context.WithValue(ctx, maxHubSessionsKey, n)
+}
+
+// MaxHubSessionsFromContext returns the maximum number of sessions that an inbound serves from a hub at the
+// same time in ctx, or zero for no limit.
+func MaxHubSessionsFromContext(ctx context.Context) uint32 {
+	n, _ := ctx.Value(maxHubSessionsKey).(uint32)
+	return n
+}
+
 type HubOption func(h *Hub)
 
 func HubCapacity(capacity int) HubOption {
@@ -24,7 +41,7 @@ func HubReceiveOriginalDestination(r bool) HubOption {
 }
 
 type Hub struct {
-	conn         *net.UDPConn
+	conn         net.PacketConn
 	cache        chan *udp.Packet
 	capacity     int
 	recvOrigDest bool
@@ -55,7 +72,7 @@ func ListenUDP(ctx context.Context, address net.Address, port net.Port, streamSe
 		return nil, err
 	}
 	newError("listening UDP on ", address, ":", port).WriteToLog()
-	hub.conn = udpConn.(*net.UDPConn)
+	hub.conn = udpConn
 	hub.cache = make(chan *udp.Packet, hub.capacity)
 
 	go hub.start()
@@ -69,7 +86,7 @@ func (h *Hub) Close() error {
 }
 
 func (h *Hub) WriteTo(payload []byte, dest net.Destination) (int, error) {
-	return h.conn.WriteToUDP(payload, &net.UDPAddr{
+	return h.conn.WriteTo(payload, &net.UDPAddr{
 		IP:   dest.Address.IP(),
 		Port: int(dest.Port),
 	})
@@ -87,7 +104,7 @@ func (h *Hub) start() {
 		var addr *net.UDPAddr
 		rawBytes := buffer.Extend(buf.Size)
 
-		n, noob, _, addr, err := ReadUDPMsg(h.conn, rawBytes, oobBytes)
+		n, noob, addr, err := h.read(rawBytes, oobBytes)
 		if err != nil {
 			newError("failed to read UDP msg").Base(err).WriteToLog()
 			buffer.Release()
@@ -122,6 +139,19 @@ func (h *Hub) start() {
 	}
 }
 
+// read reads a packet, with the original destination in oob if the socket is not shared.
+func (h *Hub) read(payload []byte, oob []byte) (int, int, *net.UDPAddr, error) {
+	if conn, ok := h.conn.(*net.UDPConn); ok {
+		n, noob, _, addr, err := ReadUDPMsg(conn, payload, oob)
+		return n, noob, addr, err
+	}
+	n, addr, err := h.conn.ReadFrom(payload)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	return n, 0, addr.(*net.UDPAddr), nil
+}
+
 // Addr implements net.Listener.
 func (h *Hub) Addr() net.Addr {
 	return h.conn.LocalAddr()
@@ -0,0 +1,361 @@
+package internet
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	"v2ray.com/core/common/net"
+	"v2ray.com/core/common/signal/done"
+)
+
+const (
+	// demuxFlowTimeout is how long a flow stays with its listener without packets from its source.
+	demuxFlowTimeout = 3 * time.Minute
+	demuxQueueSize   = 256
+	// minQUICInitialSize is the minimum size of UDP payloads with Initial packets of QUIC clients.
+	minQUICInitialSize = 1200
+)
+
+var (
+	demuxAccess  sync.Mutex
+	demuxSockets = make(map[string]*demuxSocket)
+)
+
+// isWireGuardMessage returns true if b is a WireGuard message, by its type and size.
+func isWireGuardMessage(b []byte) bool {
+	if len(b) < 4 || b[1] != 0 || b[2] != 0 || b[3] != 0 {
+		return false
+	}
+	switch b[0] {
+	case 1: // Handshake initiation
+		return len(b) == 148
+	case 2: // Handshake response
+		return len(b) == 92
+	case 3: // Cookie reply
+		return len(b) == 64
+	case 4: // Transport data
+		return len(b) >= 32 && len(b)%16 == 0
+	default:
+		return false
+	}
+}
+
+// classifyPacket returns the type of a packet, which decides the listener of a new flow.
+func classifyPacket(b []byte) UDPDemuxConfig_PacketType {
+	if isWireGuardMessage(b) {
+		return UDPDemuxConfig_WireGuard
+	}
+	// Clients start QUIC connections with Initial packets, which are padded, in long headers with the fixed bit.
+	// Short header packets are not told from random bytes, and belong to flows of QUIC listeners already, as
+	// QUIC connections time out earlier than flows.
+	if len(b) >= minQUICInitialSize && b[0]&0xc0 == 0xc0 {
+		return UDPDemuxConfig_QUIC
+	}
+	return UDPDemuxConfig_Other
+}
+
+type demuxFlow struct {
+	listener *demuxConn
+	last     time.Time
+}
+
+// demuxSocket is a UDP socket shared by listeners on the same address. The flow of packets from each source
+// goes to one listener, which is picked by the first packet of the flow.
+type demuxSocket struct {
+	key  string
+	conn net.PacketConn
+	// sockopt is the socket options of the socket, without the packet types of listeners.
+	sockopt *SocketConfig
+
+	access    sync.Mutex
+	listeners []*demuxConn
+	flows     map[string]*demuxFlow
+	lastSweep time.Time
+}
+
+// socketOptionsOf returns the socket options that the listeners of a shared socket must agree on.
+func socketOptionsOf(sockopt *SocketConfig) *SocketConfig {
+	options := proto.Clone(sockopt).(*SocketConfig)
+	options.UdpDemux = nil
+	return options
+}
+
+// listenDemux adds a listener to the shared socket on the address, which is created with the socket options
+// of the first listener. Listeners of other socket options, except for the packet types, are rejected.
+func listenDemux(ctx context.Context, addr *net.UDPAddr, sockopt *SocketConfig) (net.PacketConn, error) {
+	demuxAccess.Lock()
+	defer demuxAccess.Unlock()
+
+	key := addr.String()
+	options := socketOptionsOf(sockopt)
+	s, found := demuxSockets[key]
+	if found && !proto.Equal(options, s.sockopt) {
+		return nil, newError("socket options of listener on ", key, " differ from those of the shared socket")
+	}
+	if !found {
+		conn, err := effectiveListener.ListenPacket(ctx, addr, sockopt)
+		if err != nil {
+			return nil, err
+		}
+		s = &demuxSocket{
+			key:       key,
+			conn:      conn,
+			sockopt:   options,
+			flows:     make(map[string]*demuxFlow),
+			lastSweep: time.Now(),
+		}
+		demuxSockets[key] = s
+		go s.run()
+	}
+
+	c := &demuxConn{
+		socket:          s,
+		types:           make(map[UDPDemuxConfig_PacketType]bool),
+		queue:           make(chan *demuxPacket, demuxQueueSize),
+		done:            done.New(),
+		deadlineChanged: make(chan struct{}),
+	}
+	for _, t := range sockopt.UdpDemux.PacketType {
+		c.types[t] = true
+	}
+	if len(c.types) == 0 {
+		c.types[UDPDemuxConfig_Other] = true
+	}
+
+	s.access.Lock()
+	s.listeners = append(s.listeners, c)
+	s.access.Unlock()
+	return c, nil
+}
+
+func (s *demuxSocket) run() {
+	b := make([]byte, 64*1024)
+	for {
+		n, source, err := s.conn.ReadFrom(b)
+		if err != nil {
+			demuxAccess.Lock()
+			if demuxSockets[s.key] == s {
+				delete(demuxSockets, s.key)
+			}
+			demuxAccess.Unlock()
+			s.conn.Close()
+
+			s.access.Lock()
+			listeners := append([]*demuxConn(nil), s.listeners...)
+			s.access.Unlock()
+			for _, c := range listeners {
+				c.fail(err)
+			}
+			return
+		}
+		if c := s.pick(source, b[:n]); c != nil {
+			payload := make([]byte, n)
+			copy(payload, b)
+			c.push(&demuxPacket{payload: payload, source: source})
+		}
+	}
+}
+
+// pick returns the listener of the flow of the packet, or nil if the packet is dropped.
+func (s *demuxSocket) pick(source net.Addr, b []byte) *demuxConn {
+	key := source.String()
+	now := time.Now()
+
+	s.access.Lock()
+	defer s.access.Unlock()
+
+	if now.Sub(s.lastSweep) > demuxFlowTimeout {
+		for k, flow := range s.flows {
+			if now.Sub(flow.last) > demuxFlowTimeout {
+				delete(s.flows, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	if flow, found := s.flows[key]; found && now.Sub(flow.last) <= demuxFlowTimeout {
+		flow.last = now
+		return flow.listener
+	}
+
+	packetType := classifyPacket(b)
+	var listener *demuxConn
+	for _, c := range s.listeners {
+		if c.types[packetType] {
+			listener = c
+			break
+		}
+	}
+	if listener == nil {
+		for _, c := range s.listeners {
+			if c.types[UDPDemuxConfig_Other] {
+				listener = c
+				break
+			}
+		}
+	}
+	if listener == nil {
+		newError("dropping ", packetType, " packet from ", source, " on ", s.key).AtDebug().WriteToLog()
+		return nil
+	}
+	s.flows[key] = &demuxFlow{listener: listener, last: now}
+	return listener
+}
+
+// remove removes the listener and its flows, and closes the socket when no listener is left.
+func (s *demuxSocket) remove(c *demuxConn) {
+	demuxAccess.Lock()
+	defer demuxAccess.Unlock()
+
+	s.access.Lock()
+	for i, l := range s.listeners {
+		if l == c {
+			s.listeners = append(s.listeners[:i], s.listeners[i+1:]...)
+			break
+		}
+	}
+	for k, flow := range s.flows {
+		if flow.listener == c {
+			delete(s.flows, k)
+		}
+	}
+	empty := len(s.listeners) == 0
+	s.access.Unlock()
+
+	if empty && demuxSockets[s.key] == s {
+		delete(demuxSockets, s.key)
+		s.conn.Close()
+	}
+}
+
+type demuxPacket struct {
+	payload []byte
+	source  net.Addr
+}
+
+// demuxConn is a listener on a shared socket. It is a net.PacketConn that reads the packets of its flows.
+type demuxConn struct {
+	socket *demuxSocket
+	types  map[UDPDemuxConfig_PacketType]bool
+	queue  chan *demuxPacket
+	done   *done.Instance
+
+	access       sync.Mutex
+	err          error
+	readDeadline time.Time
+	// deadlineChanged is closed when the read deadline changes, to wake up reads in progress.
+	deadlineChanged chan struct{}
+}
+
+// push queues the packet, or drops it if the queue is full.
+func (c *demuxConn) push(p *demuxPacket) {
+	select {
+	case c.queue <- p:
+	default:
+	}
+}
+
+// fail makes reads fail with the error of the shared socket.
+func (c *demuxConn) fail(err error) {
+	c.access.Lock()
+	if c.err == nil {
+		c.err = err
+	}
+	c.access.Unlock()
+	c.done.Close()
+}
+
+// ReadFrom implements net.PacketConn.
+func (c *demuxConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	for {
+		c.access.Lock()
+		deadline := c.readDeadline
+		deadlineChanged := c.deadlineChanged
+		c.access.Unlock()
+
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if !deadline.IsZero() {
+			d := time.Until(deadline)
+			if d <= 0 {
+				return 0, nil, os.ErrDeadlineExceeded
+			}
+			timer = time.NewTimer(d)
+			timeout = timer.C
+		}
+
+		select {
+		case packet := <-c.queue:
+			if timer != nil {
+				timer.Stop()
+			}
+			return copy(p, packet.payload), packet.source, nil
+		case <-c.done.Wait():
+			if timer != nil {
+				timer.Stop()
+			}
+			c.access.Lock()
+			defer c.access.Unlock()
+			if c.err != nil {
+				return 0, nil, c.err
+			}
+			return 0, nil, newError("listener on ", c.socket.key, " closed")
+		case <-timeout:
+			return 0, nil, os.ErrDeadlineExceeded
+		case <-deadlineChanged:
+			if timer != nil {
+				timer.Stop()
+			}
+		}
+	}
+}
+
+// WriteTo implements net.PacketConn.
+func (c *demuxConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	return c.socket.conn.WriteTo(p, addr)
+}
+
+// Close implements net.PacketConn.
+func (c *demuxConn) Close() error {
+	c.done.Close()
+	c.socket.remove(c)
+	return nil
+}
+
+// LocalAddr implements net.PacketConn.
+func (c *demuxConn) LocalAddr() net.Addr {
+	return c.socket.conn.LocalAddr()
+}
+
+// SetDeadline implements net.PacketConn. Only reads have deadlines, as writes are on the shared socket.
+func (c *demuxConn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+// SetReadDeadline implements net.PacketConn. It applies to reads in progress as well.
+func (c *demuxConn) SetReadDeadline(t time.Time) error {
+	c.access.Lock()
+	c.readDeadline = t
+	close(c.deadlineChanged)
+	c.deadlineChanged = make(chan struct{})
+	c.access.Unlock()
+	return nil
+}
+
+// SetWriteDeadline implements net.PacketConn. It does nothing, as writes are on the shared socket.
+func (c *demuxConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+// demuxAddress returns the UDP address to listen on with the shared socket, or nil if sockopt doesn't ask for it.
+func demuxAddress(addr net.Addr, sockopt *SocketConfig) *net.UDPAddr {
+	udpAddr, ok := addr.(*net.UDPAddr)
+	if !ok || udpAddr.Port == 0 || sockopt.GetUdpDemux() == nil {
+		return nil
+	}
+	return udpAddr
+}
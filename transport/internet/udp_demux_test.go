@@ -0,0 +1,178 @@
+package internet_test
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"v2ray.com/core/common"
+	"v2ray.com/core/testing/servers/udp"
+	"v2ray.com/core/transport/internet"
+)
+
+func listenDemux(t *testing.T, port int, types ...internet.UDPDemuxConfig_PacketType) net.PacketConn {
+	conn, err := internet.ListenSystemPacket(context.Background(), &net.UDPAddr{
+		IP:   net.IPv4(127, 0, 0, 1),
+		Port: port,
+	}, &internet.SocketConfig{
+		UdpDemux: &internet.UDPDemuxConfig{PacketType: types},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func expectPacket(t *testing.T, conn net.PacketConn, payload []byte, source net.Addr) {
+	t.Helper()
+
+	b := make([]byte, 2048)
+	common.Must(conn.SetReadDeadline(time.Now().Add(2 * time.Second)))
+	n, addr, err := conn.ReadFrom(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b[:n], payload) {
+		t.Error("unexpected payload of ", n, " bytes")
+	}
+	if addr.String() != source.String() {
+		t.Error("unexpected source: ", addr, " want ", source)
+	}
+}
+
+func expectNoPacket(t *testing.T, conn net.PacketConn) {
+	t.Helper()
+
+	b := make([]byte, 2048)
+	common.Must(conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond)))
+	if n, _, err := conn.ReadFrom(b); err == nil {
+		t.Error("unexpected packet of ", n, " bytes")
+	} else if nerr, ok := err.(net.Error); !ok || !nerr.Timeout() {
+		t.Error("unexpected error: ", err)
+	}
+}
+
+func TestUDPDemux(t *testing.T) {
+	port := int(udp.PickPort())
+	wireguard := listenDemux(t, port, internet.UDPDemuxConfig_WireGuard)
+	defer wireguard.Close()
+	quic := listenDemux(t, port, internet.UDPDemuxConfig_QUIC)
+	defer quic.Close()
+
+	serverAddr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port}
+	dial := func() *net.UDPConn {
+		conn, err := net.DialUDP("udp", nil, serverAddr)
+		common.Must(err)
+		return conn
+	}
+
+	wgClient := dial()
+	defer wgClient.Close()
+	initiation := make([]byte, 148)
+	initiation[0] = 1
+	common.Must2(wgClient.Write(initiation))
+	expectPacket(t, wireguard, initiation, wgClient.LocalAddr())
+
+	// The flow stays with its listener, whatever the packets are.
+	initial := make([]byte, 1200)
+	initial[0] = 0xc3
+	common.Must2(wgClient.Write(initial))
+	expectPacket(t, wireguard, initial, wgClient.LocalAddr())
+
+	quicClient := dial()
+	defer quicClient.Close()
+	common.Must2(quicClient.Write(initial))
+	expectPacket(t, quic, initial, quicClient.LocalAddr())
+
+	// Responses go out of the shared socket.
+	common.Must2(quic.WriteTo([]byte("response"), quicClient.LocalAddr()))
+	b := make([]byte, 64)
+	common.Must(quicClient.SetReadDeadline(time.Now().Add(2 * time.Second)))
+	n, err := quicClient.Read(b)
+	common.Must(err)
+	if string(b[:n]) != "response" {
+		t.Error("unexpected response: ", string(b[:n]))
+	}
+
+	// Packets of other types are dropped, as no listener takes them.
+	otherClient := dial()
+	defer otherClient.Close()
+	common.Must2(otherClient.Write([]byte("other")))
+	expectNoPacket(t, wireguard)
+	expectNoPacket(t, quic)
+
+	// A listener for other packets takes new flows of them from now on.
+	other := listenDemux(t, port)
+	defer other.Close()
+	common.Must2(otherClient.Write([]byte("other")))
+	expectPacket(t, other, []byte("other"), otherClient.LocalAddr())
+}
+
+func TestUDPDemuxClose(t *testing.T) {
+	port := int(udp.PickPort())
+	first := listenDemux(t, port, internet.UDPDemuxConfig_QUIC)
+	second := listenDemux(t, port)
+
+	common.Must(first.Close())
+	common.Must(first.Close())
+	if _, _, err := first.ReadFrom(make([]byte, 16)); err == nil {
+		t.Error("read from closed listener")
+	}
+
+	// The socket is shared until the last listener is closed.
+	if _, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port}); err == nil {
+		t.Error("socket is closed with a listener on it")
+	}
+	common.Must(second.Close())
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port})
+	if err != nil {
+		t.Fatal("socket is not closed: ", err)
+	}
+	conn.Close()
+}
+
+func TestUDPDemuxSocketOptions(t *testing.T) {
+	port := int(udp.PickPort())
+	first := listenDemux(t, port, internet.UDPDemuxConfig_QUIC)
+	defer first.Close()
+
+	// Listeners of other packet types share the socket, but not those of other socket options.
+	second := listenDemux(t, port)
+	defer second.Close()
+	if conn, err := internet.ListenSystemPacket(context.Background(), &net.UDPAddr{
+		IP:   net.IPv4(127, 0, 0, 1),
+		Port: port,
+	}, &internet.SocketConfig{
+		Mark:     255,
+		UdpDemux: &internet.UDPDemuxConfig{},
+	}); err == nil {
+		conn.Close()
+		t.Error("expected error of different socket options")
+	}
+}
+
+func TestUDPDemuxReadDeadline(t *testing.T) {
+	conn := listenDemux(t, int(udp.PickPort()))
+	defer conn.Close()
+
+	errs := make(chan error, 1)
+	go func() {
+		_, _, err := conn.ReadFrom(make([]byte, 16))
+		errs <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	// A deadline in the past wakes up the read in progress.
+	common.Must(conn.SetReadDeadline(time.Now()))
+	select {
+	case err := <-errs:
+		if nerr, ok := err.(net.Error); !ok || !nerr.Timeout() {
+			t.Error("expected timeout, but got ", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("read is not woken up by the deadline")
+	}
+}
@@ -40,22 +40,56 @@ func dialWebsocket(ctx context.Context, dest net.Destination, streamSettings *in
 		WriteBufferSize:  4 * 1024,
 		HandshakeTimeout: time.Second * 8,
 	}
+	if deadline, ok := internet.HandshakeDeadline(ctx); ok {
+		dialer.HandshakeTimeout = time.Until(deadline)
+	}
 
 	protocol := "ws"
+	scheme := "ws"
+	var reportVerifyError func(error)
 
 	if config := tls.ConfigFromStreamSettings(streamSettings); config != nil {
 		protocol = "wss"
-		dialer.TLSClientConfig = config.GetTLSConfig(tls.WithDestination(dest), tls.WithNextProto("http/1.1"))
+		if sockopt := streamSettings.SocketSettings; sockopt != nil && sockopt.SendProxyProtocol > 0 && sockopt.ProxyProtocolInsideTls {
+			// The PROXY protocol header goes first inside TLS, so TLS is set up here instead of
+			// by the WebSocket dialer.
+			dialer.NetDial = func(network, addr string) (net.Conn, error) {
+				conn, err := internet.DialSystem(ctx, dest, sockopt)
+				if err != nil {
+					return nil, err
+				}
+				conn = config.Client(conn, tls.WithDestination(dest), tls.WithNextProto("http/1.1"))
+				if err := internet.WriteProxyProtocol(ctx, conn, sockopt.SendProxyProtocol); err != nil {
+					conn.Close()
+					return nil, err
+				}
+				return conn, nil
+			}
+		} else {
+			tlsConfig := config.GetTLSConfig(tls.WithDestination(dest), tls.WithNextProto("http/1.1"))
+			dialer.TLSClientConfig = tlsConfig
+			scheme = "wss"
+			reportVerifyError = func(err error) {
+				config.ReportVerifyError(tlsConfig.ServerName, err)
+			}
+		}
 	}
 
 	host := dest.NetAddr()
 	if (protocol == "ws" && dest.Port == 80) || (protocol == "wss" && dest.Port == 443) {
 		host = dest.Address.String()
 	}
-	uri := protocol + "://" + host + wsSettings.GetNormalizedPath()
+	if _, isUnix := dest.UnixPath(); isUnix {
+		// The socket path is not a valid host. The connection is made to dest regardless.
+		host = "localhost"
+	}
+	uri := scheme + "://" + host + wsSettings.GetNormalizedPath()
 
 	conn, resp, err := dialer.Dial(uri, wsSettings.GetRequestHeader())
 	if err != nil {
+		if reportVerifyError != nil {
+			reportVerifyError(err)
+		}
 		var reason string
 		if resp != nil {
 			reason = resp.Status
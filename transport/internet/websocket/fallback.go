@@ -0,0 +1,72 @@
+// +build !confonly
+
+package websocket
+
+import (
+	"context"
+	"net/http"
+	"net/http/httputil"
+	"strings"
+	"time"
+
+	"v2ray.com/core/common/net"
+)
+
+// newFallbackHandler returns the handler of the requests that are not WebSocket upgrades.
+func newFallbackHandler(config *Fallback) http.Handler {
+	if config.Dest == "" {
+		return &staticHandler{config: config}
+	}
+	return newReverseProxy(config.Dest)
+}
+
+// staticHandler answers all requests with the static response of the fallback.
+type staticHandler struct {
+	config *Fallback
+}
+
+func (h *staticHandler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	header := writer.Header()
+	for key, value := range h.config.Header {
+		header.Set(key, value)
+	}
+	statusCode := int(h.config.StatusCode)
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+	writer.WriteHeader(statusCode)
+	if request.Method != http.MethodHead {
+		writer.Write([]byte(h.config.Body))
+	}
+}
+
+// newReverseProxy returns a handler that proxies requests to the HTTP server at dest. The Host
+// header of the requests is kept, and request and response bodies are streamed.
+func newReverseProxy(dest string) http.Handler {
+	network := "tcp"
+	if strings.HasPrefix(dest, "/") || strings.HasPrefix(dest, "@") {
+		network = "unix"
+	}
+	dialer := &net.Dialer{Timeout: 16 * time.Second}
+	return &httputil.ReverseProxy{
+		Director: func(request *http.Request) {
+			request.URL.Scheme = "http"
+			request.URL.Host = dest
+			if network == "unix" {
+				request.URL.Host = "localhost"
+			}
+		},
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, dest)
+			},
+			MaxIdleConns:    16,
+			IdleConnTimeout: time.Minute,
+		},
+		FlushInterval: -1,
+		ErrorHandler: func(writer http.ResponseWriter, request *http.Request, err error) {
+			newError("failed to proxy request to fallback ", dest).Base(err).AtWarning().WriteToLog()
+			writer.WriteHeader(http.StatusBadGateway)
+		},
+	}
+}
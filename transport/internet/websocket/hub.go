@@ -19,8 +19,9 @@ import (
 )
 
 type requestHandler struct {
-	path string
-	ln   *Listener
+	path     string
+	ln       *Listener
+	fallback http.Handler
 }
 
 var upgrader = &websocket.Upgrader{
@@ -33,6 +34,10 @@ var upgrader = &websocket.Upgrader{
 }
 
 func (h *requestHandler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	if h.fallback != nil && (request.URL.Path != h.path || !websocket.IsWebSocketUpgrade(request)) {
+		h.fallback.ServeHTTP(writer, request)
+		return
+	}
 	if request.URL.Path != h.path {
 		writer.WriteHeader(http.StatusNotFound)
 		return
@@ -61,7 +66,6 @@ type Listener struct {
 	listener net.Listener
 	config   *Config
 	addConn  internet.ConnHandler
-	locker   *internet.FileLocker // for unix domain socket
 }
 
 func ListenWS(ctx context.Context, address net.Address, port net.Port, streamSettings *internet.MemoryStreamConfig, addConn internet.ConnHandler) (internet.Listener, error) {
@@ -70,11 +74,11 @@ func ListenWS(ctx context.Context, address net.Address, port net.Port, streamSet
 	}
 	wsSettings := streamSettings.ProtocolSettings.(*Config)
 	l.config = wsSettings
-	if l.config != nil {
+	if l.config != nil && l.config.AcceptProxyProtocol {
 		if streamSettings.SocketSettings == nil {
 			streamSettings.SocketSettings = &internet.SocketConfig{}
 		}
-		streamSettings.SocketSettings.AcceptProxyProtocol = l.config.AcceptProxyProtocol
+		streamSettings.SocketSettings.AcceptProxyProtocol = true
 	}
 	var listener net.Listener
 	var err error
@@ -87,10 +91,6 @@ func ListenWS(ctx context.Context, address net.Address, port net.Port, streamSet
 			return nil, newError("failed to listen unix domain socket(for WS) on ", address).Base(err)
 		}
 		newError("listening unix domain socket(for WS) on ", address).WriteToLog(session.ExportIDToError(ctx))
-		locker := ctx.Value(address.Domain())
-		if locker != nil {
-			l.locker = locker.(*internet.FileLocker)
-		}
 	} else { // tcp
 		listener, err = internet.ListenSystem(ctx, &net.TCPAddr{
 			IP:   address.IP(),
@@ -109,16 +109,23 @@ func ListenWS(ctx context.Context, address net.Address, port net.Port, streamSet
 	if config := v2tls.ConfigFromStreamSettings(streamSettings); config != nil {
 		if tlsConfig := config.GetTLSConfig(); tlsConfig != nil {
 			listener = tls.NewListener(listener, tlsConfig)
+			if sockopt := streamSettings.SocketSettings; sockopt != nil && sockopt.AcceptProxyProtocol && sockopt.ProxyProtocolInsideTls {
+				listener = internet.NewProxyProtocolListener(listener)
+			}
 		}
 	}
 
 	l.listener = listener
 
+	handler := &requestHandler{
+		path: wsSettings.GetNormalizedPath(),
+		ln:   l,
+	}
+	if wsSettings.Fallback != nil {
+		handler.fallback = newFallbackHandler(wsSettings.Fallback)
+	}
 	l.server = http.Server{
-		Handler: &requestHandler{
-			path: wsSettings.GetNormalizedPath(),
-			ln:   l,
-		},
+		Handler:           handler,
 		ReadHeaderTimeout: time.Second * 4,
 		MaxHeaderBytes:    2048,
 	}
@@ -139,9 +146,6 @@ func (ln *Listener) Addr() net.Addr {
 
 // Close implements net.Listener.Close().
 func (ln *Listener) Close() error {
-	if ln.locker != nil {
-		ln.locker.Release()
-	}
 	return ln.listener.Close()
 }
 
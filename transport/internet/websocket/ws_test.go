@@ -2,7 +2,13 @@ package websocket_test
 
 import (
 	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
 	"time"
 
@@ -69,6 +75,51 @@ func Test_listenWSAndDial(t *testing.T) {
 	common.Must(listen.Close())
 }
 
+func Test_listenWSAndDial_UnixSocket(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix domain socket is not supported")
+	}
+
+	path := filepath.Join(os.TempDir(), "v2ray-ws-test.sock")
+	streamSettings := &internet.MemoryStreamConfig{
+		ProtocolName:     "websocket",
+		ProtocolSettings: &Config{Path: "ws"},
+	}
+	listen, err := ListenWS(context.Background(), net.DomainAddress(path), 0, streamSettings, func(conn internet.Connection) {
+		go func(c internet.Connection) {
+			defer c.Close()
+
+			var b [1024]byte
+			_, err := c.Read(b[:])
+			if err != nil {
+				return
+			}
+
+			common.Must2(c.Write([]byte("Response")))
+		}(conn)
+	})
+	common.Must(err)
+
+	conn, err := Dial(context.Background(), net.TCPDestination(net.DomainAddress(path), 0), streamSettings)
+	common.Must(err)
+	common.Must2(conn.Write([]byte("Test connection")))
+
+	var b [1024]byte
+	n, err := conn.Read(b[:])
+	common.Must(err)
+	if string(b[:n]) != "Response" {
+		t.Error("response: ", string(b[:n]))
+	}
+	conn.Close()
+
+	common.Must(listen.Close())
+	for _, file := range []string{path, path + ".lock"} {
+		if _, err := os.Stat(file); !os.IsNotExist(err) {
+			t.Error("file not removed: ", file)
+		}
+	}
+}
+
 func TestDialWithRemoteAddr(t *testing.T) {
 	listen, err := ListenWS(context.Background(), net.LocalHostIP, 13148, &internet.MemoryStreamConfig{
 		ProtocolName: "websocket",
@@ -146,3 +197,71 @@ func Test_listenWSAndDial_TLS(t *testing.T) {
 		t.Error("end: ", end, " start: ", start)
 	}
 }
+
+func Test_listenWSFallback(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		body, _ := ioutil.ReadAll(request.Body)
+		writer.Header().Set("X-Host", request.Host)
+		writer.Write([]byte(request.URL.Path + ":" + string(body)))
+	}))
+	defer backend.Close()
+
+	listenFallback := func(port net.Port, fallback *Fallback) internet.Listener {
+		listen, err := ListenWS(context.Background(), net.LocalHostIP, port, &internet.MemoryStreamConfig{
+			ProtocolName: "websocket",
+			ProtocolSettings: &Config{
+				Path:     "ws",
+				Fallback: fallback,
+			},
+		}, func(conn internet.Connection) {
+			conn.Close()
+		})
+		common.Must(err)
+		return listen
+	}
+
+	proxyListener := listenFallback(13150, &Fallback{
+		Dest: strings.TrimPrefix(backend.URL, "http://"),
+	})
+	defer proxyListener.Close()
+	staticListener := listenFallback(13151, &Fallback{
+		StatusCode: 200,
+		Header:     map[string]string{"Server": "nginx"},
+		Body:       "welcome",
+	})
+	defer staticListener.Close()
+
+	for _, path := range []string{"/ws", "/index.html"} {
+		request, err := http.NewRequest(http.MethodPost, "http://127.0.0.1:13150"+path, strings.NewReader("hello"))
+		common.Must(err)
+		request.Host = "example.com"
+		response, err := http.DefaultClient.Do(request)
+		common.Must(err)
+		body, err := ioutil.ReadAll(response.Body)
+		common.Must(err)
+		response.Body.Close()
+		if string(body) != path+":hello" {
+			t.Error("proxied body: ", string(body))
+		}
+		if host := response.Header.Get("X-Host"); host != "example.com" {
+			t.Error("proxied host: ", host)
+		}
+	}
+
+	response, err := http.Get("http://127.0.0.1:13151/ws")
+	common.Must(err)
+	body, err := ioutil.ReadAll(response.Body)
+	common.Must(err)
+	response.Body.Close()
+	if response.StatusCode != 200 || response.Header.Get("Server") != "nginx" || string(body) != "welcome" {
+		t.Error("static response: ", response.StatusCode, " ", response.Header, " ", string(body))
+	}
+
+	// WebSocket upgrades still work.
+	conn, err := Dial(context.Background(), net.TCPDestination(net.DomainAddress("localhost"), 13151), &internet.MemoryStreamConfig{
+		ProtocolName:     "websocket",
+		ProtocolSettings: &Config{Path: "ws"},
+	})
+	common.Must(err)
+	conn.Close()
+}
@@ -4,10 +4,14 @@ package core
 
 import (
 	"context"
+	"path"
 	"reflect"
+	"strings"
 	"sync"
 
 	"v2ray.com/core/common"
+	"v2ray.com/core/common/errors"
+	"v2ray.com/core/common/log"
 	"v2ray.com/core/common/serial"
 	"v2ray.com/core/features"
 	"v2ray.com/core/features/dns"
@@ -17,6 +21,7 @@ import (
 	"v2ray.com/core/features/policy"
 	"v2ray.com/core/features/routing"
 	"v2ray.com/core/features/stats"
+	"v2ray.com/core/transport/internet"
 )
 
 // Server is an instance of V2Ray. At any time, there must be at most one Server instance running.
@@ -87,13 +92,24 @@ func (r *resolution) resolve(allFeatures []features.Feature) (bool, error) {
 }
 
 // Instance combines all functionalities in V2Ray.
+//
+// Instances in the same process keep their features, handlers, transport settings, readv and logs of sessions
+// apart. They share only the settings of the Go runtime in SystemConfig, GC and the buffer pools, and the log of
+// messages that are not about a session, which goes to the log app created last.
 type Instance struct {
 	access             sync.Mutex
 	features           []features.Feature
 	featureResolutions []resolution
 	running            bool
 
-	ctx context.Context
+	// readiness guards order and started, which tell the progress of Start to NotReady. Start holds access
+	// throughout.
+	readiness sync.Mutex
+	order     []features.Feature
+	started   []bool
+
+	system *SystemConfig
+	ctx    context.Context
 }
 
 func AddInboundHandler(server *Instance, config *InboundHandlerConfig) error {
@@ -163,7 +179,7 @@ func New(config *Config) (*Instance, error) {
 
 	done, err := initInstanceWithConfig(config, server)
 	if done {
-		return nil, err
+		return nil, errors.Classify(err, errors.KindConfig)
 	}
 
 	return server, nil
@@ -174,19 +190,31 @@ func NewWithContext(ctx context.Context, config *Config) (*Instance, error) {
 
 	done, err := initInstanceWithConfig(config, server)
 	if done {
-		return nil, err
+		return nil, errors.Classify(err, errors.KindConfig)
 	}
 
 	return server, nil
 }
 
 func initInstanceWithConfig(config *Config, server *Instance) (bool, error) {
-	if config.Transport != nil {
-		features.PrintDeprecatedFeatureWarning("global transport settings")
+	if err := checkDisabledFeatures(config); err != nil {
+		return true, err
 	}
-	if err := config.Transport.Apply(); err != nil {
+
+	server.system = config.System
+	ctx, err := applySystemConfig(server.ctx, config.System)
+	if err != nil {
 		return true, err
 	}
+	// The log app of the instance, if any, registers its handler into the context, so that messages about
+	// sessions of the instance go to its own log.
+	server.ctx = log.ContextWithHandler(ctx)
+
+	if config.Transport != nil {
+		features.PrintDeprecatedFeatureWarning("global transport settings")
+		// Transport settings apply to the handlers of this instance only.
+		server.ctx = internet.ContextWithTransportSettings(server.ctx, config.Transport.TransportSettings)
+	}
 
 	for _, appSettings := range config.App {
 		settings, err := appSettings.GetInstance()
@@ -209,7 +237,7 @@ func initInstanceWithConfig(config *Config, server *Instance) (bool, error) {
 		Instance features.Feature
 	}{
 		{dns.ClientType(), localdns.New()},
-		{policy.ManagerType(), policy.DefaultManager{}},
+		{policy.ManagerType(), policy.DefaultManager{Buffer: &policy.Buffer{PerConnection: policy.DefaultBufferSizeFromContext(server.ctx)}}},
 		{routing.RouterType(), routing.DefaultRouter{}},
 		{stats.ManagerType(), stats.NoopManager{}},
 	}
@@ -247,6 +275,10 @@ func (s *Instance) Close() error {
 	defer s.access.Unlock()
 
 	s.running = false
+	s.readiness.Lock()
+	s.order = nil
+	s.started = nil
+	s.readiness.Unlock()
 
 	var errors []interface{}
 	for _, f := range s.features {
@@ -290,9 +322,14 @@ func (s *Instance) AddFeature(feature features.Feature) error {
 	s.features = append(s.features, feature)
 
 	if s.running {
-		if err := feature.Start(); err != nil {
+		err := feature.Start()
+		if err != nil {
 			newError("failed to start feature").Base(err).WriteToLog()
 		}
+		s.readiness.Lock()
+		s.order = append(s.order, feature)
+		s.started = append(s.started, err == nil)
+		s.readiness.Unlock()
 		return nil
 	}
 
@@ -324,19 +361,163 @@ func (s *Instance) GetFeature(featureType interface{}) features.Feature {
 	return getFeature(s.features, reflect.TypeOf(featureType))
 }
 
+// NotReady returns the names of the features that are not ready: the ones not started successfully, and the
+// ones that are not ready yet by features.HasReadiness after starting. Names are the last elements of the
+// packages of the feature types, such as "inbound" and "dns". All features are not ready before Start.
+func (s *Instance) NotReady() []string {
+	s.readiness.Lock()
+	defer s.readiness.Unlock()
+
+	if s.order == nil {
+		return []string{"core"}
+	}
+	var names []string
+	for i, f := range s.order {
+		if r, ok := f.(features.HasReadiness); !s.started[i] || (ok && !r.Ready()) {
+			names = append(names, readinessName(f))
+		}
+	}
+	return names
+}
+
+func readinessName(f features.Feature) string {
+	t := reflect.TypeOf(f.Type())
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return path.Base(t.PkgPath())
+}
+
+func featureName(f features.Feature) string {
+	return reflect.TypeOf(f.Type()).String()
+}
+
+func (s *Instance) featureIndex(t reflect.Type) int {
+	for i, f := range s.features {
+		if reflect.TypeOf(f.Type()) == t {
+			return i
+		}
+	}
+	return -1
+}
+
+// startOrder sorts the features so that each of them comes after the ones it depends on. Otherwise
+// features keep the order they are registered in, except that the inbound manager is started as late
+// as possible, so that no inbound accepts connections before the features it uses are started.
+func (s *Instance) startOrder() ([]features.Feature, error) {
+	deps := make([][]int, len(s.features))
+	for i, f := range s.features {
+		d, ok := f.(features.HasDependencies)
+		if !ok {
+			continue
+		}
+		for _, t := range d.Dependencies() {
+			idx := s.featureIndex(reflect.TypeOf(t))
+			if idx == -1 {
+				return nil, newError("feature ", featureName(f), " depends on ", reflect.TypeOf(t), ", which is not registered").WithKind(errors.KindInternal)
+			}
+			if idx != i {
+				deps[i] = append(deps[i], idx)
+			}
+		}
+	}
+
+	inboundManager := s.featureIndex(reflect.TypeOf(inbound.ManagerType()))
+	started := make([]bool, len(s.features))
+	order := make([]features.Feature, 0, len(s.features))
+	for len(order) < len(s.features) {
+		next := -1
+		for i := range s.features {
+			if started[i] || !allStarted(deps[i], started) {
+				continue
+			}
+			if next == -1 || next == inboundManager {
+				next = i
+			}
+		}
+		if next == -1 {
+			return nil, newError("dependency cycle among features: ", s.findCycle(deps, started)).WithKind(errors.KindInternal)
+		}
+		started[next] = true
+		order = append(order, s.features[next])
+	}
+	return order, nil
+}
+
+func allStarted(indexes []int, started []bool) bool {
+	for _, idx := range indexes {
+		if !started[idx] {
+			return false
+		}
+	}
+	return true
+}
+
+// findCycle describes a dependency cycle among the features that are not started.
+func (s *Instance) findCycle(deps [][]int, started []bool) string {
+	current := -1
+	for i := range s.features {
+		if !started[i] {
+			current = i
+			break
+		}
+	}
+	var path []int
+	visited := make(map[int]int)
+	for {
+		if pos, found := visited[current]; found {
+			path = append(path[pos:], current)
+			break
+		}
+		visited[current] = len(path)
+		path = append(path, current)
+		for _, idx := range deps[current] {
+			if !started[idx] {
+				current = idx
+				break
+			}
+		}
+	}
+	names := make([]string, len(path))
+	for i, idx := range path {
+		names[i] = featureName(s.features[idx])
+	}
+	return strings.Join(names, " -> ")
+}
+
 // Start starts the V2Ray instance, including all registered features. When Start returns error, the state of the instance is unknown.
 // A V2Ray instance can be started only once. Upon closing, the instance is not guaranteed to start again.
 //
+// Features are started after the ones they depend on, as declared by features.HasDependencies, and the
+// inbound manager is started last. Start fails if any callback passed to RequireFeatures is not yet called.
+//
 // v2ray:api:stable
 func (s *Instance) Start() error {
 	s.access.Lock()
 	defer s.access.Unlock()
 
+	if s.featureResolutions != nil {
+		return newError("not all dependencies are resolved").WithKind(errors.KindInternal)
+	}
+	order, err := s.startOrder()
+	if err != nil {
+		return err
+	}
+	applyGCConfig(s.system)
+
+	s.readiness.Lock()
+	s.order = order
+	s.started = make([]bool, len(order))
+	s.readiness.Unlock()
+
 	s.running = true
-	for _, f := range s.features {
+	for i, f := range order {
 		if err := f.Start(); err != nil {
 			return err
 		}
+		s.readiness.Lock()
+		s.started[i] = true
+		s.readiness.Unlock()
 	}
 
 	newError("V2Ray ", Version(), " started").AtWarning().WriteToLog()
@@ -1,24 +1,43 @@
 package core_test
 
 import (
+	"bytes"
+	"context"
+	goerrors "errors"
+	"io"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/golang/protobuf/proto"
+	"github.com/google/go-cmp/cmp"
+	gorilla "github.com/gorilla/websocket"
 	. "v2ray.com/core"
 	"v2ray.com/core/app/dispatcher"
+	applog "v2ray.com/core/app/log"
+	"v2ray.com/core/app/policy"
 	"v2ray.com/core/app/proxyman"
+	"v2ray.com/core/app/stats"
 	"v2ray.com/core/common"
+	"v2ray.com/core/common/errors"
+	clog "v2ray.com/core/common/log"
 	"v2ray.com/core/common/net"
 	"v2ray.com/core/common/protocol"
 	"v2ray.com/core/common/serial"
 	"v2ray.com/core/common/uuid"
 	"v2ray.com/core/features/dns"
 	"v2ray.com/core/features/dns/localdns"
+	"v2ray.com/core/features/inbound"
+	feature_stats "v2ray.com/core/features/stats"
 	_ "v2ray.com/core/main/distro/all"
 	"v2ray.com/core/proxy/dokodemo"
+	"v2ray.com/core/proxy/freedom"
 	"v2ray.com/core/proxy/vmess"
 	"v2ray.com/core/proxy/vmess/outbound"
 	"v2ray.com/core/testing/servers/tcp"
+	"v2ray.com/core/transport"
+	"v2ray.com/core/transport/internet"
+	"v2ray.com/core/transport/internet/websocket"
 )
 
 func TestV2RayDependency(t *testing.T) {
@@ -35,6 +54,271 @@ func TestV2RayDependency(t *testing.T) {
 	<-wait
 }
 
+type (
+	featureA struct{}
+	featureB struct{}
+	featureC struct{}
+)
+
+type orderedFeature struct {
+	typ     interface{}
+	deps    []interface{}
+	started *[]interface{}
+}
+
+func (f *orderedFeature) Type() interface{} {
+	return f.typ
+}
+
+func (f *orderedFeature) Dependencies() []interface{} {
+	return f.deps
+}
+
+func (f *orderedFeature) Start() error {
+	*f.started = append(*f.started, f.typ)
+	return nil
+}
+
+func (f *orderedFeature) Close() error {
+	return nil
+}
+
+func TestV2RayStartOrder(t *testing.T) {
+	a := (*featureA)(nil)
+	b := (*featureB)(nil)
+	c := (*featureC)(nil)
+	im := inbound.ManagerType()
+
+	// C depends on B, which depends on A. The inbound manager depends on nothing but must start last.
+	orders := [][]interface{}{
+		{im, c, b, a},
+		{c, b, a, im},
+		{b, im, a, c},
+		{a, b, c, im},
+	}
+	deps := map[interface{}][]interface{}{
+		b: {a},
+		c: {b},
+	}
+
+	for _, order := range orders {
+		var started []interface{}
+		instance := new(Instance)
+		for _, typ := range order {
+			common.Must(instance.AddFeature(&orderedFeature{typ: typ, deps: deps[typ], started: &started}))
+		}
+		common.Must(instance.Start())
+
+		expected := []interface{}{a, b, c, im}
+		if r := cmp.Diff(started, expected); r != "" {
+			t.Error("registered in ", order, ": ", r)
+		}
+	}
+}
+
+func TestV2RayDependencyCycle(t *testing.T) {
+	a := (*featureA)(nil)
+	b := (*featureB)(nil)
+	c := (*featureC)(nil)
+
+	var started []interface{}
+	instance := new(Instance)
+	common.Must(instance.AddFeature(&orderedFeature{typ: c, started: &started}))
+	common.Must(instance.AddFeature(&orderedFeature{typ: a, deps: []interface{}{b}, started: &started}))
+	common.Must(instance.AddFeature(&orderedFeature{typ: b, deps: []interface{}{a}, started: &started}))
+
+	err := instance.Start()
+	if err == nil || !strings.Contains(err.Error(), "dependency cycle") {
+		t.Fatal("expected dependency cycle, but got ", err)
+	}
+	if !goerrors.Is(err, errors.KindInternal) {
+		t.Error("expected internal error, but got ", errors.KindOf(err))
+	}
+	if len(started) != 0 {
+		t.Error("expected no feature started, but got ", started)
+	}
+}
+
+func TestV2RayMissingDependency(t *testing.T) {
+	var started []interface{}
+	instance := new(Instance)
+	common.Must(instance.AddFeature(&orderedFeature{typ: (*featureA)(nil), deps: []interface{}{(*featureB)(nil)}, started: &started}))
+
+	if err := instance.Start(); err == nil {
+		t.Error("expected error for missing dependency, but got nil")
+	}
+}
+
+func TestV2RayUnresolvedRequirement(t *testing.T) {
+	var started []interface{}
+	instance := new(Instance)
+	common.Must(instance.AddFeature(&orderedFeature{typ: inbound.ManagerType(), started: &started}))
+	common.Must(instance.RequireFeatures(func(d dns.Client) {}))
+
+	if err := instance.Start(); err == nil {
+		t.Error("expected error for unresolved requirement, but got nil")
+	}
+	if len(started) != 0 {
+		t.Error("expected no feature started, but got ", started)
+	}
+}
+
+func TestV2RayInstanceIsolation(t *testing.T) {
+	echo := &tcp.Server{
+		MsgProcessor: func(b []byte) []byte { return b },
+	}
+	dest, err := echo.Start()
+	common.Must(err)
+	defer echo.Close()
+
+	newInstance := func(path string, port, echoPort net.Port) *Instance {
+		config := &Config{
+			App: []*serial.TypedMessage{
+				serial.ToTypedMessage(&dispatcher.Config{}),
+				serial.ToTypedMessage(&proxyman.InboundConfig{}),
+				serial.ToTypedMessage(&proxyman.OutboundConfig{}),
+				serial.ToTypedMessage(&stats.Config{}),
+				serial.ToTypedMessage(&policy.Config{
+					System: &policy.SystemPolicy{
+						Stats: &policy.SystemPolicy_Stats{
+							InboundUplink: true,
+						},
+					},
+				}),
+				serial.ToTypedMessage(&applog.Config{
+					ErrorLogLevel: clog.Severity_Debug,
+				}),
+			},
+			Transport: &transport.Config{
+				TransportSettings: []*internet.TransportConfig{
+					{
+						ProtocolName: "websocket",
+						Settings:     serial.ToTypedMessage(&websocket.Config{Path: path}),
+					},
+				},
+			},
+			Inbound: []*InboundHandlerConfig{
+				{
+					ReceiverSettings: serial.ToTypedMessage(&proxyman.ReceiverConfig{
+						PortRange:      net.SinglePortRange(port),
+						Listen:         net.NewIPOrDomain(net.LocalHostIP),
+						StreamSettings: &internet.StreamConfig{ProtocolName: "websocket"},
+					}),
+					ProxySettings: serial.ToTypedMessage(&dokodemo.Config{
+						Address:  net.NewIPOrDomain(net.LocalHostIP),
+						Port:     uint32(port),
+						Networks: []net.Network{net.Network_TCP},
+					}),
+				},
+				{
+					Tag: "test",
+					ReceiverSettings: serial.ToTypedMessage(&proxyman.ReceiverConfig{
+						PortRange: net.SinglePortRange(echoPort),
+						Listen:    net.NewIPOrDomain(net.LocalHostIP),
+					}),
+					ProxySettings: serial.ToTypedMessage(&dokodemo.Config{
+						Address:  net.NewIPOrDomain(dest.Address),
+						Port:     uint32(dest.Port),
+						Networks: []net.Network{net.Network_TCP},
+					}),
+				},
+			},
+			Outbound: []*OutboundHandlerConfig{
+				{
+					ProxySettings: serial.ToTypedMessage(&freedom.Config{}),
+				},
+			},
+		}
+		instance, err := New(config)
+		common.Must(err)
+		return instance
+	}
+
+	portA := tcp.PickPort()
+	portB := tcp.PickPort()
+	echoPortA := tcp.PickPort()
+	echoPortB := tcp.PickPort()
+	a := newInstance("/a", portA, echoPortA)
+	b := newInstance("/b", portB, echoPortB)
+	common.Must(a.Start())
+	defer a.Close()
+	common.Must(b.Start())
+	defer b.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	logsA := a.GetFeature((*applog.Instance)(nil)).(*applog.Instance).Follow(ctx, 1024)
+	logsB := b.GetFeature((*applog.Instance)(nil)).(*applog.Instance).Follow(ctx, 1024)
+
+	// Traffic through an inbound of one instance is counted and logged by that instance only.
+	conn, err := net.DialTCP("tcp", nil, &net.TCPAddr{IP: []byte{127, 0, 0, 1}, Port: int(echoPortA)})
+	common.Must(err)
+	payload := make([]byte, 1024)
+	common.Must2(conn.Write(payload))
+	common.Must2(io.ReadFull(conn, payload))
+	conn.Close()
+
+	uplink := func(v *Instance) int64 {
+		c := v.GetFeature(feature_stats.ManagerType()).(feature_stats.Manager).GetCounter("inbound>>>test>>>traffic>>>uplink")
+		if c == nil {
+			t.Fatal("counter not registered")
+		}
+		return c.Value()
+	}
+	if v := uplink(a); v != 1024 {
+		t.Error("expected uplink 1024 of instance a, but got ", v)
+	}
+	if v := uplink(b); v != 0 {
+		t.Error("expected no uplink of instance b, but got ", v)
+	}
+
+	sessions := func(logs <-chan *clog.GeneralMessage) map[uint32]bool {
+		ids := make(map[uint32]bool)
+		for {
+			select {
+			case msg := <-logs:
+				if msg.SessionID != 0 {
+					ids[msg.SessionID] = true
+				}
+			case <-time.After(time.Millisecond * 200):
+				return ids
+			}
+		}
+	}
+	sessionsA := sessions(logsA)
+	if len(sessionsA) == 0 {
+		t.Error("expected logs of the session in instance a")
+	}
+	for id := range sessions(logsB) {
+		if sessionsA[id] {
+			t.Error("expected no logs of session ", id, " in instance b")
+		}
+	}
+
+	mss, err := internet.ToMemoryStreamConfig(&internet.StreamConfig{ProtocolName: "websocket"})
+	common.Must(err)
+	if path := mss.ProtocolSettings.(*websocket.Config).Path; path != "" {
+		t.Error("expected transport settings of instances not applied globally, but got path ", path)
+	}
+
+	dial := func(port net.Port, path string) error {
+		conn, _, err := gorilla.DefaultDialer.Dial("ws://127.0.0.1:"+port.String()+path, nil)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+	if err := dial(portA, "/a"); err != nil {
+		t.Error("expected inbound of instance a to serve its own path, but got ", err)
+	}
+	if err := dial(portB, "/b"); err != nil {
+		t.Error("expected inbound of instance b to serve its own path, but got ", err)
+	}
+	if err := dial(portA, "/b"); err == nil {
+		t.Error("expected inbound of instance a to reject the path of instance b")
+	}
+}
+
 func TestV2RayClose(t *testing.T) {
 	port := tcp.PickPort()
 
@@ -88,3 +372,40 @@ func TestV2RayClose(t *testing.T) {
 	common.Must(err)
 	server.Close()
 }
+
+func TestV2RayErrorKinds(t *testing.T) {
+	if _, err := LoadConfig("protobuf", "", bytes.NewReader([]byte{0xff})); !goerrors.Is(err, errors.KindConfig) {
+		t.Error("expected config error, but got ", err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	common.Must(err)
+	defer listener.Close()
+	port := net.Port(listener.Addr().(*net.TCPAddr).Port)
+
+	server, err := New(&Config{
+		App: []*serial.TypedMessage{
+			serial.ToTypedMessage(&dispatcher.Config{}),
+			serial.ToTypedMessage(&proxyman.InboundConfig{}),
+			serial.ToTypedMessage(&proxyman.OutboundConfig{}),
+		},
+		Inbound: []*InboundHandlerConfig{
+			{
+				ReceiverSettings: serial.ToTypedMessage(&proxyman.ReceiverConfig{
+					PortRange: net.SinglePortRange(port),
+					Listen:    net.NewIPOrDomain(net.LocalHostIP),
+				}),
+				ProxySettings: serial.ToTypedMessage(&dokodemo.Config{
+					Address:  net.NewIPOrDomain(net.LocalHostIP),
+					Port:     80,
+					Networks: []net.Network{net.Network_TCP},
+				}),
+			},
+		},
+	})
+	common.Must(err)
+	defer server.Close()
+	if err := server.Start(); !goerrors.Is(err, errors.KindBind) {
+		t.Error("expected bind error, but got ", err)
+	}
+}
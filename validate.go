@@ -0,0 +1,138 @@
+// +build !confonly
+
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"v2ray.com/core/common"
+	"v2ray.com/core/common/errors"
+	"v2ray.com/core/common/serial"
+)
+
+// configValidator collects the problems of a config, with their positions in the config tree.
+type configValidator struct {
+	problems []string
+}
+
+func (v *configValidator) report(path string, values ...interface{}) {
+	v.problems = append(v.problems, path+": "+serial.Concat(values...))
+}
+
+// unknownFieldNumbers returns the numbers of the fields in the unknown bytes of a message.
+func unknownFieldNumbers(b []byte) []protowire.Number {
+	var numbers []protowire.Number
+	for len(b) > 0 {
+		number, _, n := protowire.ConsumeField(b)
+		if n < 0 {
+			break
+		}
+		numbers = append(numbers, number)
+		b = b[n:]
+	}
+	return numbers
+}
+
+// checkUnknown reports the fields of m that this build doesn't know, which are dropped silently otherwise.
+func (v *configValidator) checkUnknown(path string, m protoreflect.Message) {
+	if unknown := m.GetUnknown(); len(unknown) > 0 {
+		v.report(path, "unknown fields ", unknownFieldNumbers(unknown), " of ", m.Descriptor().FullName())
+	}
+}
+
+// walk checks m and all messages in it.
+func (v *configValidator) walk(path string, m protoreflect.Message) {
+	v.checkUnknown(path, m)
+	m.Range(func(fd protoreflect.FieldDescriptor, value protoreflect.Value) bool {
+		fieldPath := path + "." + string(fd.Name())
+		switch {
+		case fd.IsList() && fd.Message() != nil:
+			list := value.List()
+			for i := 0; i < list.Len(); i++ {
+				v.walkMessage(fmt.Sprintf("%s[%d]", fieldPath, i), list.Get(i).Message())
+			}
+		case fd.IsMap() && fd.MapValue().Message() != nil:
+			value.Map().Range(func(k protoreflect.MapKey, mv protoreflect.Value) bool {
+				v.walkMessage(fmt.Sprintf("%s[%v]", fieldPath, k.Interface()), mv.Message())
+				return true
+			})
+		case !fd.IsList() && !fd.IsMap() && fd.Message() != nil:
+			v.walkMessage(fieldPath, value.Message())
+		}
+		return true
+	})
+}
+
+func (v *configValidator) walkMessage(path string, m protoreflect.Message) {
+	if tm, ok := m.Interface().(*serial.TypedMessage); ok {
+		v.walkTyped(path, tm, false)
+		return
+	}
+	v.walk(path, m)
+}
+
+// walkTyped checks the message in tm. If creatable, the message must be a config registered through
+// common.RegisterConfig(), such as the config of a feature or a proxy.
+func (v *configValidator) walkTyped(path string, tm *serial.TypedMessage, creatable bool) {
+	if tm == nil {
+		return
+	}
+	v.checkUnknown(path, proto.MessageV2(tm).ProtoReflect())
+	instance, err := tm.GetInstance()
+	if err != nil {
+		if _, typeErr := serial.GetInstance(tm.Type); typeErr != nil {
+			v.report(path, "unknown type ", tm.Type, ", which is not in this build")
+		} else {
+			v.report(path, "invalid ", tm.Type, ": ", err)
+		}
+		return
+	}
+	if creatable && !common.IsConfigRegistered(instance) {
+		v.report(path, tm.Type, " is not registered, as the feature it configures is not in this build")
+	}
+	v.walk(path+"("+tm.Type+")", proto.MessageV2(instance).ProtoReflect())
+}
+
+// ValidateConfig checks that every part of the config is understood by this build. It reports the fields
+// and the types of messages that are unknown, as well as configs of features that are not compiled in,
+// which would be dropped silently, or fail core.New with less helpful errors. Extensions are not checked,
+// as they are optional.
+func ValidateConfig(config *Config) error {
+	v := new(configValidator)
+	v.checkUnknown("config", proto.MessageV2(config).ProtoReflect())
+
+	for i, app := range config.App {
+		v.walkTyped(fmt.Sprintf("app[%d]", i), app, true)
+	}
+	for i, ib := range config.Inbound {
+		path := fmt.Sprintf("inbound[%d]", i)
+		if len(ib.Tag) > 0 {
+			path += "[" + ib.Tag + "]"
+		}
+		v.checkUnknown(path, proto.MessageV2(ib).ProtoReflect())
+		v.walkTyped(path+".receiver_settings", ib.ReceiverSettings, false)
+		v.walkTyped(path+".proxy_settings", ib.ProxySettings, true)
+	}
+	for i, ob := range config.Outbound {
+		path := fmt.Sprintf("outbound[%d]", i)
+		if len(ob.Tag) > 0 {
+			path += "[" + ob.Tag + "]"
+		}
+		v.checkUnknown(path, proto.MessageV2(ob).ProtoReflect())
+		v.walkTyped(path+".sender_settings", ob.SenderSettings, false)
+		v.walkTyped(path+".proxy_settings", ob.ProxySettings, true)
+	}
+	if config.Transport != nil {
+		v.walk("transport", proto.MessageV2(config.Transport).ProtoReflect())
+	}
+
+	if len(v.problems) > 0 {
+		return newError("invalid config:\n  ", strings.Join(v.problems, "\n  ")).WithKind(errors.KindConfig)
+	}
+	return nil
+}
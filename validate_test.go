@@ -0,0 +1,126 @@
+package core_test
+
+import (
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	. "v2ray.com/core"
+	"v2ray.com/core/app/dispatcher"
+	"v2ray.com/core/app/proxyman"
+	"v2ray.com/core/common"
+	"v2ray.com/core/common/errors"
+	"v2ray.com/core/common/net"
+	"v2ray.com/core/common/protocol"
+	"v2ray.com/core/common/serial"
+	"v2ray.com/core/proxy/dokodemo"
+	"v2ray.com/core/proxy/vmess/outbound"
+)
+
+func TestValidateConfig(t *testing.T) {
+	valid := func() *Config {
+		return &Config{
+			App: []*serial.TypedMessage{
+				serial.ToTypedMessage(&dispatcher.Config{}),
+				serial.ToTypedMessage(&proxyman.InboundConfig{}),
+				serial.ToTypedMessage(&proxyman.OutboundConfig{}),
+			},
+			Inbound: []*InboundHandlerConfig{
+				{
+					Tag: "in",
+					ReceiverSettings: serial.ToTypedMessage(&proxyman.ReceiverConfig{
+						PortRange: net.SinglePortRange(10000),
+					}),
+					ProxySettings: serial.ToTypedMessage(&dokodemo.Config{
+						Address:  net.NewIPOrDomain(net.LocalHostIP),
+						Port:     80,
+						Networks: []net.Network{net.Network_TCP},
+					}),
+				},
+			},
+			Outbound: []*OutboundHandlerConfig{
+				{
+					ProxySettings: serial.ToTypedMessage(&outbound.Config{
+						Receiver: []*protocol.ServerEndpoint{
+							{
+								Address: net.NewIPOrDomain(net.LocalHostIP),
+								Port:    443,
+								User: []*protocol.User{
+									{
+										Account: &serial.TypedMessage{Type: "v2ray.core.proxy.vmess.Account"},
+									},
+								},
+							},
+						},
+					}),
+				},
+			},
+		}
+	}
+
+	common.Must(ValidateConfig(valid()))
+
+	cases := []struct {
+		name    string
+		modify  func(*Config)
+		problem string
+	}{
+		{
+			name: "unknown app",
+			modify: func(c *Config) {
+				c.App = append(c.App, &serial.TypedMessage{Type: "v2ray.core.app.future.Config"})
+			},
+			problem: "app[3]: unknown type v2ray.core.app.future.Config",
+		},
+		{
+			name: "unknown field",
+			modify: func(c *Config) {
+				value := c.App[0].Value
+				value = protowire.AppendTag(value, 99, protowire.VarintType)
+				value = protowire.AppendVarint(value, 1)
+				c.App[0].Value = value
+			},
+			problem: "app[0](v2ray.core.app.dispatcher.Config): unknown fields [99] of v2ray.core.app.dispatcher.Config",
+		},
+		{
+			name: "unregistered proxy",
+			modify: func(c *Config) {
+				c.Inbound[0].ProxySettings = serial.ToTypedMessage(&proxyman.SenderConfig{})
+			},
+			problem: "inbound[0][in].proxy_settings: v2ray.core.app.proxyman.SenderConfig is not registered",
+		},
+		{
+			name: "unknown nested type",
+			modify: func(c *Config) {
+				c.Outbound[0].ProxySettings = serial.ToTypedMessage(&outbound.Config{
+					Receiver: []*protocol.ServerEndpoint{
+						{
+							User: []*protocol.User{
+								{
+									Account: &serial.TypedMessage{Type: "v2ray.core.proxy.future.Account"},
+								},
+							},
+						},
+					},
+				})
+			},
+			problem: "outbound[0].proxy_settings(v2ray.core.proxy.vmess.outbound.Config).Receiver[0].user[0].account: unknown type v2ray.core.proxy.future.Account",
+		},
+	}
+	for _, c := range cases {
+		config := valid()
+		c.modify(config)
+		err := ValidateConfig(config)
+		if err == nil {
+			t.Error(c.name, ": expected error")
+			continue
+		}
+		if !strings.Contains(err.Error(), c.problem) {
+			t.Error(c.name, ": expected ", c.problem, ", but got ", err)
+		}
+		if errors.KindOf(err) != errors.KindConfig {
+			t.Error(c.name, ": expected config error, but got ", errors.KindOf(err))
+		}
+	}
+}